@@ -11,16 +11,28 @@ import (
 )
 
 type Config struct {
-	App      AppConfig
-	Database DatabaseConf
-	Log      LogConf
-	Mail     MailConf
-	Cookie   CookieConf
-	Etcd     EtcdConf
-	TLS      TLSConfig
-	OSS      OSSConfig
-	AI       AIConfig
-	MQ       MQConfig
+	App       AppConfig
+	JWT       JWTConf
+	Database  DatabaseConf
+	Log       LogConf
+	Mail      MailConf
+	Cookie    CookieConf
+	Etcd      EtcdConf
+	TLS       TLSConfig
+	OSS       OSSConfig
+	AI        AIConfig
+	MQ        MQConfig
+	Order     OrderConf
+	Logistics LogisticsConf
+	SMS       SMSConf
+	Security  SecurityConf
+	OAuth     OAuthConf
+	Account   AccountConf
+	Vip       VipConf
+	Payment   PaymentConf
+	Search    SearchConf
+	Image     ImageConf
+	GRPC      GRPCConf
 }
 
 type AppConfig struct {
@@ -37,6 +49,22 @@ type AppConfig struct {
 	UidCount             int    `mapstructure:"uid_count"`
 }
 
+// JWTConf token 签名密钥配置. 未配置密钥时使用 HS256 和 App.JWTSecret 签名
+type JWTConf struct {
+	ActiveKID string       `mapstructure:"active_kid"` // 签发新 token 使用的密钥
+	Keys      []JWTKeyConf `mapstructure:"keys"`       // 全部可用于验证的密钥, 轮换后旧密钥保留到其签发的 token 全部过期
+}
+
+// JWTKeyConf 签名密钥, 私钥和公钥可以配置 PEM 文件路径或直接配置 PEM 内容
+type JWTKeyConf struct {
+	KID            string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"algorithm"`        // RS256 或 EdDSA
+	PrivateKeyFile string `mapstructure:"private_key_file"` // 只用于验证的旧密钥可以不配置私钥
+	PublicKeyFile  string `mapstructure:"public_key_file"`  // 未配置时从私钥导出
+	PrivateKey     string `mapstructure:"private_key"`
+	PublicKey      string `mapstructure:"public_key"`
+}
+
 type DatabaseConf struct {
 	MySQL MySQLConf `mapstructure:"mysql"`
 	Redis RedisConf `mapstructure:"redis"`
@@ -150,9 +178,11 @@ type AdvancedConfig struct {
 // oos 存储配置
 type OSSConfig struct {
 	Enable bool
-	// OSSAccessKeyID 对应 腾讯云COS: SecretId  亚马逊 S3: Access Key ID
+	// Provider 对象存储服务商: tencent(默认)、aliyun 或 s3(兼容 MinIO 等 S3 协议的服务)
+	Provider string `mapstructure:"provider"`
+	// OSSAccessKeyID 对应 腾讯云COS: SecretId  阿里云OSS: AccessKey ID  亚马逊 S3: Access Key ID
 	OSSAccessKeyID string `mapstructure:"OSS_AccessKey_ID"`
-	// OSSAccessKeySecret 对应 腾讯云COS: SecretKey  亚马逊 S3: Secret Access Key
+	// OSSAccessKeySecret 对应 腾讯云COS: SecretKey  阿里云OSS: AccessKey Secret  亚马逊 S3: Secret Access Key
 	OSSAccessKeySecret string `mapstructure:"OSS_AccessKey_Secret"`
 
 	TencentCOS  TencentCosConfig
@@ -169,13 +199,16 @@ type TencentCosConfig struct {
 
 type AliCloudOssConfig struct {
 	Bucket   string `mapstructure:"bucket"`
-	Endpoint string `mapstructure:"endpoint"`
+	Endpoint string `mapstructure:"endpoint"` // 地域节点, 如 oss-cn-hangzhou.aliyuncs.com, 不带协议时使用 https
 	//AccessKeyID     string `mapstructure:"access_key_id"`
 	//AccessKeySecret string `mapstructure:"access_key_secret"`
 }
 
 type AmazonS3Config struct {
-	Bucket string `mapstructure:"bucket"`
+	Bucket    string `mapstructure:"bucket"`
+	Region    string `mapstructure:"region"`     // 默认 us-east-1
+	Endpoint  string `mapstructure:"endpoint"`   // 为空时使用 AWS, MinIO 等兼容服务填写服务地址, 如 http://127.0.0.1:9000
+	PathStyle bool   `mapstructure:"path_style"` // 使用 endpoint/bucket/key 形式的地址, MinIO 通常需要开启
 	//AccessKeyID     string `mapstructure:"access_key_id"`
 	//AccessKeySecret string `mapstructure:"secret_access_key"`
 }
@@ -188,6 +221,113 @@ type DeepSeekConfig struct {
 	ApiKey string `mapstructure:"api_key"`
 }
 
+// OrderConf 订单配置, 金额单位为分
+type OrderConf struct {
+	ShippingFee int64 `mapstructure:"shipping_fee"` // 默认运费
+}
+
+// LogisticsConf 物流配置
+type LogisticsConf struct {
+	Carriers        []string      `mapstructure:"carriers"`          // 启用的承运商编码
+	FixtureDir      string        `mapstructure:"fixture_dir"`       // 本地轨迹文件目录, 用于测试和联调
+	SyncInterval    time.Duration `mapstructure:"sync_interval"`     // 轨迹同步及自动确认收货的执行间隔
+	AutoConfirmDays int           `mapstructure:"auto_confirm_days"` // 签收后自动确认收货天数
+}
+
+// SMSConf 短信验证码配置
+type SMSConf struct {
+	Provider        string        `mapstructure:"provider"`          // 短信服务商, log 表示只写日志, 用于开发和测试
+	SignName        string        `mapstructure:"sign_name"`         // 短信签名
+	TemplateCode    string        `mapstructure:"template_code"`     // 验证码短信模板
+	Secret          string        `mapstructure:"secret"`            // 验证码摘要和发送记录签名使用的密钥
+	CodeTTL         time.Duration `mapstructure:"code_ttl"`          // 验证码有效期
+	ResendInterval  time.Duration `mapstructure:"resend_interval"`   // 同一手机号两次发送的最小间隔
+	MaxAttempts     int           `mapstructure:"max_attempts"`      // 每个验证码允许输错的次数, 超过后验证码作废
+	PhoneDailyLimit int           `mapstructure:"phone_daily_limit"` // 每个手机号每天最多发送次数
+	IPDailyLimit    int           `mapstructure:"ip_daily_limit"`    // 每个 IP 每天最多发送次数
+}
+
+// SecurityConf 登录防暴力破解配置
+type SecurityConf struct {
+	FailureWindow      time.Duration `mapstructure:"failure_window"`       // 统计登录失败次数的滑动窗口
+	DelayAfter         int           `mapstructure:"delay_after"`          // 窗口内失败达到该次数后, 每次失败都要等待一段时间才能再试
+	BaseDelay          time.Duration `mapstructure:"base_delay"`           // 首次等待时间, 之后每多失败一次翻倍
+	MaxDelay           time.Duration `mapstructure:"max_delay"`            // 等待时间上限
+	AccountMaxFailures int           `mapstructure:"account_max_failures"` // 账号在窗口内失败达到该次数后锁定
+	IPMaxFailures      int           `mapstructure:"ip_max_failures"`      // IP 在窗口内失败达到该次数后锁定
+	LockoutDuration    time.Duration `mapstructure:"lockout_duration"`     // 锁定时长
+	CodeMaxAttempts    int           `mapstructure:"code_max_attempts"`    // 每个邮箱验证码允许输错的次数, 超过后验证码作废
+	TOTPIssuer         string        `mapstructure:"totp_issuer"`          // 两步验证在验证器中显示的发行方
+	TOTPKey            string        `mapstructure:"totp_key"`             // 加密 TOTP 密钥使用的密钥
+	TrustedProxies     []string      `mapstructure:"trusted_proxies"`      // 信任的反向代理(IP 或 CIDR), 只有经过这些代理的请求才读取 X-Forwarded-For
+}
+
+// AccountConf 账号注销配置
+type AccountConf struct {
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period"` // 申请注销后的冷静期, 期间可以撤销
+	PurgeInterval       time.Duration `mapstructure:"purge_interval"`        // 清理到期注销申请的执行间隔
+}
+
+// VipConf 会员配置
+type VipConf struct {
+	ExpireInterval time.Duration `mapstructure:"expire_interval"` // 处理到期会员(自动续费或过期)的执行间隔
+	EarnWindow     time.Duration `mapstructure:"earn_window"`     // 统计消费金额的时间窗口, 用于判断能否获得消费达标的会员
+}
+
+// PaymentConf 支付配置
+type PaymentConf struct {
+	Provider string `mapstructure:"provider"`  // 支付服务商, 为空时拒绝所有扣款; log 表示只写日志并直接成功, 用于开发和测试
+	AllowLog bool   `mapstructure:"allow_log"` // 是否允许使用 log, 生产环境不能开启
+}
+
+// SearchConf 商品搜索配置
+type SearchConf struct {
+	Backend           string            `mapstructure:"backend"`            // memory、meilisearch 或 elasticsearch(兼容 OpenSearch), memory 不持久化, 启动时从数据库重建
+	Timeout           time.Duration     `mapstructure:"timeout"`            // 请求搜索服务的超时时间
+	SyncInterval      time.Duration     `mapstructure:"sync_interval"`      // 轮询商品变更事件的间隔
+	ReconcileInterval time.Duration     `mapstructure:"reconcile_interval"` // 比对数据库与索引并修复差异的间隔
+	MaxAttempts       int               `mapstructure:"max_attempts"`       // 变更事件同步失败的最大尝试次数, 超过后转为死信
+	Meilisearch       MeilisearchConf   `mapstructure:"meilisearch"`
+	Elasticsearch     ElasticsearchConf `mapstructure:"elasticsearch"`
+}
+
+// MeilisearchConf Meilisearch 配置
+type MeilisearchConf struct {
+	Host   string `mapstructure:"host"`    // 如 http://127.0.0.1:7700
+	APIKey string `mapstructure:"api_key"` // 需要有索引管理权限
+	Index  string `mapstructure:"index"`   // 商品索引名, 默认 products
+}
+
+// ElasticsearchConf Elasticsearch/OpenSearch 配置
+type ElasticsearchConf struct {
+	Host     string `mapstructure:"host"`     // 如 http://127.0.0.1:9200
+	Username string `mapstructure:"username"` // 为空时不使用 Basic 认证
+	Password string `mapstructure:"password"`
+	APIKey   string `mapstructure:"api_key"`  // 设置后优先于用户名密码
+	Alias    string `mapstructure:"alias"`    // 商品索引别名, 实际索引按映射版本命名, 默认 products
+	Analyzer string `mapstructure:"analyzer"` // 中文分词器: ik(需要 analysis-ik 插件)、smartcn(需要 analysis-smartcn 插件) 或 standard
+}
+
+// OAuthConf 第三方登录配置
+type OAuthConf struct {
+	StateTTL  time.Duration       `mapstructure:"state_ttl"` // 授权请求的有效期, 超时后回调失败
+	Providers []OAuthProviderConf `mapstructure:"providers"`
+}
+
+// OAuthProviderConf 第三方登录提供方. 端点为空时 oidc 通过 issuer 自动发现, github 和 wechat 使用官方地址
+type OAuthProviderConf struct {
+	Name         string   `mapstructure:"name"` // 路由中使用的名称, 如 google, github, wechat
+	Type         string   `mapstructure:"type"` // oidc, github 或 wechat
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"` // 在提供方登记的回调地址
+	Issuer       string   `mapstructure:"issuer"`       // oidc 发行方, 从 issuer/.well-known/openid-configuration 获取端点
+	Scopes       []string `mapstructure:"scopes"`
+	AuthURL      string   `mapstructure:"auth_url"`
+	TokenURL     string   `mapstructure:"token_url"`
+	UserInfoURL  string   `mapstructure:"user_info_url"`
+}
+
 type MQConfig struct {
 	RocketMQ RocketMQConfig
 }
@@ -286,3 +426,30 @@ func GetConfig() *Config {
 	}
 	return _conf
 }
+
+// ImageConf 图片处理配置, 上传后异步生成各尺寸的版本
+type ImageConf struct {
+	Workers    int             `mapstructure:"workers"`     // 并发处理的图片数, 默认 2
+	QueueSize  int             `mapstructure:"queue_size"`  // 等待处理的图片数上限, 默认 256, 队列满时的图片在下次启动时补处理
+	Quality    int             `mapstructure:"quality"`     // JPEG 和 WebP 的压缩质量, 默认 82
+	WebP       bool            `mapstructure:"webp"`        // 是否同时生成 WebP 版本, 需要安装 libwebp 的 cwebp
+	CWebP      string          `mapstructure:"cwebp"`       // cwebp 可执行文件路径, 默认从 PATH 查找
+	Sizes      []ImageSizeConf `mapstructure:"sizes"`       // 为空时使用 thumbnail(200)、medium(800)、large(1600)
+	GCInterval time.Duration   `mapstructure:"gc_interval"` // 回收无引用图片内容的间隔, 默认 1h
+	GCDelay    time.Duration   `mapstructure:"gc_delay"`    // 内容引用数归零后保留的时间, 默认 24h
+}
+
+// GRPCConf gRPC 图片服务配置, 与 gin 使用不同的端口
+type GRPCConf struct {
+	Addr         string        `mapstructure:"addr"`           // 监听地址, 默认 :50051
+	ChunkSize    int           `mapstructure:"chunk_size"`     // 下载时每个分片的字节数, 默认 256KB
+	MaxImageSize int64         `mapstructure:"max_image_size"` // 上传图片的大小上限, 默认 20MB
+	UploadDir    string        `mapstructure:"upload_dir"`     // 分片上传的暂存目录, 默认为系统临时目录下的 star-mall-uploads
+	UploadTTL    time.Duration `mapstructure:"upload_ttl"`     // 分片上传的进度在最后一个分片之后保留的时间, 默认 24h
+}
+
+// ImageSizeConf 图片尺寸, 按宽度等比缩小, 不会放大
+type ImageSizeConf struct {
+	Name  string `mapstructure:"name"`
+	Width int    `mapstructure:"width"`
+}
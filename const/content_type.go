@@ -47,3 +47,19 @@ var ContentTypeStringMap = map[int64]string{
 	ATW:  ".atw",
 	RAF:  ".raf",
 }
+
+// ContentTypeMIMEMap 图片格式对应的 MIME 类型, 不在表中的格式按 application/octet-stream 返回
+var ContentTypeMIMEMap = map[int64]string{
+	JPG:  "image/jpeg",
+	JPEG: "image/jpeg",
+	PNG:  "image/png",
+	WEBP: "image/webp",
+	GIF:  "image/gif",
+	BMP:  "image/bmp",
+	TIFF: "image/tiff",
+	HEIF: "image/heif",
+	DNG:  "image/x-adobe-dng",
+	CR3:  "image/x-canon-cr3",
+	NEF:  "image/x-nikon-nef",
+	RAF:  "image/x-fuji-raf",
+}
@@ -0,0 +1,30 @@
+package _const
+
+const (
+	// 优惠券类型
+	CouponTypeFixed        = 90 + iota // 固定金额减免
+	CouponTypePercent                  // 百分比折扣
+	CouponTypeThreshold                // 满减
+	CouponTypeFreeShipping             // 免运费
+)
+
+const (
+	// 优惠券发放方
+	CouponIssuerPlatform = 100 + iota // 平台券
+	CouponIssuerMerchant              // 商家券
+)
+
+const (
+	// 优惠券适用范围
+	CouponScopeAll      = 110 + iota // 全场通用
+	CouponScopeProduct               // 指定商品
+	CouponScopeCategory              // 指定分类
+	CouponScopeMerchant              // 指定商家
+)
+
+const (
+	// 用户优惠券状态
+	UserCouponUnused  = 120 + iota // 未使用
+	UserCouponUsed                 // 已使用
+	UserCouponExpired              // 已过期
+)
@@ -0,0 +1,10 @@
+package _const
+
+// 订单状态, 与 orders.order_status 字段保持一致
+const (
+	OrderStatusPendingPayment  = "待付款"
+	OrderStatusPendingShipment = "待发货"
+	OrderStatusShipped         = "已发货"
+	OrderStatusCompleted       = "已完成"
+	OrderStatusCanceled        = "已取消"
+)
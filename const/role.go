@@ -5,4 +5,13 @@ const (
 	UserRole = 40001 + iota
 	// MerchantRole 商家规则ID
 	MerchantRole
+	// AdminRole 管理员规则ID
+	AdminRole
+)
+
+// 系统内置角色编码, 与 sys_role 表中 is_system = 1 的角色对应
+const (
+	RoleCodeUser     = "user"
+	RoleCodeMerchant = "merchant"
+	RoleCodeAdmin    = "admin"
 )
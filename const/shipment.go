@@ -0,0 +1,9 @@
+package _const
+
+const (
+	// 物流状态
+	ShipmentStatusShipped   = 130 + iota // 已发货, 等待揽收
+	ShipmentStatusInTransit              // 运输中
+	ShipmentStatusDelivered              // 已签收
+	ShipmentStatusException              // 物流异常
+)
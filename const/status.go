@@ -12,3 +12,28 @@ const (
 	ProductStatusDeleted             // 已删除
 
 )
+
+// 商家审核状态
+const (
+	MerchantStatusPending  = 140 + iota // 待审核
+	MerchantStatusApproved              // 审核通过
+	MerchantStatusRejected              // 审核驳回
+)
+
+// 账号状态
+const (
+	AccountStatusBanned = 150 // 已封禁
+)
+
+// 账号注销申请状态
+const (
+	DeletionStatusPending   = 160 + iota // 冷静期内, 可以撤销
+	DeletionStatusCancelled              // 已撤销
+	DeletionStatusErased                 // 已完成注销
+)
+
+// 发件箱事件状态
+const (
+	OutboxStatusPending = 190 + iota // 待处理
+	OutboxStatusDead                 // 死信, 超过最大尝试次数, 需人工处理
+)
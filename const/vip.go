@@ -0,0 +1,14 @@
+package _const
+
+const (
+	// 会员状态
+	MembershipStatusActive  = 170 + iota // 生效中
+	MembershipStatusExpired              // 已过期
+)
+
+const (
+	// 会员订单类型
+	VipOrderPurchase = 180 + iota // 购买
+	VipOrderRenew                 // 自动续费
+	VipOrderEarn                  // 消费达标获得
+)
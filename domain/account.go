@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var (
+	// ErrDeletionPending 已经申请注销, 冷静期内不能重复申请
+	ErrDeletionPending = errors.New("account deletion already requested")
+	// ErrDeletionNotFound 没有处于冷静期的注销申请
+	ErrDeletionNotFound = errors.New("no pending account deletion")
+)
+
+// DeletionRequest 账号注销申请
+// @Description 账号注销申请, 冷静期结束前可以撤销
+type DeletionRequest struct {
+	UserID      int64 `db:"user_id" json:"userID"`
+	Status      int64 `db:"status" json:"status"`
+	RequestedAt int64 `db:"requested_at" json:"requestedAt"`
+	EraseAt     int64 `db:"erase_at" json:"eraseAt"` // 计划注销时间
+	CancelledAt int64 `db:"cancelled_at" json:"cancelledAt,omitempty"`
+	ErasedAt    int64 `db:"erased_at" json:"erasedAt,omitempty"`
+}
+
+// DataExportProfile 导出的个人资料, 不包含密码
+type DataExportProfile struct {
+	ID         int64           `db:"id" json:"id"`
+	Name       string          `db:"name" json:"name"`
+	Email      string          `db:"email" json:"email,omitempty"`
+	Phone      string          `db:"phone" json:"phone,omitempty"`
+	Sex        int             `db:"sex" json:"sex"`
+	Tags       json.RawMessage `db:"tags" json:"tags"`
+	CreateTime int64           `db:"create_time" json:"createTime"`
+	LastIP     string          `db:"last_ip" json:"lastIP,omitempty"`
+	IsVip      bool            `db:"is_vip" json:"isVip"`
+	RoleID     int64           `db:"role" json:"role"`
+}
+
+// DataExportCartItem 导出的购物车商品
+type DataExportCartItem struct {
+	ProductID    int64           `db:"product_id" json:"productID"`
+	ProductTitle string          `db:"product_title" json:"productTitle"`
+	CreatePrice  float64         `db:"create_price" json:"createPrice"`
+	Quantity     int64           `db:"quantity" json:"quantity"`
+	Specs        json.RawMessage `db:"specs" json:"specs"`
+	AddedAt      int64           `db:"added_at" json:"addedAt"`
+}
+
+// UserDataExport 用户个人数据导出
+// @Description 用户个人数据, 包括资料、收货地址、订单、收藏、购物车和绑定的第三方账号
+type UserDataExport struct {
+	ExportedAt int64                 `json:"exportedAt"`
+	Profile    *DataExportProfile    `json:"profile"`
+	Addresses  []*Address            `json:"addresses"`
+	Orders     []*OrderSummary       `json:"orders"`
+	Favourites []*ProductCollect     `json:"favourites"`
+	Cart       []*DataExportCartItem `json:"cart"`
+	Identities []*UserIdentity       `json:"identities"`
+}
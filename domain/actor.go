@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
+)
+
+// ErrForbidden 无权访问该资源
+var ErrForbidden = errors.New("forbidden")
+
+// Actor 发起请求的身份, 由 handler 从 JWT 中解析后传入 service 做归属校验
+type Actor struct {
+	ID   int64 // 用户ID或商家ID, 取决于 Role
+	Role int64
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.Role == _const.AdminRole
+}
+
+func (a Actor) IsUser() bool {
+	return a.Role == _const.UserRole
+}
+
+func (a Actor) IsMerchant() bool {
+	return a.Role == _const.MerchantRole
+}
+
+// OwnsUser 是否可以访问 userID 用户的资源, 管理员可以访问所有资源
+func (a Actor) OwnsUser(userID int64) bool {
+	return a.IsAdmin() || (a.IsUser() && a.ID != 0 && a.ID == userID)
+}
+
+// OwnsMerchant 是否可以访问 merchantID 商家的资源, 管理员可以访问所有资源
+func (a Actor) OwnsMerchant(merchantID int64) bool {
+	return a.IsAdmin() || (a.IsMerchant() && a.ID != 0 && a.ID == merchantID)
+}
@@ -1,14 +1,39 @@
 package domain
 
+import "errors"
+
+var (
+	ErrAdminDisabled = errors.New("管理员账号已停用")
+	ErrAccountBanned = errors.New("账号已被封禁")
+	// ErrMerchantNotApproved 商家尚未通过审核或已被驳回, 不能登录和访问商家接口
+	ErrMerchantNotApproved = errors.New("商家尚未通过审核")
+)
+
+// 管理员账号状态
+const (
+	AdminStatusDisabled = 0
+	AdminStatusEnabled  = 1
+)
+
 type Admin struct {
-	ID       int
-	UserName string
-	Password string
-	PhoneNum string
-	Email    string
-	Status   int
-	RoleID   int
-	AddTime  int
-	IsSuper  int
-	Role     Role
+	ID       int64  `db:"id" json:"id"`
+	UserName string `db:"user_name" json:"userName"`
+	Password string `db:"password" json:"-"`
+	PhoneNum string `db:"phone_num" json:"phoneNum"`
+	Email    string `db:"email" json:"email"`
+	Status   int    `db:"status" json:"status"`    // 状态：1-启用，0-停用
+	RoleID   int64  `db:"role_id" json:"roleId"`   // 额外角色ID, 管理员默认拥有系统管理员角色
+	AddTime  int64  `db:"add_time" json:"addTime"` // 创建时间
+	IsSuper  int    `db:"is_super" json:"isSuper"` // 是否超级管理员, 超级管理员拥有全部权限
+	Role     Role   `db:"-" json:"role,omitempty"`
+}
+
+// IsEnabled 判断管理员是否启用
+func (a *Admin) IsEnabled() bool {
+	return a.Status == AdminStatusEnabled
+}
+
+// IsSuperAdmin 判断是否为超级管理员
+func (a *Admin) IsSuperAdmin() bool {
+	return a.IsSuper == 1
 }
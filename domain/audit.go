@@ -0,0 +1,24 @@
+package domain
+
+// AuditLog 管理员操作审计日志
+type AuditLog struct {
+	ID        int64  `db:"id" json:"id"`
+	AdminID   int64  `db:"admin_id" json:"adminId"`
+	AdminName string `db:"admin_name" json:"adminName"`
+	Action    string `db:"action" json:"action"` // 方法 + 路由模板, 与权限匹配键一致
+	Path      string `db:"path" json:"path"`     // 实际请求路径
+	Params    string `db:"params" json:"params"` // 请求参数, 敏感字段已脱敏
+	Status    int    `db:"status" json:"status"` // 响应状态码
+	IP        string `db:"ip" json:"ip"`
+	CreatedAt int64  `db:"created_at" json:"createdAt"`
+}
+
+// AuditQuery 审计日志查询条件
+type AuditQuery struct {
+	AdminID int64
+	Action  string
+	StartAt int64
+	EndAt   int64
+	Limit   int
+	Offset  int
+}
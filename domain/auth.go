@@ -1,17 +1,36 @@
 package domain
 
+// PermissionAll 超级管理员拥有的通配权限
+const PermissionAll = "*"
+
 // 认证
 type Auth struct {
-	Id          int
-	ModuleName  string // 模块名称
-	ActionName  string // 操作名称
-	Type        int    // 类型
-	Url         string
-	ModuleID    int // 模块ID
-	Sort        int
-	Description string // 描述
-	Status      int
-	CreateTime  int64
-	UpdateTime  int64
-	UpdateUser  string
+	Id          int64  `db:"id" json:"id"`
+	ModuleName  string `db:"module_name" json:"moduleName"` // 模块名称
+	ActionName  string `db:"action_name" json:"actionName"` // 操作名称
+	Type        int    `db:"type" json:"type"`              // 类型：1-模块，2-菜单，3-操作
+	Method      string `db:"method" json:"method"`          // HTTP 方法
+	Url         string `db:"url" json:"url"`                // 路由模板, 如 /api/v1/admin/role/delete/:id
+	ModuleID    int64  `db:"module_id" json:"moduleId"`     // 模块ID
+	Sort        int    `db:"sort" json:"sort"`
+	Description string `db:"description" json:"description"` // 描述
+	Status      int    `db:"status" json:"status"`           // 状态：1-启用，0-禁用
+	CreateTime  int64  `db:"create_time" json:"createTime"`
+	UpdateTime  int64  `db:"update_time" json:"updateTime"`
+	UpdateUser  string `db:"update_user" json:"updateUser"`
+}
+
+// TableName 返回表名
+func (a *Auth) TableName() string {
+	return "sys_auth"
+}
+
+// Key 权限的匹配键, 由 HTTP 方法和路由模板组成
+func (a *Auth) Key() string {
+	return PermissionKey(a.Method, a.Url)
+}
+
+// PermissionKey 生成权限匹配键
+func PermissionKey(method, pattern string) string {
+	return method + " " + pattern
 }
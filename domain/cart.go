@@ -13,6 +13,7 @@ type CartItemVO struct {
 	ProductTitle    string                 `db:"product_title"`
 	CreatePrice     float64                `db:"create_price"`
 	NowPrice        float64                `db:"now_price"`
+	MemberPrice     float64                `db:"-" json:",omitempty"` // 会员价, 只对会员展示
 	ProductImageOss string                 `db:"product_image_oss"`
 	Quantity        int64                  `db:"quantity"` // 商品数量
 	Specs           map[string]interface{} `db:"specs"`    // 商品规格
@@ -0,0 +1,305 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"sort"
+)
+
+var (
+	// ErrCouponSoldOut 优惠券已领完
+	ErrCouponSoldOut = errors.New("优惠券已领完")
+	// ErrCouponClaimLimit 已达到每人限领数量
+	ErrCouponClaimLimit = errors.New("已达到领取上限")
+	// ErrCouponUnavailable 优惠券不可用(已使用、已过期或不属于当前用户)
+	ErrCouponUnavailable = errors.New("优惠券不可用")
+	// ErrCouponVipOnly 会员专享券, 会员等级不足
+	ErrCouponVipOnly = errors.New("会员专享优惠券, 会员等级不足")
+)
+
+// Int64List 以 JSON 数组形式存储在数据库中的 int64 列表
+type Int64List []int64
+
+// Value 实现 driver.Valuer
+func (l Int64List) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]int64(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (l *Int64List) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, (*[]int64)(l))
+	case string:
+		return json.Unmarshal([]byte(v), (*[]int64)(l))
+	default:
+		return fmt.Errorf("unsupported type for Int64List: %T", src)
+	}
+}
+
+// Contains 判断列表中是否包含 id
+func (l Int64List) Contains(id int64) bool {
+	for _, v := range l {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Coupon 优惠券模板, 金额单位均为分
+type Coupon struct {
+	ID           int64     `db:"id" json:"id"`
+	Name         string    `db:"name" json:"name"`
+	IssuerType   int       `db:"issuer_type" json:"issuerType"`      // 发放方: 平台/商家
+	MerchantID   int64     `db:"merchant_id" json:"merchantId"`      // 商家券所属商家
+	Type         int       `db:"type" json:"type"`                   // 优惠类型
+	Amount       int64     `db:"amount" json:"amount"`               // 减免金额, 免运费券为运费上限(0表示不限)
+	Threshold    int64     `db:"threshold" json:"threshold"`         // 使用门槛
+	Percent      int64     `db:"percent" json:"percent"`             // 折扣百分比, 如 15 表示减免 15%
+	MaxDiscount  int64     `db:"max_discount" json:"maxDiscount"`    // 百分比折扣的最高减免, 0 表示不限
+	ScopeType    int       `db:"scope_type" json:"scopeType"`        // 适用范围类型
+	ScopeIDs     Int64List `db:"scope_ids" json:"scopeIds"`          // 适用范围ID列表
+	StartAt      int64     `db:"start_at" json:"startAt"`            // 生效时间
+	EndAt        int64     `db:"end_at" json:"endAt"`                // 失效时间
+	TotalLimit   int64     `db:"total_limit" json:"totalLimit"`      // 发放总量, 0 表示不限
+	IssuedCount  int64     `db:"issued_count" json:"issuedCount"`    // 已发放数量
+	PerUserLimit int64     `db:"per_user_limit" json:"perUserLimit"` // 每人限领, 0 表示不限
+	VipLevel     int64     `db:"vip_level" json:"vipLevel"`          // 领取所需的会员等级, 0 表示不限
+	Status       int       `db:"status" json:"status"`
+	CreatedAt    int64     `db:"created_at" json:"createdAt"`
+	UpdatedAt    int64     `db:"updated_at" json:"updatedAt"`
+}
+
+// UserCoupon 用户领取到钱包中的优惠券
+type UserCoupon struct {
+	ID        int64   `db:"id" json:"id"`
+	CouponID  int64   `db:"coupon_id" json:"couponId"`
+	UserID    int64   `db:"user_id" json:"userId"`
+	Status    int     `db:"status" json:"status"`
+	OrderID   int64   `db:"order_id" json:"orderId,omitempty"`
+	ClaimedAt int64   `db:"claimed_at" json:"claimedAt"`
+	UsedAt    int64   `db:"used_at" json:"usedAt,omitempty"`
+	Coupon    *Coupon `db:"-" json:"coupon,omitempty"`
+}
+
+// CouponLine 参与优惠计算的订单行
+type CouponLine struct {
+	ProductID  int64
+	MerchantID int64
+	CateID     int64
+	Amount     int64 // 行小计
+}
+
+// OrderDiscount 订单优惠明细
+type OrderDiscount struct {
+	ID           int64 `db:"id" json:"id"`
+	OrderID      int64 `db:"order_id" json:"orderId"`
+	UserCouponID int64 `db:"user_coupon_id" json:"userCouponId"`
+	CouponID     int64 `db:"coupon_id" json:"couponId"`
+	CouponType   int   `db:"coupon_type" json:"couponType"`
+	Amount       int64 `db:"amount" json:"amount"`
+}
+
+// DiscountPlan 优惠计算结果
+type DiscountPlan struct {
+	Discounts []OrderDiscount
+	Total     int64 // 商品优惠合计(不含运费优惠)
+	Shipping  int64 // 运费优惠
+}
+
+// NewCoupon 创建优惠券模板并校验参数
+func NewCoupon(c *Coupon) (*Coupon, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c.Status = _const.StatusNotDeleted
+	return c, nil
+}
+
+// Validate 校验优惠券参数
+func (c *Coupon) Validate() error {
+	if c.Name == "" {
+		return errors.New("优惠券名称不能为空")
+	}
+	if c.EndAt <= c.StartAt {
+		return errors.New("优惠券有效期不合法")
+	}
+	if c.IssuerType == _const.CouponIssuerMerchant && c.MerchantID == 0 {
+		return errors.New("商家券必须指定商家")
+	}
+	if c.VipLevel < 0 {
+		return errors.New("会员等级不合法")
+	}
+	switch c.Type {
+	case _const.CouponTypeFixed, _const.CouponTypeThreshold:
+		if c.Amount <= 0 {
+			return errors.New("减免金额必须大于0")
+		}
+	case _const.CouponTypePercent:
+		if c.Percent <= 0 || c.Percent >= 100 {
+			return errors.New("折扣百分比必须在 1-99 之间")
+		}
+	case _const.CouponTypeFreeShipping:
+	default:
+		return errors.New("不支持的优惠券类型")
+	}
+	switch c.ScopeType {
+	case _const.CouponScopeAll:
+	case _const.CouponScopeProduct, _const.CouponScopeCategory, _const.CouponScopeMerchant:
+		if len(c.ScopeIDs) == 0 {
+			return errors.New("指定范围的优惠券必须提供范围ID")
+		}
+	default:
+		return errors.New("不支持的适用范围")
+	}
+	return nil
+}
+
+// IsActive 判断优惠券在 now 时刻是否可用
+func (c *Coupon) IsActive(now int64) bool {
+	return c.Status == _const.StatusNotDeleted && now >= c.StartAt && now < c.EndAt
+}
+
+// Applicable 判断订单行是否在优惠券适用范围内
+func (c *Coupon) Applicable(line CouponLine) bool {
+	if c.IssuerType == _const.CouponIssuerMerchant && line.MerchantID != c.MerchantID {
+		return false
+	}
+	switch c.ScopeType {
+	case _const.CouponScopeProduct:
+		return c.ScopeIDs.Contains(line.ProductID)
+	case _const.CouponScopeCategory:
+		return c.ScopeIDs.Contains(line.CateID)
+	case _const.CouponScopeMerchant:
+		return c.ScopeIDs.Contains(line.MerchantID)
+	default:
+		return true
+	}
+}
+
+// EligibleAmount 计算适用范围内的商品金额
+func (c *Coupon) EligibleAmount(lines []CouponLine) int64 {
+	var sum int64
+	for _, line := range lines {
+		if c.Applicable(line) {
+			sum += line.Amount
+		}
+	}
+	return sum
+}
+
+// Discount 计算优惠券可减免的金额, 未满足条件时返回 0
+func (c *Coupon) Discount(lines []CouponLine, shippingFee int64) int64 {
+	eligible := c.EligibleAmount(lines)
+	if eligible <= 0 || eligible < c.Threshold {
+		return 0
+	}
+
+	switch c.Type {
+	case _const.CouponTypeFixed, _const.CouponTypeThreshold:
+		return min(c.Amount, eligible)
+	case _const.CouponTypePercent:
+		discount := eligible * c.Percent / 100
+		if c.MaxDiscount > 0 {
+			discount = min(discount, c.MaxDiscount)
+		}
+		return discount
+	case _const.CouponTypeFreeShipping:
+		if c.Amount > 0 {
+			return min(c.Amount, shippingFee)
+		}
+		return shippingFee
+	}
+	return 0
+}
+
+// stackGroup 返回优惠券的叠加分组, 同一分组内只能使用一张
+func (c *Coupon) stackGroup() string {
+	if c.Type == _const.CouponTypeFreeShipping {
+		return "shipping"
+	}
+	if c.IssuerType == _const.CouponIssuerMerchant {
+		return fmt.Sprintf("merchant:%d", c.MerchantID)
+	}
+	return "platform"
+}
+
+// PlanDiscounts 从用户钱包中挑选最优优惠组合:
+// 每个商家最多使用一张商家券, 平台券和免运费券各最多一张, 商品优惠合计不超过商品总额
+func PlanDiscounts(wallet []*UserCoupon, lines []CouponLine, shippingFee, now int64) *DiscountPlan {
+	best := make(map[string]OrderDiscount)
+	for _, uc := range wallet {
+		if uc.Coupon == nil || uc.Status != _const.UserCouponUnused || !uc.Coupon.IsActive(now) {
+			continue
+		}
+		amount := uc.Coupon.Discount(lines, shippingFee)
+		if amount <= 0 {
+			continue
+		}
+		group := uc.Coupon.stackGroup()
+		if cur, ok := best[group]; ok && cur.Amount >= amount {
+			continue
+		}
+		best[group] = OrderDiscount{
+			UserCouponID: uc.ID,
+			CouponID:     uc.CouponID,
+			CouponType:   uc.Coupon.Type,
+			Amount:       amount,
+		}
+	}
+
+	var subtotal int64
+	for _, line := range lines {
+		subtotal += line.Amount
+	}
+
+	// 按分组名排序, 商家券先于平台券计入, 保证结果稳定
+	groups := make([]string, 0, len(best))
+	for group := range best {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	plan := &DiscountPlan{}
+	for _, group := range groups {
+		d := best[group]
+		if d.CouponType == _const.CouponTypeFreeShipping {
+			plan.Shipping = d.Amount
+		} else {
+			// 商品优惠不能超过商品总额
+			if plan.Total+d.Amount > subtotal {
+				d.Amount = subtotal - plan.Total
+			}
+			if d.Amount <= 0 {
+				continue
+			}
+			plan.Total += d.Amount
+		}
+		plan.Discounts = append(plan.Discounts, d)
+	}
+	return plan
+}
+
+// Uses 判断优惠方案是否使用了指定的用户优惠券
+func (p *DiscountPlan) Uses(userCouponID int64) bool {
+	for _, d := range p.Discounts {
+		if d.UserCouponID == userCouponID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	_const "github.com/star-find-cloud/star-mall/const"
+	"testing"
+)
+
+func newTestCoupon(id int64, c Coupon) *UserCoupon {
+	c.ID = id
+	c.Status = _const.StatusNotDeleted
+	c.StartAt = 0
+	c.EndAt = 100
+	return &UserCoupon{ID: id, CouponID: id, Status: _const.UserCouponUnused, Coupon: &c}
+}
+
+func TestCouponDiscount(t *testing.T) {
+	lines := []CouponLine{
+		{ProductID: 1, MerchantID: 10, CateID: 5, Amount: 8000},
+		{ProductID: 2, MerchantID: 20, CateID: 6, Amount: 2000},
+	}
+
+	tests := []struct {
+		name   string
+		coupon Coupon
+		want   int64
+	}{
+		{"立减", Coupon{Type: _const.CouponTypeFixed, Amount: 500, ScopeType: _const.CouponScopeAll}, 500},
+		{"满减未达门槛", Coupon{Type: _const.CouponTypeThreshold, Amount: 2000, Threshold: 20000, ScopeType: _const.CouponScopeAll}, 0},
+		{"满减", Coupon{Type: _const.CouponTypeThreshold, Amount: 2000, Threshold: 10000, ScopeType: _const.CouponScopeAll}, 2000},
+		{"折扣封顶", Coupon{Type: _const.CouponTypePercent, Percent: 20, MaxDiscount: 1000, ScopeType: _const.CouponScopeAll}, 1000},
+		{"分类折扣", Coupon{Type: _const.CouponTypePercent, Percent: 10, ScopeType: _const.CouponScopeCategory, ScopeIDs: Int64List{6}}, 200},
+		{"商家券仅限本店", Coupon{IssuerType: _const.CouponIssuerMerchant, MerchantID: 20, Type: _const.CouponTypeFixed, Amount: 5000, ScopeType: _const.CouponScopeAll}, 2000},
+		{"免运费", Coupon{Type: _const.CouponTypeFreeShipping, ScopeType: _const.CouponScopeAll}, 800},
+	}
+
+	for _, tt := range tests {
+		if got := tt.coupon.Discount(lines, 800); got != tt.want {
+			t.Errorf("%s: Discount() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlanDiscounts(t *testing.T) {
+	lines := []CouponLine{{ProductID: 1, MerchantID: 10, Amount: 10000}}
+	wallet := []*UserCoupon{
+		newTestCoupon(1, Coupon{Type: _const.CouponTypeFixed, Amount: 300, ScopeType: _const.CouponScopeAll}),
+		newTestCoupon(2, Coupon{Type: _const.CouponTypePercent, Percent: 10, ScopeType: _const.CouponScopeAll}),
+		newTestCoupon(3, Coupon{IssuerType: _const.CouponIssuerMerchant, MerchantID: 10, Type: _const.CouponTypeFixed, Amount: 500, ScopeType: _const.CouponScopeAll}),
+		newTestCoupon(4, Coupon{Type: _const.CouponTypeFreeShipping, ScopeType: _const.CouponScopeAll}),
+		newTestCoupon(5, Coupon{Type: _const.CouponTypeFixed, Amount: 9000, ScopeType: _const.CouponScopeAll}),
+	}
+	// 已过期的优惠券不参与计算
+	wallet[4].Coupon.EndAt = 10
+
+	plan := PlanDiscounts(wallet, lines, 800, 50)
+	if plan.Total != 1500 {
+		t.Errorf("Total = %d, want 1500", plan.Total)
+	}
+	if plan.Shipping != 800 {
+		t.Errorf("Shipping = %d, want 800", plan.Shipping)
+	}
+	for _, id := range []int64{2, 3, 4} {
+		if !plan.Uses(id) {
+			t.Errorf("plan should use coupon %d", id)
+		}
+	}
+	if plan.Uses(1) || plan.Uses(5) {
+		t.Errorf("plan should not use coupon 1 or 5")
+	}
+}
+
+func TestPlanDiscountsCappedBySubtotal(t *testing.T) {
+	lines := []CouponLine{{ProductID: 1, MerchantID: 10, Amount: 600}}
+	wallet := []*UserCoupon{
+		newTestCoupon(1, Coupon{Type: _const.CouponTypeFixed, Amount: 500, ScopeType: _const.CouponScopeAll}),
+		newTestCoupon(2, Coupon{IssuerType: _const.CouponIssuerMerchant, MerchantID: 10, Type: _const.CouponTypeFixed, Amount: 500, ScopeType: _const.CouponScopeAll}),
+	}
+
+	plan := PlanDiscounts(wallet, lines, 0, 50)
+	if plan.Total != 600 {
+		t.Errorf("Total = %d, want 600", plan.Total)
+	}
+}
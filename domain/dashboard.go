@@ -0,0 +1,13 @@
+package domain
+
+// DashboardSummary 后台首页统计, 时间范围为 [StartAt, EndAt)
+type DashboardSummary struct {
+	StartAt          int64            `json:"startAt"`
+	EndAt            int64            `json:"endAt"`
+	GMV              int64            `json:"gmv"`              // 成交总额, 已支付订单的实付金额之和（单位：分）
+	OrderCount       int64            `json:"orderCount"`       // 下单数
+	PaidOrderCount   int64            `json:"paidOrderCount"`   // 已支付订单数
+	OrderStatusCount map[string]int64 `json:"orderStatusCount"` // 各状态订单数
+	NewUsers         int64            `json:"newUsers"`         // 新注册用户数
+	PendingMerchants int64            `json:"pendingMerchants"` // 待审核商家数, 不受时间范围限制
+}
@@ -0,0 +1,40 @@
+package domain
+
+import "errors"
+
+var (
+	ErrOAuthStateInvalid    = errors.New("第三方登录请求无效或已过期, 请重新发起")
+	ErrIdentityLinked       = errors.New("该第三方账号已绑定其他用户")
+	ErrProviderAlreadyBound = errors.New("已绑定该平台的其他账号, 请先解绑")
+	ErrIdentityNotFound     = errors.New("未绑定该平台的账号")
+	ErrIdentityEmailTaken   = errors.New("该邮箱已注册, 请使用原账号登录后绑定")
+	ErrUnknownOAuthProvider = errors.New("unknown oauth provider")
+)
+
+// UserIdentity 用户绑定的第三方账号
+type UserIdentity struct {
+	ID        int64  `db:"id" json:"id"`
+	UserID    int64  `db:"user_id" json:"userId"`
+	Provider  string `db:"provider" json:"provider"`
+	Subject   string `db:"subject" json:"-"`
+	Email     string `db:"email" json:"email,omitempty"`
+	Name      string `db:"name" json:"name,omitempty"`
+	CreatedAt int64  `db:"created_at" json:"createdAt"`
+	UpdatedAt int64  `db:"updated_at" json:"updatedAt"`
+}
+
+// OAuthState 发起授权时保存的请求, 回调时取出并删除, LinkUserID 不为 0 表示绑定到已登录用户
+type OAuthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"`
+	Nonce        string `json:"nonce"`
+	LinkUserID   int64  `json:"linkUserId,omitempty"`
+}
+
+// OAuthResult 第三方登录回调的处理结果. 绑定请求只设置 Linked, 登录请求返回 token, 首次登录自动注册时 Registered 为 true
+type OAuthResult struct {
+	Token      *TokenPair
+	User       *User
+	Linked     bool
+	Registered bool
+}
@@ -1,13 +1,102 @@
 package domain
 
+import (
+	"errors"
+	"strconv"
+)
+
+var (
+	// ErrImageTypeUnsupported 不支持的图片格式
+	ErrImageTypeUnsupported = errors.New("unsupported image type")
+	// ErrImageHashMismatch 上传内容的 SHA-256 与客户端声明的不一致
+	ErrImageHashMismatch = errors.New("image sha256 mismatch")
+)
+
 type Image struct {
 	ImageID      int64  `db:"imageID"`
 	OwnerID      int64  `db:"ownerID"`
 	OwnerType    int64  `db:"ownerType"`
 	Path         string `db:"path"`
 	SHA256Hash   string `db:"sha256hash"`   // 哈希值, 用于重复图片识别, 前端处理
-	IsCompressed bool   `db:"isCompressed"` // 是否压缩
+	IsCompressed bool   `db:"isCompressed"` // 是否已生成各尺寸版本
 	ContentType  int64  `db:"content_type"` // 图片格式
 	CreateAt     int64  `db:"create_at"`    // 创建时间
 	Status       int64  `db:"status"`       // 状态
+	Variant      string `db:"-"`            // 读取时实际返回的版本尺寸, 为空时为原图
+}
+
+// ImageSizeOriginal 原图, 不使用处理后的版本
+const ImageSizeOriginal = "original"
+
+// ImageSizeThumbnail 缩略图尺寸, 用于列表展示
+const ImageSizeThumbnail = "thumbnail"
+
+// ImageURL 返回 /image/:id 读取图片的地址, size 为空时读取原图
+func ImageURL(id int64, size string) string {
+	url := "/image/" + strconv.FormatInt(id, 10)
+	if size != "" {
+		url += "?size=" + size
+	}
+	return url
+}
+
+var (
+	// ErrImageSizeUnknown 请求的尺寸不在配置中
+	ErrImageSizeUnknown = errors.New("unknown image size")
+	// ErrImageProcessFailed 图片解码、缩放或编码失败
+	ErrImageProcessFailed = errors.New("image processing failed")
+)
+
+// ImageVariant 图片处理后生成的版本, 已去除 EXIF 并按方向旋转
+type ImageVariant struct {
+	ID          int64  `db:"id"`
+	ImageID     int64  `db:"imageID"`      // 原图ID
+	Size        string `db:"size"`         // 尺寸名, 如 thumbnail、medium、large
+	ContentType int64  `db:"content_type"` // 图片格式
+	Path        string `db:"path"`
+	SHA256Hash  string `db:"sha256hash"`
+	Width       int    `db:"width"`
+	Height      int    `db:"height"`
+	Bytes       int64  `db:"bytes"`
+	CreateAt    int64  `db:"create_at"`
+}
+
+// ImageBlob 按 SHA-256 只保存一份的图片内容, 多个图片元数据可以引用同一内容.
+// 引用数降为 0 后记录 ReleasedAt, 超过安全延迟后由回收任务删除
+type ImageBlob struct {
+	SHA256Hash  string `db:"sha256hash"`
+	Path        string `db:"path"`
+	ContentType int64  `db:"content_type"`
+	Size        int64  `db:"size"`
+	RefCount    int64  `db:"ref_count"`
+	CreateAt    int64  `db:"create_at"`
+	ReleasedAt  int64  `db:"released_at"`
+}
+
+var (
+	// ErrImageUploadNotFound 分片上传不存在或已过期
+	ErrImageUploadNotFound = errors.New("image upload not found or expired")
+	// ErrImageChunkInvalid 分片的序号、图片ID或 SHA-256 不正确
+	ErrImageChunkInvalid = errors.New("invalid image chunk")
+	// ErrImageTooLarge 图片超过允许的大小
+	ErrImageTooLarge = errors.New("image too large")
+	// ErrImageStorageUnavailable 读写本地磁盘或对象存储失败
+	ErrImageStorageUnavailable = errors.New("image storage unavailable")
+	// ErrImageUploadBusy 同一图片ID的分片上传正在其他连接上进行
+	ErrImageUploadBusy = errors.New("image upload is in progress on another stream")
+)
+
+// ImageUpload 分片上传的进度, 保存在 Redis 中, 断开后凭图片ID从 NextSeq 继续上传
+type ImageUpload struct {
+	ID          int64  `json:"id"`     // 完成后保存的图片ID
+	UserID      int64  `json:"userId"` // 发起上传的用户, 只有该用户可以继续上传
+	Role        int64  `json:"role"`
+	OwnerType   int64  `json:"ownerType"`
+	OwnerID     int64  `json:"ownerId"`
+	ContentType int64  `json:"contentType"`
+	SHA256Hash  string `json:"sha256,omitempty"` // 客户端声明的整个文件的 SHA-256, 为空时不校验
+	NextSeq     uint32 `json:"nextSeq"`          // 下一个分片的序号, 从 0 开始
+	Size        int64  `json:"size"`             // 已接收的字节数
+	CreateAt    int64  `json:"createAt"`
+	LockToken   string `json:"-"` // 当前连接持有的上传锁, 不保存到 Redis
 }
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrLoginLocked    = errors.New("登录失败次数过多, 已被临时锁定")
+	ErrLoginThrottled = errors.New("登录失败次数过多, 请稍后再试")
+	ErrLockNotFound   = errors.New("锁定记录不存在")
+)
+
+// 防暴力破解按账号和 IP 两个维度分别计数
+const (
+	GuardKindAccount = "account"
+	GuardKindIP      = "ip"
+)
+
+// LoginBlockedError 登录被拒绝时携带需要等待的时间, 用于设置 Retry-After
+type LoginBlockedError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%s, 请 %d 秒后重试", e.Err, int64((e.RetryAfter+time.Second-1)/time.Second))
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Err
+}
+
+// LoginLock 被锁定的账号或 IP
+type LoginLock struct {
+	Kind      string `json:"kind"`
+	Subject   string `json:"subject"`
+	Failures  int64  `json:"failures"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
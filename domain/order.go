@@ -1,11 +1,22 @@
 package domain
 
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ErrOrderNotCancelable 订单不是待付款状态(已支付或已取消), 不能取消
+var ErrOrderNotCancelable = errors.New("只有待付款订单可以取消")
+
 type Order struct {
 	ID                int64  `db:"id" json:"id,omitempty"`
 	UserID            int64  `db:"user_id" json:"userID,omitempty"`
 	OrderStatus       string `db:"order_status" json:"orderStatus,omitempty"`
-	TotalPrice        int64  `db:"total_price" json:"totalPrice,omitempty"` // 总价
-	PayPrice          int64  `db:"pay_price" json:"payPrice,omitempty"`     // 实际支付价格
+	TotalPrice        int64  `db:"total_price" json:"totalPrice,omitempty"`       // 总价
+	PayPrice          int64  `db:"pay_price" json:"payPrice,omitempty"`           // 实际支付价格
+	ShippingFee       int64  `db:"shipping_fee" json:"shippingFee,omitempty"`     // 运费
+	DiscountPrice     int64  `db:"discount_price" json:"discountPrice,omitempty"` // 优惠金额(含运费优惠)
 	CreatedAt         int64  `db:"created_at" json:"createdAt,omitempty"`
 	UpdatedAt         int64  `db:"updated_at" json:"updatedAt,omitempty"`
 	PaymentMethodID   int64  `db:"payment_id" json:"paymentID,omitempty"`   // 支付方式ID
@@ -21,3 +32,62 @@ type OrderItem struct {
 	Quantity     int64  `db:"quantity" json:"quantity,omitempty"`    // 数量
 	Subtotal     int64  `db:"subtotal" json:"subtotal,omitempty"`    // 小计
 }
+
+// OrderListItem 订单列表中的订单项, 附带商品缩略图
+type OrderListItem struct {
+	OrderItem
+	ThumbnailID int64  `db:"thumbnail_id" json:"thumbnailID,omitempty"` // 商品首图ID
+	Thumbnail   string `db:"-" json:"thumbnail,omitempty"`              // 商品首图缩略图地址
+}
+
+// OrderSummary 订单列表中的单个订单
+type OrderSummary struct {
+	*Order
+	Items []*OrderListItem `json:"items"`
+}
+
+// OrderQuery 订单列表查询条件, UserID 与 MerchantID 二选一, 由调用方从 JWT 中填充
+type OrderQuery struct {
+	UserID     int64
+	MerchantID int64
+	Status     string // 订单状态
+	StartAt    int64  // 创建时间下限(含)
+	EndAt      int64  // 创建时间上限(不含)
+	Keyword    string // 商品标题关键词
+	Cursor     string // 上一页返回的游标
+	Limit      int
+	All        bool // 管理员查询全部订单, 此时 UserID 和 MerchantID 只作为可选的筛选条件
+}
+
+// OrderPage 订单列表分页结果
+type OrderPage struct {
+	Orders     []*OrderSummary `json:"orders"`
+	NextCursor string          `json:"nextCursor,omitempty"` // 为空表示没有更多数据
+}
+
+// OrderCursor 订单列表游标, 按 (created_at, id) 倒序翻页
+type OrderCursor struct {
+	CreatedAt int64
+	ID        int64
+}
+
+// Encode 将游标编码为不透明字符串
+func (c OrderCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.CreatedAt, c.ID)))
+}
+
+// DecodeOrderCursor 解析游标, 空字符串返回 nil
+func DecodeOrderCursor(s string) (*OrderCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c = &OrderCursor{}
+	if _, err = fmt.Sscanf(string(raw), "%d:%d", &c.CreatedAt, &c.ID); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return c, nil
+}
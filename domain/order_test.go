@@ -0,0 +1,21 @@
+package domain
+
+import "testing"
+
+func TestOrderCursor(t *testing.T) {
+	want := OrderCursor{CreatedAt: 1700000000, ID: 987654321}
+	got, err := DecodeOrderCursor(want.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Errorf("DecodeOrderCursor() = %+v, want %+v", *got, want)
+	}
+
+	if c, err := DecodeOrderCursor(""); c != nil || err != nil {
+		t.Errorf("empty cursor = %v, %v; want nil, nil", c, err)
+	}
+	if _, err := DecodeOrderCursor("not-a-cursor"); err == nil {
+		t.Error("invalid cursor should return error")
+	}
+}
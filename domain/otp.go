@@ -0,0 +1,15 @@
+package domain
+
+import "errors"
+
+var (
+	ErrOTPTooFrequent      = errors.New("验证码发送过于频繁, 请稍后再试")
+	ErrOTPExpired          = errors.New("验证码已过期")
+	ErrOTPInvalid          = errors.New("验证码错误")
+	ErrOTPAttemptsExceeded = errors.New("验证码错误次数过多, 请重新获取")
+)
+
+// OTP 验证码用途, 不同用途的验证码互不影响
+const (
+	OTPPurposeSmsLogin = "sms"
+)
@@ -0,0 +1,21 @@
+package domain
+
+// 发件箱事件
+const (
+	AggregateProduct    = "product"
+	EventProductChanged = "product.changed" // 商品或其库存发生变化, 消费方应重新读取商品的最新状态
+)
+
+// OutboxEvent 事务发件箱中的事件
+type OutboxEvent struct {
+	ID            int64  `db:"id"`
+	Aggregate     string `db:"aggregate"`
+	AggregateID   int64  `db:"aggregate_id"`
+	EventType     string `db:"event_type"`
+	Status        int    `db:"status"`
+	Attempts      int    `db:"attempts"`
+	NextAttemptAt int64  `db:"next_attempt_at"`
+	LastError     string `db:"last_error"`
+	CreatedAt     int64  `db:"created_at"`
+	UpdatedAt     int64  `db:"updated_at"`
+}
@@ -32,8 +32,48 @@ type Product struct {
 	BookingTime   int64   `db:"booking_time"`    // 预售时间
 	Sort          int     `db:"sort"`            // 排序权重
 	Status        int     `db:"status"`
+	Rating        float64 `db:"rating"`              // 评分
+	RatingCount   int64   `db:"rating_count"`        // 评价数
+	MemberPrice   float64 `db:"-" json:",omitempty"` // 会员价, 只对会员展示
 }
 
 func (d *Product) ValidateMerchantID(inputID, storeID int64) bool {
 	return inputID == storeID
 }
+
+// ProductSearchPage 商品搜索结果
+// @Description 商品搜索结果, total 为命中的商品总数
+type ProductSearchPage struct {
+	Products []*Product     `json:"products"`
+	Total    int64          `json:"total"`
+	Offset   int            `json:"offset"`
+	Limit    int            `json:"limit"`
+	Facets   *ProductFacets `json:"facets"`
+}
+
+// ProductFacets 搜索结果的分面统计, 按当前搜索词和筛选条件统计, 数量为 0 的项不返回
+// @Description 搜索结果的分面统计
+type ProductFacets struct {
+	Brands     []BrandFacet    `json:"brands"`
+	Categories []CategoryFacet `json:"categories"`
+	Prices     []PriceFacet    `json:"prices"`
+}
+
+// BrandFacet 品牌及命中的商品数
+type BrandFacet struct {
+	Brand string `json:"brand"`
+	Count int64  `json:"count"`
+}
+
+// CategoryFacet 分类及命中的商品数
+type CategoryFacet struct {
+	CateID int64 `json:"cate_id"`
+	Count  int64 `json:"count"`
+}
+
+// PriceFacet 价格区间 [min, max) 及命中的商品数, max 为 0 表示不设上限
+type PriceFacet struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
@@ -2,9 +2,9 @@ package domain
 
 // 商品收藏
 type ProductCollect struct {
-	ID         int
-	UserID     int
-	ProductID  int
-	AddTime    int
-	DeleteTime int
+	ID         int `db:"id" json:"id"`
+	UserID     int `db:"user_id" json:"userID"`
+	ProductID  int `db:"product_id" json:"productID"`
+	AddTime    int `db:"add_time" json:"addTime"`
+	DeleteTime int `db:"delete_time" json:"deleteTime,omitempty"`
 }
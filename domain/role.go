@@ -2,9 +2,28 @@ package domain
 
 import (
 	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
 	"time"
 )
 
+var (
+	ErrSystemRole   = errors.New("系统内置角色不能删除或禁用")
+	ErrRoleNotFound = errors.New("角色不存在")
+)
+
+// SystemRoleCode 返回 JWT 中的身份类型对应的系统内置角色编码
+func SystemRoleCode(userType int64) string {
+	switch userType {
+	case _const.UserRole:
+		return _const.RoleCodeUser
+	case _const.MerchantRole:
+		return _const.RoleCodeMerchant
+	case _const.AdminRole:
+		return _const.RoleCodeAdmin
+	}
+	return ""
+}
+
 // Role 角色领域模型
 type Role struct {
 	ID          int64  `db:"id" json:"id"`                   // 角色ID
@@ -100,6 +119,15 @@ func (r *Role) UpdateSort(sort int, operatorID int64) {
 	r.UpdatedBy = operatorID
 }
 
+// RoleUpdate 角色的部分更新, 为 nil 的字段保持不变
+type RoleUpdate struct {
+	ID          int64
+	Name        *string
+	Description *string
+	Status      *int // 1-启用, 其他-禁用
+	Sort        *int
+}
+
 // RolePermission 角色-权限关联
 type RolePermission struct {
 	ID           int64 `db:"id" json:"id"`                      // 主键ID
@@ -125,8 +153,10 @@ func NewRolePermission(roleID, permissionID, operatorID int64) *RolePermission {
 }
 
 // UserRole 用户-角色关联
+// 用户、商家和管理员的ID相互独立, 通过 UserType 区分
 type UserRole struct {
 	ID        int64 `db:"id" json:"id"`                // 主键ID
+	UserType  int64 `db:"user_type" json:"userType"`   // 身份类型, 同 JWT 中的 Roles
 	UserID    int64 `db:"user_id" json:"userId"`       // 用户ID
 	RoleID    int64 `db:"role_id" json:"roleId"`       // 角色ID
 	CreatedAt int64 `db:"created_at" json:"createdAt"` // 创建时间
@@ -139,8 +169,9 @@ func (ur *UserRole) TableName() string {
 }
 
 // NewUserRole 创建用户-角色关联
-func NewUserRole(userID, roleID, operatorID int64) *UserRole {
+func NewUserRole(userType, userID, roleID, operatorID int64) *UserRole {
 	return &UserRole{
+		UserType:  userType,
 		UserID:    userID,
 		RoleID:    roleID,
 		CreatedAt: time.Now().Unix(),
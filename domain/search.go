@@ -0,0 +1,27 @@
+package domain
+
+import "errors"
+
+// ErrUnsupportedSort 不支持的排序方式
+var ErrUnsupportedSort = errors.New("unsupported sort")
+
+// 搜索联想的来源
+const (
+	SuggestTitle    = "title"
+	SuggestBrand    = "brand"
+	SuggestCategory = "category"
+)
+
+// Suggestion 搜索联想词
+// @Description 搜索联想词, kind 为来源: title 商品标题, brand 品牌, category 分类
+type Suggestion struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+}
+
+// SearchQueryStat 搜索词及搜索次数
+// @Description 搜索词及统计周期内的搜索次数
+type SearchQueryStat struct {
+	Query string `json:"query"`
+	Count int64  `json:"count"`
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"strings"
+)
+
+// Shipment 发货单, 一个订单可以拆分为多个包裹
+type Shipment struct {
+	ID          int64   `db:"id" json:"id"`
+	OrderID     int64   `db:"order_id" json:"orderId"`
+	MerchantID  int64   `db:"merchant_id" json:"merchantId"`
+	Carrier     string  `db:"carrier" json:"carrier"`          // 承运商编码
+	TrackingNo  string  `db:"tracking_no" json:"trackingNo"`   // 运单号
+	Status      int     `db:"status" json:"status"`            // 物流状态
+	ShippedAt   int64   `db:"shipped_at" json:"shippedAt"`     // 发货时间
+	DeliveredAt int64   `db:"delivered_at" json:"deliveredAt"` // 签收时间
+	CreatedAt   int64   `db:"created_at" json:"createdAt"`
+	UpdatedAt   int64   `db:"updated_at" json:"updatedAt"`
+	ItemIDs     []int64 `db:"-" json:"itemIds"` // 包裹内的订单项
+}
+
+// ShipmentEvent 物流轨迹
+type ShipmentEvent struct {
+	ID          int64  `db:"id" json:"id"`
+	ShipmentID  int64  `db:"shipment_id" json:"shipmentId"`
+	Status      int    `db:"status" json:"status"`
+	Location    string `db:"location" json:"location"`
+	Description string `db:"description" json:"description"`
+	EventTime   int64  `db:"event_time" json:"eventTime"`
+	CreatedAt   int64  `db:"created_at" json:"createdAt"`
+}
+
+// ShipmentTimeline 订单物流时间线
+type ShipmentTimeline struct {
+	Shipment *Shipment       `json:"shipment"`
+	Events   []ShipmentEvent `json:"events"`
+}
+
+// NewShipment 创建发货单并校验参数
+func NewShipment(orderID, merchantID int64, carrier, trackingNo string, itemIDs []int64, now int64) (*Shipment, error) {
+	carrier = strings.TrimSpace(carrier)
+	trackingNo = strings.TrimSpace(trackingNo)
+	if carrier == "" || trackingNo == "" {
+		return nil, errors.New("承运商和运单号不能为空")
+	}
+	if len(itemIDs) == 0 {
+		return nil, errors.New("发货单至少包含一个订单项")
+	}
+	return &Shipment{
+		OrderID:    orderID,
+		MerchantID: merchantID,
+		Carrier:    carrier,
+		TrackingNo: trackingNo,
+		Status:     _const.ShipmentStatusShipped,
+		ShippedAt:  now,
+		CreatedAt:  now,
+		ItemIDs:    itemIDs,
+	}, nil
+}
+
+// Apply 根据完整物流轨迹将发货单更新为最新状态, 返回状态是否发生变化
+func (s *Shipment) Apply(events []ShipmentEvent) bool {
+	if len(events) == 0 {
+		return false
+	}
+	latest := events[0]
+	for _, e := range events[1:] {
+		if e.EventTime >= latest.EventTime {
+			latest = e
+		}
+	}
+	if latest.Status == s.Status {
+		return false
+	}
+	s.Status = latest.Status
+	if latest.Status == _const.ShipmentStatusDelivered {
+		s.DeliveredAt = latest.EventTime
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "errors"
+
+var (
+	ErrTokenRevoked        = errors.New("token 已注销")
+	ErrRefreshTokenInvalid = errors.New("刷新 token 无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新 token 已被使用, 会话已注销")
+)
+
+// TokenPair 登录或刷新后返回的 token.
+// 开启两步验证的用户密码校验通过后只返回 MFAToken, 需要再提交验证码换取正式 token
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // 访问 token 有效期, 单位秒
+	MFAToken     string `json:"mfaToken,omitempty"`
+}
+
+// MFARequired 是否还需要完成两步验证
+func (p *TokenPair) MFARequired() bool {
+	return p.MFAToken != ""
+}
+
+// TokenSession 一次登录产生的会话, 同一会话内的刷新 token 轮换使用
+type TokenSession struct {
+	ID       string `redis:"-"`
+	UserID   int64  `redis:"user_id"`
+	UserName string `redis:"user_name"`
+	Role     int64  `redis:"role"`
+}
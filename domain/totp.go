@@ -0,0 +1,27 @@
+package domain
+
+import "errors"
+
+var (
+	ErrTOTPNotEnrolled    = errors.New("未开启两步验证")
+	ErrTOTPAlreadyEnabled = errors.New("已开启两步验证")
+	ErrTOTPInvalid        = errors.New("两步验证码错误")
+	ErrTOTPRequired       = errors.New("该操作需要两步验证码")
+	ErrMFATokenInvalid    = errors.New("两步验证凭证无效或已过期, 请重新登录")
+)
+
+// UserTOTP 用户的 TOTP 配置, Secret 为加密后的密钥
+type UserTOTP struct {
+	UserID    int64  `db:"user_id"`
+	Secret    string `db:"secret"`
+	Enabled   bool   `db:"enabled"`
+	LastStep  int64  `db:"last_step"`
+	CreatedAt int64  `db:"created_at"`
+	UpdatedAt int64  `db:"updated_at"`
+}
+
+// TOTPEnrollment 开启两步验证时返回给用户的密钥, URI 用于生成二维码
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
@@ -1,12 +1,32 @@
 package domain
 
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrSmsPhoneQuota = errors.New("该手机号今日验证码发送次数已达上限")
+	ErrSmsIPQuota    = errors.New("当前网络今日验证码发送次数已达上限")
+)
+
 // 用户短信
 type UserSms struct {
-	ID        int
-	IP        string
-	Phone     string
-	SendCount int
-	AddDay    int
-	AddTime   int
-	Sign      string // 签名, 验证消息是否被篡改
+	ID        int64  `db:"id" json:"id"`
+	IP        string `db:"ip" json:"ip"`
+	Phone     string `db:"phone" json:"phone"`
+	SendCount int    `db:"send_count" json:"sendCount"` // 当天该手机号在该 IP 下的发送次数
+	AddDay    int    `db:"add_day" json:"addDay"`       // 发送日期, 如 20250101
+	AddTime   int64  `db:"add_time" json:"addTime"`     // 最近一次发送时间
+	Sign      string `db:"sign" json:"-"`               // 签名, 验证消息是否被篡改
+}
+
+// ComputeSign 计算最近一次发送记录的签名
+func (s *UserSms) ComputeSign(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s|%s|%d|%d", s.Phone, s.IP, s.AddDay, s.AddTime)
+	return hex.EncodeToString(mac.Sum(nil))
 }
@@ -2,11 +2,11 @@ package domain
 
 // 送货地址
 type Address struct {
-	ID             int    `db:"id"`
-	Uid            int    `db:"uid"`
-	Phone          string `db:"phone"`
-	Name           string `db:"name"`
-	Address        string `db:"address"`
-	DefaultAddress int    `db:"default_address"`
-	AddTime        int    `db:"add_time"`
+	ID             int    `db:"id" json:"id"`
+	Uid            int    `db:"uid" json:"uid"`
+	Phone          string `db:"phone" json:"phone"`
+	Name           string `db:"name" json:"name"`
+	Address        string `db:"address" json:"address"`
+	DefaultAddress int    `db:"default_address" json:"defaultAddress"`
+	AddTime        int    `db:"add_time" json:"addTime"`
 }
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"math"
+)
+
+var (
+	// ErrVipPlanNotFound 会员套餐不存在或已下架
+	ErrVipPlanNotFound = errors.New("vip plan not found")
+	// ErrVipPlanNotPurchasable 套餐只能通过消费达标获得, 或不能通过消费获得
+	ErrVipPlanNotPurchasable = errors.New("vip plan is not available this way")
+	// ErrVipNotEligible 消费金额未达到套餐要求
+	ErrVipNotEligible = errors.New("spending has not reached the plan threshold")
+	// ErrVipDowngrade 会员生效期间不能开通更低等级的套餐
+	ErrVipDowngrade = errors.New("cannot switch to a lower tier while membership is active")
+	// ErrVipOrderExists 商户订单号已有开通记录, 重复提交的开通不再生效
+	ErrVipOrderExists = errors.New("vip order already exists")
+	// ErrMembershipNotFound 用户不是会员
+	ErrMembershipNotFound = errors.New("membership not found")
+	// ErrPaymentFailed 扣款失败, 如余额不足或代扣协议已解约
+	ErrPaymentFailed = errors.New("payment failed")
+)
+
+// VipTier 会员等级及权益
+// @Description 会员等级及权益, 金额单位为分
+type VipTier struct {
+	Level                 int64  `db:"level" json:"level"`
+	Name                  string `db:"name" json:"name"`
+	DiscountPercent       int64  `db:"discount_percent" json:"discountPercent"`              // 会员价为原价的百分比
+	FreeShippingThreshold int64  `db:"free_shipping_threshold" json:"freeShippingThreshold"` // 包邮门槛, 0 表示全部包邮, 小于 0 表示不包邮
+}
+
+// PriceCents 计算会员价, 单位为分
+func (t *VipTier) PriceCents(cents int64) int64 {
+	if t.DiscountPercent <= 0 || t.DiscountPercent >= 100 {
+		return cents
+	}
+	return int64(math.Round(float64(cents) * float64(t.DiscountPercent) / 100))
+}
+
+// Price 计算以元为单位的会员价, 与商品价格的单位一致
+func (t *VipTier) Price(price float64) float64 {
+	return float64(t.PriceCents(int64(math.Round(price*100)))) / 100
+}
+
+// FreeShipping 判断商品金额是否满足包邮门槛
+func (t *VipTier) FreeShipping(subtotal int64) bool {
+	return t.FreeShippingThreshold >= 0 && subtotal >= t.FreeShippingThreshold
+}
+
+// VipPlan 会员套餐, 可以购买或消费达标后获得
+type VipPlan struct {
+	ID            int64    `db:"id" json:"id"`
+	TierLevel     int64    `db:"tier_level" json:"tierLevel"`
+	Name          string   `db:"name" json:"name"`
+	DurationDays  int64    `db:"duration_days" json:"durationDays"`
+	Price         int64    `db:"price" json:"price"`                  // 价格, 0 表示不能购买
+	EarnThreshold int64    `db:"earn_threshold" json:"earnThreshold"` // 消费满该金额可获得, 0 表示不能通过消费获得
+	Status        int      `db:"status" json:"-"`
+	CreatedAt     int64    `db:"created_at" json:"-"`
+	Tier          *VipTier `db:"-" json:"tier,omitempty"`
+}
+
+// Membership 用户会员
+// @Description 用户会员
+type Membership struct {
+	UserID      int64    `db:"user_id" json:"userID"`
+	PlanID      int64    `db:"plan_id" json:"planID"`
+	TierLevel   int64    `db:"tier_level" json:"tierLevel"`
+	Status      int      `db:"status" json:"status"`
+	StartedAt   int64    `db:"started_at" json:"startedAt"`
+	ExpiresAt   int64    `db:"expires_at" json:"expiresAt"`
+	AutoRenew   bool     `db:"auto_renew" json:"autoRenew"`
+	AgreementNo string   `db:"agreement_no" json:"-"`
+	UpdatedAt   int64    `db:"updated_at" json:"updatedAt"`
+	Tier        *VipTier `db:"-" json:"tier,omitempty"`
+}
+
+// Active 判断会员在 now 时刻是否有效
+func (m *Membership) Active(now int64) bool {
+	return m != nil && m.Status == _const.MembershipStatusActive && now < m.ExpiresAt
+}
+
+// NextMembership 计算开通套餐后的会员:
+// 有效期内开通同等级套餐时顺延到期时间, 开通更高等级时从现在重新计算, 过期或首次开通从现在开始
+func NextMembership(current *Membership, plan *VipPlan, userID, now int64) (*Membership, error) {
+	duration := plan.DurationDays * 24 * 3600
+	next := &Membership{
+		UserID:    userID,
+		PlanID:    plan.ID,
+		TierLevel: plan.TierLevel,
+		Status:    _const.MembershipStatusActive,
+		StartedAt: now,
+		ExpiresAt: now + duration,
+		UpdatedAt: now,
+	}
+	if !current.Active(now) {
+		return next, nil
+	}
+	if plan.TierLevel < current.TierLevel {
+		return nil, ErrVipDowngrade
+	}
+	next.AutoRenew, next.AgreementNo = current.AutoRenew, current.AgreementNo
+	if plan.TierLevel == current.TierLevel {
+		next.StartedAt = current.StartedAt
+		next.ExpiresAt = current.ExpiresAt + duration
+	}
+	return next, nil
+}
+
+// VipOrder 会员开通记录
+type VipOrder struct {
+	ID         int64  `db:"id" json:"id"`
+	UserID     int64  `db:"user_id" json:"userID"`
+	PlanID     int64  `db:"plan_id" json:"planID"`
+	Kind       int    `db:"kind" json:"kind"`
+	Amount     int64  `db:"amount" json:"amount"`
+	OutTradeNo string `db:"out_trade_no" json:"outTradeNo"`
+	TradeNo    string `db:"trade_no" json:"tradeNo"`
+	CreatedAt  int64  `db:"created_at" json:"createdAt"`
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"testing"
+)
+
+func TestVipTierBenefits(t *testing.T) {
+	tier := &VipTier{DiscountPercent: 95, FreeShippingThreshold: 9900}
+	if got := tier.PriceCents(1999); got != 1899 {
+		t.Errorf("PriceCents(1999) = %d, want 1899", got)
+	}
+	if got := tier.Price(19.99); got != 18.99 {
+		t.Errorf("Price(19.99) = %v, want 18.99", got)
+	}
+	if tier.FreeShipping(9899) || !tier.FreeShipping(9900) {
+		t.Error("free shipping threshold not applied")
+	}
+
+	noBenefit := &VipTier{DiscountPercent: 100, FreeShippingThreshold: -1}
+	if noBenefit.PriceCents(1999) != 1999 || noBenefit.FreeShipping(1<<40) {
+		t.Error("tier without benefits changed the price or shipping")
+	}
+	if !(&VipTier{FreeShippingThreshold: 0}).FreeShipping(0) {
+		t.Error("zero threshold should always ship free")
+	}
+}
+
+func TestNextMembership(t *testing.T) {
+	const day = 24 * 3600
+	const now = 1000 * day
+	monthly := &VipPlan{ID: 1, TierLevel: 1, DurationDays: 30}
+	premium := &VipPlan{ID: 2, TierLevel: 2, DurationDays: 365}
+	active := &Membership{TierLevel: 1, Status: _const.MembershipStatusActive, StartedAt: now - 10*day, ExpiresAt: now + 20*day, AutoRenew: true, AgreementNo: "a1"}
+	expired := &Membership{TierLevel: 2, Status: _const.MembershipStatusActive, ExpiresAt: now}
+
+	tests := []struct {
+		name        string
+		current     *Membership
+		plan        *VipPlan
+		start, exp  int64
+		keepRenewal bool
+		err         error
+	}{
+		{"首次开通", nil, monthly, now, now + 30*day, false, nil},
+		{"同等级续期顺延", active, monthly, now - 10*day, now + 50*day, true, nil},
+		{"升级重新计算", active, premium, now, now + 365*day, true, nil},
+		{"过期后重新开通", expired, monthly, now, now + 30*day, false, nil},
+		{"有效期内不能降级", &Membership{TierLevel: 2, Status: _const.MembershipStatusActive, ExpiresAt: now + day}, monthly, 0, 0, false, ErrVipDowngrade},
+	}
+	for _, tt := range tests {
+		got, err := NextMembership(tt.current, tt.plan, 7, now)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.StartedAt != tt.start || got.ExpiresAt != tt.exp || got.TierLevel != tt.plan.TierLevel || got.PlanID != tt.plan.ID {
+			t.Errorf("%s: got %+v, want start %d expires %d", tt.name, got, tt.start, tt.exp)
+		}
+		if got.AutoRenew != tt.keepRenewal {
+			t.Errorf("%s: AutoRenew = %v, want %v", tt.name, got.AutoRenew, tt.keepRenewal)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+)
+
+type AccountHandler struct {
+	service service.AccountService
+}
+
+func NewAccountHandler(service service.AccountService) *AccountHandler {
+	return &AccountHandler{service: service}
+}
+
+type DeleteRequest struct {
+	// @Description 发送到账号邮箱的验证码, 没有绑定邮箱时为发送到手机号的验证码
+	// @Example "123456"
+	VerifyCode string `json:"verifyCode"`
+
+	// @Description 两步验证码或恢复码, 已开启两步验证时必填
+	// @Example "123456"
+	TOTPCode string `json:"totpCode"`
+}
+
+// RequestDeletion 申请注销账号
+// @Summary 申请注销账号
+// @Description 申请注销当前登录用户的账号. 冷静期内可以撤销, 期满后匿名化个人数据, 订单记录保留
+// @Accept json
+// @Produce json
+// @Tags 用户
+// @Param request body DeleteRequest true "Delete request"
+// @Security ApiKeyAuth
+// @Success 202 {object} domain.DeletionRequest
+// @Failure 400 {object} utils.ResponseError "验证码错误"
+// @Failure 401 {object} utils.ResponseError
+// @Failure 403 {object} utils.ResponseError "需要两步验证码"
+// @Failure 409 {object} utils.ResponseError "已申请注销"
+// @Router /api/v1/user/delete [delete]
+func (h *AccountHandler) RequestDeletion(c *gin.Context) {
+	claims, ok := accountClaims(c)
+	if !ok {
+		return
+	}
+	req := &DeleteRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	deletion, err := h.service.RequestDeletion(c.Request.Context(), claims.UserID, req.VerifyCode, req.TOTPCode)
+	if err != nil {
+		logger.AppLogger.Warnf("request account deletion failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "delete failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusAccepted, deletion)
+}
+
+// DeletionStatus 查询注销申请
+// @Summary 查询注销申请
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} domain.DeletionRequest
+// @Failure 404 {object} utils.ResponseError "没有处于冷静期的注销申请"
+// @Router /api/v1/account/deletion [get]
+func (h *AccountHandler) DeletionStatus(c *gin.Context) {
+	claims, ok := accountClaims(c)
+	if !ok {
+		return
+	}
+	deletion, err := h.service.DeletionStatus(c.Request.Context(), claims.UserID)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get deletion failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, deletion)
+}
+
+// CancelDeletion 撤销注销申请
+// @Summary 撤销注销申请
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {string} string "deletion cancelled"
+// @Failure 404 {object} utils.ResponseError "没有处于冷静期的注销申请"
+// @Router /api/v1/account/deletion/cancel [post]
+func (h *AccountHandler) CancelDeletion(c *gin.Context) {
+	claims, ok := accountClaims(c)
+	if !ok {
+		return
+	}
+	if err := h.service.CancelDeletion(c.Request.Context(), claims.UserID); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "cancel deletion failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "deletion cancelled")
+}
+
+// Export 下载个人数据
+// @Summary 下载个人数据
+// @Description 导出个人资料、收货地址、订单、收藏、购物车和绑定的第三方账号. format 为 zip 时按类别分文件打包, 默认为单个 json 文件
+// @Tags 用户
+// @Produce json
+// @Produce application/zip
+// @Security ApiKeyAuth
+// @Param format query string false "json 或 zip"
+// @Success 200 {object} domain.UserDataExport
+// @Failure 400 {object} utils.ResponseError
+// @Router /api/v1/account/export [get]
+func (h *AccountHandler) Export(c *gin.Context) {
+	claims, ok := accountClaims(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		utils.RespondError(c, http.StatusBadRequest, "format must be json or zip", nil)
+		return
+	}
+
+	export, err := h.service.Export(c.Request.Context(), claims.UserID)
+	if err != nil {
+		logger.AppLogger.Errorf("export user data failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "export failed", err.Error())
+		return
+	}
+
+	// 先写入缓冲区, 打包失败时仍能返回错误响应
+	var buf bytes.Buffer
+	contentType := "application/json"
+	if format == "zip" {
+		contentType = "application/zip"
+		err = service.WriteDataArchive(&buf, export)
+	} else {
+		err = json.NewEncoder(&buf).Encode(export)
+	}
+	if err != nil {
+		logger.AppLogger.Errorf("encode user data failed: %v", err)
+		utils.RespondError(c, http.StatusInternalServerError, "export failed", err)
+		return
+	}
+
+	filename := fmt.Sprintf("star-mall-user-%d.%s", claims.UserID, format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// accountClaims 注销和导出按用户表ID操作, 只允许用户和商家账号, 管理员的ID与用户ID不在同一空间
+func accountClaims(c *gin.Context) (*appjwt.CustomClaims, bool) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return nil, false
+	}
+	if actor := claims.Actor(); !actor.IsUser() && !actor.IsMerchant() {
+		utils.RespondError(c, http.StatusForbidden, "not User or Merchant", domain.ErrForbidden)
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,579 @@
+package handler
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+)
+
+type AdminHandler struct {
+	service       service.AdminService
+	orderService  service.OrderService
+	couponService service.CouponService
+	guard         service.LoginGuardService
+}
+
+func NewAdminHandler(service service.AdminService, orderService service.OrderService, couponService service.CouponService, guard service.LoginGuardService) *AdminHandler {
+	return &AdminHandler{
+		service:       service,
+		orderService:  orderService,
+		couponService: couponService,
+		guard:         guard,
+	}
+}
+
+// AdminLoginRequest 管理员登录请求参数
+// @Description: 管理员登录请求参数
+type AdminLoginRequest struct {
+	// @Description: 登录名
+	UserName string `json:"user_name"`
+	// @Description: 密码
+	Password string `json:"password"`
+}
+
+// AdminLoginResponse 管理员登录响应
+// @Description: 管理员登录响应
+type AdminLoginResponse struct {
+	// @Description: 访问 token 和刷新 token
+	*domain.TokenPair
+	// @Description: 管理员信息
+	Admin *domain.Admin `json:"admin"`
+}
+
+// Login 管理员登录
+// @Summary 管理员登录
+// @Description 管理员使用登录名和密码登录, 停用的管理员不能登录
+// @Tags 后台管理
+// @Accept json
+// @Produce json
+// @Param request body AdminLoginRequest true "login"
+// @Success 200 {object} AdminLoginResponse
+// @Failure 400 {object} string "invalid request"
+// @Failure 401 {object} string "login failed"
+// @Router /api/v1/admin/login [post]
+func (h *AdminHandler) Login(c *gin.Context) {
+	var req = &AdminLoginRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+	if req.UserName == "" || req.Password == "" {
+		utils.RespondError(c, http.StatusBadRequest, "user name and password are required", nil)
+		return
+	}
+
+	token, admin, err := h.service.Login(c.Request.Context(), req.UserName, req.Password)
+	if err != nil {
+		utils.RespondError(c, http.StatusUnauthorized, "login failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, AdminLoginResponse{TokenPair: token, Admin: admin})
+}
+
+// Refresh 刷新管理员 token
+// @Summary 刷新管理员 token
+// @Description 使用刷新 token 换取新的访问 token 和刷新 token, 旧的刷新 token 随即失效
+// @Tags 后台管理
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "refresh"
+// @Success 200 {object} domain.TokenPair
+// @Failure 401 {object} string "refresh token failed"
+// @Router /api/v1/admin/refresh [post]
+func (h *AdminHandler) Refresh(c *gin.Context) {
+	var req = &RefreshRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	token, err := h.service.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "refresh token failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, token)
+}
+
+// Logout 管理员退出登录
+// @Summary 管理员退出登录
+// @Description 注销当前访问 token 及其所属会话的刷新 token
+// @Tags 后台管理
+// @Produce json
+// @Success 200 {object} string "logout successfully"
+// @Failure 401 {object} string "invalid token claims"
+// @Router /api/v1/admin/logout [post]
+func (h *AdminHandler) Logout(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c, _const.AdminRole)
+	if !ok {
+		return
+	}
+	if err := h.service.Logout(c.Request.Context(), customClaims); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "logout failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "logout successfully")
+}
+
+// SearchUsers 搜索用户
+// @Summary 搜索用户
+// @Description 按用户名、邮箱或手机号模糊搜索用户
+// @Tags 后台管理
+// @Produce json
+// @Param keyword query string false "关键词"
+// @Param status query int false "用户状态"
+// @Param limit query int false "每页数量, 默认 20, 最大 100"
+// @Param offset query int false "偏移量"
+// @Success 200 {array} domain.User
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/user/search [get]
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	status, limit, offset, ok := parseAdminListQuery(c)
+	if !ok {
+		return
+	}
+
+	users, err := h.service.SearchUsers(c.Request.Context(), c.Query("keyword"), status, limit, offset)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "search user failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, users)
+}
+
+// BanUser 封禁用户
+// @Summary 封禁用户
+// @Description 封禁用户, 封禁后用户不能登录
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} string "success"
+// @Failure 400 {object} string "ban user failed"
+// @Router /api/v1/admin/user/ban/{id} [patch]
+func (h *AdminHandler) BanUser(c *gin.Context) {
+	h.updateStatus(c, h.service.BanUser, "ban user failed")
+}
+
+// UnbanUser 解封用户
+// @Summary 解封用户
+// @Description 解除用户封禁
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} string "success"
+// @Failure 400 {object} string "unban user failed"
+// @Router /api/v1/admin/user/unban/{id} [patch]
+func (h *AdminHandler) UnbanUser(c *gin.Context) {
+	h.updateStatus(c, h.service.UnbanUser, "unban user failed")
+}
+
+// DisableAdmin 停用管理员
+// @Summary 停用管理员
+// @Description 停用管理员, 停用后立即失去全部权限且不能登录
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "管理员ID"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "disable admin failed"
+// @Router /api/v1/admin/admin/disable/{id} [patch]
+func (h *AdminHandler) DisableAdmin(c *gin.Context) {
+	h.updateStatus(c, h.service.DisableAdmin, "disable admin failed")
+}
+
+// EnableAdmin 启用管理员
+// @Summary 启用管理员
+// @Description 重新启用已停用的管理员
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "管理员ID"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "enable admin failed"
+// @Router /api/v1/admin/admin/enable/{id} [patch]
+func (h *AdminHandler) EnableAdmin(c *gin.Context) {
+	h.updateStatus(c, h.service.EnableAdmin, "enable admin failed")
+}
+
+// ListMerchants 获取商家列表
+// @Summary 获取商家列表
+// @Description 按审核状态获取商家列表, 默认返回待审核商家
+// @Tags 后台管理
+// @Produce json
+// @Param status query int false "商家状态 (140-待审核, 141-审核通过, 142-审核驳回)"
+// @Param limit query int false "每页数量, 默认 20, 最大 100"
+// @Param offset query int false "偏移量"
+// @Success 200 {array} domain.Merchant
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/merchant/list [get]
+func (h *AdminHandler) ListMerchants(c *gin.Context) {
+	status, limit, offset, ok := parseAdminListQuery(c)
+	if !ok {
+		return
+	}
+
+	merchants, err := h.service.ListMerchants(c.Request.Context(), int(status), limit, offset)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list merchant failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, merchants)
+}
+
+// ApproveMerchant 商家审核通过
+// @Summary 商家审核通过
+// @Description 审核通过待审核的商家
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "商家ID"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "商家不存在或不在待审核状态"
+// @Router /api/v1/admin/merchant/approve/{id} [patch]
+func (h *AdminHandler) ApproveMerchant(c *gin.Context) {
+	h.updateStatus(c, h.service.ApproveMerchant, "approve merchant failed")
+}
+
+// RejectMerchant 商家审核驳回
+// @Summary 商家审核驳回
+// @Description 驳回待审核的商家
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "商家ID"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "商家不存在或不在待审核状态"
+// @Router /api/v1/admin/merchant/reject/{id} [patch]
+func (h *AdminHandler) RejectMerchant(c *gin.Context) {
+	h.updateStatus(c, h.service.RejectMerchant, "reject merchant failed")
+}
+
+// ListProducts 获取商品列表
+// @Summary 获取商品列表
+// @Description 按状态和标题获取商品列表, 用于商品审核
+// @Tags 后台管理
+// @Produce json
+// @Param status query int false "商品状态"
+// @Param keyword query string false "商品标题关键词"
+// @Param limit query int false "每页数量, 默认 20, 最大 100"
+// @Param offset query int false "偏移量"
+// @Success 200 {array} domain.Product
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/product/list [get]
+func (h *AdminHandler) ListProducts(c *gin.Context) {
+	status, limit, offset, ok := parseAdminListQuery(c)
+	if !ok {
+		return
+	}
+
+	products, err := h.service.ListProducts(c.Request.Context(), int(status), c.Query("keyword"), limit, offset)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list product failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, products)
+}
+
+// TakedownProduct 下架违规商品
+// @Summary 下架违规商品
+// @Description 强制下架商品
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "商品ID"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "商品不存在"
+// @Router /api/v1/admin/product/takedown/{id} [patch]
+func (h *AdminHandler) TakedownProduct(c *gin.Context) {
+	h.updateStatus(c, h.service.TakedownProduct, "takedown product failed")
+}
+
+// RestoreProduct 恢复上架商品
+// @Summary 恢复上架商品
+// @Description 恢复被下架的商品
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "商品ID"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "商品不存在"
+// @Router /api/v1/admin/product/restore/{id} [patch]
+func (h *AdminHandler) RestoreProduct(c *gin.Context) {
+	h.updateStatus(c, h.service.RestoreProduct, "restore product failed")
+}
+
+// ListOrders 查询全部订单
+// @Summary 查询全部订单
+// @Description 管理员查询全部用户的订单, 可按用户、商家、状态和时间筛选; 按创建时间倒序游标分页
+// @Tags 后台管理
+// @Produce json
+// @Param user_id query int false "用户ID"
+// @Param merchant_id query int false "商家ID"
+// @Param status query string false "订单状态"
+// @Param start_at query int false "创建时间下限(含)"
+// @Param end_at query int false "创建时间上限(不含)"
+// @Param keyword query string false "商品标题关键词"
+// @Param cursor query string false "上一页返回的游标"
+// @Param limit query int false "每页数量, 默认 20, 最大 100"
+// @Success 200 {object} domain.OrderPage
+// @Failure 400 {object} string "invalid request"
+// @Router /api/v1/admin/order/list [get]
+func (h *AdminHandler) ListOrders(c *gin.Context) {
+	var query = &domain.OrderQuery{
+		Status:  c.Query("status"),
+		Keyword: c.Query("keyword"),
+		Cursor:  c.Query("cursor"),
+		All:     true,
+	}
+
+	var (
+		limit int64
+		err   error
+	)
+	for name, dst := range map[string]*int64{
+		"user_id":     &query.UserID,
+		"merchant_id": &query.MerchantID,
+		"start_at":    &query.StartAt,
+		"end_at":      &query.EndAt,
+		"limit":       &limit,
+	} {
+		if *dst, err = parseQueryInt64(c, name); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid "+name, err)
+			return
+		}
+	}
+	query.Limit = int(limit)
+
+	page, err := h.orderService.List(c.Request.Context(), query)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "list order failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, page)
+}
+
+// GetOrder 获取订单详情
+// @Summary 获取订单详情
+// @Description 管理员获取任意订单详情
+// @Tags 后台管理
+// @Produce json
+// @Param id path int true "订单ID"
+// @Success 200 {object} OrderGetResponse
+// @Failure 404 {object} string "订单不存在"
+// @Router /api/v1/admin/order/get/{id} [get]
+func (h *AdminHandler) GetOrder(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid order id", err)
+		return
+	}
+
+	order, orderItem, err := h.orderService.GetByID(c.Request.Context(), id, customClaims.Actor())
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get order failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, &OrderGetResponse{
+		ID:                order.ID,
+		UserID:            order.UserID,
+		OrderStatus:       order.OrderStatus,
+		TotalPrice:        order.TotalPrice,
+		PayPrice:          order.PayPrice,
+		ShippingFee:       order.ShippingFee,
+		DiscountPrice:     order.DiscountPrice,
+		CreatedAt:         order.CreatedAt,
+		UpdatedAt:         order.UpdatedAt,
+		PaymentMethodID:   order.PaymentMethodID,
+		ShippingAddressID: order.ShippingAddressID,
+		OrderItems:        orderItem,
+	})
+}
+
+// CreateCoupon 创建平台优惠券
+// @Summary 创建平台优惠券
+// @Description 管理员创建全平台通用的优惠券
+// @Tags 后台管理
+// @Accept json
+// @Produce json
+// @Param coupon body CouponCreateRequest true "coupon"
+// @Success 201 {object} int64 "优惠券ID"
+// @Failure 400 {object} string "invalid request"
+// @Router /api/v1/admin/coupon/create [put]
+func (h *AdminHandler) CreateCoupon(c *gin.Context) {
+	var req = &CouponCreateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	id, err := h.couponService.Create(c.Request.Context(), &domain.Coupon{
+		Name:         req.Name,
+		IssuerType:   _const.CouponIssuerPlatform,
+		Type:         req.Type,
+		Amount:       req.Amount,
+		Threshold:    req.Threshold,
+		Percent:      req.Percent,
+		MaxDiscount:  req.MaxDiscount,
+		ScopeType:    req.ScopeType,
+		ScopeIDs:     req.ScopeIDs,
+		StartAt:      req.StartAt,
+		EndAt:        req.EndAt,
+		TotalLimit:   req.TotalLimit,
+		PerUserLimit: req.PerUserLimit,
+		VipLevel:     req.VipLevel,
+	})
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "create coupon failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, id)
+}
+
+// Dashboard 数据概览
+// @Summary 数据概览
+// @Description 统计时间范围内的成交额、订单数和新用户数, 未指定时间时统计当天
+// @Tags 后台管理
+// @Produce json
+// @Param start_at query int false "开始时间(含)"
+// @Param end_at query int false "结束时间(不含)"
+// @Success 200 {object} domain.DashboardSummary
+// @Failure 400 {object} string "invalid request"
+// @Router /api/v1/admin/dashboard [get]
+func (h *AdminHandler) Dashboard(c *gin.Context) {
+	startAt, err := parseQueryInt64(c, "start_at")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid start_at", err)
+		return
+	}
+	endAt, err := parseQueryInt64(c, "end_at")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid end_at", err)
+		return
+	}
+
+	summary, err := h.service.Dashboard(c.Request.Context(), startAt, endAt)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "get dashboard failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, summary)
+}
+
+// ListAuditLogs 查询审计日志
+// @Summary 查询审计日志
+// @Description 查询管理员操作审计日志, 按时间倒序
+// @Tags 后台管理
+// @Produce json
+// @Param admin_id query int false "管理员ID"
+// @Param action query string false "操作, 如 PATCH /api/v1/admin/user/ban/:id"
+// @Param start_at query int false "开始时间(含)"
+// @Param end_at query int false "结束时间(不含)"
+// @Param limit query int false "每页数量, 默认 20, 最大 100"
+// @Param offset query int false "偏移量"
+// @Success 200 {array} domain.AuditLog
+// @Failure 400 {object} string "invalid request"
+// @Router /api/v1/admin/audit/list [get]
+func (h *AdminHandler) ListAuditLogs(c *gin.Context) {
+	var (
+		query         = &domain.AuditQuery{Action: c.Query("action")}
+		limit, offset int64
+		err           error
+	)
+	for name, dst := range map[string]*int64{
+		"admin_id": &query.AdminID,
+		"start_at": &query.StartAt,
+		"end_at":   &query.EndAt,
+		"limit":    &limit,
+		"offset":   &offset,
+	} {
+		if *dst, err = parseQueryInt64(c, name); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid "+name, err)
+			return
+		}
+	}
+	query.Limit, query.Offset = int(limit), int(offset)
+
+	logs, err := h.service.ListAuditLogs(c.Request.Context(), query)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list audit log failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, logs)
+}
+
+// ListLoginLocks 查询登录锁定
+// @Summary 查询登录锁定
+// @Description 列出因登录失败次数过多而被临时锁定的账号和 IP
+// @Tags 后台管理
+// @Produce json
+// @Success 200 {array} domain.LoginLock
+// @Router /api/v1/admin/security/locks [get]
+func (h *AdminHandler) ListLoginLocks(c *gin.Context) {
+	locks, err := h.guard.ListLocks(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list login locks failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, locks)
+}
+
+// UnlockLogin 解除登录锁定
+// @Summary 解除登录锁定
+// @Description 解除账号或 IP 的登录锁定并清除失败记录. 账号的 subject 形如 user:12 或 email:a@b.com
+// @Tags 后台管理
+// @Produce json
+// @Param kind query string true "锁定类型: account 或 ip"
+// @Param subject query string true "账号或 IP"
+// @Success 200 {object} string "unlocked"
+// @Failure 400 {object} string "invalid request"
+// @Failure 404 {object} string "lock not found"
+// @Router /api/v1/admin/security/lock [delete]
+func (h *AdminHandler) UnlockLogin(c *gin.Context) {
+	kind, subject := c.Query("kind"), c.Query("subject")
+	if subject == "" {
+		utils.RespondError(c, http.StatusBadRequest, "subject is required", nil)
+		return
+	}
+	if err := h.guard.Unlock(c.Request.Context(), kind, subject); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "unlock failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "unlocked")
+}
+
+// updateStatus 处理以路径参数 id 指定目标的状态变更
+func (h *AdminHandler) updateStatus(c *gin.Context, update func(ctx context.Context, id int64) error, message string) {
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid id", err)
+		return
+	}
+	if err = update(c.Request.Context(), id); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), message, err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "success")
+}
+
+// parseAdminListQuery 解析后台列表通用的 status、limit 和 offset 查询参数
+func parseAdminListQuery(c *gin.Context) (status int64, limit, offset int, ok bool) {
+	status, err := parseQueryInt64(c, "status")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid status", err)
+		return 0, 0, 0, false
+	}
+	l, err := parseQueryInt64(c, "limit")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid limit", err)
+		return 0, 0, 0, false
+	}
+	o, err := parseQueryInt64(c, "offset")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid offset", err)
+		return 0, 0, 0, false
+	}
+	return status, int(l), int(o), true
+}
@@ -13,10 +13,11 @@ import (
 
 type CartHandler struct {
 	CartService service.CartService
+	vip         service.MembershipService
 }
 
-func NewCartHandler(cartService service.CartService) *CartHandler {
-	return &CartHandler{CartService: cartService}
+func NewCartHandler(cartService service.CartService, vip service.MembershipService) *CartHandler {
+	return &CartHandler{CartService: cartService, vip: vip}
 }
 
 // CartCreateResponse 创建用户购物车响应体
@@ -115,12 +116,11 @@ func (h *CartHandler) GetByID(c *gin.Context) {
 
 // GetByUserID 通过用户ID获取用户购物车
 // @Summary 通过用户ID获取用户购物车
-// @Description 通过用户ID获取用户购物车
+// @Description 获取当前登录用户的购物车, 会员同时返回商品的会员价
 // @Tags 购物车
 // @Accept  json
 // @Produce  json
 // @Param Authorization header string true "Bearer token"
-// @Param id path int64 true "用户ID"
 // @Success 200 {object} domain.Cart
 // @Failure 400 {object} string
 // @Failure 401 {object} string
@@ -144,13 +144,24 @@ func (h *CartHandler) GetByUserID(c *gin.Context) {
 		return
 	}
 
-	id := c.GetInt64("id")
-	cart, err := h.CartService.GetByUserID(c, id)
+	cart, err := h.CartService.GetByUserID(c, customClaims.UserID)
 	if err != nil {
 		utils.RespondError(c, http.StatusInternalServerError, "get cart failed", err)
 		return
 	}
 
+	// 会员展示商品当前价格对应的会员价
+	tier, err := h.vip.ActiveTier(c.Request.Context(), customClaims.UserID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get cart failed", err)
+		return
+	}
+	if tier != nil {
+		for i := range cart.CartItems {
+			cart.CartItems[i].MemberPrice = tier.Price(cart.CartItems[i].NowPrice)
+		}
+	}
+
 	utils.RespondJSON(c, http.StatusOK, cart)
 	return
 }
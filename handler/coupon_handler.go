@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+	"strconv"
+)
+
+type CouponHandler struct {
+	service service.CouponService
+}
+
+func NewCouponHandler(service service.CouponService) *CouponHandler {
+	return &CouponHandler{service: service}
+}
+
+// CouponCreateRequest 创建优惠券请求参数, 金额单位为分
+// @Description: 创建优惠券请求参数
+type CouponCreateRequest struct {
+	// @Description: 优惠券名称
+	Name string `json:"name"`
+	// @Description: 优惠类型 (90-立减, 91-折扣, 92-满减, 93-免运费)
+	Type int `json:"type"`
+	// @Description: 减免金额
+	Amount int64 `json:"amount"`
+	// @Description: 使用门槛
+	Threshold int64 `json:"threshold"`
+	// @Description: 折扣百分比
+	Percent int64 `json:"percent"`
+	// @Description: 折扣最高减免
+	MaxDiscount int64 `json:"max_discount"`
+	// @Description: 适用范围 (110-全场, 111-商品, 112-分类, 113-商家)
+	ScopeType int `json:"scope_type"`
+	// @Description: 适用范围ID
+	ScopeIDs []int64 `json:"scope_ids"`
+	// @Description: 生效时间
+	StartAt int64 `json:"start_at"`
+	// @Description: 失效时间
+	EndAt int64 `json:"end_at"`
+	// @Description: 发放总量, 0 表示不限
+	TotalLimit int64 `json:"total_limit"`
+	// @Description: 每人限领, 0 表示不限
+	PerUserLimit int64 `json:"per_user_limit"`
+	// @Description: 领取所需的最低会员等级, 0 表示不限
+	VipLevel int64 `json:"vip_level"`
+}
+
+// CreateCoupon 商家创建优惠券
+// @Summary 商家创建优惠券
+// @Description 商家创建仅适用于本店商品的优惠券
+// @Tags 优惠券
+// @Accept json
+// @Produce json
+// @Param coupon body CouponCreateRequest true "coupon"
+// @Success 201 {object} int64 "优惠券ID"
+// @Failure 400 {object} string "invalid request"
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/coupon/create [put]
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
+	if !ok {
+		return
+	}
+
+	var req = &CouponCreateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	id, err := h.service.Create(c.Request.Context(), &domain.Coupon{
+		Name:         req.Name,
+		IssuerType:   _const.CouponIssuerMerchant,
+		MerchantID:   customClaims.UserID,
+		Type:         req.Type,
+		Amount:       req.Amount,
+		Threshold:    req.Threshold,
+		Percent:      req.Percent,
+		MaxDiscount:  req.MaxDiscount,
+		ScopeType:    req.ScopeType,
+		ScopeIDs:     req.ScopeIDs,
+		StartAt:      req.StartAt,
+		EndAt:        req.EndAt,
+		TotalLimit:   req.TotalLimit,
+		PerUserLimit: req.PerUserLimit,
+		VipLevel:     req.VipLevel,
+	})
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "create coupon failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusCreated, id)
+}
+
+// ListCoupons 获取可领取的优惠券
+// @Summary 获取可领取的优惠券
+// @Description 获取当前可领取的优惠券, 可按商家筛选
+// @Tags 优惠券
+// @Produce json
+// @Param merchant_id query int false "商家ID"
+// @Success 200 {array} domain.Coupon
+// @Failure 500 {object} string "服务器错误"
+// @Router /api/v1/coupon/list [get]
+func (h *CouponHandler) ListCoupons(c *gin.Context) {
+	var merchantID int64
+	if v := c.Query("merchant_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid merchant_id", err)
+			return
+		}
+		merchantID = id
+	}
+
+	coupons, err := h.service.ListAvailable(c.Request.Context(), merchantID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list coupon failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, coupons)
+}
+
+// ClaimCoupon 领取优惠券
+// @Summary 领取优惠券
+// @Description 用户领取优惠券到钱包
+// @Tags 优惠券
+// @Produce json
+// @Param id path int true "优惠券ID"
+// @Success 200 {object} int64 "用户优惠券ID"
+// @Failure 400 {object} string "领取失败"
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "会员专享优惠券, 会员等级不足"
+// @Router /api/v1/coupon/claim/{id} [post]
+func (h *CouponHandler) ClaimCoupon(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+
+	couponID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid coupon id", err)
+		return
+	}
+
+	id, err := h.service.Claim(c.Request.Context(), couponID, customClaims.UserID)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "claim coupon failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, id)
+}
+
+// GetWallet 获取用户优惠券钱包
+// @Summary 获取用户优惠券钱包
+// @Description 获取用户领取的优惠券, 可按状态筛选 (120-未使用, 121-已使用, 122-已过期)
+// @Tags 优惠券
+// @Produce json
+// @Param status query int false "状态"
+// @Success 200 {array} domain.UserCoupon
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "permission denied"
+// @Failure 500 {object} string "服务器错误"
+// @Router /api/v1/coupon/wallet [get]
+func (h *CouponHandler) GetWallet(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+
+	var status int
+	if v := c.Query("status"); v != "" {
+		s, err := strconv.Atoi(v)
+		if err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid status", err)
+			return
+		}
+		status = s
+	}
+
+	wallet, err := h.service.Wallet(c.Request.Context(), customClaims.UserID, status)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get wallet failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, wallet)
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/middleware"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	appproto "github.com/star-find-cloud/star-mall/protobuf/pb"
+	"github.com/star-find-cloud/star-mall/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// gRPC 图片服务使用的 metadata, 键均为小写
+const (
+	// 上传请求: 新建上传时携带所属者、MIME 类型和可选的整个文件的 SHA-256, 续传时只携带 x-image-id
+	mdOwnerType   = "x-owner-type"
+	mdOwnerID     = "x-owner-id"
+	mdContentType = "x-content-type"
+	mdSHA256      = "x-sha256"
+	mdImageID     = "x-image-id"
+	// 上传响应头: 本次上传的图片ID和下一个分片的序号
+	mdNextSeq = "x-next-seq"
+	// 下载请求从 x-resume-seq 分片继续, 响应头返回分片大小
+	mdResumeSeq = "x-resume-seq"
+	mdChunkSize = "x-chunk-size"
+)
+
+const defaultImageChunkSize = 256 << 10
+
+// ImageGRPCServer 实现 protobuf/image.proto 中的 ImageService.
+// 上传: 客户端打开流后读取响应头中的 x-image-id 和 x-next-seq, 从该序号开始发送分片, 每个分片携带图片ID和内容的 SHA-256,
+// 发送完毕后关闭发送端. 中断后携带 x-image-id 重新打开流即可续传.
+// 下载: 按 chunkSize 切分原图, 分片序号从文件开头计算, 携带 x-resume-seq 时从该分片继续
+type ImageGRPCServer struct {
+	appproto.UnimplementedImageServiceServer
+	images    service.ImageStreamService
+	chunkSize int
+}
+
+func NewImageGRPCServer(images service.ImageStreamService, chunkSize int) *ImageGRPCServer {
+	if chunkSize <= 0 {
+		chunkSize = defaultImageChunkSize
+	}
+	return &ImageGRPCServer{images: images, chunkSize: chunkSize}
+}
+
+func (s *ImageGRPCServer) GetImageInfo(ctx context.Context, req *appproto.ImageRequest) (*appproto.ImageProto, error) {
+	image, err := s.images.Get(ctx, req.GetImageId())
+	if err == nil && !ownerMatches(req, image) {
+		err = fmt.Errorf("%w: image %d", sql.ErrNoRows, req.GetImageId())
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &appproto.ImageProto{
+		ImageId:      image.ImageID,
+		OwnerType:    image.OwnerType,
+		OwnerId:      image.OwnerID,
+		Sha256Hash:   image.SHA256Hash,
+		IsCompressed: image.IsCompressed,
+		ContentType:  _const.ContentTypeMIMEMap[image.ContentType],
+	}, nil
+}
+
+func (s *ImageGRPCServer) UploadImage(stream appproto.ImageService_UploadImageServer) error {
+	ctx := stream.Context()
+	claims, ok := middleware.GRPCClaims(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "token is empty")
+	}
+	upload, err := uploadFromMetadata(ctx)
+	if err != nil {
+		return grpcError(err)
+	}
+	upload, err = s.images.BeginUpload(ctx, upload, claims.Actor())
+	if err != nil {
+		return grpcError(err)
+	}
+	defer s.images.EndUpload(ctx, upload)
+	imageID := strconv.FormatInt(upload.ID, 10)
+	if err = stream.SendHeader(metadata.Pairs(mdImageID, imageID, mdNextSeq, strconv.FormatUint(uint64(upload.NextSeq), 10))); err != nil {
+		return err
+	}
+
+	var received uint32
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// 连接中断, 已接收的分片保留在上传进度中
+			return err
+		}
+		if chunk.GetImageId() != imageID {
+			return grpcError(fmt.Errorf("%w: image id %q, want %s", domain.ErrImageChunkInvalid, chunk.GetImageId(), imageID))
+		}
+		if err = s.images.WriteChunk(ctx, upload, chunk.GetSeq(), chunk.GetContent(), chunk.GetSha256Chunk()); err != nil {
+			return grpcError(err)
+		}
+		received++
+	}
+
+	image, err := s.images.CompleteUpload(ctx, upload)
+	if err != nil {
+		return grpcError(err)
+	}
+	return stream.SendAndClose(&appproto.UploadResponse{
+		ImageId:      image.ImageID,
+		Sha256Hash:   image.SHA256Hash,
+		ChunkCount:   upload.NextSeq,
+		SuccessCount: received,
+	})
+}
+
+func (s *ImageGRPCServer) DownloadImage(req *appproto.ImageRequest, stream appproto.ImageService_DownloadImageServer) error {
+	ctx := stream.Context()
+	resumeSeq, err := metadataInt(ctx, mdResumeSeq)
+	if err != nil || resumeSeq < 0 {
+		return grpcError(fmt.Errorf("%w: invalid %s", domain.ErrImageChunkInvalid, mdResumeSeq))
+	}
+	image, r, err := s.images.Open(ctx, req.GetImageId(), resumeSeq*int64(s.chunkSize))
+	if err != nil {
+		return grpcError(err)
+	}
+	defer r.Close()
+	if !ownerMatches(req, image) {
+		return grpcError(fmt.Errorf("%w: image %d", sql.ErrNoRows, req.GetImageId()))
+	}
+	header := metadata.Pairs(mdChunkSize, strconv.Itoa(s.chunkSize), mdSHA256, image.SHA256Hash, mdContentType, _const.ContentTypeMIMEMap[image.ContentType])
+	if err = stream.SendHeader(header); err != nil {
+		return err
+	}
+
+	imageID := strconv.FormatInt(image.ImageID, 10)
+	buf := make([]byte, s.chunkSize)
+	for seq := uint32(resumeSeq); ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			// Send 返回前已完成序列化, 可以复用 buf
+			if serr := stream.Send(&appproto.ImageChunk{Content: buf[:n], ImageId: imageID, Seq: seq, Sha256Chunk: hex.EncodeToString(sum[:])}); serr != nil {
+				return serr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return grpcError(fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err))
+		}
+	}
+}
+
+// ownerMatches 请求指定了所属者时, 图片必须属于该所属者
+func ownerMatches(req *appproto.ImageRequest, image *domain.Image) bool {
+	return (req.GetOwnerType() == 0 || req.GetOwnerType() == image.OwnerType) &&
+		(req.GetOwnerId() == 0 || req.GetOwnerId() == image.OwnerID)
+}
+
+// uploadFromMetadata 读取上传请求的 metadata, 携带 x-image-id 时为续传
+func uploadFromMetadata(ctx context.Context) (*domain.ImageUpload, error) {
+	id, err := metadataInt(ctx, mdImageID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s", domain.ErrImageChunkInvalid, mdImageID)
+	}
+	if id != 0 {
+		return &domain.ImageUpload{ID: id}, nil
+	}
+
+	upload := &domain.ImageUpload{SHA256Hash: metadataValue(ctx, mdSHA256)}
+	if upload.OwnerType, err = metadataInt(ctx, mdOwnerType); err != nil {
+		return nil, fmt.Errorf("%w: invalid %s", domain.ErrImageChunkInvalid, mdOwnerType)
+	}
+	if upload.OwnerID, err = metadataInt(ctx, mdOwnerID); err != nil {
+		return nil, fmt.Errorf("%w: invalid %s", domain.ErrImageChunkInvalid, mdOwnerID)
+	}
+	contentType := metadataValue(ctx, mdContentType)
+	var ok bool
+	if upload.ContentType, ok = contentTypeFromMIME(contentType); !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrImageTypeUnsupported, contentType)
+	}
+	return upload, nil
+}
+
+// contentTypeFromMIME 多个格式对应同一个 MIME 类型(如 jpg 和 jpeg)时取编号最小的
+func contentTypeFromMIME(mime string) (int64, bool) {
+	var found int64
+	for contentType, m := range _const.ContentTypeMIMEMap {
+		if strings.EqualFold(m, mime) && (found == 0 || contentType < found) {
+			found = contentType
+		}
+	}
+	return found, found != 0
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// metadataInt 未携带时返回 0
+func metadataInt(ctx context.Context, key string) (int64, error) {
+	value := metadataValue(ctx, key)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// grpcError 将 service 返回的错误转换为 gRPC 状态, 并在 details 中附带 appproto.ErrorResponse 错误码
+func grpcError(err error) error {
+	code, errCode, msg := codes.Internal, appproto.ErrorCode_UNKNOWN, err.Error()
+	switch {
+	case errors.Is(err, domain.ErrImageChunkInvalid), errors.Is(err, domain.ErrImageHashMismatch):
+		code, errCode = codes.InvalidArgument, appproto.ErrorCode_INVALID_CHUNK
+	case errors.Is(err, domain.ErrImageTypeUnsupported), errors.Is(err, domain.ErrImageTooLarge):
+		code = codes.InvalidArgument
+	case errors.Is(err, domain.ErrImageUploadNotFound):
+		code, errCode = codes.NotFound, appproto.ErrorCode_UPLOAD_TIMEOUT
+	case errors.Is(err, context.DeadlineExceeded):
+		code, errCode = codes.DeadlineExceeded, appproto.ErrorCode_UPLOAD_TIMEOUT
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, domain.ErrImageStorageUnavailable):
+		code, errCode, msg = codes.Unavailable, appproto.ErrorCode_COS_CONNECTION_ERROR, domain.ErrImageStorageUnavailable.Error()
+	case errors.Is(err, domain.ErrImageProcessFailed):
+		code, errCode = codes.Internal, appproto.ErrorCode_COMPRESSION_FAILED
+	case errors.Is(err, domain.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, domain.ErrImageUploadBusy):
+		code = codes.Aborted
+	case errors.Is(err, sql.ErrNoRows):
+		code, msg = codes.NotFound, "image not found"
+	default:
+		msg = "internal error"
+	}
+	if code == codes.Internal || code == codes.Unavailable {
+		log.AppLogger.Errorf("image grpc error: %v", err)
+	}
+
+	st, derr := status.New(code, msg).WithDetails(&appproto.ErrorResponse{Code: errCode, Message: msg})
+	if derr != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
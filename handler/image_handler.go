@@ -1,19 +1,30 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
-	"github.com/gin-gonic/gin/binding"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/service"
 	"github.com/star-find-cloud/star-mall/utils"
+	"io/fs"
 	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
 )
 
 type ImageHandler struct {
 	ImageService service.ImageMetaDataService
+	// LocalService 本地存储服务, 启用 OSS 时为 nil, 图片通过预签名 URL 上传和下载
+	LocalService service.ImageLocalService
+	// Presigner 预签名服务, 未启用 OSS 时为 nil
+	Presigner service.PresignedService
 }
 
-func NewImageHandler(ImageService service.ImageMetaDataService) *ImageHandler {
-	return &ImageHandler{ImageService: ImageService}
+func NewImageHandler(ImageService service.ImageMetaDataService, LocalService service.ImageLocalService, Presigner service.PresignedService) *ImageHandler {
+	return &ImageHandler{ImageService: ImageService, LocalService: LocalService, Presigner: Presigner}
 }
 
 //// UploadImageRequest 图片上传请求体
@@ -40,102 +51,244 @@ type UploadImageResponse struct {
 
 // UploadImage 图片上传
 // @Summary 图片上传
-// @Description 图片上传
-// @Accept json
+// @Description 上传图片到本地存储并保存元数据, 服务端计算 SHA-256, 传入 sha256hash 时校验内容是否一致. 用户和商家只能为自己或自己的商品上传图片
+// @Accept multipart/form-data
 // @Produce json
 // @Tags	image
+// @Security ApiKeyAuth
+// @Param image formData file true "图片文件, 格式由扩展名决定"
+// @Param owner_type formData int true "所属者类型: 31001 商家, 31002 用户, 31003 商品"
+// @Param owner_id formData int true "所属者ID"
+// @Param sha256hash formData string false "客户端计算的 SHA-256"
 // @Success 200 {object} UploadImageResponse
+// @Failure 400 {object} utils.ResponseError "参数错误或不支持的图片格式"
 // @Failure 401 {object} string "没有权限"
+// @Failure 403 {object} utils.ResponseError "不是图片所属者"
+// @Failure 501 {object} utils.ResponseError "未启用本地存储"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/image/upload [post]
 func (h ImageHandler) UploadImage(c *gin.Context) {
-	// TODO implement me
-	panic("implement me")
-	//claims, exists := c.Get("claims")
-	//if !exists {
-	//	utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", exists)
-	//	return
-	//}
-	//
-	//customClaims, ok := claims.(*appjwt.CustomClaims)
-	//if !ok {
-	//	utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", ok)
-	//	return
-	//}
-	//if customClaims.Roles == 0 {
-	//	utils.RespondError(c, http.StatusUnauthorized, "not user", customClaims.Roles)
-	//	return
-	//}
-	//if customClaims.UserID == 0 {
-	//	utils.RespondError(c, http.StatusUnauthorized, "not user", errors.New("not merchant"))
-	//	return
-	//}
-	//
-	//isCompressed, err := strconv.ParseBool(c.PostForm("is_compressed"))
-	//if err != nil {
-	//	utils.RespondError(c, http.StatusBadRequest, "upload failed", err)
-	//	return
-	//}
-	//
-	//sha256hash := c.PostForm("sha256hash")
-	//
-	//var image = &domain.Image{
-	//	IsCompressed: isCompressed,
-	//	SHA256Hash:   sha256hash,
-	//}
-	//
-	//file, err := c.FormFile("image")
-	//if err != nil {
-	//	utils.RespondError(c, http.StatusBadRequest, "upload failed", err)
-	//	return
-	//}
-	//
-	//id, err := h.ImageService.Save(c.Request.Context(), image)
-	//if err != nil {
-	//	utils.RespondError(c, http.StatusBadRequest, "upload failed", err)
-	//	return
-	//}
-	//
-	//utils.RespondJSON(c, http.StatusOK, UploadImageResponse{
-	//	Message: "upload successfully",
-	//	ImageID: id,
-	//})
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	if h.LocalService == nil {
+		utils.RespondError(c, http.StatusNotImplemented, "local image storage is disabled", errors.New("use presigned upload url"))
+		return
+	}
+
+	ownerType, err := strconv.ParseInt(c.PostForm("owner_type"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid owner_type", err)
+		return
+	}
+	ownerID, err := strconv.ParseInt(c.PostForm("owner_id"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid owner_id", err)
+		return
+	}
+	file, err := c.FormFile("image")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "upload failed", err)
+		return
+	}
+
+	var image = &domain.Image{
+		OwnerType:  ownerType,
+		OwnerID:    ownerID,
+		SHA256Hash: c.PostForm("sha256hash"),
+	}
+	id, err := h.LocalService.Upload(c.Request.Context(), image, file, customClaims.Actor())
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "upload failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, UploadImageResponse{
+		Message:  "upload successfully",
+		ImageID:  id,
+		FilePath: image.Path,
+	})
 }
 
-// GetImageRequest 获取图片请求体
+// ServeImage 读取图片
+// @Summary 读取图片
+// @Description 返回本地存储的图片内容, ETag 为图片的 SHA-256, 支持 If-None-Match 和 Range 请求. 指定 size 时返回对应尺寸的版本, 版本尚未生成时返回原图并只短暂缓存
+// @Produce image/jpeg,image/png,image/webp,image/gif
+// @Tags	image
+// @Param id path int true "图片ID"
+// @Param size query string false "尺寸: original(默认)、thumbnail、medium、large"
+// @Param format query string false "webp 时优先返回 WebP, 也可通过 Accept: image/webp 协商"
+// @Param Range header string false "如 bytes=0-1023"
+// @Success 200 {file} file "图片内容"
+// @Success 206 {file} file "部分内容"
+// @Success 304 {string} string "未修改"
+// @Failure 400 {object} utils.ResponseError "未知的尺寸"
+// @Failure 404 {object} utils.ResponseError "图片不存在"
+// @Router /image/{id} [get]
+func (h ImageHandler) ServeImage(c *gin.Context) {
+	if h.LocalService == nil {
+		utils.RespondError(c, http.StatusNotFound, "local image storage is disabled", errors.New("use presigned download url"))
+		return
+	}
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid image id", err)
+		return
+	}
+
+	size := c.Query("size")
+	image, path, err := h.LocalService.Download(c.Request.Context(), id, size, wantsWebP(c))
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get image failed", err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		utils.RespondError(c, status, "get image failed", err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get image failed", err)
+		return
+	}
+
+	contentType, ok := _const.ContentTypeMIMEMap[image.ContentType]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if size != "" {
+		header.Set("Vary", "Accept")
+	}
+	if size != "" && size != domain.ImageSizeOriginal && image.Variant == "" {
+		// 版本尚未生成时返回的原图只短暂缓存, 生成后客户端能取到对应尺寸
+		header.Set("Cache-Control", "public, max-age=60")
+	} else {
+		// 同一ID的图片内容不会改变, 更换图片时会生成新的ID
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	if image.SHA256Hash != "" {
+		header.Set("ETag", `"`+image.SHA256Hash+`"`)
+	}
+	// ServeContent 处理 Range、If-Range 和 If-None-Match
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), f)
+}
+
+// DeleteImage 删除图片
+// @Summary 删除图片
+// @Description 删除本地存储的图片文件和元数据, 仅图片所属者和管理员可操作
+// @Produce json
+// @Tags	image
+// @Security ApiKeyAuth
+// @Param id path int true "图片ID"
+// @Success 200 {string} string "delete successfully"
+// @Failure 401 {object} utils.ResponseError
+// @Failure 403 {object} utils.ResponseError "不是图片所属者"
+// @Failure 404 {object} utils.ResponseError "图片不存在"
+// @Router /api/v1/image/{id} [delete]
+func (h ImageHandler) DeleteImage(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	if h.LocalService == nil {
+		utils.RespondError(c, http.StatusNotImplemented, "local image storage is disabled", errors.New("use presigned delete url"))
+		return
+	}
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid image id", err)
+		return
+	}
+	if err = h.LocalService.Remove(c.Request.Context(), id, customClaims.Actor()); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "delete failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "delete successfully")
+}
+
+// GetImageRequest 获取图片请求参数
 type GetImageRequest struct {
 	// @Description 图片ID
-	ID int64 `json:"id"`
+	ID int64 `json:"id" form:"id" binding:"required"`
+	// @Description 尺寸: original(默认)、thumbnail、medium、large
+	Size string `json:"size" form:"size"`
+}
+
+// GetImageResponse 图片元数据和访问地址
+type GetImageResponse struct {
+	*domain.Image
+	// @Description 访问地址, 本地存储为 /image/{id}, 启用 OSS 时为预签名下载 URL
+	URL string
 }
 
 // GetImage 获取图片
 // @Summary GetImage 获取图片
-// @Description 获取图片
-// @Accept json
+// @Description 获取图片元数据和指定尺寸的访问地址, 版本尚未生成时返回原图的地址
 // @Produce json
 // @Tags	image
-// @Param image body GetImageRequest true "image"
-// @Success 200 {object} domain.Image "get successfully"
-// @Failure 401 {object} string "没有权限"
+// @Param id query int true "图片ID"
+// @Param size query string false "尺寸: original(默认)、thumbnail、medium、large"
+// @Param format query string false "webp 时优先返回 WebP 版本的地址"
+// @Success 200 {object} GetImageResponse "get successfully"
+// @Failure 400 {object} utils.ResponseError "参数错误或未知的尺寸"
+// @Failure 404 {object} utils.ResponseError "图片不存在"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/image/getImage [get]
 func (h ImageHandler) GetImage(c *gin.Context) {
 	var req = &GetImageRequest{}
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    http.StatusBadRequest,
-			"message": err.Error(),
-		})
+	if err := c.ShouldBindQuery(req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
 		return
 	}
 
 	image, err := h.ImageService.Get(c.Request.Context(), req.ID)
 	if err != nil {
-		utils.RespondError(c, http.StatusBadRequest, "get failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "get failed", err)
 		return
 	}
 
-	utils.RespondJSON(c, http.StatusOK, image)
+	var url string
+	if h.Presigner != nil {
+		url, err = h.Presigner.GenerateDownloadURL(c.Request.Context(), req.ID, req.Size, wantsWebP(c))
+		if err != nil {
+			utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get failed", err)
+			return
+		}
+	} else {
+		// 提前校验尺寸, 避免返回无法访问的地址
+		if _, _, err = h.LocalService.Download(c.Request.Context(), req.ID, req.Size, false); err != nil {
+			utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get failed", err)
+			return
+		}
+		query := neturl.Values{}
+		if req.Size != "" {
+			query.Set("size", req.Size)
+		}
+		if c.Query("format") != "" {
+			query.Set("format", c.Query("format"))
+		}
+		url = "/image/" + strconv.FormatInt(req.ID, 10)
+		if len(query) > 0 {
+			url += "?" + query.Encode()
+		}
+	}
+
+	utils.RespondJSON(c, http.StatusOK, GetImageResponse{Image: image, URL: url})
+}
+
+// wantsWebP format=webp 或 Accept 包含 image/webp 时优先返回 WebP
+func wantsWebP(c *gin.Context) bool {
+	return c.Query("format") == "webp" || strings.Contains(c.GetHeader("Accept"), "image/webp")
 }
 
 //// UploadImage
@@ -1,11 +1,9 @@
 package handler
 
 import (
-	"errors"
 	"github.com/gin-gonic/gin"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
-	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
 	"github.com/star-find-cloud/star-mall/service"
 	"github.com/star-find-cloud/star-mall/utils"
 	"net/http"
@@ -43,22 +41,9 @@ type InventoryCreateRequest struct {
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/inventory/create [put]
 func (h *InventoryHandler) Create(c *gin.Context) {
-	// 解析jwt
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-
-	// 验证jwt
-	customClaims, ok := claims.(*appjwt.CustomClaims)
+	// 解析jwt, 只允许商家和管理员访问
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
 	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-	// 验证角色是否是商家
-	if customClaims.Roles != _const.MerchantRole {
-		utils.RespondError(c, http.StatusUnauthorized, "not merchant", errors.New("not merchant"))
 		return
 	}
 
@@ -75,9 +60,9 @@ func (h *InventoryHandler) Create(c *gin.Context) {
 		LowStockThreshold: req.LowStockThreshold,
 	}
 
-	err := h.service.Create(c, inventory, customClaims.UserID)
+	err := h.service.Create(c, inventory, customClaims.Actor())
 	if err != nil {
-		utils.RespondError(c, http.StatusBadRequest, "创建库存失败", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "创建库存失败", err)
 		return
 	}
 
@@ -96,22 +81,9 @@ func (h *InventoryHandler) Create(c *gin.Context) {
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/inventory/update [patch]
 func (h *InventoryHandler) Update(c *gin.Context) {
-	// 解析jwt
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-
-	// 验证jwt
-	customClaims, ok := claims.(*appjwt.CustomClaims)
+	// 解析jwt, 只允许商家和管理员访问
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
 	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-	// 验证角色是否是商家
-	if customClaims.Roles != _const.MerchantRole {
-		utils.RespondError(c, http.StatusUnauthorized, "not merchant", errors.New("not merchant"))
 		return
 	}
 
@@ -128,13 +100,13 @@ func (h *InventoryHandler) Update(c *gin.Context) {
 		LowStockThreshold: req.LowStockThreshold,
 	}
 
-	err := h.service.Update(c, inventory, customClaims.UserID)
+	err := h.service.Update(c, inventory, customClaims.Actor())
 	if err != nil {
-		utils.RespondError(c, http.StatusBadRequest, "创建库存失败", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "更新库存失败", err)
 		return
 	}
 
-	utils.RespondJSON(c, http.StatusCreated, "创建库存成功")
+	utils.RespondJSON(c, http.StatusOK, "更新库存成功")
 	return
 }
 
@@ -146,20 +118,24 @@ func (h *InventoryHandler) Update(c *gin.Context) {
 // @Param id path int64 true "inventory id"
 // @Success 200 {object} domain.Inventory "inventory"
 // @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "forbidden"
 // @Failure 404 {object} string "inventory not found"
 // @Failure 500 {object} string "服务器错误"
-// @Router /api/v1/inventory/{id} [get]
+// @Router /api/v1/inventory/get/{id} [get]
 func (h *InventoryHandler) GetByID(c *gin.Context) {
-	_, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
+	if !ok {
 		return
 	}
 
-	var id = c.GetInt64("id")
-	inventory, err := h.service.GetByID(c, id)
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid id", err)
+		return
+	}
+	inventory, err := h.service.GetByID(c, id, customClaims.Actor())
 	if err != nil {
-		utils.RespondError(c, http.StatusNotFound, "获取库存失败", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusNotFound), "获取库存失败", err)
 		return
 	}
 
@@ -175,20 +151,24 @@ func (h *InventoryHandler) GetByID(c *gin.Context) {
 // @Param id path int64 true "inventory id"
 // @Success 200 {object} []domain.Inventory "inventory 数组"
 // @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "forbidden"
 // @Failure 404 {object} string "inventory not found"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/inventory/search/{MerchantID} [get]
 func (h *InventoryHandler) GetByMerchant(c *gin.Context) {
-	_, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
+	if !ok {
+		return
+	}
+	id, err := utils.ParsePathParamInt64(c, "MerchantID")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid merchant id", err)
 		return
 	}
-	var id = c.GetInt64("id")
 
-	inventorys, err := h.service.GetByMerchantID(c, id)
+	inventorys, err := h.service.GetByMerchantID(c, id, customClaims.Actor())
 	if err != nil {
-		utils.RespondError(c, http.StatusNotFound, "获取库存失败", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusNotFound), "获取库存失败", err)
 		return
 	}
 
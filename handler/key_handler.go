@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"net/http"
+)
+
+type KeyHandler struct {
+	keys *appjwt.KeySet
+}
+
+func NewKeyHandler(keys *appjwt.KeySet) *KeyHandler {
+	return &KeyHandler{keys: keys}
+}
+
+// JWKS 获取 token 验证公钥
+// @Summary 获取 token 验证公钥
+// @Description 以 JWKS 格式返回全部签名密钥的公钥, 供其他服务按 kid 验证 token
+// @Tags 公共
+// @Produce json
+// @Success 200 {object} appjwt.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *KeyHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
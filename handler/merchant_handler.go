@@ -21,7 +21,6 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
-	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
 	applogger "github.com/star-find-cloud/star-mall/pkg/logger"
 	appproto "github.com/star-find-cloud/star-mall/protobuf/pb"
 
@@ -103,9 +102,6 @@ type MerchantRegisterResponse struct {
 
 	// Phone 商家店铺电话
 	Phone string `json:"phone" example:"+8613800138000"`
-
-	// UploadToken 后续传输图片所需的 临时用户凭证
-	UploadToken string `json:"uploadToken" example:"<KEY>"`
 }
 
 // MerchantUpdateRequest 商家更新请求
@@ -133,7 +129,7 @@ type MerchantUpdateRequest struct {
 
 // Register 注册商家
 // @Summary 注册商家
-// @Description 注册商家
+// @Description 注册商家, 商家为待审核状态, 管理员审核通过后才能登录
 // @Tags merchant
 // @Accept json
 // @Produce json
@@ -165,7 +161,7 @@ func (h *MerchantHandler) Register(c *gin.Context) {
 	}
 
 	// 创建商户记录
-	merchantID, token, err := h.MerchantService.Register(c.Request.Context(), &domain.Merchant{
+	merchantID, err := h.MerchantService.Register(c.Request.Context(), &domain.Merchant{
 		UserID:       userID,
 		Name:         req.Name,
 		Phone:        req.Phone,
@@ -194,12 +190,11 @@ func (h *MerchantHandler) Register(c *gin.Context) {
 	}
 
 	utils.RespondJSON(c, http.StatusCreated, MerchantRegisterResponse{
-		Code:        http.StatusCreated,
-		MerchantID:  merchantID,
-		UserID:      userID,
-		Email:       req.Email,
-		Phone:       req.Phone,
-		UploadToken: token,
+		Code:       http.StatusCreated,
+		MerchantID: merchantID,
+		UserID:     userID,
+		Email:      req.Email,
+		Phone:      req.Phone,
 	})
 }
 
@@ -288,17 +283,13 @@ func (h *MerchantHandler) Select(c *gin.Context) {
 // @Failure 500 {object} string "internal server error"
 // @Router /api/v1/merchants/update [patch]
 func (h *MerchantHandler) Update(c *gin.Context) {
-	// 获取商家 token
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	// 获取商家 token, 商家只能修改自己的信息
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
 		return
 	}
-
-	// 将 claims 转换为 CustomClaims 类型
-	customClaims, ok := claims.(*appjwt.CustomClaims)
-	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", nil)
+	if !customClaims.Actor().IsMerchant() {
+		utils.RespondError(c, http.StatusForbidden, "not merchant", domain.ErrForbidden)
 		return
 	}
 
@@ -322,10 +313,10 @@ func (h *MerchantHandler) Update(c *gin.Context) {
 	merchant.BusinessType = req.BusinessType
 
 	// 调用 service 层更新商家信息
-	err := h.MerchantService.Update(c.Request.Context(), merchant)
+	err := h.MerchantService.Update(c.Request.Context(), merchant, customClaims.Actor())
 	if err != nil {
 		applogger.AppLogger.Errorf("update failed: %v", err)
-		utils.RespondError(c, http.StatusInternalServerError, "update failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "update failed", err)
 		return
 	}
 
@@ -338,29 +329,29 @@ func (h *MerchantHandler) Update(c *gin.Context) {
 // @Tags merchant
 // @Accept json
 // @Produce json
+// @Param merchantID path int true "Merchant ID" minimum(1)
 // @Success 200 {object} string "merchant deleted successfully"
 // @Failure 401 {object} string "unauthorized"
+// @Failure 403 {object} string "forbidden"
 // @Failure 500 {object} string "internal server error"
-// @Router /api/v1/merchants/delete [delete]
+// @Router /api/v1/merchants/delete/{merchantID} [delete]
 func (h *MerchantHandler) Delete(c *gin.Context) {
-	// 获取商家 token
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "unauthorized", nil)
+	// 获取 token, 商家只能删除自己, 管理员可以删除任意商家
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
 		return
 	}
 
-	// 将 claims 转换为 CustomClaims 类型
-	customClaims, ok := claims.(*appjwt.CustomClaims)
-	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", nil)
+	merchantID, err := utils.ParsePathParamInt64(c, "merchantID")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid merchant id", err)
 		return
 	}
 
-	err := h.MerchantService.Delete(c.Request.Context(), customClaims.UserID)
+	err = h.MerchantService.Delete(c.Request.Context(), merchantID, customClaims.Actor())
 	if err != nil {
 		applogger.AppLogger.Errorf("delete failed: %v", err)
-		utils.RespondError(c, http.StatusInternalServerError, "delete failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "delete failed", err)
 		return
 	}
 
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+)
+
+// oauthStateCookie 发起授权时写入的 state, 回调时必须与 query 中的 state 一致,
+// 防止攻击者诱导用户打开携带攻击者授权码的回调地址 (登录 CSRF)
+const (
+	oauthStateCookie     = "oauth_state"
+	oauthStateCookiePath = "/api/v1/oauth/callback"
+)
+
+type OAuthHandler struct {
+	service service.OAuthService
+	// secure 为 true 时 state cookie 只通过 HTTPS 发送
+	secure bool
+}
+
+func NewOAuthHandler(service service.OAuthService, secure bool) *OAuthHandler {
+	return &OAuthHandler{service: service, secure: secure}
+}
+
+// OAuthURLResponse 第三方授权地址, 前端跳转到该地址完成授权
+type OAuthURLResponse struct {
+	URL string `json:"url"`
+}
+
+// Providers 第三方登录方式列表
+// @Summary 第三方登录方式列表
+// @Description 返回已配置的第三方登录提供方名称
+// @Tags 第三方登录
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/v1/oauth/providers [get]
+func (h *OAuthHandler) Providers(c *gin.Context) {
+	utils.RespondJSON(c, http.StatusOK, h.service.Providers())
+}
+
+// Login 发起第三方登录
+// @Summary 发起第三方登录
+// @Description 生成带 state 和 PKCE 参数的授权地址, 授权完成后提供方回调 /api/v1/oauth/callback/{provider}.
+// @Description state 同时写入 HttpOnly cookie, 回调必须在发起授权的浏览器中完成
+// @Tags 第三方登录
+// @Produce json
+// @Param provider path string true "提供方名称"
+// @Success 200 {object} OAuthURLResponse
+// @Failure 404 {object} utils.ResponseError "提供方不存在"
+// @Router /api/v1/oauth/login/{provider} [get]
+func (h *OAuthHandler) Login(c *gin.Context) {
+	h.authURL(c, 0)
+}
+
+// Link 绑定第三方账号
+// @Summary 绑定第三方账号
+// @Description 已登录用户发起授权, 回调后将第三方账号绑定到当前用户. 只支持普通用户, 商家和管理员不能绑定
+// @Tags 第三方登录
+// @Produce json
+// @Security ApiKeyAuth
+// @Param provider path string true "提供方名称"
+// @Success 200 {object} OAuthURLResponse
+// @Failure 404 {object} utils.ResponseError "提供方不存在"
+// @Router /api/v1/oauth/link/{provider} [post]
+func (h *OAuthHandler) Link(c *gin.Context) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	// user_identities 只保存用户ID, 商家和管理员的ID与用户ID不在同一空间
+	if !claims.Actor().IsUser() {
+		utils.RespondError(c, http.StatusForbidden, "not User", domain.ErrForbidden)
+		return
+	}
+	h.authURL(c, claims.UserID)
+}
+
+func (h *OAuthHandler) authURL(c *gin.Context, linkUserID int64) {
+	url, state, err := h.service.AuthURL(c.Request.Context(), c.Param("provider"), linkUserID)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadGateway), "oauth authorize failed", err.Error())
+		return
+	}
+	h.setStateCookie(c, state, 0)
+	utils.RespondJSON(c, http.StatusOK, OAuthURLResponse{URL: url})
+}
+
+// setStateCookie 提供方回调是跨站的顶级跳转, 需要 SameSite=Lax 才会携带; maxAge 为 0 时是会话 cookie, 小于 0 时删除
+func (h *OAuthHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     oauthStateCookiePath,
+		MaxAge:   maxAge,
+		Secure:   h.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Callback 第三方授权回调
+// @Summary 第三方授权回调
+// @Description 使用授权码完成登录或绑定. 登录时未绑定的第三方账号自动注册; 开启两步验证的账号返回 MFAChallengeResponse
+// @Tags 第三方登录
+// @Produce json
+// @Param provider path string true "提供方名称"
+// @Param code query string true "授权码"
+// @Param state query string true "发起授权时的 state"
+// @Success 200 {object} LoginResponse
+// @Success 201 {object} LoginResponse "首次登录自动注册"
+// @Failure 400 {object} utils.ResponseError
+// @Failure 401 {object} utils.ResponseError "state 无效、已过期或不是当前浏览器发起的"
+// @Failure 409 {object} utils.ResponseError "第三方账号已绑定其他用户或邮箱已注册"
+// @Router /api/v1/oauth/callback/{provider} [get]
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	if reason := c.Query("error"); reason != "" {
+		utils.RespondError(c, http.StatusBadRequest, "oauth authorize denied", reason)
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		utils.RespondError(c, http.StatusBadRequest, "code and state are required", nil)
+		return
+	}
+	bound, _ := c.Cookie(oauthStateCookie)
+	h.setStateCookie(c, "", -1)
+	if subtle.ConstantTimeCompare([]byte(bound), []byte(state)) != 1 {
+		logger.SecurityLogger.Warnf("oauth state is not bound to this browser, provider: %s", c.Param("provider"))
+		utils.RespondError(c, http.StatusUnauthorized, "oauth login failed", domain.ErrOAuthStateInvalid.Error())
+		return
+	}
+
+	result, err := h.service.Callback(c.Request.Context(), c.Param("provider"), code, state)
+	if err != nil {
+		logger.AppLogger.Warnf("oauth callback failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadGateway), "oauth login failed", err.Error())
+		return
+	}
+	if result.Linked {
+		utils.RespondJSON(c, http.StatusOK, "linked successfully")
+		return
+	}
+	if result.Token.MFARequired() {
+		respondMFAChallenge(c, result.Token)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Registered {
+		status = http.StatusCreated
+	}
+	utils.RespondJSON(c, status, LoginResponse{
+		result.Token.AccessToken,
+		result.Token.RefreshToken,
+		result.Token.ExpiresIn,
+		result.User.RoleID,
+		result.User.ID,
+	})
+}
+
+// Identities 已绑定的第三方账号
+// @Summary 已绑定的第三方账号
+// @Tags 第三方登录
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} domain.UserIdentity
+// @Router /api/v1/oauth/identities [get]
+func (h *OAuthHandler) Identities(c *gin.Context) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	if !claims.Actor().IsUser() {
+		utils.RespondError(c, http.StatusForbidden, "not User", domain.ErrForbidden)
+		return
+	}
+	identities, err := h.service.ListIdentities(c.Request.Context(), claims.UserID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list identities failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, identities)
+}
+
+// Unlink 解除第三方账号绑定
+// @Summary 解除第三方账号绑定
+// @Tags 第三方登录
+// @Produce json
+// @Security ApiKeyAuth
+// @Param provider path string true "提供方名称"
+// @Success 200 {string} string "unlinked successfully"
+// @Failure 404 {object} utils.ResponseError "未绑定"
+// @Router /api/v1/oauth/unlink/{provider} [delete]
+func (h *OAuthHandler) Unlink(c *gin.Context) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	if !claims.Actor().IsUser() {
+		utils.RespondError(c, http.StatusForbidden, "not User", domain.ErrForbidden)
+		return
+	}
+	if err := h.service.Unlink(c.Request.Context(), claims.UserID, c.Param("provider")); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "unlink failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "unlinked successfully")
+}
@@ -1,14 +1,13 @@
 package handler
 
 import (
-	"errors"
 	"github.com/gin-gonic/gin"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
-	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
 	"github.com/star-find-cloud/star-mall/service"
 	"github.com/star-find-cloud/star-mall/utils"
 	"net/http"
+	"strconv"
 )
 
 type OrderHandler struct {
@@ -22,20 +21,14 @@ func NewOrderHandler(service service.OrderService) *OrderHandler {
 // CreateOrderRequest 创建订单请求参数
 // @Description: 创建订单请求参数
 type CreateOrderRequest struct {
-	// @Description: 总金额
-	TotalPrice int64 `json:"total_price"`
-	// @Description: 支付金额
-	PayPrice int64 `json:"pay_price"`
 	// @Description: 商品ID
 	ProductID int64 `json:"product_id"`
-	// @Description: 商品名称
-	ProductTitle string `json:"product_title"`
-	// @Description: 商品单价
-	UnitPrice int64 `json:"unit_price"`
 	// @Description: 商品数量
 	Quantity int64 `json:"quantity"`
-	// @Description: 商品小计
-	Subtotal int64 `json:"subtotal"`
+	// @Description: 收货地址ID
+	ShippingAddressID int64 `json:"shipping_id"`
+	// @Description: 指定使用的用户优惠券ID, 为空时自动选择最优组合
+	UserCouponIDs []int64 `json:"user_coupon_ids"`
 }
 
 // CreateOrderResponse 创建订单响应参数
@@ -56,22 +49,16 @@ type CreateOrderResponse struct {
 // @Param order body CreateOrderRequest true "order"
 // @Success 200 {object} CreateOrderResponse
 // @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "forbidden"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/order/create [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-
-	customClaims, ok := claims.(*appjwt.CustomClaims)
+	customClaims, ok := utils.MustClaims(c)
 	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
 		return
 	}
-	if customClaims.Roles != _const.UserRole {
-		utils.RespondError(c, http.StatusUnauthorized, "not User", errors.New("not User"))
+	if !customClaims.Actor().IsUser() {
+		utils.RespondError(c, http.StatusForbidden, "not User", domain.ErrForbidden)
 		return
 	}
 
@@ -84,24 +71,18 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 
 	var order = &domain.Order{
-		UserID:      userID,
-		OrderStatus: "待付款",
-		TotalPrice:  req.TotalPrice,
-		PayPrice:    req.PayPrice,
+		UserID:            userID,
+		ShippingAddressID: req.ShippingAddressID,
 	}
 
 	var orderItem = &domain.OrderItem{
-		OrderID:      order.ID,
-		ProductID:    req.ProductID,
-		ProductTitle: req.ProductTitle,
-		UnitPrice:    req.UnitPrice,
-		Quantity:     req.Quantity,
-		Subtotal:     req.Subtotal,
+		ProductID: req.ProductID,
+		Quantity:  req.Quantity,
 	}
 
-	id, createAt, err := h.service.Create(c.Request.Context(), order, orderItem, userID)
+	id, createAt, err := h.service.Create(c.Request.Context(), order, orderItem, userID, req.UserCouponIDs)
 	if err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, "create order failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "create order failed", err)
 		return
 	}
 
@@ -129,6 +110,10 @@ type OrderGetResponse struct {
 	TotalPrice int64 `json:"totalPrice"`
 	// @Description: 支付金额
 	PayPrice int64 `json:"payPrice"`
+	// @Description: 运费
+	ShippingFee int64 `json:"shippingFee"`
+	// @Description: 优惠金额
+	DiscountPrice int64 `json:"discountPrice"`
 	// @Description: 创建时间
 	CreatedAt int64 `json:"createdAt"`
 	// @Description: 更新时间
@@ -150,22 +135,13 @@ type OrderGetResponse struct {
 // @Param id path int true "订单ID"
 // @Success 200 {object} OrderGetResponse
 // @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "forbidden"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/order/get [get]
 func (h *OrderHandler) GetOrder(c *gin.Context) {
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-
-	customClaims, ok := claims.(*appjwt.CustomClaims)
+	// 订单归属在 service 中校验
+	customClaims, ok := utils.MustClaims(c)
 	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-	if customClaims.Roles != _const.UserRole {
-		utils.RespondError(c, http.StatusUnauthorized, "not User", errors.New("not User"))
 		return
 	}
 
@@ -175,9 +151,9 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	order, orderItem, err := h.service.GetByID(c.Request.Context(), req.ID)
+	order, orderItem, err := h.service.GetByID(c.Request.Context(), req.ID, customClaims.Actor())
 	if err != nil {
-		utils.RespondError(c, http.StatusInternalServerError, "get order failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get order failed", err)
 		return
 	}
 
@@ -187,6 +163,8 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		OrderStatus:       order.OrderStatus,
 		TotalPrice:        order.TotalPrice,
 		PayPrice:          order.PayPrice,
+		ShippingFee:       order.ShippingFee,
+		DiscountPrice:     order.DiscountPrice,
 		CreatedAt:         order.CreatedAt,
 		UpdatedAt:         order.UpdatedAt,
 		PaymentMethodID:   order.PaymentMethodID,
@@ -196,3 +174,114 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 	return
 }
+
+// OrderCancelRequest 取消订单请求参数
+// @Description: 取消订单请求参数
+type OrderCancelRequest struct {
+	// @Description: 订单ID
+	ID int64 `json:"id"`
+}
+
+// CancelOrder 取消订单
+// @Summary 取消订单
+// @Description: 取消待付款订单, 退回已使用的优惠券
+// @Tags 订单
+// @Accept  json
+// @Produce  json
+// @Param order body OrderCancelRequest true "order"
+// @Success 200 {object} string "order canceled"
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "forbidden"
+// @Failure 500 {object} string "服务器错误"
+// @Router /api/v1/order/cancel [patch]
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	var req = &OrderCancelRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	if err := h.service.Cancel(c.Request.Context(), req.ID, customClaims.Actor()); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "cancel order failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, "order canceled")
+}
+
+// ListOrders 获取订单列表
+// @Summary 获取订单列表
+// @Description 用户获取自己的订单, 商家获取包含自家商品的订单; 按创建时间倒序游标分页
+// @Tags 订单
+// @Produce  json
+// @Param status query string false "订单状态"
+// @Param start_at query int false "创建时间下限(含)"
+// @Param end_at query int false "创建时间上限(不含)"
+// @Param keyword query string false "商品标题关键词"
+// @Param cursor query string false "上一页返回的游标"
+// @Param limit query int false "每页数量, 默认 20, 最大 100"
+// @Success 200 {object} domain.OrderPage
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "forbidden"
+// @Failure 500 {object} string "服务器错误"
+// @Router /api/v1/order/list [get]
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	var query = &domain.OrderQuery{
+		Status:  c.Query("status"),
+		Keyword: c.Query("keyword"),
+		Cursor:  c.Query("cursor"),
+	}
+	// 订单归属只取自 JWT, 不接受查询参数
+	switch customClaims.Roles {
+	case _const.UserRole:
+		query.UserID = customClaims.UserID
+	case _const.MerchantRole:
+		query.MerchantID = customClaims.UserID
+	default:
+		utils.RespondError(c, http.StatusForbidden, "not User or merchant", domain.ErrForbidden)
+		return
+	}
+
+	var err error
+	if query.StartAt, err = parseQueryInt64(c, "start_at"); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid start_at", err)
+		return
+	}
+	if query.EndAt, err = parseQueryInt64(c, "end_at"); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid end_at", err)
+		return
+	}
+	limit, err := parseQueryInt64(c, "limit")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid limit", err)
+		return
+	}
+	query.Limit = int(limit)
+
+	page, err := h.service.List(c.Request.Context(), query)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "list order failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, page)
+}
+
+// parseQueryInt64 解析可选的整数查询参数, 参数缺失时返回 0
+func parseQueryInt64(c *gin.Context, name string) (int64, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
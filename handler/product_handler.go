@@ -5,6 +5,7 @@ import (
 	"github.com/gin-gonic/gin"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
 	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
 	applog "github.com/star-find-cloud/star-mall/pkg/logger"
 	"github.com/star-find-cloud/star-mall/service"
@@ -15,10 +16,12 @@ import (
 
 type ProductHandler struct {
 	ProductService service.ProductService
+	vip            service.MembershipService
+	suggest        service.SuggestService
 }
 
-func NewProductHandler(productService service.ProductService) *ProductHandler {
-	return &ProductHandler{ProductService: productService}
+func NewProductHandler(productService service.ProductService, vip service.MembershipService, suggest service.SuggestService) *ProductHandler {
+	return &ProductHandler{ProductService: productService, vip: vip, suggest: suggest}
 }
 
 type ProductCreateRequest struct {
@@ -161,6 +164,7 @@ func (h *ProductHandler) Create(c *gin.Context) {
 // @Produce json
 // @Tags 商品
 // @Param id path int64 true "商品ID"
+// @Param Authorization header string false "Bearer token, 会员登录后返回会员价"
 // @Success 200 {object} domain.Product "product get successfully"
 // @Failure 401 {object} string "invalid token claims"
 // @Failure 500 {object} string "服务器错误"
@@ -179,6 +183,16 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
+	// 登录的会员展示会员价, 游客和非会员只展示原价
+	if claims, err := utils.GetClaims(c); err == nil {
+		tier, err := h.vip.ActiveTier(c.Request.Context(), claims.UserID)
+		if err != nil {
+			applog.AppLogger.Warnf("获取会员等级失败: %v", err)
+		} else if tier != nil {
+			product.MemberPrice = tier.Price(product.Price)
+		}
+	}
+
 	utils.RespondJSON(c, http.StatusOK, product)
 	//applog.AppLogger.Info("product get successfully")
 	return
@@ -269,26 +283,13 @@ type ProductUpdateRequest struct {
 // @Param product body ProductUpdateRequest true "product"
 // @Success 200 {object} string "product updated successfully"
 // @Failure 401 {object} string "没有权限"
+// @Failure 403 {object} string "forbidden"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/products/update [patch]
 func (h *ProductHandler) Update(c *gin.Context) {
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-
-	customClaims, ok := claims.(*appjwt.CustomClaims)
+	// 商品归属在 service 中校验, 管理员可以更新任意商品
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
 	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-	if customClaims.Roles != _const.MerchantRole {
-		utils.RespondError(c, http.StatusUnauthorized, "not merchant", errors.New("not merchant"))
-		return
-	}
-	if customClaims.UserID == 0 {
-		utils.RespondError(c, http.StatusUnauthorized, "not merchant", errors.New("not merchant"))
 		return
 	}
 
@@ -316,9 +317,9 @@ func (h *ProductHandler) Update(c *gin.Context) {
 		BookingTime:   req.BookingTime,
 	}
 
-	err := h.ProductService.Update(c, product, customClaims.UserID)
+	err := h.ProductService.Update(c, product, customClaims.Actor())
 	if err != nil {
-		utils.RespondError(c, http.StatusBadRequest, "更新商品失败", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "更新商品失败", err)
 		return
 	}
 	utils.RespondJSON(c, http.StatusOK, "商品更新成功")
@@ -326,39 +327,85 @@ func (h *ProductHandler) Update(c *gin.Context) {
 }
 
 // SearchProductRequest 搜索商品请求体
-// @Description 搜索商品请求体
+// @Description 搜索商品请求体, 筛选条件为零值时不限
 type SearchProductRequest struct {
-	Msg    string `json:"msg"`
-	Offset int    `json:"offset"`
+	// @Description 搜索词, 为空时只按筛选条件查询
+	Msg string `json:"msg"`
+	// @Description 商家ID
+	MerchantID int64 `json:"merchantId"`
+	// @Description 分类ID, 包含其全部子分类
+	CateIDs []int64 `json:"cateIds"`
+	// @Description 品牌
+	Brands []string `json:"brands"`
+	// @Description 最低价格
+	MinPrice float64 `json:"minPrice"`
+	// @Description 最高价格
+	MaxPrice float64 `json:"maxPrice"`
+	// @Description 只看新品
+	IsNew bool `json:"isNew"`
+	// @Description 只看精品
+	IsBest bool `json:"isBest"`
+	// @Description 只看热销
+	IsHot bool `json:"isHot"`
+	// @Description 只看有货
+	InStock bool `json:"inStock"`
+	// @Description 排序方式: 空为相关度, price_asc, price_desc, sales, newest, rating
+	Sort string `json:"sort"`
+	// @Description 偏移量
+	Offset int `json:"offset"`
+	// @Description 每页数量, 默认 20, 最大 100
+	Limit int `json:"limit"`
 }
 
 // SearchProduct 搜索商品
 // @Summary SearchProduct 搜索商品
-// @Description 搜索商品
+// @Description 按搜索词、筛选条件和排序方式搜索上架中的商品, 同时返回品牌、分类和价格区间的分面统计
 // @Accept json
 // @Produce json
 // @Tags 商品
 // @Param product body SearchProductRequest true "product"
 // @Param Authorization header string true "Bearer token"
-// @Success 200 {object} []domain.Product "product updated successfully"
+// @Success 200 {object} domain.ProductSearchPage "搜索结果"
+// @Failure 400 {object} string "请求参数错误"
 // @Failure 401 {object} string "没有权限"
 // @Failure 500 {object} string "服务器错误"
 // @Router /api/v1/products/search [post]
 func (h *ProductHandler) SearchProduct(c *gin.Context) {
 	var req = &SearchProductRequest{}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(req); err != nil {
 		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
 		return
 	}
 
-	var products []domain.Product
-	products, err := h.ProductService.Search(c, req.Msg)
+	page, err := h.ProductService.Search(c.Request.Context(), &search.Query{
+		Text: req.Msg,
+		Filter: search.Filter{
+			MerchantID: req.MerchantID,
+			CateIDs:    req.CateIDs,
+			Brands:     req.Brands,
+			MinPrice:   req.MinPrice,
+			MaxPrice:   req.MaxPrice,
+			IsNew:      req.IsNew,
+			IsBest:     req.IsBest,
+			IsHot:      req.IsHot,
+			InStock:    req.InStock,
+		},
+		Sort:   req.Sort,
+		Offset: req.Offset,
+		Limit:  req.Limit,
+	})
 	if err != nil {
-		utils.RespondError(c, http.StatusBadRequest, "搜索商品失败", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "搜索商品失败", err)
 		return
 	}
 
-	//fmt.Println(products)
-	utils.RespondJSON(c, http.StatusOK, products)
-	return
+	// 只在第一页记录搜索词, 翻页不重复计数; 只记录用户的最近搜索
+	if h.suggest != nil && req.Offset == 0 {
+		var userID int64
+		if claims, err := utils.GetClaims(c); err == nil && claims.Roles == _const.UserRole {
+			userID = claims.UserID
+		}
+		h.suggest.Record(c.Request.Context(), userID, req.Msg, page.Total)
+	}
+	utils.RespondJSON(c, http.StatusOK, page)
 }
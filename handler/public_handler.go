@@ -10,7 +10,8 @@ import (
 )
 
 type PublicHandler struct {
-	service service.PublicService
+	service    service.PublicService
+	smsService service.SmsService
 }
 
 type HealthCheckResponse struct {
@@ -26,8 +27,12 @@ type MailResponse struct {
 	Code string `json:"code"`
 }
 
-func NewPublicHandler(service *service.PublicServiceImp) *PublicHandler {
-	return &PublicHandler{service: service}
+type SmsRequest struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+func NewPublicHandler(service *service.PublicServiceImp, smsService service.SmsService) *PublicHandler {
+	return &PublicHandler{service: service, smsService: smsService}
 }
 
 // HealthCheck
@@ -80,3 +85,32 @@ func (h *PublicHandler) SendVerifyCodeByEmail(c *gin.Context) {
 	// 返回成功响应
 	utils.RespondJSON(c, http.StatusOK, MailResponse{Code: code})
 }
+
+// SendVerifyCodeBySms 发送短信验证码
+// @Summary 发送短信验证码
+// @Description 向手机号发送登录/注册验证码, 同一手机号 1 分钟内只能发送一次, 手机号和 IP 每天有发送上限
+// @Accept json
+// @Produce json
+// @Param request body SmsRequest true "Sms request"
+// @Success 200 {object} string
+// @Failure 400 {object} string
+// @Failure 429 {object} string
+// @Router /api/v1/sendVerifyCodeBySms [post]
+func (h *PublicHandler) SendVerifyCodeBySms(c *gin.Context) {
+	var req = SmsRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "无效的请求", err)
+		return
+	}
+	if !utils.VerifyPhone(req.Phone) {
+		utils.RespondError(c, http.StatusBadRequest, "无效的手机号", nil)
+		return
+	}
+
+	if err := h.smsService.SendCode(c.Request.Context(), req.Phone, utils.ClientIP(c)); err != nil {
+		applog.AppLogger.Warnf("send sms code failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "发送验证码失败", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "验证码已发送")
+}
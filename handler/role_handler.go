@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+)
+
+type RoleHandler struct {
+	service service.RBACService
+}
+
+func NewRoleHandler(service service.RBACService) *RoleHandler {
+	return &RoleHandler{service: service}
+}
+
+// RoleCreateRequest 创建角色请求参数
+// @Description: 创建角色请求参数
+type RoleCreateRequest struct {
+	// @Description: 角色名称
+	Name string `json:"name"`
+	// @Description: 角色编码, 全局唯一
+	Code string `json:"code"`
+	// @Description: 角色描述
+	Description string `json:"description"`
+}
+
+// RoleUpdateRequest 更新角色请求参数
+// @Description: 更新角色请求参数, 未传的字段保持不变
+type RoleUpdateRequest struct {
+	// @Description: 角色ID
+	ID int64 `json:"id"`
+	// @Description: 角色名称
+	Name *string `json:"name"`
+	// @Description: 角色描述
+	Description *string `json:"description"`
+	// @Description: 状态 (1-启用, 0-禁用)
+	Status *int `json:"status"`
+	// @Description: 排序
+	Sort *int `json:"sort"`
+}
+
+// RolePermissionRequest 设置角色权限请求参数
+// @Description: 设置角色权限请求参数
+type RolePermissionRequest struct {
+	// @Description: 权限ID, 覆盖角色当前的全部权限
+	PermissionIDs []int64 `json:"permission_ids"`
+}
+
+// RoleAssignRequest 分配或撤销角色请求参数
+// @Description: 分配或撤销角色请求参数
+type RoleAssignRequest struct {
+	// @Description: 身份类型 (40001-用户, 40002-商家, 40003-管理员)
+	UserType int64 `json:"user_type"`
+	// @Description: 用户ID
+	UserID int64 `json:"user_id"`
+	// @Description: 角色ID
+	RoleID int64 `json:"role_id"`
+}
+
+// ListRoles 获取角色列表
+// @Summary 获取角色列表
+// @Description 获取全部角色
+// @Tags 权限管理
+// @Produce json
+// @Success 200 {array} domain.Role
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/role/list [get]
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.service.ListRoles(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list role failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, roles)
+}
+
+// CreateRole 创建角色
+// @Summary 创建角色
+// @Description 创建自定义角色, 自定义角色可以被删除
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param role body RoleCreateRequest true "role"
+// @Success 201 {object} int64 "角色ID"
+// @Failure 400 {object} string "invalid request"
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/role/create [put]
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	var req = &RoleCreateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	id, err := h.service.CreateRole(c.Request.Context(), req.Name, req.Code, req.Description, customClaims.UserID)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "create role failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusCreated, id)
+}
+
+// UpdateRole 更新角色
+// @Summary 更新角色
+// @Description 更新角色名称、描述、排序和状态, 系统角色不能被禁用
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param role body RoleUpdateRequest true "role"
+// @Success 200 {object} string "success"
+// @Failure 400 {object} string "invalid request"
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/role/update [patch]
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	var req = &RoleUpdateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	err := h.service.UpdateRole(c.Request.Context(), &domain.RoleUpdate{
+		ID:          req.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Status:      req.Status,
+		Sort:        req.Sort,
+	}, customClaims.UserID)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "update role failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "success")
+}
+
+// DeleteRole 删除角色
+// @Summary 删除角色
+// @Description 删除自定义角色及其权限和用户关联, 系统角色不能被删除
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Success 200 {object} string "success"
+// @Failure 403 {object} string "系统角色不能删除"
+// @Failure 404 {object} string "角色不存在"
+// @Router /api/v1/admin/role/delete/{id} [delete]
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid role id", err)
+		return
+	}
+
+	if err = h.service.DeleteRole(c.Request.Context(), id); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "delete role failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "success")
+}
+
+// ListPermissions 获取权限列表
+// @Summary 获取权限列表
+// @Description 获取全部可分配的权限
+// @Tags 权限管理
+// @Produce json
+// @Success 200 {array} domain.Auth
+// @Failure 403 {object} string "permission denied"
+// @Router /api/v1/admin/permission/list [get]
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.service.ListPermissions(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "list permission failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, permissions)
+}
+
+// GetRolePermissions 获取角色权限
+// @Summary 获取角色权限
+// @Description 获取角色拥有的全部权限
+// @Tags 权限管理
+// @Produce json
+// @Param id path int true "角色ID"
+// @Success 200 {array} domain.Auth
+// @Failure 404 {object} string "角色不存在"
+// @Router /api/v1/admin/role/permissions/{id} [get]
+func (h *RoleHandler) GetRolePermissions(c *gin.Context) {
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid role id", err)
+		return
+	}
+
+	permissions, err := h.service.GetRolePermissions(c.Request.Context(), id)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get role permission failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, permissions)
+}
+
+// SetRolePermissions 设置角色权限
+// @Summary 设置角色权限
+// @Description 以请求中的权限覆盖角色当前的全部权限
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param id path int true "角色ID"
+// @Param permissions body RolePermissionRequest true "permissions"
+// @Success 200 {object} string "success"
+// @Failure 404 {object} string "角色不存在"
+// @Router /api/v1/admin/role/permissions/{id} [put]
+func (h *RoleHandler) SetRolePermissions(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	id, err := utils.ParsePathParamInt64(c, "id")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid role id", err)
+		return
+	}
+	var req = &RolePermissionRequest{}
+	if err = c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	if err = h.service.SetRolePermissions(c.Request.Context(), id, req.PermissionIDs, customClaims.UserID); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "set role permission failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "success")
+}
+
+// AssignRole 分配角色
+// @Summary 分配角色
+// @Description 为用户、商家或管理员额外分配角色
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param assign body RoleAssignRequest true "assign"
+// @Success 200 {object} string "success"
+// @Failure 400 {object} string "invalid request"
+// @Router /api/v1/admin/role/assign [put]
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	var req = &RoleAssignRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	if err := h.service.AssignRole(c.Request.Context(), req.UserType, req.UserID, req.RoleID, customClaims.UserID); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "assign role failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "success")
+}
+
+// RevokeRole 撤销角色
+// @Summary 撤销角色
+// @Description 撤销额外分配的角色, 身份类型对应的系统角色不受影响
+// @Tags 权限管理
+// @Accept json
+// @Produce json
+// @Param revoke body RoleAssignRequest true "revoke"
+// @Success 200 {object} string "success"
+// @Failure 400 {object} string "invalid request"
+// @Router /api/v1/admin/role/revoke [post]
+func (h *RoleHandler) RevokeRole(c *gin.Context) {
+	var req = &RoleAssignRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	if err := h.service.RevokeRole(c.Request.Context(), req.UserType, req.UserID, req.RoleID); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "revoke role failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "success")
+}
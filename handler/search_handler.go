@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+)
+
+type SearchHandler struct {
+	service service.SuggestService
+}
+
+func NewSearchHandler(service service.SuggestService) *SearchHandler {
+	return &SearchHandler{service: service}
+}
+
+// Suggest 搜索联想
+// @Summary 搜索联想
+// @Description 根据输入前缀返回商品标题、品牌和分类名称的联想词, 支持全拼和拼音首字母, 没有前缀匹配时容错少量拼写错误
+// @Tags 商品
+// @Produce json
+// @Param q query string true "输入的前缀"
+// @Param limit query int false "返回数量, 默认 10, 最大 20"
+// @Success 200 {array} domain.Suggestion
+// @Failure 400 {object} utils.ResponseError
+// @Router /api/v1/products/suggest [get]
+func (h *SearchHandler) Suggest(c *gin.Context) {
+	limit, err := parseQueryInt64(c, "limit")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid limit", err)
+		return
+	}
+	suggestions, err := h.service.Suggest(c.Request.Context(), c.Query("q"), int(limit))
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "suggest failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, suggestions)
+}
+
+// HotSearches 热门搜索
+// @Summary 热门搜索
+// @Description 最近一周搜索次数最多且有结果的搜索词
+// @Tags 商品
+// @Produce json
+// @Param limit query int false "返回数量, 默认 10, 最大 20"
+// @Success 200 {array} domain.SearchQueryStat
+// @Failure 500 {object} utils.ResponseError
+// @Router /api/v1/products/hotSearches [get]
+func (h *SearchHandler) HotSearches(c *gin.Context) {
+	limit, err := parseQueryInt64(c, "limit")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid limit", err)
+		return
+	}
+	stats, err := h.service.Hot(c.Request.Context(), int(limit))
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get hot searches failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, stats)
+}
+
+// SearchHistory 最近搜索
+// @Summary 最近搜索
+// @Description 当前用户最近的 20 条搜索词, 新的在前
+// @Tags 商品
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} string
+// @Failure 401 {object} utils.ResponseError
+// @Router /api/v1/products/searchHistory [get]
+func (h *SearchHandler) SearchHistory(c *gin.Context) {
+	claims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+	queries, err := h.service.Recent(c.Request.Context(), claims.UserID)
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get search history failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, queries)
+}
+
+// DeleteSearchHistory 删除最近搜索
+// @Summary 删除最近搜索
+// @Description 删除一条最近搜索, 不传 q 时清空全部
+// @Tags 商品
+// @Produce json
+// @Security ApiKeyAuth
+// @Param q query string false "要删除的搜索词"
+// @Success 200 {object} string
+// @Failure 401 {object} utils.ResponseError
+// @Router /api/v1/products/searchHistory [delete]
+func (h *SearchHandler) DeleteSearchHistory(c *gin.Context) {
+	claims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteRecent(c.Request.Context(), claims.UserID, c.Query("q")); err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "delete search history failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "ok")
+}
+
+// ZeroResults 无结果搜索词
+// @Summary 无结果搜索词
+// @Description 最近一段时间搜索次数最多的无结果搜索词, 供运营补充商品或关键词
+// @Tags 后台管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param days query int false "统计天数, 默认 7, 最大 30"
+// @Param limit query int false "返回数量, 默认 20, 最大 100"
+// @Success 200 {array} domain.SearchQueryStat
+// @Failure 400 {object} utils.ResponseError
+// @Router /api/v1/admin/search/zeroResults [get]
+func (h *SearchHandler) ZeroResults(c *gin.Context) {
+	days, err := parseQueryInt64(c, "days")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid days", err)
+		return
+	}
+	limit, err := parseQueryInt64(c, "limit")
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid limit", err)
+		return
+	}
+	stats, err := h.service.ZeroResults(c.Request.Context(), int(days), int(limit))
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get zero result searches failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, stats)
+}
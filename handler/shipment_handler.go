@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+	"strconv"
+)
+
+type ShipmentHandler struct {
+	service service.ShipmentService
+}
+
+func NewShipmentHandler(service service.ShipmentService) *ShipmentHandler {
+	return &ShipmentHandler{service: service}
+}
+
+// ShipmentCreateRequest 发货请求参数
+// @Description: 发货请求参数
+type ShipmentCreateRequest struct {
+	// @Description: 订单ID
+	OrderID int64 `json:"order_id"`
+	// @Description: 承运商编码
+	Carrier string `json:"carrier"`
+	// @Description: 运单号
+	TrackingNo string `json:"tracking_no"`
+	// @Description: 本次发货的订单项ID, 为空时发出全部订单项
+	ItemIDs []int64 `json:"item_ids"`
+}
+
+// CreateShipment 商家发货
+// @Summary 商家发货
+// @Description 商家录入承运商和运单号, 订单进入已发货状态
+// @Tags 物流
+// @Accept json
+// @Produce json
+// @Param shipment body ShipmentCreateRequest true "shipment"
+// @Success 201 {object} int64 "发货单ID"
+// @Failure 400 {object} string "invalid request"
+// @Failure 401 {object} string "invalid token claims"
+// @Router /api/v1/shipment/create [put]
+func (h *ShipmentHandler) CreateShipment(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c, _const.MerchantRole)
+	if !ok {
+		return
+	}
+
+	var req = &ShipmentCreateRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	id, err := h.service.Ship(c.Request.Context(), customClaims.Actor(), req.OrderID, req.Carrier, req.TrackingNo, req.ItemIDs)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "create shipment failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusCreated, id)
+}
+
+// GetTimeline 获取订单物流时间线
+// @Summary 获取订单物流时间线
+// @Description 获取订单下所有包裹的物流轨迹
+// @Tags 物流
+// @Produce json
+// @Param orderID path int true "订单ID"
+// @Success 200 {array} domain.ShipmentTimeline
+// @Failure 401 {object} string "invalid token claims"
+// @Failure 500 {object} string "服务器错误"
+// @Router /api/v1/shipment/timeline/{orderID} [get]
+func (h *ShipmentHandler) GetTimeline(c *gin.Context) {
+	// 订单归属在 service 中校验
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := strconv.ParseInt(c.Param("orderID"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid order id", err)
+		return
+	}
+
+	timelines, err := h.service.Timeline(c.Request.Context(), orderID, customClaims.Actor())
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get timeline failed", err)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, timelines)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+)
+
+type TOTPHandler struct {
+	service service.TOTPService
+}
+
+func NewTOTPHandler(service service.TOTPService) *TOTPHandler {
+	return &TOTPHandler{service: service}
+}
+
+// TOTPCodeRequest 提交两步验证码
+type TOTPCodeRequest struct {
+	// @Description 验证器显示的 6 位验证码, 关闭时也可以使用恢复码
+	// @Example "123456"
+	Code string `json:"code" binding:"required"`
+}
+
+// TOTPActivateResponse 开启两步验证成功后返回的恢复码
+type TOTPActivateResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// Enroll 生成两步验证密钥
+// @Summary 生成两步验证密钥
+// @Description 生成新的 TOTP 密钥并返回 otpauth URI, 前端渲染为二维码供验证器扫描. 需调用激活接口后才生效
+// @Tags 两步验证
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} domain.TOTPEnrollment
+// @Failure 409 {object} utils.ResponseError "已开启两步验证"
+// @Router /api/v1/user/totp/enroll [post]
+func (h *TOTPHandler) Enroll(c *gin.Context) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	// 两步验证按用户表ID保存, 用户和商家账号都可以开启和关闭, 管理员的ID与用户ID不在同一空间
+	if actor := claims.Actor(); !actor.IsUser() && !actor.IsMerchant() {
+		utils.RespondError(c, http.StatusForbidden, "not User or Merchant", domain.ErrForbidden)
+		return
+	}
+
+	enrollment, err := h.service.Enroll(c.Request.Context(), claims.UserID, claims.UserName)
+	if err != nil {
+		logger.AppLogger.Errorf("enroll totp failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "enroll totp failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, enrollment)
+}
+
+// Activate 激活两步验证
+// @Summary 激活两步验证
+// @Description 提交验证器显示的第一个验证码以开启两步验证, 返回的恢复码只展示一次, 每个恢复码只能使用一次
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body TOTPCodeRequest true "验证码"
+// @Success 200 {object} TOTPActivateResponse
+// @Failure 400 {object} utils.ResponseError
+// @Router /api/v1/user/totp/activate [post]
+func (h *TOTPHandler) Activate(c *gin.Context) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	if actor := claims.Actor(); !actor.IsUser() && !actor.IsMerchant() {
+		utils.RespondError(c, http.StatusForbidden, "not User or Merchant", domain.ErrForbidden)
+		return
+	}
+	var req = &TOTPCodeRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	codes, err := h.service.Activate(c.Request.Context(), claims.UserID, req.Code)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "activate totp failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, TOTPActivateResponse{RecoveryCodes: codes})
+}
+
+// Disable 关闭两步验证
+// @Summary 关闭两步验证
+// @Description 使用验证码或恢复码关闭两步验证
+// @Tags 两步验证
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body TOTPCodeRequest true "验证码或恢复码"
+// @Success 200 {string} string "totp disabled"
+// @Failure 400 {object} utils.ResponseError
+// @Router /api/v1/user/totp/disable [post]
+func (h *TOTPHandler) Disable(c *gin.Context) {
+	claims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+	if actor := claims.Actor(); !actor.IsUser() && !actor.IsMerchant() {
+		utils.RespondError(c, http.StatusForbidden, "not User or Merchant", domain.ErrForbidden)
+		return
+	}
+	var req = &TOTPCodeRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	if err := h.service.Disable(c.Request.Context(), claims.UserID, req.Code); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "disable totp failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "totp disabled")
+}
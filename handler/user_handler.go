@@ -12,6 +12,7 @@ import (
 	"github.com/star-find-cloud/star-mall/utils"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type UserHandler struct {
@@ -24,9 +25,45 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token  string `json:"token"`
-	Role   int64  `json:"role"`
-	UserID int64  `json:"userId"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	Role         int64  `json:"role"`
+	UserID       int64  `json:"userId"`
+}
+
+// MFAChallengeResponse 已开启两步验证的账号密码校验通过后返回, 需使用 MFAToken 和验证码完成登录
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
+// TOTPLoginRequest 两步验证登录请求
+type TOTPLoginRequest struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	// @Description 验证器显示的 6 位验证码或恢复码
+	Code string `json:"code" binding:"required"`
+}
+
+// SmsLoginRequest 短信验证码登录请求
+type SmsLoginRequest struct {
+	Phone string `json:"phone" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// SmsRegisterRequest 短信验证码注册请求, 不设置密码时只能通过验证码登录
+type SmsRegisterRequest struct {
+	Name     string `json:"name" binding:"required,min=2,max=32"`
+	Phone    string `json:"phone" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+	Password string `json:"password,omitempty" binding:"omitempty,min=8"`
+	Sex      int    `json:"sex,omitempty"`
+}
+
+// RefreshRequest 刷新 token 请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
 type UserRegisterRequest struct {
@@ -71,6 +108,10 @@ type UpdateEmailRequest struct {
 	// @Required true
 	// @Example "12AB56"
 	VerifyCode string `json:"verifyCode" binding:"required"`
+
+	// @Description 两步验证码或恢复码, 已开启两步验证时必填
+	// @Example "123456"
+	TOTPCode string `json:"totpCode"`
 }
 
 type UpdatePasswordRequest struct {
@@ -93,6 +134,10 @@ type UpdatePasswordRequest struct {
 	// @Required true
 	// @Example "12AB56"
 	VerifyCode string `json:"verifyCode" binding:"required"`
+
+	// @Description 两步验证码或恢复码, 已开启两步验证时必填
+	// @Example "123456"
+	TOTPCode string `json:"totpCode"`
 }
 
 type ForgetPasswordRequest struct {
@@ -110,14 +155,10 @@ type ForgetPasswordRequest struct {
 	// @Required true
 	// @Example "<PASSWORD>"
 	NewPassword string `json:"newPassword" binding:"required,min=6"`
-}
 
-type DeleteRequest struct {
-	// @Description 邮箱
-	Email string `json:"email" binding:"required,email"`
-
-	// @Description 验证码
-	VerifyCode string `json:"verifyCode" binding:"required"`
+	// @Description 两步验证码或恢复码, 已开启两步验证时必填
+	// @Example "123456"
+	TOTPCode string `json:"totpCode"`
 }
 
 func NewUserHandler(userService service.UserService) *UserHandler {
@@ -170,13 +211,15 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 
 // Login 用户登录接口
 // @Summary 用户登录
-// @Description 用户通过 email 或 userID 登录
+// @Description 用户通过 email 或 userID 登录. 已开启两步验证的账号返回 MFAChallengeResponse, 需继续调用 /api/v1/user/login/2fa
 // @Accept json
 // @Produce json
 // @Tags 用户
 // @Param request body LoginRequest true "Login request"
 // @Success 200 {object} LoginResponse
 // @Failure 400 {object} utils.ResponseError
+// @Failure 401 {object} utils.ResponseError
+// @Failure 429 {object} utils.ResponseError "失败次数过多, 响应头 Retry-After 给出需要等待的秒数"
 // @Router /api/v1/user/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
 	var req = &LoginRequest{}
@@ -192,32 +235,218 @@ func (h *UserHandler) Login(c *gin.Context) {
 	}
 
 	var (
-		token string
+		token *domain.TokenPair
 		role  int64
 		err   error
 		id    int64
 	)
 	if req.ID != "" {
 		id, _ = strconv.ParseInt(req.ID, 10, 64)
-		token, role, err = h.UserService.LoginByID(c.Request.Context(), id, req.Password)
+		token, role, err = h.UserService.LoginByID(c.Request.Context(), id, req.Password, utils.ClientIP(c))
 	} else {
-		token, role, err = h.UserService.LoginByEmail(c.Request.Context(), req.Email, req.Password)
+		token, role, err = h.UserService.LoginByEmail(c.Request.Context(), req.Email, req.Password, utils.ClientIP(c))
 	}
 	if err != nil {
 		logger.AppLogger.Errorf("login failed: %v", err)
-		utils.RespondError(c, http.StatusUnauthorized, "login failed", err)
+		setRetryAfter(c, err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusUnauthorized), "login failed", err.Error())
+		return
+	}
+	if token.MFARequired() {
+		respondMFAChallenge(c, token)
 		return
 	}
 
 	//fmt.Printf("token: %s, role: %d, id: %d", token, role, id)
 	utils.RespondJSON(c, http.StatusOK, LoginResponse{
-		token,
+		token.AccessToken,
+		token.RefreshToken,
+		token.ExpiresIn,
 		role,
 		id,
 	})
 	return
 }
 
+// setRetryAfter 登录因失败次数过多被拒绝时, 通过 Retry-After 告知客户端需要等待的秒数
+func setRetryAfter(c *gin.Context, err error) {
+	var blocked *domain.LoginBlockedError
+	if errors.As(err, &blocked) {
+		c.Header("Retry-After", strconv.FormatInt(int64((blocked.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+}
+
+// LoginBySms 短信验证码登录
+// @Summary 短信验证码登录
+// @Description 用户通过手机号和短信验证码登录, 验证码输错次数过多后作废
+// @Accept json
+// @Produce json
+// @Tags 用户
+// @Param request body SmsLoginRequest true "Sms login request"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} utils.ResponseError
+// @Failure 401 {object} utils.ResponseError
+// @Router /api/v1/user/login/sms [post]
+func (h *UserHandler) LoginBySms(c *gin.Context) {
+	var req = &SmsLoginRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	token, user, err := h.UserService.LoginByPhone(c.Request.Context(), req.Phone, req.Code)
+	if err != nil {
+		logger.AppLogger.Warnf("sms login failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusUnauthorized), "login failed", err.Error())
+		return
+	}
+	if token.MFARequired() {
+		respondMFAChallenge(c, token)
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, LoginResponse{
+		token.AccessToken,
+		token.RefreshToken,
+		token.ExpiresIn,
+		user.RoleID,
+		user.ID,
+	})
+}
+
+// LoginWithTOTP 两步验证登录
+// @Summary 两步验证登录
+// @Description 密码或短信登录返回 mfaRequired 后, 在 5 分钟内提交 mfaToken 和验证器验证码(或恢复码)换取正式 token. mfaToken 只能使用一次
+// @Accept json
+// @Produce json
+// @Tags 用户
+// @Param request body TOTPLoginRequest true "Two-factor login request"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} utils.ResponseError
+// @Failure 401 {object} utils.ResponseError
+// @Failure 429 {object} utils.ResponseError
+// @Router /api/v1/user/login/2fa [post]
+func (h *UserHandler) LoginWithTOTP(c *gin.Context) {
+	var req = &TOTPLoginRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	token, user, err := h.UserService.LoginWithTOTP(c.Request.Context(), req.MFAToken, req.Code, utils.ClientIP(c))
+	if err != nil {
+		logger.AppLogger.Warnf("totp login failed: %v", err)
+		setRetryAfter(c, err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusUnauthorized), "login failed", err.Error())
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusOK, LoginResponse{
+		token.AccessToken,
+		token.RefreshToken,
+		token.ExpiresIn,
+		user.RoleID,
+		user.ID,
+	})
+}
+
+func respondMFAChallenge(c *gin.Context, token *domain.TokenPair) {
+	utils.RespondJSON(c, http.StatusOK, MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token.MFAToken,
+		ExpiresIn:   token.ExpiresIn,
+	})
+}
+
+// RegisterBySms 短信验证码注册
+// @Summary 短信验证码注册
+// @Description 用户通过手机号和短信验证码注册
+// @Accept json
+// @Produce json
+// @Tags 用户
+// @Param request body SmsRegisterRequest true "Sms register request"
+// @Success 201 {object} LoginResponse
+// @Failure 400 {object} utils.ResponseError
+// @Router /api/v1/user/register/sms [put]
+func (h *UserHandler) RegisterBySms(c *gin.Context) {
+	var req = &SmsRegisterRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	token, id, err := h.UserService.RegisterByPhone(c.Request.Context(), &domain.User{
+		Name:     req.Name,
+		Password: req.Password,
+		Phone:    req.Phone,
+		Sex:      req.Sex,
+		RoleID:   _const.UserRole,
+	}, req.Code)
+	if err != nil {
+		logger.AppLogger.Warnf("sms register failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusBadRequest), "register failed", err.Error())
+		return
+	}
+
+	utils.RespondJSON(c, http.StatusCreated, LoginResponse{
+		token.AccessToken,
+		token.RefreshToken,
+		token.ExpiresIn,
+		_const.UserRole,
+		id,
+	})
+}
+
+// Refresh 刷新 token
+// @Summary 刷新 token
+// @Description 使用刷新 token 换取新的访问 token 和刷新 token, 旧的刷新 token 随即失效; 重复使用已失效的刷新 token 会注销整个会话
+// @Accept json
+// @Produce json
+// @Tags 用户
+// @Param request body RefreshRequest true "Refresh request"
+// @Success 200 {object} domain.TokenPair
+// @Failure 400 {object} utils.ResponseError
+// @Failure 401 {object} utils.ResponseError
+// @Router /api/v1/user/refresh [post]
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req = &RefreshRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
+		return
+	}
+
+	token, err := h.UserService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		logger.AppLogger.Warnf("refresh token failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "refresh token failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, token)
+}
+
+// Logout 退出登录
+// @Summary 退出登录
+// @Description 注销当前访问 token 及其所属会话的刷新 token
+// @Produce json
+// @Security ApiKeyAuth
+// @Tags 用户
+// @Success 200 {string} string "logout successfully"
+// @Failure 401 {object} utils.ResponseError
+// @Router /api/v1/user/logout [post]
+func (h *UserHandler) Logout(c *gin.Context) {
+	customClaims, ok := utils.MustClaims(c)
+	if !ok {
+		return
+	}
+
+	if err := h.UserService.Logout(c.Request.Context(), customClaims); err != nil {
+		logger.AppLogger.Errorf("logout failed: %v", err)
+		utils.RespondError(c, http.StatusInternalServerError, "logout failed", err)
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "logout successfully")
+}
+
 // Register 用户注册接口
 // @Summary 用户注册接口
 // @Description 用户注册
@@ -262,7 +491,9 @@ func (h *UserHandler) Register(c *gin.Context) {
 	}
 
 	utils.RespondJSON(c, http.StatusCreated, LoginResponse{
-		token,
+		token.AccessToken,
+		token.RefreshToken,
+		token.ExpiresIn,
 		_const.UserRole,
 		id,
 	})
@@ -353,21 +584,11 @@ func (h *UserHandler) UpdateEmail(c *gin.Context) {
 		return
 	}
 
-	get, err := h.UserService.CheckEmailVerificationCode(c.Request.Context(), req.Email, req.VerifyCode)
-	if err != nil {
-		logger.AppLogger.Errorf("Register failed: %v", err)
-		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
-		return
-	}
-	if !get {
-		utils.RespondError(c, http.StatusBadRequest, "invalid verification code", nil)
-		return
-	}
-
-	err = h.UserService.UpdateEmail(c.Request.Context(), req.Email, req.VerifyCode, userID)
+	// 验证码在 service 中校验, 校验通过后即失效
+	err := h.UserService.UpdateEmail(c.Request.Context(), req.Email, req.VerifyCode, userID, req.TOTPCode)
 	if err != nil {
 		logger.AppLogger.Errorf("update email failed: %v", err)
-		utils.RespondError(c, http.StatusInternalServerError, "update email failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "update email failed", err.Error())
 		return
 	}
 
@@ -423,10 +644,10 @@ func (h *UserHandler) UpdatePassword(c *gin.Context) {
 	}
 
 	// 调用 service 层更新用户信息
-	err = h.UserService.UpdatePassword(c.Request.Context(), userID, req.NewPassword, req.OldPassword)
+	err = h.UserService.UpdatePassword(c.Request.Context(), userID, req.NewPassword, req.OldPassword, req.TOTPCode)
 	if err != nil {
 		logger.AppLogger.Errorf("update password failed: %v", err)
-		utils.RespondError(c, http.StatusInternalServerError, "update password failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "update password failed", err.Error())
 		return
 	}
 
@@ -454,62 +675,12 @@ func (h *UserHandler) ForgetPassword(c *gin.Context) {
 		return
 	}
 
-	err := h.UserService.ForgetPassword(c, req.Email, req.VerifyCode, req.NewPassword)
+	err := h.UserService.ForgetPassword(c, req.Email, req.VerifyCode, req.NewPassword, req.TOTPCode)
 	if err != nil {
 		logger.AppLogger.Errorf("forget password failed: %v", err)
-		utils.RespondError(c, http.StatusInternalServerError, "forget password failed", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "forget password failed", err.Error())
 		return
 	}
 
 	utils.RespondJSON(c, http.StatusOK, "password updated successfully")
 }
-
-// Delete 用户删除账户
-// @Summary Delete user
-// @Description 删除当前登录用户的账户
-// @Accept json
-// @Produce json
-// @Tags 用户
-// @Param request body DeleteRequest true "Delete request"
-// @Security ApiKeyAuth
-// @Success 200 {string} string "user deleted successfully"
-// @Failure 401 {object} utils.ResponseError
-// @Failure 500 {object} utils.ResponseError
-// @Router /api/v1/user/delete [delete]
-func (h *UserHandler) Delete(c *gin.Context) {
-	// 从 JWT token 中获取用户 ID
-	claims, exists := c.Get("claims")
-	if !exists {
-		utils.RespondError(c, http.StatusUnauthorized, "unauthorized", errors.New("invalid token claims"))
-		return
-	}
-
-	// 将 claims 转换为 CustomClaims 类型
-	customClaims, ok := claims.(*appjwt.CustomClaims)
-	if !ok {
-		utils.RespondError(c, http.StatusUnauthorized, "invalid token claims", errors.New("invalid token claims"))
-		return
-	}
-
-	req := &DeleteRequest{}
-	get, err := h.UserService.CheckEmailVerificationCode(c.Request.Context(), req.Email, req.VerifyCode)
-	if err != nil {
-		logger.AppLogger.Errorf("Register failed: %v", err)
-		utils.RespondError(c, http.StatusBadRequest, "invalid request", err)
-		return
-	}
-	if !get {
-		utils.RespondError(c, http.StatusBadRequest, "invalid verification code", nil)
-		return
-	}
-
-	userID := customClaims.UserID
-	err = h.UserService.Delete(c.Request.Context(), userID)
-	if err != nil {
-		logger.AppLogger.Errorf("delete failed: %v", err)
-		utils.RespondError(c, http.StatusInternalServerError, "delete failed", err)
-		return
-	}
-	utils.RespondJSON(c, http.StatusOK, "user deleted successfully")
-	return
-}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/service"
+	"github.com/star-find-cloud/star-mall/utils"
+	"net/http"
+	"strconv"
+)
+
+type VipHandler struct {
+	service service.MembershipService
+}
+
+func NewVipHandler(service service.MembershipService) *VipHandler {
+	return &VipHandler{service: service}
+}
+
+type VipPurchaseRequest struct {
+	// @Description 是否签订代扣协议, 到期前自动续费
+	// @Example true
+	AutoRenew bool `json:"autoRenew"`
+}
+
+// Plans 获取会员套餐
+// @Summary 获取会员套餐
+// @Description 获取在售的会员套餐及对应等级权益, 金额单位为分. price 为 0 的套餐只能消费达标获得
+// @Tags 会员
+// @Produce json
+// @Success 200 {array} domain.VipPlan
+// @Failure 500 {object} utils.ResponseError
+// @Router /api/v1/vip/plans [get]
+func (h *VipHandler) Plans(c *gin.Context) {
+	plans, err := h.service.Plans(c.Request.Context())
+	if err != nil {
+		utils.RespondError(c, http.StatusInternalServerError, "get plans failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, plans)
+}
+
+// Membership 获取当前用户的会员
+// @Summary 获取当前用户的会员
+// @Tags 会员
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} domain.Membership
+// @Failure 401 {object} utils.ResponseError
+// @Failure 404 {object} utils.ResponseError "不是会员"
+// @Router /api/v1/vip/membership [get]
+func (h *VipHandler) Membership(c *gin.Context) {
+	claims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+	membership, err := h.service.Get(c.Request.Context(), claims.UserID)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "get membership failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, membership)
+}
+
+// Purchase 购买会员套餐
+// @Summary 购买会员套餐
+// @Description 购买会员套餐. 有效期内购买同等级套餐顺延到期时间, 购买更高等级从现在重新计算, 不能购买更低等级
+// @Tags 会员
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param planID path int true "套餐ID"
+// @Param request body VipPurchaseRequest false "purchase request"
+// @Success 200 {object} domain.Membership
+// @Failure 400 {object} utils.ResponseError "套餐不能购买"
+// @Failure 402 {object} utils.ResponseError "支付失败"
+// @Failure 404 {object} utils.ResponseError "套餐不存在"
+// @Failure 409 {object} utils.ResponseError "不能降级"
+// @Router /api/v1/vip/purchase/{planID} [post]
+func (h *VipHandler) Purchase(c *gin.Context) {
+	claims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+	planID, err := strconv.ParseInt(c.Param("planID"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid plan id", err.Error())
+		return
+	}
+	req := &VipPurchaseRequest{}
+	if c.Request.ContentLength > 0 {
+		if err = c.ShouldBindJSON(req); err != nil {
+			utils.RespondError(c, http.StatusBadRequest, "invalid request", err.Error())
+			return
+		}
+	}
+
+	membership, err := h.service.Purchase(c.Request.Context(), claims.UserID, planID, req.AutoRenew)
+	if err != nil {
+		logger.AppLogger.Warnf("purchase vip plan failed: %v", err)
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "purchase failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, membership)
+}
+
+// Earn 消费达标开通会员
+// @Summary 消费达标开通会员
+// @Description 统计周期内已完成订单的实付金额达到套餐要求后免费开通, 不自动续费
+// @Tags 会员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param planID path int true "套餐ID"
+// @Success 200 {object} domain.Membership
+// @Failure 400 {object} utils.ResponseError "套餐不能通过消费获得"
+// @Failure 403 {object} utils.ResponseError "消费金额未达标"
+// @Failure 404 {object} utils.ResponseError "套餐不存在"
+// @Router /api/v1/vip/earn/{planID} [post]
+func (h *VipHandler) Earn(c *gin.Context) {
+	claims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+	planID, err := strconv.ParseInt(c.Param("planID"), 10, 64)
+	if err != nil {
+		utils.RespondError(c, http.StatusBadRequest, "invalid plan id", err.Error())
+		return
+	}
+
+	membership, err := h.service.Earn(c.Request.Context(), claims.UserID, planID)
+	if err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "earn failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, membership)
+}
+
+// CancelAutoRenew 关闭自动续费
+// @Summary 关闭自动续费
+// @Description 关闭自动续费, 会员在本期结束后过期
+// @Tags 会员
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} string "auto renew cancelled"
+// @Failure 404 {object} utils.ResponseError "未开启自动续费"
+// @Router /api/v1/vip/autoRenew/cancel [post]
+func (h *VipHandler) CancelAutoRenew(c *gin.Context) {
+	claims, ok := utils.MustClaims(c, _const.UserRole)
+	if !ok {
+		return
+	}
+	if err := h.service.CancelAutoRenew(c.Request.Context(), claims.UserID); err != nil {
+		utils.RespondError(c, utils.ErrorStatus(err, http.StatusInternalServerError), "cancel auto renew failed", err.Error())
+		return
+	}
+	utils.RespondJSON(c, http.StatusOK, "auto renew cancelled")
+}
@@ -0,0 +1,41 @@
+package logistics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+// ErrUnknownCarrier 未注册的承运商
+var ErrUnknownCarrier = errors.New("unknown carrier")
+
+// Carrier 承运商适配器, 负责查询运单的物流轨迹
+type Carrier interface {
+	// Code 承运商编码, 如 sf、yto
+	Code() string
+	// Track 查询运单的全部物流轨迹, 运单尚无轨迹时返回空切片
+	Track(ctx context.Context, trackingNo string) ([]domain.ShipmentEvent, error)
+}
+
+// Registry 承运商注册表
+type Registry struct {
+	carriers map[string]Carrier
+}
+
+func NewRegistry(carriers ...Carrier) *Registry {
+	r := &Registry{carriers: make(map[string]Carrier, len(carriers))}
+	for _, c := range carriers {
+		r.carriers[c.Code()] = c
+	}
+	return r
+}
+
+// Get 根据编码获取承运商
+func (r *Registry) Get(code string) (Carrier, error) {
+	c, ok := r.carriers[code]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCarrier, code)
+	}
+	return c, nil
+}
@@ -0,0 +1,83 @@
+package logistics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+var trackingNoPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+var fixtureStatus = map[string]int{
+	"shipped":    _const.ShipmentStatusShipped,
+	"in_transit": _const.ShipmentStatusInTransit,
+	"delivered":  _const.ShipmentStatusDelivered,
+	"exception":  _const.ShipmentStatusException,
+}
+
+// fixtureEvent 轨迹文件中的单条记录
+type fixtureEvent struct {
+	Status      string `json:"status"`
+	Location    string `json:"location"`
+	Description string `json:"description"`
+	Time        int64  `json:"time"`
+}
+
+// FixtureCarrier 从本地文件读取物流轨迹的承运商适配器, 用于测试和联调.
+// 轨迹文件路径为 <dir>/<code>/<trackingNo>.json, 内容为 fixtureEvent 数组
+type FixtureCarrier struct {
+	code string
+	dir  string
+}
+
+func NewFixtureCarrier(code, dir string) *FixtureCarrier {
+	return &FixtureCarrier{code: code, dir: dir}
+}
+
+func (c *FixtureCarrier) Code() string {
+	return c.code
+}
+
+func (c *FixtureCarrier) Track(ctx context.Context, trackingNo string) ([]domain.ShipmentEvent, error) {
+	if !trackingNoPattern.MatchString(trackingNo) {
+		return nil, fmt.Errorf("invalid tracking number: %q", trackingNo)
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, c.code, trackingNo+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []domain.ShipmentEvent{}, nil
+		}
+		return nil, fmt.Errorf("read fixture failed: %w", err)
+	}
+
+	var raw []fixtureEvent
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse fixture failed: %w", err)
+	}
+
+	events := make([]domain.ShipmentEvent, 0, len(raw))
+	for _, e := range raw {
+		status, ok := fixtureStatus[e.Status]
+		if !ok {
+			return nil, fmt.Errorf("unknown fixture status: %q", e.Status)
+		}
+		events = append(events, domain.ShipmentEvent{
+			Status:      status,
+			Location:    e.Location,
+			Description: e.Description,
+			EventTime:   e.Time,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].EventTime < events[j].EventTime
+	})
+	return events, nil
+}
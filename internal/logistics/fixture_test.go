@@ -0,0 +1,57 @@
+package logistics
+
+import (
+	"context"
+	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixtureCarrier_Track(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sf"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fixture := `[
+		{"status": "delivered", "location": "上海", "description": "已签收", "time": 300},
+		{"status": "shipped", "location": "杭州", "description": "已揽收", "time": 100},
+		{"status": "in_transit", "location": "嘉兴", "description": "运输中", "time": 200}
+	]`
+	if err := os.WriteFile(filepath.Join(dir, "sf", "SF123.json"), []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry(NewFixtureCarrier("sf", dir))
+	carrier, err := registry.Get("sf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := carrier.Track(context.Background(), "SF123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("len(events) = %d, want 3", len(events))
+	}
+	if events[0].Status != _const.ShipmentStatusShipped || events[2].Status != _const.ShipmentStatusDelivered {
+		t.Errorf("events not sorted by time: %+v", events)
+	}
+
+	// 尚无轨迹的运单返回空切片
+	events, err = carrier.Track(context.Background(), "SF404")
+	if err != nil || len(events) != 0 {
+		t.Errorf("Track(SF404) = %v, %v; want empty", events, err)
+	}
+
+	// 非法运单号不能逃逸出轨迹目录
+	if _, err = carrier.Track(context.Background(), "../../etc/passwd"); err == nil {
+		t.Error("Track should reject path traversal")
+	}
+
+	if _, err = registry.Get("yto"); !errors.Is(err, ErrUnknownCarrier) {
+		t.Errorf("Get(yto) err = %v, want ErrUnknownCarrier", err)
+	}
+}
@@ -1 +1,570 @@
 package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// esMappingVersion 索引映射版本, 修改 mapping 后需要加一并重建索引
+const esMappingVersion = 2
+
+// 中文分词器, 写入时细粒度切分, 搜索时粗粒度切分
+var esAnalyzers = map[string][2]string{
+	"ik":       {"ik_max_word", "ik_smart"},
+	"smartcn":  {"smartcn", "smartcn"},
+	"standard": {"standard", "standard"},
+}
+
+// Elasticsearch 通过 HTTP API 访问 Elasticsearch 或 OpenSearch 的搜索索引.
+// 读写都通过别名进行, 重建时写入新版本的索引后原子切换别名
+type Elasticsearch struct {
+	host     string
+	username string
+	password string
+	apiKey   string
+	alias    string
+	analyzer [2]string
+	client   *http.Client
+
+	mu    sync.Mutex
+	ready bool // 别名已存在
+}
+
+// ESError Elasticsearch 返回的错误
+type ESError struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e *ESError) Error() string {
+	return fmt.Sprintf("elasticsearch %d %s: %s", e.Status, e.Type, e.Reason)
+}
+
+func NewElasticsearch(c conf.ElasticsearchConf, client *http.Client) (*Elasticsearch, error) {
+	if c.Host == "" {
+		return nil, errors.New("search: elasticsearch host is required")
+	}
+	if c.Alias == "" {
+		c.Alias = "products"
+	}
+	if c.Analyzer == "" {
+		c.Analyzer = "ik"
+	}
+	analyzer, ok := esAnalyzers[c.Analyzer]
+	if !ok {
+		return nil, fmt.Errorf("search: unsupported elasticsearch analyzer %q", c.Analyzer)
+	}
+	return &Elasticsearch{
+		host:     strings.TrimRight(c.Host, "/"),
+		username: c.Username,
+		password: c.Password,
+		apiKey:   c.APIKey,
+		alias:    c.Alias,
+		analyzer: analyzer,
+		client:   client,
+	}, nil
+}
+
+// mapping 当前版本的索引设置和映射
+func (e *Elasticsearch) mapping() map[string]any {
+	text := map[string]any{"type": "text", "analyzer": e.analyzer[0], "search_analyzer": e.analyzer[1]}
+	long := map[string]any{"type": "long"}
+	boolean := map[string]any{"type": "boolean"}
+	return map[string]any{
+		"mappings": map[string]any{
+			"_meta":   map[string]any{"version": esMappingVersion},
+			"dynamic": "strict",
+			"properties": map[string]any{
+				"id":          long,
+				"merchant_id": long,
+				"title":       text,
+				"sub_title":   text,
+				"keywords":    text,
+				"desc":        text,
+				// 品牌既用于精确筛选也参与搜索
+				"brand": map[string]any{
+					"type":   "keyword",
+					"fields": map[string]any{"text": text},
+				},
+				"cate_id":        long,
+				"price":          map[string]any{"type": "scaled_float", "scaling_factor": 100},
+				"purchase_count": long,
+				"rating":         map[string]any{"type": "scaled_float", "scaling_factor": 100},
+				"in_stock":       boolean,
+				"is_hot":         boolean,
+				"is_best":        boolean,
+				"is_new":         boolean,
+				"created_at":     long,
+				"updated_at":     long,
+			},
+		},
+	}
+}
+
+// versionedName 生成新的索引名, 包含映射版本和创建时间
+func (e *Elasticsearch) versionedName() string {
+	return fmt.Sprintf("%s_v%d_%d", e.alias, esMappingVersion, time.Now().UnixNano())
+}
+
+func (e *Elasticsearch) Index(ctx context.Context, docs ...*Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	if err := e.ensure(ctx); err != nil {
+		return err
+	}
+	return e.bulkIndex(ctx, e.alias, docs)
+}
+
+func (e *Elasticsearch) Delete(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := e.ensure(ctx); err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, id := range ids {
+		_ = enc.Encode(map[string]any{"delete": map[string]string{"_index": e.alias, "_id": strconv.FormatInt(id, 10)}})
+	}
+	return e.bulk(ctx, &body)
+}
+
+// Versions 通过 _mget 实时读取文档, 只取回 updated_at
+func (e *Elasticsearch) Versions(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	versions := make(map[int64]int64, len(ids))
+	if len(ids) == 0 {
+		return versions, nil
+	}
+	if err := e.ensure(ctx); err != nil {
+		return nil, err
+	}
+	docIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		docIDs = append(docIDs, strconv.FormatInt(id, 10))
+	}
+	var resp struct {
+		Docs []struct {
+			ID     string `json:"_id"`
+			Found  bool   `json:"found"`
+			Source struct {
+				UpdatedAt int64 `json:"updated_at"`
+			} `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := e.do(ctx, http.MethodPost, "/"+e.alias+"/_mget?_source_includes=updated_at", map[string]any{"ids": docIDs}, &resp); err != nil {
+		return nil, err
+	}
+	for _, d := range resp.Docs {
+		id, err := strconv.ParseInt(d.ID, 10, 64)
+		if err != nil || !d.Found {
+			continue
+		}
+		versions[id] = d.Source.UpdatedAt
+	}
+	return versions, nil
+}
+
+// Reindex 写入新版本的索引后切换别名并删除旧索引, 重建期间搜索和写入仍使用旧索引
+func (e *Elasticsearch) Reindex(ctx context.Context, load Loader) (int, error) {
+	name := e.versionedName()
+	body := e.mapping()
+	// 批量写入期间关闭刷新, 完成后恢复
+	body["settings"] = map[string]any{"index": map[string]any{"refresh_interval": "-1"}}
+	if err := e.do(ctx, http.MethodPut, "/"+name, body, nil); err != nil {
+		return 0, err
+	}
+
+	n, err := reindex(ctx, load, func(ctx context.Context, docs []*Document) error {
+		return e.bulkIndex(ctx, name, docs)
+	})
+	if err == nil {
+		err = e.do(ctx, http.MethodPut, "/"+name+"/_settings", map[string]any{"index": map[string]any{"refresh_interval": nil}}, nil)
+	}
+	if err == nil {
+		err = e.do(ctx, http.MethodPost, "/"+name+"/_refresh", nil, nil)
+	}
+	if err != nil {
+		if derr := e.do(context.Background(), http.MethodDelete, "/"+name, nil, nil); derr != nil {
+			applog.AppLogger.Warnf("删除未完成的索引 %s 失败: %v", name, derr)
+		}
+		return 0, err
+	}
+
+	old, err := e.aliasIndices(ctx)
+	if err != nil {
+		return 0, err
+	}
+	actions := make([]map[string]any, 0, len(old)+1)
+	for _, index := range old {
+		actions = append(actions, map[string]any{"remove": map[string]string{"index": index, "alias": e.alias}})
+	}
+	actions = append(actions, map[string]any{"add": map[string]string{"index": name, "alias": e.alias}})
+	if err = e.do(ctx, http.MethodPost, "/_aliases", map[string]any{"actions": actions}, nil); err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	e.ready = true
+	e.mu.Unlock()
+	if len(old) > 0 {
+		if err = e.do(ctx, http.MethodDelete, "/"+strings.Join(old, ","), nil, nil); err != nil {
+			applog.AppLogger.Warnf("删除旧索引 %v 失败: %v", old, err)
+		}
+	}
+	return n, nil
+}
+
+func (e *Elasticsearch) Search(ctx context.Context, q *Query) (*Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if err := e.ensure(ctx); err != nil {
+		return nil, err
+	}
+
+	size := q.Limit
+	if size <= 0 {
+		size = 20
+	}
+	body := map[string]any{
+		"query":            esQuery(q),
+		"sort":             esSort(q.Sort, q.Text),
+		"from":             q.Offset,
+		"size":             size,
+		"_source":          false,
+		"track_total_hits": true,
+		"aggs":             esAggs(),
+	}
+	var resp struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations struct {
+			Brands struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int64  `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"brands"`
+			Categories struct {
+				Buckets []struct {
+					Key      int64 `json:"key"`
+					DocCount int64 `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"categories"`
+			Prices struct {
+				Buckets []struct {
+					DocCount int64 `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"prices"`
+		} `json:"aggregations"`
+	}
+	if err := e.do(ctx, http.MethodPost, "/"+e.alias+"/_search", body, &resp); err != nil {
+		return nil, err
+	}
+
+	aggs := &resp.Aggregations
+	facets := &domain.ProductFacets{}
+	for _, b := range aggs.Brands.Buckets {
+		facets.Brands = append(facets.Brands, domain.BrandFacet{Brand: b.Key, Count: b.DocCount})
+	}
+	for _, b := range aggs.Categories.Buckets {
+		facets.Categories = append(facets.Categories, domain.CategoryFacet{CateID: b.Key, Count: b.DocCount})
+	}
+	// range 聚合按请求中的区间顺序返回
+	for i, b := range aggs.Prices.Buckets {
+		if i >= len(PriceRanges) {
+			break
+		}
+		lo, hi := priceRange(i)
+		facets.Prices = append(facets.Prices, domain.PriceFacet{Min: lo, Max: hi, Count: b.DocCount})
+	}
+
+	result := &Result{Total: resp.Hits.Total.Value, IDs: make([]int64, 0, len(resp.Hits.Hits)), Facets: sortFacets(facets)}
+	for _, h := range resp.Hits.Hits {
+		id, err := strconv.ParseInt(h.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document id %q: %w", h.ID, err)
+		}
+		result.IDs = append(result.IDs, id)
+	}
+	return result, nil
+}
+
+// esQuery 搜索词用于相关度计算, 筛选条件不影响得分
+func esQuery(q *Query) map[string]any {
+	var must any = map[string]any{"match_all": map[string]any{}}
+	if q.Text != "" {
+		must = map[string]any{"multi_match": map[string]any{
+			"query":    q.Text,
+			"fields":   []string{"title^8", "keywords^4", "brand.text^4", "sub_title^2", "desc"},
+			"operator": "and",
+		}}
+	}
+
+	f := &q.Filter
+	filters := make([]any, 0)
+	if f.MerchantID != 0 {
+		filters = append(filters, map[string]any{"term": map[string]any{"merchant_id": f.MerchantID}})
+	}
+	if len(f.CateIDs) > 0 {
+		filters = append(filters, map[string]any{"terms": map[string]any{"cate_id": f.CateIDs}})
+	}
+	if len(f.Brands) > 0 {
+		filters = append(filters, map[string]any{"terms": map[string]any{"brand": f.Brands}})
+	}
+	if f.MinPrice > 0 || f.MaxPrice > 0 {
+		price := map[string]any{}
+		if f.MinPrice > 0 {
+			price["gte"] = f.MinPrice
+		}
+		if f.MaxPrice > 0 {
+			price["lte"] = f.MaxPrice
+		}
+		filters = append(filters, map[string]any{"range": map[string]any{"price": price}})
+	}
+	if f.IsNew {
+		filters = append(filters, map[string]any{"term": map[string]any{"is_new": true}})
+	}
+	if f.IsBest {
+		filters = append(filters, map[string]any{"term": map[string]any{"is_best": true}})
+	}
+	if f.IsHot {
+		filters = append(filters, map[string]any{"term": map[string]any{"is_hot": true}})
+	}
+	if f.InStock {
+		filters = append(filters, map[string]any{"term": map[string]any{"in_stock": true}})
+	}
+	return map[string]any{"bool": map[string]any{"must": must, "filter": filters}}
+}
+
+// esSort 将排序方式转换为 sort 参数, 最后按 ID 排序保证分页稳定
+func esSort(sort, text string) []any {
+	var fields []any
+	switch sort {
+	case SortPriceAsc:
+		fields = []any{map[string]string{"price": "asc"}}
+	case SortPriceDesc:
+		fields = []any{map[string]string{"price": "desc"}}
+	case SortSales:
+		fields = []any{map[string]string{"purchase_count": "desc"}}
+	case SortNewest:
+		fields = []any{map[string]string{"created_at": "desc"}}
+	case SortRating:
+		fields = []any{map[string]string{"rating": "desc"}}
+	default:
+		if text != "" {
+			fields = []any{"_score"}
+		}
+		fields = append(fields, map[string]string{"purchase_count": "desc"})
+	}
+	return append(fields, map[string]string{"id": "asc"})
+}
+
+// esAggs 品牌、分类和价格区间的聚合
+func esAggs() map[string]any {
+	ranges := make([]map[string]float64, 0, len(PriceRanges))
+	for i := range PriceRanges {
+		lo, hi := priceRange(i)
+		r := map[string]float64{"from": lo}
+		if hi > 0 {
+			r["to"] = hi
+		}
+		ranges = append(ranges, r)
+	}
+	return map[string]any{
+		"brands":     map[string]any{"terms": map[string]any{"field": "brand", "size": FacetSize}},
+		"categories": map[string]any{"terms": map[string]any{"field": "cate_id", "size": FacetSize}},
+		"prices":     map[string]any{"range": map[string]any{"field": "price", "ranges": ranges}},
+	}
+}
+
+// ensure 首次使用时检查别名, 不存在时创建当前版本的索引并绑定别名
+func (e *Elasticsearch) ensure(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ready {
+		return nil
+	}
+	indices, err := e.aliasIndices(ctx)
+	if err != nil {
+		return err
+	}
+	if len(indices) == 0 {
+		body := e.mapping()
+		body["aliases"] = map[string]any{e.alias: map[string]any{}}
+		if err = e.do(ctx, http.MethodPut, "/"+e.versionedName(), body, nil); err != nil {
+			return err
+		}
+	} else if err = e.checkVersion(ctx); err != nil {
+		return err
+	}
+	e.ready = true
+	return nil
+}
+
+// checkVersion 别名指向的索引映射版本与当前版本不一致时提示重建
+func (e *Elasticsearch) checkVersion(ctx context.Context) error {
+	var resp map[string]struct {
+		Mappings struct {
+			Meta struct {
+				Version int `json:"version"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	if err := e.do(ctx, http.MethodGet, "/"+e.alias+"/_mapping", nil, &resp); err != nil {
+		return err
+	}
+	for index, m := range resp {
+		if m.Mappings.Meta.Version != esMappingVersion {
+			applog.AppLogger.Warnf("搜索索引 %s 的映射版本为 %d, 当前版本为 %d, 请执行 reindex 重建索引", index, m.Mappings.Meta.Version, esMappingVersion)
+		}
+	}
+	return nil
+}
+
+// aliasIndices 获取别名指向的索引, 别名不存在时返回空
+func (e *Elasticsearch) aliasIndices(ctx context.Context) ([]string, error) {
+	var resp map[string]json.RawMessage
+	err := e.do(ctx, http.MethodGet, "/_alias/"+e.alias, nil, &resp)
+	var ee *ESError
+	if errors.As(err, &ee) && ee.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]string, 0, len(resp))
+	for index := range resp {
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+func (e *Elasticsearch) bulkIndex(ctx context.Context, index string, docs []*Document) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, d := range docs {
+		_ = enc.Encode(map[string]any{"index": map[string]string{"_index": index, "_id": strconv.FormatInt(d.ID, 10)}})
+		if err := enc.Encode(d); err != nil {
+			return fmt.Errorf("failed to encode document %d: %w", d.ID, err)
+		}
+	}
+	return e.bulk(ctx, &body)
+}
+
+// bulk 调用 _bulk 接口, 任一操作失败时返回第一个错误, 删除不存在的文档不算失败
+func (e *Elasticsearch) bulk(ctx context.Context, body *bytes.Buffer) error {
+	var resp struct {
+		Errors bool                `json:"errors"`
+		Items  []map[string]esItem `json:"items"`
+	}
+	if err := e.doRaw(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body, &resp); err != nil {
+		return err
+	}
+	if !resp.Errors {
+		return nil
+	}
+	for _, item := range resp.Items {
+		for action, result := range item {
+			if result.Error == nil || (action == "delete" && result.Status == http.StatusNotFound) {
+				continue
+			}
+			return &ESError{Status: result.Status, Type: result.Error.Type, Reason: fmt.Sprintf("%s %s: %s", action, result.ID, result.Error.Reason)}
+		}
+	}
+	return nil
+}
+
+// esItem _bulk 响应中的单个操作结果
+type esItem struct {
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (e *Elasticsearch) do(ctx context.Context, method, path string, body, dst any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode elasticsearch request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	return e.doRaw(ctx, method, path, "application/json", reader, dst)
+}
+
+// doRaw 发送请求并解析 JSON 响应, 非 2xx 时返回 *ESError
+func (e *Elasticsearch) doRaw(ctx context.Context, method, path, contentType string, body io.Reader, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, method, e.host+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to build elasticsearch request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case e.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	case e.username != "":
+		req.SetBasicAuth(e.username, e.password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("elasticsearch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read elasticsearch response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		ee := &ESError{Status: resp.StatusCode}
+		// error 可能是对象, 也可能是字符串(如别名不存在)
+		var errResp struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(data, &errResp) == nil && len(errResp.Error) > 0 {
+			var detail struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			}
+			if json.Unmarshal(errResp.Error, &detail) == nil {
+				ee.Type, ee.Reason = detail.Type, detail.Reason
+			} else {
+				_ = json.Unmarshal(errResp.Error, &ee.Reason)
+			}
+		}
+		return ee
+	}
+	if dst != nil {
+		if err = json.Unmarshal(data, dst); err != nil {
+			return fmt.Errorf("failed to decode elasticsearch response: %w", err)
+		}
+	}
+	return nil
+}
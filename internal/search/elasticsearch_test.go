@@ -0,0 +1,291 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeES 模拟 Elasticsearch 的 HTTP API, 记录索引、别名、文档数和收到的请求
+type fakeES struct {
+	mu       sync.Mutex
+	requests []string
+	indices  map[string]map[string]any // 索引名 -> 创建时的请求体
+	aliases  map[string]string         // 索引名 -> 别名
+	docs     map[string]int
+	search   map[string]any
+}
+
+func newFakeES() *fakeES {
+	return &fakeES{indices: map[string]map[string]any{}, aliases: map[string]string{}, docs: map[string]int{}}
+}
+
+// resolve 将别名解析为索引名
+func (f *fakeES) resolve(name string) string {
+	for index, alias := range f.aliases {
+		if alias == name {
+			return index
+		}
+	}
+	return name
+}
+
+func (f *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"type":"security_exception","reason":"missing authentication"},"status":401}`))
+		return
+	}
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "_alias":
+		resp := map[string]any{}
+		for index, alias := range f.aliases {
+			if alias == parts[1] {
+				resp[index] = map[string]any{"aliases": map[string]any{alias: map[string]any{}}}
+			}
+		}
+		if len(resp) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"alias [` + parts[1] + `] missing","status":404}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case r.Method == http.MethodPut && len(parts) == 1:
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.indices[parts[0]] = body
+		if aliases, ok := body["aliases"].(map[string]any); ok {
+			for alias := range aliases {
+				f.aliases[parts[0]] = alias
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodDelete && len(parts) == 1:
+		for _, index := range strings.Split(parts[0], ",") {
+			delete(f.indices, index)
+			delete(f.aliases, index)
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "_mapping":
+		index := f.resolve(parts[0])
+		_ = json.NewEncoder(w).Encode(map[string]any{index: f.indices[index]})
+	case r.URL.Path == "/_aliases":
+		var body struct {
+			Actions []map[string]map[string]string `json:"actions"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for _, action := range body.Actions {
+			if a, ok := action["remove"]; ok {
+				delete(f.aliases, a["index"])
+			}
+			if a, ok := action["add"]; ok {
+				f.aliases[a["index"]] = a["alias"]
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.URL.Path == "/_bulk":
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		var items []map[string]any
+		var hasErrors bool
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]map[string]any
+			_ = json.Unmarshal(scanner.Bytes(), &line)
+			if meta, ok := line["index"]; ok {
+				scanner.Scan()
+				f.docs[f.resolve(meta["_index"].(string))]++
+				items = append(items, map[string]any{"index": map[string]any{"_id": meta["_id"], "status": 201}})
+			}
+			if meta, ok := line["delete"]; ok {
+				// ID 为 404 的文档不存在
+				item := map[string]any{"_id": meta["_id"], "status": 200}
+				if meta["_id"] == "404" {
+					item["status"], item["error"], hasErrors = 404, map[string]string{"type": "not_found", "reason": "missing"}, true
+				}
+				items = append(items, map[string]any{"delete": item})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"errors": hasErrors, "items": items})
+	case len(parts) == 2 && (parts[1] == "_settings" || parts[1] == "_refresh"):
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case len(parts) == 2 && parts[1] == "_mget":
+		if r.URL.Query().Get("_source_includes") != "updated_at" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"docs":[{"_id":"1","found":true,"_source":{"updated_at":100}},{"_id":"2","found":false}]}`))
+	case len(parts) == 2 && parts[1] == "_search":
+		_ = json.NewDecoder(r.Body).Decode(&f.search)
+		_, _ = w.Write([]byte(`{"hits":{"total":{"value":12,"relation":"eq"},"hits":[{"_id":"3"},{"_id":"1"}]},` +
+			`"aggregations":{"brands":{"buckets":[{"key":"飞跃","doc_count":3},{"key":"星辰","doc_count":9}]},` +
+			`"categories":{"buckets":[{"key":3,"doc_count":12}]},` +
+			`"prices":{"buckets":[{"key":"0.0-50.0","from":0,"to":50,"doc_count":2},{"key":"50.0-100.0","from":50,"to":100,"doc_count":0},{"key":"100.0-200.0","from":100,"to":200,"doc_count":10}]}}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestES(t *testing.T) (*Elasticsearch, *fakeES) {
+	fake := newFakeES()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	e, err := NewElasticsearch(conf.ElasticsearchConf{Host: server.URL + "/", Username: "elastic", Password: "secret"}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, fake
+}
+
+func TestElasticsearch_Search(t *testing.T) {
+	e, fake := newTestES(t)
+	got, err := e.Search(context.Background(), &Query{
+		Text:   "蓝牙耳机",
+		Filter: Filter{MerchantID: 10, CateIDs: []int64{3, 4}, MinPrice: 9.9, IsNew: true, InStock: true},
+		Sort:   SortPriceAsc,
+		Offset: 20,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search err = %v", err)
+	}
+	if !slices.Equal(got.IDs, []int64{3, 1}) || got.Total != 12 {
+		t.Errorf("result = %+v", got)
+	}
+	wantFacets := &domain.ProductFacets{
+		Brands:     []domain.BrandFacet{{Brand: "星辰", Count: 9}, {Brand: "飞跃", Count: 3}},
+		Categories: []domain.CategoryFacet{{CateID: 3, Count: 12}},
+		Prices:     []domain.PriceFacet{{Min: 0, Max: 50, Count: 2}, {Min: 100, Max: 200, Count: 10}},
+	}
+	if !reflect.DeepEqual(got.Facets, wantFacets) {
+		t.Errorf("facets = %+v, want %+v", got.Facets, wantFacets)
+	}
+
+	// 首次使用时创建带别名的版本化索引, 中文字段使用 IK 分词
+	if len(fake.indices) != 1 {
+		t.Fatalf("indices = %v, want 1", fake.indices)
+	}
+	for index, body := range fake.indices {
+		if !strings.HasPrefix(index, "products_v2_") || fake.aliases[index] != "products" {
+			t.Errorf("index %s alias %q, want products_v2_* aliased to products", index, fake.aliases[index])
+		}
+		title := body["mappings"].(map[string]any)["properties"].(map[string]any)["title"].(map[string]any)
+		if title["analyzer"] != "ik_max_word" || title["search_analyzer"] != "ik_smart" {
+			t.Errorf("title mapping = %v", title)
+		}
+	}
+
+	data, _ := json.Marshal(fake.search)
+	for _, want := range []string{
+		`"multi_match":{"fields":["title^8","keywords^4","brand.text^4","sub_title^2","desc"],"operator":"and","query":"蓝牙耳机"}`,
+		`{"term":{"merchant_id":10}}`,
+		`{"terms":{"cate_id":[3,4]}}`,
+		`{"range":{"price":{"gte":9.9}}}`,
+		`{"term":{"is_new":true}}`,
+		`{"term":{"in_stock":true}}`,
+		`"prices":{"range":{"field":"price","ranges":[{"from":0,"to":50},{"from":50,"to":100}`,
+		`{"from":5000}]}}`,
+		`"sort":[{"price":"asc"},{"id":"asc"}]`,
+		`"from":20`,
+		`"size":10`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("search request %s missing %s", data, want)
+		}
+	}
+}
+
+func TestElasticsearch_Reindex(t *testing.T) {
+	e, fake := newTestES(t)
+	ctx := context.Background()
+
+	if err := e.Index(ctx, testDocs...); err != nil {
+		t.Fatalf("Index err = %v", err)
+	}
+	// 删除不存在的文档不算失败
+	if err := e.Delete(ctx, 1, 404); err != nil {
+		t.Fatalf("Delete err = %v", err)
+	}
+	var old string
+	for index := range fake.aliases {
+		old = index
+	}
+	if fake.docs[old] != len(testDocs) {
+		t.Fatalf("docs = %v, want %d in %s", fake.docs, len(testDocs), old)
+	}
+
+	docs := make([]*Document, 0, ReindexBatchSize+1)
+	for i := 1; i <= ReindexBatchSize+1; i++ {
+		docs = append(docs, &Document{ID: int64(i), Title: "商品"})
+	}
+	n, err := e.Reindex(ctx, loadDocs(docs))
+	if err != nil || n != len(docs) {
+		t.Fatalf("Reindex = %d, %v", n, err)
+	}
+
+	// 别名切换到新索引, 旧索引被删除
+	if len(fake.aliases) != 1 || len(fake.indices) != 1 {
+		t.Fatalf("aliases = %v, indices = %d, want only the new index", fake.aliases, len(fake.indices))
+	}
+	for index := range fake.aliases {
+		if index == old || fake.docs[index] != len(docs) {
+			t.Errorf("alias points to %s with %d docs, want new index with %d", index, fake.docs[index], len(docs))
+		}
+	}
+	var bulks int
+	for _, r := range fake.requests {
+		if r == "POST /_bulk" {
+			bulks++
+		}
+	}
+	// 写入 1 次, 删除 1 次, 重建 2 批
+	if bulks != 4 {
+		t.Errorf("bulk requests = %d, want 4", bulks)
+	}
+}
+
+func TestElasticsearch_Versions(t *testing.T) {
+	e, fake := newTestES(t)
+	got, err := e.Versions(context.Background(), []int64{1, 2})
+	if err != nil {
+		t.Fatalf("Versions err = %v", err)
+	}
+	if len(got) != 1 || got[1] != 100 {
+		t.Errorf("versions = %v, want map[1:100]", got)
+	}
+	if !slices.Contains(fake.requests, "POST /products/_mget") {
+		t.Errorf("requests = %v, want _mget on the alias", fake.requests)
+	}
+}
+
+func TestElasticsearch_Error(t *testing.T) {
+	fake := newFakeES()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	e, _ := NewElasticsearch(conf.ElasticsearchConf{Host: server.URL}, server.Client())
+
+	_, err := e.Search(context.Background(), &Query{Text: "a"})
+	if ee, ok := err.(*ESError); !ok || ee.Status != http.StatusUnauthorized || ee.Type != "security_exception" {
+		t.Errorf("Search err = %v, want security_exception", err)
+	}
+
+	if _, err = NewElasticsearch(conf.ElasticsearchConf{Host: server.URL, Analyzer: "jieba"}, nil); err == nil {
+		t.Error("NewElasticsearch accepted an unsupported analyzer")
+	}
+}
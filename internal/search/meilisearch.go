@@ -1,9 +1,451 @@
 package search
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// meiliTaskPollInterval 等待异步任务完成时的轮询间隔
+const meiliTaskPollInterval = 50 * time.Millisecond
+
+// meiliSettings 索引设置: 可搜索字段按重要程度排列, 以及可筛选和排序的字段
+var meiliSettings = map[string]any{
+	"searchableAttributes": []string{"title", "keywords", "brand", "sub_title", "desc"},
+	"filterableAttributes": []string{"id", "merchant_id", "cate_id", "brand", "price", "is_new", "is_best", "is_hot", "in_stock"},
+	"sortableAttributes":   []string{"price", "purchase_count", "created_at", "rating"},
+}
+
+// Meilisearch 通过 HTTP API 访问 Meilisearch 的搜索索引
 type Meilisearch struct {
+	host   string
+	apiKey string
+	index  string
+	client *http.Client
+
+	mu    sync.Mutex
+	ready bool // 索引已创建并完成设置
+}
+
+// meiliTask 异步任务
+type meiliTask struct {
+	TaskUID int64       `json:"taskUid"`
+	Status  string      `json:"status"`
+	Error   *MeiliError `json:"error"`
+}
+
+func NewMeilisearch(c conf.MeilisearchConf, client *http.Client) (*Meilisearch, error) {
+	if c.Host == "" {
+		return nil, errors.New("search: meilisearch host is required")
+	}
+	if c.Index == "" {
+		c.Index = "products"
+	}
+	return &Meilisearch{
+		host:   strings.TrimRight(c.Host, "/"),
+		apiKey: c.APIKey,
+		index:  c.Index,
+		client: client,
+	}, nil
+}
+
+// Index 写入文档并等待任务完成, 写入失败时返回错误以便调用方重试
+func (m *Meilisearch) Index(ctx context.Context, docs ...*Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	if err := m.ensure(ctx); err != nil {
+		return err
+	}
+	task, err := m.addDocuments(ctx, m.index, docs)
+	if err != nil {
+		return err
+	}
+	return m.waitTask(ctx, task.TaskUID)
+}
+
+// Delete 删除文档并等待任务完成
+func (m *Meilisearch) Delete(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := m.ensure(ctx); err != nil {
+		return err
+	}
+	var task meiliTask
+	if err := m.do(ctx, http.MethodPost, "/indexes/"+m.index+"/documents/delete-batch", ids, &task); err != nil {
+		return err
+	}
+	return m.waitTask(ctx, task.TaskUID)
 }
 
-func init() {
-	// TODO init meilisearch
-	panic("implement me")
+// Versions 通过 documents/fetch 按 ID 筛选文档, 只取回 updated_at
+func (m *Meilisearch) Versions(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	versions := make(map[int64]int64, len(ids))
+	if len(ids) == 0 {
+		return versions, nil
+	}
+	if err := m.ensure(ctx); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Results []struct {
+			ID        int64 `json:"id"`
+			UpdatedAt int64 `json:"updated_at"`
+		} `json:"results"`
+	}
+	body := map[string]any{
+		"filter": "id IN " + meiliInts(ids),
+		"fields": []string{"id", "updated_at"},
+		"limit":  len(ids),
+	}
+	if err := m.do(ctx, http.MethodPost, "/indexes/"+m.index+"/documents/fetch", body, &resp); err != nil {
+		return nil, err
+	}
+	for _, d := range resp.Results {
+		versions[d.ID] = d.UpdatedAt
+	}
+	return versions, nil
+}
+
+// Reindex 写入临时索引后与正式索引交换, 重建期间搜索仍使用旧索引
+func (m *Meilisearch) Reindex(ctx context.Context, load Loader) (int, error) {
+	if err := m.ensure(ctx); err != nil {
+		return 0, err
+	}
+	tmp := m.index + "_reindex"
+	if err := m.deleteIndex(ctx, tmp); err != nil {
+		return 0, err
+	}
+	if err := m.createIndex(ctx, tmp); err != nil {
+		return 0, err
+	}
+
+	var tasks []int64
+	n, err := reindex(ctx, load, func(ctx context.Context, docs []*Document) error {
+		task, err := m.addDocuments(ctx, tmp, docs)
+		if err == nil {
+			tasks = append(tasks, task.TaskUID)
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, uid := range tasks {
+		if err = m.waitTask(ctx, uid); err != nil {
+			return 0, err
+		}
+	}
+
+	var task meiliTask
+	swap := []map[string][]string{{"indexes": {m.index, tmp}}}
+	if err = m.do(ctx, http.MethodPost, "/swap-indexes", swap, &task); err != nil {
+		return 0, err
+	}
+	if err = m.waitTask(ctx, task.TaskUID); err != nil {
+		return 0, err
+	}
+	// 交换后临时索引中是旧数据
+	return n, m.deleteIndex(ctx, tmp)
+}
+
+// Search 通过 multi-search 一次请求完成搜索和分面统计, 每个价格区间各使用一个只统计数量的查询
+func (m *Meilisearch) Search(ctx context.Context, q *Query) (*Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if err := m.ensure(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := meiliFilter(&q.Filter)
+	req := map[string]any{
+		"indexUid":             m.index,
+		"q":                    q.Text,
+		"offset":               q.Offset,
+		"attributesToRetrieve": []string{"id"},
+		"facets":               []string{"brand", "cate_id"},
+	}
+	if q.Limit > 0 {
+		req["limit"] = q.Limit
+	}
+	if filter != "" {
+		req["filter"] = filter
+	}
+	if sort := meiliSort(q.Sort, q.Text); len(sort) > 0 {
+		req["sort"] = sort
+	}
+	queries := []map[string]any{req}
+	for i := range PriceRanges {
+		lo, hi := priceRange(i)
+		parts := []string{"price >= " + strconv.FormatFloat(lo, 'f', -1, 64)}
+		if hi > 0 {
+			parts = append(parts, "price < "+strconv.FormatFloat(hi, 'f', -1, 64))
+		}
+		if filter != "" {
+			parts = append([]string{filter}, parts...)
+		}
+		queries = append(queries, map[string]any{
+			"indexUid": m.index,
+			"q":        q.Text,
+			"limit":    0,
+			"filter":   strings.Join(parts, " AND "),
+		})
+	}
+
+	var resp struct {
+		Results []struct {
+			Hits []struct {
+				ID int64 `json:"id"`
+			} `json:"hits"`
+			EstimatedTotalHits int64                       `json:"estimatedTotalHits"`
+			FacetDistribution  map[string]map[string]int64 `json:"facetDistribution"`
+		} `json:"results"`
+	}
+	if err := m.do(ctx, http.MethodPost, "/multi-search", map[string]any{"queries": queries}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Results) != len(queries) {
+		return nil, fmt.Errorf("meilisearch returned %d results for %d queries", len(resp.Results), len(queries))
+	}
+
+	hits := resp.Results[0]
+	facets := &domain.ProductFacets{}
+	for brand, n := range hits.FacetDistribution["brand"] {
+		facets.Brands = append(facets.Brands, domain.BrandFacet{Brand: brand, Count: n})
+	}
+	for value, n := range hits.FacetDistribution["cate_id"] {
+		cateID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		facets.Categories = append(facets.Categories, domain.CategoryFacet{CateID: cateID, Count: n})
+	}
+	for i, r := range resp.Results[1:] {
+		lo, hi := priceRange(i)
+		facets.Prices = append(facets.Prices, domain.PriceFacet{Min: lo, Max: hi, Count: r.EstimatedTotalHits})
+	}
+
+	result := &Result{Total: hits.EstimatedTotalHits, IDs: make([]int64, 0, len(hits.Hits)), Facets: sortFacets(facets)}
+	for _, h := range hits.Hits {
+		result.IDs = append(result.IDs, h.ID)
+	}
+	return result, nil
+}
+
+// meiliFilter 将筛选条件转换为 Meilisearch 的 filter 表达式
+func meiliFilter(f *Filter) string {
+	var parts []string
+	if f.MerchantID != 0 {
+		parts = append(parts, "merchant_id = "+strconv.FormatInt(f.MerchantID, 10))
+	}
+	if len(f.CateIDs) > 0 {
+		parts = append(parts, "cate_id IN "+meiliInts(f.CateIDs))
+	}
+	if len(f.Brands) > 0 {
+		brands := make([]string, 0, len(f.Brands))
+		for _, b := range f.Brands {
+			brands = append(brands, meiliQuote(b))
+		}
+		parts = append(parts, "brand IN ["+strings.Join(brands, ", ")+"]")
+	}
+	if f.MinPrice > 0 {
+		parts = append(parts, "price >= "+strconv.FormatFloat(f.MinPrice, 'f', -1, 64))
+	}
+	if f.MaxPrice > 0 {
+		parts = append(parts, "price <= "+strconv.FormatFloat(f.MaxPrice, 'f', -1, 64))
+	}
+	if f.IsNew {
+		parts = append(parts, "is_new = true")
+	}
+	if f.IsBest {
+		parts = append(parts, "is_best = true")
+	}
+	if f.IsHot {
+		parts = append(parts, "is_hot = true")
+	}
+	if f.InStock {
+		parts = append(parts, "in_stock = true")
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// meiliInts 将 ID 列表转换为 filter 表达式中的数组
+func meiliInts(ids []int64) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// meiliQuote 转义字符串中的引号和反斜杠
+func meiliQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// meiliSort 将排序方式转换为 Meilisearch 的 sort 参数, 按相关度排序时不需要 sort
+func meiliSort(sort, text string) []string {
+	switch sort {
+	case SortPriceAsc:
+		return []string{"price:asc"}
+	case SortPriceDesc:
+		return []string{"price:desc"}
+	case SortSales:
+		return []string{"purchase_count:desc"}
+	case SortNewest:
+		return []string{"created_at:desc"}
+	case SortRating:
+		return []string{"rating:desc"}
+	}
+	if text == "" {
+		return []string{"purchase_count:desc"}
+	}
+	return nil
+}
+
+// ensure 首次使用时创建正式索引并写入设置
+func (m *Meilisearch) ensure(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ready {
+		return nil
+	}
+	if err := m.createIndex(ctx, m.index); err != nil {
+		return err
+	}
+	m.ready = true
+	return nil
+}
+
+// createIndex 创建索引并写入设置, 索引已存在时只更新设置
+func (m *Meilisearch) createIndex(ctx context.Context, uid string) error {
+	var task meiliTask
+	if err := m.do(ctx, http.MethodPost, "/indexes", map[string]string{"uid": uid, "primaryKey": "id"}, &task); err != nil {
+		return err
+	}
+	if err := m.waitTask(ctx, task.TaskUID); err != nil && !isMeiliCode(err, "index_already_exists") {
+		return err
+	}
+	if err := m.do(ctx, http.MethodPatch, "/indexes/"+uid+"/settings", meiliSettings, &task); err != nil {
+		return err
+	}
+	return m.waitTask(ctx, task.TaskUID)
+}
+
+// deleteIndex 删除索引, 索引不存在时忽略
+func (m *Meilisearch) deleteIndex(ctx context.Context, uid string) error {
+	var task meiliTask
+	err := m.do(ctx, http.MethodDelete, "/indexes/"+uid, nil, &task)
+	if err == nil {
+		err = m.waitTask(ctx, task.TaskUID)
+	}
+	if isMeiliCode(err, "index_not_found") {
+		return nil
+	}
+	return err
+}
+
+func (m *Meilisearch) addDocuments(ctx context.Context, uid string, docs []*Document) (*meiliTask, error) {
+	var task meiliTask
+	if err := m.do(ctx, http.MethodPost, "/indexes/"+uid+"/documents?primaryKey=id", docs, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// waitTask 等待异步任务完成, 任务失败时返回 Meilisearch 的错误
+func (m *Meilisearch) waitTask(ctx context.Context, uid int64) error {
+	ticker := time.NewTicker(meiliTaskPollInterval)
+	defer ticker.Stop()
+	for {
+		var task meiliTask
+		if err := m.do(ctx, http.MethodGet, "/tasks/"+strconv.FormatInt(uid, 10), nil, &task); err != nil {
+			return err
+		}
+		switch task.Status {
+		case "succeeded":
+			return nil
+		case "failed", "canceled":
+			if task.Error != nil {
+				return task.Error
+			}
+			return fmt.Errorf("meilisearch task %d %s", uid, task.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// MeiliError Meilisearch 返回的错误
+type MeiliError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *MeiliError) Error() string {
+	return fmt.Sprintf("meilisearch %s: %s", e.Code, e.Message)
+}
+
+func isMeiliCode(err error, code string) bool {
+	var me *MeiliError
+	return errors.As(err, &me) && me.Code == code
+}
+
+// do 发送 JSON 请求并解析响应, 非 2xx 时返回 *MeiliError
+func (m *Meilisearch) do(ctx context.Context, method, path string, body, dst any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode meilisearch request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.host+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build meilisearch request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("meilisearch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read meilisearch response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		me := &MeiliError{Status: resp.StatusCode}
+		_ = json.Unmarshal(data, me)
+		return me
+	}
+	if dst != nil {
+		if err = json.Unmarshal(data, dst); err != nil {
+			return fmt.Errorf("failed to decode meilisearch response: %w", err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,234 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMeili 模拟 Meilisearch 的 HTTP API, 记录收到的请求, 所有任务立即完成
+type fakeMeili struct {
+	mu       sync.Mutex
+	requests []string
+	indexes  map[string]bool
+	tasks    map[int64]*meiliTask
+	search   []map[string]any
+	docs     map[string]int
+}
+
+func newFakeMeili() *fakeMeili {
+	return &fakeMeili{indexes: map[string]bool{}, tasks: map[int64]*meiliTask{}, docs: map[string]int{}}
+}
+
+// task 创建任务, code 不为空时任务失败
+func (f *fakeMeili) task(w http.ResponseWriter, code string) {
+	uid := int64(len(f.tasks) + 1)
+	t := &meiliTask{TaskUID: uid, Status: "succeeded"}
+	if code != "" {
+		t.Status, t.Error = "failed", &MeiliError{Code: code, Message: code}
+	}
+	f.tasks[uid] = t
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]int64{"taskUid": uid})
+}
+
+func (f *fakeMeili) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":"invalid_api_key","message":"invalid"}`))
+		return
+	}
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "tasks":
+		var uid int64
+		fmt.Sscan(parts[1], &uid)
+		_ = json.NewEncoder(w).Encode(f.tasks[uid])
+	case r.Method == http.MethodPost && r.URL.Path == "/indexes":
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if f.indexes[body["uid"]] {
+			f.task(w, "index_already_exists")
+			return
+		}
+		f.indexes[body["uid"]] = true
+		f.task(w, "")
+	case r.Method == http.MethodDelete && parts[0] == "indexes":
+		if !f.indexes[parts[1]] {
+			f.task(w, "index_not_found")
+			return
+		}
+		delete(f.indexes, parts[1])
+		f.task(w, "")
+	case r.Method == http.MethodPost && r.URL.Path == "/swap-indexes":
+		var body []map[string][]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		a, b := body[0]["indexes"][0], body[0]["indexes"][1]
+		f.docs[a], f.docs[b] = f.docs[b], f.docs[a]
+		f.task(w, "")
+	case len(parts) == 3 && parts[2] == "settings":
+		f.task(w, "")
+	case len(parts) == 3 && parts[2] == "documents":
+		var docs []*Document
+		_ = json.NewDecoder(r.Body).Decode(&docs)
+		f.docs[parts[1]] += len(docs)
+		f.task(w, "")
+	case len(parts) == 4 && parts[3] == "delete-batch":
+		f.task(w, "")
+	case len(parts) == 4 && parts[3] == "fetch":
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.search = []map[string]any{body}
+		_, _ = w.Write([]byte(`{"results":[{"id":1,"updated_at":100}],"offset":0,"limit":2,"total":1}`))
+	case r.URL.Path == "/multi-search":
+		var body struct {
+			Queries []map[string]any `json:"queries"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.search = body.Queries
+		results := []string{`{"hits":[{"id":3},{"id":1}],"estimatedTotalHits":12,"facetDistribution":{"brand":{"星辰":9,"飞跃":3},"cate_id":{"3":12}}}`}
+		for i := range body.Queries[1:] {
+			results = append(results, fmt.Sprintf(`{"hits":[],"estimatedTotalHits":%d}`, i%2*6))
+		}
+		_, _ = w.Write([]byte(`{"results":[` + strings.Join(results, ",") + `]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestMeili(t *testing.T) (*Meilisearch, *fakeMeili) {
+	fake := newFakeMeili()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	m, err := NewMeilisearch(conf.MeilisearchConf{Host: server.URL + "/", APIKey: "key"}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, fake
+}
+
+func TestMeilisearch_Search(t *testing.T) {
+	m, fake := newTestMeili(t)
+	got, err := m.Search(context.Background(), &Query{
+		Text:   "蓝牙",
+		Filter: Filter{MerchantID: 10, CateIDs: []int64{3, 4}, Brands: []string{`星"辰`}, MinPrice: 9.9, IsNew: true},
+		Sort:   SortPriceAsc,
+		Offset: 20,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("Search err = %v", err)
+	}
+	if !slices.Equal(got.IDs, []int64{3, 1}) || got.Total != 12 {
+		t.Errorf("result = %+v", got)
+	}
+
+	wantFilter := `merchant_id = 10 AND cate_id IN [3, 4] AND brand IN ["星\"辰"] AND price >= 9.9 AND is_new = true`
+	req := fake.search[0]
+	if req["filter"] != wantFilter {
+		t.Errorf("filter = %v, want %s", req["filter"], wantFilter)
+	}
+	if sort, _ := req["sort"].([]any); len(sort) != 1 || sort[0] != "price:asc" {
+		t.Errorf("sort = %v, want [price:asc]", req["sort"])
+	}
+	if req["q"] != "蓝牙" || req["offset"] != float64(20) || req["limit"] != float64(10) {
+		t.Errorf("search request = %v", req)
+	}
+
+	// 每个价格区间一个只统计数量的查询, 在原筛选条件上加价格范围
+	if len(fake.search) != len(PriceRanges)+1 {
+		t.Fatalf("queries = %d, want %d", len(fake.search), len(PriceRanges)+1)
+	}
+	if want := wantFilter + " AND price >= 50 AND price < 100"; fake.search[2]["filter"] != want || fake.search[2]["limit"] != float64(0) {
+		t.Errorf("price query = %v, want filter %s", fake.search[2], want)
+	}
+	if want := wantFilter + " AND price >= 5000"; fake.search[len(PriceRanges)]["filter"] != want {
+		t.Errorf("last price query filter = %v, want %s", fake.search[len(PriceRanges)]["filter"], want)
+	}
+	wantBrands := []domain.BrandFacet{{Brand: "星辰", Count: 9}, {Brand: "飞跃", Count: 3}}
+	if !slices.Equal(got.Facets.Brands, wantBrands) || len(got.Facets.Categories) != 1 || got.Facets.Categories[0].CateID != 3 {
+		t.Errorf("facets = %+v", got.Facets)
+	}
+	if len(got.Facets.Prices) != len(PriceRanges)/2 || got.Facets.Prices[0] != (domain.PriceFacet{Min: 50, Max: 100, Count: 6}) {
+		t.Errorf("price facets = %+v", got.Facets.Prices)
+	}
+
+	// 首次使用时创建索引并写入设置, 之后不再重复
+	_, _ = m.Search(context.Background(), &Query{})
+	var creates int
+	for _, r := range fake.requests {
+		if r == "POST /indexes" {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("index created %d times, want 1", creates)
+	}
+}
+
+func TestMeilisearch_Reindex(t *testing.T) {
+	m, fake := newTestMeili(t)
+	ctx := context.Background()
+
+	// 正式索引已存在时不会报错
+	fake.indexes["products"] = true
+	if err := m.Index(ctx, testDocs[0]); err != nil {
+		t.Fatalf("Index err = %v", err)
+	}
+
+	docs := make([]*Document, 0, ReindexBatchSize+1)
+	for i := 1; i <= ReindexBatchSize+1; i++ {
+		docs = append(docs, &Document{ID: int64(i), Title: "商品"})
+	}
+	n, err := m.Reindex(ctx, loadDocs(docs))
+	if err != nil || n != len(docs) {
+		t.Fatalf("Reindex = %d, %v", n, err)
+	}
+	if fake.docs["products"] != len(docs) {
+		t.Errorf("products index has %d docs after swap, want %d", fake.docs["products"], len(docs))
+	}
+	if fake.indexes["products_reindex"] {
+		t.Error("temporary index was not deleted")
+	}
+	if !slices.Contains(fake.requests, "POST /swap-indexes") {
+		t.Errorf("requests = %v, want a swap", fake.requests)
+	}
+}
+
+func TestMeilisearch_Versions(t *testing.T) {
+	m, fake := newTestMeili(t)
+	got, err := m.Versions(context.Background(), []int64{1, 2})
+	if err != nil {
+		t.Fatalf("Versions err = %v", err)
+	}
+	if len(got) != 1 || got[1] != 100 {
+		t.Errorf("versions = %v, want map[1:100]", got)
+	}
+	if req := fake.search[0]; req["filter"] != "id IN [1, 2]" || req["limit"] != float64(2) {
+		t.Errorf("fetch request = %v", req)
+	}
+}
+
+func TestMeilisearch_Error(t *testing.T) {
+	fake := newFakeMeili()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	m, _ := NewMeilisearch(conf.MeilisearchConf{Host: server.URL, APIKey: "wrong"}, server.Client())
+
+	_, err := m.Search(context.Background(), &Query{Text: "a"})
+	if !isMeiliCode(err, "invalid_api_key") {
+		t.Errorf("Search err = %v, want invalid_api_key", err)
+	}
+}
@@ -0,0 +1,209 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// 各字段命中搜索词时的得分, 标题最重要
+var fieldWeights = []struct {
+	weight int
+	value  func(d *Document) string
+}{
+	{8, func(d *Document) string { return d.Title }},
+	{4, func(d *Document) string { return d.Keywords }},
+	{4, func(d *Document) string { return d.Brand }},
+	{2, func(d *Document) string { return d.SubTitle }},
+	{1, func(d *Document) string { return d.Desc }},
+}
+
+// MemoryIndex 进程内的搜索索引, 用于测试和没有搜索服务的部署. 数据不持久化, 启动后需要重建
+type MemoryIndex struct {
+	mu   sync.RWMutex
+	docs map[int64]*Document
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{docs: make(map[int64]*Document)}
+}
+
+func (m *MemoryIndex) Index(ctx context.Context, docs ...*Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range docs {
+		copied := *d
+		m.docs[d.ID] = &copied
+	}
+	return nil
+}
+
+func (m *MemoryIndex) Delete(ctx context.Context, ids ...int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.docs, id)
+	}
+	return nil
+}
+
+func (m *MemoryIndex) Versions(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := make(map[int64]int64, len(ids))
+	for _, id := range ids {
+		if d, ok := m.docs[id]; ok {
+			versions[id] = d.UpdatedAt
+		}
+	}
+	return versions, nil
+}
+
+func (m *MemoryIndex) Reindex(ctx context.Context, load Loader) (int, error) {
+	docs := make(map[int64]*Document)
+	n, err := reindex(ctx, load, func(ctx context.Context, batch []*Document) error {
+		for _, d := range batch {
+			copied := *d
+			docs[d.ID] = &copied
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	m.docs = docs
+	m.mu.Unlock()
+	return n, nil
+}
+
+// hit 命中的文档及相关度得分
+type hit struct {
+	doc   *Document
+	score int
+}
+
+func (m *MemoryIndex) Search(ctx context.Context, q *Query) (*Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	terms := strings.Fields(strings.ToLower(q.Text))
+
+	m.mu.RLock()
+	hits := make([]hit, 0)
+	for _, d := range m.docs {
+		if !matchFilter(d, &q.Filter) {
+			continue
+		}
+		if score, ok := relevance(d, terms); ok {
+			hits = append(hits, hit{doc: d, score: score})
+		}
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(hits, func(a, b hit) int {
+		if c := compareHits(a, b, q.Sort); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.doc.ID, b.doc.ID)
+	})
+
+	result := &Result{Total: int64(len(hits)), IDs: make([]int64, 0), Facets: countFacets(hits)}
+	start := min(q.Offset, len(hits))
+	end := len(hits)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, len(hits))
+	}
+	for _, h := range hits[start:end] {
+		result.IDs = append(result.IDs, h.doc.ID)
+	}
+	return result, nil
+}
+
+// relevance 计算文档的相关度, 每个搜索词都必须命中至少一个字段
+func relevance(d *Document, terms []string) (int, bool) {
+	var score int
+	for _, term := range terms {
+		best := 0
+		for _, f := range fieldWeights {
+			if f.weight > best && strings.Contains(strings.ToLower(f.value(d)), term) {
+				best = f.weight
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+	}
+	return score, true
+}
+
+func matchFilter(d *Document, f *Filter) bool {
+	if f.MerchantID != 0 && d.MerchantID != f.MerchantID {
+		return false
+	}
+	if len(f.CateIDs) > 0 && !slices.Contains(f.CateIDs, d.CateID) {
+		return false
+	}
+	if len(f.Brands) > 0 && !slices.Contains(f.Brands, d.Brand) {
+		return false
+	}
+	if f.MinPrice > 0 && d.Price < f.MinPrice {
+		return false
+	}
+	if f.MaxPrice > 0 && d.Price > f.MaxPrice {
+		return false
+	}
+	return (!f.IsNew || d.IsNew) && (!f.IsBest || d.IsBest) && (!f.IsHot || d.IsHot) && (!f.InStock || d.InStock)
+}
+
+// countFacets 统计命中文档的品牌、分类和价格区间
+func countFacets(hits []hit) *domain.ProductFacets {
+	brands := make(map[string]int64)
+	cates := make(map[int64]int64)
+	prices := make([]int64, len(PriceRanges))
+	for _, h := range hits {
+		if h.doc.Brand != "" {
+			brands[h.doc.Brand]++
+		}
+		cates[h.doc.CateID]++
+		prices[priceBucket(h.doc.Price)]++
+	}
+
+	f := &domain.ProductFacets{Prices: make([]domain.PriceFacet, 0, len(prices))}
+	for brand, n := range brands {
+		f.Brands = append(f.Brands, domain.BrandFacet{Brand: brand, Count: n})
+	}
+	for cateID, n := range cates {
+		f.Categories = append(f.Categories, domain.CategoryFacet{CateID: cateID, Count: n})
+	}
+	for i, n := range prices {
+		lo, hi := priceRange(i)
+		f.Prices = append(f.Prices, domain.PriceFacet{Min: lo, Max: hi, Count: n})
+	}
+	return sortFacets(f)
+}
+
+// compareHits 按排序方式比较, 返回负数表示 a 排在前面
+func compareHits(a, b hit, sort string) int {
+	switch sort {
+	case SortPriceAsc:
+		return cmp.Compare(a.doc.Price, b.doc.Price)
+	case SortPriceDesc:
+		return cmp.Compare(b.doc.Price, a.doc.Price)
+	case SortSales:
+		return cmp.Compare(b.doc.PurchaseCount, a.doc.PurchaseCount)
+	case SortNewest:
+		return cmp.Compare(b.doc.CreatedAt, a.doc.CreatedAt)
+	case SortRating:
+		return cmp.Compare(b.doc.Rating, a.doc.Rating)
+	}
+	if c := cmp.Compare(b.score, a.score); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.doc.PurchaseCount, a.doc.PurchaseCount)
+}
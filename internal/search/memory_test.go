@@ -0,0 +1,124 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/domain"
+	"slices"
+	"testing"
+)
+
+var testDocs = []*Document{
+	{ID: 1, MerchantID: 10, Title: "星辰 无线蓝牙耳机", Brand: "星辰", CateID: 3, Price: 199, PurchaseCount: 50, Rating: 4.6, InStock: true, IsNew: true, CreatedAt: 300},
+	{ID: 2, MerchantID: 10, Title: "运动跑步鞋", Keywords: "蓝牙 计步", Brand: "飞跃", CateID: 4, Price: 299, PurchaseCount: 80, Rating: 4.8, CreatedAt: 100},
+	{ID: 3, MerchantID: 11, Title: "机械键盘", Desc: "支持蓝牙和有线连接", Brand: "星辰", CateID: 3, Price: 399, PurchaseCount: 20, Rating: 4.2, InStock: true, IsHot: true, CreatedAt: 200},
+	{ID: 4, MerchantID: 11, Title: "USB 数据线", Brand: "Anker", CateID: 3, Price: 29, PurchaseCount: 500, Rating: 4.9, InStock: true, CreatedAt: 400},
+}
+
+func loadDocs(docs []*Document) Loader {
+	return func(ctx context.Context, afterID int64, limit int) ([]*Document, error) {
+		var batch []*Document
+		for _, d := range docs {
+			if d.ID > afterID && len(batch) < limit {
+				batch = append(batch, d)
+			}
+		}
+		return batch, nil
+	}
+}
+
+func TestMemoryIndex_Search(t *testing.T) {
+	idx := NewMemoryIndex()
+	ctx := context.Background()
+	if n, err := idx.Reindex(ctx, loadDocs(testDocs)); err != nil || n != len(testDocs) {
+		t.Fatalf("Reindex = %d, %v", n, err)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int64
+		total int64
+	}{
+		{"标题命中排在关键词和描述前", Query{Text: "蓝牙"}, []int64{1, 2, 3}, 3},
+		{"多个搜索词都要命中", Query{Text: "星辰 蓝牙"}, []int64{1, 3}, 2},
+		{"不区分大小写", Query{Text: "usb"}, []int64{4}, 1},
+		{"无搜索词按销量", Query{}, []int64{4, 2, 1, 3}, 4},
+		{"分类和品牌筛选", Query{Filter: Filter{CateIDs: []int64{3}, Brands: []string{"星辰"}}}, []int64{1, 3}, 2},
+		{"价格区间", Query{Filter: Filter{MinPrice: 100, MaxPrice: 300}, Sort: SortPriceDesc}, []int64{2, 1}, 2},
+		{"商家和热销", Query{Filter: Filter{MerchantID: 11, IsHot: true}}, []int64{3}, 1},
+		{"按上架时间分页", Query{Sort: SortNewest, Offset: 1, Limit: 2}, []int64{1, 3}, 4},
+		{"价格从低到高", Query{Text: "星辰", Sort: SortPriceAsc}, []int64{1, 3}, 2},
+		{"按评分", Query{Text: "蓝牙", Sort: SortRating}, []int64{2, 1, 3}, 3},
+		{"只看有货", Query{Filter: Filter{InStock: true}, Sort: SortPriceAsc}, []int64{4, 1, 3}, 3},
+	}
+	for _, tt := range tests {
+		got, err := idx.Search(ctx, &tt.query)
+		if err != nil {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got.IDs, tt.want) || got.Total != tt.total {
+			t.Errorf("%s: got %v (total %d), want %v (total %d)", tt.name, got.IDs, got.Total, tt.want, tt.total)
+		}
+	}
+
+	if _, err := idx.Search(ctx, &Query{Sort: "random"}); !errors.Is(err, ErrUnsupportedSort) {
+		t.Errorf("Search(unknown sort) err = %v, want %v", err, ErrUnsupportedSort)
+	}
+}
+
+func TestMemoryIndex_Facets(t *testing.T) {
+	idx := NewMemoryIndex()
+	ctx := context.Background()
+	_ = idx.Index(ctx, testDocs...)
+
+	// 分面统计全部命中的商品, 不受分页影响
+	got, err := idx.Search(ctx, &Query{Filter: Filter{CateIDs: []int64{3}}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBrands := []domain.BrandFacet{{Brand: "星辰", Count: 2}, {Brand: "Anker", Count: 1}}
+	if !slices.Equal(got.Facets.Brands, wantBrands) {
+		t.Errorf("brands = %+v, want %+v", got.Facets.Brands, wantBrands)
+	}
+	if want := []domain.CategoryFacet{{CateID: 3, Count: 3}}; !slices.Equal(got.Facets.Categories, want) {
+		t.Errorf("categories = %+v, want %+v", got.Facets.Categories, want)
+	}
+	wantPrices := []domain.PriceFacet{{Min: 0, Max: 50, Count: 1}, {Min: 100, Max: 200, Count: 1}, {Min: 200, Max: 500, Count: 1}}
+	if !slices.Equal(got.Facets.Prices, wantPrices) {
+		t.Errorf("prices = %+v, want %+v", got.Facets.Prices, wantPrices)
+	}
+
+	// 区间下限包含在内, 上限不包含, 最后一个区间不设上限
+	for price, want := range map[float64]int{0: 0, 49.99: 0, 50: 1, 4999: 6, 5000: 7, 99999: 7} {
+		if got := priceBucket(price); got != want {
+			t.Errorf("priceBucket(%v) = %d, want %d", price, got, want)
+		}
+	}
+}
+
+func TestMemoryIndex_IndexAndDelete(t *testing.T) {
+	idx := NewMemoryIndex()
+	ctx := context.Background()
+	_ = idx.Index(ctx, testDocs...)
+
+	updated := *testDocs[0]
+	updated.Title = "星辰 降噪耳机"
+	_ = idx.Index(ctx, &updated)
+	_ = idx.Delete(ctx, 3, 99)
+
+	got, _ := idx.Search(ctx, &Query{Text: "蓝牙"})
+	if !slices.Equal(got.IDs, []int64{2}) {
+		t.Errorf("after update and delete got %v, want [2]", got.IDs)
+	}
+
+	// 重建后只保留新数据
+	if _, err := idx.Reindex(ctx, loadDocs(testDocs[3:])); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = idx.Search(ctx, &Query{})
+	if !slices.Equal(got.IDs, []int64{4}) {
+		t.Errorf("after reindex got %v, want [4]", got.IDs)
+	}
+}
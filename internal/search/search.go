@@ -0,0 +1,233 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ErrUnsupportedSort 不支持的排序方式, 定义在 domain 中以便 handler 映射状态码
+var ErrUnsupportedSort = domain.ErrUnsupportedSort
+
+// 排序方式
+const (
+	SortRelevance = ""           // 相关度, 没有搜索词时按销量
+	SortPriceAsc  = "price_asc"  // 价格从低到高
+	SortPriceDesc = "price_desc" // 价格从高到低
+	SortSales     = "sales"      // 销量从高到低
+	SortNewest    = "newest"     // 上架时间从新到旧
+	SortRating    = "rating"     // 评分从高到低
+)
+
+// ReindexBatchSize 重建索引时每批读取和写入的商品数
+const ReindexBatchSize = 500
+
+// FacetSize 品牌和分类分面最多返回的项数
+const FacetSize = 20
+
+// PriceRanges 价格分面的区间边界, 相邻两个值为一个区间 [min, max), 最后一个区间不设上限
+var PriceRanges = []float64{0, 50, 100, 200, 500, 1000, 2000, 5000}
+
+// Document 索引中的商品文档, 只包含搜索、筛选和排序需要的字段
+type Document struct {
+	ID            int64   `json:"id"`
+	MerchantID    int64   `json:"merchant_id"`
+	Title         string  `json:"title"`
+	SubTitle      string  `json:"sub_title"`
+	Brand         string  `json:"brand"`
+	Keywords      string  `json:"keywords"`
+	Desc          string  `json:"desc"`
+	CateID        int64   `json:"cate_id"`
+	Price         float64 `json:"price"`
+	PurchaseCount int64   `json:"purchase_count"`
+	Rating        float64 `json:"rating"`
+	InStock       bool    `json:"in_stock"`
+	IsHot         bool    `json:"is_hot"`
+	IsBest        bool    `json:"is_best"`
+	IsNew         bool    `json:"is_new"`
+	CreatedAt     int64   `json:"created_at"`
+	UpdatedAt     int64   `json:"updated_at"`
+}
+
+// NewDocument 将商品转换为索引文档, inStock 表示商品有可用库存
+func NewDocument(p *domain.Product, inStock bool) *Document {
+	return &Document{
+		ID:            p.ID,
+		MerchantID:    p.MerchantID,
+		Title:         p.Title,
+		SubTitle:      p.SubTitle,
+		Brand:         p.Brand,
+		Keywords:      p.Keywords,
+		Desc:          p.Desc,
+		CateID:        p.CateID,
+		Price:         p.Price,
+		PurchaseCount: p.PurchaseCount,
+		Rating:        p.Rating,
+		InStock:       inStock,
+		IsHot:         p.IsHot == 1,
+		IsBest:        p.IsBest,
+		IsNew:         p.IsNew,
+		CreatedAt:     int64(p.CreatedAt),
+		UpdatedAt:     int64(p.UpdatedAt),
+	}
+}
+
+// Indexable 判断商品是否应出现在搜索结果中, 只有上架且未删除的商品可以被搜索
+func Indexable(p *domain.Product) bool {
+	return p.Status == _const.ProductStatusOnSale && p.IsDeleted == 0
+}
+
+// Filter 筛选条件, 零值表示不限
+type Filter struct {
+	MerchantID int64
+	CateIDs    []int64
+	Brands     []string
+	MinPrice   float64
+	MaxPrice   float64
+	IsNew      bool // 只看新品
+	IsBest     bool // 只看精品
+	IsHot      bool // 只看热销
+	InStock    bool // 只看有货
+}
+
+// Query 搜索请求
+type Query struct {
+	Text   string
+	Filter Filter
+	Sort   string
+	Offset int
+	Limit  int
+}
+
+// Validate 校验排序方式和分页参数
+func (q *Query) Validate() error {
+	switch q.Sort {
+	case SortRelevance, SortPriceAsc, SortPriceDesc, SortSales, SortNewest, SortRating:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedSort, q.Sort)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return errors.New("offset and limit must not be negative")
+	}
+	return nil
+}
+
+// Result 搜索结果, IDs 按排序后的顺序排列, Facets 为全部命中商品的分面统计
+type Result struct {
+	IDs    []int64
+	Total  int64
+	Facets *domain.ProductFacets
+}
+
+// Loader 按 ID 升序分批读取 afterID 之后的可搜索商品, 返回空切片表示读取完毕
+type Loader func(ctx context.Context, afterID int64, limit int) ([]*Document, error)
+
+// ProductIndex 商品搜索索引
+type ProductIndex interface {
+	// Index 新增或覆盖商品文档
+	Index(ctx context.Context, docs ...*Document) error
+
+	// Delete 删除商品文档, 文档不存在时忽略
+	Delete(ctx context.Context, ids ...int64) error
+
+	// Reindex 使用 load 读取的全部商品重建索引, 完成前搜索仍使用旧数据, 返回写入的文档数
+	Reindex(ctx context.Context, load Loader) (int, error)
+
+	// Search 搜索商品
+	Search(ctx context.Context, q *Query) (*Result, error)
+
+	// Versions 返回 ids 中已在索引里的文档的 updated_at, 不在索引中的 ID 不出现在结果中, 用于比对数据库与索引
+	Versions(ctx context.Context, ids []int64) (map[int64]int64, error)
+}
+
+// New 根据配置创建搜索索引, client 为 nil 时使用配置的超时创建默认客户端
+func New(c conf.SearchConf, client *http.Client) (ProductIndex, error) {
+	switch c.Backend {
+	case "", "memory":
+		return NewMemoryIndex(), nil
+	}
+	if client == nil {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+	switch c.Backend {
+	case "meilisearch":
+		return NewMeilisearch(c.Meilisearch, client)
+	case "elasticsearch", "opensearch":
+		return NewElasticsearch(c.Elasticsearch, client)
+	}
+	return nil, fmt.Errorf("search: unsupported backend %q", c.Backend)
+}
+
+// reindex 分批读取商品并写入 index, 供各实现的 Reindex 复用
+func reindex(ctx context.Context, load Loader, write func(ctx context.Context, docs []*Document) error) (int, error) {
+	var afterID int64
+	var total int
+	for {
+		docs, err := load(ctx, afterID, ReindexBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(docs) == 0 {
+			return total, nil
+		}
+		if err = write(ctx, docs); err != nil {
+			return total, err
+		}
+		total += len(docs)
+		afterID = docs[len(docs)-1].ID
+	}
+}
+
+// priceRange 返回第 i 个价格区间, 最后一个区间的 max 为 0
+func priceRange(i int) (float64, float64) {
+	if i == len(PriceRanges)-1 {
+		return PriceRanges[i], 0
+	}
+	return PriceRanges[i], PriceRanges[i+1]
+}
+
+// priceBucket 返回价格所在的区间下标
+func priceBucket(price float64) int {
+	i, found := slices.BinarySearch(PriceRanges, price)
+	if !found {
+		i--
+	}
+	return max(i, 0)
+}
+
+// sortFacets 品牌和分类按商品数从多到少排列并截取前 FacetSize 项, 去掉数量为 0 的价格区间
+func sortFacets(f *domain.ProductFacets) *domain.ProductFacets {
+	if f.Brands == nil {
+		f.Brands = []domain.BrandFacet{}
+	}
+	if f.Categories == nil {
+		f.Categories = []domain.CategoryFacet{}
+	}
+	slices.SortFunc(f.Brands, func(a, b domain.BrandFacet) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Brand, b.Brand)
+	})
+	slices.SortFunc(f.Categories, func(a, b domain.CategoryFacet) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.CateID, b.CateID)
+	})
+	f.Brands = f.Brands[:min(len(f.Brands), FacetSize)]
+	f.Categories = f.Categories[:min(len(f.Categories), FacetSize)]
+	f.Prices = slices.DeleteFunc(f.Prices, func(p domain.PriceFacet) bool { return p.Count == 0 })
+	return f
+}
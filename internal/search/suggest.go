@@ -0,0 +1,198 @@
+package search
+
+import (
+	"cmp"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/pinyin"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SuggestTerm 联想词库中的一项, Weight 越大越靠前
+type SuggestTerm struct {
+	Text   string
+	Kind   string
+	Weight int64
+}
+
+// suggestEntry 联想词及其匹配用的文本
+type suggestEntry struct {
+	domain.Suggestion
+	weight int64
+	text   []rune // 归一化后的原文
+	full   []rune // 全拼, 不含汉字时为空
+}
+
+// suggestKey 前缀匹配的键, 原文、全拼和首字母各一个
+type suggestKey struct {
+	key   string
+	entry int
+}
+
+// Suggester 搜索联想, 支持原文、全拼和拼音首字母的前缀匹配, 没有前缀匹配时按编辑距离容错
+type Suggester struct {
+	mu      sync.RWMutex
+	entries []suggestEntry
+	keys    []suggestKey // 按 key 排序
+}
+
+func NewSuggester() *Suggester {
+	return &Suggester{}
+}
+
+// normalize 转为小写并去掉空白
+func normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// Build 使用 terms 替换词库, 同一来源的相同文本合并权重
+func (s *Suggester) Build(terms []SuggestTerm) int {
+	merged := make(map[domain.Suggestion]int64, len(terms))
+	for _, t := range terms {
+		text := strings.TrimSpace(t.Text)
+		if text == "" {
+			continue
+		}
+		merged[domain.Suggestion{Text: text, Kind: t.Kind}] += t.Weight
+	}
+
+	entries := make([]suggestEntry, 0, len(merged))
+	keys := make([]suggestKey, 0, len(merged)*3)
+	for sg, weight := range merged {
+		e := suggestEntry{Suggestion: sg, weight: weight, text: []rune(normalize(sg.Text))}
+		keys = append(keys, suggestKey{key: string(e.text), entry: len(entries)})
+		if pinyin.HasHan(sg.Text) {
+			full := pinyin.Full(sg.Text)
+			e.full = []rune(full)
+			keys = append(keys, suggestKey{key: full, entry: len(entries)}, suggestKey{key: pinyin.Initials(sg.Text), entry: len(entries)})
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(keys, func(a, b suggestKey) int { return cmp.Compare(a.key, b.key) })
+
+	s.mu.Lock()
+	s.entries, s.keys = entries, keys
+	s.mu.Unlock()
+	return len(entries)
+}
+
+// suggestHit 命中的联想词及编辑距离, 前缀匹配的距离为 0
+type suggestHit struct {
+	entry int
+	edits int
+}
+
+// Suggest 返回以 prefix 开头的联想词, 按编辑距离、权重排列
+func (s *Suggester) Suggest(prefix string, limit int) []domain.Suggestion {
+	p := normalize(prefix)
+	if p == "" || limit <= 0 {
+		return []domain.Suggestion{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best := make(map[int]int)
+	start, _ := slices.BinarySearchFunc(s.keys, p, func(k suggestKey, p string) int { return cmp.Compare(k.key, p) })
+	for _, k := range s.keys[start:] {
+		if !strings.HasPrefix(k.key, p) {
+			break
+		}
+		best[k.entry] = 0
+	}
+	// 没有前缀匹配时才容错, 且只在输入足够长时启用, 避免短输入匹配到大量无关结果
+	if maxEdits := allowedEdits(p); len(best) == 0 && maxEdits > 0 {
+		pr := []rune(p)
+		for i, e := range s.entries {
+			if _, ok := best[i]; ok {
+				continue
+			}
+			d := prefixDistance(pr, e.text, maxEdits)
+			if len(e.full) > 0 {
+				d = min(d, prefixDistance(pr, e.full, maxEdits))
+			}
+			if d <= maxEdits {
+				best[i] = d
+			}
+		}
+	}
+
+	hits := make([]suggestHit, 0, len(best))
+	for i, d := range best {
+		hits = append(hits, suggestHit{entry: i, edits: d})
+	}
+	slices.SortFunc(hits, func(a, b suggestHit) int {
+		if c := cmp.Compare(a.edits, b.edits); c != 0 {
+			return c
+		}
+		ea, eb := &s.entries[a.entry], &s.entries[b.entry]
+		if c := cmp.Compare(eb.weight, ea.weight); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(len(ea.text), len(eb.text)); c != 0 {
+			return c
+		}
+		return cmp.Compare(ea.Text, eb.Text)
+	})
+
+	result := make([]domain.Suggestion, 0, min(limit, len(hits)))
+	for _, h := range hits[:min(limit, len(hits))] {
+		result = append(result, s.entries[h.entry].Suggestion)
+	}
+	return result
+}
+
+// allowedEdits 输入少于 3 个字符时不容错, 6 个字符以上允许 2 处错误
+func allowedEdits(p string) int {
+	switch n := len([]rune(p)); {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// prefixDistance 计算 p 与 key 任意前缀之间的最小编辑距离(相邻交换计为一次), 超过 maxEdits 时返回 maxEdits+1
+func prefixDistance(p, key []rune, maxEdits int) int {
+	if len(key) < len(p)-maxEdits {
+		return maxEdits + 1
+	}
+	key = key[:min(len(key), len(p)+maxEdits)]
+
+	// rows[i][j] 为 p[:i] 与 key[:j] 的编辑距离, 只保留最近三行
+	prev2 := make([]int, len(key)+1)
+	prev := make([]int, len(key)+1)
+	cur := make([]int, len(key)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(p); i++ {
+		cur[0] = i
+		for j := 1; j <= len(key); j++ {
+			cost := 1
+			if p[i-1] == key[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && p[i-1] == key[j-2] && p[i-2] == key[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	best := maxEdits + 1
+	for j := max(0, len(p)-maxEdits); j <= len(key); j++ {
+		best = min(best, prev[j])
+	}
+	return best
+}
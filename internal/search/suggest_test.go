@@ -0,0 +1,70 @@
+package search
+
+import (
+	"github.com/star-find-cloud/star-mall/domain"
+	"slices"
+	"testing"
+)
+
+func TestSuggester_Suggest(t *testing.T) {
+	s := NewSuggester()
+	n := s.Build([]SuggestTerm{
+		{Text: "华为 Mate60 手机", Kind: domain.SuggestTitle, Weight: 50},
+		{Text: "华为手环", Kind: domain.SuggestTitle, Weight: 80},
+		{Text: "华为", Kind: domain.SuggestBrand, Weight: 3},
+		{Text: "华为", Kind: domain.SuggestBrand, Weight: 2},
+		{Text: "手机", Kind: domain.SuggestCategory, Weight: 10},
+		{Text: "iPhone 15", Kind: domain.SuggestTitle, Weight: 100},
+		{Text: "  ", Kind: domain.SuggestTitle},
+	})
+	if n != 5 {
+		t.Fatalf("Build = %d, want 5 merged terms", n)
+	}
+
+	texts := func(sg []domain.Suggestion) []string {
+		var out []string
+		for _, x := range sg {
+			out = append(out, x.Text)
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"原文前缀按权重", "华为", 10, []string{"华为手环", "华为 Mate60 手机", "华为"}},
+		{"忽略空白和大小写", "华为m", 10, []string{"华为 Mate60 手机"}},
+		{"全拼", "huaweis", 10, []string{"华为手环"}},
+		{"首字母", "sj", 10, []string{"手机"}},
+		{"拼写容错", "iphoen", 10, []string{"iPhone 15"}},
+		{"拼音容错", "shouij", 10, []string{"手机"}},
+		{"短输入不容错", "ip", 10, []string{"iPhone 15"}},
+		{"数量限制", "hw", 1, []string{"华为手环"}},
+		{"无结果", "xyz", 10, nil},
+	}
+	for _, tt := range tests {
+		if got := texts(s.Suggest(tt.prefix, tt.limit)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Suggest(%q) = %v, want %v", tt.name, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixDistance(t *testing.T) {
+	tests := []struct {
+		p, key string
+		want   int
+	}{
+		{"abc", "abcdef", 0},
+		{"abd", "abcdef", 1},
+		{"acb", "abcdef", 1},
+		{"xyz", "abcdef", 2},
+		{"abcdef", "abc", 2},
+	}
+	for _, tt := range tests {
+		if got := prefixDistance([]rune(tt.p), []rune(tt.key), 1); got != min(tt.want, 2) {
+			t.Errorf("prefixDistance(%q, %q) = %d, want %d", tt.p, tt.key, got, min(tt.want, 2))
+		}
+	}
+}
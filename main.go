@@ -1,20 +1,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
 	log "github.com/star-find-cloud/star-mall/pkg/logger"
-	"github.com/star-find-cloud/star-mall/protobuf/pb"
-	"google.golang.org/grpc"
 
 	"github.com/star-find-cloud/star-mall/handler"
 	ds "github.com/star-find-cloud/star-mall/internal/deepseek"
-	"github.com/star-find-cloud/star-mall/internal/mq"
+	"github.com/star-find-cloud/star-mall/internal/logistics"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	"github.com/star-find-cloud/star-mall/middleware"
 	"github.com/star-find-cloud/star-mall/pkg/database"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"github.com/star-find-cloud/star-mall/pkg/oauth"
 	"github.com/star-find-cloud/star-mall/pkg/oss"
+	"github.com/star-find-cloud/star-mall/pkg/payment"
+	"github.com/star-find-cloud/star-mall/pkg/sms"
+	appproto "github.com/star-find-cloud/star-mall/protobuf/pb"
 	"github.com/star-find-cloud/star-mall/repo"
 	"github.com/star-find-cloud/star-mall/routers"
 	"github.com/star-find-cloud/star-mall/service"
 	"github.com/star-find-cloud/star-mall/utils"
+	"google.golang.org/grpc"
+	"net"
+	"os"
 )
 
 // @title           Star Mall API
@@ -38,42 +48,140 @@ import (
 // @description 输入 JWT token，格式为：Bearer <token>
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		os.Exit(runReindex())
+	}
+
 	var (
-		mqProducer     mq.Producer
-		mqConsumer     mq.Consumer
-		db, err        = database.NewMySQL()
-		ossClient      = oss.NewTencentCos()
-		cache, err     = database.NewRedis()
+		ossClient      = oss.New(conf.GetConfig().OSS)
 		deepseekClient = ds.NewDeepseekClient()
 	)
+	db, err := database.NewMySQL()
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
+	cache, err := database.NewRedis()
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
+
+	// 加载 token 签名密钥, 密钥配置错误时拒绝启动
+	keySet, err := appjwt.NewKeySet(conf.GetConfig().JWT, conf.GetConfig().App.JWTSecret)
 	if err != nil {
 		fmt.Printf("初始化失败: %v\n", err)
 		log.AppLogger.Fatalf("初始化失败: %v\n", err)
 		panic(err)
 	}
+	appjwt.SetKeySet(keySet)
+	keyHandler := handler.NewKeyHandler(keySet)
+
+	// 只信任配置的反向代理转发的客户端 IP
+	if err = utils.SetTrustedProxies(conf.GetConfig().Security.TrustedProxies); err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
 
 	imageRepo := repo.NewImageRepo(db)
 	var imageService service.ImageMetaDataService
+	var imageLocalService service.ImageLocalService
+	var imagePresigner service.PresignedService
+	// 图片处理读写原图所在的存储, 生成的各尺寸版本保存在原图旁边
+	var imageStore service.ImageStore = service.NewLocalImageStore(conf.GetConfig().App.ImageDir)
+	if utils.IsEnableOSS() {
+		imageStore = service.NewOSSImageStore(ossClient, nil)
+	}
+	imageProcessService := service.NewImageProcessService(imageRepo, imageStore, conf.GetConfig().Image)
+	go imageProcessService.Run(context.Background())
+	imageGCService := service.NewImageGCService(imageRepo, imageStore, conf.GetConfig().Image)
+	go imageGCService.Run(context.Background())
 	if utils.IsEnableOSS() {
-		imageService = service.NewImageForOssService(imageRepo, ossClient, cache)
+		ossService := service.NewImageForOssService(imageRepo, ossClient, cache, imageProcessService)
+		imageService, imagePresigner = ossService, ossService
 	} else {
-		imageService = service.NewImageForDBService(imageRepo)
+		localService := service.NewImageForDBService(imageRepo, repo.NewProductRepo(db, cache), conf.GetConfig().App.ImageDir, imageProcessService)
+		imageService, imageLocalService = localService, localService
 	}
-	imageHandler := handler.NewImageHandler(imageService)
+	imageHandler := handler.NewImageHandler(imageService, imageLocalService, imagePresigner)
 
 	userRepo := repo.NewUserRepo(db, cache)
-	userService := service.NewUserService(userRepo, imageRepo)
+	tokenRepo := repo.NewTokenRepo(cache.Cache)
+	tokenService := service.NewTokenService(tokenRepo)
+	smsProvider, err := sms.NewProvider(conf.GetConfig().SMS)
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
+	smsService := service.NewSmsService(repo.NewSmsRepo(db), repo.NewOTPRepo(cache.Cache), smsProvider, conf.GetConfig().SMS)
+	loginGuardRepo := repo.NewLoginGuardRepo(cache.Cache)
+	loginGuard := service.NewLoginGuardService(loginGuardRepo, conf.GetConfig().Security)
+	totpService := service.NewTOTPService(repo.NewTOTPRepo(db), loginGuard, conf.GetConfig().Security)
+	// 商家账号登录时检查审核状态
+	merchantRepo := repo.NewMerchantRepo(db, cache)
+	merchantService := service.NewMerchantService(merchantRepo, imageRepo)
+	userService := service.NewUserService(userRepo, imageRepo, tokenService, smsService, loginGuard, totpService, merchantService)
 	userHandler := handler.NewUserHandler(userService)
+	totpHandler := handler.NewTOTPHandler(totpService)
+	oauthRegistry, err := oauth.NewRegistry(conf.GetConfig().OAuth.Providers, nil)
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
+	identityRepo := repo.NewIdentityRepo(db)
+	oauthService := service.NewOAuthService(oauthRegistry, repo.NewOAuthStateRepo(cache.Cache), identityRepo, userRepo, userService, conf.GetConfig().OAuth)
+	oauthHandler := handler.NewOAuthHandler(oauthService, conf.GetConfig().Cookie.Secure)
+	searchLogRepo := repo.NewSearchLogRepo(cache.Cache)
+	accountService := service.NewAccountService(repo.NewAccountRepo(db), identityRepo, userService, smsService, totpService, tokenService,
+		loginGuardRepo, searchLogRepo, conf.GetConfig().Account)
+	accountHandler := handler.NewAccountHandler(accountService)
+	go accountService.Run(context.Background())
+
+	// 初始化会员相关组件
+	paymentProvider, err := payment.NewProvider(conf.GetConfig().Payment)
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
+	vipService := service.NewMembershipService(repo.NewVipRepo(db), paymentProvider, conf.GetConfig().Vip)
+	vipHandler := handler.NewVipHandler(vipService)
+	go vipService.Run(context.Background())
 
 	// 初始化商家相关组件
-	merchantRepo := repo.NewMerchantRepo(db, cache)
-	merchantService := service.NewMerchantService(merchantRepo, imageRepo)
 	merchantHandler := handler.NewMerchantHandler(merchantService, userService)
 
 	// 初始化商品相关组件
 	productRepo := repo.NewProductRepo(db, cache)
-	productService := service.NewProductService(productRepo, ossClient, imageRepo)
-	productHandler := handler.NewProductHandler(productService)
+	productIndex, err := search.New(conf.GetConfig().Search, nil)
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Fatalf("初始化失败: %v\n", err)
+		panic(err)
+	}
+	productService := service.NewProductService(productRepo, ossClient, imageRepo, productIndex)
+	// 进程内索引不持久化, 启动时从数据库重建
+	if _, ok := productIndex.(*search.MemoryIndex); ok {
+		go func() {
+			if n, err := productService.RebuildIndex(context.Background()); err != nil {
+				log.AppLogger.Errorf("重建商品搜索索引失败: %v", err)
+			} else {
+				log.AppLogger.Infof("重建商品搜索索引完成, 共 %d 个商品", n)
+			}
+		}()
+	}
+	// 商品和库存的变更通过发件箱事件同步到搜索索引, 并定期比对修复差异
+	indexSyncService := service.NewIndexSyncService(productRepo, repo.NewOutboxRepo(db), productIndex, conf.GetConfig().Search)
+	go indexSyncService.Run(context.Background())
+	suggestService := service.NewSuggestService(productRepo, searchLogRepo)
+	go suggestService.Run(context.Background())
+	searchHandler := handler.NewSearchHandler(suggestService)
+	productHandler := handler.NewProductHandler(productService, vipService, suggestService)
 
 	// 初始化库存相关组件
 	inventoryRepo := repo.NewInventoryRepo(db, cache)
@@ -83,27 +191,61 @@ func main() {
 	// 初始化公共组件
 	publicRepo := repo.NewPublicRepo(db, cache)
 	publicService := service.NewPublicService(publicRepo)
-	publicHandler := handler.NewPublicHandler(publicService)
+	publicHandler := handler.NewPublicHandler(publicService, smsService)
 
 	// 初始化购物车相关组件
 	cartRepo := repo.NewCartRepo(db, cache)
 	cartService := service.NewCartService(cartRepo, productRepo)
-	cartHandler := handler.NewCartHandler(cartService)
+	cartHandler := handler.NewCartHandler(cartService, vipService)
 
 	// 初始化订单相关组件
 	orderRepo := repo.NewOrderRepo(db, cache)
-	orderService := service.NewOrderService(orderRepo, productRepo, userRepo, inventoryRepo)
+	couponRepo := repo.NewCouponRepo(db, cache)
+	couponService := service.NewCouponService(couponRepo, vipService)
+	couponHandler := handler.NewCouponHandler(couponService)
+	orderService := service.NewOrderService(orderRepo, productRepo, userRepo, inventoryRepo, couponService, vipService)
 	orderHandler := handler.NewOrderHandler(orderService)
 
+	// 初始化物流相关组件
+	logisticsConf := conf.GetConfig().Logistics
+	carriers := make([]logistics.Carrier, 0, len(logisticsConf.Carriers))
+	for _, code := range logisticsConf.Carriers {
+		carriers = append(carriers, logistics.NewFixtureCarrier(code, logisticsConf.FixtureDir))
+	}
+	shipmentRepo := repo.NewShipmentRepo(db, cache)
+	shipmentService := service.NewShipmentService(shipmentRepo, orderRepo, productRepo, logistics.NewRegistry(carriers...), logisticsConf.AutoConfirmDays)
+	shipmentHandler := handler.NewShipmentHandler(shipmentService)
+	go shipmentService.Run(context.Background(), logisticsConf.SyncInterval)
+
 	// 初始化 deepseek 相关组件
 	deepseekService := service.NewDeepseekService(deepseekClient, userRepo, productRepo)
 	deepseekHandler := handler.NewDeepseekHandler(deepseekService)
 
-	//grpcServer := grpc.NewServer()
-	//pb.RegisterImageServiceServer(grpcServer, imageService)
+	// 初始化权限相关组件
+	rbacRepo := repo.NewRBACRepo(db, cache)
+	rbacService := service.NewRBACService(rbacRepo)
+	roleHandler := handler.NewRoleHandler(rbacService)
+
+	// 初始化后台管理相关组件
+	adminRepo := repo.NewAdminRepo(db, cache)
+	auditRepo := repo.NewAuditRepo(db)
+	adminService := service.NewAdminService(adminRepo, auditRepo, userRepo, tokenService)
+	adminHandler := handler.NewAdminHandler(adminService, orderService, couponService, loginGuard)
+
+	// 初始化 gRPC 图片服务, 与 gin 使用不同的端口, 查询和下载允许游客访问
+	grpcConf := conf.GetConfig().GRPC
+	imageStreamService := service.NewImageStreamService(imageRepo, repo.NewImageUploadRepo(cache.Cache), productRepo, imageStore, imageProcessService, grpcConf)
+	go imageStreamService.Run(context.Background())
+	publicImageMethods := []string{appproto.ImageService_GetImageInfo_FullMethodName, appproto.ImageService_DownloadImage_FullMethodName}
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.GRPCUnaryAuth(tokenService, publicImageMethods...)),
+		grpc.ChainStreamInterceptor(middleware.GRPCStreamAuth(tokenService, publicImageMethods...)),
+	)
+	appproto.RegisterImageServiceServer(grpcServer, handler.NewImageGRPCServer(imageStreamService, grpcConf.ChunkSize))
+	go serveGRPC(grpcServer, grpcConf.Addr)
 
 	fmt.Println("配置读取完成")
-	var r = routers.InitRouter(userHandler, imageHandler, merchantHandler, productHandler, inventoryHandler, publicHandler, cartHandler, orderHandler, deepseekHandler)
+	var r = routers.InitRouter(userHandler, imageHandler, merchantHandler, productHandler, inventoryHandler, publicHandler, cartHandler, orderHandler, couponHandler, shipmentHandler, deepseekHandler, roleHandler, adminHandler, keyHandler, totpHandler, oauthHandler, accountHandler, vipHandler, searchHandler, tokenService, merchantService, rbacService, adminService, cache)
 
 	fmt.Println("gin 配置完成")
 	fmt.Println("正在启动服务器...")
@@ -113,3 +255,19 @@ func main() {
 		panic(err)
 	}
 }
+
+// serveGRPC 启动 gRPC 服务, 启动失败的处理与 gin 一致
+func serveGRPC(server *grpc.Server, addr string) {
+	if addr == "" {
+		addr = ":50051"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err == nil {
+		fmt.Printf("gRPC 服务监听 %s\n", addr)
+		err = server.Serve(lis)
+	}
+	if err != nil {
+		fmt.Printf("gRPC 服务启动失败: %v\n", err)
+		panic(err)
+	}
+}
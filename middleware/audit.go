@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	auditMaxBody   = 4 << 10 // 审计日志中保存的请求体上限
+	auditRedacted  = "******"
+	auditRecordTTL = 3 * time.Second
+)
+
+// 请求体中需要脱敏的字段, 字段名包含以下任意片段即脱敏
+var auditSensitiveKeys = []string{"password", "passwd", "secret", "token", "code"}
+
+// AuditRecorder 保存管理员操作审计日志
+type AuditRecorder interface {
+	Record(ctx context.Context, log *domain.AuditLog) error
+}
+
+// Audit 记录管理员的修改类操作(非 GET/HEAD/OPTIONS 请求), 包括操作人、路由、参数和响应状态码.
+// 需放在 JwtAuth 之后, 请求体中的密码等敏感字段会被脱敏
+func Audit(recorder AuditRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			data, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"code": http.StatusBadRequest,
+					"msg":  "invalid request body",
+				})
+				return
+			}
+			body = data
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		}
+
+		c.Next()
+
+		entry := &domain.AuditLog{
+			Action:    domain.PermissionKey(c.Request.Method, routePattern(c)),
+			Path:      c.Request.URL.Path,
+			Params:    auditParams(c, body),
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			CreatedAt: time.Now().Unix(),
+		}
+		if claims, exists := c.Get("claims"); exists {
+			if customClaims, ok := claims.(*appjwt.CustomClaims); ok {
+				entry.AdminID = customClaims.UserID
+				entry.AdminName = customClaims.UserName
+			}
+		}
+
+		// 请求可能已被客户端取消, 审计日志使用独立的 context 写入
+		ctx, cancel := context.WithTimeout(context.Background(), auditRecordTTL)
+		defer cancel()
+		if err := recorder.Record(ctx, entry); err != nil {
+			log.AppLogger.Errorf("record audit log failed, action: %s, err: %v", entry.Action, err)
+		}
+	}
+}
+
+// auditParams 将查询参数和脱敏后的请求体序列化为 JSON, 超出长度的部分会被截断
+func auditParams(c *gin.Context, body []byte) string {
+	params := make(map[string]interface{}, 2)
+	if c.Request.URL.RawQuery != "" {
+		params["query"] = c.Request.URL.RawQuery
+	}
+	if len(body) > 0 {
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			params["body"] = redactAudit(decoded)
+		} else {
+			// 非 JSON 请求体(如文件上传)无法脱敏, 只记录长度
+			params["bodySize"] = len(body)
+		}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	if len(data) > auditMaxBody {
+		data = data[:auditMaxBody]
+	}
+	return string(data)
+}
+
+func redactAudit(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if isSensitiveAuditKey(k) {
+				val[k] = auditRedacted
+			} else {
+				val[k] = redactAudit(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = redactAudit(item)
+		}
+	}
+	return v
+}
+
+func isSensitiveAuditKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range auditSensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
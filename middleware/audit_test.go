@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeRecorder struct {
+	logs []*domain.AuditLog
+}
+
+func (f *fakeRecorder) Record(ctx context.Context, log *domain.AuditLog) error {
+	f.logs = append(f.logs, log)
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := &fakeRecorder{}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("claims", &appjwt.CustomClaims{UserID: 7, UserName: "root", Roles: _const.AdminRole})
+	})
+	checker := fakeChecker{_const.AdminRole: {"GET /api/v1/admin/user/search", "PATCH /api/v1/admin/user/ban/:id"}}
+	admin := NewPermissionGroup(r.Group("/api/v1/admin"), checker, Audit(recorder))
+
+	var handlerBody string
+	admin.GET("/user/search", func(c *gin.Context) { c.Status(http.StatusOK) })
+	admin.PATCH("/user/ban/:id", func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		handlerBody = string(data)
+		c.Status(http.StatusNotFound)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/admin/user/search?keyword=a", nil))
+	if len(recorder.logs) != 0 {
+		t.Fatalf("GET request should not be audited, got %d logs", len(recorder.logs))
+	}
+
+	body := `{"reason":"spam","password":"123456","nested":{"accessToken":"abc"}}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/user/ban/42?force=1", strings.NewReader(body))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if handlerBody != body {
+		t.Errorf("handler body = %q, want %q", handlerBody, body)
+	}
+	if len(recorder.logs) != 1 {
+		t.Fatalf("got %d logs, want 1", len(recorder.logs))
+	}
+	log := recorder.logs[0]
+	if log.AdminID != 7 || log.AdminName != "root" {
+		t.Errorf("admin = %d %s, want 7 root", log.AdminID, log.AdminName)
+	}
+	if log.Action != "PATCH /api/v1/admin/user/ban/:id" || log.Path != "/api/v1/admin/user/ban/42" {
+		t.Errorf("action = %q, path = %q", log.Action, log.Path)
+	}
+	if log.Status != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", log.Status, http.StatusNotFound)
+	}
+	for _, secret := range []string{"123456", "abc"} {
+		if strings.Contains(log.Params, secret) {
+			t.Errorf("params %s leaks %q", log.Params, secret)
+		}
+	}
+	if !strings.Contains(log.Params, "spam") || !strings.Contains(log.Params, "force=1") {
+		t.Errorf("params %s missing request data", log.Params)
+	}
+}
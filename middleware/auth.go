@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/domain"
 	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
 	"net/http"
 )
 
@@ -27,7 +30,14 @@ func handleJWTError(c *gin.Context, err error) {
 	}
 }
 
-func JwtAuth() gin.HandlerFunc {
+// TokenChecker 检查访问 token 是否已被注销
+type TokenChecker interface {
+	CheckToken(ctx context.Context, claims *appjwt.CustomClaims) error
+}
+
+// JwtAuth 校验请求携带的访问 token, 并拒绝已注销(退出登录、修改密码等)的 token.
+// checker 为 nil 时只校验签名和有效期
+func JwtAuth(checker TokenChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -49,7 +59,45 @@ func JwtAuth() gin.HandlerFunc {
 			handleJWTError(c, err)
 			return
 		}
+		// 两步验证中间凭证等特殊用途的 token 不能访问接口
+		if claims.Purpose != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code": http.StatusUnauthorized,
+				"msg":  "token is invalid",
+			})
+			return
+		}
+		if checker != nil {
+			if err = checker.CheckToken(c.Request.Context(), claims); err != nil {
+				if errors.Is(err, domain.ErrTokenRevoked) {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+						"code": http.StatusUnauthorized,
+						"msg":  "token is revoked",
+					})
+					return
+				}
+				log.AppLogger.Errorf("check token failed, err: %v", err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+					"code": http.StatusServiceUnavailable,
+					"msg":  "token check unavailable",
+				})
+				return
+			}
+		}
 		c.Set("claims", claims)
 		c.Next()
 	}
 }
+
+// OptionalJwtAuth 请求携带 token 时按 JwtAuth 校验并写入 claims, 未携带时按游客放行,
+// 用于商品详情等游客可访问但会员能看到更多信息的接口
+func OptionalJwtAuth(checker TokenChecker) gin.HandlerFunc {
+	auth := JwtAuth(checker)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"slices"
+	"strings"
+)
+
+type grpcClaimsKey struct{}
+
+// GRPCClaims 获取 gRPC 拦截器解析出的 claims, 游客访问公开方法时 ok 为 false
+func GRPCClaims(ctx context.Context) (*appjwt.CustomClaims, bool) {
+	claims, ok := ctx.Value(grpcClaimsKey{}).(*appjwt.CustomClaims)
+	return claims, ok && claims != nil
+}
+
+// GRPCUnaryAuth 与 JwtAuth 相同, 校验 metadata 中 authorization 携带的访问 token.
+// public 为允许游客访问的完整方法名, 如 /image.ImageService/GetImageInfo, 携带 token 时仍然校验
+func GRPCUnaryAuth(checker TokenChecker, public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := grpcAuthenticate(ctx, checker, slices.Contains(public, info.FullMethod))
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// GRPCStreamAuth 流式方法的 GRPCUnaryAuth
+func GRPCStreamAuth(checker TokenChecker, public ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := grpcAuthenticate(ss.Context(), checker, slices.Contains(public, info.FullMethod))
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authServerStream 替换流的 context, 使方法能够取到 claims
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcAuthenticate(ctx context.Context, checker TokenChecker, public bool) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || values[0] == "" {
+		if public {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "token is empty")
+	}
+
+	claims, err := appjwt.ParseToken(strings.TrimPrefix(values[0], "Bearer "))
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, status.Error(codes.Unauthenticated, "token is expired")
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return nil, status.Error(codes.Unauthenticated, "token is not active yet")
+	case err != nil, claims.Purpose != "":
+		return nil, status.Error(codes.Unauthenticated, "token is invalid")
+	}
+	if checker != nil {
+		if err = checker.CheckToken(ctx, claims); err != nil {
+			if errors.Is(err, domain.ErrTokenRevoked) {
+				return nil, status.Error(codes.Unauthenticated, "token is revoked")
+			}
+			log.AppLogger.Errorf("check token failed, err: %v", err)
+			return nil, status.Error(codes.Unavailable, "token check unavailable")
+		}
+	}
+	return context.WithValue(ctx, grpcClaimsKey{}, claims), nil
+}
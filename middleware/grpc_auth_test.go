@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+type revokedChecker struct{}
+
+func (revokedChecker) CheckToken(ctx context.Context, claims *appjwt.CustomClaims) error {
+	return domain.ErrTokenRevoked
+}
+
+func TestGRPCUnaryAuth(t *testing.T) {
+	keys, err := appjwt.NewKeySet(conf.JWTConf{}, "test-secret")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	appjwt.SetKeySet(keys)
+	token, _ := appjwt.GenerateSessionToken(7, "alice", _const.UserRole, "session")
+	mfa, _ := appjwt.GenerateMFAToken(7, "alice", _const.UserRole)
+
+	const public, private = "/image.ImageService/GetImageInfo", "/image.ImageService/UploadImage"
+	call := func(checker TokenChecker, method, authorization string) (*appjwt.CustomClaims, error) {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+		}
+		var claims *appjwt.CustomClaims
+		_, err := GRPCUnaryAuth(checker, public)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			claims, _ = GRPCClaims(ctx)
+			return nil, nil
+		})
+		return claims, err
+	}
+
+	tests := []struct {
+		name          string
+		checker       TokenChecker
+		method, token string
+		code          codes.Code
+		authenticated bool
+	}{
+		{name: "guest on public method", method: public, code: codes.OK},
+		{name: "guest on private method", method: private, code: codes.Unauthenticated},
+		{name: "bearer token", method: private, token: "Bearer " + token, code: codes.OK, authenticated: true},
+		{name: "token on public method", method: public, token: token, code: codes.OK, authenticated: true},
+		{name: "invalid token on public method", method: public, token: "Bearer invalid", code: codes.Unauthenticated},
+		{name: "mfa token", method: private, token: "Bearer " + mfa, code: codes.Unauthenticated},
+		{name: "revoked token", checker: revokedChecker{}, method: private, token: "Bearer " + token, code: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := call(tt.checker, tt.method, tt.token)
+			if status.Code(err) != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", status.Code(err), tt.code, err)
+			}
+			if (claims != nil) != tt.authenticated || claims != nil && claims.UserID != 7 {
+				t.Errorf("claims = %+v, authenticated = %v", claims, tt.authenticated)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyKeyPrefix   = "idempotency:"
+	idempotencyMaxKeyLen   = 128
+	idempotencyLockTTL     = 30 * time.Second       // 处理中记录的存活时间, 处理期间定期续期, 进程退出后到期释放
+	idempotencyLockRefresh = idempotencyLockTTL / 3 // 处理中记录的续期间隔
+	idempotencyWaitTimeout = 10 * time.Second       // 并发重复请求等待首个请求完成的最长时间
+	idempotencyPollDelay   = 50 * time.Millisecond  // 等待期间的轮询间隔
+)
+
+// refreshIdempotencyLockScript 仍由本请求持有时延长处理中记录的有效期
+var refreshIdempotencyLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseIdempotencyLockScript 仍由本请求持有时删除处理中记录
+var releaseIdempotencyLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// idempotencyRecord 幂等键对应的请求指纹及首次响应
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Owner       string `json:"owner,omitempty"` // 处理中记录的持有者, 用于续期和释放
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// responseRecorder 在写出响应的同时记录响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 基于 Redis 的幂等中间件, 用于下单、支付等修改类接口.
+// 携带 Idempotency-Key 的请求: 首次请求正常执行并保存响应; 相同请求体的重试直接重放首次响应;
+// 请求体不同的重试返回 422; 首次请求尚未完成时, 重复请求会阻塞等待其结果而不是重复执行.
+// 未携带 Idempotency-Key 的请求不受影响. 需放在 JwtAuth 之后, 幂等键按用户隔离, 未登录的请求被拒绝.
+func Idempotency(rdb *redis.Client, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyMaxKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"code": http.StatusBadRequest,
+				"msg":  "idempotency key is too long",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"code": http.StatusBadRequest,
+				"msg":  "invalid request body",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		redisKey, ok := idempotencyRedisKey(c, key)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code": http.StatusUnauthorized,
+				"msg":  "invalid token claims",
+			})
+			return
+		}
+		fingerprint := idempotencyFingerprint(c, body)
+		lock, err := json.Marshal(&idempotencyRecord{Fingerprint: fingerprint, Owner: uuid.NewString()})
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		deadline := time.Now().Add(idempotencyWaitTimeout)
+		for {
+			acquired, err := rdb.SetNX(ctx, redisKey, lock, idempotencyLockTTL).Result()
+			if err != nil {
+				log.RedisLogger.Errorf("idempotency lock failed, err: %v", err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+					"code": http.StatusServiceUnavailable,
+					"msg":  "idempotency store unavailable",
+				})
+				return
+			}
+			if acquired {
+				break
+			}
+
+			record, err := loadIdempotencyRecord(c, rdb, redisKey)
+			if err != nil && !errors.Is(err, redis.Nil) {
+				log.RedisLogger.Errorf("idempotency load failed, err: %v", err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+					"code": http.StatusServiceUnavailable,
+					"msg":  "idempotency store unavailable",
+				})
+				return
+			}
+			if record != nil {
+				if record.Fingerprint != fingerprint {
+					c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+						"code": http.StatusUnprocessableEntity,
+						"msg":  "idempotency key was used with a different request",
+					})
+					return
+				}
+				if record.Done {
+					c.Header(IdempotencyReplayedHeader, "true")
+					c.Data(record.Status, record.ContentType, record.Body)
+					c.Abort()
+					return
+				}
+			}
+
+			// 首个请求仍在处理中, 等待其完成; 若记录消失(首个请求失败)则重新尝试获取
+			if time.Now().After(deadline) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"code": http.StatusConflict,
+					"msg":  "request with the same idempotency key is in progress",
+				})
+				return
+			}
+			select {
+			case <-ctx.Done():
+				c.Abort()
+				return
+			case <-time.After(idempotencyPollDelay):
+			}
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+
+		completed := false
+		defer func() {
+			// 服务端错误或处理过程中 panic 时释放幂等键, 允许客户端重试
+			if !completed {
+				if err := releaseIdempotencyLockScript.Run(context.Background(), rdb, []string{redisKey}, lock).Err(); err != nil {
+					log.RedisLogger.Errorf("idempotency release failed, err: %v", err)
+				}
+			}
+		}()
+
+		// 处理时间超过记录有效期时重复请求会被再次执行, 处理期间定期续期
+		stop := keepIdempotencyLock(rdb, redisKey, lock)
+		defer stop()
+
+		c.Next()
+		stop()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		record := &idempotencyRecord{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		if err = rdb.Set(context.Background(), redisKey, data, ttl).Err(); err != nil {
+			log.RedisLogger.Errorf("idempotency save failed, err: %v", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// idempotencyRedisKey 幂等键按用户、方法和路径隔离, 请求未携带登录信息时返回 false
+func idempotencyRedisKey(c *gin.Context, key string) (string, bool) {
+	claims, _ := c.Get("claims")
+	customClaims, ok := claims.(*appjwt.CustomClaims)
+	if !ok {
+		return "", false
+	}
+	subject := fmt.Sprintf("%d:%d", customClaims.Roles, customClaims.UserID)
+	sum := sha256.Sum256([]byte(subject + "|" + c.Request.Method + "|" + c.Request.URL.Path + "|" + key))
+	return idempotencyKeyPrefix + hex.EncodeToString(sum[:]), true
+}
+
+// idempotencyFingerprint 请求指纹, 由方法、路径、查询参数和请求体组成
+func idempotencyFingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + "|" + c.Request.URL.Path + "|" + c.Request.URL.RawQuery + "|"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// keepIdempotencyLock 定期延长处理中记录的有效期, 返回的 stop 可重复调用
+func keepIdempotencyLock(rdb *redis.Client, redisKey string, lock []byte) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(idempotencyLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := refreshIdempotencyLockScript.Run(context.Background(), rdb, []string{redisKey}, lock, idempotencyLockTTL.Milliseconds()).Err()
+				if err != nil {
+					log.RedisLogger.Errorf("idempotency refresh failed, err: %v", err)
+				}
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func loadIdempotencyRecord(c *gin.Context, rdb *redis.Client, redisKey string) (*idempotencyRecord, error) {
+	data, err := rdb.Get(c.Request.Context(), redisKey).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var record = &idempotencyRecord{}
+	if err = json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
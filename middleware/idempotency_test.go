@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	_const "github.com/star-find-cloud/star-mall/const"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newIdempotencyRouter(t *testing.T, handler gin.HandlerFunc) *gin.Engine {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "none" {
+			c.Set("claims", &appjwt.CustomClaims{UserID: 7, Roles: _const.UserRole})
+		}
+	})
+	r.PUT("/order/create", Idempotency(rdb, time.Hour), handler)
+	return r
+}
+
+func doIdempotentRequest(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/order/create", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	var calls int32
+	r := newIdempotencyRouter(t, func(c *gin.Context) {
+		n := atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusOK, gin.H{"call": n})
+	})
+
+	first := doIdempotentRequest(r, "k1", `{"product_id":1}`)
+	second := doIdempotentRequest(r, "k1", `{"product_id":1}`)
+
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("replayed response = %d %s, want %d %s", second.Code, second.Body, first.Code, first.Body)
+	}
+	if second.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Error("replayed response should carry Idempotent-Replayed header")
+	}
+}
+
+func TestIdempotency_RequiresClaims(t *testing.T) {
+	var calls int32
+	r := newIdempotencyRouter(t, func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/order/create", strings.NewReader(`{}`))
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	req.Header.Set("Authorization", "none")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || calls != 0 {
+		t.Errorf("status = %d, calls = %d; want 401 without calling the handler", w.Code, calls)
+	}
+}
+
+func TestIdempotency_DifferentBody(t *testing.T) {
+	r := newIdempotencyRouter(t, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	doIdempotentRequest(r, "k1", `{"product_id":1}`)
+	w := doIdempotentRequest(r, "k1", `{"product_id":2}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", w.Code)
+	}
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	var calls int32
+	r := newIdempotencyRouter(t, func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	doIdempotentRequest(r, "k1", `{}`)
+	w := doIdempotentRequest(r, "k1", `{}`)
+	if calls != 2 || w.Code != http.StatusOK {
+		t.Errorf("calls = %d, status = %d; want retry after server error", calls, w.Code)
+	}
+}
+
+func TestIdempotency_ConcurrentDuplicates(t *testing.T) {
+	var calls int32
+	r := newIdempotencyRouter(t, func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(200 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"id": 42})
+	})
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = doIdempotentRequest(r, "k1", `{}`)
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	for _, w := range results {
+		if w.Code != http.StatusOK || w.Body.String() != `{"id":42}` {
+			t.Errorf("response = %d %s, want 200 {\"id\":42}", w.Code, w.Body)
+		}
+	}
+}
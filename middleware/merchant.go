@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"net/http"
+)
+
+// MerchantChecker 检查商家是否已通过审核
+type MerchantChecker interface {
+	CheckApproved(ctx context.Context, userID int64) error
+}
+
+// MerchantApproved 拒绝未通过审核(待审核、已驳回)的商家 token, 其他角色直接放行.
+// 需放在 JwtAuth 之后, checker 为 nil 时不做检查
+func MerchantApproved(checker MerchantChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		customClaims, ok := claims.(*appjwt.CustomClaims)
+		if checker == nil || !ok || !customClaims.Actor().IsMerchant() {
+			c.Next()
+			return
+		}
+
+		if err := checker.CheckApproved(c.Request.Context(), customClaims.UserID); err != nil {
+			if errors.Is(err, domain.ErrMerchantNotApproved) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"code": http.StatusForbidden,
+					"msg":  "merchant is not approved",
+				})
+				return
+			}
+			log.AppLogger.Errorf("check merchant status failed, err: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"code": http.StatusServiceUnavailable,
+				"msg":  "merchant store unavailable",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeMerchants 按用户ID返回审核结果, 未列出的用户视为待审核
+type fakeMerchants map[int64]error
+
+func (f fakeMerchants) CheckApproved(ctx context.Context, userID int64) error {
+	if err, ok := f[userID]; ok {
+		return err
+	}
+	return domain.ErrMerchantNotApproved
+}
+
+func TestMerchantApproved(t *testing.T) {
+	checker := fakeMerchants{1: nil, 3: errors.New("connection refused")}
+	tests := []struct {
+		name   string
+		claims *appjwt.CustomClaims
+		code   int
+	}{
+		{name: "approved merchant", claims: &appjwt.CustomClaims{UserID: 1, Roles: _const.MerchantRole}, code: http.StatusOK},
+		{name: "pending merchant", claims: &appjwt.CustomClaims{UserID: 2, Roles: _const.MerchantRole}, code: http.StatusForbidden},
+		{name: "store unavailable", claims: &appjwt.CustomClaims{UserID: 3, Roles: _const.MerchantRole}, code: http.StatusServiceUnavailable},
+		{name: "user", claims: &appjwt.CustomClaims{UserID: 2, Roles: _const.UserRole}, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(func(c *gin.Context) { c.Set("claims", tt.claims) }, MerchantApproved(checker))
+			r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.code {
+				t.Errorf("code = %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"net/http"
+	"path"
+)
+
+// PermissionChecker 判断身份是否拥有某个路由的访问权限
+type PermissionChecker interface {
+	Authorize(ctx context.Context, actor domain.Actor, method, pattern string) (bool, error)
+}
+
+// routePatternKey 请求上下文中保存路由模板的键
+const routePatternKey = "routePattern"
+
+// PermissionGroup 注册需要按角色权限访问的路由. gin v1.4 无法在请求中取得匹配的路由模板,
+// 因此在注册路由时登记模板, 请求时先按 HTTP 方法 + 路由模板校验权限, 再执行 middlewares 和 handlers
+type PermissionGroup struct {
+	group       *gin.RouterGroup
+	checker     PermissionChecker
+	middlewares []gin.HandlerFunc
+}
+
+// NewPermissionGroup 在 group 上注册路由, group 需已使用 JwtAuth
+func NewPermissionGroup(group *gin.RouterGroup, checker PermissionChecker, middlewares ...gin.HandlerFunc) *PermissionGroup {
+	return &PermissionGroup{group: group, checker: checker, middlewares: middlewares}
+}
+
+func (g *PermissionGroup) Handle(method, relativePath string, handlers ...gin.HandlerFunc) {
+	pattern := path.Join(g.group.BasePath(), relativePath)
+	chain := make([]gin.HandlerFunc, 0, 1+len(g.middlewares)+len(handlers))
+	chain = append(chain, RBAC(g.checker, pattern))
+	chain = append(chain, g.middlewares...)
+	g.group.Handle(method, relativePath, append(chain, handlers...)...)
+}
+
+func (g *PermissionGroup) GET(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (g *PermissionGroup) POST(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (g *PermissionGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (g *PermissionGroup) PATCH(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+func (g *PermissionGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+// RBAC 基于角色的访问控制, 按 HTTP 方法 + 路由模板(如 /api/v1/admin/role/delete/:id)校验调用方的角色权限.
+// pattern 为注册路由时的完整路径, 通常通过 PermissionGroup 注册. 需放在 JwtAuth 之后
+func RBAC(checker PermissionChecker, pattern string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(routePatternKey, pattern)
+		claims, exists := c.Get("claims")
+		customClaims, ok := claims.(*appjwt.CustomClaims)
+		if !exists || !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code": http.StatusUnauthorized,
+				"msg":  "invalid token claims",
+			})
+			return
+		}
+
+		allowed, err := checker.Authorize(c.Request.Context(), customClaims.Actor(), c.Request.Method, pattern)
+		if err != nil {
+			log.AppLogger.Errorf("rbac authorize failed, err: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"code": http.StatusServiceUnavailable,
+				"msg":  "permission store unavailable",
+			})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"code": http.StatusForbidden,
+				"msg":  "permission denied",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// routePattern 返回 RBAC 登记的路由模板, 未登记时返回请求路径
+func routePattern(c *gin.Context) string {
+	if pattern := c.GetString(routePatternKey); pattern != "" {
+		return pattern
+	}
+	return c.Request.URL.Path
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeChecker 按 角色 -> 权限匹配键 授权
+type fakeChecker map[int64][]string
+
+func (f fakeChecker) Authorize(ctx context.Context, actor domain.Actor, method, pattern string) (bool, error) {
+	for _, key := range f[actor.Role] {
+		if key == domain.PermissionKey(method, pattern) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newRBACRouter(checker PermissionChecker, claims *appjwt.CustomClaims) (*gin.Engine, *PermissionGroup) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if claims != nil {
+			c.Set("claims", claims)
+		}
+	})
+	return r, NewPermissionGroup(r.Group("/api/v1"), checker)
+}
+
+func TestPermissionGroup(t *testing.T) {
+	checker := fakeChecker{_const.AdminRole: {
+		"GET /api/v1/admin/role/list",
+		"DELETE /api/v1/admin/role/delete/:id",
+		"GET /api/v1/shop/:module/:id/detail",
+		"GET /api/v1/static/*filepath",
+	}}
+	r, group := newRBACRouter(checker, &appjwt.CustomClaims{UserID: 1, Roles: _const.AdminRole})
+	ok := func(c *gin.Context) { c.String(http.StatusOK, routePattern(c)) }
+	group.GET("/admin/role/list", ok)
+	group.DELETE("/admin/role/delete/:id", ok)
+	group.GET("/shop/:module/:id/detail", ok)
+	group.GET("/static/*filepath", ok)
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/api/v1/admin/role/list", "/api/v1/admin/role/list"},
+		{http.MethodDelete, "/api/v1/admin/role/delete/12", "/api/v1/admin/role/delete/:id"},
+		// 参数值与路径中其他段相同时也使用登记的模板
+		{http.MethodGet, "/api/v1/shop/user/user/detail", "/api/v1/shop/:module/:id/detail"},
+		{http.MethodGet, "/api/v1/static/css/app.css", "/api/v1/static/*filepath"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("%s %s = %d %s, want 200 %s", tt.method, tt.path, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+func TestRBAC(t *testing.T) {
+	checker := fakeChecker{_const.AdminRole: {"DELETE /api/v1/admin/role/delete/:id"}}
+
+	tests := []struct {
+		name   string
+		claims *appjwt.CustomClaims
+		method string
+		want   int
+	}{
+		{"granted", &appjwt.CustomClaims{UserID: 1, Roles: _const.AdminRole}, http.MethodDelete, http.StatusOK},
+		{"other role", &appjwt.CustomClaims{UserID: 1, Roles: _const.MerchantRole}, http.MethodDelete, http.StatusForbidden},
+		{"other method", &appjwt.CustomClaims{UserID: 1, Roles: _const.AdminRole}, http.MethodGet, http.StatusForbidden},
+		{"no claims", nil, http.MethodDelete, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, group := newRBACRouter(checker, tt.claims)
+			group.Handle(tt.method, "/admin/role/delete/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, "/api/v1/admin/role/delete/3", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package imageproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+)
+
+// ErrWebPUnavailable 未找到 cwebp, 无法生成 WebP
+var ErrWebPUnavailable = errors.New("imageproc: cwebp is not available")
+
+// Encoder 将图片编码为指定格式. 标准库只能解码 WebP, 编码 WebP 调用 libwebp 的 cwebp 命令
+type Encoder struct {
+	Quality int    // JPEG 和 WebP 的压缩质量 1-100
+	CWebP   string // cwebp 可执行文件路径, 为空时从 PATH 查找
+}
+
+// FormatFor 不透明的图片使用 JPEG 压缩, 带透明度的图片使用 PNG 保留透明通道
+func FormatFor(img *image.RGBA) Format {
+	if img.Opaque() {
+		return JPEG
+	}
+	return PNG
+}
+
+func (e Encoder) Encode(ctx context.Context, w io.Writer, img image.Image, f Format) error {
+	switch f {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: e.quality()})
+	case PNG:
+		return (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(w, img)
+	case WebP:
+		return e.encodeWebP(ctx, w, img)
+	}
+	return fmt.Errorf("imageproc: unsupported format %q", f)
+}
+
+func (e Encoder) quality() int {
+	if e.Quality <= 0 || e.Quality > 100 {
+		return 82
+	}
+	return e.Quality
+}
+
+// encodeWebP 以无损 PNG 作为 cwebp 的输入, -metadata none 保证不写入任何元数据
+func (e Encoder) encodeWebP(ctx context.Context, w io.Writer, img image.Image) error {
+	name := e.CWebP
+	if name == "" {
+		name = "cwebp"
+	}
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebPUnavailable, err)
+	}
+
+	dir, err := os.MkdirTemp("", "imageproc-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out.webp")
+	f, err := os.Create(in)
+	if err != nil {
+		return err
+	}
+	err = (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, bin, "-quiet", "-metadata", "none", "-q", strconv.Itoa(e.quality()), in, "-o", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("imageproc: cwebp: %v: %s", err, output)
+	}
+	result, err := os.Open(out)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	_, err = io.Copy(w, result)
+	return err
+}
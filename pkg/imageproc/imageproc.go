@@ -0,0 +1,125 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// MaxPixels 解码图片的最大像素数, 防止解压炸弹耗尽内存
+const MaxPixels = 50_000_000
+
+// ErrTooLarge 图片像素数超过 MaxPixels
+var ErrTooLarge = errors.New("imageproc: image too large")
+
+// Decode 解码 JPEG、PNG 或 GIF 图片, 按 EXIF 方向旋转. 返回的图片不含任何元数据
+func Decode(r io.Reader) (*image.RGBA, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("imageproc: decode config: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("imageproc: decode %s: %w", format, err)
+	}
+	rgba := toRGBA(img)
+	if format == "jpeg" {
+		rgba = orient(rgba, jpegOrientation(data))
+	}
+	return rgba, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// orient 按 EXIF Orientation(1-8) 变换图片, 使其按正常方向显示
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = w-1-x, y
+			case 3: // 旋转 180 度
+				sx, sy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				sx, sy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				sx, sy = y, x
+			case 6: // 顺时针旋转 90 度
+				sx, sy = y, h-1-x
+			case 7: // 沿副对角线翻转
+				sx, sy = w-1-y, h-1-x
+			case 8: // 逆时针旋转 90 度
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// Resize 按宽度等比缩小图片, 每个像素取覆盖区域的平均值. 图片不宽于 width 时原样返回, 不会放大
+func Resize(src *image.RGBA, width int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if width <= 0 || width >= w {
+		return src
+	}
+	dw := width
+	dh := max((h*dw+w/2)/w, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		sy0 := dy * h / dh
+		sy1 := max((dy+1)*h/dh, sy0+1)
+		for dx := 0; dx < dw; dx++ {
+			sx0 := dx * w / dw
+			sx1 := max((dx+1)*w/dw, sx0+1)
+			var sum [4]int
+			for sy := sy0; sy < sy1; sy++ {
+				i := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := (sy1 - sy0) * (sx1 - sx0)
+			i := dst.PixOffset(dx, dy)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,133 @@
+package imageproc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// halves 左半边红色, 右半边蓝色
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation 在 SOI 之后插入只包含 Orientation 的 Exif 段
+func withOrientation(t *testing.T, img image.Image, orientation byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00" + string(orientation) + "\x00\x00\x00\x00\x00\x00")
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xFF, 0xE1, byte((len(app1) + 2) >> 8), byte(len(app1) + 2)}, app1...)
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func isRed(c color.RGBA) bool  { return c.R > 200 && c.B < 60 }
+func isBlue(c color.RGBA) bool { return c.B > 200 && c.R < 60 }
+
+func TestDecode_Orientation(t *testing.T) {
+	data := withOrientation(t, halves(32, 16), 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation = %d, want 6", got)
+	}
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 顺时针旋转 90 度后左半边到了上方
+	if img.Rect.Dx() != 16 || img.Rect.Dy() != 32 {
+		t.Fatalf("size = %v, want 16x32", img.Rect.Size())
+	}
+	if top, bottom := img.RGBAAt(8, 4), img.RGBAAt(8, 28); !isRed(top) || !isBlue(bottom) {
+		t.Errorf("top = %v, bottom = %v, want red over blue", top, bottom)
+	}
+
+	// 所有方向变换都是可逆的像素重排
+	src := halves(4, 2)
+	src.SetRGBA(0, 0, color.RGBA{G: 255, A: 255})
+	for o, want := range map[int]image.Point{1: {0, 0}, 2: {3, 0}, 3: {3, 1}, 4: {0, 1}, 5: {0, 0}, 6: {1, 0}, 7: {1, 3}, 8: {0, 3}} {
+		if got := orient(src, o); got.RGBAAt(want.X, want.Y).G != 255 {
+			t.Errorf("orientation %d: top-left pixel not at %v", o, want)
+		}
+	}
+
+	// 不带 Exif 的 JPEG 和 PNG 不旋转
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, halves(32, 16))
+	if img, err = Decode(&buf); err != nil || img.Rect.Dx() != 32 {
+		t.Errorf("png decode = %v, %v", img.Rect, err)
+	}
+	if _, err = Decode(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("Decode accepted invalid data")
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := halves(400, 200)
+	got := Resize(src, 100)
+	if got.Rect.Dx() != 100 || got.Rect.Dy() != 50 {
+		t.Fatalf("size = %v, want 100x50", got.Rect.Size())
+	}
+	if !isRed(got.RGBAAt(10, 25)) || !isBlue(got.RGBAAt(90, 25)) {
+		t.Errorf("colors not preserved: %v %v", got.RGBAAt(10, 25), got.RGBAAt(90, 25))
+	}
+	if Resize(src, 800) != src {
+		t.Error("Resize enlarged the image")
+	}
+
+	// 缩小时取平均值
+	pair := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	pair.SetRGBA(1, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	pair.SetRGBA(0, 0, color.RGBA{A: 255})
+	if c := Resize(pair, 1).RGBAAt(0, 0); c.R != 128 || c.A != 255 {
+		t.Errorf("average = %v, want gray", c)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	ctx := context.Background()
+	img := halves(8, 8)
+	if FormatFor(img) != JPEG {
+		t.Error("opaque image should be JPEG")
+	}
+	img.SetRGBA(0, 0, color.RGBA{})
+	if FormatFor(img) != PNG {
+		t.Error("transparent image should be PNG")
+	}
+
+	var buf bytes.Buffer
+	if err := (Encoder{CWebP: filepath.Join(t.TempDir(), "cwebp")}).Encode(ctx, &buf, img, WebP); !errors.Is(err, ErrWebPUnavailable) {
+		t.Errorf("Encode webp without cwebp err = %v, want %v", err, ErrWebPUnavailable)
+	}
+
+	// 用脚本代替 cwebp, 检查输入输出文件的传递
+	script := filepath.Join(t.TempDir(), "cwebp")
+	body := "#!/bin/sh\nwhile [ $# -gt 0 ]; do if [ \"$1\" = -o ]; then printf 'RIFF' > \"$2\"; fi; shift; done\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := (Encoder{CWebP: script}).Encode(ctx, &buf, img, WebP); err != nil || buf.String() != "RIFF" {
+		t.Errorf("Encode webp = %q, %v", buf.String(), err)
+	}
+}
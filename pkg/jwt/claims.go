@@ -1,10 +1,31 @@
 package jwt
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
 
 type CustomClaims struct {
 	UserID   int64
 	UserName string
 	Roles    int64
+	// SessionID 登录会话ID, 与刷新 token 同属一个会话; 临时 token 没有会话
+	SessionID string `json:"sid,omitempty"`
+	// Purpose 特殊用途的 token, 如两步验证中间凭证, 不能作为访问 token 使用
+	Purpose string `json:"pur,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// TTL token 剩余有效期
+func (c *CustomClaims) TTL() time.Duration {
+	if c.ExpiresAt == nil {
+		return 0
+	}
+	return max(time.Until(c.ExpiresAt.Time), 0)
+}
+
+// Actor 将 claims 转换为 service 层使用的身份
+func (c *CustomClaims) Actor() domain.Actor {
+	return domain.Actor{ID: c.UserID, Role: c.Roles}
+}
@@ -1,63 +1,73 @@
 package jwt
 
 import (
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/google/uuid"
 	"time"
 )
 
 const (
-	TokenExpireDuration = 6 * time.Hour
+	// TokenExpireDuration 访问 token 有效期, 过期后使用刷新 token 换取新的访问 token
+	TokenExpireDuration = 30 * time.Minute
+	// RefreshTokenExpireDuration 刷新 token 有效期, 每次刷新后重新计算
+	RefreshTokenExpireDuration = 7 * 24 * time.Hour
+	// MFATokenExpireDuration 两步验证中间凭证有效期
+	MFATokenExpireDuration = 5 * time.Minute
+
+	issuer = "star-Mall"
+
+	// PurposeMFA 密码校验通过、等待两步验证的中间凭证
+	PurposeMFA = "mfa"
 )
 
-var secretKey = conf.GetConfig().App.JWTSecret
+// GenerateSessionToken 生成属于登录会话 sessionID 的访问 token, 会话被注销后 token 随之失效.
+// 访问 token 只能通过该函数生成, 没有会话的访问 token 无法批量吊销, 校验时会被拒绝
+func GenerateSessionToken(userID int64, username string, roles int64, sessionID string) (string, error) {
+	return newToken(userID, username, roles, sessionID, "", TokenExpireDuration)
+}
 
-// 生成 jwt
-func GenerateToken(userID int64, username string, roles int64) (string, error) {
-	// 创建自定义的 claims 对象
-	claims := CustomClaims{
-		UserID:   userID,
-		UserName: username,
-		Roles:    roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			// 设置过期时间为一周后
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(168 * time.Hour)),
-			Issuer:    "star-Mall",
-		},
-	}
-	// 创建token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// 返回签名后的token
-	return token.SignedString([]byte(secretKey))
+// GenerateMFAToken 生成两步验证使用的临时 jwt, 不属于任何会话, 只能用于换取正式会话, 可通过 jti 黑名单注销
+func GenerateMFAToken(userID int64, username string, roles int64) (string, error) {
+	return newToken(userID, username, roles, "", PurposeMFA, MFATokenExpireDuration)
 }
 
-// 生成临时 jwt
-func GenerateTempToken(userID int64, username string, roles int64) (string, error) {
-	// 创建自定义的 claims 对象
+func newToken(userID int64, username string, roles int64, sessionID, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	// 创建自定义的 claims 对象, 每个 token 都有唯一的 jti, 用于注销
 	claims := CustomClaims{
-		UserID:   userID,
-		UserName: username,
-		Roles:    roles,
+		UserID:    userID,
+		UserName:  username,
+		Roles:     roles,
+		SessionID: sessionID,
+		Purpose:   purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
-			// 设置过期时间
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
-			Issuer:    "star-Mall",
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			Issuer:    issuer,
 		},
 	}
-	// 创建token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// 返回签名后的token
-	return token.SignedString([]byte(secretKey))
+	keys, err := Keys()
+	if err != nil {
+		return "", err
+	}
+	// 使用当前密钥签名
+	return keys.Sign(claims)
 }
 
-// 解析token
+// 解析token, 按 kid 选择验证密钥, 拒绝未知的密钥和签名算法
 func ParseToken(tokenStr string) (*CustomClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &CustomClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+	token, err := keys.Parse(tokenStr, &CustomClaims{})
+	if err != nil {
+		return nil, err
+	}
 	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
 		return claims, nil
-	} else {
-		return nil, err
 	}
+	return nil, errors.New("invalid token")
 }
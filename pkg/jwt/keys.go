@@ -0,0 +1,232 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/conf"
+	"math/big"
+	"os"
+	"sync"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrUnexpectedMethod = errors.New("unexpected signing method")
+)
+
+// signingKey 一个签名密钥, 只配置公钥的密钥只能用于验证
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySet 按 kid 管理的一组签名密钥, active 用于签发新 token, 其余密钥只用于验证
+type KeySet struct {
+	active  *signingKey
+	keys    map[string]*signingKey
+	methods []string
+}
+
+// NewKeySet 根据配置加载密钥. 未配置密钥时退化为使用 secret 的 HS256 签名
+func NewKeySet(c conf.JWTConf, secret string) (*KeySet, error) {
+	if len(c.Keys) == 0 {
+		if secret == "" {
+			return nil, errors.New("jwt: neither signing keys nor secret configured")
+		}
+		key := &signingKey{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+		return &KeySet{
+			active:  key,
+			keys:    map[string]*signingKey{"": key},
+			methods: []string{jwt.SigningMethodHS256.Alg()},
+		}, nil
+	}
+
+	ks := &KeySet{keys: make(map[string]*signingKey, len(c.Keys))}
+	seen := make(map[string]bool)
+	for _, kc := range c.Keys {
+		if kc.KID == "" {
+			return nil, errors.New("jwt: key without kid")
+		}
+		if _, ok := ks.keys[kc.KID]; ok {
+			return nil, fmt.Errorf("jwt: duplicate kid %s", kc.KID)
+		}
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: load key %s: %w", kc.KID, err)
+		}
+		ks.keys[kc.KID] = key
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			ks.methods = append(ks.methods, alg)
+		}
+	}
+
+	active, ok := ks.keys[c.ActiveKID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: active kid %q not found", c.ActiveKID)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("jwt: active key %s has no private key", c.ActiveKID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+func loadKey(c conf.JWTKeyConf) (*signingKey, error) {
+	privatePEM, err := readPEM(c.PrivateKey, c.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := readPEM(c.PublicKey, c.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if privatePEM == nil && publicPEM == nil {
+		return nil, errors.New("no key configured")
+	}
+
+	key := &signingKey{kid: c.KID}
+	switch c.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, &private.PublicKey
+		}
+		if publicPEM != nil {
+			if key.public, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	case jwt.SigningMethodEdDSA.Alg():
+		key.method = jwt.SigningMethodEdDSA
+		if privatePEM != nil {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, private.(ed25519.PrivateKey).Public()
+		}
+		if publicPEM != nil {
+			if key.public, err = jwt.ParseEdPublicKeyFromPEM(publicPEM); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", c.Algorithm)
+	}
+	return key, nil
+}
+
+// readPEM 优先使用配置中的 PEM 内容, 其次读取文件, 都未配置时返回 nil
+func readPEM(content, file string) ([]byte, error) {
+	if content != "" {
+		return []byte(content), nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(file)
+}
+
+// Sign 使用当前密钥签发 token, 非 HS256 的 token 头部带有 kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.kid != "" {
+		token.Header["kid"] = ks.active.kid
+	}
+	return token.SignedString(ks.active.private)
+}
+
+// Parse 按 token 头部的 kid 选择密钥验证签名, 签名算法必须与密钥一致
+func (ks *KeySet) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, ks.keyFunc, jwt.WithValidMethods(ks.methods))
+}
+
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedMethod, t.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK JSON Web Key, 只包含公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 导出全部非对称密钥的公钥, 供其他服务验证 token; HS256 密钥不会导出
+func (ks *KeySet) JWKS() JWKS {
+	var set = JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for kid, key := range ks.keys {
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Alg: key.method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Alg: key.method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+var (
+	defaultKeys     *KeySet
+	defaultKeysErr  error
+	defaultKeysOnce sync.Once
+)
+
+// SetKeySet 替换包级别使用的密钥, 应在启动时调用
+func SetKeySet(ks *KeySet) {
+	defaultKeysOnce.Do(func() {})
+	defaultKeys, defaultKeysErr = ks, nil
+}
+
+// Keys 返回包级别使用的密钥, 未调用 SetKeySet 时在首次使用时从配置加载
+func Keys() (*KeySet, error) {
+	defaultKeysOnce.Do(func() {
+		c := conf.GetConfig()
+		defaultKeys, defaultKeysErr = NewKeySet(c.JWT, c.App.JWTSecret)
+	})
+	return defaultKeys, defaultKeysErr
+}
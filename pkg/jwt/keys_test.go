@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/conf"
+	"testing"
+	"time"
+)
+
+func privatePEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func testClaims() *CustomClaims {
+	return &CustomClaims{
+		UserID: 1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaConf := conf.JWTKeyConf{KID: "old", Algorithm: "RS256", PrivateKey: privatePEM(t, rsaKey)}
+	edConf := conf.JWTKeyConf{KID: "new", Algorithm: "EdDSA", PrivateKey: privatePEM(t, edKey)}
+
+	before, err := NewKeySet(conf.JWTConf{ActiveKID: "old", Keys: []conf.JWTKeyConf{rsaConf}}, "")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	oldToken, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// 轮换: 新密钥签发, 旧密钥只保留公钥用于验证
+	rsaConf.PrivateKey, rsaConf.PublicKey = "", publicPEM(t, &rsaKey.PublicKey)
+	after, err := NewKeySet(conf.JWTConf{ActiveKID: "new", Keys: []conf.JWTKeyConf{rsaConf, edConf}}, "")
+	if err != nil {
+		t.Fatalf("NewKeySet after rotation: %v", err)
+	}
+	newToken, err := after.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		parsed, err := after.Parse(token, &CustomClaims{})
+		if err != nil {
+			t.Errorf("parse %s token: %v", name, err)
+			continue
+		}
+		if kid := parsed.Header["kid"]; kid != name {
+			t.Errorf("%s token kid = %v", name, kid)
+		}
+	}
+	if _, err = before.Parse(newToken, &CustomClaims{}); err == nil {
+		t.Error("token of a key not in the set was accepted")
+	}
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	unknown.Header["kid"] = "missing"
+	unknownStr, _ := unknown.SignedString(rsaKey)
+	if _, err = after.Parse(unknownStr, &CustomClaims{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("parse with unknown kid: err = %v, want ErrUnknownKey", err)
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("jwks has %d keys, want 2", len(jwks.Keys))
+	}
+	for _, k := range jwks.Keys {
+		if k.Kid == "new" && (k.Kty != "OKP" || k.Crv != "Ed25519" || len(k.X) == 0) {
+			t.Errorf("bad ed25519 jwk: %+v", k)
+		}
+		if k.Kid == "old" && (k.Kty != "RSA" || k.N == "" || k.E != "AQAB") {
+			t.Errorf("bad rsa jwk: %+v", k)
+		}
+	}
+
+	if _, err = NewKeySet(conf.JWTConf{ActiveKID: "old", Keys: []conf.JWTKeyConf{rsaConf}}, ""); err == nil {
+		t.Error("active key without private key should be rejected")
+	}
+}
+
+func TestKeySet_RejectsUnexpectedAlgorithm(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := publicPEM(t, &rsaKey.PublicKey)
+	ks, err := NewKeySet(conf.JWTConf{ActiveKID: "k1", Keys: []conf.JWTKeyConf{
+		{KID: "k1", Algorithm: "RS256", PrivateKey: privatePEM(t, rsaKey)},
+	}}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 以公钥作为 HMAC 密钥伪造的 token
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "k1"
+	forgedStr, _ := forged.SignedString([]byte(pub))
+	// 配置了非对称密钥后, 使用 App.JWTSecret 签名的 token 不再有效
+	legacyStr, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("secret"))
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+	none.Header["kid"] = "k1"
+	noneStr, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	for name, token := range map[string]string{"hs256 with public key": forgedStr, "legacy hs256": legacyStr, "none": noneStr} {
+		if _, err := ks.Parse(token, &CustomClaims{}); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
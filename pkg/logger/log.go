@@ -9,11 +9,12 @@ import (
 )
 
 var (
-	AppLogger   *zap.SugaredLogger // 主日志
-	MySQLLogger *zap.SugaredLogger // 数据库专用日志
-	HttpLogger  *zap.SugaredLogger
-	RedisLogger *zap.SugaredLogger
-	EtcdLogger  *zap.SugaredLogger
+	AppLogger      *zap.SugaredLogger // 主日志
+	MySQLLogger    *zap.SugaredLogger // 数据库专用日志
+	HttpLogger     *zap.SugaredLogger
+	RedisLogger    *zap.SugaredLogger
+	EtcdLogger     *zap.SugaredLogger
+	SecurityLogger *zap.SugaredLogger // 安全事件日志, 如登录失败锁定
 )
 
 func init() {
@@ -26,12 +27,14 @@ func init() {
 	httpCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConig), getLogWriter("http"), zap.DebugLevel)
 	redisCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConig), getLogWriter("redis"), zap.DebugLevel)
 	etcdCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConig), getLogWriter("etcd"), zap.DebugLevel)
+	securityCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConig), getLogWriter("security"), zap.DebugLevel)
 
 	AppLogger = zap.New(appCore, zap.AddCaller()).Sugar()
 	MySQLLogger = zap.New(dbCore, zap.AddCaller()).Sugar()
 	HttpLogger = zap.New(httpCore, zap.AddCaller()).Sugar()
 	RedisLogger = zap.New(redisCore, zap.AddCaller()).Sugar()
 	EtcdLogger = zap.New(etcdCore, zap.AddCaller()).Sugar()
+	SecurityLogger = zap.New(securityCore, zap.AddCaller()).Sugar()
 }
 
 func getLogWriter(model string) zapcore.WriteSyncer {
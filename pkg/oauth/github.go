@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	githubAuthURL     = "https://github.com/login/oauth/authorize"
+	githubTokenURL    = "https://github.com/login/oauth/access_token"
+	githubUserInfoURL = "https://api.github.com/user"
+)
+
+// GitHubProvider 标准 OAuth2 授权码流程, 通过用户信息接口获取账号, 不返回 id_token
+type GitHubProvider struct {
+	conf   conf.OAuthProviderConf
+	client *http.Client
+}
+
+func NewGitHubProvider(c conf.OAuthProviderConf, client *http.Client) *GitHubProvider {
+	if c.AuthURL == "" {
+		c.AuthURL = githubAuthURL
+	}
+	if c.TokenURL == "" {
+		c.TokenURL = githubTokenURL
+	}
+	if c.UserInfoURL == "" {
+		c.UserInfoURL = githubUserInfoURL
+	}
+	return &GitHubProvider{conf: c, client: client}
+}
+
+func (p *GitHubProvider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	return buildURL(p.conf.AuthURL, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.conf.ClientID},
+		"redirect_uri":          {p.conf.RedirectURL},
+		"scope":                 {scopes(p.conf, "read:user", "user:email")},
+		"state":                 {req.State},
+		"code_challenge":        {req.CodeChallenge()},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error) {
+	token, err := exchangeCode(ctx, p.client, p.conf, p.conf.TokenURL, code, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err = getJSON(ctx, p.client, p.conf.UserInfoURL, token.AccessToken, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("github user info has no id")
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+	// 公开邮箱未必经过验证, 不能用于匹配已有账号
+	return &Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Email:   user.Email,
+		Name:    name,
+		Avatar:  user.AvatarURL,
+	}, nil
+}
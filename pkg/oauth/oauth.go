@@ -0,0 +1,221 @@
+// Package oauth 实现第三方登录使用的 OAuth2 授权码流程, 支持 PKCE.
+// 每个提供方实现 Provider, 由 Registry 按配置中的名称管理
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownProvider = domain.ErrUnknownOAuthProvider
+	ErrInvalidIDToken  = errors.New("invalid id token")
+)
+
+// Identity 第三方账号信息, Subject 在同一提供方内唯一且不变
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Avatar        string
+}
+
+// AuthRequest 一次授权请求的参数, 回调时需要使用同一组参数完成换取
+type AuthRequest struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+}
+
+// NewAuthRequest 生成随机的 state, PKCE code_verifier 和 OIDC nonce
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	for _, dst := range []*string{&req.State, &req.CodeVerifier, &req.Nonce} {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return req, fmt.Errorf("failed to generate auth request: %w", err)
+		}
+		*dst = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return req, nil
+}
+
+// CodeChallenge 按 S256 方法计算 PKCE code_challenge
+func (r AuthRequest) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(r.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type Provider interface {
+	// AuthCodeURL 返回跳转到提供方授权页面的地址
+	AuthCodeURL(ctx context.Context, req AuthRequest) (string, error)
+
+	// Exchange 使用回调中的授权码换取 token 并获取账号信息
+	Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error)
+}
+
+// Registry 按名称管理已配置的提供方
+type Registry struct {
+	providers map[string]Provider
+	names     []string
+}
+
+// NewRegistry 根据配置创建全部提供方, client 为 nil 时使用 10 秒超时的默认客户端
+func NewRegistry(providers []conf.OAuthProviderConf, client *http.Client) (*Registry, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, c := range providers {
+		if c.Name == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("oauth provider %q: name and client_id are required", c.Name)
+		}
+		if _, ok := r.providers[c.Name]; ok {
+			return nil, fmt.Errorf("oauth provider %q: duplicate name", c.Name)
+		}
+		var p Provider
+		switch c.Type {
+		case "oidc":
+			if c.Issuer == "" {
+				return nil, fmt.Errorf("oauth provider %q: issuer is required", c.Name)
+			}
+			p = NewOIDCProvider(c, client)
+		case "github":
+			p = NewGitHubProvider(c, client)
+		case "wechat":
+			p = NewWeChatProvider(c, client)
+		default:
+			return nil, fmt.Errorf("oauth provider %q: unsupported type %q", c.Name, c.Type)
+		}
+		r.Register(c.Name, p)
+	}
+	return r, nil
+}
+
+// Register 注册提供方, 已存在时覆盖
+func (r *Registry) Register(name string, p Provider) {
+	if _, ok := r.providers[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.providers[name] = p
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names 按配置顺序返回提供方名称
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// tokenResponse 标准 OAuth2 token 响应
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode 以 client_secret_post 方式向 token 端点换取 token
+func exchangeCode(ctx context.Context, client *http.Client, c conf.OAuthProviderConf, tokenURL, code string, req AuthRequest) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.RedirectURL)
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+	form.Set("code_verifier", req.CodeVerifier)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token tokenResponse
+	if err = doJSON(client, httpReq, &token); err != nil && token.Error == "" {
+		return nil, err
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("oauth token error: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("oauth token response has no access_token")
+	}
+	return &token, nil
+}
+
+// getJSON 使用 access token 请求用户信息等接口
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, dst any) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if accessToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return doJSON(client, httpReq, dst)
+}
+
+// doJSON 发送请求并解析 JSON 响应, 非 2xx 时仍尝试解析以便读取错误信息
+func doJSON(client *http.Client, req *http.Request, dst any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oauth request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read oauth response: %w", err)
+	}
+	decodeErr := json.Unmarshal(body, dst)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("oauth request %s returned %d", req.URL.Path, resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to decode oauth response: %w", decodeErr)
+	}
+	return nil
+}
+
+// buildURL 在 base 上追加查询参数, 保留 base 中已有的参数
+func buildURL(base string, params url.Values) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", base, err)
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func scopes(c conf.OAuthProviderConf, defaults ...string) string {
+	if len(c.Scopes) > 0 {
+		return strings.Join(c.Scopes, " ")
+	}
+	return strings.Join(defaults, " ")
+}
@@ -0,0 +1,258 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/conf"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOIDCServer 本地 OIDC 提供方: 授权端点直接重定向回 redirect_uri, token 端点校验 PKCE 后签发 id_token
+type fakeOIDCServer struct {
+	*httptest.Server
+	t       *testing.T
+	key     *rsa.PrivateKey
+	signer  *rsa.PrivateKey // 用于签发 id_token 的密钥, 替换后可模拟伪造的 token
+	pending map[string]url.Values
+}
+
+func newFakeOIDCServer(t *testing.T) *fakeOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeOIDCServer{t: t, key: key, signer: key, pending: make(map[string]url.Values)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		code := "code-" + query.Get("state")
+		f.pending[code] = query
+		http.Redirect(w, r, query.Get("redirect_uri")+"?code="+code+"&state="+query.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOIDCServer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	auth, ok := f.pending[r.PostForm.Get("code")]
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+		fail("invalid_grant")
+		return
+	}
+	delete(f.pending, r.PostForm.Get("code"))
+	if r.PostForm.Get("client_id") != auth.Get("client_id") || r.PostForm.Get("client_secret") != "secret" ||
+		r.PostForm.Get("redirect_uri") != auth.Get("redirect_uri") {
+		fail("invalid_client")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if auth.Get("code_challenge_method") != "S256" || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") {
+		fail("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            "subject-1",
+		"aud":            auth.Get("client_id"),
+		"exp":            now.Add(time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	})
+	token.Header["kid"] = "k1"
+	idToken, err := token.SignedString(f.signer)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+// authorize 模拟浏览器访问授权地址, 返回回调中的 code
+func authorize(t *testing.T, authURL string, state string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("state") != state {
+		t.Fatalf("callback state = %q, want %q", location.Query().Get("state"), state)
+	}
+	return location.Query().Get("code")
+}
+
+func newTestOIDC(t *testing.T) (*fakeOIDCServer, Provider) {
+	server := newFakeOIDCServer(t)
+	registry, err := NewRegistry([]conf.OAuthProviderConf{{
+		Name:         "fake",
+		Type:         "oidc",
+		Issuer:       server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://mall.example.com/callback",
+	}}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := registry.Get("fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, p
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	_, p := newTestOIDC(t)
+	ctx := context.Background()
+
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL err = %v", err)
+	}
+	code := authorize(t, authURL, req.State)
+
+	identity, err := p.Exchange(ctx, code, req)
+	if err != nil {
+		t.Fatalf("Exchange err = %v", err)
+	}
+	if identity.Subject != "subject-1" || identity.Email != "alice@example.com" || !identity.EmailVerified || identity.Name != "Alice" {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	// 授权码只能使用一次
+	if _, err = p.Exchange(ctx, code, req); err == nil {
+		t.Error("code reused")
+	}
+}
+
+func TestOIDCProvider_Rejects(t *testing.T) {
+	server, p := newTestOIDC(t)
+	ctx := context.Background()
+
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		mutate func(req *AuthRequest)
+		signer *rsa.PrivateKey
+		want   error
+	}{
+		{"wrong code verifier", func(req *AuthRequest) { req.CodeVerifier = "other" }, server.key, nil},
+		{"nonce mismatch", func(req *AuthRequest) { req.Nonce = "other" }, server.key, ErrInvalidIDToken},
+		{"forged signature", func(req *AuthRequest) {}, forged, ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.signer = tt.signer
+			defer func() { server.signer = server.key }()
+
+			req, _ := NewAuthRequest()
+			authURL, err := p.AuthCodeURL(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := authorize(t, authURL, req.State)
+			tt.mutate(&req)
+
+			_, err = p.Exchange(ctx, code, req)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("Exchange err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubProvider_Exchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != "gh-code" || r.PostForm.Get("code_verifier") == "" {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": 42, "login": "octocat", "avatar_url": "https://avatars/42"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := NewGitHubProvider(conf.OAuthProviderConf{
+		ClientID:    "client",
+		AuthURL:     server.URL + "/login/oauth/authorize",
+		TokenURL:    server.URL + "/login/oauth/access_token",
+		UserInfoURL: server.URL + "/user",
+	}, server.Client())
+	req, _ := NewAuthRequest()
+
+	authURL, _ := p.AuthCodeURL(context.Background(), req)
+	if !strings.Contains(authURL, "code_challenge="+req.CodeChallenge()) {
+		t.Errorf("auth url %s has no code challenge", authURL)
+	}
+	identity, err := p.Exchange(context.Background(), "gh-code", req)
+	if err != nil {
+		t.Fatalf("Exchange err = %v", err)
+	}
+	if identity.Subject != "42" || identity.Name != "octocat" || identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+	if _, err = p.Exchange(context.Background(), "wrong", req); err == nil {
+		t.Error("invalid code accepted")
+	}
+}
@@ -0,0 +1,210 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/star-find-cloud/star-mall/conf"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// oidcMetadata 发现文档中用到的字段
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type idTokenClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"` // 部分提供方返回字符串 "true"
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// OIDCProvider 通过 OIDC 发现文档获取端点, 校验 id_token 的签名, 发行方, 受众和 nonce
+type OIDCProvider struct {
+	conf   conf.OAuthProviderConf
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *oidcMetadata
+	keys map[string]any
+}
+
+func NewOIDCProvider(c conf.OAuthProviderConf, client *http.Client) *OIDCProvider {
+	return &OIDCProvider{conf: c, client: client}
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	return buildURL(meta.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.conf.ClientID},
+		"redirect_uri":          {p.conf.RedirectURL},
+		"scope":                 {scopes(p.conf, "openid", "email", "profile")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {req.CodeChallenge()},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := exchangeCode(ctx, p.client, p.conf, meta.TokenEndpoint, code, req)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing id_token", ErrInvalidIDToken)
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(token.IDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.conf.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Nonce != req.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+		Avatar:        claims.Picture,
+	}, nil
+}
+
+// metadata 首次使用时获取发现文档, 配置中的端点优先
+func (p *OIDCProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	meta := &oidcMetadata{}
+	endpoint := strings.TrimSuffix(p.conf.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, p.client, endpoint, "", meta); err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider %s: %w", p.conf.Name, err)
+	}
+	// 发现文档中的 issuer 必须与配置一致, 防止被替换为其他发行方
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.conf.Issuer, "/") {
+		return nil, fmt.Errorf("oidc provider %s: issuer mismatch %q", p.conf.Name, meta.Issuer)
+	}
+	if p.conf.AuthURL != "" {
+		meta.AuthorizationEndpoint = p.conf.AuthURL
+	}
+	if p.conf.TokenURL != "" {
+		meta.TokenEndpoint = p.conf.TokenURL
+	}
+	p.meta = meta
+	return meta, nil
+}
+
+// key 按 kid 查找验证公钥, 找不到时重新获取一次 JWKS 以支持提供方轮换密钥
+func (p *OIDCProvider) key(ctx context.Context, meta *oidcMetadata, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, p.client, meta.JWKSURI, "", &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	p.keys = keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, errors.New("unsupported key type " + k.Kty)
+}
@@ -0,0 +1,119 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"net/http"
+	"net/url"
+)
+
+const (
+	wechatAuthURL     = "https://open.weixin.qq.com/connect/qrconnect"
+	wechatTokenURL    = "https://api.weixin.qq.com/sns/oauth2/access_token"
+	wechatUserInfoURL = "https://api.weixin.qq.com/sns/userinfo"
+)
+
+// WeChatProvider 微信网站应用扫码登录. 微信的参数名与标准 OAuth2 不同, 且不支持 PKCE, 只依赖 state 防止 CSRF
+type WeChatProvider struct {
+	conf   conf.OAuthProviderConf
+	client *http.Client
+}
+
+func NewWeChatProvider(c conf.OAuthProviderConf, client *http.Client) *WeChatProvider {
+	if c.AuthURL == "" {
+		c.AuthURL = wechatAuthURL
+	}
+	if c.TokenURL == "" {
+		c.TokenURL = wechatTokenURL
+	}
+	if c.UserInfoURL == "" {
+		c.UserInfoURL = wechatUserInfoURL
+	}
+	return &WeChatProvider{conf: c, client: client}
+}
+
+type wechatError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e wechatError) err() error {
+	if e.ErrCode == 0 {
+		return nil
+	}
+	return fmt.Errorf("wechat error %d: %s", e.ErrCode, e.ErrMsg)
+}
+
+func (p *WeChatProvider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	u, err := buildURL(p.conf.AuthURL, url.Values{
+		"appid":         {p.conf.ClientID},
+		"redirect_uri":  {p.conf.RedirectURL},
+		"response_type": {"code"},
+		"scope":         {scopes(p.conf, "snsapi_login")},
+		"state":         {req.State},
+	})
+	if err != nil {
+		return "", err
+	}
+	return u + "#wechat_redirect", nil
+}
+
+func (p *WeChatProvider) Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error) {
+	tokenURL, err := buildURL(p.conf.TokenURL, url.Values{
+		"appid":      {p.conf.ClientID},
+		"secret":     {p.conf.ClientSecret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var token struct {
+		wechatError
+		AccessToken string `json:"access_token"`
+		OpenID      string `json:"openid"`
+		UnionID     string `json:"unionid"`
+	}
+	if err = getJSON(ctx, p.client, tokenURL, "", &token); err != nil {
+		return nil, err
+	}
+	if err = token.err(); err != nil {
+		return nil, err
+	}
+
+	userURL, err := buildURL(p.conf.UserInfoURL, url.Values{
+		"access_token": {token.AccessToken},
+		"openid":       {token.OpenID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var user struct {
+		wechatError
+		OpenID     string `json:"openid"`
+		UnionID    string `json:"unionid"`
+		Nickname   string `json:"nickname"`
+		HeadImgURL string `json:"headimgurl"`
+	}
+	if err = getJSON(ctx, p.client, userURL, "", &user); err != nil {
+		return nil, err
+	}
+	if err = user.err(); err != nil {
+		return nil, err
+	}
+
+	// 同一开放平台下的应用共享 unionid, 优先使用
+	subject := token.UnionID
+	if subject == "" {
+		subject = user.UnionID
+	}
+	if subject == "" {
+		subject = token.OpenID
+	}
+	return &Identity{
+		Subject: subject,
+		Name:    user.Nickname,
+		Avatar:  user.HeadImgURL,
+	}, nil
+}
@@ -0,0 +1,83 @@
+package oss
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AliyunOSS 使用 OSS 的 URL 签名(Signature V1)生成预签名 URL
+type AliyunOSS struct {
+	bucket          string
+	accessKeyID     string
+	accessKeySecret string
+	endpoint        *url.URL
+	now             func() time.Time
+}
+
+func NewAliyunOSS(c conf.OSSConfig) (*AliyunOSS, error) {
+	if c.AliCloudOOS.Bucket == "" || c.AliCloudOOS.Endpoint == "" {
+		return nil, errors.New("oss: aliyun oss bucket and endpoint are required")
+	}
+	if c.OSSAccessKeyID == "" || c.OSSAccessKeySecret == "" {
+		return nil, errors.New("oss: aliyun oss access key id and secret are required")
+	}
+	endpoint := c.AliCloudOOS.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("oss: invalid aliyun oss endpoint %q", c.AliCloudOOS.Endpoint)
+	}
+	return &AliyunOSS{
+		bucket:          c.AliCloudOOS.Bucket,
+		accessKeyID:     c.OSSAccessKeyID,
+		accessKeySecret: c.OSSAccessKeySecret,
+		endpoint:        u,
+		now:             time.Now,
+	}, nil
+}
+
+// GeneratePresignedUploadURL 生成上传预签名URL, 上传时必须携带相同的 Content-Type
+func (o *AliyunOSS) GeneratePresignedUploadURL(ctx context.Context, filePath, ContentType string) (string, error) {
+	return o.presign(http.MethodPut, filePath, ContentType, uploadExpiry), nil
+}
+
+func (o *AliyunOSS) GeneratePresignedDownloadURL(ctx context.Context, filePath, ContentType string) (string, error) {
+	return o.presign(http.MethodGet, filePath, "", downloadExpiry), nil
+}
+
+func (o *AliyunOSS) GeneratePresignedDeleteURL(ctx context.Context, filePath, ContentType string) (string, error) {
+	return o.presign(http.MethodDelete, filePath, "", deleteExpiry), nil
+}
+
+// presign 签名内容为 VERB\nContent-MD5\nContent-Type\nExpires\n/bucket/key
+func (o *AliyunOSS) presign(method, key, contentType string, expiry time.Duration) string {
+	key = strings.TrimPrefix(key, "/")
+	expires := strconv.FormatInt(o.now().Add(expiry).Unix(), 10)
+	stringToSign := method + "\n\n" + contentType + "\n" + expires + "\n/" + o.bucket + "/" + key
+
+	h := hmac.New(sha1.New, []byte(o.accessKeySecret))
+	h.Write([]byte(stringToSign))
+	query := url.Values{
+		"OSSAccessKeyId": {o.accessKeyID},
+		"Expires":        {expires},
+		"Signature":      {base64.StdEncoding.EncodeToString(h.Sum(nil))},
+	}
+
+	u := *o.endpoint
+	u.Host = o.bucket + "." + u.Host
+	u.Path = "/" + key
+	u.RawQuery = query.Encode()
+	return u.String()
+}
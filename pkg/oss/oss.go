@@ -1,6 +1,19 @@
 package oss
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"sync"
+	"time"
+)
+
+// 预签名 URL 的有效期
+const (
+	uploadExpiry   = 30 * time.Minute
+	downloadExpiry = 1 * time.Hour
+	deleteExpiry   = 5 * time.Minute
+)
 
 type OSS interface {
 	// GeneratePresignedUploadURL 生成上传预签名URL
@@ -12,3 +25,58 @@ type OSS interface {
 	// GeneratePresignedDeleteURL 删除签名URL
 	GeneratePresignedDeleteURL(ctx context.Context, filePath, ContentType string) (string, error)
 }
+
+// New 根据配置的服务商创建对象存储客户端. 客户端在第一次生成预签名 URL 时才创建,
+// 服务商未配置或配置有误时不影响启动, 错误在使用时返回
+func New(c conf.OSSConfig) OSS {
+	return &lazyOSS{build: func() (OSS, error) {
+		switch c.Provider {
+		case "", "tencent":
+			return NewTencentCos(c)
+		case "aliyun":
+			return NewAliyunOSS(c)
+		case "s3", "minio":
+			return NewS3(c)
+		}
+		return nil, fmt.Errorf("oss: unsupported provider %q", c.Provider)
+	}}
+}
+
+// lazyOSS 第一次使用时创建客户端, 创建失败的错误会被缓存, 之后的调用直接返回该错误
+type lazyOSS struct {
+	once  sync.Once
+	build func() (OSS, error)
+	oss   OSS
+	err   error
+}
+
+func (l *lazyOSS) get() (OSS, error) {
+	l.once.Do(func() {
+		l.oss, l.err = l.build()
+	})
+	return l.oss, l.err
+}
+
+func (l *lazyOSS) GeneratePresignedUploadURL(ctx context.Context, filePath, ContentType string) (string, error) {
+	client, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return client.GeneratePresignedUploadURL(ctx, filePath, ContentType)
+}
+
+func (l *lazyOSS) GeneratePresignedDownloadURL(ctx context.Context, filePath, ContentType string) (string, error) {
+	client, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return client.GeneratePresignedDownloadURL(ctx, filePath, ContentType)
+}
+
+func (l *lazyOSS) GeneratePresignedDeleteURL(ctx context.Context, filePath, ContentType string) (string, error) {
+	client, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return client.GeneratePresignedDeleteURL(ctx, filePath, ContentType)
+}
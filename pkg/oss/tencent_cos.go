@@ -2,6 +2,7 @@ package oss
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/star-find-cloud/star-mall/conf"
 	"github.com/tencentyun/cos-go-sdk-v5"
@@ -11,31 +12,39 @@ import (
 )
 
 type TencentCos struct {
-	client *cos.Client
-	bucket string
+	client    *cos.Client
+	bucket    string
+	secretID  string
+	secretKey string
 }
 
-var tencentCos = &TencentCos{}
-
-func init() {
-	c := conf.GetConfig()
-	u, _ := url.Parse(fmt.Sprintf("https://%s.cos.%s.myqcloud.com", c.OSS.TencentCOS.Bucket, c.OSS.TencentCOS.Region))
+func NewTencentCos(c conf.OSSConfig) (*TencentCos, error) {
+	if c.TencentCOS.Bucket == "" || c.TencentCOS.Region == "" {
+		return nil, errors.New("oss: tencent cos bucket and region are required")
+	}
+	if c.OSSAccessKeyID == "" || c.OSSAccessKeySecret == "" {
+		return nil, errors.New("oss: tencent cos secret id and secret key are required")
+	}
+	u, err := url.Parse(fmt.Sprintf("https://%s.cos.%s.myqcloud.com", c.TencentCOS.Bucket, c.TencentCOS.Region))
+	if err != nil {
+		return nil, fmt.Errorf("oss: invalid tencent cos bucket or region: %w", err)
+	}
 	baseURL := &cos.BaseURL{BucketURL: u}
 
 	// 创建 腾讯云 cos 客户端
 	client := cos.NewClient(baseURL, &http.Client{
 		Timeout: 60 * time.Second,
 		Transport: &cos.AuthorizationTransport{
-			SecretID:  c.OSS.OSSAccessKeyID,
-			SecretKey: c.OSS.OSSAccessKeySecret,
+			SecretID:  c.OSSAccessKeyID,
+			SecretKey: c.OSSAccessKeySecret,
 		},
 	})
-	tencentCos.client = client
-	tencentCos.bucket = c.OSS.TencentCOS.Bucket
-}
-
-func NewTencentCos() *TencentCos {
-	return tencentCos
+	return &TencentCos{
+		client:    client,
+		bucket:    c.TencentCOS.Bucket,
+		secretID:  c.OSSAccessKeyID,
+		secretKey: c.OSSAccessKeySecret,
+	}, nil
 }
 
 func (oss *TencentCos) GetTencentCosClient() *cos.Client {
@@ -44,64 +53,30 @@ func (oss *TencentCos) GetTencentCosClient() *cos.Client {
 
 // GeneratePresignedUploadURL 生成上传预签名URL, filePath 为文件永久路径，如：/test/123.jpg, opt 为请求头数组
 func (oss *TencentCos) GeneratePresignedUploadURL(ctx context.Context, filePath, ContentType string) (string, error) {
-	var c = conf.GetConfig()
-	expiry := 30 * time.Minute
-
-	var opt = &cos.PresignedURLOptions{
-		Header: &http.Header{},
-	}
-	opt.Header.Set("Content-Type", ContentType)
-
-	presignedURL, err := oss.client.Object.GetPresignedURL(
-		ctx,
-		http.MethodPut,
-		filePath,
-		c.OSS.OSSAccessKeyID,
-		c.OSS.OSSAccessKeySecret,
-		expiry,
-		opt,
-	)
-	if err != nil {
-		return "", err
-	}
-
-	return presignedURL.String(), nil
+	return oss.presign(ctx, http.MethodPut, filePath, ContentType, uploadExpiry)
 }
 
 // GeneratePresignedDownloadURL 生成下载预签名URL, filePath 为文件永久路径，如：/test/123.jpg, opt 为请求头数组
 func (oss *TencentCos) GeneratePresignedDownloadURL(ctx context.Context, filePath, ContentType string) (string, error) {
-	var c = conf.GetConfig()
-	expiry := 1 * time.Hour
-
-	opt := &cos.PresignedURLOptions{
-		Header: &http.Header{},
-	}
-	opt.Header.Set("Content-Type", ContentType)
-
-	presignedURL, err := oss.client.Object.GetPresignedURL(ctx, http.MethodGet, filePath,
-		c.OSS.OSSAccessKeyID,
-		c.OSS.OSSAccessKeySecret,
-		expiry,
-		opt)
-	if err != nil {
-		return "", err
-	}
-
-	return presignedURL.String(), nil
+	return oss.presign(ctx, http.MethodGet, filePath, ContentType, downloadExpiry)
 }
 
 func (oss *TencentCos) GeneratePresignedDeleteURL(ctx context.Context, filePath, ContentType string) (string, error) {
-	var c = conf.GetConfig()
-	expiry := 5 * time.Minute
+	return oss.presign(ctx, http.MethodDelete, filePath, ContentType, deleteExpiry)
+}
 
+func (oss *TencentCos) presign(ctx context.Context, method, filePath, ContentType string, expiry time.Duration) (string, error) {
 	opt := &cos.PresignedURLOptions{
 		Header: &http.Header{},
 	}
-	opt.Header.Set("Content-Type", ContentType)
+	// 只有上传请求携带 Content-Type, 下载和删除请求签名该请求头会导致浏览器直接访问时签名不匹配
+	if method == http.MethodPut && ContentType != "" {
+		opt.Header.Set("Content-Type", ContentType)
+	}
 
-	presignedURL, err := oss.client.Object.GetPresignedURL(ctx, http.MethodDelete, filePath,
-		c.OSS.OSSAccessKeyID,
-		c.OSS.OSSAccessKeySecret,
+	presignedURL, err := oss.client.Object.GetPresignedURL(ctx, method, filePath,
+		oss.secretID,
+		oss.secretKey,
 		expiry,
 		opt)
 	if err != nil {
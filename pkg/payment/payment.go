@@ -0,0 +1,71 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+)
+
+// ErrPaymentFailed 扣款失败, 如余额不足或代扣协议已解约, 定义在 domain 中以便 handler 映射状态码
+var ErrPaymentFailed = domain.ErrPaymentFailed
+
+// ChargeRequest 扣款请求, 金额单位为分
+type ChargeRequest struct {
+	OutTradeNo string // 商户订单号, 服务商以此去重
+	UserID     int64
+	Amount     int64
+	Subject    string
+	Recurring  bool   // 同时签订代扣协议, 用于自动续费
+	Agreement  string // 使用已签订的代扣协议扣款, 为空时由用户完成支付
+}
+
+// ChargeResult 扣款结果
+type ChargeResult struct {
+	TradeNo   string // 服务商交易号
+	Agreement string // Recurring 为 true 时返回的代扣协议号
+}
+
+// Provider 支付服务商
+type Provider interface {
+	// Charge 扣款, 失败时返回的错误包装 ErrPaymentFailed
+	Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error)
+}
+
+// NewProvider 根据配置创建支付服务商. 未配置服务商时返回拒绝所有扣款的 DisabledProvider,
+// log 不实际扣款, 只有显式开启 allow_log 时才能使用, 避免误用于生产环境
+func NewProvider(c conf.PaymentConf) (Provider, error) {
+	switch c.Provider {
+	case "":
+		applog.AppLogger.Warnln("[payment] 未配置支付服务商, 所有扣款都会失败")
+		return &DisabledProvider{}, nil
+	case "log":
+		if !c.AllowLog {
+			return nil, errors.New("payment: provider log does not charge, set allow_log only in development and test")
+		}
+		applog.AppLogger.Warnln("[payment] 使用 log 支付服务商, 不会实际扣款")
+		return &LogProvider{}, nil
+	}
+	return nil, fmt.Errorf("payment: unsupported provider %q", c.Provider)
+}
+
+// DisabledProvider 未配置支付服务商时使用, 拒绝所有扣款
+type DisabledProvider struct{}
+
+func (p *DisabledProvider) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	return nil, fmt.Errorf("%w: no payment provider configured", ErrPaymentFailed)
+}
+
+// LogProvider 不实际扣款, 只写入日志并返回成功, 用于开发环境
+type LogProvider struct{}
+
+func (p *LogProvider) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	applog.AppLogger.Infof("[payment] out trade no: %s, user: %d, amount: %d, subject: %s", req.OutTradeNo, req.UserID, req.Amount, req.Subject)
+	result := &ChargeResult{TradeNo: "log-" + req.OutTradeNo, Agreement: req.Agreement}
+	if req.Recurring && result.Agreement == "" {
+		result.Agreement = fmt.Sprintf("log-agreement-%d", req.UserID)
+	}
+	return result, nil
+}
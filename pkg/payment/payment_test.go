@@ -0,0 +1,33 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	"testing"
+)
+
+func TestNewProvider_FailsClosed(t *testing.T) {
+	// 未配置服务商时拒绝扣款
+	p, err := NewProvider(conf.PaymentConf{})
+	if err != nil {
+		t.Fatalf("NewProvider err = %v", err)
+	}
+	if _, err = p.Charge(context.Background(), ChargeRequest{OutTradeNo: "1", Amount: 100}); !errors.Is(err, ErrPaymentFailed) {
+		t.Errorf("Charge without provider err = %v, want %v", err, ErrPaymentFailed)
+	}
+
+	// log 需要显式开启
+	if _, err = NewProvider(conf.PaymentConf{Provider: "log"}); err == nil {
+		t.Error("NewProvider accepted log without allow_log")
+	}
+	if p, err = NewProvider(conf.PaymentConf{Provider: "log", AllowLog: true}); err != nil {
+		t.Fatalf("NewProvider log err = %v", err)
+	}
+	if _, err = p.Charge(context.Background(), ChargeRequest{OutTradeNo: "1", Amount: 100}); err != nil {
+		t.Errorf("log Charge err = %v", err)
+	}
+	if _, err = NewProvider(conf.PaymentConf{Provider: "unknown"}); err == nil {
+		t.Error("NewProvider accepted an unknown provider")
+	}
+}
@@ -0,0 +1,63 @@
+//go:build ignore
+
+// gen 使用 ICU 的 uconv 生成常用汉字的拼音表, 用法: go run gen.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// CJK 统一汉字基本区
+const first, last = 0x4E00, 0x9FA5
+
+func main() {
+	var input strings.Builder
+	for r := rune(first); r <= last; r++ {
+		input.WriteString(string(r) + "\n")
+	}
+	cmd := exec.Command("uconv", "-x", "Han-Latin; Latin-ASCII; Lower")
+	cmd.Stdin = strings.NewReader(input.String())
+	out, err := cmd.Output()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "uconv failed:", err)
+		os.Exit(1)
+	}
+
+	groups := make(map[string][]rune)
+	for i, line := range strings.Split(string(out), "\n") {
+		if i > last-first {
+			break
+		}
+		syllable := strings.TrimSpace(line)
+		if syllable == "" || strings.IndexFunc(syllable, func(r rune) bool { return r < 'a' || r > 'z' }) >= 0 {
+			continue
+		}
+		groups[syllable] = append(groups[syllable], rune(first+i))
+	}
+	syllables := make([]string, 0, len(groups))
+	for s := range groups {
+		syllables = append(syllables, s)
+	}
+	slices.Sort(syllables)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage pinyin\n\n")
+	buf.WriteString("// table 每行为一个拼音及其对应的汉字, 多音字只取最常用的读音\n")
+	buf.WriteString("const table = \"\" +\n")
+	for i, s := range syllables {
+		sep := " +"
+		if i == len(syllables)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&buf, "\t%q%s\n", s+":"+string(groups[s])+"\n", sep)
+	}
+	if err = os.WriteFile("table.go", buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,62 @@
+// Package pinyin 将汉字转换为不带声调的拼音, 用于搜索联想的拼音和首字母匹配
+package pinyin
+
+//go:generate go run gen.go
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// syllables 汉字到拼音的映射, 首次使用时从 table 解析
+var syllables = sync.OnceValue(func() map[rune]string {
+	m := make(map[rune]string, 21000)
+	for _, line := range strings.Split(table, "\n") {
+		syllable, chars, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			m[r] = syllable
+		}
+	}
+	return m
+})
+
+// Syllable 返回汉字的拼音, 不是汉字或不在拼音表中时返回 false
+func Syllable(r rune) (string, bool) {
+	s, ok := syllables()[r]
+	return s, ok
+}
+
+// Full 返回字符串的全拼, 汉字转换为拼音, 字母和数字转为小写后保留, 其他字符丢弃.
+// 如 "华为 Mate60" 返回 "huaweimate60"
+func Full(s string) string {
+	return convert(s, func(syllable string) string { return syllable })
+}
+
+// Initials 返回字符串的拼音首字母, 字母和数字转为小写后保留, 其他字符丢弃.
+// 如 "华为 Mate60" 返回 "hwmate60"
+func Initials(s string) string {
+	return convert(s, func(syllable string) string { return syllable[:1] })
+}
+
+func convert(s string, part func(syllable string) string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if syllable, ok := Syllable(r); ok {
+			b.WriteString(part(syllable))
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// HasHan 判断字符串是否包含汉字
+func HasHan(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return unicode.Is(unicode.Han, r) }) >= 0
+}
@@ -0,0 +1,30 @@
+package pinyin
+
+import "testing"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		in, full, initials string
+	}{
+		{"手机", "shouji", "sj"},
+		{"华为 Mate60 Pro", "huaweimate60pro", "hwmate60pro"},
+		{"蓝牙耳机-降噪版", "lanyaerjijiangzaoban", "lyejjzb"},
+		{"USB", "usb", "usb"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Full(tt.in); got != tt.full {
+			t.Errorf("Full(%q) = %q, want %q", tt.in, got, tt.full)
+		}
+		if got := Initials(tt.in); got != tt.initials {
+			t.Errorf("Initials(%q) = %q, want %q", tt.in, got, tt.initials)
+		}
+	}
+
+	if _, ok := Syllable('a'); ok {
+		t.Error("Syllable('a') ok = true, want false")
+	}
+	if !HasHan("iPhone 手机") || HasHan("iPhone") {
+		t.Error("HasHan mismatch")
+	}
+}
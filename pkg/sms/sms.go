@@ -0,0 +1,31 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+)
+
+// Provider 短信服务商
+type Provider interface {
+	// SendCode 向手机号发送验证码短信
+	SendCode(ctx context.Context, phone, code string) error
+}
+
+// NewProvider 根据配置创建短信服务商
+func NewProvider(c conf.SMSConf) (Provider, error) {
+	switch c.Provider {
+	case "", "log":
+		return &LogProvider{}, nil
+	}
+	return nil, fmt.Errorf("sms: unsupported provider %q", c.Provider)
+}
+
+// LogProvider 不发送短信, 只将验证码写入日志, 用于开发环境
+type LogProvider struct{}
+
+func (p *LogProvider) SendCode(ctx context.Context, phone, code string) error {
+	applog.AppLogger.Infof("[sms] phone: %s, code: %s", phone, code)
+	return nil
+}
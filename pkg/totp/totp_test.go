@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量, 取 8 位结果的后 6 位
+func TestCode_RFC6238(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) err = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	prev, _ := Code(secret, Step(now)-1)
+	old, _ := Code(secret, Step(now)-2)
+
+	if step, ok := Validate(secret, prev, now, 1); !ok || step != Step(now)-1 {
+		t.Errorf("Validate(prev) = %d %v, want %d true", step, ok, Step(now)-1)
+	}
+	if _, ok := Validate(secret, old, now, 1); ok {
+		t.Error("code outside skew accepted")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("寻星商城", "a@b.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/寻星商城:a@b.com" {
+		t.Errorf("uri = %s", u)
+	}
+	if q := u.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "寻星商城" || q.Get("digits") != "6" {
+		t.Errorf("query = %v", q)
+	}
+}
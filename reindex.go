@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"github.com/star-find-cloud/star-mall/service"
+)
+
+// runReindex 从 shop.product 分批读取全部在售商品重建搜索索引, 用法: star-mall reindex.
+// 重建完成后切换到新索引, 期间线上搜索不受影响
+func runReindex() int {
+	searchConf := conf.GetConfig().Search
+	if searchConf.Backend == "" || searchConf.Backend == "memory" {
+		fmt.Println("内存索引在服务启动时自动重建, 无需执行 reindex")
+		return 1
+	}
+
+	db, err := database.NewMySQL()
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Errorf("初始化失败: %v", err)
+		return 1
+	}
+	index, err := search.New(searchConf, nil)
+	if err != nil {
+		fmt.Printf("初始化失败: %v\n", err)
+		log.AppLogger.Errorf("初始化失败: %v", err)
+		return 1
+	}
+
+	productService := service.NewProductService(repo.NewProductRepo(db, nil), nil, nil, index)
+	n, err := productService.RebuildIndex(context.Background())
+	if err != nil {
+		fmt.Printf("重建商品搜索索引失败: %v\n", err)
+		log.AppLogger.Errorf("重建商品搜索索引失败: %v", err)
+		return 1
+	}
+	fmt.Printf("商品搜索索引重建完成, 共 %d 个商品\n", n)
+	log.AppLogger.Infof("商品搜索索引重建完成, 共 %d 个商品", n)
+	return 0
+}
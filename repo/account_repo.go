@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+type AccountRepo interface {
+	// GetProfile 获取导出用的个人资料, 不包含密码
+	GetProfile(ctx context.Context, userID int64) (*domain.DataExportProfile, error)
+
+	// RequestDeletion 创建注销申请, 已有处于冷静期的申请时返回 domain.ErrDeletionPending
+	RequestDeletion(ctx context.Context, req *domain.DeletionRequest) error
+
+	// GetDeletion 获取用户最近一次注销申请, 不存在时返回 sql.ErrNoRows
+	GetDeletion(ctx context.Context, userID int64) (*domain.DeletionRequest, error)
+
+	// CancelDeletion 撤销处于冷静期的注销申请
+	CancelDeletion(ctx context.Context, userID int64) (bool, error)
+
+	// ListDueDeletions 获取冷静期已结束的用户ID
+	ListDueDeletions(ctx context.Context, now int64, limit int) ([]int64, error)
+
+	// Erase 匿名化用户数据. 订单保留用于对账, 收货地址只清空个人信息, 其余个人数据(含短信发送记录)直接删除.
+	// 申请已被撤销时返回 domain.ErrDeletionNotFound
+	Erase(ctx context.Context, userID int64) error
+
+	// ListAddresses 获取用户的收货地址
+	ListAddresses(ctx context.Context, userID int64) ([]*domain.Address, error)
+
+	// ListOrders 获取用户的全部订单及订单项
+	ListOrders(ctx context.Context, userID int64) ([]*domain.OrderSummary, error)
+
+	// ListFavourites 获取用户收藏的商品
+	ListFavourites(ctx context.Context, userID int64) ([]*domain.ProductCollect, error)
+
+	// ListCartItems 获取用户购物车中的商品
+	ListCartItems(ctx context.Context, userID int64) ([]*domain.DataExportCartItem, error)
+}
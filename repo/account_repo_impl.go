@@ -0,0 +1,209 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+// erasedUserName 注销后用户名替换为该值, 订单等保留的数据仍能关联到一个可展示的用户
+const erasedUserName = "已注销用户"
+
+type AccountRepoImpl struct {
+	db database.Database
+}
+
+func NewAccountRepo(db database.Database) *AccountRepoImpl {
+	return &AccountRepoImpl{db: db}
+}
+
+func (r *AccountRepoImpl) GetProfile(ctx context.Context, userID int64) (*domain.DataExportProfile, error) {
+	var profile = &domain.DataExportProfile{}
+	sqlStr := "select id, name, email, phone, sex, ifnull(tags, json_array()) as tags, create_time, last_ip, is_vip, role from shop.user where id = ? LIMIT 1"
+	if err := r.db.GetDB().GetContext(ctx, profile, sqlStr, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: user id %d", err, userID)
+		}
+		applog.MySQLLogger.Errorf("get user profile failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	return profile, nil
+}
+
+func (r *AccountRepoImpl) RequestDeletion(ctx context.Context, req *domain.DeletionRequest) error {
+	// 已有处于冷静期的申请时保持原样, 影响行数为 0; 撤销过的申请重新进入冷静期
+	sqlStr := "insert into shop.user_deletion_requests (user_id, status, requested_at, erase_at) values (?, ?, ?, ?) " +
+		"on duplicate key update requested_at = if(status = ?, requested_at, values(requested_at)), " +
+		"erase_at = if(status = ?, erase_at, values(erase_at)), cancelled_at = if(status = ?, cancelled_at, 0), status = values(status)"
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, req.UserID, _const.DeletionStatusPending, req.RequestedAt, req.EraseAt,
+		_const.DeletionStatusPending, _const.DeletionStatusPending, _const.DeletionStatusPending)
+	if err != nil {
+		applog.MySQLLogger.Errorf("request account deletion failed, user id: %d, err: %v", req.UserID, err)
+		return fmt.Errorf("failed to request account deletion: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return domain.ErrDeletionPending
+	}
+	return nil
+}
+
+func (r *AccountRepoImpl) GetDeletion(ctx context.Context, userID int64) (*domain.DeletionRequest, error) {
+	var req = &domain.DeletionRequest{}
+	sqlStr := "select user_id, status, requested_at, erase_at, cancelled_at, erased_at from shop.user_deletion_requests where user_id = ?"
+	if err := r.db.GetDB().GetContext(ctx, req, sqlStr, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		applog.MySQLLogger.Errorf("get account deletion failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to get account deletion: %w", err)
+	}
+	return req, nil
+}
+
+func (r *AccountRepoImpl) CancelDeletion(ctx context.Context, userID int64) (bool, error) {
+	sqlStr := "update shop.user_deletion_requests set status = ?, cancelled_at = ? where user_id = ? and status = ?"
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, _const.DeletionStatusCancelled, time.Now().Unix(), userID, _const.DeletionStatusPending)
+	if err != nil {
+		applog.MySQLLogger.Errorf("cancel account deletion failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *AccountRepoImpl) ListDueDeletions(ctx context.Context, now int64, limit int) ([]int64, error) {
+	var ids = make([]int64, 0)
+	sqlStr := "select user_id from shop.user_deletion_requests where status = ? and erase_at <= ? order by erase_at limit ?"
+	if err := r.db.GetDB().SelectContext(ctx, &ids, sqlStr, _const.DeletionStatusPending, now, limit); err != nil {
+		applog.MySQLLogger.Errorf("list due account deletions failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list due account deletions: %w", err)
+	}
+	return ids, nil
+}
+
+func (r *AccountRepoImpl) Erase(ctx context.Context, userID int64) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 先更新申请状态并锁定该行, 与撤销操作互斥
+	now := time.Now().Unix()
+	result, err := tx.ExecContext(ctx, "update shop.user_deletion_requests set status = ?, erased_at = ? where user_id = ? and status = ?",
+		_const.DeletionStatusErased, now, userID, _const.DeletionStatusPending)
+	if err != nil {
+		applog.MySQLLogger.Errorf("update account deletion failed, user id: %d, err: %v", userID, err)
+		return fmt.Errorf("failed to update account deletion: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return domain.ErrDeletionNotFound
+	}
+
+	statements := []struct {
+		sql  string
+		args []interface{}
+	}{
+		// 短信发送记录只能按手机号关联, 需在清空 user.phone 之前删除
+		{"delete from shop.user_sms where phone in (select phone from shop.user where id = ? and phone <> '')", []interface{}{userID}},
+		{"update shop.user set name = ?, password = '', email = '', phone = '', sex = 0, tags = null, last_ip = '', image = 0, " +
+			"status = ?, delete_time = ?, update_time = ? where id = ?", []interface{}{erasedUserName, _const.StatusDeleted, now, now, userID}},
+		// 订单通过 shipping_id 引用收货地址, 只清空个人信息不删除记录
+		{"update shop.user_address set name = '', phone = '', address = '' where uid = ?", []interface{}{userID}},
+		{"delete from shop.product_collect where user_id = ?", []interface{}{userID}},
+		{"delete from shop.cart_item where cart_id in (select id from shop.cart where user_id = ?)", []interface{}{userID}},
+		{"delete from shop.cart where user_id = ?", []interface{}{userID}},
+		{"delete from shop.user_identities where user_id = ?", []interface{}{userID}},
+		{"delete from shop.user_totp_recovery where user_id = ?", []interface{}{userID}},
+		{"delete from shop.user_totp where user_id = ?", []interface{}{userID}},
+	}
+	for _, stmt := range statements {
+		if _, err = tx.ExecContext(ctx, stmt.sql, stmt.args...); err != nil {
+			applog.MySQLLogger.Errorf("erase user data failed, user id: %d, err: %v", userID, err)
+			return fmt.Errorf("failed to erase user data: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return nil
+}
+
+func (r *AccountRepoImpl) ListAddresses(ctx context.Context, userID int64) ([]*domain.Address, error) {
+	var addresses = make([]*domain.Address, 0)
+	sqlStr := "select id, uid, phone, name, address, default_address, add_time from shop.user_address where uid = ? order by id"
+	if err := r.db.GetDB().SelectContext(ctx, &addresses, sqlStr, userID); err != nil {
+		applog.MySQLLogger.Errorf("list user address failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to list user address: %w", err)
+	}
+	return addresses, nil
+}
+
+func (r *AccountRepoImpl) ListOrders(ctx context.Context, userID int64) ([]*domain.OrderSummary, error) {
+	var orders = make([]*domain.Order, 0)
+	sqlStr := "select " + orderColumns + " from shop.orders where user_id = ? order by created_at desc, id desc"
+	if err := r.db.GetDB().SelectContext(ctx, &orders, sqlStr, userID); err != nil {
+		applog.MySQLLogger.Errorf("list user orders failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to list user orders: %w", err)
+	}
+
+	summaries := make([]*domain.OrderSummary, 0, len(orders))
+	if len(orders) == 0 {
+		return summaries, nil
+	}
+	ids := make([]int64, 0, len(orders))
+	summaryMap := make(map[int64]*domain.OrderSummary, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+		summary := &domain.OrderSummary{Order: o, Items: make([]*domain.OrderListItem, 0)}
+		summaries = append(summaries, summary)
+		summaryMap[o.ID] = summary
+	}
+
+	inSql, inArgs, err := sqlx.In("select item_id, order_id, product_id, product_title, unit_price, quantity, subtotal from shop.order_items where order_id in (?)", ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build order item query: %w", err)
+	}
+	var items = make([]*domain.OrderListItem, 0)
+	if err = r.db.GetDB().SelectContext(ctx, &items, r.db.GetDB().Rebind(inSql), inArgs...); err != nil {
+		applog.MySQLLogger.Errorf("list user order items failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to list user order items: %w", err)
+	}
+	for _, item := range items {
+		if summary, ok := summaryMap[item.OrderID]; ok {
+			summary.Items = append(summary.Items, item)
+		}
+	}
+	return summaries, nil
+}
+
+func (r *AccountRepoImpl) ListFavourites(ctx context.Context, userID int64) ([]*domain.ProductCollect, error) {
+	var favourites = make([]*domain.ProductCollect, 0)
+	sqlStr := "select id, user_id, product_id, add_time, delete_time from shop.product_collect where user_id = ? and delete_time = 0 order by add_time desc"
+	if err := r.db.GetDB().SelectContext(ctx, &favourites, sqlStr, userID); err != nil {
+		applog.MySQLLogger.Errorf("list user favourites failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to list user favourites: %w", err)
+	}
+	return favourites, nil
+}
+
+func (r *AccountRepoImpl) ListCartItems(ctx context.Context, userID int64) ([]*domain.DataExportCartItem, error) {
+	var items = make([]*domain.DataExportCartItem, 0)
+	sqlStr := "select i.product_id, i.product_title, i.create_price, i.quantity, i.specs, i.added_at " +
+		"from shop.cart_item i join shop.cart c on c.id = i.cart_id where c.user_id = ? order by i.added_at desc"
+	if err := r.db.GetDB().SelectContext(ctx, &items, sqlStr, userID); err != nil {
+		applog.MySQLLogger.Errorf("list user cart items failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to list user cart items: %w", err)
+	}
+	return items, nil
+}
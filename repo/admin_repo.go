@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+// AdminRepo 后台管理数据库接口
+type AdminRepo interface {
+	GetByUserName(ctx context.Context, userName string) (*domain.Admin, error)
+	SearchUsers(ctx context.Context, keyword string, status int64, limit, offset int) ([]*domain.User, error)
+	UpdateUserStatus(ctx context.Context, id, status int64) error
+	UpdateAdminStatus(ctx context.Context, id int64, from, to int) error
+	ListMerchants(ctx context.Context, status, limit, offset int) ([]*domain.Merchant, error)
+	UpdateMerchantStatus(ctx context.Context, id int64, from, to int) error
+	ListProducts(ctx context.Context, status int, keyword string, limit, offset int) ([]*domain.Product, error)
+	UpdateProductStatus(ctx context.Context, id int64, status int) error
+	Dashboard(ctx context.Context, startAt, endAt int64) (*domain.DashboardSummary, error)
+}
+
+// AuditRepo 管理员审计日志数据库接口
+type AuditRepo interface {
+	Create(ctx context.Context, log *domain.AuditLog) error
+	List(ctx context.Context, query *domain.AuditQuery) ([]*domain.AuditLog, error)
+}
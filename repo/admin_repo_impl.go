@@ -0,0 +1,207 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strings"
+	"time"
+)
+
+type AdminRepoImpl struct {
+	db    database.Database
+	cache *database.Redis
+}
+
+func NewAdminRepo(db database.Database, cache *database.Redis) *AdminRepoImpl {
+	return &AdminRepoImpl{
+		db:    db,
+		cache: cache,
+	}
+}
+
+func (r *AdminRepoImpl) GetByUserName(ctx context.Context, userName string) (*domain.Admin, error) {
+	var admin = &domain.Admin{}
+	sqlStr := "select id, user_name, password, phone_num, email, status, role_id, add_time, is_super from shop.admin where user_name = ?"
+
+	err := r.db.GetDB().GetContext(ctx, admin, sqlStr, userName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			applog.MySQLLogger.Warnf("admin not found (user_name: %s)", userName)
+			return nil, fmt.Errorf("%w: admin %s", err, userName)
+		}
+		applog.AppLogger.Errorf("admin repo error: %v", err)
+		return nil, fmt.Errorf("failed to get admin: %w", err)
+	}
+	return admin, nil
+}
+
+// SearchUsers 按用户名、邮箱或手机号模糊搜索用户, status 为 0 时不按状态筛选
+func (r *AdminRepoImpl) SearchUsers(ctx context.Context, keyword string, status int64, limit, offset int) ([]*domain.User, error) {
+	var (
+		users = make([]*domain.User, 0)
+		conds []string
+		args  []interface{}
+	)
+	if keyword != "" {
+		like := "%" + escapeLike(keyword) + "%"
+		conds = append(conds, "(name like ? or email like ? or phone like ?)")
+		args = append(args, like, like, like)
+	}
+	if status != 0 {
+		conds = append(conds, "status = ?")
+		args = append(args, status)
+	}
+	sqlStr := "select id, name, email, phone, sex, create_time, update_time, status, last_ip, is_vip, role from shop.user"
+	if len(conds) > 0 {
+		sqlStr += " where " + strings.Join(conds, " and ")
+	}
+	sqlStr += " order by id desc limit ? offset ?"
+	args = append(args, limit, offset)
+
+	err := r.db.GetDB().SelectContext(ctx, &users, sqlStr, args...)
+	if err != nil {
+		applog.AppLogger.Errorf("search user failed, err: %v", err)
+		return nil, fmt.Errorf("failed to search user: %w", err)
+	}
+	return users, nil
+}
+
+func (r *AdminRepoImpl) UpdateUserStatus(ctx context.Context, id, status int64) error {
+	sqlStr := "update shop.user set status = ?, update_time = ? where id = ?"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, status, time.Now().Unix(), id)
+	if err != nil {
+		applog.AppLogger.Errorf("update user status failed, err: %v", err)
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+	return expectAffected(result, fmt.Sprintf("user %d", id))
+}
+
+// UpdateAdminStatus 仅当管理员当前状态为 from 时更新为 to.
+// 权限缓存中的结果依赖管理员状态, 更新成功后使全部权限缓存失效
+func (r *AdminRepoImpl) UpdateAdminStatus(ctx context.Context, id int64, from, to int) error {
+	sqlStr := "update shop.admin set status = ? where id = ? and status = ?"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, to, id, from)
+	if err != nil {
+		applog.AppLogger.Errorf("update admin status failed, err: %v", err)
+		return fmt.Errorf("failed to update admin status: %w", err)
+	}
+	if err = expectAffected(result, fmt.Sprintf("admin %d with status %d", id, from)); err != nil {
+		return err
+	}
+	if err = r.cache.GetCache().Incr(ctx, rbacVersionKey).Err(); err != nil {
+		applog.RedisLogger.Errorf("invalidate permission cache failed, err: %v", err)
+	}
+	return nil
+}
+
+// ListMerchants 按状态获取商家列表, 先申请的排在前面
+func (r *AdminRepoImpl) ListMerchants(ctx context.Context, status, limit, offset int) ([]*domain.Merchant, error) {
+	var merchants = make([]*domain.Merchant, 0)
+	sqlStr := "select id, name, phone, email, real_name, license_image_id, cate_id, score, create_at, status from shop.merchant where status = ? order by create_at, id limit ? offset ?"
+
+	err := r.db.GetDB().SelectContext(ctx, &merchants, sqlStr, status, limit, offset)
+	if err != nil {
+		applog.AppLogger.Errorf("list merchant failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list merchant: %w", err)
+	}
+	return merchants, nil
+}
+
+// UpdateMerchantStatus 仅当商家当前状态为 from 时更新为 to
+func (r *AdminRepoImpl) UpdateMerchantStatus(ctx context.Context, id int64, from, to int) error {
+	sqlStr := "update shop.merchant set status = ?, update_at = ? where id = ? and status = ?"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, to, time.Now().Unix(), id, from)
+	if err != nil {
+		applog.AppLogger.Errorf("update merchant status failed, err: %v", err)
+		return fmt.Errorf("failed to update merchant status: %w", err)
+	}
+	return expectAffected(result, fmt.Sprintf("merchant %d with status %d", id, from))
+}
+
+// ListProducts 按状态和标题获取商品列表, status 为 0 时不按状态筛选
+func (r *AdminRepoImpl) ListProducts(ctx context.Context, status int, keyword string, limit, offset int) ([]*domain.Product, error) {
+	var (
+		products = make([]*domain.Product, 0)
+		conds    = []string{"is_deleted = 0"}
+		args     []interface{}
+	)
+	if status != 0 {
+		conds = append(conds, "status = ?")
+		args = append(args, status)
+	}
+	if keyword != "" {
+		conds = append(conds, "title like ?")
+		args = append(args, "%"+escapeLike(keyword)+"%")
+	}
+	sqlStr := "select id, merchant_id, title, sub_title, brand, product_sn, cate_id, price, market_price, keywords, created_at, updated_at, status from shop.product where " + strings.Join(conds, " and ") + " order by id desc limit ? offset ?"
+	args = append(args, limit, offset)
+
+	err := r.db.GetDB().SelectContext(ctx, &products, sqlStr, args...)
+	if err != nil {
+		applog.AppLogger.Errorf("list product failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list product: %w", err)
+	}
+	return products, nil
+}
+
+func (r *AdminRepoImpl) UpdateProductStatus(ctx context.Context, id int64, status int) error {
+	sqlStr := "update shop.product set status = ?, updated_at = ? where id = ? and is_deleted = 0"
+
+	result, err := execProductChange(ctx, r.db, id, sqlStr, status, time.Now().Unix(), id)
+	if err != nil {
+		applog.AppLogger.Errorf("update product status failed, err: %v", err)
+		return fmt.Errorf("failed to update product status: %w", err)
+	}
+	return expectAffected(result, fmt.Sprintf("product %d", id))
+}
+
+// Dashboard 统计 [startAt, endAt) 内的成交额、订单数和新用户数
+func (r *AdminRepoImpl) Dashboard(ctx context.Context, startAt, endAt int64) (*domain.DashboardSummary, error) {
+	summary := &domain.DashboardSummary{
+		StartAt:          startAt,
+		EndAt:            endAt,
+		OrderStatusCount: make(map[string]int64),
+	}
+
+	var counts []struct {
+		Status string `db:"order_status"`
+		Count  int64  `db:"cnt"`
+		Pay    int64  `db:"pay"`
+	}
+	sqlStr := "select order_status, count(*) as cnt, coalesce(sum(pay_price), 0) as pay from shop.orders where created_at >= ? and created_at < ? group by order_status"
+	if err := r.db.GetDB().SelectContext(ctx, &counts, sqlStr, startAt, endAt); err != nil {
+		applog.AppLogger.Errorf("count order failed, err: %v", err)
+		return nil, fmt.Errorf("failed to count order: %w", err)
+	}
+	for _, c := range counts {
+		summary.OrderStatusCount[c.Status] = c.Count
+		summary.OrderCount += c.Count
+		// 待付款和已取消的订单不计入成交额
+		if c.Status != _const.OrderStatusPendingPayment && c.Status != _const.OrderStatusCanceled {
+			summary.PaidOrderCount += c.Count
+			summary.GMV += c.Pay
+		}
+	}
+
+	sqlStr = "select count(*) from shop.user where create_time >= ? and create_time < ?"
+	if err := r.db.GetDB().GetContext(ctx, &summary.NewUsers, sqlStr, startAt, endAt); err != nil {
+		applog.AppLogger.Errorf("count new user failed, err: %v", err)
+		return nil, fmt.Errorf("failed to count new user: %w", err)
+	}
+
+	sqlStr = "select count(*) from shop.merchant where status = ?"
+	if err := r.db.GetDB().GetContext(ctx, &summary.PendingMerchants, sqlStr, _const.MerchantStatusPending); err != nil {
+		applog.AppLogger.Errorf("count pending merchant failed, err: %v", err)
+		return nil, fmt.Errorf("failed to count pending merchant: %w", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strings"
+)
+
+type AuditRepoImpl struct {
+	db database.Database
+}
+
+func NewAuditRepo(db database.Database) *AuditRepoImpl {
+	return &AuditRepoImpl{db: db}
+}
+
+func (r *AuditRepoImpl) Create(ctx context.Context, log *domain.AuditLog) error {
+	sqlStr := "insert into shop.admin_audit_log (admin_id, admin_name, action, path, params, status, ip, created_at) values (?, ?, ?, ?, ?, ?, ?, ?)"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, log.AdminID, log.AdminName, log.Action, log.Path, log.Params, log.Status, log.IP, log.CreatedAt)
+	if err != nil {
+		applog.AppLogger.Errorf("create audit log failed, err: %v", err)
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+	return nil
+}
+
+func (r *AuditRepoImpl) List(ctx context.Context, query *domain.AuditQuery) ([]*domain.AuditLog, error) {
+	var (
+		logs  = make([]*domain.AuditLog, 0)
+		conds []string
+		args  []interface{}
+	)
+	if query.AdminID != 0 {
+		conds = append(conds, "admin_id = ?")
+		args = append(args, query.AdminID)
+	}
+	if query.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, query.Action)
+	}
+	if query.StartAt > 0 {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, query.StartAt)
+	}
+	if query.EndAt > 0 {
+		conds = append(conds, "created_at < ?")
+		args = append(args, query.EndAt)
+	}
+	sqlStr := "select id, admin_id, admin_name, action, path, params, status, ip, created_at from shop.admin_audit_log"
+	if len(conds) > 0 {
+		sqlStr += " where " + strings.Join(conds, " and ")
+	}
+	sqlStr += " order by id desc limit ? offset ?"
+	args = append(args, query.Limit, query.Offset)
+
+	err := r.db.GetDB().SelectContext(ctx, &logs, sqlStr, args...)
+	if err != nil {
+		applog.AppLogger.Errorf("list audit log failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+	return logs, nil
+}
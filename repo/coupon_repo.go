@@ -0,0 +1,17 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+// CouponRepo 优惠券数据库接口
+type CouponRepo interface {
+	Create(ctx context.Context, coupon *domain.Coupon) (int64, error)
+	GetByID(ctx context.Context, id int64) (*domain.Coupon, error)
+	ListAvailable(ctx context.Context, merchantID, now int64) ([]*domain.Coupon, error)
+	Claim(ctx context.Context, userCoupon *domain.UserCoupon, perUserLimit int64) (int64, error)
+	GetWallet(ctx context.Context, userID int64, status int) ([]*domain.UserCoupon, error)
+	MarkUsed(ctx context.Context, userCouponID, userID, orderID int64) error
+	ReturnByOrder(ctx context.Context, orderID int64) error
+}
@@ -0,0 +1,217 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const couponColumns = "id, name, issuer_type, merchant_id, type, amount, threshold, percent, max_discount, scope_type, scope_ids, start_at, end_at, total_limit, issued_count, per_user_limit, vip_level, status, created_at, updated_at"
+
+type CouponRepoImpl struct {
+	db    database.Database
+	cache *database.Redis
+}
+
+func NewCouponRepo(db database.Database, cache *database.Redis) *CouponRepoImpl {
+	return &CouponRepoImpl{
+		db:    db,
+		cache: cache,
+	}
+}
+
+func (r *CouponRepoImpl) Create(ctx context.Context, coupon *domain.Coupon) (int64, error) {
+	sqlStr := "insert into shop.coupon (name, issuer_type, merchant_id, type, amount, threshold, percent, max_discount, scope_type, scope_ids, start_at, end_at, total_limit, per_user_limit, vip_level, status, created_at) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, coupon.Name, coupon.IssuerType, coupon.MerchantID, coupon.Type, coupon.Amount, coupon.Threshold, coupon.Percent, coupon.MaxDiscount, coupon.ScopeType, coupon.ScopeIDs, coupon.StartAt, coupon.EndAt, coupon.TotalLimit, coupon.PerUserLimit, coupon.VipLevel, coupon.Status, time.Now().Unix())
+	if err != nil {
+		applog.AppLogger.Errorf("create coupon failed, err: %v", err)
+		return 0, fmt.Errorf("failed to create coupon: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		applog.MySQLLogger.Errorf("get coupon id failed, err: %v", err)
+		return 0, fmt.Errorf("failed to get coupon id: %w", err)
+	}
+	return id, nil
+}
+
+func (r *CouponRepoImpl) GetByID(ctx context.Context, id int64) (*domain.Coupon, error) {
+	var coupon = &domain.Coupon{}
+	sqlStr := "select " + couponColumns + " from shop.coupon where id = ?"
+
+	err := r.db.GetDB().GetContext(ctx, coupon, sqlStr, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			applog.MySQLLogger.Warnf("coupon not found (id: %d)", id)
+			return nil, fmt.Errorf("%w: coupon id %d", err, id)
+		}
+		applog.AppLogger.Errorf("coupon repo error: %v", err)
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	return coupon, nil
+}
+
+// ListAvailable 获取当前可领取的优惠券, merchantID 为 0 时返回全部
+func (r *CouponRepoImpl) ListAvailable(ctx context.Context, merchantID, now int64) ([]*domain.Coupon, error) {
+	var coupons = make([]*domain.Coupon, 0)
+	sqlStr := "select " + couponColumns + " from shop.coupon where status = ? and start_at <= ? and end_at > ? and (total_limit = 0 or issued_count < total_limit)"
+	args := []interface{}{_const.StatusNotDeleted, now, now}
+	if merchantID != 0 {
+		sqlStr += " and merchant_id = ?"
+		args = append(args, merchantID)
+	}
+	sqlStr += " order by id desc"
+
+	err := r.db.GetDB().SelectContext(ctx, &coupons, sqlStr, args...)
+	if err != nil {
+		applog.AppLogger.Errorf("list coupon failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list coupon: %w", err)
+	}
+	return coupons, nil
+}
+
+// Claim 在同一事务中锁定优惠券, 校验发放总量和每人限领数量后发放到用户钱包.
+// 超出发放总量时返回 domain.ErrCouponSoldOut, 超出每人限领数量时返回 domain.ErrCouponClaimLimit
+func (r *CouponRepoImpl) Claim(ctx context.Context, userCoupon *domain.UserCoupon, perUserLimit int64) (int64, error) {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var coupon = &domain.Coupon{}
+	sqlStr := "select total_limit, issued_count from shop.coupon where id = ? for update"
+	if err = tx.GetContext(ctx, coupon, sqlStr, userCoupon.CouponID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%w: coupon id %d", err, userCoupon.CouponID)
+		}
+		applog.AppLogger.Errorf("lock coupon failed, err: %v", err)
+		return 0, fmt.Errorf("failed to lock coupon: %w", err)
+	}
+	if coupon.TotalLimit > 0 && coupon.IssuedCount >= coupon.TotalLimit {
+		return 0, domain.ErrCouponSoldOut
+	}
+
+	if perUserLimit > 0 {
+		var count int64
+		sqlStr = "select count(*) from shop.user_coupon where coupon_id = ? and user_id = ?"
+		if err = tx.GetContext(ctx, &count, sqlStr, userCoupon.CouponID, userCoupon.UserID); err != nil {
+			applog.AppLogger.Errorf("count user coupon failed, err: %v", err)
+			return 0, fmt.Errorf("failed to count user coupon: %w", err)
+		}
+		if count >= perUserLimit {
+			return 0, domain.ErrCouponClaimLimit
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "update shop.coupon set issued_count = issued_count + 1 where id = ?", userCoupon.CouponID); err != nil {
+		applog.AppLogger.Errorf("issue coupon failed, err: %v", err)
+		return 0, fmt.Errorf("failed to issue coupon: %w", err)
+	}
+
+	sqlStr = "insert into shop.user_coupon (coupon_id, user_id, status, claimed_at) values (?, ?, ?, ?)"
+	result, err := tx.ExecContext(ctx, sqlStr, userCoupon.CouponID, userCoupon.UserID, _const.UserCouponUnused, userCoupon.ClaimedAt)
+	if err != nil {
+		applog.AppLogger.Errorf("create user coupon failed, err: %v", err)
+		return 0, fmt.Errorf("failed to create user coupon: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		applog.MySQLLogger.Errorf("get user coupon id failed, err: %v", err)
+		return 0, fmt.Errorf("failed to get user coupon id: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return 0, fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return id, nil
+}
+
+// GetWallet 获取用户钱包中的优惠券并填充模板, status 为 0 时返回全部
+func (r *CouponRepoImpl) GetWallet(ctx context.Context, userID int64, status int) ([]*domain.UserCoupon, error) {
+	var userCoupons = make([]*domain.UserCoupon, 0)
+	sqlStr := "select id, coupon_id, user_id, status, order_id, claimed_at, used_at from shop.user_coupon where user_id = ?"
+	args := []interface{}{userID}
+	if status != 0 {
+		sqlStr += " and status = ?"
+		args = append(args, status)
+	}
+	sqlStr += " order by claimed_at desc"
+
+	err := r.db.GetDB().SelectContext(ctx, &userCoupons, sqlStr, args...)
+	if err != nil {
+		applog.AppLogger.Errorf("get user coupon failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get user coupon: %w", err)
+	}
+	if len(userCoupons) == 0 {
+		return userCoupons, nil
+	}
+
+	ids := make([]int64, 0, len(userCoupons))
+	for _, uc := range userCoupons {
+		ids = append(ids, uc.CouponID)
+	}
+	query, inArgs, err := sqlx.In("select "+couponColumns+" from shop.coupon where id in (?)", ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build coupon query: %w", err)
+	}
+
+	var coupons = make([]*domain.Coupon, 0)
+	err = r.db.GetDB().SelectContext(ctx, &coupons, r.db.GetDB().Rebind(query), inArgs...)
+	if err != nil {
+		applog.AppLogger.Errorf("get coupon failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+
+	couponMap := make(map[int64]*domain.Coupon, len(coupons))
+	for _, c := range coupons {
+		couponMap[c.ID] = c
+	}
+	for _, uc := range userCoupons {
+		uc.Coupon = couponMap[uc.CouponID]
+	}
+	return userCoupons, nil
+}
+
+// MarkUsed 核销用户优惠券, 仅未使用的优惠券可被核销
+func (r *CouponRepoImpl) MarkUsed(ctx context.Context, userCouponID, userID, orderID int64) error {
+	sqlStr := "update shop.user_coupon set status = ?, order_id = ?, used_at = ? where id = ? and user_id = ? and status = ?"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, _const.UserCouponUsed, orderID, time.Now().Unix(), userCouponID, userID, _const.UserCouponUnused)
+	if err != nil {
+		applog.AppLogger.Errorf("use coupon failed, err: %v", err)
+		return fmt.Errorf("failed to use coupon: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to use coupon: %w", err)
+	}
+	if rows == 0 {
+		applog.MySQLLogger.Warnf("user coupon unavailable (id: %d, user: %d)", userCouponID, userID)
+		return domain.ErrCouponUnavailable
+	}
+	return nil
+}
+
+// ReturnByOrder 订单取消后退回该订单使用的优惠券
+func (r *CouponRepoImpl) ReturnByOrder(ctx context.Context, orderID int64) error {
+	sqlStr := "update shop.user_coupon set status = ?, order_id = 0, used_at = 0 where order_id = ? and status = ?"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, _const.UserCouponUnused, orderID, _const.UserCouponUsed)
+	if err != nil {
+		applog.AppLogger.Errorf("return coupon failed, err: %v", err)
+		return fmt.Errorf("failed to return coupon: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike 转义 like 查询中的通配符
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// prefixColumns 为逗号分隔的列名加上表别名前缀
+func prefixColumns(prefix, columns string) string {
+	cols := strings.Split(columns, ",")
+	for i, col := range cols {
+		cols[i] = prefix + strings.TrimSpace(col)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// expectAffected 更新未命中任何行时返回 sql.ErrNoRows
+func expectAffected(result sql.Result, target string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", sql.ErrNoRows, target)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
+
+type IdentityRepo interface {
+	// GetByProviderSubject 根据第三方账号查找绑定, 不存在时返回 sql.ErrNoRows
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error)
+
+	// ListByUser 获取用户绑定的全部第三方账号
+	ListByUser(ctx context.Context, userID int64) ([]*domain.UserIdentity, error)
+
+	// Create 绑定第三方账号, 第三方账号已被绑定时返回 domain.ErrIdentityLinked
+	Create(ctx context.Context, identity *domain.UserIdentity) (int64, error)
+
+	// Touch 更新最近一次登录时间和提供方返回的资料
+	Touch(ctx context.Context, identity *domain.UserIdentity) error
+
+	// Delete 解除用户与某个提供方的绑定
+	Delete(ctx context.Context, userID int64, provider string) (bool, error)
+}
+
+type OAuthStateRepo interface {
+	// Save 保存授权请求
+	Save(ctx context.Context, state string, data *domain.OAuthState, ttl time.Duration) error
+
+	// Take 取出并删除授权请求, 每个 state 只能使用一次
+	Take(ctx context.Context, state string) (*domain.OAuthState, error)
+}
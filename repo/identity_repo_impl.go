@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strings"
+	"time"
+)
+
+// mysqlDuplicateEntry 违反唯一索引的错误码
+const mysqlDuplicateEntry = 1062
+
+type IdentityRepoImpl struct {
+	db database.Database
+}
+
+func NewIdentityRepo(db database.Database) *IdentityRepoImpl {
+	return &IdentityRepoImpl{db: db}
+}
+
+func (r *IdentityRepoImpl) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	var identity domain.UserIdentity
+	sqlStr := "select id, user_id, provider, subject, email, name, created_at, updated_at from shop.user_identities where provider = ? and subject = ?"
+	if err := r.db.GetDB().GetContext(ctx, &identity, sqlStr, provider, subject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		applog.MySQLLogger.Errorf("get user identity failed, provider: %s, err: %v", provider, err)
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return &identity, nil
+}
+
+func (r *IdentityRepoImpl) ListByUser(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	var identities []*domain.UserIdentity
+	sqlStr := "select id, user_id, provider, subject, email, name, created_at, updated_at from shop.user_identities where user_id = ? order by id"
+	if err := r.db.GetDB().SelectContext(ctx, &identities, sqlStr, userID); err != nil {
+		applog.MySQLLogger.Errorf("list user identities failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to list user identities: %w", err)
+	}
+	return identities, nil
+}
+
+func (r *IdentityRepoImpl) Create(ctx context.Context, identity *domain.UserIdentity) (int64, error) {
+	now := time.Now().Unix()
+	identity.CreatedAt, identity.UpdatedAt = now, now
+	sqlStr := "insert into shop.user_identities (user_id, provider, subject, email, name, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?)"
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.Name, identity.CreatedAt, identity.UpdatedAt)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			if strings.Contains(mysqlErr.Message, "uk_user_provider") {
+				return 0, domain.ErrProviderAlreadyBound
+			}
+			return 0, domain.ErrIdentityLinked
+		}
+		applog.MySQLLogger.Errorf("create user identity failed, user id: %d, err: %v", identity.UserID, err)
+		return 0, fmt.Errorf("failed to create user identity: %w", err)
+	}
+	identity.ID, err = result.LastInsertId()
+	return identity.ID, err
+}
+
+func (r *IdentityRepoImpl) Touch(ctx context.Context, identity *domain.UserIdentity) error {
+	sqlStr := "update shop.user_identities set email = ?, name = ?, updated_at = ? where id = ?"
+	if _, err := r.db.GetDB().ExecContext(ctx, sqlStr, identity.Email, identity.Name, time.Now().Unix(), identity.ID); err != nil {
+		applog.MySQLLogger.Errorf("update user identity failed, id: %d, err: %v", identity.ID, err)
+		return fmt.Errorf("failed to update user identity: %w", err)
+	}
+	return nil
+}
+
+func (r *IdentityRepoImpl) Delete(ctx context.Context, userID int64, provider string) (bool, error) {
+	result, err := r.db.GetDB().ExecContext(ctx, "delete from shop.user_identities where user_id = ? and provider = ?", userID, provider)
+	if err != nil {
+		applog.MySQLLogger.Errorf("delete user identity failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to delete user identity: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
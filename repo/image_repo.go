@@ -24,12 +24,31 @@ type ImageRepo interface {
 	// UpdatePath 更新图片的 ossPath
 	UpdatePath(ctx context.Context, image domain.Image) error
 
-	// Update 更新图片元信息
+	// Update 更新图片元信息, 旧图片标记为删除并释放对内容的引用
 	Update(ctx context.Context, oldImageID int64, newImage *domain.Image) (int64, error)
 
-	// Delete 删除图片元信息
+	// Delete 删除图片元信息并释放对内容的引用, 文件由回收任务删除
 	Delete(ctx context.Context, imageID int64) error
 
 	// CheckImageExistsByID 检查图片元信息是否存在
 	CheckImageExistsByID(ctx context.Context, id int64) (bool, error)
+
+	// SaveVariants 替换图片的全部处理版本, 并将图片标记为已处理
+	SaveVariants(ctx context.Context, imageID int64, variants []*domain.ImageVariant) error
+
+	// GetVariants 获取图片的全部处理版本
+	GetVariants(ctx context.Context, imageID int64) ([]*domain.ImageVariant, error)
+
+	// ListUnprocessed 按 ID 升序分批获取尚未处理的指定格式的图片
+	ListUnprocessed(ctx context.Context, afterID int64, limit int, contentTypes []int64) ([]*domain.Image, error)
+
+	// CreateWithBlob 增加内容的引用数(不存在时创建)并保存图片元数据, image.Path 设置为内容的路径.
+	// 内容为新建时在提交前调用 write 写入内容的文件, 写入失败时不保存任何记录
+	CreateWithBlob(ctx context.Context, image *domain.Image, blob *domain.ImageBlob, write func(path string) error) error
+
+	// ListReleasedBlobs 获取引用数为 0 且在 releasedBefore 之前释放的内容
+	ListReleasedBlobs(ctx context.Context, releasedBefore int64, limit int) ([]*domain.ImageBlob, error)
+
+	// DeleteBlob 内容仍满足回收条件时调用 remove 删除文件并删除记录, 返回是否已删除
+	DeleteBlob(ctx context.Context, hash string, releasedBefore int64, remove func(paths []string) error) (bool, error)
 }
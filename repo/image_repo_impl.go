@@ -5,10 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/pkg/database"
 	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
 )
 
 type ImageRepositoryImpl struct {
@@ -27,8 +29,10 @@ func (r *ImageRepositoryImpl) UploadImage(ctx context.Context, image *domain.Ima
 		image.OwnerType,
 		image.OwnerID,
 		image.Path,
+		image.SHA256Hash,
 		image.IsCompressed,
 		image.ContentType,
+		image.CreateAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -41,12 +45,12 @@ func (r *ImageRepositoryImpl) UploadImage(ctx context.Context, image *domain.Ima
 	return image.ImageID, nil
 }
 
-// GetByID 根据 imageID 获取图片元信息
+// GetByID 根据 imageID 获取未删除的图片元信息
 func (r *ImageRepositoryImpl) GetByID(ctx context.Context, imageID int64) (*domain.Image, error) {
 	var image = &domain.Image{}
-	sqlStr := "select imageID, ownerType, ownerID, path, isCompressed, content_type, create_at from shop.images where imageID = ?;"
+	sqlStr := "select imageID, ownerType, ownerID, path, coalesce(sha256hash, '') as sha256hash, isCompressed, content_type, create_at, status from shop.images where imageID = ? and status = ?;"
 
-	err := r.db.GetDB().GetContext(ctx, image, sqlStr, imageID)
+	err := r.db.GetDB().GetContext(ctx, image, sqlStr, imageID, _const.StatusNotDeleted)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.MySQLLogger.Warnf("image not found (id: %d)", imageID)
@@ -76,10 +80,10 @@ func (r *ImageRepositoryImpl) GetByOwner(ctx context.Context, ownerType, ownerID
 }
 
 func (r *ImageRepositoryImpl) GetPathByImageID(ctx context.Context, id int64) (string, error) {
-	sqlStr := "select path from shop.images where imageID = ?;"
+	sqlStr := "select path from shop.images where imageID = ? and status = ?;"
 	var path string
 
-	err := r.db.GetDB().QueryRowContext(ctx, path, sqlStr, id).Scan()
+	err := r.db.GetDB().GetContext(ctx, &path, sqlStr, id, _const.StatusNotDeleted)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.MySQLLogger.Warnf("image not found (id: %d)", id)
@@ -144,42 +148,34 @@ func (r *ImageRepositoryImpl) UpdatePath(ctx context.Context, image domain.Image
 	return tx.Commit()
 }
 
-// Update 更新图片元信息
+// Update 更新图片元信息, 旧图片标记为删除并释放对内容的引用
 func (r *ImageRepositoryImpl) Update(ctx context.Context, oldImageID int64, newImage *domain.Image) (int64, error) {
 	// 开启事务
-	tx, err := r.db.GetDB().Begin()
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("tx begin err: %v", err)
 	}
+	defer tx.Rollback()
 
 	// 将旧数据标记为删除
-	selectStr := "update shop.images set status = ? where imageID = ?"
-	_, err = tx.ExecContext(ctx, selectStr, _const.StatusDeleted, oldImageID)
-	if err != nil {
-		if err = tx.Rollback(); err != nil {
-			log.AppLogger.Warnf("tx rollback err: %v", err)
-		}
-		return 0, fmt.Errorf("image not found (id: %d)", oldImageID)
+	if _, err = deleteImage(ctx, tx, oldImageID); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return 0, fmt.Errorf("image update err: %v", err)
 	}
 
 	// 插入新数据
 	insertStr := "insert into shop.images (imageID, ownerType, ownerID, path, sha256hash, isCompressed, content_type, create_at) values (?,?,?,?,?,?,?,?);"
 	_, err = tx.ExecContext(ctx, insertStr,
 		newImage.ImageID,
-		newImage.Path,
 		newImage.OwnerType,
 		newImage.OwnerID,
+		newImage.Path,
+		newImage.SHA256Hash,
 		newImage.IsCompressed,
 		newImage.ContentType,
+		newImage.CreateAt,
 	)
 	if err != nil {
-		if err := tx.Rollback(); err != nil {
-			log.AppLogger.Warnf("tx rollback err: %v", err)
-		}
-		if errors.Is(err, sql.ErrNoRows) {
-			log.MySQLLogger.Warnf("image update err: %v", err)
-			return 0, fmt.Errorf("image update err: %v", err)
-		}
 		log.AppLogger.Errorf("image repo error: %v", err)
 		return 0, fmt.Errorf("image update err: %v", err)
 	}
@@ -191,33 +187,44 @@ func (r *ImageRepositoryImpl) Update(ctx context.Context, oldImageID int64, newI
 	return newImage.ImageID, nil
 }
 
-// Delete 删除图片元信息
+// Delete 将图片标记为删除并释放对内容的引用, 已删除的图片返回不存在
 func (r *ImageRepositoryImpl) Delete(ctx context.Context, imageID int64) error {
-	exists, err := r.CheckImageExistsByID(ctx, imageID)
-	if !exists {
-		return fmt.Errorf("image not found (id: %d)", imageID)
-	}
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.MySQLLogger.Errorf("image check exists error :%v", err)
-			return err
-		}
-		log.AppLogger.Errorf("image repo error: %v", err)
-		return fmt.Errorf("image delete err: %v", err)
+		return fmt.Errorf("tx begin err: %v", err)
 	}
+	defer tx.Rollback()
 
-	deleteStr := "update shop.images set status = ? where imageID = ?;"
-	_, err = r.db.GetDB().ExecContext(ctx, deleteStr, imageID)
+	deleted, err := deleteImage(ctx, tx, imageID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.MySQLLogger.Warnf("image delete error :%v", err)
-			return fmt.Errorf("image delete err: %v", err)
-		}
 		log.AppLogger.Errorf("image repo error: %v", err)
 		return fmt.Errorf("image delete err: %v", err)
 	}
+	if !deleted {
+		log.MySQLLogger.Warnf("image not found (id: %d)", imageID)
+		return fmt.Errorf("%w: image id %d", sql.ErrNoRows, imageID)
+	}
+	return tx.Commit()
+}
 
-	return nil
+// deleteImage 将未删除的图片标记为删除, 如果图片引用了去重的内容, 内容的引用数减 1, 降为 0 时记录释放时间
+func deleteImage(ctx context.Context, tx *sqlx.Tx, imageID int64) (bool, error) {
+	var image domain.Image
+	err := tx.GetContext(ctx, &image, "select imageID, path, coalesce(sha256hash, '') as sha256hash from shop.images where imageID = ? and status = ? for update", imageID, _const.StatusNotDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, "update shop.images set status = ? where imageID = ?", _const.StatusDeleted, imageID); err != nil {
+		return false, err
+	}
+	// 同时匹配路径, 去重之前上传的图片即使哈希相同也没有引用内容
+	// 单表 update 按从左到右的顺序赋值, released_at 判断的是减 1 之前的引用数
+	_, err = tx.ExecContext(ctx, "update shop.image_blobs set released_at = if(ref_count = 1, ?, released_at), ref_count = ref_count - 1 where sha256hash = ? and path = ? and ref_count > 0",
+		time.Now().Unix(), image.SHA256Hash, image.Path)
+	return err == nil, err
 }
 
 // CheckImageExistsByID 根据ID判断是否存在根据 id 检查图片是否存在
@@ -228,3 +235,148 @@ func (r *ImageRepositoryImpl) CheckImageExistsByID(ctx context.Context, id int64
 	var err = r.db.GetDB().GetContext(ctx, &exist, sqlStr, id)
 	return exist, err
 }
+
+// SaveVariants 在一个事务中删除旧版本、写入新版本并标记图片已处理, 重复处理同一图片不会留下多余的记录
+func (r *ImageRepositoryImpl) SaveVariants(ctx context.Context, imageID int64, variants []*domain.ImageVariant) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("tx begin err: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "delete from shop.image_variants where imageID = ?", imageID); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return fmt.Errorf("failed to save image variants: %w", err)
+	}
+	insertStr := "insert into shop.image_variants (imageID, size, content_type, path, sha256hash, width, height, bytes, create_at) values (?,?,?,?,?,?,?,?,?)"
+	for _, v := range variants {
+		if _, err = tx.ExecContext(ctx, insertStr, imageID, v.Size, v.ContentType, v.Path, v.SHA256Hash, v.Width, v.Height, v.Bytes, v.CreateAt); err != nil {
+			log.AppLogger.Errorf("image repo error: %v", err)
+			return fmt.Errorf("failed to save image variants: %w", err)
+		}
+	}
+	if _, err = tx.ExecContext(ctx, "update shop.images set isCompressed = 1 where imageID = ?", imageID); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return fmt.Errorf("failed to save image variants: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (r *ImageRepositoryImpl) GetVariants(ctx context.Context, imageID int64) ([]*domain.ImageVariant, error) {
+	var variants = []*domain.ImageVariant{}
+	sqlStr := "select id, imageID, size, content_type, path, sha256hash, width, height, bytes, create_at from shop.image_variants where imageID = ?"
+	if err := r.db.GetDB().SelectContext(ctx, &variants, sqlStr, imageID); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return nil, fmt.Errorf("failed to get image variants: %w", err)
+	}
+	return variants, nil
+}
+
+// ListUnprocessed 用于启动时补处理上传后未能处理的图片
+func (r *ImageRepositoryImpl) ListUnprocessed(ctx context.Context, afterID int64, limit int, contentTypes []int64) ([]*domain.Image, error) {
+	var images = []*domain.Image{}
+	if len(contentTypes) == 0 {
+		return images, nil
+	}
+	sqlStr, args, err := sqlx.In("select imageID, ownerType, ownerID, path, coalesce(sha256hash, '') as sha256hash, isCompressed, content_type, create_at, status from shop.images "+
+		"where imageID > ? and isCompressed = 0 and status = ? and content_type in (?) order by imageID limit ?", afterID, _const.StatusNotDeleted, contentTypes, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+	if err = r.db.GetDB().SelectContext(ctx, &images, r.db.GetDB().Rebind(sqlStr), args...); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	return images, nil
+}
+
+// CreateWithBlob 在一个事务中增加内容的引用数(不存在时创建)并写入图片元数据, image.Path 设置为内容的路径.
+// 新建内容时持有行锁调用 write 写入文件后才提交, 期间上传相同内容或回收该内容会等待, 不会引用尚未写入的文件
+func (r *ImageRepositoryImpl) CreateWithBlob(ctx context.Context, image *domain.Image, blob *domain.ImageBlob, write func(path string) error) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("tx begin err: %v", err)
+	}
+	defer tx.Rollback()
+
+	// 新建时影响 1 行, 已存在时更新影响 2 行
+	res, err := tx.ExecContext(ctx, "insert into shop.image_blobs (sha256hash, path, content_type, size, ref_count, create_at) values (?,?,?,?,1,?) "+
+		"on duplicate key update ref_count = ref_count + 1, released_at = 0", blob.SHA256Hash, blob.Path, blob.ContentType, blob.Size, blob.CreateAt)
+	if err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return fmt.Errorf("failed to acquire image blob: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to acquire image blob: %w", err)
+	}
+	if err = r.createOnBlob(ctx, tx, image, blob.SHA256Hash); err != nil {
+		return err
+	}
+	if affected == 1 {
+		if err = write(image.Path); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// createOnBlob 以内容的路径和哈希写入图片元数据
+func (r *ImageRepositoryImpl) createOnBlob(ctx context.Context, tx *sqlx.Tx, image *domain.Image, hash string) error {
+	if err := tx.GetContext(ctx, &image.Path, "select path from shop.image_blobs where sha256hash = ?", hash); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return fmt.Errorf("failed to get image blob: %w", err)
+	}
+	image.SHA256Hash = hash
+	sqlStr := "insert into shop.images (imageID, ownerType, ownerID, path, sha256hash, isCompressed, content_type, create_at) values (?,?,?,?,?,?,?,?);"
+	if _, err := tx.ExecContext(ctx, sqlStr, image.ImageID, image.OwnerType, image.OwnerID, image.Path, image.SHA256Hash, image.IsCompressed, image.ContentType, image.CreateAt); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+	return nil
+}
+
+// ListReleasedBlobs 按释放时间获取引用数为 0 且在 releasedBefore 之前释放的内容
+func (r *ImageRepositoryImpl) ListReleasedBlobs(ctx context.Context, releasedBefore int64, limit int) ([]*domain.ImageBlob, error) {
+	var blobs = []*domain.ImageBlob{}
+	sqlStr := "select sha256hash, path, content_type, size, ref_count, create_at, released_at from shop.image_blobs " +
+		"where ref_count = 0 and released_at > 0 and released_at <= ? order by released_at limit ?"
+	if err := r.db.GetDB().SelectContext(ctx, &blobs, sqlStr, releasedBefore, limit); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return nil, fmt.Errorf("failed to list image blobs: %w", err)
+	}
+	return blobs, nil
+}
+
+// DeleteBlob 锁定仍满足回收条件的内容, 调用 remove 删除内容及其各尺寸版本的文件后删除记录.
+// 持有行锁期间上传相同内容会等待, 之后重新创建内容, 不会引用已删除的文件
+func (r *ImageRepositoryImpl) DeleteBlob(ctx context.Context, hash string, releasedBefore int64, remove func(paths []string) error) (bool, error) {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("tx begin err: %v", err)
+	}
+	defer tx.Rollback()
+
+	var path string
+	err = tx.GetContext(ctx, &path, "select path from shop.image_blobs where sha256hash = ? and ref_count = 0 and released_at > 0 and released_at <= ? for update", hash, releasedBefore)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return false, fmt.Errorf("failed to lock image blob: %w", err)
+	}
+	var variants []string
+	if err = tx.SelectContext(ctx, &variants, "select distinct v.path from shop.image_variants v join shop.images i on i.imageID = v.imageID where i.path = ?", path); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return false, fmt.Errorf("failed to get image variants: %w", err)
+	}
+	if err = remove(append([]string{path}, variants...)); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, "delete from shop.image_blobs where sha256hash = ?", hash); err != nil {
+		log.AppLogger.Errorf("image repo error: %v", err)
+		return false, fmt.Errorf("failed to delete image blob: %w", err)
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,27 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
+
+type ImageUploadRepo interface {
+	// Save 保存分片上传的进度, 每次保存重新计算过期时间
+	Save(ctx context.Context, upload *domain.ImageUpload, ttl time.Duration) error
+
+	// Get 获取分片上传的进度, 不存在或已过期时返回 domain.ErrImageUploadNotFound
+	Get(ctx context.Context, id int64) (*domain.ImageUpload, error)
+
+	// Delete 删除分片上传的进度
+	Delete(ctx context.Context, id int64) error
+
+	// Lock 获取上传锁, 同一图片ID同时只能有一个连接写入; 已被其他连接持有时返回 false
+	Lock(ctx context.Context, id int64, token string, ttl time.Duration) (bool, error)
+
+	// RefreshLock 仍持有上传锁时延长有效期, 锁已过期或被其他连接获取时返回 false
+	RefreshLock(ctx context.Context, id int64, token string, ttl time.Duration) (bool, error)
+
+	// Unlock 仍持有上传锁时释放
+	Unlock(ctx context.Context, id int64, token string) error
+}
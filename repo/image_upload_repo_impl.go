@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strconv"
+	"time"
+)
+
+const imageUploadKeyPrefix = "image:upload:"
+
+// refreshImageUploadLockScript 仍由本连接持有时延长上传锁
+var refreshImageUploadLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseImageUploadLockScript 仍由本连接持有时释放上传锁
+var releaseImageUploadLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type ImageUploadRepoImpl struct {
+	rdb *redis.Client
+}
+
+func NewImageUploadRepo(rdb *redis.Client) *ImageUploadRepoImpl {
+	return &ImageUploadRepoImpl{rdb: rdb}
+}
+
+func imageUploadKey(id int64) string {
+	return imageUploadKeyPrefix + strconv.FormatInt(id, 10)
+}
+
+func imageUploadLockKey(id int64) string {
+	return imageUploadKey(id) + ":lock"
+}
+
+func (r *ImageUploadRepoImpl) Save(ctx context.Context, upload *domain.ImageUpload, ttl time.Duration) error {
+	value, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal image upload: %w", err)
+	}
+	if err = r.rdb.Set(ctx, imageUploadKey(upload.ID), value, ttl).Err(); err != nil {
+		applog.RedisLogger.Errorf("save image upload failed, err: %v", err)
+		return fmt.Errorf("failed to save image upload: %w", err)
+	}
+	return nil
+}
+
+func (r *ImageUploadRepoImpl) Get(ctx context.Context, id int64) (*domain.ImageUpload, error) {
+	value, err := r.rdb.Get(ctx, imageUploadKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, domain.ErrImageUploadNotFound
+	}
+	if err != nil {
+		applog.RedisLogger.Errorf("get image upload failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get image upload: %w", err)
+	}
+	var upload domain.ImageUpload
+	if err = json.Unmarshal(value, &upload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal image upload: %w", err)
+	}
+	return &upload, nil
+}
+
+func (r *ImageUploadRepoImpl) Delete(ctx context.Context, id int64) error {
+	if err := r.rdb.Del(ctx, imageUploadKey(id)).Err(); err != nil {
+		applog.RedisLogger.Errorf("delete image upload failed, err: %v", err)
+		return fmt.Errorf("failed to delete image upload: %w", err)
+	}
+	return nil
+}
+
+func (r *ImageUploadRepoImpl) Lock(ctx context.Context, id int64, token string, ttl time.Duration) (bool, error) {
+	ok, err := r.rdb.SetNX(ctx, imageUploadLockKey(id), token, ttl).Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("lock image upload failed, err: %v", err)
+		return false, fmt.Errorf("failed to lock image upload: %w", err)
+	}
+	return ok, nil
+}
+
+func (r *ImageUploadRepoImpl) RefreshLock(ctx context.Context, id int64, token string, ttl time.Duration) (bool, error) {
+	n, err := refreshImageUploadLockScript.Run(ctx, r.rdb, []string{imageUploadLockKey(id)}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		applog.RedisLogger.Errorf("refresh image upload lock failed, err: %v", err)
+		return false, fmt.Errorf("failed to refresh image upload lock: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (r *ImageUploadRepoImpl) Unlock(ctx context.Context, id int64, token string) error {
+	if err := releaseImageUploadLockScript.Run(ctx, r.rdb, []string{imageUploadLockKey(id)}, token).Err(); err != nil {
+		applog.RedisLogger.Errorf("unlock image upload failed, err: %v", err)
+		return fmt.Errorf("failed to unlock image upload: %w", err)
+	}
+	return nil
+}
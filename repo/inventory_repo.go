@@ -12,4 +12,5 @@ type InventoryRepo interface {
 	GetByID(ctx context.Context, id int64) (*domain.Inventory, error)
 	GetByMerchantID(ctx context.Context, MerchantID int64) ([]*domain.Inventory, error)
 	Deduction(ctx context.Context, ProductID int64, count int64) error
+	Restock(ctx context.Context, ProductID int64, count int64) error
 }
@@ -26,7 +26,7 @@ func NewInventoryRepo(db database.Database, cache *database.Redis) *InventoryRep
 func (r *InventoryRepoImpl) Create(ctx context.Context, inventory *domain.Inventory) error {
 	sqlStr := "insert into shop.inventory (product_id, available_stock, low_stock_threshold, create_at) values (?, ?, ?, ?) "
 
-	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, inventory.ProductID, inventory.AvailableStock, time.Now().Unix(), inventory.UpdateAt)
+	_, err := execStockChange(ctx, r.db, inventory.ProductID, sqlStr, inventory.ProductID, inventory.AvailableStock, inventory.LowStockThreshold, time.Now().Unix())
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			applog.MySQLLogger.Warnf("product not found id: %d", inventory.ProductID)
@@ -42,7 +42,7 @@ func (r *InventoryRepoImpl) Create(ctx context.Context, inventory *domain.Invent
 func (r *InventoryRepoImpl) Update(ctx context.Context, inventory *domain.Inventory) error {
 	sqlStr := "update shop.inventory set available_stock = ?, low_stock_threshold = ?, update_at = ? where product_id = ?"
 
-	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, inventory.AvailableStock, inventory.LowStockThreshold, time.Now().Unix(), inventory.ProductID)
+	_, err := execStockChange(ctx, r.db, inventory.ProductID, sqlStr, inventory.AvailableStock, inventory.LowStockThreshold, time.Now().Unix(), inventory.ProductID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			applog.MySQLLogger.Warnf("product not found id: %d", inventory.ProductID)
@@ -86,11 +86,11 @@ func (r *InventoryRepoImpl) GetByMerchantID(ctx context.Context, MerchantID int6
 	return inventories, nil
 }
 
-// Deduction 扣减库存
+// Deduction 扣减库存, 同时写入商品变更事件以更新搜索索引中的有货状态
 func (r *InventoryRepoImpl) Deduction(ctx context.Context, ProductID int64, count int64) error {
-	sqlStr := "update shop.inventory set available_stock = available_stock - ? where product_id = ?"
+	sqlStr := "update shop.inventory set available_stock = available_stock - ?, update_at = ? where product_id = ?"
 
-	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, count, ProductID)
+	_, err := execStockChange(ctx, r.db, ProductID, sqlStr, count, time.Now().Unix(), ProductID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			applog.MySQLLogger.Warnf("product not found id: %d", ProductID)
@@ -102,3 +102,16 @@ func (r *InventoryRepoImpl) Deduction(ctx context.Context, ProductID int64, coun
 
 	return nil
 }
+
+// Restock 回补库存, 用于订单取消, 同时写入商品变更事件
+func (r *InventoryRepoImpl) Restock(ctx context.Context, ProductID int64, count int64) error {
+	sqlStr := "update shop.inventory set available_stock = available_stock + ?, update_at = ? where product_id = ?"
+
+	_, err := execStockChange(ctx, r.db, ProductID, sqlStr, count, time.Now().Unix(), ProductID)
+	if err != nil {
+		applog.AppLogger.Errorf("inventory repo error: %v", err)
+		return fmt.Errorf("failed to restock inventory: %w", err)
+	}
+
+	return nil
+}
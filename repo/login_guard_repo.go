@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
+
+type LoginGuardRepo interface {
+	// AddFailure 记录一次失败并返回滑动窗口内的失败次数
+	AddFailure(ctx context.Context, kind, subject string, now time.Time, window time.Duration) (int64, error)
+
+	// ResetFailures 清除失败记录和等待时间
+	ResetFailures(ctx context.Context, kind, subject string) error
+
+	// SetDelay 设置下次允许尝试前需要等待的时间
+	SetDelay(ctx context.Context, kind, subject string, delay time.Duration) error
+
+	// Lock 锁定账号或 IP
+	Lock(ctx context.Context, kind, subject string, ttl time.Duration) error
+
+	// Blocked 返回锁定或等待的剩余时间, 都没有时返回 0
+	Blocked(ctx context.Context, kind, subject string) (locked, delay time.Duration, err error)
+
+	// ListLocks 列出当前所有锁定
+	ListLocks(ctx context.Context) ([]*domain.LoginLock, error)
+
+	// Unlock 解除锁定并清除失败记录
+	Unlock(ctx context.Context, kind, subject string) (bool, error)
+}
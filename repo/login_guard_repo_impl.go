@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 失败记录使用有序集合, 成员和分值都是失败时间, 按分值裁剪即可得到滑动窗口
+const guardKeyPrefix = "guard:"
+
+type LoginGuardRepoImpl struct {
+	rdb *redis.Client
+}
+
+func NewLoginGuardRepo(rdb *redis.Client) *LoginGuardRepoImpl {
+	return &LoginGuardRepoImpl{rdb: rdb}
+}
+
+func guardKey(kind, subject, suffix string) string {
+	return guardKeyPrefix + kind + ":" + subject + ":" + suffix
+}
+
+func (r *LoginGuardRepoImpl) AddFailure(ctx context.Context, kind, subject string, now time.Time, window time.Duration) (int64, error) {
+	key := guardKey(kind, subject, "failures")
+	var count *redis.IntCmd
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: strconv.FormatInt(now.UnixNano(), 10)})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Add(-window).UnixMilli(), 10))
+		count = pipe.ZCard(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("add login failure failed, err: %v", err)
+		return 0, fmt.Errorf("failed to add login failure: %w", err)
+	}
+	return count.Val(), nil
+}
+
+func (r *LoginGuardRepoImpl) ResetFailures(ctx context.Context, kind, subject string) error {
+	err := r.rdb.Del(ctx, guardKey(kind, subject, "failures"), guardKey(kind, subject, "delay")).Err()
+	if err != nil {
+		applog.RedisLogger.Errorf("reset login failures failed, err: %v", err)
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+func (r *LoginGuardRepoImpl) SetDelay(ctx context.Context, kind, subject string, delay time.Duration) error {
+	if err := r.rdb.Set(ctx, guardKey(kind, subject, "delay"), 1, delay).Err(); err != nil {
+		applog.RedisLogger.Errorf("set login delay failed, err: %v", err)
+		return fmt.Errorf("failed to set login delay: %w", err)
+	}
+	return nil
+}
+
+func (r *LoginGuardRepoImpl) Lock(ctx context.Context, kind, subject string, ttl time.Duration) error {
+	if err := r.rdb.Set(ctx, guardKey(kind, subject, "lock"), 1, ttl).Err(); err != nil {
+		applog.RedisLogger.Errorf("lock login failed, err: %v", err)
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+func (r *LoginGuardRepoImpl) Blocked(ctx context.Context, kind, subject string) (time.Duration, time.Duration, error) {
+	var lock, delay *redis.DurationCmd
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		lock = pipe.PTTL(ctx, guardKey(kind, subject, "lock"))
+		delay = pipe.PTTL(ctx, guardKey(kind, subject, "delay"))
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("get login block failed, err: %v", err)
+		return 0, 0, fmt.Errorf("failed to get login block: %w", err)
+	}
+	// 不存在的键 PTTL 返回负数
+	return max(lock.Val(), 0), max(delay.Val(), 0), nil
+}
+
+func (r *LoginGuardRepoImpl) ListLocks(ctx context.Context) ([]*domain.LoginLock, error) {
+	var locks []*domain.LoginLock
+	iter := r.rdb.Scan(ctx, 0, guardKeyPrefix+"*:lock", 100).Iterator()
+	for iter.Next(ctx) {
+		kind, subject, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(iter.Val(), guardKeyPrefix), ":lock"), ":")
+		if !ok {
+			continue
+		}
+		ttl, err := r.rdb.PTTL(ctx, iter.Val()).Result()
+		if err != nil {
+			applog.RedisLogger.Errorf("get login lock ttl failed, err: %v", err)
+			return nil, fmt.Errorf("failed to list login locks: %w", err)
+		}
+		if ttl <= 0 {
+			continue
+		}
+		failures, err := r.rdb.ZCard(ctx, guardKey(kind, subject, "failures")).Result()
+		if err != nil {
+			applog.RedisLogger.Errorf("get login failures failed, err: %v", err)
+			return nil, fmt.Errorf("failed to list login locks: %w", err)
+		}
+		locks = append(locks, &domain.LoginLock{
+			Kind:      kind,
+			Subject:   subject,
+			Failures:  failures,
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		applog.RedisLogger.Errorf("scan login locks failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list login locks: %w", err)
+	}
+	return locks, nil
+}
+
+func (r *LoginGuardRepoImpl) Unlock(ctx context.Context, kind, subject string) (bool, error) {
+	n, err := r.rdb.Del(ctx,
+		guardKey(kind, subject, "lock"),
+		guardKey(kind, subject, "failures"),
+		guardKey(kind, subject, "delay"),
+	).Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("unlock login failed, err: %v", err)
+		return false, fmt.Errorf("failed to unlock login: %w", err)
+	}
+	return n > 0, nil
+}
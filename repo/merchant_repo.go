@@ -17,4 +17,5 @@ type MerchantRepository interface {
 	IsExistsByEmail(ctx context.Context, email string) (bool, error)
 	IsExistsByPhone(ctx context.Context, phone string) (bool, error)
 	UpdateLicenseImage(ctx context.Context, merchantID, imageID int64) error
+	GetStatusByUserID(ctx context.Context, userID int64) (int, error)
 }
@@ -31,7 +31,7 @@ func (r *MerchantRepo) Create(ctx context.Context, merchant *domain.Merchant) (i
 
 	sqlStr := "insert into shop.merchant (userID, name, phone, email, password, real_name, real_id, license_image_id, tag, cate_id, business_type, score, create_at, status) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
-	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, merchant.UserID, merchant.Name, merchant.Phone, merchant.Email, merchant.Password, merchant.RealName, merchant.RealID, merchant.LicenseImageID, merchant.Tag, merchant.CateID, businessTypeJSON, merchant.Score, merchant.CreateAt, _const.StatusNotDeleted)
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, merchant.UserID, merchant.Name, merchant.Phone, merchant.Email, merchant.Password, merchant.RealName, merchant.RealID, merchant.LicenseImageID, merchant.Tag, merchant.CateID, businessTypeJSON, merchant.Score, merchant.CreateAt, _const.MerchantStatusPending)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			applog.MySQLLogger.Error("GetMerchantByID", "err", err)
@@ -210,3 +210,19 @@ func (r *MerchantRepo) IsExistsByPhone(ctx context.Context, phone string) (bool,
 	}
 	return exists, nil
 }
+
+// GetStatusByUserID 获取用户对应商家的审核状态, 直接读库, 审核后立即生效
+func (r *MerchantRepo) GetStatusByUserID(ctx context.Context, userID int64) (int, error) {
+	var status int
+	sqlStr := "select status from shop.merchant where userID = ?"
+
+	err := r.db.GetDB().GetContext(ctx, &status, sqlStr, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%w: merchant of user %d", err, userID)
+		}
+		applog.MySQLLogger.Error("GetStatusByUserID", "err", err)
+		return 0, fmt.Errorf("failed to get merchant status: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const oauthStateKeyPrefix = "oauth:state:"
+
+type OAuthStateRepoImpl struct {
+	rdb *redis.Client
+}
+
+func NewOAuthStateRepo(rdb *redis.Client) *OAuthStateRepoImpl {
+	return &OAuthStateRepoImpl{rdb: rdb}
+}
+
+func (r *OAuthStateRepoImpl) Save(ctx context.Context, state string, data *domain.OAuthState, ttl time.Duration) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oauth state: %w", err)
+	}
+	if err = r.rdb.Set(ctx, oauthStateKeyPrefix+state, value, ttl).Err(); err != nil {
+		applog.RedisLogger.Errorf("save oauth state failed, err: %v", err)
+		return fmt.Errorf("failed to save oauth state: %w", err)
+	}
+	return nil
+}
+
+func (r *OAuthStateRepoImpl) Take(ctx context.Context, state string) (*domain.OAuthState, error) {
+	value, err := r.rdb.GetDel(ctx, oauthStateKeyPrefix+state).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, domain.ErrOAuthStateInvalid
+	}
+	if err != nil {
+		applog.RedisLogger.Errorf("take oauth state failed, err: %v", err)
+		return nil, fmt.Errorf("failed to take oauth state: %w", err)
+	}
+	var data domain.OAuthState
+	if err = json.Unmarshal(value, &data); err != nil {
+		return nil, domain.ErrOAuthStateInvalid
+	}
+	return &data, nil
+}
@@ -9,6 +9,11 @@ type OrderRepo interface {
 	Create(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem) error
 	GetByID(ctx context.Context, orderID int64) (*domain.Order, *domain.OrderItem, error)
 	GetByCreatedAt(ctx context.Context, createdAt int64) ([]*domain.Order, error)
+	List(ctx context.Context, query *domain.OrderQuery, cursor *domain.OrderCursor) ([]*domain.OrderSummary, error)
 	UpdateStatus(ctx context.Context, order *domain.Order) error
+	// TransitionStatus 仅当订单当前状态为 from 时更新为 to, 状态已变化时返回 sql.ErrNoRows
+	TransitionStatus(ctx context.Context, id int64, from, to string) error
 	Delete(ctx context.Context, order *domain.Order) error
+	SaveDiscounts(ctx context.Context, orderID int64, discounts []domain.OrderDiscount) error
+	GetDiscounts(ctx context.Context, orderID int64) ([]domain.OrderDiscount, error)
 }
@@ -4,11 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/pkg/database"
 	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strings"
+	"time"
 )
 
+const orderColumns = "id, user_id, order_status, total_price, pay_price, shipping_fee, discount_price, created_at, updated_at, shipping_id"
+
 type OrderRepoImpl struct {
 	db    database.Database
 	cache *database.Redis
@@ -22,10 +29,10 @@ func NewOrderRepo(db database.Database, cache *database.Redis) *OrderRepoImpl {
 }
 
 func (r *OrderRepoImpl) Create(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem) error {
-	sqlStr := "insert into shop.orders (id, user_id, order_status, total_price, pay_price, created_at, shipping_id) values (?, ?, ?, ?, ?, ?, ?)"
+	sqlStr := "insert into shop.orders (id, user_id, order_status, total_price, pay_price, shipping_fee, discount_price, created_at, shipping_id) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	itemSqlStr := "insert into shop.order_items (order_id, product_id, product_title, unit_price, quantity, subtotal) values (?, ?, ?, ?, ?, ?)"
 
-	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, order.ID, order.UserID, order.OrderStatus, order.TotalPrice, order.PayPrice, order.CreatedAt, order.ShippingAddressID)
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, order.ID, order.UserID, order.OrderStatus, order.TotalPrice, order.PayPrice, order.ShippingFee, order.DiscountPrice, order.CreatedAt, order.ShippingAddressID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			applog.MySQLLogger.Warnf("create order failed, err: %v", err)
@@ -51,8 +58,8 @@ func (r *OrderRepoImpl) GetByID(ctx context.Context, orderID int64) (*domain.Ord
 	var order = &domain.Order{}
 	var orderItem = &domain.OrderItem{}
 
-	sqlStr := "select id, user_id, order_status, total_price, pay_price, created_at, shipping_id from shop.orders where id = ?"
-	ItemSqlStr := "select order_id, product_id, product_title, unit_price, quantity, subtotal from shop.order_items where order_id = ?"
+	sqlStr := "select " + orderColumns + " from shop.orders where id = ?"
+	ItemSqlStr := "select item_id, order_id, product_id, product_title, unit_price, quantity, subtotal from shop.order_items where order_id = ?"
 
 	err := r.db.GetDB().GetContext(ctx, order, sqlStr, orderID)
 	if err != nil {
@@ -77,14 +84,134 @@ func (r *OrderRepoImpl) GetByID(ctx context.Context, orderID int64) (*domain.Ord
 	return order, orderItem, nil
 }
 
+// GetByCreatedAt 获取 createdAt 之后创建的订单
 func (r *OrderRepoImpl) GetByCreatedAt(ctx context.Context, createdAt int64) ([]*domain.Order, error) {
-	//TODO implement me
-	panic("implement me")
+	var orders = make([]*domain.Order, 0)
+	sqlStr := "select " + orderColumns + " from shop.orders where created_at >= ? order by created_at desc, id desc"
+
+	err := r.db.GetDB().SelectContext(ctx, &orders, sqlStr, createdAt)
+	if err != nil {
+		applog.AppLogger.Errorf("get order by created_at failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get order by created_at: %w", err)
+	}
+	return orders, nil
+}
+
+// List 按条件分页查询订单及其订单项, 按 (created_at, id) 倒序, 返回 query.Limit 条
+func (r *OrderRepoImpl) List(ctx context.Context, query *domain.OrderQuery, cursor *domain.OrderCursor) ([]*domain.OrderSummary, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if query.UserID != 0 {
+		conds = append(conds, "o.user_id = ?")
+		args = append(args, query.UserID)
+	}
+	if query.MerchantID != 0 {
+		conds = append(conds, "exists (select 1 from shop.order_items mi join shop.product mp on mp.id = mi.product_id where mi.order_id = o.id and mp.merchant_id = ?)")
+		args = append(args, query.MerchantID)
+	}
+	if len(conds) == 0 && !query.All {
+		return nil, errors.New("order list requires user or merchant")
+	}
+	if query.Status != "" {
+		conds = append(conds, "o.order_status = ?")
+		args = append(args, query.Status)
+	}
+	if query.StartAt > 0 {
+		conds = append(conds, "o.created_at >= ?")
+		args = append(args, query.StartAt)
+	}
+	if query.EndAt > 0 {
+		conds = append(conds, "o.created_at < ?")
+		args = append(args, query.EndAt)
+	}
+	if query.Keyword != "" {
+		conds = append(conds, "exists (select 1 from shop.order_items ki where ki.order_id = o.id and ki.product_title like ?)")
+		args = append(args, "%"+escapeLike(query.Keyword)+"%")
+	}
+	if cursor != nil {
+		conds = append(conds, "(o.created_at < ? or (o.created_at = ? and o.id < ?))")
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+	args = append(args, query.Limit)
+
+	sqlStr := "select " + prefixColumns("o.", orderColumns) + " from shop.orders o"
+	if len(conds) > 0 {
+		sqlStr += " where " + strings.Join(conds, " and ")
+	}
+	sqlStr += " order by o.created_at desc, o.id desc limit ?"
+
+	var orders = make([]*domain.Order, 0)
+	if err := r.db.GetDB().SelectContext(ctx, &orders, sqlStr, args...); err != nil {
+		applog.AppLogger.Errorf("list order failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list order: %w", err)
+	}
+	summaries := make([]*domain.OrderSummary, 0, len(orders))
+	if len(orders) == 0 {
+		return summaries, nil
+	}
+
+	ids := make([]int64, 0, len(orders))
+	summaryMap := make(map[int64]*domain.OrderSummary, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+		summary := &domain.OrderSummary{Order: o, Items: make([]*domain.OrderListItem, 0)}
+		summaries = append(summaries, summary)
+		summaryMap[o.ID] = summary
+	}
+
+	// 订单项附带商品首图作为缩略图; 商家只能看到自己商品的订单项
+	itemSqlStr := "select i.item_id, i.order_id, i.product_id, i.product_title, i.unit_price, i.quantity, i.subtotal, " +
+		"coalesce((select img.imageID from shop.images img where img.ownerType = ? and img.ownerID = i.product_id and img.status = ? " +
+		"order by img.create_at, img.imageID limit 1), 0) as thumbnail_id " +
+		"from shop.order_items i where i.order_id in (?)"
+	itemArgs := []interface{}{_const.ProductModel, _const.StatusNotDeleted, ids}
+	if query.MerchantID != 0 {
+		itemSqlStr += " and i.product_id in (select id from shop.product where merchant_id = ?)"
+		itemArgs = append(itemArgs, query.MerchantID)
+	}
+	inSql, inArgs, err := sqlx.In(itemSqlStr, itemArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build order item query: %w", err)
+	}
+
+	var items = make([]*domain.OrderListItem, 0)
+	if err = r.db.GetDB().SelectContext(ctx, &items, r.db.GetDB().Rebind(inSql), inArgs...); err != nil {
+		applog.AppLogger.Errorf("list order item failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list order item: %w", err)
+	}
+	for _, item := range items {
+		if item.ThumbnailID != 0 {
+			item.Thumbnail = domain.ImageURL(item.ThumbnailID, domain.ImageSizeThumbnail)
+		}
+		if summary, ok := summaryMap[item.OrderID]; ok {
+			summary.Items = append(summary.Items, item)
+		}
+	}
+	return summaries, nil
 }
 
 func (r *OrderRepoImpl) UpdateStatus(ctx context.Context, order *domain.Order) error {
-	//TODO implement me
-	panic("implement me")
+	sqlStr := "update shop.orders set order_status = ?, updated_at = ? where id = ?"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, order.OrderStatus, time.Now().Unix(), order.ID)
+	if err != nil {
+		applog.AppLogger.Errorf("update order status failed, err: %v", err)
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	return nil
+}
+
+func (r *OrderRepoImpl) TransitionStatus(ctx context.Context, id int64, from, to string) error {
+	sqlStr := "update shop.orders set order_status = ?, updated_at = ? where id = ? and order_status = ?"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, to, time.Now().Unix(), id, from)
+	if err != nil {
+		applog.AppLogger.Errorf("transition order status failed, err: %v", err)
+		return fmt.Errorf("failed to transition order status: %w", err)
+	}
+	return expectAffected(result, fmt.Sprintf("order %d with status %s", id, from))
 }
 
 func (r *OrderRepoImpl) Delete(ctx context.Context, order *domain.Order) error {
@@ -113,3 +240,29 @@ func (r *OrderRepoImpl) Delete(ctx context.Context, order *domain.Order) error {
 
 	return nil
 }
+
+// SaveDiscounts 保存订单优惠明细
+func (r *OrderRepoImpl) SaveDiscounts(ctx context.Context, orderID int64, discounts []domain.OrderDiscount) error {
+	sqlStr := "insert into shop.order_discounts (order_id, user_coupon_id, coupon_id, coupon_type, amount) values (?, ?, ?, ?, ?)"
+
+	for _, d := range discounts {
+		_, err := r.db.GetDB().ExecContext(ctx, sqlStr, orderID, d.UserCouponID, d.CouponID, d.CouponType, d.Amount)
+		if err != nil {
+			applog.AppLogger.Errorf("save order discount failed, err: %v", err)
+			return fmt.Errorf("failed to save order discount: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *OrderRepoImpl) GetDiscounts(ctx context.Context, orderID int64) ([]domain.OrderDiscount, error) {
+	var discounts = make([]domain.OrderDiscount, 0)
+	sqlStr := "select id, order_id, user_coupon_id, coupon_id, coupon_type, amount from shop.order_discounts where order_id = ?"
+
+	err := r.db.GetDB().SelectContext(ctx, &discounts, sqlStr, orderID)
+	if err != nil {
+		applog.AppLogger.Errorf("get order discount failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get order discount: %w", err)
+	}
+	return discounts, nil
+}
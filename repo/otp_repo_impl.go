@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const otpKeyPrefix = "otp:"
+
+// verifyOTPScript 原子地校验验证码. 返回 1 表示通过, 0 表示不存在或已过期, -1 表示错误, -2 表示错误次数过多已作废
+var verifyOTPScript = redis.NewScript(`
+local stored = redis.call('HGET', KEYS[1], 'hash')
+if not stored then
+	return 0
+end
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+	return -2
+end
+return -1
+`)
+
+type OTPRepoImpl struct {
+	rdb *redis.Client
+}
+
+func NewOTPRepo(rdb *redis.Client) *OTPRepoImpl {
+	return &OTPRepoImpl{rdb: rdb}
+}
+
+func otpKey(purpose, target string) string {
+	return otpKeyPrefix + purpose + ":" + target
+}
+
+func (r *OTPRepoImpl) Cooldown(ctx context.Context, purpose, target string, interval time.Duration) error {
+	ok, err := r.rdb.SetNX(ctx, otpKey(purpose, target)+":cooldown", 1, interval).Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("set otp cooldown failed, err: %v", err)
+		return fmt.Errorf("failed to set otp cooldown: %w", err)
+	}
+	if !ok {
+		return domain.ErrOTPTooFrequent
+	}
+	return nil
+}
+
+func (r *OTPRepoImpl) ResetCooldown(ctx context.Context, purpose, target string) error {
+	if err := r.rdb.Del(ctx, otpKey(purpose, target)+":cooldown").Err(); err != nil {
+		applog.RedisLogger.Errorf("reset otp cooldown failed, err: %v", err)
+		return fmt.Errorf("failed to reset otp cooldown: %w", err)
+	}
+	return nil
+}
+
+func (r *OTPRepoImpl) Save(ctx context.Context, purpose, target, codeHash string, ttl time.Duration) error {
+	key := otpKey(purpose, target)
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "hash", codeHash, "attempts", 0)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("save otp failed, err: %v", err)
+		return fmt.Errorf("failed to save otp: %w", err)
+	}
+	return nil
+}
+
+func (r *OTPRepoImpl) Verify(ctx context.Context, purpose, target, codeHash string, maxAttempts int) error {
+	result, err := verifyOTPScript.Run(ctx, r.rdb, []string{otpKey(purpose, target)}, codeHash, maxAttempts).Int()
+	if err != nil {
+		applog.RedisLogger.Errorf("verify otp failed, err: %v", err)
+		return fmt.Errorf("failed to verify otp: %w", err)
+	}
+	switch result {
+	case 1:
+		return nil
+	case 0:
+		return domain.ErrOTPExpired
+	case -2:
+		applog.AppLogger.Warnf("otp of %s (%s) invalidated after %d wrong attempts", target, purpose, maxAttempts)
+		return domain.ErrOTPAttemptsExceeded
+	}
+	return domain.ErrOTPInvalid
+}
@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+type OutboxRepo interface {
+	// Claim 按 ID 顺序领取 aggregate 最多 limit 个到期的待处理事件, 并将其下次处理时间推迟到 leaseUntil 作为租约,
+	// 多个实例不会同时领取到同一事件, 租约到期仍未完成的事件可以被重新领取
+	Claim(ctx context.Context, aggregate string, now, leaseUntil int64, limit int) ([]*domain.OutboxEvent, error)
+
+	// Complete 删除处理成功的事件
+	Complete(ctx context.Context, ids []int64) error
+
+	// Fail 记录处理失败的事件的尝试次数、下次处理时间、状态和失败原因
+	Fail(ctx context.Context, event *domain.OutboxEvent) error
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+// maxOutboxErrorLen 失败原因的最大长度, 与 outbox_event.last_error 一致
+const maxOutboxErrorLen = 512
+
+type OutboxRepoImpl struct {
+	db database.Database
+}
+
+func NewOutboxRepo(db database.Database) *OutboxRepoImpl {
+	return &OutboxRepoImpl{db: db}
+}
+
+// addProductChanged 在 tx 中写入商品变更事件, 与商品或库存的修改一起提交
+func addProductChanged(ctx context.Context, tx *sqlx.Tx, productID int64) error {
+	now := time.Now().Unix()
+	sqlStr := "insert into shop.outbox_event (aggregate, aggregate_id, event_type, status, next_attempt_at, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?)"
+	if _, err := tx.ExecContext(ctx, sqlStr, domain.AggregateProduct, productID, domain.EventProductChanged, _const.OutboxStatusPending, now, now, now); err != nil {
+		applog.MySQLLogger.Errorf("add outbox event failed, product id: %d, err: %v", productID, err)
+		return fmt.Errorf("failed to add outbox event: %w", err)
+	}
+	return nil
+}
+
+// execProductChange 在同一事务中执行修改商品或库存的语句并写入商品变更事件
+func execProductChange(ctx context.Context, db database.Database, productID int64, sqlStr string, args ...any) (sql.Result, error) {
+	return execProductTx(ctx, db, productID, false, sqlStr, args...)
+}
+
+// execStockChange 与 execProductChange 相同, 并更新商品的 updated_at, 使索引比对能发现有货状态的变化
+func execStockChange(ctx context.Context, db database.Database, productID int64, sqlStr string, args ...any) (sql.Result, error) {
+	return execProductTx(ctx, db, productID, true, sqlStr, args...)
+}
+
+func execProductTx(ctx context.Context, db database.Database, productID int64, touch bool, sqlStr string, args ...any) (sql.Result, error) {
+	tx, err := db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return nil, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	if touch {
+		if _, err = tx.ExecContext(ctx, "update shop.product set updated_at = ? where id = ?", time.Now().Unix(), productID); err != nil {
+			applog.MySQLLogger.Errorf("touch product failed, product id: %d, err: %v", productID, err)
+			return nil, fmt.Errorf("failed to touch product: %w", err)
+		}
+	}
+	if err = addProductChanged(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return nil, fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return result, nil
+}
+
+func (r *OutboxRepoImpl) Claim(ctx context.Context, aggregate string, now, leaseUntil int64, limit int) ([]*domain.OutboxEvent, error) {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return nil, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var events = make([]*domain.OutboxEvent, 0)
+	sqlStr := "select id, aggregate, aggregate_id, event_type, status, attempts, next_attempt_at, last_error, created_at, updated_at from shop.outbox_event " +
+		"where aggregate = ? and status = ? and next_attempt_at <= ? order by id limit ? for update skip locked"
+	if err = tx.SelectContext(ctx, &events, sqlStr, aggregate, _const.OutboxStatusPending, now, limit); err != nil {
+		applog.MySQLLogger.Errorf("claim outbox events failed, err: %v", err)
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	ids := make([]int64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	sqlStr, args, err := sqlx.In("update shop.outbox_event set next_attempt_at = ? where id in (?)", leaseUntil, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, tx.Rebind(sqlStr), args...); err != nil {
+		applog.MySQLLogger.Errorf("lease outbox events failed, err: %v", err)
+		return nil, fmt.Errorf("failed to lease outbox events: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return nil, fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return events, nil
+}
+
+func (r *OutboxRepoImpl) Complete(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	sqlStr, args, err := sqlx.In("delete from shop.outbox_event where id in (?)", ids)
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err = r.db.GetDB().ExecContext(ctx, r.db.GetDB().Rebind(sqlStr), args...); err != nil {
+		applog.MySQLLogger.Errorf("complete outbox events failed, err: %v", err)
+		return fmt.Errorf("failed to complete outbox events: %w", err)
+	}
+	return nil
+}
+
+func (r *OutboxRepoImpl) Fail(ctx context.Context, event *domain.OutboxEvent) error {
+	lastError := []rune(event.LastError)
+	if len(lastError) > maxOutboxErrorLen {
+		lastError = lastError[:maxOutboxErrorLen]
+	}
+	sqlStr := "update shop.outbox_event set status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ? where id = ?"
+	if _, err := r.db.GetDB().ExecContext(ctx, sqlStr, event.Status, event.Attempts, event.NextAttemptAt, string(lastError), event.UpdatedAt, event.ID); err != nil {
+		applog.MySQLLogger.Errorf("fail outbox event failed, id: %d, err: %v", event.ID, err)
+		return fmt.Errorf("failed to update outbox event: %w", err)
+	}
+	return nil
+}
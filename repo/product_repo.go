@@ -16,6 +16,12 @@ type ProductRepo interface {
 	GetByTitleAndKeywords(ctx context.Context, title, keywords string, offset int) ([]*domain.Product, error)
 	GetMerchantID(ctx context.Context, id int64) (int64, error)
 	SearchByMsg(ctx context.Context, msg string) ([]domain.Product, error)
+	GetByIDs(ctx context.Context, ids []int64) ([]*domain.Product, error)
+	ListForIndex(ctx context.Context, afterID int64, limit int) ([]*domain.Product, error)
+	ListIndexState(ctx context.Context, afterID int64, limit int) ([]*domain.Product, error)
+	GetAvailableStock(ctx context.Context, ids []int64) (map[int64]int64, error)
+	GetCateSubtree(ctx context.Context, ids []int64) ([]int64, error)
+	ListCates(ctx context.Context) ([]*domain.ProductCate, error)
 	//GetByKeywords(ctx context.Context, keywords string) ([]*domain.Product, error)
 	Update(ctx context.Context, product *domain.Product) error
 	Delete(ctx context.Context, id int64) error
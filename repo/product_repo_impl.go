@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/pkg/database"
@@ -27,9 +28,21 @@ func (r *ProductRepoImpl) Create(ctx context.Context, product *domain.Product) (
 	//	log.AppLogger.Errorf("序列化图片id失败: %d", product.ImageID)
 	//}
 
-	sqlStr := "insert into shop.product (merchant_id, title, sub_title, brand, product_sn, cate_id, product_num, price, market_price, attr, version, keywords, `desc`, content, created_at, is_best, is_new, is_booking, product_type_id, sort, status) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	if product.CreatedAt == 0 {
+		product.CreatedAt = int(time.Now().Unix())
+	}
+	product.UpdatedAt = product.CreatedAt
+
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		log.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	sqlStr := "insert into shop.product (merchant_id, title, sub_title, brand, product_sn, cate_id, product_num, price, market_price, attr, version, keywords, `desc`, content, created_at, updated_at, is_best, is_new, is_booking, product_type_id, sort, status) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
 
-	result, err := r.db.GetDB().ExecContext(ctx, sqlStr,
+	result, err := tx.ExecContext(ctx, sqlStr,
 		product.MerchantID,
 		product.Title,
 		//jsonImage,
@@ -46,6 +59,7 @@ func (r *ProductRepoImpl) Create(ctx context.Context, product *domain.Product) (
 		product.Desc,
 		product.Content,
 		product.CreatedAt,
+		product.UpdatedAt,
 		product.IsBest,
 		product.IsNew,
 		product.IsBooking,
@@ -67,7 +81,14 @@ func (r *ProductRepoImpl) Create(ctx context.Context, product *domain.Product) (
 		log.AppLogger.Errorf("product repo error: %v", err)
 		return 0, fmt.Errorf("failed to get product: %w", err)
 	}
+	if err = addProductChanged(ctx, tx, id); err != nil {
+		return 0, err
+	}
 
+	if err = tx.Commit(); err != nil {
+		log.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return 0, fmt.Errorf("failed to commit tx: %w", err)
+	}
 	return id, nil
 }
 
@@ -77,7 +98,7 @@ func (r *ProductRepoImpl) Create(ctx context.Context, product *domain.Product) (
 
 func (r *ProductRepoImpl) GetByID(ctx context.Context, id int64) (*domain.Product, error) {
 	var product = &domain.Product{}
-	sqlStr := "select id, merchant_id, title, sub_title, brand, product_sn, cate_id, click_count, purchase_count, product_num, price, market_price, attr, version, keywords, `desc`, content, is_deleted, created_at, updated_at, deleted_at, is_hot, is_best, is_new, is_booking, product_type_id, sort, status from shop.product where id = ?"
+	sqlStr := "select " + productColumns + " from shop.product where id = ?"
 
 	err := r.db.GetDB().GetContext(ctx, product, sqlStr, id)
 	if err != nil {
@@ -162,10 +183,101 @@ func (r *ProductRepoImpl) GetByCateIDsAndHot(ctx context.Context, ids []int64) (
 	return products, nil
 }
 
+// productColumns 商品详情查询的字段
+const productColumns = "id, merchant_id, title, sub_title, brand, product_sn, cate_id, click_count, purchase_count, product_num, price, market_price, attr, version, keywords, `desc`, content, is_deleted, created_at, updated_at, deleted_at, is_hot, is_best, is_new, is_booking, product_type_id, sort, status, rating, rating_count"
+
+// GetByIDs 批量获取未删除的商品, 结果不保证与 ids 顺序一致
+func (r *ProductRepoImpl) GetByIDs(ctx context.Context, ids []int64) ([]*domain.Product, error) {
+	var products = []*domain.Product{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+	sqlStr, args, err := sqlx.In("select "+productColumns+" from shop.product where id in (?) and is_deleted = 0", ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+	if err = r.db.GetDB().SelectContext(ctx, &products, r.db.GetDB().Rebind(sqlStr), args...); err != nil {
+		log.AppLogger.Errorf("product repo error: %v", err)
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+	return products, nil
+}
+
+// ListForIndex 按 ID 升序分批获取上架中的商品, 用于重建搜索索引
+func (r *ProductRepoImpl) ListForIndex(ctx context.Context, afterID int64, limit int) ([]*domain.Product, error) {
+	var products = []*domain.Product{}
+	sqlStr := "select " + productColumns + " from shop.product where id > ? and status = ? and is_deleted = 0 order by id limit ?"
+	if err := r.db.GetDB().SelectContext(ctx, &products, sqlStr, afterID, _const.ProductStatusOnSale, limit); err != nil {
+		log.AppLogger.Errorf("product repo error: %v", err)
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	return products, nil
+}
+
+// ListIndexState 按 ID 升序分批获取全部商品(含已删除)的 ID、状态和更新时间, 用于比对搜索索引
+func (r *ProductRepoImpl) ListIndexState(ctx context.Context, afterID int64, limit int) ([]*domain.Product, error) {
+	var products = []*domain.Product{}
+	sqlStr := "select id, status, is_deleted, updated_at from shop.product where id > ? order by id limit ?"
+	if err := r.db.GetDB().SelectContext(ctx, &products, sqlStr, afterID, limit); err != nil {
+		log.AppLogger.Errorf("product repo error: %v", err)
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	return products, nil
+}
+
+// GetAvailableStock 批量获取商品的可用库存, 没有库存记录的商品不在结果中
+func (r *ProductRepoImpl) GetAvailableStock(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	stocks := make(map[int64]int64, len(ids))
+	if len(ids) == 0 {
+		return stocks, nil
+	}
+	sqlStr, args, err := sqlx.In("select product_id, available_stock from shop.inventory where product_id in (?)", ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+	var rows []domain.Inventory
+	if err = r.db.GetDB().SelectContext(ctx, &rows, r.db.GetDB().Rebind(sqlStr), args...); err != nil {
+		log.AppLogger.Errorf("product repo error: %v", err)
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+	for _, row := range rows {
+		stocks[row.ProductID] = row.AvailableStock
+	}
+	return stocks, nil
+}
+
+// GetCateSubtree 获取分类及其全部子孙分类的ID
+func (r *ProductRepoImpl) GetCateSubtree(ctx context.Context, ids []int64) ([]int64, error) {
+	var cateIDs = []int64{}
+	if len(ids) == 0 {
+		return cateIDs, nil
+	}
+	sqlStr, args, err := sqlx.In("with recursive subtree (id) as (select id from shop.product_cate where id in (?) union select c.id from shop.product_cate c join subtree s on c.pid = s.id) select id from subtree", ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+	if err = r.db.GetDB().SelectContext(ctx, &cateIDs, r.db.GetDB().Rebind(sqlStr), args...); err != nil {
+		log.AppLogger.Errorf("product repo error: %v", err)
+		return nil, fmt.Errorf("failed to get category subtree: %w", err)
+	}
+	return cateIDs, nil
+}
+
+// ListCates 获取启用的商品分类
+func (r *ProductRepoImpl) ListCates(ctx context.Context) ([]*domain.ProductCate, error) {
+	var cates = []*domain.ProductCate{}
+	sqlStr := "select id, title, pid, sort, status from shop.product_cate where status = 1 order by sort, id"
+	if err := r.db.GetDB().SelectContext(ctx, &cates, sqlStr); err != nil {
+		log.AppLogger.Errorf("product repo error: %v", err)
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+	return cates, nil
+}
+
 // SearchByMsg 搜索商品
 func (r *ProductRepoImpl) SearchByMsg(ctx context.Context, msg string) ([]domain.Product, error) {
 	var products = []domain.Product{}
-	sqlStr := "select id, merchant_id, title, sub_title,  brand, product_sn, cate_id, click_count, purchase_count, product_num, price, market_price, attr, version, `desc`, content, is_deleted, created_at, updated_at, deleted_at, is_hot, is_best, is_new, is_booking, product_type_id, sort, status from shop.product where title like ? or keywords like ?"
+	sqlStr := "select id, merchant_id, title, sub_title,  brand, product_sn, cate_id, click_count, purchase_count, product_num, price, market_price, attr, version, `desc`, content, is_deleted, created_at, updated_at, deleted_at, is_hot, is_best, is_new, is_booking, product_type_id, sort, status from shop.product where (title like ? or keywords like ?) and is_deleted = 0 limit 30"
 
 	err := r.db.GetDB().SelectContext(ctx, &products, sqlStr, "%"+msg+"%", "%"+msg+"%")
 	if err != nil {
@@ -179,10 +291,12 @@ func (r *ProductRepoImpl) SearchByMsg(ctx context.Context, msg string) ([]domain
 	return products, nil
 }
 
+// Update 更新商品并写入商品变更事件, updated_at 取当前时间
 func (r *ProductRepoImpl) Update(ctx context.Context, product *domain.Product) error {
 	sqlStr := "update shop.product set title = ?, sub_title = ?, cate_id = ?, price = ?, market_price = ?, attr = ?, version = ?, `desc` = ?, content = ?, updated_at = ?, is_best = ?, is_booking = ?, product_type_id = ?, status = ? where id = ?"
 
-	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, product.Title, product.SubTitle, product.CateID, product.Price, product.MarketPrice, product.Attr, product.Version, product.Desc, product.Content, product.UpdatedAt, product.IsBest, product.IsBooking, product.ProductTypeID, product.Status, product.ID)
+	product.UpdatedAt = int(time.Now().Unix())
+	_, err := execProductChange(ctx, r.db, product.ID, sqlStr, product.Title, product.SubTitle, product.CateID, product.Price, product.MarketPrice, product.Attr, product.Version, product.Desc, product.Content, product.UpdatedAt, product.IsBest, product.IsBooking, product.ProductTypeID, product.Status, product.ID)
 	if err != nil {
 		log.AppLogger.Errorf("product repo error: %v", err)
 		return fmt.Errorf("failed to update product: %w", err)
@@ -190,11 +304,12 @@ func (r *ProductRepoImpl) Update(ctx context.Context, product *domain.Product) e
 	return nil
 }
 
+// Delete 软删除商品并写入商品变更事件
 func (r *ProductRepoImpl) Delete(ctx context.Context, id int64) error {
-	sqlstr := "update shop.product set is_deleted = 1, deleted_at = ?, status = ? where id = ?"
+	sqlstr := "update shop.product set is_deleted = 1, deleted_at = ?, updated_at = ?, status = ? where id = ?"
 
 	now := int(time.Now().Unix())
-	_, err := r.db.GetDB().ExecContext(ctx, sqlstr, now, _const.StatusDeleted, id)
+	_, err := execProductChange(ctx, r.db, id, sqlstr, now, now, _const.StatusDeleted, id)
 	if err != nil {
 		log.AppLogger.Errorf("product repo error: %v", err)
 		return fmt.Errorf("failed to delete product: %w", err)
@@ -0,0 +1,21 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+// RBACRepo 角色与权限数据库接口
+type RBACRepo interface {
+	CreateRole(ctx context.Context, role *domain.Role) (int64, error)
+	GetRole(ctx context.Context, id int64) (*domain.Role, error)
+	ListRoles(ctx context.Context) ([]*domain.Role, error)
+	UpdateRole(ctx context.Context, role *domain.Role) error
+	DeleteRole(ctx context.Context, id int64) error
+	ListPermissions(ctx context.Context) ([]*domain.Auth, error)
+	GetRolePermissions(ctx context.Context, roleID int64) ([]*domain.Auth, error)
+	SetRolePermissions(ctx context.Context, roleID int64, permissionIDs []int64, operatorID int64) error
+	AssignRole(ctx context.Context, userRole *domain.UserRole) error
+	RevokeRole(ctx context.Context, userType, userID, roleID int64) error
+	GetSubjectPermissions(ctx context.Context, userType, userID int64) (map[string]struct{}, error)
+}
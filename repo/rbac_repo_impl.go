@@ -0,0 +1,295 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const (
+	roleColumns = "id, name, code, description, status, is_system, sort, created_at, updated_at, created_by, updated_by"
+	authColumns = "id, module_name, action_name, type, method, url, module_id, sort, description, status, create_time, update_time, update_user"
+
+	// 角色或权限变更时递增版本号, 使所有身份的权限缓存失效
+	rbacVersionKey     = "rbac:version"
+	rbacPermKeyPrefix  = "rbac:perm:"
+	rbacPermissionsTTL = 10 * time.Minute
+)
+
+type RBACRepoImpl struct {
+	db    database.Database
+	cache *database.Redis
+}
+
+func NewRBACRepo(db database.Database, cache *database.Redis) *RBACRepoImpl {
+	return &RBACRepoImpl{
+		db:    db,
+		cache: cache,
+	}
+}
+
+func (r *RBACRepoImpl) CreateRole(ctx context.Context, role *domain.Role) (int64, error) {
+	sqlStr := "insert into shop.sys_role (name, code, description, status, is_system, sort, created_at, updated_at, created_by, updated_by) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, role.Name, role.Code, role.Description, role.Status, role.IsSystem, role.Sort, role.CreatedAt, role.UpdatedAt, role.CreatedBy, role.UpdatedBy)
+	if err != nil {
+		applog.AppLogger.Errorf("create role failed, err: %v", err)
+		return 0, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		applog.MySQLLogger.Errorf("get role id failed, err: %v", err)
+		return 0, fmt.Errorf("failed to get role id: %w", err)
+	}
+	return id, nil
+}
+
+func (r *RBACRepoImpl) GetRole(ctx context.Context, id int64) (*domain.Role, error) {
+	var role = &domain.Role{}
+	sqlStr := "select " + roleColumns + " from shop.sys_role where id = ?"
+
+	err := r.db.GetDB().GetContext(ctx, role, sqlStr, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			applog.MySQLLogger.Warnf("role not found (id: %d)", id)
+			return nil, fmt.Errorf("%w: role id %d", domain.ErrRoleNotFound, id)
+		}
+		applog.AppLogger.Errorf("role repo error: %v", err)
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return role, nil
+}
+
+func (r *RBACRepoImpl) ListRoles(ctx context.Context) ([]*domain.Role, error) {
+	var roles = make([]*domain.Role, 0)
+	sqlStr := "select " + roleColumns + " from shop.sys_role order by sort, id"
+
+	err := r.db.GetDB().SelectContext(ctx, &roles, sqlStr)
+	if err != nil {
+		applog.AppLogger.Errorf("list role failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list role: %w", err)
+	}
+	return roles, nil
+}
+
+func (r *RBACRepoImpl) UpdateRole(ctx context.Context, role *domain.Role) error {
+	sqlStr := "update shop.sys_role set name = ?, description = ?, status = ?, sort = ?, updated_at = ?, updated_by = ? where id = ?"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, role.Name, role.Description, role.Status, role.Sort, role.UpdatedAt, role.UpdatedBy, role.ID)
+	if err != nil {
+		applog.AppLogger.Errorf("update role failed, err: %v", err)
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+// DeleteRole 删除角色及其权限和用户关联, 系统内置角色不会被删除
+func (r *RBACRepoImpl) DeleteRole(ctx context.Context, id int64) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "delete from shop.sys_role where id = ? and is_system = 0", id)
+	if err != nil {
+		applog.AppLogger.Errorf("delete role failed, err: %v", err)
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	} else if n == 0 {
+		return domain.ErrSystemRole
+	}
+
+	if _, err = tx.ExecContext(ctx, "delete from shop.sys_role_permission where role_id = ?", id); err != nil {
+		applog.AppLogger.Errorf("delete role permission failed, err: %v", err)
+		return fmt.Errorf("failed to delete role permission: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, "delete from shop.sys_user_role where role_id = ?", id); err != nil {
+		applog.AppLogger.Errorf("delete user role failed, err: %v", err)
+		return fmt.Errorf("failed to delete user role: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+func (r *RBACRepoImpl) ListPermissions(ctx context.Context) ([]*domain.Auth, error) {
+	var auths = make([]*domain.Auth, 0)
+	sqlStr := "select " + authColumns + " from shop.sys_auth order by module_id, sort, id"
+
+	err := r.db.GetDB().SelectContext(ctx, &auths, sqlStr)
+	if err != nil {
+		applog.AppLogger.Errorf("list permission failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list permission: %w", err)
+	}
+	return auths, nil
+}
+
+func (r *RBACRepoImpl) GetRolePermissions(ctx context.Context, roleID int64) ([]*domain.Auth, error) {
+	var auths = make([]*domain.Auth, 0)
+	sqlStr := "select " + prefixColumns("a.", authColumns) + " from shop.sys_auth a join shop.sys_role_permission rp on rp.permission_id = a.id where rp.role_id = ? order by a.module_id, a.sort, a.id"
+
+	err := r.db.GetDB().SelectContext(ctx, &auths, sqlStr, roleID)
+	if err != nil {
+		applog.AppLogger.Errorf("get role permission failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get role permission: %w", err)
+	}
+	return auths, nil
+}
+
+// SetRolePermissions 以 permissionIDs 覆盖角色当前的权限
+func (r *RBACRepoImpl) SetRolePermissions(ctx context.Context, roleID int64, permissionIDs []int64, operatorID int64) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "delete from shop.sys_role_permission where role_id = ?", roleID); err != nil {
+		applog.AppLogger.Errorf("clear role permission failed, err: %v", err)
+		return fmt.Errorf("failed to clear role permission: %w", err)
+	}
+	for _, permissionID := range permissionIDs {
+		rp := domain.NewRolePermission(roleID, permissionID, operatorID)
+		_, err = tx.ExecContext(ctx, "insert ignore into shop.sys_role_permission (role_id, permission_id, created_at, created_by) values (?, ?, ?, ?)", rp.RoleID, rp.PermissionID, rp.CreatedAt, rp.CreatedBy)
+		if err != nil {
+			applog.AppLogger.Errorf("add role permission failed, err: %v", err)
+			return fmt.Errorf("failed to add role permission: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+func (r *RBACRepoImpl) AssignRole(ctx context.Context, userRole *domain.UserRole) error {
+	sqlStr := "insert ignore into shop.sys_user_role (user_type, user_id, role_id, created_at, created_by) values (?, ?, ?, ?, ?)"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, userRole.UserType, userRole.UserID, userRole.RoleID, userRole.CreatedAt, userRole.CreatedBy)
+	if err != nil {
+		applog.AppLogger.Errorf("assign role failed, err: %v", err)
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+func (r *RBACRepoImpl) RevokeRole(ctx context.Context, userType, userID, roleID int64) error {
+	sqlStr := "delete from shop.sys_user_role where user_type = ? and user_id = ? and role_id = ?"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, userType, userID, roleID)
+	if err != nil {
+		applog.AppLogger.Errorf("revoke role failed, err: %v", err)
+		return fmt.Errorf("failed to revoke role: %w", err)
+	}
+	r.invalidate(ctx)
+	return nil
+}
+
+// GetSubjectPermissions 获取身份拥有的全部权限匹配键, 包括身份类型对应的系统角色和额外分配的角色.
+// 结果缓存在 Redis 中, 角色或权限变更后自动失效
+func (r *RBACRepoImpl) GetSubjectPermissions(ctx context.Context, userType, userID int64) (map[string]struct{}, error) {
+	version, err := r.cache.GetCache().Get(ctx, rbacVersionKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		applog.RedisLogger.Warnf("get rbac version failed, err: %v", err)
+	}
+	cacheKey := fmt.Sprintf("%s%d:%d:%d", rbacPermKeyPrefix, version, userType, userID)
+
+	var keys []string
+	if data, err := r.cache.GetCache().Get(ctx, cacheKey).Bytes(); err == nil {
+		if err = json.Unmarshal(data, &keys); err == nil {
+			return toPermissionSet(keys), nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		applog.RedisLogger.Warnf("get permission cache failed, err: %v", err)
+	}
+
+	keys, err = r.loadSubjectPermissions(ctx, userType, userID)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(keys); err == nil {
+		if err = r.cache.GetCache().Set(ctx, cacheKey, data, rbacPermissionsTTL).Err(); err != nil {
+			applog.RedisLogger.Warnf("set permission cache failed, err: %v", err)
+		}
+	}
+	return toPermissionSet(keys), nil
+}
+
+func (r *RBACRepoImpl) loadSubjectPermissions(ctx context.Context, userType, userID int64) ([]string, error) {
+	// 管理员账号: 停用的没有任何权限, 超级管理员拥有全部权限, 另外还拥有账号上的额外角色
+	var extraRoleID int64
+	if userType == _const.AdminRole {
+		var admin = &domain.Admin{}
+		err := r.db.GetDB().GetContext(ctx, admin, "select status, is_super, role_id from shop.admin where id = ?", userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return []string{}, nil
+			}
+			applog.AppLogger.Errorf("get admin failed, err: %v", err)
+			return nil, fmt.Errorf("failed to get admin: %w", err)
+		}
+		if !admin.IsEnabled() {
+			return []string{}, nil
+		}
+		if admin.IsSuperAdmin() {
+			return []string{domain.PermissionAll}, nil
+		}
+		extraRoleID = admin.RoleID
+	}
+
+	var rows []struct {
+		Method string `db:"method"`
+		Url    string `db:"url"`
+	}
+	sqlStr := "select distinct a.method, a.url from shop.sys_auth a join shop.sys_role_permission rp on rp.permission_id = a.id join shop.sys_role r on r.id = rp.role_id " +
+		"where a.status = 1 and r.status = 1 and (r.code = ? or r.id = ? or r.id in (select role_id from shop.sys_user_role where user_type = ? and user_id = ?))"
+	err := r.db.GetDB().SelectContext(ctx, &rows, sqlStr, domain.SystemRoleCode(userType), extraRoleID, userType, userID)
+	if err != nil {
+		applog.AppLogger.Errorf("get subject permission failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get subject permission: %w", err)
+	}
+
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, domain.PermissionKey(row.Method, row.Url))
+	}
+	return keys, nil
+}
+
+// invalidate 使所有权限缓存失效
+func (r *RBACRepoImpl) invalidate(ctx context.Context) {
+	if err := r.cache.GetCache().Incr(ctx, rbacVersionKey).Err(); err != nil {
+		applog.RedisLogger.Errorf("invalidate permission cache failed, err: %v", err)
+	}
+}
+
+func toPermissionSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[key] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
+
+// SearchLogRepo 搜索词统计, 热门搜索和无结果搜索按天统计, 最近搜索按用户保存
+type SearchLogRepo interface {
+	// Record 记录一次搜索, 有结果时计入热门搜索, 否则计入无结果搜索; userID 为 0 时不记录最近搜索
+	Record(ctx context.Context, userID int64, query string, hits int64, now time.Time, recentLimit int) error
+
+	// Hot 返回最近 days 天搜索次数最多的搜索词
+	Hot(ctx context.Context, now time.Time, days, limit int) ([]domain.SearchQueryStat, error)
+
+	// ZeroResults 返回最近 days 天搜索次数最多的无结果搜索词
+	ZeroResults(ctx context.Context, now time.Time, days, limit int) ([]domain.SearchQueryStat, error)
+
+	// Recent 返回用户最近的搜索词, 新的在前
+	Recent(ctx context.Context, userID int64, limit int) ([]string, error)
+
+	// DeleteRecent 删除用户的一条最近搜索
+	DeleteRecent(ctx context.Context, userID int64, query string) error
+
+	// ClearRecent 清空用户的最近搜索
+	ClearRecent(ctx context.Context, userID int64) error
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"strconv"
+	"time"
+)
+
+// 热门搜索和无结果搜索每天一个有序集合, 分值为搜索次数; 最近搜索每个用户一个有序集合, 分值为搜索时间
+const (
+	searchHotKeyPrefix    = "search:hot:"
+	searchZeroKeyPrefix   = "search:zero:"
+	searchRecentKeyPrefix = "search:recent:"
+
+	searchDailyTTL  = 31 * 24 * time.Hour
+	searchRecentTTL = 90 * 24 * time.Hour
+)
+
+type SearchLogRepoImpl struct {
+	rdb *redis.Client
+}
+
+func NewSearchLogRepo(rdb *redis.Client) *SearchLogRepoImpl {
+	return &SearchLogRepoImpl{rdb: rdb}
+}
+
+func searchDayKey(prefix string, day time.Time) string {
+	return prefix + day.Format("20060102")
+}
+
+func searchRecentKey(userID int64) string {
+	return searchRecentKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+func (r *SearchLogRepoImpl) Record(ctx context.Context, userID int64, query string, hits int64, now time.Time, recentLimit int) error {
+	prefix := searchHotKeyPrefix
+	if hits == 0 {
+		prefix = searchZeroKeyPrefix
+	}
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		key := searchDayKey(prefix, now)
+		pipe.ZIncrBy(ctx, key, 1, query)
+		pipe.Expire(ctx, key, searchDailyTTL)
+		if userID > 0 {
+			key = searchRecentKey(userID)
+			pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixMilli()), Member: query})
+			pipe.ZRemRangeByRank(ctx, key, 0, int64(-recentLimit-1))
+			pipe.Expire(ctx, key, searchRecentTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("record search query failed, err: %v", err)
+		return fmt.Errorf("failed to record search query: %w", err)
+	}
+	return nil
+}
+
+func (r *SearchLogRepoImpl) Hot(ctx context.Context, now time.Time, days, limit int) ([]domain.SearchQueryStat, error) {
+	return r.top(ctx, searchHotKeyPrefix, now, days, limit)
+}
+
+func (r *SearchLogRepoImpl) ZeroResults(ctx context.Context, now time.Time, days, limit int) ([]domain.SearchQueryStat, error) {
+	return r.top(ctx, searchZeroKeyPrefix, now, days, limit)
+}
+
+// top 合并最近 days 天的统计, 返回次数最多的 limit 个搜索词
+func (r *SearchLogRepoImpl) top(ctx context.Context, prefix string, now time.Time, days, limit int) ([]domain.SearchQueryStat, error) {
+	keys := make([]string, 0, days)
+	for i := 0; i < days; i++ {
+		keys = append(keys, searchDayKey(prefix, now.AddDate(0, 0, -i)))
+	}
+	zs, err := r.rdb.ZUnionWithScores(ctx, redis.ZStore{Keys: keys}).Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("get search stats failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get search stats: %w", err)
+	}
+
+	// ZUNION 按分值升序返回
+	stats := make([]domain.SearchQueryStat, 0, min(limit, len(zs)))
+	for i := len(zs) - 1; i >= 0 && len(stats) < limit; i-- {
+		stats = append(stats, domain.SearchQueryStat{Query: fmt.Sprint(zs[i].Member), Count: int64(zs[i].Score)})
+	}
+	return stats, nil
+}
+
+func (r *SearchLogRepoImpl) Recent(ctx context.Context, userID int64, limit int) ([]string, error) {
+	queries, err := r.rdb.ZRevRange(ctx, searchRecentKey(userID), 0, int64(limit-1)).Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("get recent searches failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get recent searches: %w", err)
+	}
+	return queries, nil
+}
+
+func (r *SearchLogRepoImpl) DeleteRecent(ctx context.Context, userID int64, query string) error {
+	if err := r.rdb.ZRem(ctx, searchRecentKey(userID), query).Err(); err != nil {
+		applog.RedisLogger.Errorf("delete recent search failed, err: %v", err)
+		return fmt.Errorf("failed to delete recent search: %w", err)
+	}
+	return nil
+}
+
+func (r *SearchLogRepoImpl) ClearRecent(ctx context.Context, userID int64) error {
+	if err := r.rdb.Del(ctx, searchRecentKey(userID)).Err(); err != nil {
+		applog.RedisLogger.Errorf("clear recent searches failed, err: %v", err)
+		return fmt.Errorf("failed to clear recent searches: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+// ShipmentRepo 发货单数据库接口
+type ShipmentRepo interface {
+	Create(ctx context.Context, shipment *domain.Shipment) (int64, error)
+	GetByOrderID(ctx context.Context, orderID int64) ([]*domain.Shipment, error)
+	GetShippedItemIDs(ctx context.Context, orderID int64) ([]int64, error)
+	ListActive(ctx context.Context, limit int) ([]*domain.Shipment, error)
+	UpdateStatus(ctx context.Context, shipment *domain.Shipment) error
+	AddEvents(ctx context.Context, shipmentID int64, events []domain.ShipmentEvent) error
+	GetEvents(ctx context.Context, shipmentID int64) ([]domain.ShipmentEvent, error)
+	ListConfirmableOrders(ctx context.Context, deliveredBefore int64) ([]int64, error)
+}
@@ -0,0 +1,182 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const shipmentColumns = "id, order_id, merchant_id, carrier, tracking_no, status, shipped_at, delivered_at, created_at, updated_at"
+
+type ShipmentRepoImpl struct {
+	db    database.Database
+	cache *database.Redis
+}
+
+func NewShipmentRepo(db database.Database, cache *database.Redis) *ShipmentRepoImpl {
+	return &ShipmentRepoImpl{
+		db:    db,
+		cache: cache,
+	}
+}
+
+// Create 创建发货单及其包含的订单项
+func (r *ShipmentRepoImpl) Create(ctx context.Context, shipment *domain.Shipment) (int64, error) {
+	sqlStr := "insert into shop.shipments (order_id, merchant_id, carrier, tracking_no, status, shipped_at, created_at) values (?, ?, ?, ?, ?, ?, ?)"
+	itemSqlStr := "insert into shop.shipment_items (shipment_id, order_item_id) values (?, ?)"
+
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, sqlStr, shipment.OrderID, shipment.MerchantID, shipment.Carrier, shipment.TrackingNo, shipment.Status, shipment.ShippedAt, shipment.CreatedAt)
+	if err != nil {
+		applog.AppLogger.Errorf("create shipment failed, err: %v", err)
+		return 0, fmt.Errorf("failed to create shipment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get shipment id: %w", err)
+	}
+
+	for _, itemID := range shipment.ItemIDs {
+		if _, err = tx.ExecContext(ctx, itemSqlStr, id, itemID); err != nil {
+			applog.AppLogger.Errorf("create shipment item failed, err: %v", err)
+			return 0, fmt.Errorf("failed to create shipment item: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return 0, fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return id, nil
+}
+
+func (r *ShipmentRepoImpl) GetByOrderID(ctx context.Context, orderID int64) ([]*domain.Shipment, error) {
+	var shipments = make([]*domain.Shipment, 0)
+	sqlStr := "select " + shipmentColumns + " from shop.shipments where order_id = ? order by shipped_at"
+
+	err := r.db.GetDB().SelectContext(ctx, &shipments, sqlStr, orderID)
+	if err != nil {
+		applog.AppLogger.Errorf("get shipment failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get shipment: %w", err)
+	}
+	if len(shipments) == 0 {
+		return shipments, nil
+	}
+
+	ids := make([]int64, 0, len(shipments))
+	for _, s := range shipments {
+		ids = append(ids, s.ID)
+	}
+	query, args, err := sqlx.In("select shipment_id, order_item_id from shop.shipment_items where shipment_id in (?)", ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build shipment item query: %w", err)
+	}
+
+	var items []struct {
+		ShipmentID  int64 `db:"shipment_id"`
+		OrderItemID int64 `db:"order_item_id"`
+	}
+	if err = r.db.GetDB().SelectContext(ctx, &items, r.db.GetDB().Rebind(query), args...); err != nil {
+		applog.AppLogger.Errorf("get shipment item failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get shipment item: %w", err)
+	}
+
+	shipmentMap := make(map[int64]*domain.Shipment, len(shipments))
+	for _, s := range shipments {
+		shipmentMap[s.ID] = s
+	}
+	for _, item := range items {
+		if s, ok := shipmentMap[item.ShipmentID]; ok {
+			s.ItemIDs = append(s.ItemIDs, item.OrderItemID)
+		}
+	}
+	return shipments, nil
+}
+
+// GetShippedItemIDs 获取订单中已发货的订单项
+func (r *ShipmentRepoImpl) GetShippedItemIDs(ctx context.Context, orderID int64) ([]int64, error) {
+	var ids = make([]int64, 0)
+	sqlStr := "select si.order_item_id from shop.shipment_items si join shop.shipments s on s.id = si.shipment_id where s.order_id = ?"
+
+	err := r.db.GetDB().SelectContext(ctx, &ids, sqlStr, orderID)
+	if err != nil {
+		applog.AppLogger.Errorf("get shipped item failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get shipped item: %w", err)
+	}
+	return ids, nil
+}
+
+// ListActive 获取尚未签收的发货单, 用于同步物流轨迹
+func (r *ShipmentRepoImpl) ListActive(ctx context.Context, limit int) ([]*domain.Shipment, error) {
+	var shipments = make([]*domain.Shipment, 0)
+	sqlStr := "select " + shipmentColumns + " from shop.shipments where status <> ? order by updated_at limit ?"
+
+	err := r.db.GetDB().SelectContext(ctx, &shipments, sqlStr, _const.ShipmentStatusDelivered, limit)
+	if err != nil {
+		applog.AppLogger.Errorf("list active shipment failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list active shipment: %w", err)
+	}
+	return shipments, nil
+}
+
+func (r *ShipmentRepoImpl) UpdateStatus(ctx context.Context, shipment *domain.Shipment) error {
+	sqlStr := "update shop.shipments set status = ?, delivered_at = ?, updated_at = ? where id = ?"
+
+	_, err := r.db.GetDB().ExecContext(ctx, sqlStr, shipment.Status, shipment.DeliveredAt, time.Now().Unix(), shipment.ID)
+	if err != nil {
+		applog.AppLogger.Errorf("update shipment status failed, err: %v", err)
+		return fmt.Errorf("failed to update shipment status: %w", err)
+	}
+	return nil
+}
+
+// AddEvents 写入物流轨迹, 已存在的轨迹会被忽略
+func (r *ShipmentRepoImpl) AddEvents(ctx context.Context, shipmentID int64, events []domain.ShipmentEvent) error {
+	sqlStr := "insert ignore into shop.shipment_events (shipment_id, status, location, description, event_time, created_at) values (?, ?, ?, ?, ?, ?)"
+
+	now := time.Now().Unix()
+	for _, e := range events {
+		_, err := r.db.GetDB().ExecContext(ctx, sqlStr, shipmentID, e.Status, e.Location, e.Description, e.EventTime, now)
+		if err != nil {
+			applog.AppLogger.Errorf("add shipment event failed, err: %v", err)
+			return fmt.Errorf("failed to add shipment event: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *ShipmentRepoImpl) GetEvents(ctx context.Context, shipmentID int64) ([]domain.ShipmentEvent, error) {
+	var events = make([]domain.ShipmentEvent, 0)
+	sqlStr := "select id, shipment_id, status, location, description, event_time, created_at from shop.shipment_events where shipment_id = ? order by event_time"
+
+	err := r.db.GetDB().SelectContext(ctx, &events, sqlStr, shipmentID)
+	if err != nil {
+		applog.AppLogger.Errorf("get shipment event failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get shipment event: %w", err)
+	}
+	return events, nil
+}
+
+// ListConfirmableOrders 获取所有包裹均已签收, 且最后签收时间早于 deliveredBefore 的已发货订单
+func (r *ShipmentRepoImpl) ListConfirmableOrders(ctx context.Context, deliveredBefore int64) ([]int64, error) {
+	var ids = make([]int64, 0)
+	sqlStr := "select s.order_id from shop.shipments s join shop.orders o on o.id = s.order_id where o.order_status = ? group by s.order_id having min(s.status = ?) = 1 and max(s.delivered_at) < ?"
+
+	err := r.db.GetDB().SelectContext(ctx, &ids, sqlStr, _const.OrderStatusShipped, _const.ShipmentStatusDelivered, deliveredBefore)
+	if err != nil {
+		applog.AppLogger.Errorf("list confirmable order failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list confirmable order: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
+
+type SmsRepo interface {
+	// RecordSend 检查手机号和 IP 当天的发送次数并记录本次发送, 超出限额时返回
+	// domain.ErrSmsPhoneQuota 或 domain.ErrSmsIPQuota 且不记录
+	RecordSend(ctx context.Context, record *domain.UserSms, phoneLimit, ipLimit int) error
+
+	// RevertSend 撤销 RecordSend 记录的一次发送, 发送失败时退回额度
+	RevertSend(ctx context.Context, record *domain.UserSms) error
+}
+
+type OTPRepo interface {
+	// Cooldown 限制同一目标的发送间隔, 间隔内重复发送返回 domain.ErrOTPTooFrequent
+	Cooldown(ctx context.Context, purpose, target string, interval time.Duration) error
+
+	// ResetCooldown 清除发送间隔, 发送失败时允许立即重试
+	ResetCooldown(ctx context.Context, purpose, target string) error
+
+	// Save 保存验证码摘要, 覆盖之前未使用的验证码
+	Save(ctx context.Context, purpose, target, codeHash string, ttl time.Duration) error
+
+	// Verify 校验验证码摘要, 成功后验证码失效; 错误次数达到 maxAttempts 时验证码作废
+	Verify(ctx context.Context, purpose, target, codeHash string, maxAttempts int) error
+}
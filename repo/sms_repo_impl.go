@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+)
+
+type SmsRepoImpl struct {
+	db database.Database
+}
+
+func NewSmsRepo(db database.Database) *SmsRepoImpl {
+	return &SmsRepoImpl{db: db}
+}
+
+// RecordSend 在事务中锁定手机号和 IP 当天的记录后计数, 并发请求不会超出限额
+func (r *SmsRepoImpl) RecordSend(ctx context.Context, record *domain.UserSms, phoneLimit, ipLimit int) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var phoneCount, ipCount int
+	sqlStr := "select coalesce(sum(send_count), 0) from shop.user_sms where phone = ? and add_day = ? for update"
+	if err = tx.GetContext(ctx, &phoneCount, sqlStr, record.Phone, record.AddDay); err != nil {
+		applog.AppLogger.Errorf("count sms by phone failed, err: %v", err)
+		return fmt.Errorf("failed to count sms: %w", err)
+	}
+	if phoneLimit > 0 && phoneCount >= phoneLimit {
+		return domain.ErrSmsPhoneQuota
+	}
+	sqlStr = "select coalesce(sum(send_count), 0) from shop.user_sms where ip = ? and add_day = ? for update"
+	if err = tx.GetContext(ctx, &ipCount, sqlStr, record.IP, record.AddDay); err != nil {
+		applog.AppLogger.Errorf("count sms by ip failed, err: %v", err)
+		return fmt.Errorf("failed to count sms: %w", err)
+	}
+	if ipLimit > 0 && ipCount >= ipLimit {
+		return domain.ErrSmsIPQuota
+	}
+
+	var existing domain.UserSms
+	sqlStr = "select id, send_count from shop.user_sms where phone = ? and ip = ? and add_day = ?"
+	err = tx.GetContext(ctx, &existing, sqlStr, record.Phone, record.IP, record.AddDay)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		record.SendCount = 1
+		sqlStr = "insert into shop.user_sms (ip, phone, send_count, add_day, add_time, sign) values (?, ?, ?, ?, ?, ?)"
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, sqlStr, record.IP, record.Phone, record.SendCount, record.AddDay, record.AddTime, record.Sign); err == nil {
+			record.ID, err = result.LastInsertId()
+		}
+	case err == nil:
+		record.ID, record.SendCount = existing.ID, existing.SendCount+1
+		sqlStr = "update shop.user_sms set send_count = ?, add_time = ?, sign = ? where id = ?"
+		_, err = tx.ExecContext(ctx, sqlStr, record.SendCount, record.AddTime, record.Sign, record.ID)
+	}
+	if err != nil {
+		applog.AppLogger.Errorf("record sms failed, err: %v", err)
+		return fmt.Errorf("failed to record sms: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return nil
+}
+
+func (r *SmsRepoImpl) RevertSend(ctx context.Context, record *domain.UserSms) error {
+	sqlStr := "update shop.user_sms set send_count = send_count - 1 where id = ? and send_count > 0"
+	if _, err := r.db.GetDB().ExecContext(ctx, sqlStr, record.ID); err != nil {
+		applog.AppLogger.Errorf("revert sms failed, err: %v", err)
+		return fmt.Errorf("failed to revert sms: %w", err)
+	}
+	return nil
+}
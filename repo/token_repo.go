@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"time"
+)
+
+type TokenRepo interface {
+	// CreateSession 创建登录会话, refreshHash 为会话当前刷新 token 的摘要
+	CreateSession(ctx context.Context, session *domain.TokenSession, refreshHash string, ttl time.Duration) error
+
+	// GetSession 获取登录会话, 会话不存在时返回 domain.ErrRefreshTokenInvalid
+	GetSession(ctx context.Context, id string) (*domain.TokenSession, error)
+
+	// RotateRefresh 将会话的刷新 token 从 oldHash 轮换为 newHash.
+	// oldHash 已被轮换过时视为重放, 删除整个会话并返回 domain.ErrRefreshTokenReused
+	RotateRefresh(ctx context.Context, session *domain.TokenSession, oldHash, newHash string, ttl time.Duration) error
+
+	// DeleteSession 删除登录会话, 会话内的访问 token 和刷新 token 全部失效
+	DeleteSession(ctx context.Context, session *domain.TokenSession) error
+
+	// DeleteUserSessions 删除用户的全部登录会话
+	DeleteUserSessions(ctx context.Context, role, userID int64) error
+
+	// Deny 将访问 token 的 jti 加入黑名单, ttl 为 token 的剩余有效期
+	Deny(ctx context.Context, jti string, ttl time.Duration) error
+
+	// IsRevoked 访问 token 是否已注销: jti 在黑名单中, 或所属会话已被删除
+	IsRevoked(ctx context.Context, jti, sessionID string) (bool, error)
+}
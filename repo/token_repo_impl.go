@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const (
+	tokenSessionKeyPrefix  = "token:session:"  // 会话信息及当前刷新 token 摘要
+	tokenUserKeyPrefix     = "token:sessions:" // 用户的全部会话ID
+	tokenDenylistKeyPrefix = "token:deny:"     // 已注销的访问 token jti
+)
+
+// rotateRefreshScript 原子地轮换刷新 token. 返回 1 表示轮换成功, 0 表示 token 无效, -1 表示重放并已删除会话
+var rotateRefreshScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], 'current')
+if not cur then
+	return 0
+end
+if cur == ARGV[1] then
+	redis.call('HSET', KEYS[1], 'current', ARGV[2])
+	redis.call('SADD', KEYS[2], ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('PEXPIRE', KEYS[2], ARGV[3])
+	return 1
+end
+if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return -1
+end
+return 0
+`)
+
+type TokenRepoImpl struct {
+	rdb *redis.Client
+}
+
+func NewTokenRepo(rdb *redis.Client) *TokenRepoImpl {
+	return &TokenRepoImpl{rdb: rdb}
+}
+
+func sessionKey(id string) string {
+	return tokenSessionKeyPrefix + id
+}
+
+// usedRefreshKey 会话中已被轮换掉的刷新 token 摘要, 用于识别重放
+func usedRefreshKey(id string) string {
+	return tokenSessionKeyPrefix + id + ":used"
+}
+
+func userSessionsKey(role, userID int64) string {
+	return fmt.Sprintf("%s%d:%d", tokenUserKeyPrefix, role, userID)
+}
+
+func (r *TokenRepoImpl) CreateSession(ctx context.Context, session *domain.TokenSession, refreshHash string, ttl time.Duration) error {
+	key, userKey := sessionKey(session.ID), userSessionsKey(session.Role, session.UserID)
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", session.UserID, "user_name", session.UserName, "role", session.Role, "current", refreshHash)
+		pipe.Expire(ctx, key, ttl)
+		pipe.SAdd(ctx, userKey, session.ID)
+		pipe.Expire(ctx, userKey, ttl)
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("create token session failed, err: %v", err)
+		return fmt.Errorf("failed to create token session: %w", err)
+	}
+	return nil
+}
+
+func (r *TokenRepoImpl) GetSession(ctx context.Context, id string) (*domain.TokenSession, error) {
+	result := r.rdb.HGetAll(ctx, sessionKey(id))
+	values, err := result.Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("get token session failed, err: %v", err)
+		return nil, fmt.Errorf("failed to get token session: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, domain.ErrRefreshTokenInvalid
+	}
+
+	var session = &domain.TokenSession{ID: id}
+	if err = result.Scan(session); err != nil {
+		return nil, fmt.Errorf("failed to decode token session: %w", err)
+	}
+	return session, nil
+}
+
+func (r *TokenRepoImpl) RotateRefresh(ctx context.Context, session *domain.TokenSession, oldHash, newHash string, ttl time.Duration) error {
+	keys := []string{sessionKey(session.ID), usedRefreshKey(session.ID)}
+	result, err := rotateRefreshScript.Run(ctx, r.rdb, keys, oldHash, newHash, ttl.Milliseconds()).Int()
+	if err != nil {
+		applog.RedisLogger.Errorf("rotate refresh token failed, err: %v", err)
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	switch result {
+	case 1:
+		return r.rdb.Expire(ctx, userSessionsKey(session.Role, session.UserID), ttl).Err()
+	case -1:
+		applog.AppLogger.Warnf("refresh token reused, session %s of user %d (role %d) revoked", session.ID, session.UserID, session.Role)
+		if err = r.rdb.SRem(ctx, userSessionsKey(session.Role, session.UserID), session.ID).Err(); err != nil {
+			applog.RedisLogger.Warnf("remove token session failed, err: %v", err)
+		}
+		return domain.ErrRefreshTokenReused
+	}
+	return domain.ErrRefreshTokenInvalid
+}
+
+func (r *TokenRepoImpl) DeleteSession(ctx context.Context, session *domain.TokenSession) error {
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(session.ID), usedRefreshKey(session.ID))
+		pipe.SRem(ctx, userSessionsKey(session.Role, session.UserID), session.ID)
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("delete token session failed, err: %v", err)
+		return fmt.Errorf("failed to delete token session: %w", err)
+	}
+	return nil
+}
+
+func (r *TokenRepoImpl) DeleteUserSessions(ctx context.Context, role, userID int64) error {
+	userKey := userSessionsKey(role, userID)
+	ids, err := r.rdb.SMembers(ctx, userKey).Result()
+	if err != nil {
+		applog.RedisLogger.Errorf("list token session failed, err: %v", err)
+		return fmt.Errorf("failed to list token session: %w", err)
+	}
+
+	keys := make([]string, 0, 2*len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id), usedRefreshKey(id))
+	}
+	keys = append(keys, userKey)
+	if err = r.rdb.Del(ctx, keys...).Err(); err != nil {
+		applog.RedisLogger.Errorf("delete token session failed, err: %v", err)
+		return fmt.Errorf("failed to delete token session: %w", err)
+	}
+	return nil
+}
+
+func (r *TokenRepoImpl) Deny(ctx context.Context, jti string, ttl time.Duration) error {
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	if err := r.rdb.Set(ctx, tokenDenylistKeyPrefix+jti, 1, ttl).Err(); err != nil {
+		applog.RedisLogger.Errorf("deny token failed, err: %v", err)
+		return fmt.Errorf("failed to deny token: %w", err)
+	}
+	return nil
+}
+
+func (r *TokenRepoImpl) IsRevoked(ctx context.Context, jti, sessionID string) (bool, error) {
+	var denied, alive *redis.IntCmd
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if jti != "" {
+			denied = pipe.Exists(ctx, tokenDenylistKeyPrefix+jti)
+		}
+		if sessionID != "" {
+			alive = pipe.Exists(ctx, sessionKey(sessionID))
+		}
+		return nil
+	})
+	if err != nil {
+		applog.RedisLogger.Errorf("check token revocation failed, err: %v", err)
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if denied != nil && denied.Val() > 0 {
+		return true, nil
+	}
+	return alive != nil && alive.Val() == 0, nil
+}
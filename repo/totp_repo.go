@@ -0,0 +1,26 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+type TOTPRepo interface {
+	// Get 获取用户的 TOTP 配置, 不存在时返回 sql.ErrNoRows
+	Get(ctx context.Context, userID int64) (*domain.UserTOTP, error)
+
+	// SavePending 保存待激活的密钥, 覆盖之前未激活的密钥
+	SavePending(ctx context.Context, userID int64, secret string) error
+
+	// Enable 激活两步验证并替换全部恢复码
+	Enable(ctx context.Context, userID, step int64, recoveryHashes []string) error
+
+	// UseStep 记录已使用的时间步, 时间步不大于上次使用的值时返回 false
+	UseStep(ctx context.Context, userID, step int64) (bool, error)
+
+	// UseRecoveryCode 使用一个恢复码, 恢复码不存在或已使用时返回 false
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+
+	// Delete 关闭两步验证, 同时删除恢复码
+	Delete(ctx context.Context, userID int64) error
+}
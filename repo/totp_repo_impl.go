@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+type TOTPRepoImpl struct {
+	db database.Database
+}
+
+func NewTOTPRepo(db database.Database) *TOTPRepoImpl {
+	return &TOTPRepoImpl{db: db}
+}
+
+func (r *TOTPRepoImpl) Get(ctx context.Context, userID int64) (*domain.UserTOTP, error) {
+	var totp domain.UserTOTP
+	sqlStr := "select user_id, secret, enabled, last_step, created_at, updated_at from shop.user_totp where user_id = ?"
+	if err := r.db.GetDB().GetContext(ctx, &totp, sqlStr, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		applog.MySQLLogger.Errorf("get user totp failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to get user totp: %w", err)
+	}
+	return &totp, nil
+}
+
+func (r *TOTPRepoImpl) SavePending(ctx context.Context, userID int64, secret string) error {
+	now := time.Now().Unix()
+	// 已启用的密钥不会被覆盖
+	sqlStr := `insert into shop.user_totp (user_id, secret, enabled, last_step, created_at, updated_at) values (?, ?, 0, 0, ?, ?)
+		on duplicate key update secret = if(enabled, secret, values(secret)), updated_at = values(updated_at)`
+	if _, err := r.db.GetDB().ExecContext(ctx, sqlStr, userID, secret, now, now); err != nil {
+		applog.MySQLLogger.Errorf("save user totp failed, user id: %d, err: %v", userID, err)
+		return fmt.Errorf("failed to save user totp: %w", err)
+	}
+	return nil
+}
+
+func (r *TOTPRepoImpl) Enable(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	sqlStr := "update shop.user_totp set enabled = 1, last_step = ?, updated_at = ? where user_id = ? and enabled = 0"
+	result, err := tx.ExecContext(ctx, sqlStr, step, now, userID)
+	if err != nil {
+		applog.MySQLLogger.Errorf("enable user totp failed, user id: %d, err: %v", userID, err)
+		return fmt.Errorf("failed to enable user totp: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return domain.ErrTOTPAlreadyEnabled
+	}
+
+	if _, err = tx.ExecContext(ctx, "delete from shop.user_totp_recovery where user_id = ?", userID); err != nil {
+		applog.MySQLLogger.Errorf("delete recovery codes failed, user id: %d, err: %v", userID, err)
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	sqlStr = "insert into shop.user_totp_recovery (user_id, code_hash, used_at, created_at) values (?, ?, 0, ?)"
+	for _, hash := range recoveryHashes {
+		if _, err = tx.ExecContext(ctx, sqlStr, userID, hash, now); err != nil {
+			applog.MySQLLogger.Errorf("insert recovery code failed, user id: %d, err: %v", userID, err)
+			return fmt.Errorf("failed to insert recovery code: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return nil
+}
+
+func (r *TOTPRepoImpl) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	sqlStr := "update shop.user_totp set last_step = ?, updated_at = ? where user_id = ? and enabled = 1 and last_step < ?"
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, step, time.Now().Unix(), userID, step)
+	if err != nil {
+		applog.MySQLLogger.Errorf("update totp step failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to update totp step: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *TOTPRepoImpl) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	sqlStr := "update shop.user_totp_recovery set used_at = ? where user_id = ? and code_hash = ? and used_at = 0"
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, time.Now().Unix(), userID, codeHash)
+	if err != nil {
+		applog.MySQLLogger.Errorf("use recovery code failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *TOTPRepoImpl) Delete(ctx context.Context, userID int64) error {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "delete from shop.user_totp_recovery where user_id = ?", userID); err == nil {
+		_, err = tx.ExecContext(ctx, "delete from shop.user_totp where user_id = ?", userID)
+	}
+	if err != nil {
+		applog.MySQLLogger.Errorf("delete user totp failed, user id: %d, err: %v", userID, err)
+		return fmt.Errorf("failed to delete user totp: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return nil
+}
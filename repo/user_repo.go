@@ -15,9 +15,18 @@ type UserRepo interface {
 	// GetByEmail 根据邮箱获取用户
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 
+	// GetByPhone 根据手机号获取用户
+	GetByPhone(ctx context.Context, phone string) (*domain.User, error)
+
 	// GetPasswordByID 根据ID获取用户密码
 	GetPasswordByID(ctx context.Context, id int64) (string, error)
 
+	// GetStatusByID 根据ID获取用户状态
+	GetStatusByID(ctx context.Context, id int64) (int64, error)
+
+	// GetStatusAndRoleByID 获取用户状态和角色, 封禁时按角色吊销会话
+	GetStatusAndRoleByID(ctx context.Context, id int64) (status, role int64, err error)
+
 	// GetUserTags 获取用户标签
 	GetUserTags(ctx context.Context, userID int64) ([]byte, error)
 
@@ -45,6 +54,6 @@ type UserRepo interface {
 	// Delete 删除用户
 	Delete(ctx context.Context, id int64) error
 
-	// CheckEmailVerificationCode 检查邮箱验证码
-	CheckEmailVerificationCode(ctx context.Context, email string, verificationCode string) (bool, error)
+	// CheckEmailVerificationCode 检查邮箱验证码, 输错 maxAttempts 次后验证码作废
+	CheckEmailVerificationCode(ctx context.Context, email string, verificationCode string, maxAttempts int) (bool, error)
 }
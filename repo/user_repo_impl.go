@@ -63,6 +63,38 @@ func (r *UserRepoImpl) GetPasswordByID(ctx context.Context, id int64) (string, e
 	return password, nil
 }
 
+func (r *UserRepoImpl) GetStatusAndRoleByID(ctx context.Context, id int64) (int64, int64, error) {
+	var user = &domain.User{}
+	sqlStr := "select status, role from shop.user where id = ? LIMIT 1;"
+
+	err := r.db.GetDB().GetContext(ctx, user, sqlStr, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.MySQLLogger.Warnf("user not found (id: %d)", id)
+			return 0, 0, fmt.Errorf("%w: user id %d", err, id)
+		}
+		log.AppLogger.Errorf("user repo error: %v", err)
+		return 0, 0, fmt.Errorf("failed to get user status: %w", err)
+	}
+	return user.Status, user.RoleID, nil
+}
+
+func (r *UserRepoImpl) GetStatusByID(ctx context.Context, id int64) (int64, error) {
+	var status int64
+	sqlStr := "select status from shop.user where id = ? LIMIT 1;"
+
+	err := r.db.GetDB().GetContext(ctx, &status, sqlStr, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.MySQLLogger.Warnf("user not found (id: %d)", id)
+			return 0, fmt.Errorf("%w: user id %d", err, id)
+		}
+		log.AppLogger.Errorf("user repo error: %v", err)
+		return 0, fmt.Errorf("failed to get user status: %w", err)
+	}
+	return status, nil
+}
+
 func (r *UserRepoImpl) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user = &domain.User{}
 	sqlStr := "select id,name, sex,image,last_ip,image,is_vip, role from shop.user where email = ? LIMIT 1;"
@@ -79,6 +111,22 @@ func (r *UserRepoImpl) GetByEmail(ctx context.Context, email string) (*domain.Us
 	return user, nil
 }
 
+func (r *UserRepoImpl) GetByPhone(ctx context.Context, phone string) (*domain.User, error) {
+	var user = &domain.User{}
+	sqlStr := "select id, name, sex, image, last_ip, is_vip, role from shop.user where phone = ? LIMIT 1;"
+
+	err := r.db.GetDB().GetContext(ctx, user, sqlStr, phone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.MySQLLogger.Warnf("user not found (phone: %s)", phone)
+			return nil, fmt.Errorf("%w: user phone %s", err, phone)
+		}
+		log.AppLogger.Errorf("user repo error: %v", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
 func (r *UserRepoImpl) Create(ctx context.Context, user *domain.User) (int64, error) {
 	sqlStr := "insert into shop.user (name,password,email,phone,sex,create_time, status, last_ip, image, is_vip, role) values (?,?,?,?,?,?,?,?,?,?,?)"
 
@@ -197,35 +245,47 @@ func (r *UserRepoImpl) IsExistsByEmail(ctx context.Context, email string) (bool,
 	return exists, nil
 }
 
-// CheckEmailVerificationCode 验证邮箱验证码
-func (r *UserRepoImpl) CheckEmailVerificationCode(ctx context.Context, email string, verificationCode string) (bool, error) {
-	// 从Redis缓存中获取存储的验证码
-	storedCode, err := r.cache.GetCache().Get(ctx, email).Result()
+// checkEmailCodeScript 校验邮箱验证码并统计输错次数. 返回 1 表示通过, 0 表示不存在或已过期, -1 表示错误, -2 表示错误次数过多已作废
+var checkEmailCodeScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return 0
+end
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 1
+end
+local attempts = redis.call('INCR', KEYS[2])
+if attempts == 1 then
+	redis.call('PEXPIRE', KEYS[2], math.max(redis.call('PTTL', KEYS[1]), 1))
+end
+if attempts >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return -2
+end
+return -1
+`)
+
+// CheckEmailVerificationCode 验证邮箱验证码, 通过后验证码失效; 输错 maxAttempts 次后验证码作废
+func (r *UserRepoImpl) CheckEmailVerificationCode(ctx context.Context, email string, verificationCode string, maxAttempts int) (bool, error) {
+	result, err := checkEmailCodeScript.Run(ctx, r.cache.GetCache(), []string{email, email + ":attempts"}, verificationCode, maxAttempts).Int()
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			log.AppLogger.Warnf("email:%s err: %v", email, err)
-			return false, err
-		}
 		log.AppLogger.Errorf("获取验证码失败: %v", err)
 		return false, fmt.Errorf("获取验证码失败: %w", err)
 	}
 
-	// 比较验证码是否匹配
-	isValid, err := domain.ValidateCode(verificationCode, storedCode)
-	if err != nil {
-		log.AppLogger.Errorln(err)
-		return false, err
+	switch result {
+	case 1:
+		return true, nil
+	case 0:
+		log.AppLogger.Warnf("email:%s verification code expired", email)
+		return false, domain.ErrOTPExpired
+	case -2:
+		log.SecurityLogger.Warnf("email verification code invalidated after %d wrong attempts, email: %s", maxAttempts, email)
+		return false, domain.ErrOTPAttemptsExceeded
+	default:
+		return false, domain.ErrOTPInvalid
 	}
-
-	// 如果验证成功，删除验证码防止重复使用
-	if isValid {
-		_, err = r.cache.GetCache().Del(ctx, email).Result()
-		if err != nil {
-			log.AppLogger.Warnf("删除已使用的验证码失败: %v", err)
-		}
-	}
-
-	return isValid, nil
 }
 
 func (r *UserRepoImpl) UpdateEmail(ctx context.Context, email string, userID int64) error {
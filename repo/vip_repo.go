@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+)
+
+type VipRepo interface {
+	// ListPlans 获取在售的会员套餐及对应等级
+	ListPlans(ctx context.Context) ([]*domain.VipPlan, error)
+
+	// GetPlan 获取在售的会员套餐及对应等级, 不存在或已下架时返回 domain.ErrVipPlanNotFound
+	GetPlan(ctx context.Context, id int64) (*domain.VipPlan, error)
+
+	// GetMembership 获取用户会员及对应等级, 不存在时返回 domain.ErrMembershipNotFound
+	GetMembership(ctx context.Context, userID int64) (*domain.Membership, error)
+
+	// Activate 在事务中锁定用户的会员记录, 由 next 根据锁定后的会员(不是会员时为 nil)计算开通结果,
+	// 保存开通后的会员和开通记录, 并将用户标记为会员. order.OutTradeNo 已有开通记录时不做修改, 返回 domain.ErrVipOrderExists
+	Activate(ctx context.Context, order *domain.VipOrder, next func(current *domain.Membership) (*domain.Membership, error)) (*domain.Membership, error)
+
+	// CancelAutoRenew 关闭自动续费
+	CancelAutoRenew(ctx context.Context, userID int64) (bool, error)
+
+	// ListDue 获取到期时间早于 before 的有效会员
+	ListDue(ctx context.Context, before int64, limit int) ([]*domain.Membership, error)
+
+	// Expire 会员过期并取消用户的会员标记, expiresAt 与当前记录不一致(期间已续期)时不做修改
+	Expire(ctx context.Context, userID, expiresAt int64) (bool, error)
+
+	// SumSpend 统计用户 since 之后已完成订单的实付金额
+	SumSpend(ctx context.Context, userID, since int64) (int64, error)
+
+	// LastEarnAt 获取用户最近一次消费达标获得会员的时间, 没有时返回 0
+	LastEarnAt(ctx context.Context, userID int64) (int64, error)
+}
@@ -0,0 +1,232 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"time"
+)
+
+const (
+	vipPlanColumns    = "p.id, p.tier_level, p.name, p.duration_days, p.price, p.earn_threshold, p.status, p.created_at"
+	membershipColumns = "m.user_id, m.plan_id, m.tier_level, m.status, m.started_at, m.expires_at, m.auto_renew, m.agreement_no, m.updated_at"
+	vipTierColumns    = "t.name as tier_name, t.discount_percent, t.free_shipping_threshold"
+)
+
+type VipRepoImpl struct {
+	db database.Database
+}
+
+func NewVipRepo(db database.Database) *VipRepoImpl {
+	return &VipRepoImpl{db: db}
+}
+
+// tierColumns 联表查询出的会员等级字段
+type tierColumns struct {
+	TierName              string `db:"tier_name"`
+	DiscountPercent       int64  `db:"discount_percent"`
+	FreeShippingThreshold int64  `db:"free_shipping_threshold"`
+}
+
+func (c tierColumns) tier(level int64) *domain.VipTier {
+	return &domain.VipTier{Level: level, Name: c.TierName, DiscountPercent: c.DiscountPercent, FreeShippingThreshold: c.FreeShippingThreshold}
+}
+
+// planRow 套餐与等级的联表查询结果
+type planRow struct {
+	domain.VipPlan
+	tierColumns
+}
+
+func (row *planRow) plan() *domain.VipPlan {
+	plan := row.VipPlan
+	plan.Tier = row.tier(plan.TierLevel)
+	return &plan
+}
+
+func (r *VipRepoImpl) ListPlans(ctx context.Context) ([]*domain.VipPlan, error) {
+	var rows = make([]*planRow, 0)
+	sqlStr := "select " + vipPlanColumns + ", " + vipTierColumns + " from shop.vip_plan p join shop.vip_tier t on t.level = p.tier_level " +
+		"where p.status = ? order by p.tier_level, p.price"
+	if err := r.db.GetDB().SelectContext(ctx, &rows, sqlStr, _const.StatusNotDeleted); err != nil {
+		applog.MySQLLogger.Errorf("list vip plans failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list vip plans: %w", err)
+	}
+	plans := make([]*domain.VipPlan, 0, len(rows))
+	for _, row := range rows {
+		plans = append(plans, row.plan())
+	}
+	return plans, nil
+}
+
+func (r *VipRepoImpl) GetPlan(ctx context.Context, id int64) (*domain.VipPlan, error) {
+	var row = &planRow{}
+	sqlStr := "select " + vipPlanColumns + ", " + vipTierColumns + " from shop.vip_plan p join shop.vip_tier t on t.level = p.tier_level " +
+		"where p.id = ? and p.status = ?"
+	if err := r.db.GetDB().GetContext(ctx, row, sqlStr, id, _const.StatusNotDeleted); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrVipPlanNotFound
+		}
+		applog.MySQLLogger.Errorf("get vip plan failed, id: %d, err: %v", id, err)
+		return nil, fmt.Errorf("failed to get vip plan: %w", err)
+	}
+	return row.plan(), nil
+}
+
+func (r *VipRepoImpl) GetMembership(ctx context.Context, userID int64) (*domain.Membership, error) {
+	var row = &struct {
+		domain.Membership
+		tierColumns
+	}{}
+	sqlStr := "select " + membershipColumns + ", " + vipTierColumns + " from shop.user_membership m join shop.vip_tier t on t.level = m.tier_level where m.user_id = ?"
+	if err := r.db.GetDB().GetContext(ctx, row, sqlStr, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrMembershipNotFound
+		}
+		applog.MySQLLogger.Errorf("get membership failed, user id: %d, err: %v", userID, err)
+		return nil, fmt.Errorf("failed to get membership: %w", err)
+	}
+	membership := row.Membership
+	membership.Tier = row.tier(membership.TierLevel)
+	return &membership, nil
+}
+
+func (r *VipRepoImpl) Activate(ctx context.Context, order *domain.VipOrder, next func(current *domain.Membership) (*domain.Membership, error)) (*domain.Membership, error) {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return nil, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 首次开通时会员记录还不存在, 先锁定用户行, 使同一用户的开通串行执行
+	var userID int64
+	if err = tx.GetContext(ctx, &userID, "select id from shop.user where id = ? for update", order.UserID); err != nil {
+		applog.MySQLLogger.Errorf("lock user failed, user id: %d, err: %v", order.UserID, err)
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var orders int
+	if err = tx.GetContext(ctx, &orders, "select count(*) from shop.vip_order where out_trade_no = ?", order.OutTradeNo); err != nil {
+		applog.MySQLLogger.Errorf("check vip order failed, out trade no: %s, err: %v", order.OutTradeNo, err)
+		return nil, fmt.Errorf("failed to check vip order: %w", err)
+	}
+	if orders > 0 {
+		return nil, domain.ErrVipOrderExists
+	}
+
+	var current = &domain.Membership{}
+	sqlStr := "select " + membershipColumns + " from shop.user_membership m where m.user_id = ? for update"
+	if err = tx.GetContext(ctx, current, sqlStr, order.UserID); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			applog.MySQLLogger.Errorf("lock membership failed, user id: %d, err: %v", order.UserID, err)
+			return nil, fmt.Errorf("failed to lock membership: %w", err)
+		}
+		current = nil
+	}
+	m, err := next(current)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStr = "insert into shop.user_membership (user_id, plan_id, tier_level, status, started_at, expires_at, auto_renew, agreement_no, updated_at) " +
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?) on duplicate key update plan_id = values(plan_id), tier_level = values(tier_level), status = values(status), " +
+		"started_at = values(started_at), expires_at = values(expires_at), auto_renew = values(auto_renew), agreement_no = values(agreement_no), updated_at = values(updated_at)"
+	if _, err = tx.ExecContext(ctx, sqlStr, m.UserID, m.PlanID, m.TierLevel, m.Status, m.StartedAt, m.ExpiresAt, m.AutoRenew, m.AgreementNo, m.UpdatedAt); err != nil {
+		applog.MySQLLogger.Errorf("save membership failed, user id: %d, err: %v", m.UserID, err)
+		return nil, fmt.Errorf("failed to save membership: %w", err)
+	}
+
+	sqlStr = "insert into shop.vip_order (user_id, plan_id, kind, amount, out_trade_no, trade_no, created_at) values (?, ?, ?, ?, ?, ?, ?)"
+	if _, err = tx.ExecContext(ctx, sqlStr, order.UserID, order.PlanID, order.Kind, order.Amount, order.OutTradeNo, order.TradeNo, order.CreatedAt); err != nil {
+		applog.MySQLLogger.Errorf("save vip order failed, user id: %d, err: %v", order.UserID, err)
+		return nil, fmt.Errorf("failed to save vip order: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "update shop.user set is_vip = 1, update_time = ? where id = ?", m.UpdatedAt, m.UserID); err != nil {
+		applog.MySQLLogger.Errorf("mark user vip failed, user id: %d, err: %v", m.UserID, err)
+		return nil, fmt.Errorf("failed to mark user vip: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return nil, fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return m, nil
+}
+
+func (r *VipRepoImpl) CancelAutoRenew(ctx context.Context, userID int64) (bool, error) {
+	sqlStr := "update shop.user_membership set auto_renew = 0, agreement_no = '', updated_at = ? where user_id = ? and auto_renew = 1"
+	result, err := r.db.GetDB().ExecContext(ctx, sqlStr, time.Now().Unix(), userID)
+	if err != nil {
+		applog.MySQLLogger.Errorf("cancel auto renew failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to cancel auto renew: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *VipRepoImpl) ListDue(ctx context.Context, before int64, limit int) ([]*domain.Membership, error) {
+	var memberships = make([]*domain.Membership, 0)
+	sqlStr := "select " + membershipColumns + " from shop.user_membership m where m.status = ? and m.expires_at <= ? order by m.expires_at limit ?"
+	if err := r.db.GetDB().SelectContext(ctx, &memberships, sqlStr, _const.MembershipStatusActive, before, limit); err != nil {
+		applog.MySQLLogger.Errorf("list due memberships failed, err: %v", err)
+		return nil, fmt.Errorf("failed to list due memberships: %w", err)
+	}
+	return memberships, nil
+}
+
+func (r *VipRepoImpl) Expire(ctx context.Context, userID, expiresAt int64) (bool, error) {
+	tx, err := r.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		applog.MySQLLogger.Errorf("begin tx failed, err: %v", err)
+		return false, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	sqlStr := "update shop.user_membership set status = ?, auto_renew = 0, agreement_no = '', updated_at = ? where user_id = ? and status = ? and expires_at = ?"
+	result, err := tx.ExecContext(ctx, sqlStr, _const.MembershipStatusExpired, now, userID, _const.MembershipStatusActive, expiresAt)
+	if err != nil {
+		applog.MySQLLogger.Errorf("expire membership failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to expire membership: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err = tx.ExecContext(ctx, "update shop.user set is_vip = 0, update_time = ? where id = ?", now, userID); err != nil {
+		applog.MySQLLogger.Errorf("unmark user vip failed, user id: %d, err: %v", userID, err)
+		return false, fmt.Errorf("failed to unmark user vip: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		applog.MySQLLogger.Errorf("commit tx failed, err: %v", err)
+		return false, fmt.Errorf("failed to commit tx: %w", err)
+	}
+	return true, nil
+}
+
+func (r *VipRepoImpl) SumSpend(ctx context.Context, userID, since int64) (int64, error) {
+	var total int64
+	sqlStr := "select coalesce(sum(pay_price), 0) from shop.orders where user_id = ? and order_status = ? and created_at >= ?"
+	if err := r.db.GetDB().GetContext(ctx, &total, sqlStr, userID, _const.OrderStatusCompleted, since); err != nil {
+		applog.MySQLLogger.Errorf("sum user spend failed, user id: %d, err: %v", userID, err)
+		return 0, fmt.Errorf("failed to sum user spend: %w", err)
+	}
+	return total, nil
+}
+
+func (r *VipRepoImpl) LastEarnAt(ctx context.Context, userID int64) (int64, error) {
+	var at int64
+	sqlStr := "select coalesce(max(created_at), 0) from shop.vip_order where user_id = ? and kind = ?"
+	if err := r.db.GetDB().GetContext(ctx, &at, sqlStr, userID, _const.VipOrderEarn); err != nil {
+		applog.MySQLLogger.Errorf("get last vip earn failed, user id: %d, err: %v", userID, err)
+		return 0, fmt.Errorf("failed to get last vip earn: %w", err)
+	}
+	return at, nil
+}
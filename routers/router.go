@@ -4,6 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/star-find-cloud/star-mall/handler"
 	"github.com/star-find-cloud/star-mall/middleware"
+	"github.com/star-find-cloud/star-mall/pkg/database"
+	"time"
 )
 
 func InitRouter(userHandler *handler.UserHandler,
@@ -14,7 +16,21 @@ func InitRouter(userHandler *handler.UserHandler,
 	public *handler.PublicHandler,
 	cartHandler *handler.CartHandler,
 	orderHandler *handler.OrderHandler,
-	deepseekHandler *handler.DeepseekHandler) *gin.Engine {
+	couponHandler *handler.CouponHandler,
+	shipmentHandler *handler.ShipmentHandler,
+	deepseekHandler *handler.DeepseekHandler,
+	roleHandler *handler.RoleHandler,
+	adminHandler *handler.AdminHandler,
+	keyHandler *handler.KeyHandler, totpHandler *handler.TOTPHandler,
+	oauthHandler *handler.OAuthHandler,
+	accountHandler *handler.AccountHandler,
+	vipHandler *handler.VipHandler,
+	searchHandler *handler.SearchHandler,
+	tokens middleware.TokenChecker,
+	merchants middleware.MerchantChecker,
+	rbac middleware.PermissionChecker,
+	audit middleware.AuditRecorder,
+	cache *database.Redis) *gin.Engine {
 	// 设置 gin 模式
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
@@ -24,33 +40,94 @@ func InitRouter(userHandler *handler.UserHandler,
 		middleware.GinRecoveryWithZap(true),
 	)
 
+	// 登录校验中间件, 拒绝已注销的 token
+	jwtAuth := middleware.JwtAuth(tokens)
+	// 商家接口只允许审核通过的商家访问
+	merchantApproved := middleware.MerchantApproved(merchants)
+
+	// 幂等中间件, 用于下单等客户端可能重试的修改类接口
+	idempotency := middleware.Idempotency(cache.Cache, 24*time.Hour)
+
+	// token 验证公钥, 供其他服务验证 token
+	r.GET("/.well-known/jwks.json", keyHandler.JWKS)
+
 	publicGroup := r.Group("/api/v1")
 	{
 		publicGroup.GET("/health", public.HealthCheck)
 		publicGroup.POST("/sendVerifyCodeByEmail", public.SendVerifyCodeByEmail)
+		publicGroup.POST("/sendVerifyCodeBySms", public.SendVerifyCodeBySms)
 	}
 
 	userGroup := r.Group("/api/v1/user")
 	{
 		userGroup.POST("/login", userHandler.Login)
 		userGroup.PUT("/register", userHandler.Register)
-		userGroup.DELETE("/delete", userHandler.Delete)
+		userGroup.POST("/login/sms", userHandler.LoginBySms)
+		userGroup.POST("/login/2fa", userHandler.LoginWithTOTP)
+		userGroup.PUT("/register/sms", userHandler.RegisterBySms)
 		userGroup.PATCH("/forgetPassword", userHandler.ForgetPassword)
+		userGroup.POST("/refresh", userHandler.Refresh)
 	}
-	userGroup.Use(middleware.JwtAuth())
+	userGroup.Use(jwtAuth)
 	{
 		userGroup.GET("/:id", userHandler.GetUser)
 		userGroup.PATCH("/update", userHandler.Update)
 		userGroup.PATCH("/update/password", userHandler.UpdatePassword)
+		userGroup.POST("/logout", userHandler.Logout)
+		userGroup.DELETE("/delete", accountHandler.RequestDeletion)
+		// 两步验证
+		userGroup.POST("/totp/enroll", totpHandler.Enroll)
+		userGroup.POST("/totp/activate", totpHandler.Activate)
+		userGroup.POST("/totp/disable", totpHandler.Disable)
+	}
+
+	// 账号注销及个人数据导出路由组
+	accountGroup := r.Group("/api/v1/account")
+	accountGroup.Use(jwtAuth)
+	{
+		accountGroup.GET("/deletion", accountHandler.DeletionStatus)
+		accountGroup.POST("/deletion/cancel", accountHandler.CancelDeletion)
+		accountGroup.GET("/export", accountHandler.Export)
+	}
+
+	// 会员路由组
+	vipGroup := r.Group("/api/v1/vip")
+	{
+		vipGroup.GET("/plans", vipHandler.Plans)
+	}
+	vipGroup.Use(jwtAuth)
+	{
+		vipGroup.GET("/membership", vipHandler.Membership)
+		vipGroup.POST("/purchase/:planID", idempotency, vipHandler.Purchase)
+		vipGroup.POST("/earn/:planID", vipHandler.Earn)
+		vipGroup.POST("/autoRenew/cancel", vipHandler.CancelAutoRenew)
+	}
+
+	// 第三方登录路由组
+	oauthGroup := r.Group("/api/v1/oauth")
+	{
+		oauthGroup.GET("/providers", oauthHandler.Providers)
+		oauthGroup.GET("/login/:provider", oauthHandler.Login)
+		oauthGroup.GET("/callback/:provider", oauthHandler.Callback)
+	}
+	oauthGroup.Use(jwtAuth)
+	{
+		oauthGroup.GET("/identities", oauthHandler.Identities)
+		oauthGroup.POST("/link/:provider", oauthHandler.Link)
+		oauthGroup.DELETE("/unlink/:provider", oauthHandler.Unlink)
 	}
 
+	// 图片内容, 供页面直接引用
+	r.GET("/image/:id", imageHandler.ServeImage)
+
 	imageGroup := r.Group("/api/v1/image")
 	{
 		imageGroup.GET("/getImage", imageHandler.GetImage)
 	}
-	imageGroup.Use(middleware.JwtAuth())
+	imageGroup.Use(jwtAuth, merchantApproved)
 	{
 		imageGroup.POST("/upload", imageHandler.UploadImage)
+		imageGroup.DELETE("/:id", imageHandler.DeleteImage)
 		//imageGroup.POST("/:owner_type/:id/images/upload", imageHandler.)
 
 	}
@@ -64,6 +141,9 @@ func InitRouter(userHandler *handler.UserHandler,
 		merchantGroup.GET("/search/:merchant_name", merchantHandler.Select)
 		// 商家注册
 		merchantGroup.POST("/register", merchantHandler.Register)
+	}
+	merchantGroup.Use(jwtAuth, merchantApproved)
+	{
 		// 更新商家信息
 		merchantGroup.PATCH("/update", merchantHandler.Update)
 		// 删除商家
@@ -73,10 +153,13 @@ func InitRouter(userHandler *handler.UserHandler,
 	// 商品相关路由组
 	productGroup := r.Group("/api/v1/products")
 	{
-		// 获取单个商品信息
-		productGroup.GET("/getProduct/:id", product.GetProduct)
+		// 获取单个商品信息, 会员登录后返回会员价
+		productGroup.GET("/getProduct/:id", middleware.OptionalJwtAuth(tokens), product.GetProduct)
+		// 搜索联想和热门搜索
+		productGroup.GET("/suggest", searchHandler.Suggest)
+		productGroup.GET("/hotSearches", searchHandler.HotSearches)
 	}
-	productGroup.Use(middleware.JwtAuth())
+	productGroup.Use(jwtAuth, merchantApproved)
 	{
 		// 创建单个商品
 		productGroup.PUT("/create", product.Create)
@@ -86,17 +169,21 @@ func InitRouter(userHandler *handler.UserHandler,
 		productGroup.PATCH("/update", product.Update)
 		//
 		productGroup.POST("/search", product.SearchProduct)
+		// 最近搜索
+		productGroup.GET("/searchHistory", searchHandler.SearchHistory)
+		productGroup.DELETE("/searchHistory", searchHandler.DeleteSearchHistory)
 	}
 
 	// 库存相关路由组
 	inventoryGroup := r.Group("/api/v1/inventory")
+	inventoryGroup.Use(jwtAuth, merchantApproved)
 	{
 		// 创建单个库存
 		inventoryGroup.PUT("/create", inventoryHandler.Create)
 		// 获取单个库存信息
-		inventoryGroup.GET("inventory/{id}", inventoryHandler.GetInventory)
+		inventoryGroup.GET("/get/:id", inventoryHandler.GetByID)
 		//// 搜索库存
-		inventoryGroup.GET("/search/:MerchantID", inventoryHandler.GetInventoryByMerchant)
+		inventoryGroup.GET("/search/:MerchantID", inventoryHandler.GetByMerchant)
 		// 更新库存信息
 		inventoryGroup.PATCH("/update", inventoryHandler.Update)
 	}
@@ -107,7 +194,7 @@ func InitRouter(userHandler *handler.UserHandler,
 		// 获取单个购物车信息
 		cartGroup.GET("/{id}", cartHandler.GetByID)
 	}
-	cartGroup.Use(middleware.JwtAuth())
+	cartGroup.Use(jwtAuth)
 	{
 		// 创建单个购物车
 		cartGroup.PUT("/create", cartHandler.Create)
@@ -119,24 +206,110 @@ func InitRouter(userHandler *handler.UserHandler,
 
 	// 订单相关路由组
 	orderGroup := r.Group("/api/v1/order")
+	orderGroup.Use(jwtAuth, merchantApproved)
 	{
 		// 创建单个订单
-		orderGroup.PUT("/create", orderHandler.CreateOrder)
+		orderGroup.PUT("/create", idempotency, orderHandler.CreateOrder)
 		// 获取单个订单信息
 		orderGroup.GET("/get", orderHandler.GetOrder)
-		//// 获取单个用户订单信息
-		//orderGroup.GET("user/{id}", orderHandler.GetByUserID)
+		// 取消订单
+		orderGroup.PATCH("/cancel", idempotency, orderHandler.CancelOrder)
+		// 获取当前用户或商家的订单列表
+		orderGroup.GET("/list", orderHandler.ListOrders)
 		//// 添加商品到订单
 		//orderGroup.PUT("/add", orderHandler.AddProduct)
 	}
 
+	// 优惠券相关路由组
+	couponGroup := r.Group("/api/v1/coupon")
+	{
+		// 获取可领取的优惠券
+		couponGroup.GET("/list", couponHandler.ListCoupons)
+	}
+	couponGroup.Use(jwtAuth, merchantApproved)
+	{
+		// 商家创建优惠券
+		couponGroup.PUT("/create", couponHandler.CreateCoupon)
+		// 领取优惠券
+		couponGroup.POST("/claim/:id", idempotency, couponHandler.ClaimCoupon)
+		// 获取用户优惠券钱包
+		couponGroup.GET("/wallet", couponHandler.GetWallet)
+	}
+
+	// 物流相关路由组
+	shipmentGroup := r.Group("/api/v1/shipment")
+	shipmentGroup.Use(jwtAuth, merchantApproved)
+	{
+		// 商家发货
+		shipmentGroup.PUT("/create", idempotency, shipmentHandler.CreateShipment)
+		// 获取订单物流时间线
+		shipmentGroup.GET("/timeline/:orderID", shipmentHandler.GetTimeline)
+	}
+
 	// AI相关路由组
 	aiGroup := r.Group("/api/v1/deepseek")
-	aiGroup.Use(middleware.JwtAuth())
+	aiGroup.Use(jwtAuth)
 	{
 		aiGroup.POST("/suggest", deepseekHandler.SuggestProductByUserTags)
 		aiGroup.POST("/search", deepseekHandler.SuggestProductBySearch)
 	}
 
+	// 后台管理路由组, 除登录外按角色权限访问, 修改类操作记录审计日志
+	adminGroup := r.Group("/api/v1/admin")
+	adminGroup.POST("/login", adminHandler.Login)
+	adminGroup.POST("/refresh", adminHandler.Refresh)
+	adminGroup.POST("/logout", jwtAuth, adminHandler.Logout)
+	adminGroup.Use(jwtAuth)
+	// 路由注册时登记权限校验使用的路由模板, 审计日志在权限校验之后记录
+	admin := middleware.NewPermissionGroup(adminGroup, rbac, middleware.Audit(audit))
+	{
+		// 角色列表
+		admin.GET("/role/list", roleHandler.ListRoles)
+		// 创建角色
+		admin.PUT("/role/create", roleHandler.CreateRole)
+		// 更新角色
+		admin.PATCH("/role/update", roleHandler.UpdateRole)
+		// 删除角色
+		admin.DELETE("/role/delete/:id", roleHandler.DeleteRole)
+		// 角色权限
+		admin.GET("/role/permissions/:id", roleHandler.GetRolePermissions)
+		admin.PUT("/role/permissions/:id", roleHandler.SetRolePermissions)
+		// 分配和撤销角色
+		admin.PUT("/role/assign", roleHandler.AssignRole)
+		admin.POST("/role/revoke", roleHandler.RevokeRole)
+		// 权限列表
+		admin.GET("/permission/list", roleHandler.ListPermissions)
+
+		// 用户管理
+		admin.GET("/user/search", adminHandler.SearchUsers)
+		admin.PATCH("/user/ban/:id", adminHandler.BanUser)
+		admin.PATCH("/user/unban/:id", adminHandler.UnbanUser)
+
+		admin.PATCH("/admin/disable/:id", adminHandler.DisableAdmin)
+		admin.PATCH("/admin/enable/:id", adminHandler.EnableAdmin)
+		// 商家审核
+		admin.GET("/merchant/list", adminHandler.ListMerchants)
+		admin.PATCH("/merchant/approve/:id", adminHandler.ApproveMerchant)
+		admin.PATCH("/merchant/reject/:id", adminHandler.RejectMerchant)
+		// 商品审核
+		admin.GET("/product/list", adminHandler.ListProducts)
+		admin.PATCH("/product/takedown/:id", adminHandler.TakedownProduct)
+		admin.PATCH("/product/restore/:id", adminHandler.RestoreProduct)
+		// 订单查询
+		admin.GET("/order/list", adminHandler.ListOrders)
+		admin.GET("/order/get/:id", adminHandler.GetOrder)
+		// 平台优惠券
+		admin.PUT("/coupon/create", adminHandler.CreateCoupon)
+		// 数据概览
+		admin.GET("/dashboard", adminHandler.Dashboard)
+		// 审计日志
+		admin.GET("/audit/list", adminHandler.ListAuditLogs)
+		// 登录锁定
+		admin.GET("/security/locks", adminHandler.ListLoginLocks)
+		admin.DELETE("/security/lock", adminHandler.UnlockLogin)
+		// 无结果搜索词
+		admin.GET("/search/zeroResults", searchHandler.ZeroResults)
+	}
+
 	return r
 }
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"io"
+	"time"
+)
+
+const (
+	defaultDeletionGracePeriod = 15 * 24 * time.Hour
+	defaultPurgeInterval       = time.Hour
+	// purgeBatchSize 每轮最多注销的账号数
+	purgeBatchSize = 100
+)
+
+type AccountService interface {
+	// RequestDeletion 申请注销账号, 冷静期结束后匿名化用户数据.
+	// 需要账号邮箱收到的验证码, 没有邮箱时使用手机号收到的验证码; 已开启两步验证时还需要两步验证码
+	RequestDeletion(ctx context.Context, userID int64, verifyCode, totpCode string) (*domain.DeletionRequest, error)
+
+	// DeletionStatus 获取处于冷静期的注销申请
+	DeletionStatus(ctx context.Context, userID int64) (*domain.DeletionRequest, error)
+
+	// CancelDeletion 冷静期内撤销注销申请
+	CancelDeletion(ctx context.Context, userID int64) error
+
+	// Export 导出用户的个人数据
+	Export(ctx context.Context, userID int64) (*domain.UserDataExport, error)
+
+	// PurgeDue 注销冷静期已结束的账号, 返回注销的数量
+	PurgeDue(ctx context.Context) (int, error)
+
+	// Run 定期执行 PurgeDue, 直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+type AccountServiceImpl struct {
+	repo         repo.AccountRepo
+	identityRepo repo.IdentityRepo
+	users        UserService
+	sms          SmsService
+	totp         TOTPService
+	tokens       TokenService
+	guard        repo.LoginGuardRepo
+	searchLog    repo.SearchLogRepo
+	gracePeriod  time.Duration
+	interval     time.Duration
+}
+
+func NewAccountService(repo repo.AccountRepo, identityRepo repo.IdentityRepo, users UserService, sms SmsService, totp TOTPService, tokens TokenService,
+	guard repo.LoginGuardRepo, searchLog repo.SearchLogRepo, c conf.AccountConf) *AccountServiceImpl {
+	if c.DeletionGracePeriod <= 0 {
+		c.DeletionGracePeriod = defaultDeletionGracePeriod
+	}
+	if c.PurgeInterval <= 0 {
+		c.PurgeInterval = defaultPurgeInterval
+	}
+	return &AccountServiceImpl{
+		repo:         repo,
+		identityRepo: identityRepo,
+		users:        users,
+		sms:          sms,
+		totp:         totp,
+		tokens:       tokens,
+		guard:        guard,
+		searchLog:    searchLog,
+		gracePeriod:  c.DeletionGracePeriod,
+		interval:     c.PurgeInterval,
+	}
+}
+
+func (s *AccountServiceImpl) RequestDeletion(ctx context.Context, userID int64, verifyCode, totpCode string) (*domain.DeletionRequest, error) {
+	profile, err := s.repo.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.verifyOwner(ctx, profile, verifyCode); err != nil {
+		return nil, err
+	}
+	if err = s.totp.Require(ctx, userID, totpCode); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	req := &domain.DeletionRequest{
+		UserID:      userID,
+		Status:      _const.DeletionStatusPending,
+		RequestedAt: now.Unix(),
+		EraseAt:     now.Add(s.gracePeriod).Unix(),
+	}
+	if err = s.repo.RequestDeletion(ctx, req); err != nil {
+		return nil, err
+	}
+	log.SecurityLogger.Infof("account deletion requested, user id: %d, erase at: %d", userID, req.EraseAt)
+	return req, nil
+}
+
+// verifyOwner 校验发送到账号邮箱或手机号的验证码. 只通过第三方登录注册、没有邮箱和手机号的账号只能依赖登录状态
+func (s *AccountServiceImpl) verifyOwner(ctx context.Context, profile *domain.DataExportProfile, code string) error {
+	switch {
+	case profile.Email != "":
+		ok, err := s.users.CheckEmailVerificationCode(ctx, profile.Email, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return domain.ErrOTPInvalid
+		}
+		return nil
+	case profile.Phone != "":
+		return s.sms.VerifyCode(ctx, profile.Phone, code)
+	}
+	return nil
+}
+
+func (s *AccountServiceImpl) DeletionStatus(ctx context.Context, userID int64) (*domain.DeletionRequest, error) {
+	req, err := s.repo.GetDeletion(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && req.Status != _const.DeletionStatusPending) {
+		return nil, domain.ErrDeletionNotFound
+	}
+	return req, err
+}
+
+func (s *AccountServiceImpl) CancelDeletion(ctx context.Context, userID int64) error {
+	ok, err := s.repo.CancelDeletion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrDeletionNotFound
+	}
+	log.SecurityLogger.Infof("account deletion cancelled, user id: %d", userID)
+	return nil
+}
+
+func (s *AccountServiceImpl) Export(ctx context.Context, userID int64) (*domain.UserDataExport, error) {
+	export := &domain.UserDataExport{ExportedAt: time.Now().Unix()}
+	var err error
+	if export.Profile, err = s.repo.GetProfile(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Addresses, err = s.repo.ListAddresses(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Orders, err = s.repo.ListOrders(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Favourites, err = s.repo.ListFavourites(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Cart, err = s.repo.ListCartItems(ctx, userID); err != nil {
+		return nil, err
+	}
+	if export.Identities, err = s.identityRepo.ListByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *AccountServiceImpl) PurgeDue(ctx context.Context) (int, error) {
+	ids, err := s.repo.ListDueDeletions(ctx, time.Now().Unix(), purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	erased := 0
+	for _, id := range ids {
+		profile, err := s.repo.GetProfile(ctx, id)
+		if err != nil {
+			log.AppLogger.Warnf("注销账号失败 (user: %d): %v", id, err)
+			continue
+		}
+		if err = s.repo.Erase(ctx, id); err != nil {
+			// 执行期间被撤销的申请直接跳过
+			if !errors.Is(err, domain.ErrDeletionNotFound) {
+				log.AppLogger.Warnf("注销账号失败 (user: %d): %v", id, err)
+			}
+			continue
+		}
+		if err = s.tokens.RevokeAll(ctx, profile.RoleID, id); err != nil {
+			log.AppLogger.Warnf("注销账号后吊销登录状态失败 (user: %d): %v", id, err)
+		}
+		s.clearCache(ctx, profile)
+		log.SecurityLogger.Infof("account erased, user id: %d", id)
+		erased++
+	}
+	return erased, nil
+}
+
+// clearCache 清除 Redis 中与用户相关的最近搜索和登录失败记录, 失败只记录日志, 这些数据都会自然过期
+func (s *AccountServiceImpl) clearCache(ctx context.Context, profile *domain.DataExportProfile) {
+	if err := s.searchLog.ClearRecent(ctx, profile.ID); err != nil {
+		log.AppLogger.Warnf("注销账号后清除最近搜索失败 (user: %d): %v", profile.ID, err)
+	}
+	accounts := []string{guardAccount(profile.ID), guardTOTP(profile.ID)}
+	if profile.Email != "" {
+		accounts = append(accounts, guardEmail(profile.Email))
+	}
+	for _, account := range accounts {
+		if _, err := s.guard.Unlock(ctx, domain.GuardKindAccount, account); err != nil {
+			log.AppLogger.Warnf("注销账号后清除登录失败记录失败 (user: %d): %v", profile.ID, err)
+		}
+	}
+}
+
+func (s *AccountServiceImpl) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.PurgeDue(ctx); err != nil {
+				log.AppLogger.Errorf("注销到期账号失败: %v", err)
+			} else if n > 0 {
+				log.AppLogger.Infof("注销到期账号 %d 个", n)
+			}
+		}
+	}
+}
+
+// WriteDataArchive 将导出的个人数据按类别写入 zip 压缩包
+func WriteDataArchive(w io.Writer, export *domain.UserDataExport) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"addresses.json", export.Addresses},
+		{"orders.json", export.Orders},
+		{"favourites.json", export.Favourites},
+		{"cart.json", export.Cart},
+		{"identities.json", export.Identities},
+	}
+
+	zw := zip.NewWriter(w)
+	modified := time.Unix(export.ExportedAt, 0)
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"testing"
+	"time"
+)
+
+// fakeAccountRepo 在内存中保存注销申请, 记录被匿名化的用户
+type fakeAccountRepo struct {
+	profiles  map[int64]*domain.DataExportProfile
+	deletions map[int64]*domain.DeletionRequest
+	erased    []int64
+}
+
+func (r *fakeAccountRepo) GetProfile(ctx context.Context, userID int64) (*domain.DataExportProfile, error) {
+	if p, ok := r.profiles[userID]; ok {
+		return p, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeAccountRepo) RequestDeletion(ctx context.Context, req *domain.DeletionRequest) error {
+	if d, ok := r.deletions[req.UserID]; ok && d.Status == _const.DeletionStatusPending {
+		return domain.ErrDeletionPending
+	}
+	copied := *req
+	r.deletions[req.UserID] = &copied
+	return nil
+}
+
+func (r *fakeAccountRepo) GetDeletion(ctx context.Context, userID int64) (*domain.DeletionRequest, error) {
+	if d, ok := r.deletions[userID]; ok {
+		return d, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeAccountRepo) CancelDeletion(ctx context.Context, userID int64) (bool, error) {
+	d, ok := r.deletions[userID]
+	if !ok || d.Status != _const.DeletionStatusPending {
+		return false, nil
+	}
+	d.Status = _const.DeletionStatusCancelled
+	return true, nil
+}
+
+func (r *fakeAccountRepo) ListDueDeletions(ctx context.Context, now int64, limit int) ([]int64, error) {
+	var ids []int64
+	for id, d := range r.deletions {
+		if d.Status == _const.DeletionStatusPending && d.EraseAt <= now {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *fakeAccountRepo) Erase(ctx context.Context, userID int64) error {
+	r.deletions[userID].Status = _const.DeletionStatusErased
+	r.erased = append(r.erased, userID)
+	return nil
+}
+
+func (r *fakeAccountRepo) ListAddresses(ctx context.Context, userID int64) ([]*domain.Address, error) {
+	return []*domain.Address{{ID: 1, Uid: int(userID), Name: "Alice", Address: "成都"}}, nil
+}
+
+func (r *fakeAccountRepo) ListOrders(ctx context.Context, userID int64) ([]*domain.OrderSummary, error) {
+	return []*domain.OrderSummary{{Order: &domain.Order{ID: 10, UserID: userID}}}, nil
+}
+
+func (r *fakeAccountRepo) ListFavourites(ctx context.Context, userID int64) ([]*domain.ProductCollect, error) {
+	return nil, nil
+}
+
+func (r *fakeAccountRepo) ListCartItems(ctx context.Context, userID int64) ([]*domain.DataExportCartItem, error) {
+	return nil, nil
+}
+
+// fakeCodeUsers 只实现邮箱验证码校验
+type fakeCodeUsers struct {
+	UserService
+	code string
+}
+
+func (u fakeCodeUsers) CheckEmailVerificationCode(ctx context.Context, email string, code string) (bool, error) {
+	return code == u.code, nil
+}
+
+// fakeRevoker 记录被吊销登录状态的用户
+type fakeRevoker struct {
+	TokenService
+	revoked []int64
+}
+
+func (t *fakeRevoker) RevokeAll(ctx context.Context, role, userID int64) error {
+	t.revoked = append(t.revoked, userID)
+	return nil
+}
+
+func newTestAccountService(t *testing.T, grace time.Duration) (*AccountServiceImpl, *fakeAccountRepo, *fakeRevoker, *miniredis.Miniredis) {
+	accounts := &fakeAccountRepo{
+		profiles: map[int64]*domain.DataExportProfile{
+			1: {ID: 1, Email: "alice@example.com", RoleID: _const.UserRole},
+			2: {ID: 2, RoleID: _const.UserRole},
+		},
+		deletions: make(map[int64]*domain.DeletionRequest),
+	}
+	totpService := NewTOTPService(&fakeTOTPRepo{totps: make(map[int64]*domain.UserTOTP)}, nil, conf.SecurityConf{TOTPKey: "key"})
+	revoker := &fakeRevoker{}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	s := NewAccountService(accounts, &fakeIdentityRepo{}, fakeCodeUsers{code: "123456"}, nil, totpService, revoker,
+		repo.NewLoginGuardRepo(rdb), repo.NewSearchLogRepo(rdb), conf.AccountConf{DeletionGracePeriod: grace})
+	return s, accounts, revoker, mr
+}
+
+func TestAccountService_Deletion(t *testing.T) {
+	s, _, _, _ := newTestAccountService(t, time.Hour)
+	ctx := context.Background()
+
+	if _, err := s.RequestDeletion(ctx, 1, "000000", ""); !errors.Is(err, domain.ErrOTPInvalid) {
+		t.Fatalf("RequestDeletion(wrong code) err = %v, want %v", err, domain.ErrOTPInvalid)
+	}
+	req, err := s.RequestDeletion(ctx, 1, "123456", "")
+	if err != nil {
+		t.Fatalf("RequestDeletion err = %v", err)
+	}
+	if got := time.Duration(req.EraseAt-req.RequestedAt) * time.Second; got != time.Hour {
+		t.Errorf("grace period = %v, want %v", got, time.Hour)
+	}
+	if _, err = s.RequestDeletion(ctx, 1, "123456", ""); !errors.Is(err, domain.ErrDeletionPending) {
+		t.Errorf("RequestDeletion(again) err = %v, want %v", err, domain.ErrDeletionPending)
+	}
+	if _, err = s.DeletionStatus(ctx, 1); err != nil {
+		t.Errorf("DeletionStatus err = %v", err)
+	}
+
+	if err = s.CancelDeletion(ctx, 1); err != nil {
+		t.Fatalf("CancelDeletion err = %v", err)
+	}
+	if _, err = s.DeletionStatus(ctx, 1); !errors.Is(err, domain.ErrDeletionNotFound) {
+		t.Errorf("DeletionStatus after cancel err = %v, want %v", err, domain.ErrDeletionNotFound)
+	}
+	if err = s.CancelDeletion(ctx, 1); !errors.Is(err, domain.ErrDeletionNotFound) {
+		t.Errorf("CancelDeletion(again) err = %v, want %v", err, domain.ErrDeletionNotFound)
+	}
+	// 撤销后可以重新申请
+	if _, err = s.RequestDeletion(ctx, 1, "123456", ""); err != nil {
+		t.Errorf("RequestDeletion after cancel err = %v", err)
+	}
+}
+
+func TestAccountService_PurgeDue(t *testing.T) {
+	s, accounts, revoker, mr := newTestAccountService(t, time.Hour)
+	ctx := context.Background()
+	now := time.Now()
+	if err := s.searchLog.Record(ctx, 2, "耳机", 1, now, 10); err != nil {
+		t.Fatalf("Record err = %v", err)
+	}
+	if _, err := s.guard.AddFailure(ctx, domain.GuardKindAccount, guardAccount(2), now, time.Hour); err != nil {
+		t.Fatalf("AddFailure err = %v", err)
+	}
+
+	// 没有邮箱和手机号的账号不需要验证码
+	if _, err := s.RequestDeletion(ctx, 2, "", ""); err != nil {
+		t.Fatalf("RequestDeletion err = %v", err)
+	}
+	if _, err := s.RequestDeletion(ctx, 1, "123456", ""); err != nil {
+		t.Fatalf("RequestDeletion err = %v", err)
+	}
+	if n, _ := s.PurgeDue(ctx); n != 0 {
+		t.Fatalf("PurgeDue during grace period erased %d", n)
+	}
+
+	accounts.deletions[2].EraseAt = time.Now().Add(-time.Minute).Unix()
+	n, err := s.PurgeDue(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDue = %d, %v, want 1", n, err)
+	}
+	if len(accounts.erased) != 1 || accounts.erased[0] != 2 || len(revoker.revoked) != 1 || revoker.revoked[0] != 2 {
+		t.Errorf("erased = %v, revoked = %v, want [2]", accounts.erased, revoker.revoked)
+	}
+	for _, key := range []string{"search:recent:2", "guard:account:user:2:failures"} {
+		if mr.Exists(key) {
+			t.Errorf("key %s still exists after erase", key)
+		}
+	}
+	if err = s.CancelDeletion(ctx, 2); !errors.Is(err, domain.ErrDeletionNotFound) {
+		t.Errorf("CancelDeletion after erase err = %v, want %v", err, domain.ErrDeletionNotFound)
+	}
+}
+
+func TestWriteDataArchive(t *testing.T) {
+	s, _, _, _ := newTestAccountService(t, time.Hour)
+	export, err := s.Export(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Export err = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteDataArchive(&buf, export); err != nil {
+		t.Fatalf("WriteDataArchive err = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"profile.json", "addresses.json", "orders.json", "favourites.json", "cart.json", "identities.json"} {
+		if files[name] == nil {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+
+	rc, err := files["addresses.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var addresses []*domain.Address
+	if err = json.NewDecoder(rc).Decode(&addresses); err != nil || len(addresses) != 1 || addresses[0].Name != "Alice" {
+		t.Errorf("addresses.json = %+v, err = %v", addresses, err)
+	}
+}
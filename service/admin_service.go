@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/jwt"
+	"github.com/star-find-cloud/star-mall/repo"
+	"github.com/star-find-cloud/star-mall/utils"
+	"time"
+)
+
+const (
+	defaultAdminPageSize = 20
+	maxAdminPageSize     = 100
+)
+
+type AdminService interface {
+	// Login 管理员登录, 返回 token 和管理员信息, 停用的管理员不能登录
+	Login(ctx context.Context, userName, password string) (*domain.TokenPair, *domain.Admin, error)
+
+	// Refresh 使用刷新 token 换取新的 token
+	Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error)
+
+	// Logout 退出登录, 注销当前 token 所属的会话
+	Logout(ctx context.Context, claims *jwt.CustomClaims) error
+
+	// SearchUsers 按用户名、邮箱或手机号搜索用户
+	SearchUsers(ctx context.Context, keyword string, status int64, limit, offset int) ([]*domain.User, error)
+
+	// BanUser 封禁用户, 封禁后用户不能登录, 已登录的会话全部失效
+	BanUser(ctx context.Context, id int64) error
+
+	// UnbanUser 解封用户
+	UnbanUser(ctx context.Context, id int64) error
+
+	// DisableAdmin 停用管理员, 停用后立即失去全部权限, 已登录的会话全部失效
+	DisableAdmin(ctx context.Context, id int64) error
+
+	// EnableAdmin 重新启用已停用的管理员
+	EnableAdmin(ctx context.Context, id int64) error
+
+	// ListMerchants 按审核状态获取商家列表, status 为 0 时返回待审核商家
+	ListMerchants(ctx context.Context, status, limit, offset int) ([]*domain.Merchant, error)
+
+	// ApproveMerchant 审核通过待审核的商家
+	ApproveMerchant(ctx context.Context, id int64) error
+
+	// RejectMerchant 驳回待审核的商家
+	RejectMerchant(ctx context.Context, id int64) error
+
+	// ListProducts 按状态和标题获取商品列表
+	ListProducts(ctx context.Context, status int, keyword string, limit, offset int) ([]*domain.Product, error)
+
+	// TakedownProduct 强制下架违规商品
+	TakedownProduct(ctx context.Context, id int64) error
+
+	// RestoreProduct 恢复上架商品
+	RestoreProduct(ctx context.Context, id int64) error
+
+	// Dashboard 统计时间范围内的成交额、订单数和新用户数, 未指定时统计当天
+	Dashboard(ctx context.Context, startAt, endAt int64) (*domain.DashboardSummary, error)
+
+	// ListAuditLogs 查询管理员操作审计日志
+	ListAuditLogs(ctx context.Context, query *domain.AuditQuery) ([]*domain.AuditLog, error)
+
+	// Record 记录管理员操作审计日志
+	Record(ctx context.Context, log *domain.AuditLog) error
+}
+
+type AdminServiceImpl struct {
+	adminRepo repo.AdminRepo
+	auditRepo repo.AuditRepo
+	userRepo  repo.UserRepo
+	tokens    TokenService
+}
+
+func NewAdminService(adminRepo repo.AdminRepo, auditRepo repo.AuditRepo, userRepo repo.UserRepo, tokens TokenService) *AdminServiceImpl {
+	return &AdminServiceImpl{
+		adminRepo: adminRepo,
+		auditRepo: auditRepo,
+		userRepo:  userRepo,
+		tokens:    tokens,
+	}
+}
+
+func (s *AdminServiceImpl) Login(ctx context.Context, userName, password string) (*domain.TokenPair, *domain.Admin, error) {
+	admin, err := s.adminRepo.GetByUserName(ctx, userName)
+	if err != nil {
+		return nil, nil, errors.New("invalid user name or password")
+	}
+	if err = utils.CheckPasswordHash(password, admin.Password); err != nil {
+		return nil, nil, errors.New("invalid user name or password")
+	}
+	if !admin.IsEnabled() {
+		return nil, nil, domain.ErrAdminDisabled
+	}
+
+	token, err := s.tokens.Issue(ctx, admin.ID, admin.UserName, _const.AdminRole)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, admin, nil
+}
+
+func (s *AdminServiceImpl) Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	return s.tokens.Refresh(ctx, refreshToken, _const.AdminRole)
+}
+
+func (s *AdminServiceImpl) Logout(ctx context.Context, claims *jwt.CustomClaims) error {
+	return s.tokens.Revoke(ctx, claims)
+}
+
+func (s *AdminServiceImpl) SearchUsers(ctx context.Context, keyword string, status int64, limit, offset int) ([]*domain.User, error) {
+	limit, offset = adminPage(limit, offset)
+	return s.adminRepo.SearchUsers(ctx, keyword, status, limit, offset)
+}
+
+func (s *AdminServiceImpl) BanUser(ctx context.Context, id int64) error {
+	status, role, err := s.userRepo.GetStatusAndRoleByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status == _const.AccountStatusBanned {
+		return errors.New("用户已被封禁")
+	}
+	if err = s.adminRepo.UpdateUserStatus(ctx, id, _const.AccountStatusBanned); err != nil {
+		return err
+	}
+	// 商家账号的会话按商家角色保存
+	return s.tokens.RevokeAll(ctx, role, id)
+}
+
+func (s *AdminServiceImpl) UnbanUser(ctx context.Context, id int64) error {
+	status, err := s.userRepo.GetStatusByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status != _const.AccountStatusBanned {
+		return errors.New("用户未被封禁")
+	}
+	return s.adminRepo.UpdateUserStatus(ctx, id, _const.StatusNotDeleted)
+}
+
+func (s *AdminServiceImpl) DisableAdmin(ctx context.Context, id int64) error {
+	if err := s.adminRepo.UpdateAdminStatus(ctx, id, domain.AdminStatusEnabled, domain.AdminStatusDisabled); err != nil {
+		return err
+	}
+	return s.tokens.RevokeAll(ctx, _const.AdminRole, id)
+}
+
+func (s *AdminServiceImpl) EnableAdmin(ctx context.Context, id int64) error {
+	return s.adminRepo.UpdateAdminStatus(ctx, id, domain.AdminStatusDisabled, domain.AdminStatusEnabled)
+}
+
+func (s *AdminServiceImpl) ListMerchants(ctx context.Context, status, limit, offset int) ([]*domain.Merchant, error) {
+	if status == 0 {
+		status = _const.MerchantStatusPending
+	}
+	limit, offset = adminPage(limit, offset)
+	return s.adminRepo.ListMerchants(ctx, status, limit, offset)
+}
+
+func (s *AdminServiceImpl) ApproveMerchant(ctx context.Context, id int64) error {
+	return s.adminRepo.UpdateMerchantStatus(ctx, id, _const.MerchantStatusPending, _const.MerchantStatusApproved)
+}
+
+func (s *AdminServiceImpl) RejectMerchant(ctx context.Context, id int64) error {
+	return s.adminRepo.UpdateMerchantStatus(ctx, id, _const.MerchantStatusPending, _const.MerchantStatusRejected)
+}
+
+func (s *AdminServiceImpl) ListProducts(ctx context.Context, status int, keyword string, limit, offset int) ([]*domain.Product, error) {
+	limit, offset = adminPage(limit, offset)
+	return s.adminRepo.ListProducts(ctx, status, keyword, limit, offset)
+}
+
+func (s *AdminServiceImpl) TakedownProduct(ctx context.Context, id int64) error {
+	return s.adminRepo.UpdateProductStatus(ctx, id, _const.ProductStatusOffSale)
+}
+
+func (s *AdminServiceImpl) RestoreProduct(ctx context.Context, id int64) error {
+	return s.adminRepo.UpdateProductStatus(ctx, id, _const.ProductStatusOnSale)
+}
+
+func (s *AdminServiceImpl) Dashboard(ctx context.Context, startAt, endAt int64) (*domain.DashboardSummary, error) {
+	if startAt == 0 && endAt == 0 {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		startAt, endAt = today.Unix(), today.AddDate(0, 0, 1).Unix()
+	}
+	if endAt == 0 {
+		endAt = time.Now().Unix()
+	}
+	if startAt >= endAt {
+		return nil, errors.New("开始时间必须早于结束时间")
+	}
+	return s.adminRepo.Dashboard(ctx, startAt, endAt)
+}
+
+func (s *AdminServiceImpl) ListAuditLogs(ctx context.Context, query *domain.AuditQuery) ([]*domain.AuditLog, error) {
+	query.Limit, query.Offset = adminPage(query.Limit, query.Offset)
+	return s.auditRepo.List(ctx, query)
+}
+
+func (s *AdminServiceImpl) Record(ctx context.Context, log *domain.AuditLog) error {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = time.Now().Unix()
+	}
+	return s.auditRepo.Create(ctx, log)
+}
+
+// adminPage 规范化后台列表的分页参数
+func adminPage(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = defaultAdminPageSize
+	}
+	return min(limit, maxAdminPageSize), max(offset, 0)
+}
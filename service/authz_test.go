@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	"github.com/star-find-cloud/star-mall/repo"
+	"testing"
+)
+
+// fakeOrderRepo 仅实现归属校验用到的方法, GetByID 返回订单的副本
+type fakeOrderRepo struct {
+	repo.OrderRepo
+	order *domain.Order
+	item  *domain.OrderItem
+}
+
+func (r *fakeOrderRepo) GetByID(ctx context.Context, orderID int64) (*domain.Order, *domain.OrderItem, error) {
+	copied := *r.order
+	return &copied, r.item, nil
+}
+
+func (r *fakeOrderRepo) UpdateStatus(ctx context.Context, order *domain.Order) error {
+	return nil
+}
+
+func (r *fakeOrderRepo) TransitionStatus(ctx context.Context, id int64, from, to string) error {
+	if r.order.OrderStatus != from {
+		return fmt.Errorf("%w: order %d with status %s", sql.ErrNoRows, id, from)
+	}
+	r.order.OrderStatus = to
+	return nil
+}
+
+type fakeProductRepo struct {
+	repo.ProductRepo
+	merchantID int64
+}
+
+func (r *fakeProductRepo) GetMerchantID(ctx context.Context, id int64) (int64, error) {
+	return r.merchantID, nil
+}
+
+func (r *fakeProductRepo) GetByID(ctx context.Context, id int64) (*domain.Product, error) {
+	return &domain.Product{ID: id, MerchantID: r.merchantID, Status: _const.ProductStatusOnSale}, nil
+}
+
+func (r *fakeProductRepo) Update(ctx context.Context, product *domain.Product) error {
+	return nil
+}
+
+func (r *fakeProductRepo) GetAvailableStock(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	return map[int64]int64{}, nil
+}
+
+type fakeInventoryRepo struct {
+	repo.InventoryRepo
+}
+
+func (r *fakeInventoryRepo) Update(ctx context.Context, inventory *domain.Inventory) error {
+	return nil
+}
+
+func TestOrderService_GetByID_CrossTenant(t *testing.T) {
+	orderRepo := &fakeOrderRepo{
+		order: &domain.Order{ID: 1, UserID: 10, OrderStatus: _const.OrderStatusPendingPayment},
+		item:  &domain.OrderItem{OrderID: 1, ProductID: 100},
+	}
+	s := NewOrderService(orderRepo, &fakeProductRepo{merchantID: 20}, nil, nil, nil, nil)
+
+	tests := []struct {
+		name  string
+		actor domain.Actor
+		want  error
+	}{
+		{"owner", domain.Actor{ID: 10, Role: _const.UserRole}, nil},
+		{"other user", domain.Actor{ID: 11, Role: _const.UserRole}, domain.ErrForbidden},
+		{"owning merchant", domain.Actor{ID: 20, Role: _const.MerchantRole}, nil},
+		{"other merchant", domain.Actor{ID: 21, Role: _const.MerchantRole}, domain.ErrForbidden},
+		{"merchant with user id", domain.Actor{ID: 10, Role: _const.MerchantRole}, domain.ErrForbidden},
+		{"admin", domain.Actor{ID: 1, Role: _const.AdminRole}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.GetByID(context.Background(), 1, tt.actor)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetByID() err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderService_Cancel_OtherUser(t *testing.T) {
+	orderRepo := &fakeOrderRepo{
+		order: &domain.Order{ID: 1, UserID: 10, OrderStatus: _const.OrderStatusPendingPayment},
+		item:  &domain.OrderItem{OrderID: 1, ProductID: 100},
+	}
+	s := NewOrderService(orderRepo, &fakeProductRepo{merchantID: 20}, nil, nil, nil, nil)
+
+	err := s.Cancel(context.Background(), 1, domain.Actor{ID: 11, Role: _const.UserRole})
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("Cancel() err = %v, want %v", err, domain.ErrForbidden)
+	}
+	if orderRepo.order.OrderStatus != _const.OrderStatusPendingPayment {
+		t.Errorf("order status changed to %s", orderRepo.order.OrderStatus)
+	}
+}
+
+// staleOrderRepo 读取时订单仍是待付款, 状态转换前已被并发请求取消
+type staleOrderRepo struct {
+	*fakeOrderRepo
+}
+
+func (r staleOrderRepo) GetByID(ctx context.Context, orderID int64) (*domain.Order, *domain.OrderItem, error) {
+	return &domain.Order{ID: orderID, UserID: r.order.UserID, OrderStatus: _const.OrderStatusPendingPayment}, r.item, nil
+}
+
+func TestOrderService_Cancel_Concurrent(t *testing.T) {
+	orderRepo := &fakeOrderRepo{
+		order: &domain.Order{ID: 1, UserID: 10, OrderStatus: _const.OrderStatusCanceled},
+		item:  &domain.OrderItem{OrderID: 1, ProductID: 100},
+	}
+	// 优惠券和库存为 nil, 状态转换失败后仍退回会直接 panic
+	s := NewOrderService(staleOrderRepo{orderRepo}, &fakeProductRepo{merchantID: 20}, nil, nil, nil, nil)
+
+	err := s.Cancel(context.Background(), 1, domain.Actor{ID: 10, Role: _const.UserRole})
+	if !errors.Is(err, domain.ErrOrderNotCancelable) {
+		t.Errorf("Cancel() err = %v, want %v", err, domain.ErrOrderNotCancelable)
+	}
+}
+
+func TestInventoryService_Update_OtherMerchant(t *testing.T) {
+	s := NewInventoryService(&fakeInventoryRepo{}, nil, &fakeProductRepo{merchantID: 20})
+	inventory := &domain.Inventory{ProductID: 100, AvailableStock: 5}
+
+	if err := s.Update(context.Background(), inventory, domain.Actor{ID: 21, Role: _const.MerchantRole}); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("other merchant Update() err = %v, want %v", err, domain.ErrForbidden)
+	}
+	if err := s.Update(context.Background(), inventory, domain.Actor{ID: 20, Role: _const.MerchantRole}); err != nil {
+		t.Errorf("owning merchant Update() err = %v", err)
+	}
+}
+
+func TestProductService_Update_KeepsOwner(t *testing.T) {
+	s := NewProductService(&fakeProductRepo{merchantID: 20}, nil, nil, search.NewMemoryIndex())
+
+	product := &domain.Product{ID: 100, MerchantID: 21}
+	if err := s.Update(context.Background(), product, domain.Actor{ID: 21, Role: _const.MerchantRole}); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("other merchant Update() err = %v, want %v", err, domain.ErrForbidden)
+	}
+
+	if err := s.Update(context.Background(), product, domain.Actor{ID: 1, Role: _const.AdminRole}); err != nil {
+		t.Fatalf("admin Update() err = %v", err)
+	}
+	if product.MerchantID != 20 {
+		t.Errorf("product.MerchantID = %d, want 20", product.MerchantID)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"time"
+)
+
+type CouponService interface {
+	// Create 创建优惠券模板, 平台券由管理员创建, 商家券的 MerchantID 由调用方指定
+	Create(ctx context.Context, coupon *domain.Coupon) (int64, error)
+
+	// ListAvailable 获取当前可领取的优惠券, merchantID 为 0 时返回全部
+	ListAvailable(ctx context.Context, merchantID int64) ([]*domain.Coupon, error)
+
+	// Claim 用户领取优惠券
+	Claim(ctx context.Context, couponID, userID int64) (int64, error)
+
+	// Wallet 获取用户钱包中的优惠券
+	Wallet(ctx context.Context, userID int64, status int) ([]*domain.UserCoupon, error)
+
+	// Plan 为订单计算最优优惠组合, userCouponIDs 不为空时只在指定的优惠券中选择
+	Plan(ctx context.Context, userID int64, userCouponIDs []int64, lines []domain.CouponLine, shippingFee int64) (*domain.DiscountPlan, error)
+
+	// Use 核销优惠方案中的优惠券
+	Use(ctx context.Context, userID, orderID int64, plan *domain.DiscountPlan) error
+
+	// Return 订单取消后退回优惠券
+	Return(ctx context.Context, orderID int64) error
+}
+
+type CouponServiceImpl struct {
+	couponRepo repo.CouponRepo
+	vip        MembershipService
+}
+
+func NewCouponService(couponRepo repo.CouponRepo, vip MembershipService) *CouponServiceImpl {
+	return &CouponServiceImpl{couponRepo: couponRepo, vip: vip}
+}
+
+func (s *CouponServiceImpl) Create(ctx context.Context, coupon *domain.Coupon) (int64, error) {
+	coupon, err := domain.NewCoupon(coupon)
+	if err != nil {
+		return 0, err
+	}
+	return s.couponRepo.Create(ctx, coupon)
+}
+
+func (s *CouponServiceImpl) ListAvailable(ctx context.Context, merchantID int64) ([]*domain.Coupon, error) {
+	return s.couponRepo.ListAvailable(ctx, merchantID, time.Now().Unix())
+}
+
+func (s *CouponServiceImpl) Claim(ctx context.Context, couponID, userID int64) (int64, error) {
+	if userID == 0 {
+		return 0, errors.New("userID is empty")
+	}
+
+	coupon, err := s.couponRepo.GetByID(ctx, couponID)
+	if err != nil {
+		return 0, err
+	}
+	if !coupon.IsActive(time.Now().Unix()) {
+		return 0, domain.ErrCouponUnavailable
+	}
+	if coupon.VipLevel > 0 {
+		tier, err := s.vip.ActiveTier(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if tier == nil || tier.Level < coupon.VipLevel {
+			return 0, domain.ErrCouponVipOnly
+		}
+	}
+
+	// 发放总量和每人限领数量在锁定优惠券的事务中校验, 写入钱包失败时发放数量一并回滚
+	id, err := s.couponRepo.Claim(ctx, &domain.UserCoupon{
+		CouponID:  couponID,
+		UserID:    userID,
+		ClaimedAt: time.Now().Unix(),
+	}, coupon.PerUserLimit)
+	if err != nil {
+		if errors.Is(err, domain.ErrCouponSoldOut) || errors.Is(err, domain.ErrCouponClaimLimit) {
+			return 0, err
+		}
+		applog.AppLogger.Errorf("领取优惠券失败: %v", err)
+		return 0, fmt.Errorf("领取优惠券失败: %w", err)
+	}
+	return id, nil
+}
+
+func (s *CouponServiceImpl) Wallet(ctx context.Context, userID int64, status int) ([]*domain.UserCoupon, error) {
+	if userID == 0 {
+		return nil, errors.New("userID is empty")
+	}
+	return s.couponRepo.GetWallet(ctx, userID, status)
+}
+
+func (s *CouponServiceImpl) Plan(ctx context.Context, userID int64, userCouponIDs []int64, lines []domain.CouponLine, shippingFee int64) (*domain.DiscountPlan, error) {
+	wallet, err := s.couponRepo.GetWallet(ctx, userID, _const.UserCouponUnused)
+	if err != nil {
+		return nil, err
+	}
+
+	// 指定了优惠券时, 只在指定范围内选择, 且每一张都必须可用
+	if len(userCouponIDs) > 0 {
+		owned := make(map[int64]*domain.UserCoupon, len(wallet))
+		for _, uc := range wallet {
+			owned[uc.ID] = uc
+		}
+		selected := make([]*domain.UserCoupon, 0, len(userCouponIDs))
+		for _, id := range userCouponIDs {
+			uc, ok := owned[id]
+			if !ok {
+				return nil, domain.ErrCouponUnavailable
+			}
+			selected = append(selected, uc)
+		}
+		wallet = selected
+	}
+
+	plan := domain.PlanDiscounts(wallet, lines, shippingFee, time.Now().Unix())
+	for _, id := range userCouponIDs {
+		if !plan.Uses(id) {
+			return nil, fmt.Errorf("%w: 优惠券 %d 不满足使用条件或无法与其他优惠券叠加", domain.ErrCouponUnavailable, id)
+		}
+	}
+	return plan, nil
+}
+
+func (s *CouponServiceImpl) Use(ctx context.Context, userID, orderID int64, plan *domain.DiscountPlan) error {
+	for _, d := range plan.Discounts {
+		if err := s.couponRepo.MarkUsed(ctx, d.UserCouponID, userID, orderID); err != nil {
+			// 回滚已核销的优惠券
+			if rerr := s.couponRepo.ReturnByOrder(ctx, orderID); rerr != nil {
+				applog.AppLogger.Errorf("退回优惠券失败: %v", rerr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CouponServiceImpl) Return(ctx context.Context, orderID int64) error {
+	return s.couponRepo.ReturnByOrder(ctx, orderID)
+}
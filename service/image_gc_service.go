@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/conf"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"time"
+)
+
+type ImageGCService interface {
+	// CollectOnce 删除一批引用数为 0 且超过保留时间的图片内容及其各尺寸版本, 返回删除的数量
+	CollectOnce(ctx context.Context) (int, error)
+
+	// Run 定期回收无引用的图片内容, 直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+const (
+	defaultImageGCInterval = time.Hour
+	defaultImageGCDelay    = 24 * time.Hour
+	imageGCBatchSize       = 100
+)
+
+type ImageGCServiceImpl struct {
+	repo     repo.ImageRepo
+	store    ImageStore
+	interval time.Duration
+	delay    time.Duration
+	now      func() time.Time
+}
+
+func NewImageGCService(repo repo.ImageRepo, store ImageStore, c conf.ImageConf) *ImageGCServiceImpl {
+	if c.GCInterval <= 0 {
+		c.GCInterval = defaultImageGCInterval
+	}
+	if c.GCDelay <= 0 {
+		c.GCDelay = defaultImageGCDelay
+	}
+	return &ImageGCServiceImpl{
+		repo:     repo,
+		store:    store,
+		interval: c.GCInterval,
+		delay:    c.GCDelay,
+		now:      time.Now,
+	}
+}
+
+// CollectOnce 保留时间内重新上传相同内容的图片会复用该内容, 删除时再次确认引用数, 单个内容删除失败不影响其他内容
+func (s *ImageGCServiceImpl) CollectOnce(ctx context.Context) (int, error) {
+	releasedBefore := s.now().Add(-s.delay).Unix()
+	blobs, err := s.repo.ListReleasedBlobs(ctx, releasedBefore, imageGCBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	for _, blob := range blobs {
+		ok, err := s.repo.DeleteBlob(ctx, blob.SHA256Hash, releasedBefore, func(paths []string) error {
+			for _, path := range paths {
+				if err := s.store.Remove(ctx, path); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.AppLogger.Errorf("回收图片内容 %s 失败: %v", blob.SHA256Hash, err)
+			continue
+		}
+		if ok {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *ImageGCServiceImpl) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := s.CollectOnce(ctx)
+				if err != nil {
+					log.AppLogger.Errorf("回收图片内容失败: %v", err)
+					break
+				}
+				if n > 0 {
+					log.AppLogger.Infof("回收图片内容 %d 个", n)
+				}
+				if n < imageGCBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
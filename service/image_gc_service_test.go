@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingImageStore 写入和删除文件时返回错误
+type failingImageStore struct {
+	ImageStore
+}
+
+func (failingImageStore) Put(ctx context.Context, path, contentType string, r io.Reader) error {
+	return errors.New("store unavailable")
+}
+
+func (failingImageStore) Remove(ctx context.Context, path string) error {
+	return errors.New("store unavailable")
+}
+
+func TestImageGCService_CollectOnce(t *testing.T) {
+	dir := t.TempDir()
+	images := &fakeImageRepo{images: map[int64]*domain.Image{}}
+	s := NewImageForDBService(images, nil, dir, nil)
+	ctx := context.Background()
+	owner := domain.Actor{ID: 7, Role: _const.UserRole}
+	upload := func() int64 {
+		id, err := s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 7}, formFile(t, "a.png", pngBytes(t, 10, 10)), owner)
+		if err != nil {
+			t.Fatalf("Upload err = %v", err)
+		}
+		return id
+	}
+
+	id := upload()
+	path := filepath.Join(dir, filepath.FromSlash(images.images[id].Path))
+	if err := s.Remove(ctx, id, owner); err != nil {
+		t.Fatalf("Remove err = %v", err)
+	}
+
+	now := time.Now()
+	gc := NewImageGCService(images, NewLocalImageStore(dir), conf.ImageConf{GCDelay: time.Hour})
+	gc.now = func() time.Time { return now }
+
+	// 保留时间内不回收, 重新上传相同内容时复用原文件
+	if n, err := gc.CollectOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("CollectOnce within delay = %d, %v, want 0", n, err)
+	}
+	id = upload()
+	if err := s.Remove(ctx, id, owner); err != nil {
+		t.Fatalf("Remove err = %v", err)
+	}
+
+	// 删除文件失败时保留记录, 下次继续回收
+	now = now.Add(2 * time.Hour)
+	failing := NewImageGCService(images, failingImageStore{}, conf.ImageConf{GCDelay: time.Hour})
+	failing.now = gc.now
+	if n, err := failing.CollectOnce(ctx); err != nil || n != 0 || len(images.blobs) != 1 {
+		t.Fatalf("CollectOnce with failing store = %d, %v, %d blobs left", n, err, len(images.blobs))
+	}
+
+	if n, err := gc.CollectOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("CollectOnce after delay = %d, %v, want 1", n, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file still exists after collection: %v", err)
+	}
+	if len(images.blobs) != 0 {
+		t.Errorf("%d blobs left after collection", len(images.blobs))
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/imageproc"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"image"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ImageProcessService interface {
+	// Enqueue 将图片加入处理队列, 队列已满时返回 false, 该图片在下次启动补处理时生成
+	Enqueue(imageID int64) bool
+
+	// Process 生成图片的各尺寸版本并记录, 已有的版本会被替换. 不支持处理的格式直接跳过
+	Process(ctx context.Context, imageID int64) error
+
+	// Resolve 返回图片指定尺寸的版本, webp 为 true 时优先返回 WebP. size 为空或 original, 以及版本尚未生成时返回原图, 返回的版本设置 Variant
+	Resolve(ctx context.Context, original *domain.Image, size string, webp bool) (*domain.Image, error)
+
+	// Run 启动 worker 处理队列中的图片, 并补处理之前未能处理的图片, 直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+const (
+	defaultImageWorkers    = 2
+	defaultImageQueueSize  = 256
+	imageProcessTimeout    = 2 * time.Minute
+	imageBackfillBatchSize = 100
+)
+
+// processableContentTypes 标准库能够解码的图片格式
+var processableContentTypes = []int64{_const.JPG, _const.JPEG, _const.PNG, _const.GIF}
+
+var formatContentTypes = map[imageproc.Format]int64{
+	imageproc.JPEG: _const.JPG,
+	imageproc.PNG:  _const.PNG,
+	imageproc.WebP: _const.WEBP,
+}
+
+type ImageProcessServiceImpl struct {
+	repo       repo.ImageRepo
+	store      ImageStore
+	encoder    imageproc.Encoder
+	sizes      []conf.ImageSizeConf
+	webp       bool
+	workers    int
+	queue      chan int64
+	webpWarned sync.Once
+	now        func() time.Time
+}
+
+func NewImageProcessService(repo repo.ImageRepo, store ImageStore, c conf.ImageConf) *ImageProcessServiceImpl {
+	if c.Workers <= 0 {
+		c.Workers = defaultImageWorkers
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultImageQueueSize
+	}
+	if len(c.Sizes) == 0 {
+		c.Sizes = []conf.ImageSizeConf{{Name: "thumbnail", Width: 200}, {Name: "medium", Width: 800}, {Name: "large", Width: 1600}}
+	}
+	return &ImageProcessServiceImpl{
+		repo:    repo,
+		store:   store,
+		encoder: imageproc.Encoder{Quality: c.Quality, CWebP: c.CWebP},
+		sizes:   c.Sizes,
+		webp:    c.WebP,
+		workers: c.Workers,
+		queue:   make(chan int64, c.QueueSize),
+		now:     time.Now,
+	}
+}
+
+func (s *ImageProcessServiceImpl) Enqueue(imageID int64) bool {
+	select {
+	case s.queue <- imageID:
+		return true
+	default:
+		log.AppLogger.Warnf("图片处理队列已满, 图片 %d 将在下次启动时处理", imageID)
+		return false
+	}
+}
+
+func (s *ImageProcessServiceImpl) Process(ctx context.Context, imageID int64) error {
+	original, err := s.repo.GetByID(ctx, imageID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(processableContentTypes, original.ContentType) {
+		return nil
+	}
+
+	r, err := s.store.Open(ctx, original.Path)
+	if err != nil {
+		return err
+	}
+	src, err := imageproc.Decode(r)
+	_ = r.Close()
+	if err != nil {
+		return fmt.Errorf("%w: image %d: %v", domain.ErrImageProcessFailed, imageID, err)
+	}
+
+	webp := s.webp
+	variants := make([]*domain.ImageVariant, 0, len(s.sizes)*2)
+	for _, size := range s.sizes {
+		resized := imageproc.Resize(src, size.Width)
+		formats := []imageproc.Format{imageproc.FormatFor(resized)}
+		if webp {
+			formats = append(formats, imageproc.WebP)
+		}
+		for _, f := range formats {
+			v, err := s.saveVariant(ctx, original, size.Name, resized, f)
+			if errors.Is(err, imageproc.ErrWebPUnavailable) {
+				s.webpWarned.Do(func() { log.AppLogger.Warnf("未生成 WebP 版本: %v", err) })
+				webp = false
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			variants = append(variants, v)
+		}
+	}
+	return s.repo.SaveVariants(ctx, imageID, variants)
+}
+
+// saveVariant 编码并保存一个版本, 路径为原图路径去掉扩展名后加上尺寸名, 如 image/31002/7/123_thumbnail.jpg
+func (s *ImageProcessServiceImpl) saveVariant(ctx context.Context, original *domain.Image, size string, img *image.RGBA, f imageproc.Format) (*domain.ImageVariant, error) {
+	var buf bytes.Buffer
+	if err := s.encoder.Encode(ctx, &buf, img, f); err != nil {
+		if errors.Is(err, imageproc.ErrWebPUnavailable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: image %d: %v", domain.ErrImageProcessFailed, original.ImageID, err)
+	}
+	contentType := formatContentTypes[f]
+	sum := sha256.Sum256(buf.Bytes())
+	v := &domain.ImageVariant{
+		ImageID:     original.ImageID,
+		Size:        size,
+		ContentType: contentType,
+		Path:        strings.TrimSuffix(original.Path, path.Ext(original.Path)) + "_" + size + _const.ContentTypeStringMap[contentType],
+		SHA256Hash:  hex.EncodeToString(sum[:]),
+		Width:       img.Rect.Dx(),
+		Height:      img.Rect.Dy(),
+		Bytes:       int64(buf.Len()),
+		CreateAt:    s.now().Unix(),
+	}
+	if err := s.store.Put(ctx, v.Path, _const.ContentTypeMIMEMap[contentType], &buf); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *ImageProcessServiceImpl) Resolve(ctx context.Context, original *domain.Image, size string, webp bool) (*domain.Image, error) {
+	if size == "" || size == domain.ImageSizeOriginal {
+		return original, nil
+	}
+	if !slices.ContainsFunc(s.sizes, func(c conf.ImageSizeConf) bool { return c.Name == size }) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrImageSizeUnknown, size)
+	}
+	if !original.IsCompressed {
+		return original, nil
+	}
+	variants, err := s.repo.GetVariants(ctx, original.ImageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chosen *domain.ImageVariant
+	for _, v := range variants {
+		if v.Size != size {
+			continue
+		}
+		if (v.ContentType == _const.WEBP) == webp {
+			chosen = v
+			break
+		}
+		if chosen == nil {
+			chosen = v
+		}
+	}
+	if chosen == nil {
+		return original, nil
+	}
+	resolved := *original
+	resolved.Path = chosen.Path
+	resolved.ContentType = chosen.ContentType
+	resolved.SHA256Hash = chosen.SHA256Hash
+	resolved.Variant = chosen.Size
+	return &resolved, nil
+}
+
+func (s *ImageProcessServiceImpl) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	s.backfill(ctx)
+	wg.Wait()
+}
+
+func (s *ImageProcessServiceImpl) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			processCtx, cancel := context.WithTimeout(ctx, imageProcessTimeout)
+			if err := s.Process(processCtx, id); err != nil {
+				log.AppLogger.Errorf("处理图片 %d 失败: %v", id, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// backfill 将尚未处理的图片逐批加入队列, 包括队列已满时没有加入的和服务重启前未处理完的图片
+func (s *ImageProcessServiceImpl) backfill(ctx context.Context) {
+	var afterID int64
+	for {
+		images, err := s.repo.ListUnprocessed(ctx, afterID, imageBackfillBatchSize, processableContentTypes)
+		if err != nil {
+			log.AppLogger.Errorf("获取未处理的图片失败: %v", err)
+			return
+		}
+		if len(images) == 0 {
+			return
+		}
+		for _, img := range images {
+			select {
+			case s.queue <- img.ImageID:
+			case <-ctx.Done():
+				return
+			}
+		}
+		afterID = images[len(images)-1].ImageID
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	img.SetRGBA(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageProcessService_Process(t *testing.T) {
+	dir := t.TempDir()
+	images := &fakeImageRepo{images: map[int64]*domain.Image{}}
+	processor := NewImageProcessService(images, NewLocalImageStore(dir), conf.ImageConf{
+		Sizes: []conf.ImageSizeConf{{Name: "thumbnail", Width: 100}, {Name: "large", Width: 1000}},
+		WebP:  true,
+		CWebP: filepath.Join(dir, "missing-cwebp"),
+	})
+	s := NewImageForDBService(images, nil, dir, processor)
+	ctx := context.Background()
+	owner := domain.Actor{ID: 7, Role: _const.UserRole}
+
+	id, err := s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 7}, formFile(t, "photo.png", pngBytes(t, 400, 200)), owner)
+	if err != nil {
+		t.Fatalf("Upload err = %v", err)
+	}
+	if len(processor.queue) != 1 {
+		t.Fatalf("queue length = %d, want the uploaded image", len(processor.queue))
+	}
+
+	// 处理完成前返回原图, 未知尺寸被拒绝
+	original, _, err := s.Download(ctx, id, "thumbnail", false)
+	if err != nil || original.ContentType != _const.PNG {
+		t.Fatalf("Download before processing = %+v, %v, want original", original, err)
+	}
+	if _, _, err = s.Download(ctx, id, "huge", false); !errors.Is(err, domain.ErrImageSizeUnknown) {
+		t.Errorf("Download unknown size err = %v, want %v", err, domain.ErrImageSizeUnknown)
+	}
+
+	// 没有 cwebp 时跳过 WebP, 仍然生成 JPEG 版本, 不放大小图
+	if err = processor.Process(ctx, id); err != nil {
+		t.Fatalf("Process err = %v", err)
+	}
+	variants := images.variants[id]
+	if len(variants) != 2 || !images.images[id].IsCompressed {
+		t.Fatalf("variants = %+v, compressed = %v", variants, images.images[id].IsCompressed)
+	}
+	if v := variants[1]; v.Size != "large" || v.Width != 400 || v.Height != 200 {
+		t.Errorf("large variant = %+v, want original size 400x200", v)
+	}
+
+	thumb, path, err := s.Download(ctx, id, "thumbnail", true)
+	if err != nil {
+		t.Fatalf("Download thumbnail err = %v", err)
+	}
+	if thumb.ContentType != _const.JPG || !strings.HasSuffix(path, "_thumbnail.jpg") {
+		t.Errorf("thumbnail = %+v at %s, want jpg variant", thumb, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if thumb.SHA256Hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("thumbnail hash = %s, want hash of the variant file", thumb.SHA256Hash)
+	}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("thumbnail = %+v, %v, want 100x50", cfg, err)
+	}
+
+	// 回收内容时删除所有版本
+	if err = s.Remove(ctx, id, owner); err != nil {
+		t.Fatalf("Remove err = %v", err)
+	}
+	gc := NewImageGCService(images, NewLocalImageStore(dir), conf.ImageConf{})
+	gc.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if n, err := gc.CollectOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("CollectOnce = %d, %v, want 1", n, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 0 {
+		t.Errorf("%d files left after collection", len(entries))
+	}
+
+	// 无法解码的图片返回处理失败
+	images.images[99] = &domain.Image{ImageID: 99, Path: "image/bad.png", ContentType: _const.PNG}
+	_ = os.MkdirAll(filepath.Join(dir, "image"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "image", "bad.png"), []byte("\x89PNG broken"), 0o644)
+	if err = processor.Process(ctx, 99); !errors.Is(err, domain.ErrImageProcessFailed) {
+		t.Errorf("Process broken image err = %v, want %v", err, domain.ErrImageProcessFailed)
+	}
+}
+
+func TestImageProcessService_Backfill(t *testing.T) {
+	dir := t.TempDir()
+	images := &fakeImageRepo{images: map[int64]*domain.Image{
+		1: {ImageID: 1, Path: "image/1.png", ContentType: _const.PNG},
+		2: {ImageID: 2, Path: "image/2.heif", ContentType: _const.HEIF},
+	}}
+	_ = os.MkdirAll(filepath.Join(dir, "image"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "image", "1.png"), pngBytes(t, 300, 300), 0o644)
+	processor := NewImageProcessService(images, NewLocalImageStore(dir), conf.ImageConf{QueueSize: 1})
+
+	// 启动时补处理未处理的图片, 跳过不支持的格式
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		processor.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if v, _ := images.GetVariants(ctx, 1); len(v) == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("image 1 was not processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v, _ := images.GetVariants(ctx, 2); len(v) != 0 {
+		t.Errorf("heif image has %d variants", len(v))
+	}
+
+	// 队列已满时不阻塞
+	cancel()
+	<-done
+	processor.queue <- 1
+	if processor.Enqueue(3) {
+		t.Error("Enqueue succeeded on a full queue")
+	}
+}
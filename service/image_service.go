@@ -2,9 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"github.com/star-find-cloud/star-mall/conf"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/pkg/database"
@@ -13,10 +14,12 @@ import (
 	"github.com/star-find-cloud/star-mall/pkg/oss"
 	"github.com/star-find-cloud/star-mall/repo"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -41,52 +44,58 @@ type ImageMetaDataService interface {
 
 // ImageLocalService 图片本地服务接口
 type ImageLocalService interface {
-	// Upload 上传图片到服务器
-	Upload(ctx context.Context, image *domain.Image, file *multipart.FileHeader) (int64, error)
+	// Upload 上传图片到服务器并保存元数据, 仅图片所属者和管理员可操作
+	Upload(ctx context.Context, image *domain.Image, file *multipart.FileHeader, actor domain.Actor) (int64, error)
 
 	// UploadMore 批量上传图片到服务器
-	UploadMore(ctx context.Context, images []*domain.Image, files []*multipart.FileHeader) (map[int]int64, error)
+	UploadMore(ctx context.Context, images []*domain.Image, files []*multipart.FileHeader, actor domain.Actor) (map[int]int64, error)
 
-	// Download 获取图片
-	Download(ctx context.Context, id int64) (string, error)
+	// Download 获取图片元数据和本地文件路径, size 不为空时返回对应尺寸的版本, 返回的元数据为该版本的路径、格式和哈希
+	Download(ctx context.Context, id int64, size string, webp bool) (*domain.Image, string, error)
 
-	// Remove 删除图片
-	Remove(ctx context.Context, path string) error
+	// Remove 删除图片元数据和文件, 仅图片所属者和管理员可操作
+	Remove(ctx context.Context, id int64, actor domain.Actor) error
 }
 
 // PresignedService 预签名服务接口
 type PresignedService interface {
-	// GenerateUploadURL 生成上传预签名 返回 path 和 预签名
+	// GenerateUploadURL 生成上传预签名 返回图片ID 和 预签名. 客户端总是上传到暂存路径, 保存时由服务端校验哈希并去重
 	GenerateUploadURL(ctx context.Context, image *domain.Image) (int64, string, error)
 
 	// GenerateUploadURLs 批量生成上传预签名
 	GenerateUploadURLs(ctx context.Context, images []*domain.Image) (map[int64]string, error)
 
-	// GenerateDownloadURL 生成下载预签名
-	GenerateDownloadURL(ctx context.Context, id int64) (string, error)
+	// GenerateDownloadURL 生成下载预签名, size 不为空时为对应尺寸的版本
+	GenerateDownloadURL(ctx context.Context, id int64, size string, webp bool) (string, error)
 
-	// GenerateDeleteURL 生成删除预签名
+	// GenerateDeleteURL 生成删除预签名. 按内容去重保存的图片可能被其他图片引用, 由回收任务删除, 返回空的预签名
 	GenerateDeleteURL(ctx context.Context, id int64) (string, error)
 }
 
+// ImageForDB 图片保存在本地磁盘, 元数据中的 path 为相对于 dir 的路径
 type ImageForDB struct {
-	repo  repo.ImageRepo
-	cache *database.Redis
+	repo        repo.ImageRepo
+	productRepo repo.ProductRepo
+	dir         string
+	cache       *database.Redis
+	// processor 上传后生成各尺寸版本, 为 nil 时只保存原图
+	processor ImageProcessService
 }
 
-func NewImageForDBService(repo repo.ImageRepo) *ImageForDB {
-	return &ImageForDB{repo: repo}
+func NewImageForDBService(repo repo.ImageRepo, productRepo repo.ProductRepo, dir string, processor ImageProcessService) *ImageForDB {
+	return &ImageForDB{repo: repo, productRepo: productRepo, dir: filepath.Clean(dir), processor: processor}
 }
 
-// Save 保存元数据
+// Save 保存元数据, 失败时删除已写入的文件
 func (s *ImageForDB) Save(ctx context.Context, image *domain.Image) (int64, error) {
 	id, err := s.repo.UploadImage(ctx, image)
 	if err != nil {
-		if err = os.Remove(image.Path); err != nil {
-			log.AppLogger.Errorln("remove image err: ", err)
-			return 0, err
-		}
 		log.AppLogger.Errorln("upload image err: ", err)
+		if path, perr := s.localPath(image.Path); perr == nil {
+			if rerr := os.Remove(path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+				log.AppLogger.Errorln("remove image err: ", rerr)
+			}
+		}
 		return 0, err
 	}
 
@@ -186,12 +195,16 @@ func (s *ImageForDB) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-// Upload 上传图片到服务器
-func (s *ImageForDB) Upload(ctx context.Context, image *domain.Image, file *multipart.FileHeader) (int64, error) {
-	var (
-		c       = conf.GetConfig()
-		saveDir = c.App.ImageDir
-	)
+// Upload 上传图片到服务器, 边写入边计算 SHA-256, 写入暂存文件后按内容保存. 内容已存在时只增加引用数, 不重复保存
+func (s *ImageForDB) Upload(ctx context.Context, image *domain.Image, file *multipart.FileHeader, actor domain.Actor) (int64, error) {
+	if err := s.authorize(ctx, actor, image.OwnerType, image.OwnerID); err != nil {
+		return 0, err
+	}
+	fileExt := strings.ToLower(filepath.Ext(file.Filename))
+	contentType, ok := _const.ContentTypeIntMap[fileExt]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", domain.ErrImageTypeUnsupported, fileExt)
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -202,16 +215,11 @@ func (s *ImageForDB) Upload(ctx context.Context, image *domain.Image, file *mult
 		return 0, err
 	}
 
-	select {
-	case <-ctx.Done():
-		return 0, errors.New("busy servers")
-	default:
+	stagingPath, err := s.localPath(fmt.Sprintf("%s/.staging/%d%s", imageBlobDir, uid, fileExt))
+	if err != nil {
+		return 0, err
 	}
 
-	fileExt := filepath.Ext(file.Filename)
-	fileName := fmt.Sprintf("image/%d/%d/%d.%s \n", image.OwnerType, image.OwnerID, uid, fileExt)
-	filePath := filepath.Join(saveDir, fileName)
-
 	// 访问图片
 	src, err := file.Open()
 	if err != nil {
@@ -220,38 +228,147 @@ func (s *ImageForDB) Upload(ctx context.Context, image *domain.Image, file *mult
 	}
 	defer src.Close()
 
-	// 创建图片地址
-	dst, err := os.Create(filePath)
+	hash, err := writeFileAtomic(ctx, stagingPath, src)
+	// 内容已存在或保存失败时删除暂存文件, 重命名成功后暂存文件已不存在
+	defer os.Remove(stagingPath)
 	if err != nil {
 		log.AppLogger.Warnln("save image error:", err)
-		return 0, fmt.Errorf("save image error: %v", err)
+		return 0, fmt.Errorf("save image error: %w", err)
+	}
+	if image.SHA256Hash != "" && !strings.EqualFold(image.SHA256Hash, hash) {
+		return 0, domain.ErrImageHashMismatch
+	}
+	info, err := os.Stat(stagingPath)
+	if err != nil {
+		return 0, err
 	}
-	defer dst.Close()
 
-	done := make(chan error, 1)
-	go func() {
-		// 将访问到的图片进行持久化
-		_, err = io.Copy(dst, src)
-		done <- err
-	}()
+	image.ImageID = uid
+	image.ContentType = contentType
+	image.CreateAt = time.Now().Unix()
+	image.Status = _const.StatusNotDeleted
+	// 内容为新建时在提交记录前将暂存文件移动到内容路径, 移动失败时不保存任何记录
+	err = s.repo.CreateWithBlob(ctx, image, newImageBlob(hash, contentType, info.Size(), image.CreateAt), func(path string) error {
+		blobPath, err := s.localPath(path)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(blobPath), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(stagingPath, blobPath)
+	})
+	if err != nil {
+		log.AppLogger.Errorln("upload image err: ", err)
+		return 0, fmt.Errorf("save image error: %w", err)
+	}
+	id := image.ImageID
+	if s.processor != nil {
+		s.processor.Enqueue(id)
+	}
+	return id, nil
+}
+
+// localPath 将元数据中的相对路径转换为本地路径, 拒绝指向图片目录之外的路径
+func (s *ImageForDB) localPath(name string) (string, error) {
+	return safeJoin(s.dir, name)
+}
 
-	select {
-	case <-ctx.Done():
-		// 超时取消文件上传, 清理文件
-		os.Remove(filePath)
-		return 0, ctx.Err()
-	case err := <-done:
+// authorize 校验 actor 能否管理所属者的图片: 用户和商家管理自己的图片, 商家管理自己商品的图片, 管理员可以管理所有图片
+func (s *ImageForDB) authorize(ctx context.Context, actor domain.Actor, ownerType, ownerID int64) error {
+	return authorizeImageOwner(ctx, s.productRepo, actor, ownerType, ownerID)
+}
+
+// authorizeImageOwner 校验 actor 能否管理所属者的图片, 商品图片需要 productRepo 查询所属商家
+func authorizeImageOwner(ctx context.Context, productRepo repo.ProductRepo, actor domain.Actor, ownerType, ownerID int64) error {
+	var allowed bool
+	switch {
+	case actor.IsAdmin():
+		allowed = true
+	case ownerType == _const.UserModel:
+		allowed = actor.OwnsUser(ownerID)
+	case ownerType == _const.MerchantsModel:
+		allowed = actor.OwnsMerchant(ownerID)
+	case ownerType == _const.ProductModel && actor.IsMerchant():
+		merchantID, err := productRepo.GetMerchantID(ctx, ownerID)
 		if err != nil {
-			log.AppLogger.Warnln("copy image error:", err)
-			return 0, fmt.Errorf("copy image error: %v", err)
+			return err
 		}
+		allowed = actor.OwnsMerchant(merchantID)
+	}
+	if !allowed {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+// imageBlobDir 去重后的图片内容保存在该目录下, 路径为 blob/<哈希前两位>/<哈希>
+const imageBlobDir = "blob"
+
+func newImageBlob(hash string, contentType, size, now int64) *domain.ImageBlob {
+	return &domain.ImageBlob{
+		SHA256Hash:  hash,
+		Path:        imageBlobDir + "/" + hash[:2] + "/" + hash,
+		ContentType: contentType,
+		Size:        size,
+		CreateAt:    now,
+	}
+}
+
+func isImageBlobPath(path string) bool {
+	return strings.HasPrefix(path, imageBlobDir+"/")
+}
+
+// writeFileAtomic 将 r 写入 path 所在目录的临时文件, 完成后重命名为 path, 返回内容的 SHA-256
+func writeFileAtomic(ctx context.Context, path string, r io.Reader) (string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		// 重命名成功后临时文件已不存在
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, h), &ctxReader{ctx: ctx, r: r}); err != nil {
+		return "", err
+	}
+	if err = tmp.Sync(); err != nil {
+		return "", err
 	}
+	if err = tmp.Chmod(0o644); err != nil {
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	return uid, nil
+// ctxReader 在 ctx 结束后停止读取, 用于中断超时的上传
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
 }
 
 // UploadMore 批量上传图片
-func (s *ImageForDB) UploadMore(ctx context.Context, images []*domain.Image, files []*multipart.FileHeader) (map[int]int64, error) {
+func (s *ImageForDB) UploadMore(ctx context.Context, images []*domain.Image, files []*multipart.FileHeader, actor domain.Actor) (map[int]int64, error) {
 	// 判断图片数量是否一致
 	if len(images) != len(files) {
 		log.AppLogger.Warnln("The number of pictures and files is not equal")
@@ -270,7 +387,7 @@ func (s *ImageForDB) UploadMore(ctx context.Context, images []*domain.Image, fil
 		go func(idx int, img *domain.Image, f *multipart.FileHeader) {
 			defer wg.Done()
 
-			id, err := s.Upload(ctx, img, f)
+			id, err := s.Upload(ctx, img, f, actor)
 			if err != nil {
 				select {
 				case errChan <- err:
@@ -331,32 +448,76 @@ func (s *ImageForDB) UploadMore(ctx context.Context, images []*domain.Image, fil
 	return imgs, nil
 }
 
-func (s *ImageForDB) Download(ctx context.Context, id int64) (string, error) {
-	path, err := s.repo.GetPathByImageID(ctx, id)
+func (s *ImageForDB) Download(ctx context.Context, id int64, size string, webp bool) (*domain.Image, string, error) {
+	image, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		log.AppLogger.Errorf("get path by image id error: %v \n", err)
-		return "", err
+		log.AppLogger.Errorf("get image by id error: %v \n", err)
+		return nil, "", err
 	}
-	return path, nil
+	if s.processor != nil {
+		if image, err = s.processor.Resolve(ctx, image, size, webp); err != nil {
+			return nil, "", err
+		}
+	}
+	path, err := s.localPath(image.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	return image, path, nil
 }
 
-func (s *ImageForDB) Remove(ctx context.Context, path string) error {
-	err := os.Remove(path)
+// Remove 先删除元数据再删除文件, 文件删除失败只记录日志, 图片已无法访问. 去重的内容只释放引用
+func (s *ImageForDB) Remove(ctx context.Context, id int64, actor domain.Actor) error {
+	image, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		log.AppLogger.Errorln("remove image err: ", err)
 		return err
 	}
+	if err = s.authorize(ctx, actor, image.OwnerType, image.OwnerID); err != nil {
+		return err
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		log.AppLogger.Errorf("delete image err: %v \n", err)
+		return err
+	}
+
+	// 去重的内容可能被其他图片引用, 由回收任务在引用数降为 0 后删除
+	if isImageBlobPath(image.Path) {
+		return nil
+	}
+	paths := []string{image.Path}
+	if image.IsCompressed {
+		variants, err := s.repo.GetVariants(ctx, id)
+		if err != nil {
+			log.AppLogger.Errorln("get image variants err: ", err)
+		}
+		for _, v := range variants {
+			paths = append(paths, v.Path)
+		}
+	}
+	for _, name := range paths {
+		path, err := s.localPath(name)
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.AppLogger.Errorln("remove image err: ", err)
+		}
+	}
 	return nil
 }
 
+// ImageForOSS 客户端通过预签名 URL 上传到暂存路径, 保存时服务端校验 SHA-256 后按内容去重保存
 type ImageForOSS struct {
 	repo  repo.ImageRepo
 	oss   oss.OSS
+	store ImageStore
 	cache *database.Redis
+	// processor 客户端确认上传后生成各尺寸版本, 为 nil 时只保存原图
+	processor ImageProcessService
 }
 
-func NewImageForOssService(repo repo.ImageRepo, oss oss.OSS, cache *database.Redis) *ImageForOSS {
-	return &ImageForOSS{repo: repo, oss: oss, cache: cache}
+func NewImageForOssService(repo repo.ImageRepo, oss oss.OSS, cache *database.Redis, processor ImageProcessService) *ImageForOSS {
+	return &ImageForOSS{repo: repo, oss: oss, store: NewOSSImageStore(oss, nil), cache: cache, processor: processor}
 }
 
 func (s *ImageForOSS) GenerateUploadURL(ctx context.Context, image *domain.Image) (int64, string, error) {
@@ -374,9 +535,9 @@ func (s *ImageForOSS) GenerateUploadURL(ctx context.Context, image *domain.Image
 		return 0, "", err
 	}
 
-	path := fmt.Sprintf("image/%d/%d/%d.%s", image.OwnerType, image.OwnerID, uid, v)
-
-	url, err := s.oss.GeneratePresignedUploadURL(ctx, path, v)
+	// 客户端总是上传到暂存路径, 保存时由服务端计算哈希后去重, 不能凭哈希引用或探测已有内容
+	path := fmt.Sprintf("%s/.staging/%d%s", imageBlobDir, uid, v)
+	url, err := s.oss.GeneratePresignedUploadURL(ctx, path, _const.ContentTypeMIMEMap[image.ContentType])
 	if err != nil {
 		log.AppLogger.Warnf("生成上传预签名失败: %v", err)
 		return 0, "", err
@@ -387,7 +548,7 @@ func (s *ImageForOSS) GenerateUploadURL(ctx context.Context, image *domain.Image
 		"ownerID":     image.OwnerID,
 		"ownerType":   image.OwnerType,
 		"path":        path,
-		"sha256":      image.SHA256Hash,
+		"sha256":      strings.ToLower(image.SHA256Hash),
 		"contentType": image.ContentType,
 	}
 	err = idgen.MakeUidCache(ctx, uid, s.cache, cacheMap)
@@ -450,16 +611,21 @@ func (s *ImageForOSS) GenerateUploadURLs(ctx context.Context, images []*domain.I
 	return urls, nil
 }
 
-func (s *ImageForOSS) GenerateDownloadURL(ctx context.Context, id int64) (string, error) {
-	path, contentType, err := s.repo.GetPathAndContentTypeByImageID(ctx, id)
+func (s *ImageForOSS) GenerateDownloadURL(ctx context.Context, id int64, size string, webp bool) (string, error) {
+	image, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		log.AppLogger.Errorf("get path by image id error: %v \n", err)
+		log.AppLogger.Errorf("get image by id error: %v \n", err)
 		return "", err
 	}
+	if s.processor != nil {
+		if image, err = s.processor.Resolve(ctx, image, size, webp); err != nil {
+			return "", err
+		}
+	}
 
-	var contentTypeStr = _const.ContentTypeStringMap[contentType]
+	var contentTypeStr = _const.ContentTypeMIMEMap[image.ContentType]
 
-	url, err := s.oss.GeneratePresignedDownloadURL(ctx, path, contentTypeStr)
+	url, err := s.oss.GeneratePresignedDownloadURL(ctx, image.Path, contentTypeStr)
 	if err != nil {
 		log.AppLogger.Errorf("generate download url error: %v \n", err)
 		return "", err
@@ -473,8 +639,11 @@ func (s *ImageForOSS) GenerateDeleteURL(ctx context.Context, id int64) (string,
 		log.AppLogger.Errorf("get path by image id error: %v \n", err)
 		return "", err
 	}
+	if isImageBlobPath(path) {
+		return "", nil
+	}
 
-	var contentTypeStr = _const.ContentTypeStringMap[contentType]
+	var contentTypeStr = _const.ContentTypeMIMEMap[contentType]
 
 	url, err := s.oss.GeneratePresignedDeleteURL(ctx, path, contentTypeStr)
 	if err != nil {
@@ -494,22 +663,77 @@ func (s *ImageForOSS) Save(ctx context.Context, image *domain.Image) (int64, err
 	image.ImageID, err = strconv.ParseInt(imageMap["imageID"], 10, 64)
 	image.OwnerID, err = strconv.ParseInt(imageMap["ownerID"], 10, 64)
 	image.OwnerType, err = strconv.ParseInt(imageMap["ownerType"], 10, 64)
-	image.Path = imageMap["path"]
-	image.SHA256Hash = imageMap["sha256"]
 	image.ContentType, err = strconv.ParseInt(imageMap["contentType"], 10, 64)
 	if err != nil {
 		log.AppLogger.Errorf("parse uid cache error: %v \n", err)
 		return 0, err
 	}
+	image.CreateAt = time.Now().Unix()
+	image.Status = _const.StatusNotDeleted
 
-	id, err := s.repo.UploadImage(ctx, image)
-	if err != nil {
+	if err = s.saveUpload(ctx, image, imageMap["path"], imageMap["sha256"]); err != nil {
 		log.AppLogger.Errorf("save image error: %v \n", err)
 		return 0, err
 	}
+	id := image.ImageID
+	if err = idgen.DeleteUidCache(ctx, id, s.cache); err != nil {
+		log.AppLogger.Warnf("delete uid cache error: %v", err)
+	}
+	if s.processor != nil {
+		s.processor.Enqueue(id)
+	}
 	return id, nil
 }
 
+// saveUpload 读取客户端上传到暂存路径的文件, 校验 SHA-256 后按内容保存, 暂存文件无论结果都会删除
+func (s *ImageForOSS) saveUpload(ctx context.Context, image *domain.Image, staging, claimed string) error {
+	defer func() {
+		if err := s.store.Remove(ctx, staging); err != nil {
+			log.AppLogger.Warnf("remove staging image %s error: %v", staging, err)
+		}
+	}()
+
+	r, err := s.store.Open(ctx, staging)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "image-upload-*")
+	if err != nil {
+		_ = r.Close()
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	if claimed != "" && !strings.EqualFold(claimed, hash) {
+		return domain.ErrImageHashMismatch
+	}
+
+	return saveImageBlob(ctx, s.repo, s.store, image, hash, size, tmp)
+}
+
+// saveImageBlob 按内容保存图片元数据, 内容为新建时先将 content 写入 store 再提交记录, 写入失败时不保存元数据
+func saveImageBlob(ctx context.Context, images repo.ImageRepo, store ImageStore, image *domain.Image, hash string, size int64, content io.ReadSeeker) error {
+	return images.CreateWithBlob(ctx, image, newImageBlob(hash, image.ContentType, size, image.CreateAt), func(path string) error {
+		_, err := content.Seek(0, io.SeekStart)
+		if err == nil {
+			err = store.Put(ctx, path, _const.ContentTypeMIMEMap[image.ContentType], content)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+		}
+		return nil
+	})
+}
+
 func (s *ImageForOSS) SaveMore(ctx context.Context, image []*domain.Image) (map[int]int64, error) {
 	var (
 		total      = len(image)
@@ -1,14 +1,28 @@
 package service
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/pkg/database"
 	"github.com/star-find-cloud/star-mall/pkg/oss"
 	"github.com/star-find-cloud/star-mall/repo"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestImageForOSS_GenerateUploadURLs(t *testing.T) {
@@ -29,11 +43,257 @@ func TestImageForOSS_GenerateUploadURLs(t *testing.T) {
 	}
 
 	images := []*domain.Image{imagea, imageb}
-	cos := oss.NewTencentCos()
+	cos := oss.New(conf.GetConfig().OSS)
 	db, err := database.NewMySQL()
 	cache, err := database.NewRedis()
 	imageRepo := repo.NewImageRepo(db)
-	imageService := NewImageForOssService(imageRepo, cos, cache)
+	imageService := NewImageForOssService(imageRepo, cos, cache, nil)
 	url, err := imageService.GenerateUploadURLs(context.Background(), images)
 	fmt.Println(url, err)
 }
+
+// fakeImageRepo 内存中的图片元数据, 可被图片处理的 worker 并发访问
+type fakeImageRepo struct {
+	repo.ImageRepo
+	mu       sync.Mutex
+	images   map[int64]*domain.Image
+	variants map[int64][]*domain.ImageVariant
+	blobs    map[string]*domain.ImageBlob
+}
+
+func (r *fakeImageRepo) UploadImage(ctx context.Context, image *domain.Image) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *image
+	r.images[image.ImageID] = &copied
+	return image.ImageID, nil
+}
+
+func (r *fakeImageRepo) GetByID(ctx context.Context, id int64) (*domain.Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	image, ok := r.images[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: image id %d", sql.ErrNoRows, id)
+	}
+	copied := *image
+	return &copied, nil
+}
+
+func (r *fakeImageRepo) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	image, ok := r.images[id]
+	if !ok {
+		return fmt.Errorf("%w: image id %d", sql.ErrNoRows, id)
+	}
+	delete(r.images, id)
+	if blob, ok := r.blobs[image.SHA256Hash]; ok && blob.Path == image.Path && blob.RefCount > 0 {
+		blob.RefCount--
+		if blob.RefCount == 0 {
+			blob.ReleasedAt = time.Now().Unix()
+		}
+	}
+	return nil
+}
+
+func (r *fakeImageRepo) CreateWithBlob(ctx context.Context, image *domain.Image, blob *domain.ImageBlob, write func(path string) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blobs == nil {
+		r.blobs = map[string]*domain.ImageBlob{}
+	}
+	existing, ok := r.blobs[blob.SHA256Hash]
+	if !ok {
+		if err := write(blob.Path); err != nil {
+			return err
+		}
+		copied := *blob
+		existing = &copied
+		r.blobs[blob.SHA256Hash] = existing
+	}
+	r.createOnBlob(image, existing)
+	return nil
+}
+
+func (r *fakeImageRepo) createOnBlob(image *domain.Image, blob *domain.ImageBlob) {
+	blob.RefCount++
+	blob.ReleasedAt = 0
+	image.Path = blob.Path
+	image.SHA256Hash = blob.SHA256Hash
+	copied := *image
+	r.images[image.ImageID] = &copied
+}
+
+func (r *fakeImageRepo) ListReleasedBlobs(ctx context.Context, releasedBefore int64, limit int) ([]*domain.ImageBlob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var blobs []*domain.ImageBlob
+	for _, blob := range r.blobs {
+		if blob.RefCount == 0 && blob.ReleasedAt > 0 && blob.ReleasedAt <= releasedBefore {
+			copied := *blob
+			blobs = append(blobs, &copied)
+		}
+	}
+	return blobs[:min(limit, len(blobs))], nil
+}
+
+// DeleteBlob 各尺寸版本的路径由内容路径加尺寸名构成
+func (r *fakeImageRepo) DeleteBlob(ctx context.Context, hash string, releasedBefore int64, remove func(paths []string) error) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob, ok := r.blobs[hash]
+	if !ok || blob.RefCount > 0 || blob.ReleasedAt == 0 || blob.ReleasedAt > releasedBefore {
+		return false, nil
+	}
+	paths := []string{blob.Path}
+	for _, variants := range r.variants {
+		for _, v := range variants {
+			if strings.HasPrefix(v.Path, blob.Path+"_") && !slices.Contains(paths, v.Path) {
+				paths = append(paths, v.Path)
+			}
+		}
+	}
+	if err := remove(paths); err != nil {
+		return false, err
+	}
+	delete(r.blobs, hash)
+	return true, nil
+}
+
+func (r *fakeImageRepo) SaveVariants(ctx context.Context, imageID int64, variants []*domain.ImageVariant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.variants == nil {
+		r.variants = map[int64][]*domain.ImageVariant{}
+	}
+	r.variants[imageID] = variants
+	if image, ok := r.images[imageID]; ok {
+		image.IsCompressed = true
+	}
+	return nil
+}
+
+func (r *fakeImageRepo) GetVariants(ctx context.Context, imageID int64) ([]*domain.ImageVariant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.variants[imageID], nil
+}
+
+func (r *fakeImageRepo) ListUnprocessed(ctx context.Context, afterID int64, limit int, contentTypes []int64) ([]*domain.Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var images []*domain.Image
+	for _, image := range r.images {
+		if image.ImageID > afterID && !image.IsCompressed && slices.Contains(contentTypes, image.ContentType) {
+			copied := *image
+			images = append(images, &copied)
+		}
+	}
+	slices.SortFunc(images, func(a, b *domain.Image) int { return cmp.Compare(a.ImageID, b.ImageID) })
+	return images[:min(limit, len(images))], nil
+}
+
+// formFile 构造上传的 multipart 文件
+func formFile(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("image", name)
+	_, _ = part.Write(content)
+	_ = w.Close()
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["image"][0]
+}
+
+func TestImageForDB_LocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	images := &fakeImageRepo{images: map[int64]*domain.Image{}}
+	s := NewImageForDBService(images, nil, dir, nil)
+	ctx := context.Background()
+	owner := domain.Actor{ID: 7, Role: _const.UserRole}
+	content := []byte("\x89PNG fake image content")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	id, err := s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 7, SHA256Hash: hash}, formFile(t, "avatar.PNG", content), owner)
+	if err != nil {
+		t.Fatalf("Upload err = %v", err)
+	}
+	saved := images.images[id]
+	if saved == nil || saved.SHA256Hash != hash || saved.ContentType != _const.PNG || saved.Path != "blob/"+hash[:2]+"/"+hash {
+		t.Fatalf("metadata = %+v", saved)
+	}
+
+	image, path, err := s.Download(ctx, id, "", false)
+	if err != nil || image.ImageID != id || path != filepath.Join(dir, filepath.FromSlash(saved.Path)) {
+		t.Fatalf("Download = %+v, %s, %v", image, path, err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+		t.Errorf("file content = %q", data)
+	}
+	// 写入完成后不留下临时文件
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("upload dir has %d entries, want 1", len(entries))
+	}
+
+	// 不能为他人上传, 不支持的格式和哈希不一致的内容被拒绝
+	if _, err = s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 8}, formFile(t, "a.png", content), owner); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("upload for another user err = %v, want %v", err, domain.ErrForbidden)
+	}
+	if _, err = s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 7}, formFile(t, "a.exe", content), owner); !errors.Is(err, domain.ErrImageTypeUnsupported) {
+		t.Errorf("upload exe err = %v, want %v", err, domain.ErrImageTypeUnsupported)
+	}
+	if _, err = s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 7, SHA256Hash: "00"}, formFile(t, "b.png", content), owner); !errors.Is(err, domain.ErrImageHashMismatch) {
+		t.Errorf("upload with wrong hash err = %v, want %v", err, domain.ErrImageHashMismatch)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 || len(images.images) != 1 {
+		t.Errorf("rejected uploads left %d files and %d records", len(entries), len(images.images))
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "blob", ".staging")); len(entries) != 0 {
+		t.Errorf("uploads left %d staging files", len(entries))
+	}
+
+	// 相同内容只保存一份, 多张图片引用同一个文件
+	other, err := s.Upload(ctx, &domain.Image{OwnerType: _const.UserModel, OwnerID: 7}, formFile(t, "copy.png", content), owner)
+	if err != nil {
+		t.Fatalf("Upload same content err = %v", err)
+	}
+	if images.images[other].Path != saved.Path || images.blobs[hash].RefCount != 2 {
+		t.Errorf("duplicate upload = %+v, blob = %+v", images.images[other], images.blobs[hash])
+	}
+
+	// 删除时只删除元数据, 文件在不再被引用后由回收任务删除
+	if err = s.Remove(ctx, id, domain.Actor{ID: 8, Role: _const.UserRole}); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("Remove by another user err = %v, want %v", err, domain.ErrForbidden)
+	}
+	if err = s.Remove(ctx, id, owner); err != nil {
+		t.Fatalf("Remove err = %v", err)
+	}
+	if _, _, err = s.Download(ctx, id, "", false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Download after Remove err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, path, err := s.Download(ctx, other, "", false); err != nil {
+		t.Errorf("Download shared content err = %v", err)
+	} else if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+		t.Errorf("shared file content = %q", data)
+	}
+	if err = s.Remove(ctx, other, owner); err != nil {
+		t.Fatalf("Remove err = %v", err)
+	}
+	if blob := images.blobs[hash]; blob.RefCount != 0 || blob.ReleasedAt == 0 {
+		t.Errorf("blob after removing all images = %+v", blob)
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Errorf("file removed before collection: %v", err)
+	}
+
+	for _, name := range []string{"../outside.png", "image/../../outside.png", "/etc/passwd", ""} {
+		if _, err = s.localPath(name); err == nil {
+			t.Errorf("localPath(%q) accepted a path outside the image dir", name)
+		}
+	}
+}
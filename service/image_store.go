@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/pkg/oss"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImageStore 读写图片文件, path 为元数据中保存的相对路径
+type ImageStore interface {
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// Put 写入文件, 已存在时覆盖
+	Put(ctx context.Context, path, contentType string, r io.Reader) error
+
+	// Remove 删除文件, 文件不存在时不返回错误
+	Remove(ctx context.Context, path string) error
+}
+
+// LocalImageStore 图片保存在本地目录
+type LocalImageStore struct {
+	dir string
+}
+
+func NewLocalImageStore(dir string) *LocalImageStore {
+	return &LocalImageStore{dir: filepath.Clean(dir)}
+}
+
+func (s *LocalImageStore) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	local, err := safeJoin(s.dir, path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(local)
+}
+
+func (s *LocalImageStore) Put(ctx context.Context, path, contentType string, r io.Reader) error {
+	local, err := safeJoin(s.dir, path)
+	if err != nil {
+		return err
+	}
+	_, err = writeFileAtomic(ctx, local, r)
+	return err
+}
+
+func (s *LocalImageStore) Remove(ctx context.Context, path string) error {
+	local, err := safeJoin(s.dir, path)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(local); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// safeJoin 将相对路径转换为 dir 下的本地路径, 拒绝指向 dir 之外的路径
+func safeJoin(dir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid image path %q", name)
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid image path %q", name)
+	}
+	return path, nil
+}
+
+// OSSImageStore 通过预签名 URL 读写对象存储中的图片, 不依赖各服务商的 SDK
+type OSSImageStore struct {
+	oss    oss.OSS
+	client *http.Client
+}
+
+func NewOSSImageStore(oss oss.OSS, client *http.Client) *OSSImageStore {
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+	return &OSSImageStore{oss: oss, client: client}
+}
+
+func (s *OSSImageStore) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	url, err := s.oss.GeneratePresignedDownloadURL(ctx, path, "")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *OSSImageStore) Put(ctx context.Context, path, contentType string, r io.Reader) error {
+	url, err := s.oss.GeneratePresignedUploadURL(ctx, path, contentType)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, url, contentType, r)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *OSSImageStore) Remove(ctx context.Context, path string) error {
+	url, err := s.oss.GeneratePresignedDeleteURL(ctx, path, "")
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, url, "", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do 发送请求, 非 2xx 响应返回错误, DELETE 的 404 视为成功
+func (s *OSSImageStore) do(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	// 对象存储的预签名上传不接受分块传输, 文件需要设置 Content-Length
+	if f, ok := body.(io.Seeker); ok && req.ContentLength == 0 {
+		if req.ContentLength, err = f.Seek(0, io.SeekEnd); err != nil {
+			return nil, err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 || method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+		return resp, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	_ = resp.Body.Close()
+	return nil, fmt.Errorf("oss %s %s: %s: %s", method, req.URL.Path, resp.Status, msg)
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/idgen"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageStreamService 分片上传和分片下载图片, 供 gRPC 图片服务使用
+type ImageStreamService interface {
+	// Get 获取图片元数据
+	Get(ctx context.Context, id int64) (*domain.Image, error)
+
+	// BeginUpload upload.ID 为 0 时新建分片上传并分配图片ID, 仅图片所属者和管理员可操作;
+	// 否则恢复该ID未完成的上传, 仅发起上传的用户可以继续. 返回的进度中 NextSeq 为下一个分片的序号.
+	// 同时获取上传锁, 同一图片ID已在其他连接上传时返回 domain.ErrImageUploadBusy, 连接结束时需调用 EndUpload
+	BeginUpload(ctx context.Context, upload *domain.ImageUpload, actor domain.Actor) (*domain.ImageUpload, error)
+
+	// WriteChunk 校验分片的序号和 SHA-256 后追加到暂存文件, 并更新 upload 的进度.
+	// 上传锁已失效(如连接长时间没有发送分片后被其他连接获取)时返回 domain.ErrImageUploadBusy
+	WriteChunk(ctx context.Context, upload *domain.ImageUpload, seq uint32, content []byte, chunkHash string) error
+
+	// CompleteUpload 校验整个文件的 SHA-256 后按内容保存, 返回保存的图片元数据
+	CompleteUpload(ctx context.Context, upload *domain.ImageUpload) (*domain.Image, error)
+
+	// EndUpload 释放 BeginUpload 获取的上传锁, 未完成的进度保留用于续传
+	EndUpload(ctx context.Context, upload *domain.ImageUpload)
+
+	// Open 从 offset 字节处开始读取图片原图, 调用方负责关闭
+	Open(ctx context.Context, id, offset int64) (*domain.Image, io.ReadCloser, error)
+
+	// Run 定期删除上传进度已过期的暂存文件, 直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+const (
+	defaultImageMaxSize   = 20 << 20
+	defaultImageUploadTTL = 24 * time.Hour
+	// imageUploadLockTTL 上传锁的有效期, 每写入一个分片延长一次; 连接异常断开后最多等待这么久即可续传
+	imageUploadLockTTL = time.Minute
+)
+
+type ImageStreamServiceImpl struct {
+	repo        repo.ImageRepo
+	uploads     repo.ImageUploadRepo
+	productRepo repo.ProductRepo
+	store       ImageStore
+	// processor 上传完成后生成各尺寸版本, 为 nil 时只保存原图
+	processor ImageProcessService
+	dir       string
+	maxSize   int64
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+func NewImageStreamService(repo repo.ImageRepo, uploads repo.ImageUploadRepo, productRepo repo.ProductRepo, store ImageStore, processor ImageProcessService, c conf.GRPCConf) *ImageStreamServiceImpl {
+	if c.UploadDir == "" {
+		c.UploadDir = filepath.Join(os.TempDir(), "star-mall-uploads")
+	}
+	if c.MaxImageSize <= 0 {
+		c.MaxImageSize = defaultImageMaxSize
+	}
+	if c.UploadTTL <= 0 {
+		c.UploadTTL = defaultImageUploadTTL
+	}
+	return &ImageStreamServiceImpl{
+		repo:        repo,
+		uploads:     uploads,
+		productRepo: productRepo,
+		store:       store,
+		processor:   processor,
+		dir:         filepath.Clean(c.UploadDir),
+		maxSize:     c.MaxImageSize,
+		ttl:         c.UploadTTL,
+		now:         time.Now,
+	}
+}
+
+func (s *ImageStreamServiceImpl) Get(ctx context.Context, id int64) (*domain.Image, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *ImageStreamServiceImpl) BeginUpload(ctx context.Context, upload *domain.ImageUpload, actor domain.Actor) (*domain.ImageUpload, error) {
+	if upload.ID != 0 {
+		saved, err := s.uploads.Get(ctx, upload.ID)
+		if err != nil {
+			return nil, err
+		}
+		if saved.UserID != actor.ID || saved.Role != actor.Role {
+			return nil, domain.ErrForbidden
+		}
+		// 持有锁后重新读取进度, 避免使用上一个连接释放锁之前的旧进度
+		if err = s.lock(ctx, saved); err != nil {
+			return nil, err
+		}
+		current, err := s.uploads.Get(ctx, upload.ID)
+		if err != nil {
+			s.EndUpload(ctx, saved)
+			return nil, err
+		}
+		current.LockToken = saved.LockToken
+		return current, nil
+	}
+
+	if _, ok := _const.ContentTypeMIMEMap[upload.ContentType]; !ok {
+		return nil, fmt.Errorf("%w: %d", domain.ErrImageTypeUnsupported, upload.ContentType)
+	}
+	if err := authorizeImageOwner(ctx, s.productRepo, actor, upload.OwnerType, upload.OwnerID); err != nil {
+		return nil, err
+	}
+	uid, err := idgen.GenerateUid()
+	if err != nil {
+		log.AppLogger.Errorln("get uid error: ", err)
+		return nil, err
+	}
+	started := &domain.ImageUpload{
+		ID:          uid,
+		UserID:      actor.ID,
+		Role:        actor.Role,
+		OwnerType:   upload.OwnerType,
+		OwnerID:     upload.OwnerID,
+		ContentType: upload.ContentType,
+		SHA256Hash:  strings.ToLower(upload.SHA256Hash),
+		CreateAt:    s.now().Unix(),
+	}
+	if err = s.lock(ctx, started); err != nil {
+		return nil, err
+	}
+	if err = s.uploads.Save(ctx, started, s.ttl); err != nil {
+		s.EndUpload(ctx, started)
+		return nil, err
+	}
+	return started, nil
+}
+
+// lock 获取上传锁并记录在 upload 中, 之后的分片写入和完成都需要仍持有该锁
+func (s *ImageStreamServiceImpl) lock(ctx context.Context, upload *domain.ImageUpload) error {
+	token := uuid.NewString()
+	ok, err := s.uploads.Lock(ctx, upload.ID, token, imageUploadLockTTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrImageUploadBusy
+	}
+	upload.LockToken = token
+	return nil
+}
+
+// checkLock 确认仍持有上传锁并延长有效期
+func (s *ImageStreamServiceImpl) checkLock(ctx context.Context, upload *domain.ImageUpload) error {
+	ok, err := s.uploads.RefreshLock(ctx, upload.ID, upload.LockToken, imageUploadLockTTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrImageUploadBusy
+	}
+	return nil
+}
+
+func (s *ImageStreamServiceImpl) EndUpload(ctx context.Context, upload *domain.ImageUpload) {
+	if upload.LockToken == "" {
+		return
+	}
+	if err := s.uploads.Unlock(context.WithoutCancel(ctx), upload.ID, upload.LockToken); err != nil {
+		log.AppLogger.Warnf("unlock image upload %d error: %v", upload.ID, err)
+	}
+}
+
+// partPath 暂存文件只保存在接收分片的实例上, 断点续传需要连接到同一个实例
+func (s *ImageStreamServiceImpl) partPath(id int64) string {
+	return filepath.Join(s.dir, strconv.FormatInt(id, 10)+".part")
+}
+
+// WriteChunk 写入前将暂存文件截断到已记录的长度, 丢弃上次中断时写入但未记录的内容
+func (s *ImageStreamServiceImpl) WriteChunk(ctx context.Context, upload *domain.ImageUpload, seq uint32, content []byte, chunkHash string) error {
+	if seq != upload.NextSeq {
+		return fmt.Errorf("%w: seq %d, want %d", domain.ErrImageChunkInvalid, seq, upload.NextSeq)
+	}
+	sum := sha256.Sum256(content)
+	if chunkHash == "" || !strings.EqualFold(chunkHash, hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("%w: chunk %d sha256 mismatch", domain.ErrImageChunkInvalid, seq)
+	}
+	if upload.Size+int64(len(content)) > s.maxSize {
+		return fmt.Errorf("%w: limit %d bytes", domain.ErrImageTooLarge, s.maxSize)
+	}
+	// 只有持有上传锁的连接可以写入暂存文件, 进度才与文件内容一致
+	if err := s.checkLock(ctx, upload); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+	f, err := os.OpenFile(s.partPath(upload.ID), os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+	defer f.Close()
+	if err = f.Truncate(upload.Size); err == nil {
+		if _, err = f.WriteAt(content, upload.Size); err == nil {
+			err = f.Sync()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+
+	upload.NextSeq++
+	upload.Size += int64(len(content))
+	return s.uploads.Save(ctx, upload, s.ttl)
+}
+
+func (s *ImageStreamServiceImpl) CompleteUpload(ctx context.Context, upload *domain.ImageUpload) (*domain.Image, error) {
+	if upload.NextSeq == 0 {
+		return nil, fmt.Errorf("%w: no chunks received", domain.ErrImageChunkInvalid)
+	}
+	if err := s.checkLock(ctx, upload); err != nil {
+		return nil, err
+	}
+	part := s.partPath(upload.ID)
+	f, err := os.Open(part)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, io.LimitReader(&ctxReader{ctx: ctx, r: f}, upload.Size)); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	if upload.SHA256Hash != "" && upload.SHA256Hash != hash {
+		// 内容已无法通过续传修正, 放弃本次上传
+		s.discard(ctx, upload.ID)
+		return nil, domain.ErrImageHashMismatch
+	}
+
+	image := &domain.Image{
+		ImageID:     upload.ID,
+		OwnerID:     upload.OwnerID,
+		OwnerType:   upload.OwnerType,
+		ContentType: upload.ContentType,
+		CreateAt:    s.now().Unix(),
+		Status:      _const.StatusNotDeleted,
+	}
+	if err = saveImageBlob(ctx, s.repo, s.store, image, hash, upload.Size, io.NewSectionReader(f, 0, upload.Size)); err != nil {
+		log.AppLogger.Errorf("save uploaded image %d error: %v", upload.ID, err)
+		// 暂存内容可能已被移动或损坏, 需要重新上传
+		s.discard(ctx, upload.ID)
+		return nil, err
+	}
+	s.discard(ctx, upload.ID)
+	if s.processor != nil {
+		s.processor.Enqueue(image.ImageID)
+	}
+	return image, nil
+}
+
+// discard 删除上传进度和暂存文件, 失败时只记录日志, 残留的暂存文件由 Run 删除
+func (s *ImageStreamServiceImpl) discard(ctx context.Context, id int64) {
+	if err := s.uploads.Delete(ctx, id); err != nil {
+		log.AppLogger.Warnf("delete image upload %d error: %v", id, err)
+	}
+	if err := os.Remove(s.partPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.AppLogger.Warnf("remove image upload %d error: %v", id, err)
+	}
+}
+
+func (s *ImageStreamServiceImpl) Open(ctx context.Context, id, offset int64) (*domain.Image, io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, nil, fmt.Errorf("%w: negative offset", domain.ErrImageChunkInvalid)
+	}
+	image, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.store.Open(ctx, image.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("%w: image %d file missing", sql.ErrNoRows, id)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+	if offset == 0 {
+		return image, r, nil
+	}
+
+	// 对象存储返回的响应不能定位, 跳过前面的内容
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err = seeker.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, r, offset)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		_ = r.Close()
+		return nil, nil, fmt.Errorf("%w: %v", domain.ErrImageStorageUnavailable, err)
+	}
+	return image, r, nil
+}
+
+func (s *ImageStreamServiceImpl) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.removeExpiredParts(); n > 0 {
+				log.AppLogger.Infof("删除过期的分片上传暂存文件 %d 个", n)
+			}
+		}
+	}
+}
+
+// removeExpiredParts 每个分片写入后都会刷新进度的过期时间, 暂存文件超过 ttl 未修改说明进度已过期
+func (s *ImageStreamServiceImpl) removeExpiredParts() int {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.AppLogger.Warnf("read image upload dir error: %v", err)
+		}
+		return 0
+	}
+	var removed int
+	expired := s.now().Add(-s.ttl)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".part" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(expired) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(s.dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.AppLogger.Warnf("remove image upload %s error: %v", e.Name(), err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func chunkHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestImageStreamService_ResumableUpload(t *testing.T) {
+	dir := t.TempDir()
+	mr := miniredis.RunT(t)
+	images := &fakeImageRepo{images: map[int64]*domain.Image{}}
+	uploads := repo.NewImageUploadRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	s := NewImageStreamService(images, uploads, nil, NewLocalImageStore(filepath.Join(dir, "images")), nil, conf.GRPCConf{
+		UploadDir:    filepath.Join(dir, "uploads"),
+		MaxImageSize: 64,
+	})
+	ctx := context.Background()
+	owner := domain.Actor{ID: 7, Role: _const.UserRole}
+	content := []byte("\x89PNG chunked image content, split into three parts")
+	chunks := [][]byte{content[:16], content[16:32], content[32:]}
+
+	// 不能为他人上传, 不支持的格式被拒绝
+	if _, err := s.BeginUpload(ctx, &domain.ImageUpload{OwnerType: _const.UserModel, OwnerID: 8, ContentType: _const.PNG}, owner); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("BeginUpload for another user err = %v, want %v", err, domain.ErrForbidden)
+	}
+	if _, err := s.BeginUpload(ctx, &domain.ImageUpload{OwnerType: _const.UserModel, OwnerID: 7, ContentType: 1}, owner); !errors.Is(err, domain.ErrImageTypeUnsupported) {
+		t.Errorf("BeginUpload unknown type err = %v, want %v", err, domain.ErrImageTypeUnsupported)
+	}
+
+	upload, err := s.BeginUpload(ctx, &domain.ImageUpload{OwnerType: _const.UserModel, OwnerID: 7, ContentType: _const.PNG, SHA256Hash: chunkHash(content)}, owner)
+	if err != nil {
+		t.Fatalf("BeginUpload err = %v", err)
+	}
+	if err = s.WriteChunk(ctx, upload, 0, chunks[0], chunkHash(chunks[0])); err != nil {
+		t.Fatalf("WriteChunk 0 err = %v", err)
+	}
+
+	// 乱序、哈希不一致的分片被拒绝, 不影响进度
+	if err = s.WriteChunk(ctx, upload, 2, chunks[2], chunkHash(chunks[2])); !errors.Is(err, domain.ErrImageChunkInvalid) {
+		t.Errorf("WriteChunk out of order err = %v, want %v", err, domain.ErrImageChunkInvalid)
+	}
+	if err = s.WriteChunk(ctx, upload, 1, chunks[1], chunkHash(chunks[0])); !errors.Is(err, domain.ErrImageChunkInvalid) {
+		t.Errorf("WriteChunk with wrong hash err = %v, want %v", err, domain.ErrImageChunkInvalid)
+	}
+	if err = s.WriteChunk(ctx, upload, 1, make([]byte, 64), chunkHash(make([]byte, 64))); !errors.Is(err, domain.ErrImageTooLarge) {
+		t.Errorf("WriteChunk over the limit err = %v, want %v", err, domain.ErrImageTooLarge)
+	}
+	if err = s.WriteChunk(ctx, upload, 1, chunks[1], chunkHash(chunks[1])); err != nil {
+		t.Fatalf("WriteChunk 1 err = %v", err)
+	}
+
+	// 中断时已写入但未记录的内容在续传时被丢弃
+	f, _ := os.OpenFile(s.partPath(upload.ID), os.O_WRONLY|os.O_APPEND, 0o644)
+	_, _ = f.Write([]byte("partial"))
+	_ = f.Close()
+
+	if _, err = s.BeginUpload(ctx, &domain.ImageUpload{ID: upload.ID}, domain.Actor{ID: 8, Role: _const.UserRole}); !errors.Is(err, domain.ErrForbidden) {
+		t.Errorf("resume by another user err = %v, want %v", err, domain.ErrForbidden)
+	}
+	// 同一图片ID同时只能在一个连接上上传
+	if _, err = s.BeginUpload(ctx, &domain.ImageUpload{ID: upload.ID}, owner); !errors.Is(err, domain.ErrImageUploadBusy) {
+		t.Errorf("resume while uploading err = %v, want %v", err, domain.ErrImageUploadBusy)
+	}
+	s.EndUpload(ctx, upload)
+	resumed, err := s.BeginUpload(ctx, &domain.ImageUpload{ID: upload.ID}, owner)
+	if err != nil || resumed.NextSeq != 2 || resumed.Size != 32 {
+		t.Fatalf("resumed upload = %+v, %v, want next seq 2", resumed, err)
+	}
+	// 已释放锁的旧连接不能继续写入
+	if err = s.WriteChunk(ctx, upload, 2, chunks[2], chunkHash(chunks[2])); !errors.Is(err, domain.ErrImageUploadBusy) {
+		t.Errorf("WriteChunk from stale stream err = %v, want %v", err, domain.ErrImageUploadBusy)
+	}
+	if err = s.WriteChunk(ctx, resumed, 2, chunks[2], chunkHash(chunks[2])); err != nil {
+		t.Fatalf("WriteChunk 2 err = %v", err)
+	}
+	image, err := s.CompleteUpload(ctx, resumed)
+	if err != nil {
+		t.Fatalf("CompleteUpload err = %v", err)
+	}
+	if image.ImageID != upload.ID || image.SHA256Hash != chunkHash(content) || images.images[image.ImageID] == nil {
+		t.Fatalf("saved image = %+v", image)
+	}
+	if _, err = uploads.Get(ctx, upload.ID); !errors.Is(err, domain.ErrImageUploadNotFound) {
+		t.Errorf("upload progress after completion err = %v, want %v", err, domain.ErrImageUploadNotFound)
+	}
+	if _, err = os.Stat(s.partPath(upload.ID)); !os.IsNotExist(err) {
+		t.Errorf("part file left after completion: %v", err)
+	}
+
+	// 从指定位置继续下载
+	_, r, err := s.Open(ctx, image.ImageID, 16)
+	if err != nil {
+		t.Fatalf("Open err = %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if !bytes.Equal(data, content[16:]) {
+		t.Errorf("Open from offset = %q", data)
+	}
+
+	// 整个文件的哈希不一致时放弃上传
+	upload, _ = s.BeginUpload(ctx, &domain.ImageUpload{OwnerType: _const.UserModel, OwnerID: 7, ContentType: _const.PNG, SHA256Hash: chunkHash(chunks[0])}, owner)
+	_ = s.WriteChunk(ctx, upload, 0, chunks[1], chunkHash(chunks[1]))
+	if _, err = s.CompleteUpload(ctx, upload); !errors.Is(err, domain.ErrImageHashMismatch) {
+		t.Errorf("CompleteUpload with wrong hash err = %v, want %v", err, domain.ErrImageHashMismatch)
+	}
+	if _, err = s.BeginUpload(ctx, &domain.ImageUpload{ID: upload.ID}, owner); !errors.Is(err, domain.ErrImageUploadNotFound) {
+		t.Errorf("resume discarded upload err = %v, want %v", err, domain.ErrImageUploadNotFound)
+	}
+
+	// 写入内容失败时不保存元数据和内容记录
+	failing := NewImageStreamService(images, uploads, nil, failingImageStore{}, nil, conf.GRPCConf{UploadDir: filepath.Join(dir, "uploads")})
+	other := []byte("\x89PNG content that cannot be stored")
+	upload, _ = failing.BeginUpload(ctx, &domain.ImageUpload{OwnerType: _const.UserModel, OwnerID: 7, ContentType: _const.PNG}, owner)
+	_ = failing.WriteChunk(ctx, upload, 0, other, chunkHash(other))
+	if _, err = failing.CompleteUpload(ctx, upload); !errors.Is(err, domain.ErrImageStorageUnavailable) {
+		t.Errorf("CompleteUpload with failing store err = %v, want %v", err, domain.ErrImageStorageUnavailable)
+	}
+	if images.images[upload.ID] != nil || images.blobs[chunkHash(other)] != nil {
+		t.Errorf("records saved after failed write: %+v", images.images[upload.ID])
+	}
+
+	// 进度过期后残留的暂存文件被删除
+	upload, _ = s.BeginUpload(ctx, &domain.ImageUpload{OwnerType: _const.UserModel, OwnerID: 7, ContentType: _const.PNG}, owner)
+	_ = s.WriteChunk(ctx, upload, 0, chunks[0], chunkHash(chunks[0]))
+	s.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	if n := s.removeExpiredParts(); n != 1 {
+		t.Errorf("removeExpiredParts = %d, want 1", n)
+	}
+}
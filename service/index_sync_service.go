@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"time"
+)
+
+type IndexSyncService interface {
+	// SyncOnce 领取一批到期的商品变更事件并同步到搜索索引, 返回领取的事件数
+	SyncOnce(ctx context.Context) (int, error)
+
+	// Reconcile 逐批比对数据库中商品的 updated_at 与索引中的文档, 修复缺失、过期和不应存在的文档, 返回修复的商品数
+	Reconcile(ctx context.Context) (int, error)
+
+	// Run 定期同步商品变更事件并比对索引, 直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+const (
+	defaultIndexSyncInterval    = time.Second
+	defaultIndexReconcileEvery  = 30 * time.Minute
+	defaultIndexSyncMaxAttempts = 10
+	indexSyncBatchSize          = 100
+	indexSyncLease              = time.Minute // 领取后超过该时间仍未完成的事件可以被重新领取
+	maxIndexSyncBackoff         = time.Hour
+)
+
+type IndexSyncServiceImpl struct {
+	productRepo       repo.ProductRepo
+	outbox            repo.OutboxRepo
+	index             search.ProductIndex
+	interval          time.Duration
+	reconcileInterval time.Duration
+	maxAttempts       int
+	now               func() time.Time
+}
+
+func NewIndexSyncService(productRepo repo.ProductRepo, outbox repo.OutboxRepo, index search.ProductIndex, c conf.SearchConf) *IndexSyncServiceImpl {
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = defaultIndexSyncInterval
+	}
+	if c.ReconcileInterval <= 0 {
+		c.ReconcileInterval = defaultIndexReconcileEvery
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultIndexSyncMaxAttempts
+	}
+	return &IndexSyncServiceImpl{
+		productRepo:       productRepo,
+		outbox:            outbox,
+		index:             index,
+		interval:          c.SyncInterval,
+		reconcileInterval: c.ReconcileInterval,
+		maxAttempts:       c.MaxAttempts,
+		now:               time.Now,
+	}
+}
+
+// SyncOnce 同一商品的多个事件合并处理, 同步时重新读取商品的最新状态, 因此重复或乱序的事件不影响结果.
+// 整批同步失败时逐个商品重试, 只有仍然失败的商品的事件退避重试或转为死信, 其余事件正常完成
+func (s *IndexSyncServiceImpl) SyncOnce(ctx context.Context) (int, error) {
+	now := s.now()
+	events, err := s.outbox.Claim(ctx, domain.AggregateProduct, now.Unix(), now.Add(indexSyncLease).Unix(), indexSyncBatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	productIDs := make([]int64, 0, len(events))
+	seen := make(map[int64]bool, len(events))
+	for _, e := range events {
+		if !seen[e.AggregateID] {
+			seen[e.AggregateID] = true
+			productIDs = append(productIDs, e.AggregateID)
+		}
+	}
+
+	failures := make(map[int64]error)
+	if err = s.apply(ctx, productIDs); err != nil && len(productIDs) == 1 {
+		failures[productIDs[0]] = err
+	} else if err != nil {
+		for _, id := range productIDs {
+			if perr := s.apply(ctx, []int64{id}); perr != nil {
+				failures[id] = perr
+			}
+		}
+	}
+
+	completed := make([]int64, 0, len(events))
+	var firstErr error
+	for _, e := range events {
+		cause, failed := failures[e.AggregateID]
+		if !failed {
+			completed = append(completed, e.ID)
+			continue
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%d of %d products failed to sync: %w", len(failures), len(productIDs), cause)
+		}
+		s.fail(ctx, e, cause, now)
+	}
+	if len(completed) > 0 {
+		if err = s.outbox.Complete(ctx, completed); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), firstErr
+}
+
+// fail 记录事件同步失败, 按尝试次数指数退避, 超过最大尝试次数的事件转为死信
+func (s *IndexSyncServiceImpl) fail(ctx context.Context, e *domain.OutboxEvent, cause error, now time.Time) {
+	e.Attempts++
+	e.LastError = cause.Error()
+	e.UpdatedAt = now.Unix()
+	if e.Attempts >= s.maxAttempts {
+		e.Status = _const.OutboxStatusDead
+		log.AppLogger.Errorf("商品变更事件 %d 同步失败 %d 次, 已转为死信 (商品ID: %d): %v", e.ID, e.Attempts, e.AggregateID, cause)
+	} else {
+		e.NextAttemptAt = now.Add(indexSyncBackoff(e.Attempts)).Unix()
+	}
+	if err := s.outbox.Fail(ctx, e); err != nil {
+		log.AppLogger.Errorf("记录商品变更事件 %d 失败状态出错: %v", e.ID, err)
+	}
+}
+
+// indexSyncBackoff 第 attempts 次失败后的重试间隔: 2, 4, 8 ... 秒, 最长 maxIndexSyncBackoff
+func indexSyncBackoff(attempts int) time.Duration {
+	if attempts >= 12 {
+		return maxIndexSyncBackoff
+	}
+	return min(time.Second<<attempts, maxIndexSyncBackoff)
+}
+
+func (s *IndexSyncServiceImpl) Reconcile(ctx context.Context) (int, error) {
+	var afterID int64
+	var fixed int
+	for {
+		products, err := s.productRepo.ListIndexState(ctx, afterID, search.ReindexBatchSize)
+		if err != nil {
+			return fixed, err
+		}
+		if len(products) == 0 {
+			return fixed, nil
+		}
+		ids := make([]int64, 0, len(products))
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+		versions, err := s.index.Versions(ctx, ids)
+		if err != nil {
+			return fixed, err
+		}
+
+		var drifted []int64
+		for _, p := range products {
+			version, indexed := versions[p.ID]
+			if search.Indexable(p) && (!indexed || version != int64(p.UpdatedAt)) || !search.Indexable(p) && indexed {
+				drifted = append(drifted, p.ID)
+			}
+		}
+		if len(drifted) > 0 {
+			if err = s.apply(ctx, drifted); err != nil {
+				return fixed, err
+			}
+			fixed += len(drifted)
+		}
+		afterID = products[len(products)-1].ID
+	}
+}
+
+// apply 按商品的最新状态更新索引: 可搜索的商品写入索引, 其余的从索引删除
+func (s *IndexSyncServiceImpl) apply(ctx context.Context, ids []int64) error {
+	products, err := s.productRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	indexable := make([]*domain.Product, 0, len(products))
+	keep := make(map[int64]bool, len(products))
+	for _, p := range products {
+		if search.Indexable(p) {
+			indexable = append(indexable, p)
+			keep[p.ID] = true
+		}
+	}
+	removed := make([]int64, 0, len(ids)-len(indexable))
+	for _, id := range ids {
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	docs, err := indexDocuments(ctx, s.productRepo, indexable)
+	if err != nil {
+		return err
+	}
+	if err = s.index.Index(ctx, docs...); err != nil {
+		return err
+	}
+	return s.index.Delete(ctx, removed...)
+}
+
+func (s *IndexSyncServiceImpl) Run(ctx context.Context) {
+	syncTicker := time.NewTicker(s.interval)
+	defer syncTicker.Stop()
+	reconcileTicker := time.NewTicker(s.reconcileInterval)
+	defer reconcileTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTicker.C:
+			// 积压时连续处理, 直到领取不满一批
+			for {
+				n, err := s.SyncOnce(ctx)
+				if err != nil {
+					log.AppLogger.Warnf("同步商品搜索索引失败: %v", err)
+				}
+				if err != nil || n < indexSyncBatchSize {
+					break
+				}
+			}
+		case <-reconcileTicker.C:
+			n, err := s.Reconcile(ctx)
+			if err != nil {
+				log.AppLogger.Errorf("比对商品搜索索引失败: %v", err)
+			}
+			if n > 0 {
+				log.AppLogger.Infof("比对商品搜索索引, 修复 %d 个商品", n)
+			}
+		}
+	}
+}
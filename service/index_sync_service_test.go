@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	"slices"
+	"testing"
+	"time"
+)
+
+func (r *fakeCatalogRepo) ListIndexState(ctx context.Context, afterID int64, limit int) ([]*domain.Product, error) {
+	return r.ListForIndex(ctx, afterID, limit)
+}
+
+// fakeOutbox 内存中的发件箱, 完成的事件被删除
+type fakeOutbox struct {
+	events []*domain.OutboxEvent
+}
+
+func (o *fakeOutbox) add(productID int64) {
+	o.events = append(o.events, &domain.OutboxEvent{ID: int64(len(o.events) + 1), Aggregate: domain.AggregateProduct, AggregateID: productID, Status: _const.OutboxStatusPending})
+}
+
+func (o *fakeOutbox) Claim(ctx context.Context, aggregate string, now, leaseUntil int64, limit int) ([]*domain.OutboxEvent, error) {
+	var claimed []*domain.OutboxEvent
+	for _, e := range o.events {
+		if e.Aggregate == aggregate && e.Status == _const.OutboxStatusPending && e.NextAttemptAt <= now && len(claimed) < limit {
+			e.NextAttemptAt = leaseUntil
+			copied := *e
+			claimed = append(claimed, &copied)
+		}
+	}
+	return claimed, nil
+}
+
+func (o *fakeOutbox) Complete(ctx context.Context, ids []int64) error {
+	o.events = slices.DeleteFunc(o.events, func(e *domain.OutboxEvent) bool { return slices.Contains(ids, e.ID) })
+	return nil
+}
+
+func (o *fakeOutbox) Fail(ctx context.Context, event *domain.OutboxEvent) error {
+	for i, e := range o.events {
+		if e.ID == event.ID {
+			copied := *event
+			o.events[i] = &copied
+		}
+	}
+	return nil
+}
+
+// flakyIndex 在 failures 次写入失败后恢复正常, 包含 poison 中商品的写入总是失败
+type flakyIndex struct {
+	*search.MemoryIndex
+	failures int
+	poison   map[int64]bool
+}
+
+func (f *flakyIndex) Index(ctx context.Context, docs ...*search.Document) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("search backend unavailable")
+	}
+	for _, d := range docs {
+		if f.poison[d.ID] {
+			return errors.New("document rejected")
+		}
+	}
+	return f.MemoryIndex.Index(ctx, docs...)
+}
+
+func indexedIDs(t *testing.T, index search.ProductIndex) []int64 {
+	t.Helper()
+	result, err := index.Search(context.Background(), &search.Query{Sort: search.SortNewest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(result.IDs)
+	return result.IDs
+}
+
+func TestIndexSyncService_SyncOnce(t *testing.T) {
+	repo := &fakeCatalogRepo{
+		products: []*domain.Product{
+			{ID: 1, Title: "蓝牙耳机", Status: _const.ProductStatusOnSale, UpdatedAt: 100},
+			{ID: 2, Title: "蓝牙音箱", Status: _const.ProductStatusOnSale, UpdatedAt: 100},
+		},
+		stocks: map[int64]int64{1: 3},
+	}
+	outbox := &fakeOutbox{}
+	index := &flakyIndex{MemoryIndex: search.NewMemoryIndex(), failures: 1, poison: map[int64]bool{2: true}}
+	_ = index.MemoryIndex.Index(context.Background(), &search.Document{ID: 3, Title: "已下架"})
+	s := NewIndexSyncService(repo, outbox, index, conf.SearchConf{MaxAttempts: 3})
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	outbox.add(1)
+	outbox.add(2)
+	outbox.add(1)
+	outbox.add(3)
+
+	// 整批写入失败后逐个重试, 只有商品 2 的事件保留并退避 2 秒
+	if n, err := s.SyncOnce(ctx); err == nil || n != 4 {
+		t.Fatalf("SyncOnce = %d, %v, want failure", n, err)
+	}
+	if len(outbox.events) != 1 || outbox.events[0].AggregateID != 2 || outbox.events[0].Attempts != 1 || outbox.events[0].NextAttemptAt != 1002 || outbox.events[0].LastError == "" {
+		t.Fatalf("events after failure = %+v", outbox.events)
+	}
+	if n, _ := s.SyncOnce(ctx); n != 0 {
+		t.Errorf("claimed %d events before backoff elapsed", n)
+	}
+
+	delete(index.poison, 2)
+	now = now.Add(2 * time.Second)
+	if n, err := s.SyncOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("SyncOnce = %d, %v", n, err)
+	}
+	if len(outbox.events) != 0 {
+		t.Errorf("%d events left after success", len(outbox.events))
+	}
+	// 商品 3 不在数据库中, 从索引删除
+	if got := indexedIDs(t, index); !slices.Equal(got, []int64{1, 2}) {
+		t.Errorf("indexed = %v, want [1 2]", got)
+	}
+	page, _ := index.Search(ctx, &search.Query{Filter: search.Filter{InStock: true}})
+	if !slices.Equal(page.IDs, []int64{1}) {
+		t.Errorf("in stock = %v, want [1]", page.IDs)
+	}
+}
+
+func TestIndexSyncService_DeadLetter(t *testing.T) {
+	repo := &fakeCatalogRepo{products: []*domain.Product{{ID: 1, Status: _const.ProductStatusOnSale}}}
+	outbox := &fakeOutbox{}
+	index := &flakyIndex{MemoryIndex: search.NewMemoryIndex(), failures: 10}
+	s := NewIndexSyncService(repo, outbox, index, conf.SearchConf{MaxAttempts: 3})
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	outbox.add(1)
+
+	for i := 0; i < 3; i++ {
+		_, _ = s.SyncOnce(context.Background())
+		now = now.Add(time.Hour)
+	}
+	if e := outbox.events[0]; e.Status != _const.OutboxStatusDead || e.Attempts != 3 {
+		t.Fatalf("event = %+v, want dead after 3 attempts", e)
+	}
+	// 死信不再被领取
+	if n, _ := s.SyncOnce(context.Background()); n != 0 {
+		t.Errorf("claimed %d dead events", n)
+	}
+}
+
+func TestIndexSyncService_Reconcile(t *testing.T) {
+	repo := &fakeCatalogRepo{
+		products: []*domain.Product{
+			{ID: 1, Title: "未变化", Status: _const.ProductStatusOnSale, UpdatedAt: 100},
+			{ID: 2, Title: "索引过期", Status: _const.ProductStatusOnSale, UpdatedAt: 200},
+			{ID: 3, Title: "索引缺失", Status: _const.ProductStatusOnSale, UpdatedAt: 100},
+			{ID: 4, Title: "已下架", Status: _const.ProductStatusOffSale, UpdatedAt: 300},
+			{ID: 5, Title: "已删除", Status: _const.ProductStatusOnSale, IsDeleted: 1, UpdatedAt: 300},
+		},
+	}
+	index := search.NewMemoryIndex()
+	ctx := context.Background()
+	_ = index.Index(ctx,
+		&search.Document{ID: 1, Title: "未变化", UpdatedAt: 100},
+		&search.Document{ID: 2, Title: "索引过期", UpdatedAt: 150},
+		&search.Document{ID: 4, Title: "已下架", UpdatedAt: 250},
+		&search.Document{ID: 5, Title: "已删除", UpdatedAt: 250},
+	)
+	s := NewIndexSyncService(repo, &fakeOutbox{}, index, conf.SearchConf{})
+
+	n, err := s.Reconcile(ctx)
+	if err != nil || n != 4 {
+		t.Fatalf("Reconcile = %d, %v, want 4", n, err)
+	}
+	if got := indexedIDs(t, index); !slices.Equal(got, []int64{1, 2, 3}) {
+		t.Errorf("indexed = %v, want [1 2 3]", got)
+	}
+	versions, _ := index.Versions(ctx, []int64{1, 2, 3, 4})
+	if len(versions) != 3 || versions[2] != 200 {
+		t.Errorf("versions = %v", versions)
+	}
+
+	// 没有差异时不做修改
+	if n, err = s.Reconcile(ctx); err != nil || n != 0 {
+		t.Errorf("second Reconcile = %d, %v, want 0", n, err)
+	}
+}
@@ -8,17 +8,17 @@ import (
 )
 
 type InventoryService interface {
-	// Create 创建库存
-	Create(ctx context.Context, inventory *domain.Inventory, inputID int64) error
+	// Create 创建库存, 仅商品所属商家和管理员可操作
+	Create(ctx context.Context, inventory *domain.Inventory, actor domain.Actor) error
 
-	// GetByID 根据ID查询库存
-	GetByID(ctx context.Context, id int64) (*domain.Inventory, error)
+	// GetByID 根据商品ID查询库存, 仅商品所属商家和管理员可查看
+	GetByID(ctx context.Context, id int64, actor domain.Actor) (*domain.Inventory, error)
 
-	// GetByMerchantID 根据商家ID查询库存
-	GetByMerchantID(ctx context.Context, MerchantID int64) ([]*domain.Inventory, error)
+	// GetByMerchantID 根据商家ID查询库存, 仅该商家和管理员可查看
+	GetByMerchantID(ctx context.Context, MerchantID int64, actor domain.Actor) ([]*domain.Inventory, error)
 
-	// Update 更新库存
-	Update(ctx context.Context, inventory *domain.Inventory, inputID int64) error
+	// Update 更新库存, 仅商品所属商家和管理员可操作
+	Update(ctx context.Context, inventory *domain.Inventory, actor domain.Actor) error
 
 	// Delete 删除库存
 	Delete(ctx context.Context, id int64) error
@@ -34,42 +34,52 @@ func NewInventoryService(inventoryRepo repo.InventoryRepo, merchantRepo repo.Mer
 	return &InventoryServiceImpl{inventoryRepo: inventoryRepo, merchantRepo: merchantRepo, productRepo: productRepo}
 }
 
-func (s *InventoryServiceImpl) Create(ctx context.Context, inventory *domain.Inventory, inputID int64) error {
-	var storeID, err = s.productRepo.GetMerchantID(ctx, inventory.ProductID)
-	if err != nil {
-		return errors.New("商品ID不存在")
-	}
-	if !inventory.ValidateMerchantID(inputID, storeID) {
-		return errors.New("商家ID不匹配")
+func (s *InventoryServiceImpl) Create(ctx context.Context, inventory *domain.Inventory, actor domain.Actor) error {
+	if err := s.authorize(ctx, inventory.ProductID, actor); err != nil {
+		return err
 	}
 	return s.inventoryRepo.Create(ctx, inventory)
 }
 
-func (s *InventoryServiceImpl) Update(ctx context.Context, inventory *domain.Inventory, inputID int64) error {
-	var storeID, err = s.productRepo.GetMerchantID(ctx, inventory.ProductID)
-	if err != nil {
-		return errors.New("商品ID不存在")
-	}
-	if !inventory.ValidateMerchantID(inputID, storeID) {
-		return errors.New("商家ID不匹配")
+func (s *InventoryServiceImpl) Update(ctx context.Context, inventory *domain.Inventory, actor domain.Actor) error {
+	if err := s.authorize(ctx, inventory.ProductID, actor); err != nil {
+		return err
 	}
 	return s.inventoryRepo.Update(ctx, inventory)
 }
 
-func (s *InventoryServiceImpl) GetByID(ctx context.Context, id int64) (*domain.Inventory, error) {
+func (s *InventoryServiceImpl) GetByID(ctx context.Context, id int64, actor domain.Actor) (*domain.Inventory, error) {
 	if id == 0 {
 		return nil, errors.New("库存ID不存在")
 	}
+	if err := s.authorize(ctx, id, actor); err != nil {
+		return nil, err
+	}
 	return s.inventoryRepo.GetByID(ctx, id)
 }
 
-func (s *InventoryServiceImpl) GetByMerchantID(ctx context.Context, MerchantID int64) ([]*domain.Inventory, error) {
+func (s *InventoryServiceImpl) GetByMerchantID(ctx context.Context, MerchantID int64, actor domain.Actor) ([]*domain.Inventory, error) {
 	if MerchantID == 0 {
 		return nil, errors.New("商家ID不存在")
 	}
+	if !actor.OwnsMerchant(MerchantID) {
+		return nil, domain.ErrForbidden
+	}
 	return s.inventoryRepo.GetByMerchantID(ctx, MerchantID)
 }
 
+// authorize 校验 actor 是否为商品所属商家或管理员
+func (s *InventoryServiceImpl) authorize(ctx context.Context, productID int64, actor domain.Actor) error {
+	storeID, err := s.productRepo.GetMerchantID(ctx, productID)
+	if err != nil {
+		return errors.New("商品ID不存在")
+	}
+	if !actor.OwnsMerchant(storeID) {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
 func (s *InventoryServiceImpl) Delete(ctx context.Context, id int64) error {
 	// TODO implement me
 	panic("implement me")
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"time"
+)
+
+const (
+	defaultGuardFailureWindow      = 15 * time.Minute
+	defaultGuardDelayAfter         = 3
+	defaultGuardBaseDelay          = time.Second
+	defaultGuardMaxDelay           = 30 * time.Second
+	defaultGuardAccountMaxFailures = 10
+	defaultGuardIPMaxFailures      = 50
+	defaultGuardLockoutDuration    = 30 * time.Minute
+)
+
+type LoginGuardService interface {
+	// Check 登录前检查账号和 IP 是否被锁定或仍需等待, 被拒绝时返回 *domain.LoginBlockedError
+	Check(ctx context.Context, account, ip string) error
+
+	// Fail 记录一次登录失败; 失败次数达到阈值时设置等待时间或锁定, 并返回对应的 *domain.LoginBlockedError
+	Fail(ctx context.Context, account, ip string) error
+
+	// Succeed 登录成功后清除账号的失败记录, IP 的记录保留到窗口过期
+	Succeed(ctx context.Context, account string)
+
+	// ListLocks 列出当前被锁定的账号和 IP
+	ListLocks(ctx context.Context) ([]*domain.LoginLock, error)
+
+	// Unlock 管理员解除锁定
+	Unlock(ctx context.Context, kind, subject string) error
+}
+
+type LoginGuardServiceImpl struct {
+	repo repo.LoginGuardRepo
+	conf conf.SecurityConf
+}
+
+func NewLoginGuardService(repo repo.LoginGuardRepo, c conf.SecurityConf) *LoginGuardServiceImpl {
+	if c.FailureWindow <= 0 {
+		c.FailureWindow = defaultGuardFailureWindow
+	}
+	if c.DelayAfter <= 0 {
+		c.DelayAfter = defaultGuardDelayAfter
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = defaultGuardBaseDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = defaultGuardMaxDelay
+	}
+	if c.AccountMaxFailures <= 0 {
+		c.AccountMaxFailures = defaultGuardAccountMaxFailures
+	}
+	if c.IPMaxFailures <= 0 {
+		c.IPMaxFailures = defaultGuardIPMaxFailures
+	}
+	if c.LockoutDuration <= 0 {
+		c.LockoutDuration = defaultGuardLockoutDuration
+	}
+	return &LoginGuardServiceImpl{repo: repo, conf: c}
+}
+
+func (s *LoginGuardServiceImpl) Check(ctx context.Context, account, ip string) error {
+	for _, target := range s.targets(account, ip) {
+		locked, delay, err := s.repo.Blocked(ctx, target.kind, target.subject)
+		if err != nil {
+			return err
+		}
+		if locked > 0 {
+			return &domain.LoginBlockedError{Err: domain.ErrLoginLocked, RetryAfter: locked}
+		}
+		if delay > 0 {
+			return &domain.LoginBlockedError{Err: domain.ErrLoginThrottled, RetryAfter: delay}
+		}
+	}
+	return nil
+}
+
+func (s *LoginGuardServiceImpl) Fail(ctx context.Context, account, ip string) error {
+	now := time.Now()
+	var blocked error
+	for _, target := range s.targets(account, ip) {
+		failures, err := s.repo.AddFailure(ctx, target.kind, target.subject, now, s.conf.FailureWindow)
+		if err != nil {
+			return err
+		}
+
+		limit := s.conf.AccountMaxFailures
+		if target.kind == domain.GuardKindIP {
+			limit = s.conf.IPMaxFailures
+		}
+		switch {
+		case failures >= int64(limit):
+			if err = s.repo.Lock(ctx, target.kind, target.subject, s.conf.LockoutDuration); err != nil {
+				return err
+			}
+			log.SecurityLogger.Warnf("login locked, %s: %s, failures: %d, account: %s, ip: %s, duration: %s",
+				target.kind, target.subject, failures, account, ip, s.conf.LockoutDuration)
+			blocked = &domain.LoginBlockedError{Err: domain.ErrLoginLocked, RetryAfter: s.conf.LockoutDuration}
+		case target.kind == domain.GuardKindAccount && failures >= int64(s.conf.DelayAfter):
+			delay := s.delay(failures)
+			if err = s.repo.SetDelay(ctx, target.kind, target.subject, delay); err != nil {
+				return err
+			}
+			log.SecurityLogger.Infof("login throttled, account: %s, ip: %s, failures: %d, delay: %s", account, ip, failures, delay)
+			if blocked == nil {
+				blocked = &domain.LoginBlockedError{Err: domain.ErrLoginThrottled, RetryAfter: delay}
+			}
+		}
+	}
+	return blocked
+}
+
+func (s *LoginGuardServiceImpl) Succeed(ctx context.Context, account string) {
+	if err := s.repo.ResetFailures(ctx, domain.GuardKindAccount, account); err != nil {
+		log.AppLogger.Warnf("reset login failures failed, account: %s, err: %v", account, err)
+	}
+}
+
+func (s *LoginGuardServiceImpl) ListLocks(ctx context.Context) ([]*domain.LoginLock, error) {
+	return s.repo.ListLocks(ctx)
+}
+
+func (s *LoginGuardServiceImpl) Unlock(ctx context.Context, kind, subject string) error {
+	if kind != domain.GuardKindAccount && kind != domain.GuardKindIP {
+		return errors.New("invalid lock kind")
+	}
+	ok, err := s.repo.Unlock(ctx, kind, subject)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrLockNotFound
+	}
+	log.SecurityLogger.Infof("login unlocked, %s: %s", kind, subject)
+	return nil
+}
+
+// delay 等待时间从 BaseDelay 开始, 每多失败一次翻倍, 不超过 MaxDelay
+func (s *LoginGuardServiceImpl) delay(failures int64) time.Duration {
+	d := s.conf.BaseDelay
+	for i := int64(s.conf.DelayAfter); i < failures && d < s.conf.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, s.conf.MaxDelay)
+}
+
+type guardTarget struct {
+	kind, subject string
+}
+
+func (s *LoginGuardServiceImpl) targets(account, ip string) []guardTarget {
+	targets := []guardTarget{{domain.GuardKindAccount, account}}
+	if ip != "" {
+		targets = append(targets, guardTarget{domain.GuardKindIP, ip})
+	}
+	return targets
+}
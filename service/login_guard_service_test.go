@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"testing"
+	"time"
+)
+
+func newTestLoginGuard(t *testing.T, c conf.SecurityConf) (*LoginGuardServiceImpl, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	guardRepo := repo.NewLoginGuardRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	return NewLoginGuardService(guardRepo, c), mr
+}
+
+func blockedBy(t *testing.T, err error, want error) time.Duration {
+	t.Helper()
+	var blocked *domain.LoginBlockedError
+	if !errors.As(err, &blocked) || !errors.Is(err, want) {
+		t.Fatalf("err = %v, want %v", err, want)
+	}
+	return blocked.RetryAfter
+}
+
+func TestLoginGuard_DelayThenLock(t *testing.T) {
+	s, mr := newTestLoginGuard(t, conf.SecurityConf{
+		DelayAfter:         2,
+		BaseDelay:          time.Second,
+		MaxDelay:           3 * time.Second,
+		AccountMaxFailures: 5,
+		LockoutDuration:    time.Minute,
+	})
+	ctx := context.Background()
+	const account, ip = "user:1", "10.0.0.1"
+
+	if err := s.Fail(ctx, account, ip); err != nil {
+		t.Fatalf("first failure err = %v", err)
+	}
+	if err := s.Check(ctx, account, ip); err != nil {
+		t.Fatalf("Check after one failure err = %v", err)
+	}
+
+	// 第 2 次起等待时间逐次翻倍, 且不超过上限
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		if got := blockedBy(t, s.Fail(ctx, account, ip), domain.ErrLoginThrottled); got != want {
+			t.Errorf("failure %d delay = %s, want %s", i+2, got, want)
+		}
+		blockedBy(t, s.Check(ctx, account, ip), domain.ErrLoginThrottled)
+		mr.FastForward(want)
+		if err := s.Check(ctx, account, ip); err != nil {
+			t.Fatalf("Check after delay err = %v", err)
+		}
+	}
+
+	if got := blockedBy(t, s.Fail(ctx, account, ip), domain.ErrLoginLocked); got != time.Minute {
+		t.Errorf("lockout = %s, want 1m", got)
+	}
+	blockedBy(t, s.Check(ctx, account, ip), domain.ErrLoginLocked)
+	// 其他 IP 也不能登录被锁定的账号
+	blockedBy(t, s.Check(ctx, account, "10.0.0.2"), domain.ErrLoginLocked)
+
+	locks, err := s.ListLocks(ctx)
+	if err != nil {
+		t.Fatalf("ListLocks err = %v", err)
+	}
+	if len(locks) != 1 || locks[0].Kind != domain.GuardKindAccount || locks[0].Subject != account || locks[0].Failures != 5 {
+		t.Fatalf("locks = %+v", locks)
+	}
+
+	if err = s.Unlock(ctx, domain.GuardKindAccount, account); err != nil {
+		t.Fatalf("Unlock err = %v", err)
+	}
+	if err = s.Check(ctx, account, ip); err != nil {
+		t.Errorf("Check after unlock err = %v", err)
+	}
+	if err = s.Unlock(ctx, domain.GuardKindAccount, account); !errors.Is(err, domain.ErrLockNotFound) {
+		t.Errorf("Unlock twice err = %v, want %v", err, domain.ErrLockNotFound)
+	}
+}
+
+func TestLoginGuard_IPLockAndReset(t *testing.T) {
+	s, _ := newTestLoginGuard(t, conf.SecurityConf{
+		DelayAfter:         10,
+		AccountMaxFailures: 10,
+		IPMaxFailures:      3,
+	})
+	ctx := context.Background()
+	const ip = "10.0.0.1"
+
+	// 同一 IP 尝试不同账号, 单个账号都未达到阈值, IP 被锁定
+	for _, account := range []string{"user:1", "user:2"} {
+		if err := s.Fail(ctx, account, ip); err != nil {
+			t.Fatalf("Fail(%s) err = %v", account, err)
+		}
+	}
+	blockedBy(t, s.Fail(ctx, "user:3", ip), domain.ErrLoginLocked)
+	blockedBy(t, s.Check(ctx, "user:4", ip), domain.ErrLoginLocked)
+	if err := s.Check(ctx, "user:4", "10.0.0.2"); err != nil {
+		t.Errorf("Check from other ip err = %v", err)
+	}
+
+	// 登录成功清除账号的失败记录
+	s.Succeed(ctx, "user:1")
+	for i := 0; i < 9; i++ {
+		if err := s.Fail(ctx, "user:1", ""); err != nil {
+			t.Fatalf("failure %d after reset err = %v", i+1, err)
+		}
+	}
+
+	if err := s.Unlock(ctx, "user", "1"); err == nil {
+		t.Error("Unlock accepted invalid kind")
+	}
+}
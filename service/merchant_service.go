@@ -2,11 +2,10 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"fmt"
 	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
-	"github.com/star-find-cloud/star-mall/pkg/jwt"
 	applog "github.com/star-find-cloud/star-mall/pkg/logger"
 	"github.com/star-find-cloud/star-mall/repo"
 	"github.com/star-find-cloud/star-mall/utils"
@@ -16,8 +15,11 @@ type MerchantService interface {
 	// Create 创建商家
 	Create(ctx context.Context, merchant *domain.Merchant) (int64, error)
 
-	// Register 注册商家
-	Register(ctx context.Context, merchant *domain.Merchant) (int64, string, error)
+	// Register 注册商家, 商家为待审核状态, 审核通过前不签发 token
+	Register(ctx context.Context, merchant *domain.Merchant) (int64, error)
+
+	// CheckApproved 检查用户对应的商家是否已通过审核, 未通过时返回 domain.ErrMerchantNotApproved
+	CheckApproved(ctx context.Context, userID int64) error
 
 	// GetByID 根据ID获取商家
 	GetByID(ctx context.Context, id int64) (*domain.Merchant, error)
@@ -25,14 +27,14 @@ type MerchantService interface {
 	// GetByName 根据名称获取商家
 	GetByName(ctx context.Context, email string) (*[]domain.Merchant, error)
 
-	// Update 更新商家信息
-	Update(ctx context.Context, merchant *domain.Merchant) error
+	// Update 更新商家信息, 仅商家本人和管理员可操作
+	Update(ctx context.Context, merchant *domain.Merchant, actor domain.Actor) error
 
 	// UpdateLicenseImage 更新商家营业执照
 	UpdateLicenseImage(ctx context.Context, merchantID int64, image *domain.Image) error
 
-	// Delete 删除商家
-	Delete(ctx context.Context, id int64) error
+	// Delete 删除商家, 仅商家本人和管理员可操作
+	Delete(ctx context.Context, id int64, actor domain.Actor) error
 }
 
 type MerchantServiceImpl struct {
@@ -61,50 +63,64 @@ func (s *MerchantServiceImpl) GetByName(ctx context.Context, email string) (*[]d
 	return s.repo.GetMerchantByName(ctx, email)
 }
 
-func (s *MerchantServiceImpl) Register(ctx context.Context, merchant *domain.Merchant) (int64, string, error) {
+func (s *MerchantServiceImpl) Register(ctx context.Context, merchant *domain.Merchant) (int64, error) {
 	if !utils.VerifyEmail(merchant.Email) {
-		return 0, "", errors.New("email is not valid")
+		return 0, errors.New("email is not valid")
 	}
 
 	// 判断邮箱是否已存在
 	exist, err := s.repo.IsExistsByEmail(ctx, merchant.Email)
 	if err != nil {
-		return 0, "", err
+		return 0, err
 	}
 	if exist {
-		return 0, "", errors.New("email already exist")
+		return 0, errors.New("email already exist")
 	}
 
 	// 判断手机号是否已存在
 	exist, err = s.repo.IsExistsByPhone(ctx, merchant.Name)
 	if err != nil {
-		return 0, "", err
+		return 0, err
 	}
 	if exist {
-		return 0, "", errors.New("phone already  exist")
+		return 0, errors.New("phone already  exist")
 	}
 
 	// 哈希密码
 	hashedPassword, err := utils.HashPassword(merchant.Password)
 	if err != nil {
-		return 0, "", errors.New("failed to hash password")
+		return 0, errors.New("failed to hash password")
 	}
 	merchant.Password = hashedPassword
 
 	id, err := s.repo.Create(ctx, merchant)
 	if err != nil {
-		return 0, "", errors.New("failed to create merchant")
+		return 0, errors.New("failed to create merchant")
 	}
-	token, err := jwt.GenerateTempToken(id, merchant.Name, _const.MerchantRole)
+	return id, nil
+}
 
-	fmt.Println(id, token)
-	return id, token, nil
+func (s *MerchantServiceImpl) CheckApproved(ctx context.Context, userID int64) error {
+	status, err := s.repo.GetStatusByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrMerchantNotApproved
+	}
+	if err != nil {
+		return err
+	}
+	if status != _const.MerchantStatusApproved {
+		return domain.ErrMerchantNotApproved
+	}
+	return nil
 }
 
-func (s *MerchantServiceImpl) Update(ctx context.Context, merchant *domain.Merchant) error {
+func (s *MerchantServiceImpl) Update(ctx context.Context, merchant *domain.Merchant, actor domain.Actor) error {
 	if merchant.ID == 0 {
 		return errors.New("invalid merchant")
 	}
+	if !actor.OwnsMerchant(merchant.ID) {
+		return domain.ErrForbidden
+	}
 	exists, err := s.repo.IsExistsByID(ctx, merchant.ID)
 	if err != nil {
 		return errors.New("merchant not found")
@@ -139,7 +155,10 @@ func (s *MerchantServiceImpl) UpdateLicenseImage(ctx context.Context, merchantID
 	return nil
 }
 
-func (s *MerchantServiceImpl) Delete(ctx context.Context, id int64) error {
+func (s *MerchantServiceImpl) Delete(ctx context.Context, id int64, actor domain.Actor) error {
+	if !actor.OwnsMerchant(id) {
+		return domain.ErrForbidden
+	}
 	exits, err := s.repo.IsExistsByID(ctx, id)
 	if err != nil {
 		return errors.New("merchant inventoryRepo err")
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/pkg/oauth"
+	"github.com/star-find-cloud/star-mall/repo"
+	"github.com/star-find-cloud/star-mall/utils"
+	"strings"
+	"time"
+)
+
+const defaultOAuthStateTTL = 10 * time.Minute
+
+type OAuthService interface {
+	// Providers 已配置的第三方登录提供方
+	Providers() []string
+
+	// AuthURL 发起授权并返回提供方的授权地址和其中的 state, linkUserID 不为 0 时回调后绑定到该用户.
+	// 调用方需将 state 与发起授权的浏览器绑定, 回调时校验, 防止登录 CSRF
+	AuthURL(ctx context.Context, provider string, linkUserID int64) (authURL, state string, err error)
+
+	// Callback 处理授权回调. 绑定请求将第三方账号绑定到发起的用户; 登录请求使用已绑定的用户登录, 未绑定时自动注册
+	Callback(ctx context.Context, provider, code, state string) (*domain.OAuthResult, error)
+
+	// ListIdentities 获取用户绑定的第三方账号
+	ListIdentities(ctx context.Context, userID int64) ([]*domain.UserIdentity, error)
+
+	// Unlink 解除绑定
+	Unlink(ctx context.Context, userID int64, provider string) error
+}
+
+type OAuthServiceImpl struct {
+	registry     *oauth.Registry
+	stateRepo    repo.OAuthStateRepo
+	identityRepo repo.IdentityRepo
+	userRepo     repo.UserRepo
+	users        UserService
+	stateTTL     time.Duration
+}
+
+func NewOAuthService(registry *oauth.Registry, stateRepo repo.OAuthStateRepo, identityRepo repo.IdentityRepo, userRepo repo.UserRepo, users UserService, c conf.OAuthConf) *OAuthServiceImpl {
+	if c.StateTTL <= 0 {
+		c.StateTTL = defaultOAuthStateTTL
+	}
+	return &OAuthServiceImpl{
+		registry:     registry,
+		stateRepo:    stateRepo,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		users:        users,
+		stateTTL:     c.StateTTL,
+	}
+}
+
+func (s *OAuthServiceImpl) Providers() []string {
+	return s.registry.Names()
+}
+
+func (s *OAuthServiceImpl) AuthURL(ctx context.Context, provider string, linkUserID int64) (string, string, error) {
+	p, err := s.registry.Get(provider)
+	if err != nil {
+		return "", "", err
+	}
+	req, err := oauth.NewAuthRequest()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err := p.AuthCodeURL(ctx, req)
+	if err != nil {
+		log.AppLogger.Errorf("build oauth url failed, provider: %s, err: %v", provider, err)
+		return "", "", err
+	}
+
+	err = s.stateRepo.Save(ctx, req.State, &domain.OAuthState{
+		Provider:     provider,
+		CodeVerifier: req.CodeVerifier,
+		Nonce:        req.Nonce,
+		LinkUserID:   linkUserID,
+	}, s.stateTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, req.State, nil
+}
+
+func (s *OAuthServiceImpl) Callback(ctx context.Context, provider, code, state string) (*domain.OAuthResult, error) {
+	saved, err := s.stateRepo.Take(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	// state 只能在发起时的提供方回调中使用
+	if saved.Provider != provider {
+		return nil, domain.ErrOAuthStateInvalid
+	}
+	p, err := s.registry.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := p.Exchange(ctx, code, oauth.AuthRequest{State: state, CodeVerifier: saved.CodeVerifier, Nonce: saved.Nonce})
+	if err != nil {
+		log.SecurityLogger.Warnf("oauth exchange failed, provider: %s, err: %v", provider, err)
+		return nil, fmt.Errorf("oauth login failed: %w", err)
+	}
+
+	if saved.LinkUserID != 0 {
+		return s.link(ctx, provider, identity, saved.LinkUserID)
+	}
+	return s.login(ctx, provider, identity)
+}
+
+func (s *OAuthServiceImpl) link(ctx context.Context, provider string, identity *oauth.Identity, userID int64) (*domain.OAuthResult, error) {
+	existing, err := s.identityRepo.GetByProviderSubject(ctx, provider, identity.Subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, domain.ErrIdentityLinked
+		}
+		return &domain.OAuthResult{Linked: true}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if _, err = s.identityRepo.Create(ctx, newUserIdentity(userID, provider, identity)); err != nil {
+		return nil, err
+	}
+	log.SecurityLogger.Infof("oauth identity linked, user id: %d, provider: %s", userID, provider)
+	return &domain.OAuthResult{Linked: true}, nil
+}
+
+func (s *OAuthServiceImpl) login(ctx context.Context, provider string, identity *oauth.Identity) (*domain.OAuthResult, error) {
+	result := &domain.OAuthResult{}
+	existing, err := s.identityRepo.GetByProviderSubject(ctx, provider, identity.Subject)
+	switch {
+	case err == nil:
+		existing.Email, existing.Name = identity.Email, identity.Name
+		if err = s.identityRepo.Touch(ctx, existing); err != nil {
+			log.AppLogger.Warnf("update oauth identity failed, id: %d, err: %v", existing.ID, err)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if existing, err = s.register(ctx, provider, identity); err != nil {
+			return nil, err
+		}
+		result.Registered = true
+	default:
+		return nil, err
+	}
+
+	result.Token, result.User, err = s.users.LoginByIdentity(ctx, existing.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// register 首次登录时创建用户. 已注册的邮箱不会自动绑定, 避免通过第三方账号接管他人账户
+func (s *OAuthServiceImpl) register(ctx context.Context, provider string, identity *oauth.Identity) (*domain.UserIdentity, error) {
+	user := &domain.User{
+		Name:   identity.Name,
+		RoleID: _const.UserRole,
+	}
+	if user.Name == "" {
+		user.Name = provider + "_" + identity.Subject
+	}
+	if identity.EmailVerified && identity.Email != "" {
+		exists, err := s.userRepo.IsExistsByEmail(ctx, identity.Email)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, domain.ErrIdentityEmailTaken
+		}
+		user.Email = strings.ToLower(identity.Email)
+	}
+
+	// 第三方注册的用户没有可用的密码, 需要时通过邮箱找回设置
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	if user.Password, err = utils.HashPassword(password); err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+	userID, err := s.userRepo.Create(ctx, user)
+	if err != nil {
+		return nil, errors.New("failed to create user")
+	}
+
+	created := newUserIdentity(userID, provider, identity)
+	if _, err = s.identityRepo.Create(ctx, created); err != nil {
+		log.AppLogger.Errorf("create oauth identity failed, user id: %d, provider: %s, err: %v", userID, provider, err)
+		return nil, err
+	}
+	log.SecurityLogger.Infof("user registered by oauth, user id: %d, provider: %s", userID, provider)
+	return created, nil
+}
+
+func (s *OAuthServiceImpl) ListIdentities(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	return s.identityRepo.ListByUser(ctx, userID)
+}
+
+func (s *OAuthServiceImpl) Unlink(ctx context.Context, userID int64, provider string) error {
+	ok, err := s.identityRepo.Delete(ctx, userID, provider)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrIdentityNotFound
+	}
+	log.SecurityLogger.Infof("oauth identity unlinked, user id: %d, provider: %s", userID, provider)
+	return nil
+}
+
+func newUserIdentity(userID int64, provider string, identity *oauth.Identity) *domain.UserIdentity {
+	return &domain.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Name:     identity.Name,
+	}
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/oauth"
+	"github.com/star-find-cloud/star-mall/repo"
+	"net/url"
+	"testing"
+)
+
+// fakeProvider 授权地址中带上 state, 授权码即第三方账号 ID
+type fakeProvider struct{}
+
+func (fakeProvider) AuthCodeURL(ctx context.Context, req oauth.AuthRequest) (string, error) {
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(req.State), nil
+}
+
+func (fakeProvider) Exchange(ctx context.Context, code string, req oauth.AuthRequest) (*oauth.Identity, error) {
+	if req.CodeVerifier == "" {
+		return nil, errors.New("missing code verifier")
+	}
+	return &oauth.Identity{Subject: code, Name: "user-" + code}, nil
+}
+
+// fakeIdentityRepo 在内存中保存第三方账号绑定
+type fakeIdentityRepo struct {
+	identities []*domain.UserIdentity
+}
+
+func (r *fakeIdentityRepo) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeIdentityRepo) ListByUser(ctx context.Context, userID int64) ([]*domain.UserIdentity, error) {
+	var list []*domain.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			list = append(list, identity)
+		}
+	}
+	return list, nil
+}
+
+func (r *fakeIdentityRepo) Create(ctx context.Context, identity *domain.UserIdentity) (int64, error) {
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return 0, domain.ErrIdentityLinked
+		}
+		if existing.Provider == identity.Provider && existing.UserID == identity.UserID {
+			return 0, domain.ErrProviderAlreadyBound
+		}
+	}
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return identity.ID, nil
+}
+
+func (r *fakeIdentityRepo) Touch(ctx context.Context, identity *domain.UserIdentity) error {
+	return nil
+}
+
+func (r *fakeIdentityRepo) Delete(ctx context.Context, userID int64, provider string) (bool, error) {
+	for i, identity := range r.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newTestOAuthService(t *testing.T) (*OAuthServiceImpl, *fakeIdentityRepo) {
+	mr := miniredis.RunT(t)
+	registry, err := oauth.NewRegistry(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Register("fake", fakeProvider{})
+	identities := &fakeIdentityRepo{}
+	stateRepo := repo.NewOAuthStateRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	return NewOAuthService(registry, stateRepo, identities, nil, nil, conf.OAuthConf{}), identities
+}
+
+// startAuth 发起授权并返回 state
+func startAuth(t *testing.T, s *OAuthServiceImpl, linkUserID int64) string {
+	t.Helper()
+	authURL, state, err := s.AuthURL(context.Background(), "fake", linkUserID)
+	if err != nil {
+		t.Fatalf("AuthURL err = %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query().Get("state"); got != state {
+		t.Fatalf("state in url = %q, want %q", got, state)
+	}
+	return state
+}
+
+func TestOAuthService_State(t *testing.T) {
+	s, _ := newTestOAuthService(t)
+	ctx := context.Background()
+
+	if _, _, err := s.AuthURL(ctx, "unknown", 0); !errors.Is(err, oauth.ErrUnknownProvider) {
+		t.Errorf("AuthURL unknown provider err = %v", err)
+	}
+	if _, err := s.Callback(ctx, "fake", "sub", "forged"); !errors.Is(err, domain.ErrOAuthStateInvalid) {
+		t.Errorf("forged state err = %v", err)
+	}
+
+	state := startAuth(t, s, 7)
+	if _, err := s.Callback(ctx, "other", "sub", state); !errors.Is(err, domain.ErrOAuthStateInvalid) {
+		t.Errorf("provider mismatch err = %v", err)
+	}
+	// 校验失败的 state 也已被消费, 不能再次使用
+	if _, err := s.Callback(ctx, "fake", "sub", state); !errors.Is(err, domain.ErrOAuthStateInvalid) {
+		t.Errorf("reused state err = %v", err)
+	}
+}
+
+func TestOAuthService_LinkAndUnlink(t *testing.T) {
+	s, identities := newTestOAuthService(t)
+	ctx := context.Background()
+
+	result, err := s.Callback(ctx, "fake", "sub-1", startAuth(t, s, 7))
+	if err != nil || !result.Linked {
+		t.Fatalf("link result = %+v, err = %v", result, err)
+	}
+	// 重复绑定同一个账号是幂等的
+	if _, err = s.Callback(ctx, "fake", "sub-1", startAuth(t, s, 7)); err != nil {
+		t.Errorf("relink err = %v", err)
+	}
+	// 已绑定其他用户的第三方账号不能再绑定
+	if _, err = s.Callback(ctx, "fake", "sub-1", startAuth(t, s, 8)); !errors.Is(err, domain.ErrIdentityLinked) {
+		t.Errorf("link to other user err = %v", err)
+	}
+	// 同一提供方只能绑定一个账号
+	if _, err = s.Callback(ctx, "fake", "sub-2", startAuth(t, s, 7)); !errors.Is(err, domain.ErrProviderAlreadyBound) {
+		t.Errorf("second identity err = %v", err)
+	}
+
+	list, _ := s.ListIdentities(ctx, 7)
+	if len(list) != 1 || list[0].Name != "user-sub-1" {
+		t.Errorf("identities = %+v", list)
+	}
+	if err = s.Unlink(ctx, 7, "fake"); err != nil {
+		t.Errorf("Unlink err = %v", err)
+	}
+	if err = s.Unlink(ctx, 7, "fake"); !errors.Is(err, domain.ErrIdentityNotFound) {
+		t.Errorf("Unlink again err = %v", err)
+	}
+	if len(identities.identities) != 0 {
+		t.Errorf("identities left = %d", len(identities.identities))
+	}
+}
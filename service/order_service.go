@@ -2,74 +2,254 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	applog "github.com/star-find-cloud/star-mall/pkg/logger"
 	"github.com/star-find-cloud/star-mall/repo"
 	"github.com/star-find-cloud/star-mall/utils"
+	"math"
 	"time"
 )
 
 type OrderService interface {
-	// Create 创建订单
-	Create(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem, userID int64) (int64, int64, error)
+	// Create 创建订单, 商品单价以服务端价格为准, 并根据用户钱包计算最优优惠
+	Create(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem, userID int64, userCouponIDs []int64) (int64, int64, error)
 
-	// GetByID 获取订单
-	GetByID(ctx context.Context, id int64) (*domain.Order, *domain.OrderItem, error)
+	// GetByID 获取订单, 仅订单所属用户、订单商品所属商家和管理员可查看
+	GetByID(ctx context.Context, id int64, actor domain.Actor) (*domain.Order, *domain.OrderItem, error)
+
+	// List 分页查询订单, 用户查看自己的订单, 商家查看包含自家商品的订单, 管理员可设置 All 查看全部订单
+	List(ctx context.Context, query *domain.OrderQuery) (*domain.OrderPage, error)
+
+	// Cancel 取消待付款订单, 退回优惠券并回补库存, 仅订单所属用户和管理员可操作
+	Cancel(ctx context.Context, id int64, actor domain.Actor) error
 
 	// Delete 删除订单
 	Delete(ctx context.Context, id int64) error
 }
 
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
 type OrderServiceImpl struct {
 	OrderRepo     repo.OrderRepo
 	productRepo   repo.ProductRepo
 	userRepo      repo.UserRepo
 	inventoryRepo repo.InventoryRepo
+	couponService CouponService
+	vip           MembershipService
 }
 
-func NewOrderService(orderRepo repo.OrderRepo, productRepo repo.ProductRepo, userRepo repo.UserRepo, inventoryRepo repo.InventoryRepo) *OrderServiceImpl {
+func NewOrderService(orderRepo repo.OrderRepo, productRepo repo.ProductRepo, userRepo repo.UserRepo, inventoryRepo repo.InventoryRepo, couponService CouponService, vip MembershipService) *OrderServiceImpl {
 	return &OrderServiceImpl{
 		OrderRepo:     orderRepo,
 		productRepo:   productRepo,
 		userRepo:      userRepo,
 		inventoryRepo: inventoryRepo,
+		couponService: couponService,
+		vip:           vip,
 	}
 }
 
-func (s *OrderServiceImpl) Create(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem, userID int64) (int64, int64, error) {
+func (s *OrderServiceImpl) Create(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem, userID int64, userCouponIDs []int64) (int64, int64, error) {
 	if userID == 0 {
 		return 0, 0, errors.New("userID is empty")
 	}
 	if order.UserID != userID {
 		return 0, 0, errors.New("用户ID与订单所属用户ID不匹配")
 	}
+	if orderItem.Quantity <= 0 {
+		return 0, 0, errors.New("商品数量必须大于0")
+	}
+
+	product, err := s.productRepo.GetByID(ctx, orderItem.ProductID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = s.userRepo.UpdateUserTags(ctx, userID, product.CateID); err != nil {
+		applog.AppLogger.Warnf("更新用户标签失败: %v", err)
+	}
+
+	tier, err := s.vip.ActiveTier(ctx, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 价格以服务端商品价格为准, 会员按会员价计算, 单位: 分
+	orderItem.ProductTitle = product.Title
+	orderItem.UnitPrice = int64(math.Round(product.Price * 100))
+	if tier != nil {
+		orderItem.UnitPrice = tier.PriceCents(orderItem.UnitPrice)
+	}
+	orderItem.Subtotal = orderItem.UnitPrice * orderItem.Quantity
+
+	order.TotalPrice = orderItem.Subtotal
+	order.ShippingFee = conf.GetConfig().Order.ShippingFee
+	if tier != nil && tier.FreeShipping(order.TotalPrice) {
+		order.ShippingFee = 0
+	}
+	lines := []domain.CouponLine{{
+		ProductID:  product.ID,
+		MerchantID: product.MerchantID,
+		CateID:     product.CateID,
+		Amount:     orderItem.Subtotal,
+	}}
+	plan, err := s.couponService.Plan(ctx, userID, userCouponIDs, lines, order.ShippingFee)
+	if err != nil {
+		return 0, 0, err
+	}
+	order.DiscountPrice = plan.Total + plan.Shipping
+	order.PayPrice = order.TotalPrice + order.ShippingFee - order.DiscountPrice
 
-	tag, err := s.productRepo.GetCateID(ctx, orderItem.ProductID)
-	err = s.userRepo.UpdateUserTags(ctx, userID, tag)
 	id, err := utils.GenerateOrderID()
 	if err != nil {
 		applog.AppLogger.Errorf("生成订单号失败: %v", err)
 		return 0, 0, fmt.Errorf("生成订单号失败: %v", err)
 	}
 	order.ID = id
+	orderItem.OrderID = id
+	order.OrderStatus = _const.OrderStatusPendingPayment
 	order.CreatedAt = time.Now().Unix()
 
+	// 先扣减库存再核销优惠券和写入订单, 之后任一步失败都回补库存, 订单写入成功即返回成功
+	if err = s.inventoryRepo.Deduction(ctx, orderItem.ProductID, orderItem.Quantity); err != nil {
+		return 0, 0, err
+	}
+	if err = s.couponService.Use(ctx, userID, order.ID, plan); err != nil {
+		s.restock(ctx, orderItem)
+		return 0, 0, err
+	}
+
 	err = s.OrderRepo.Create(ctx, order, orderItem)
 	if err != nil {
 		applog.AppLogger.Errorf("创建订单失败: %v", err)
+		s.returnCoupons(ctx, order.ID)
+		s.restock(ctx, orderItem)
 		return 0, 0, fmt.Errorf("创建订单失败: %v", err)
 	}
+	if err = s.OrderRepo.SaveDiscounts(ctx, order.ID, plan.Discounts); err != nil {
+		applog.AppLogger.Errorf("保存订单优惠明细失败: %v", err)
+		// 订单缺少优惠明细, 取消订单并退回已核销的优惠券和库存
+		if terr := s.OrderRepo.TransitionStatus(ctx, order.ID, _const.OrderStatusPendingPayment, _const.OrderStatusCanceled); terr != nil {
+			applog.AppLogger.Errorf("取消订单失败: %v", terr)
+		}
+		s.returnCoupons(ctx, order.ID)
+		s.restock(ctx, orderItem)
+		return 0, 0, err
+	}
 
-	return order.ID, order.CreatedAt, s.inventoryRepo.Deduction(ctx, orderItem.ProductID, orderItem.Quantity)
+	return order.ID, order.CreatedAt, nil
 }
 
-func (s *OrderServiceImpl) GetByID(ctx context.Context, id int64) (*domain.Order, *domain.OrderItem, error) {
+// returnCoupons 下单失败时退回已核销的优惠券, 失败只记录日志
+func (s *OrderServiceImpl) returnCoupons(ctx context.Context, orderID int64) {
+	if err := s.couponService.Return(ctx, orderID); err != nil {
+		applog.AppLogger.Errorf("退回优惠券失败: %v", err)
+	}
+}
+
+// restock 下单失败时回补已扣减的库存, 失败只记录日志
+func (s *OrderServiceImpl) restock(ctx context.Context, orderItem *domain.OrderItem) {
+	if err := s.inventoryRepo.Restock(ctx, orderItem.ProductID, orderItem.Quantity); err != nil {
+		applog.AppLogger.Errorf("回补库存失败 (product: %d): %v", orderItem.ProductID, err)
+	}
+}
+
+func (s *OrderServiceImpl) GetByID(ctx context.Context, id int64, actor domain.Actor) (*domain.Order, *domain.OrderItem, error) {
 	if id == 0 {
 		return nil, nil, errors.New("id is empty")
 	}
-	return s.OrderRepo.GetByID(ctx, id)
+	order, orderItem, err := s.OrderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = s.authorize(ctx, order, orderItem, actor); err != nil {
+		return nil, nil, err
+	}
+	return order, orderItem, nil
+}
+
+// authorize 校验 actor 是否可以查看订单: 订单所属用户、订单商品所属商家或管理员
+func (s *OrderServiceImpl) authorize(ctx context.Context, order *domain.Order, orderItem *domain.OrderItem, actor domain.Actor) error {
+	if actor.OwnsUser(order.UserID) {
+		return nil
+	}
+	if actor.IsMerchant() {
+		merchantID, err := s.productRepo.GetMerchantID(ctx, orderItem.ProductID)
+		if err != nil {
+			return err
+		}
+		if actor.OwnsMerchant(merchantID) {
+			return nil
+		}
+	}
+	return domain.ErrForbidden
+}
+
+func (s *OrderServiceImpl) List(ctx context.Context, query *domain.OrderQuery) (*domain.OrderPage, error) {
+	if !query.All && (query.UserID == 0) == (query.MerchantID == 0) {
+		return nil, errors.New("必须且只能指定用户或商家")
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultOrderPageSize
+	}
+	query.Limit = min(query.Limit, maxOrderPageSize)
+
+	cursor, err := domain.DecodeOrderCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多查一条用于判断是否还有下一页
+	limit := query.Limit
+	query.Limit = limit + 1
+	orders, err := s.OrderRepo.List(ctx, query, cursor)
+	query.Limit = limit
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = domain.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	return page, nil
+}
+
+func (s *OrderServiceImpl) Cancel(ctx context.Context, id int64, actor domain.Actor) error {
+	order, orderItem, err := s.OrderRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !actor.OwnsUser(order.UserID) {
+		return domain.ErrForbidden
+	}
+	if order.OrderStatus != _const.OrderStatusPendingPayment {
+		return domain.ErrOrderNotCancelable
+	}
+
+	// 并发取消或支付时只有一次状态转换成功, 只有成功的一方退回优惠券和回补库存
+	err = s.OrderRepo.TransitionStatus(ctx, order.ID, _const.OrderStatusPendingPayment, _const.OrderStatusCanceled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrOrderNotCancelable
+	}
+	if err != nil {
+		return err
+	}
+	order.OrderStatus = _const.OrderStatusCanceled
+	if err = s.couponService.Return(ctx, order.ID); err != nil {
+		applog.AppLogger.Errorf("退回优惠券失败: %v", err)
+		return err
+	}
+	return s.inventoryRepo.Restock(ctx, orderItem.ProductID, orderItem.Quantity)
 }
 
 func (s *OrderServiceImpl) Delete(ctx context.Context, id int64) error {
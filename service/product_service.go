@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
 	"github.com/star-find-cloud/star-mall/pkg/oss"
 	"github.com/star-find-cloud/star-mall/repo"
+	"slices"
 )
 
 type ProductService interface {
@@ -21,27 +23,38 @@ type ProductService interface {
 	// GetByTitleAndKeywords 根据标题和关键词获取商品
 	GetByTitleAndKeywords(ctx context.Context, title, keywords string, offset int) ([]*domain.Product, error)
 
-	// Update 更新商品
-	Update(ctx context.Context, product *domain.Product, merchantID int64) error
+	// Update 更新商品, 仅商品所属商家和管理员可操作
+	Update(ctx context.Context, product *domain.Product, actor domain.Actor) error
 
-	// Delete 删除商品
-	Delete(ctx context.Context, id int64) error
+	// Delete 删除商品, 仅商品所属商家和管理员可操作
+	Delete(ctx context.Context, id int64, actor domain.Actor) error
 
-	// Search 根据搜索关键词获取商品
-	Search(ctx context.Context, msg string) ([]domain.Product, error)
+	// Search 通过搜索索引查询商品, 返回的商品按索引排序
+	Search(ctx context.Context, q *search.Query) (*domain.ProductSearchPage, error)
+
+	// RebuildIndex 从数据库重建商品搜索索引, 返回写入的商品数
+	RebuildIndex(ctx context.Context) (int, error)
 }
 
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// ProductServiceImpl 商品的增删改由仓储写入发件箱事件, 再由 IndexSyncService 同步到搜索索引
 type ProductServiceImpl struct {
 	productRepo repo.ProductRepo
 	oss         oss.OSS
 	imageRepo   repo.ImageRepo
+	index       search.ProductIndex
 }
 
-func NewProductService(repo repo.ProductRepo, oss oss.OSS, imageRepo repo.ImageRepo) *ProductServiceImpl {
+func NewProductService(repo repo.ProductRepo, oss oss.OSS, imageRepo repo.ImageRepo, index search.ProductIndex) *ProductServiceImpl {
 	return &ProductServiceImpl{
 		productRepo: repo,
 		oss:         oss,
 		imageRepo:   imageRepo,
+		index:       index,
 	}
 }
 
@@ -77,27 +90,105 @@ func (s *ProductServiceImpl) GetByTitleAndKeywords(ctx context.Context, title, k
 	return s.productRepo.GetByTitleAndKeywords(ctx, title, keywords, offset)
 }
 
-func (s *ProductServiceImpl) Update(ctx context.Context, product *domain.Product, merchantID int64) error {
+func (s *ProductServiceImpl) Update(ctx context.Context, product *domain.Product, actor domain.Actor) error {
+	if product.ID == 0 {
+		return errors.New("id is empty")
+	}
 	storeID, err := s.productRepo.GetMerchantID(ctx, product.ID)
 	if err != nil {
 		return errors.New("merchantID is empty")
 	}
-	if !product.ValidateMerchantID(merchantID, storeID) {
-		return errors.New("商家ID与商品所属商家ID不匹配")
-	}
-	if product.ID == 0 {
-		return errors.New("id is empty")
+	if !actor.OwnsMerchant(storeID) {
+		return domain.ErrForbidden
 	}
+	// 商品归属不随更新改变
+	product.MerchantID = storeID
 	return s.productRepo.Update(ctx, product)
 }
 
-func (s *ProductServiceImpl) Delete(ctx context.Context, id int64) error {
+func (s *ProductServiceImpl) Delete(ctx context.Context, id int64, actor domain.Actor) error {
 	if id == 0 {
 		return errors.New("id is empty")
 	}
+	storeID, err := s.productRepo.GetMerchantID(ctx, id)
+	if err != nil {
+		return errors.New("merchantID is empty")
+	}
+	if !actor.OwnsMerchant(storeID) {
+		return domain.ErrForbidden
+	}
 	return s.productRepo.Delete(ctx, id)
 }
 
-func (s *ProductServiceImpl) Search(ctx context.Context, msg string) ([]domain.Product, error) {
-	return s.productRepo.SearchByMsg(ctx, msg)
+func (s *ProductServiceImpl) Search(ctx context.Context, q *search.Query) (*domain.ProductSearchPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultSearchPageSize
+	}
+	q.Limit = min(q.Limit, maxSearchPageSize)
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	// 选择分类时同时搜索其全部子分类
+	if len(q.Filter.CateIDs) > 0 {
+		subtree, err := s.productRepo.GetCateSubtree(ctx, q.Filter.CateIDs)
+		if err != nil {
+			return nil, err
+		}
+		q.Filter.CateIDs = slices.Compact(slices.Sorted(slices.Values(slices.Concat(q.Filter.CateIDs, subtree))))
+	}
+
+	result, err := s.index.Search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.productRepo.GetByIDs(ctx, result.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按索引的排序返回, 索引中存在但数据库中已删除的商品不返回
+	byID := make(map[int64]*domain.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	page := &domain.ProductSearchPage{
+		Products: make([]*domain.Product, 0, len(result.IDs)),
+		Total:    result.Total,
+		Offset:   q.Offset,
+		Limit:    q.Limit,
+		Facets:   result.Facets,
+	}
+	for _, id := range result.IDs {
+		if p, ok := byID[id]; ok {
+			page.Products = append(page.Products, p)
+		}
+	}
+	return page, nil
+}
+
+func (s *ProductServiceImpl) RebuildIndex(ctx context.Context) (int, error) {
+	return s.index.Reindex(ctx, func(ctx context.Context, afterID int64, limit int) ([]*search.Document, error) {
+		products, err := s.productRepo.ListForIndex(ctx, afterID, limit)
+		if err != nil {
+			return nil, err
+		}
+		return indexDocuments(ctx, s.productRepo, products)
+	})
+}
+
+// indexDocuments 将商品转换为索引文档, 可用库存大于 0 的商品为有货
+func indexDocuments(ctx context.Context, productRepo repo.ProductRepo, products []*domain.Product) ([]*search.Document, error) {
+	ids := make([]int64, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	stocks, err := productRepo.GetAvailableStock(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*search.Document, 0, len(products))
+	for _, p := range products {
+		docs = append(docs, search.NewDocument(p, stocks[p.ID] > 0))
+	}
+	return docs, nil
 }
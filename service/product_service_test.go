@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	"slices"
+	"testing"
+)
+
+// fakeCatalogRepo 内存中的商品、库存和分类
+type fakeCatalogRepo struct {
+	fakeProductRepo
+	products []*domain.Product
+	stocks   map[int64]int64
+	children map[int64][]int64
+}
+
+func (r *fakeCatalogRepo) ListForIndex(ctx context.Context, afterID int64, limit int) ([]*domain.Product, error) {
+	var batch []*domain.Product
+	for _, p := range r.products {
+		if p.ID > afterID && len(batch) < limit {
+			batch = append(batch, p)
+		}
+	}
+	return batch, nil
+}
+
+func (r *fakeCatalogRepo) GetByIDs(ctx context.Context, ids []int64) ([]*domain.Product, error) {
+	var found []*domain.Product
+	for _, p := range r.products {
+		if slices.Contains(ids, p.ID) {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeCatalogRepo) GetAvailableStock(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	return r.stocks, nil
+}
+
+func (r *fakeCatalogRepo) GetCateSubtree(ctx context.Context, ids []int64) ([]int64, error) {
+	var subtree []int64
+	for len(ids) > 0 {
+		subtree = append(subtree, ids...)
+		var next []int64
+		for _, id := range ids {
+			next = append(next, r.children[id]...)
+		}
+		ids = next
+	}
+	return subtree, nil
+}
+
+func (r *fakeCatalogRepo) ListCates(ctx context.Context) ([]*domain.ProductCate, error) {
+	return []*domain.ProductCate{{ID: 11, Title: "耳机"}, {ID: 12, Title: "音箱"}}, nil
+}
+
+func TestProductService_SearchFacets(t *testing.T) {
+	repo := &fakeCatalogRepo{
+		products: []*domain.Product{
+			{ID: 1, Title: "蓝牙耳机", Brand: "星辰", CateID: 11, Price: 199, Rating: 4.5},
+			{ID: 2, Title: "蓝牙音箱", Brand: "星辰", CateID: 12, Price: 399, Rating: 4.9},
+			{ID: 3, Title: "蓝牙键盘", Brand: "飞跃", CateID: 20, Price: 99, Rating: 4.7},
+		},
+		stocks:   map[int64]int64{1: 5, 2: 0, 3: 8},
+		children: map[int64][]int64{1: {10}, 10: {11, 12}},
+	}
+	s := NewProductService(repo, nil, nil, search.NewMemoryIndex())
+	ctx := context.Background()
+	if n, err := s.RebuildIndex(ctx); err != nil || n != 3 {
+		t.Fatalf("RebuildIndex = %d, %v", n, err)
+	}
+
+	// 顶级分类 1 包含子孙分类 11 和 12
+	page, err := s.Search(ctx, &search.Query{Text: "蓝牙", Filter: search.Filter{CateIDs: []int64{1}}, Sort: search.SortRating})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Products) != 2 || page.Products[0].ID != 2 || page.Products[1].ID != 1 {
+		t.Errorf("subtree search got %+v, want products 2, 1", page.Products)
+	}
+	if len(page.Facets.Brands) != 1 || page.Facets.Brands[0] != (domain.BrandFacet{Brand: "星辰", Count: 2}) {
+		t.Errorf("brand facets = %+v", page.Facets.Brands)
+	}
+	wantPrices := []domain.PriceFacet{{Min: 100, Max: 200, Count: 1}, {Min: 200, Max: 500, Count: 1}}
+	if !slices.Equal(page.Facets.Prices, wantPrices) {
+		t.Errorf("price facets = %+v, want %+v", page.Facets.Prices, wantPrices)
+	}
+
+	// 没有可用库存的商品不在有货结果中
+	page, err = s.Search(ctx, &search.Query{Filter: search.Filter{InStock: true}, Sort: search.SortPriceAsc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Products) != 2 || page.Products[0].ID != 3 || page.Products[1].ID != 1 {
+		t.Errorf("in-stock search got %+v, want products 3, 1", page.Products)
+	}
+	wantCates := []domain.CategoryFacet{{CateID: 11, Count: 1}, {CateID: 20, Count: 1}}
+	if !slices.Equal(page.Facets.Categories, wantCates) {
+		t.Errorf("category facets = %+v, want %+v", page.Facets.Categories, wantCates)
+	}
+}
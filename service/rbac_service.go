@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+)
+
+type RBACService interface {
+	// CreateRole 创建自定义角色, 通过接口创建的角色均不是系统角色
+	CreateRole(ctx context.Context, name, code, description string, operatorID int64) (int64, error)
+
+	// ListRoles 获取全部角色
+	ListRoles(ctx context.Context) ([]*domain.Role, error)
+
+	// UpdateRole 更新角色名称、描述、排序和状态, 只更新传入的字段, 系统角色不能被禁用
+	UpdateRole(ctx context.Context, update *domain.RoleUpdate, operatorID int64) error
+
+	// DeleteRole 删除角色, 系统角色不能被删除
+	DeleteRole(ctx context.Context, id int64) error
+
+	// ListPermissions 获取全部权限
+	ListPermissions(ctx context.Context) ([]*domain.Auth, error)
+
+	// GetRolePermissions 获取角色拥有的权限
+	GetRolePermissions(ctx context.Context, roleID int64) ([]*domain.Auth, error)
+
+	// SetRolePermissions 覆盖角色拥有的权限
+	SetRolePermissions(ctx context.Context, roleID int64, permissionIDs []int64, operatorID int64) error
+
+	// AssignRole 为用户、商家或管理员额外分配角色
+	AssignRole(ctx context.Context, userType, userID, roleID, operatorID int64) error
+
+	// RevokeRole 撤销额外分配的角色
+	RevokeRole(ctx context.Context, userType, userID, roleID int64) error
+
+	// Authorize 判断 actor 的角色是否拥有 method + 路由模板 对应的权限
+	Authorize(ctx context.Context, actor domain.Actor, method, pattern string) (bool, error)
+}
+
+type RBACServiceImpl struct {
+	rbacRepo repo.RBACRepo
+}
+
+func NewRBACService(rbacRepo repo.RBACRepo) *RBACServiceImpl {
+	return &RBACServiceImpl{rbacRepo: rbacRepo}
+}
+
+func (s *RBACServiceImpl) CreateRole(ctx context.Context, name, code, description string, operatorID int64) (int64, error) {
+	role, err := domain.NewRole(name, code, description, false, operatorID)
+	if err != nil {
+		return 0, err
+	}
+	return s.rbacRepo.CreateRole(ctx, role)
+}
+
+func (s *RBACServiceImpl) ListRoles(ctx context.Context) ([]*domain.Role, error) {
+	return s.rbacRepo.ListRoles(ctx)
+}
+
+func (s *RBACServiceImpl) UpdateRole(ctx context.Context, update *domain.RoleUpdate, operatorID int64) error {
+	stored, err := s.rbacRepo.GetRole(ctx, update.ID)
+	if err != nil {
+		return err
+	}
+	if update.Name != nil || update.Description != nil {
+		name, description := stored.Name, stored.Description
+		if update.Name != nil {
+			name = *update.Name
+		}
+		if update.Description != nil {
+			description = *update.Description
+		}
+		if err = stored.Update(name, description, operatorID); err != nil {
+			return err
+		}
+	}
+	if update.Sort != nil {
+		stored.UpdateSort(*update.Sort, operatorID)
+	}
+
+	switch {
+	case update.Status == nil:
+	case *update.Status == 1:
+		stored.Enable(operatorID)
+	case stored.IsSystem:
+		return domain.ErrSystemRole
+	default:
+		stored.Disable(operatorID)
+	}
+	return s.rbacRepo.UpdateRole(ctx, stored)
+}
+
+func (s *RBACServiceImpl) DeleteRole(ctx context.Context, id int64) error {
+	role, err := s.rbacRepo.GetRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return domain.ErrSystemRole
+	}
+	return s.rbacRepo.DeleteRole(ctx, id)
+}
+
+func (s *RBACServiceImpl) ListPermissions(ctx context.Context) ([]*domain.Auth, error) {
+	return s.rbacRepo.ListPermissions(ctx)
+}
+
+func (s *RBACServiceImpl) GetRolePermissions(ctx context.Context, roleID int64) ([]*domain.Auth, error) {
+	if _, err := s.rbacRepo.GetRole(ctx, roleID); err != nil {
+		return nil, err
+	}
+	return s.rbacRepo.GetRolePermissions(ctx, roleID)
+}
+
+func (s *RBACServiceImpl) SetRolePermissions(ctx context.Context, roleID int64, permissionIDs []int64, operatorID int64) error {
+	if _, err := s.rbacRepo.GetRole(ctx, roleID); err != nil {
+		return err
+	}
+	return s.rbacRepo.SetRolePermissions(ctx, roleID, permissionIDs, operatorID)
+}
+
+func (s *RBACServiceImpl) AssignRole(ctx context.Context, userType, userID, roleID, operatorID int64) error {
+	if domain.SystemRoleCode(userType) == "" || userID == 0 {
+		return errors.New("无效的用户")
+	}
+	if _, err := s.rbacRepo.GetRole(ctx, roleID); err != nil {
+		return err
+	}
+	return s.rbacRepo.AssignRole(ctx, domain.NewUserRole(userType, userID, roleID, operatorID))
+}
+
+func (s *RBACServiceImpl) RevokeRole(ctx context.Context, userType, userID, roleID int64) error {
+	return s.rbacRepo.RevokeRole(ctx, userType, userID, roleID)
+}
+
+func (s *RBACServiceImpl) Authorize(ctx context.Context, actor domain.Actor, method, pattern string) (bool, error) {
+	if actor.ID == 0 || domain.SystemRoleCode(actor.Role) == "" {
+		return false, nil
+	}
+	permissions, err := s.rbacRepo.GetSubjectPermissions(ctx, actor.Role, actor.ID)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := permissions[domain.PermissionAll]; ok {
+		return true, nil
+	}
+	_, ok := permissions[domain.PermissionKey(method, pattern)]
+	return ok, nil
+}
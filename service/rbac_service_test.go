@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"testing"
+)
+
+type fakeRBACRepo struct {
+	repo.RBACRepo
+	roles   map[int64]*domain.Role
+	deleted []int64
+}
+
+func (r *fakeRBACRepo) GetRole(ctx context.Context, id int64) (*domain.Role, error) {
+	if role, ok := r.roles[id]; ok {
+		return role, nil
+	}
+	return nil, domain.ErrRoleNotFound
+}
+
+func (r *fakeRBACRepo) UpdateRole(ctx context.Context, role *domain.Role) error {
+	return nil
+}
+
+func (r *fakeRBACRepo) DeleteRole(ctx context.Context, id int64) error {
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func TestRBACService_SystemRoleProtected(t *testing.T) {
+	rbacRepo := &fakeRBACRepo{roles: map[int64]*domain.Role{
+		1: {ID: 1, Name: "管理员", Code: "admin", Status: 1, IsSystem: true},
+		2: {ID: 2, Name: "客服", Code: "support", Status: 1},
+	}}
+	s := NewRBACService(rbacRepo)
+	ctx := context.Background()
+
+	if err := s.DeleteRole(ctx, 1); !errors.Is(err, domain.ErrSystemRole) {
+		t.Errorf("DeleteRole(system) err = %v, want %v", err, domain.ErrSystemRole)
+	}
+	disabled, sort := 0, 5
+	if err := s.UpdateRole(ctx, &domain.RoleUpdate{ID: 1, Status: &disabled}, 1); !errors.Is(err, domain.ErrSystemRole) {
+		t.Errorf("UpdateRole(disable system) err = %v, want %v", err, domain.ErrSystemRole)
+	}
+	// 只传排序时名称、描述和状态保持不变
+	if err := s.UpdateRole(ctx, &domain.RoleUpdate{ID: 1, Sort: &sort}, 1); err != nil {
+		t.Errorf("UpdateRole(sort only) err = %v", err)
+	}
+	if role := rbacRepo.roles[1]; role.Name != "管理员" || role.Status != 1 || role.Sort != 5 {
+		t.Errorf("role after sort-only update = %+v", role)
+	}
+	if err := s.DeleteRole(ctx, 2); err != nil {
+		t.Errorf("DeleteRole(custom) err = %v", err)
+	}
+	if len(rbacRepo.deleted) != 1 || rbacRepo.deleted[0] != 2 {
+		t.Errorf("deleted = %v, want [2]", rbacRepo.deleted)
+	}
+}
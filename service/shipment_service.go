@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/logistics"
+	applog "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"time"
+)
+
+// 单次同步的发货单数量上限
+const shipmentSyncBatch = 200
+
+type ShipmentService interface {
+	// Ship 商家为订单中的一个或多个订单项录入承运商和运单号, 订单随之进入已发货状态
+	Ship(ctx context.Context, actor domain.Actor, orderID int64, carrier, trackingNo string, itemIDs []int64) (int64, error)
+
+	// Timeline 获取订单的物流时间线, 仅订单所属用户、发货商家和管理员可查看
+	Timeline(ctx context.Context, orderID int64, actor domain.Actor) ([]*domain.ShipmentTimeline, error)
+
+	// SyncEvents 通过承运商适配器同步未签收包裹的物流轨迹
+	SyncEvents(ctx context.Context) error
+
+	// AutoConfirm 将签收超过指定天数的订单自动确认收货, 返回确认的订单数
+	AutoConfirm(ctx context.Context) (int, error)
+
+	// Run 周期性执行轨迹同步和自动确认收货, 直到 ctx 结束
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type ShipmentServiceImpl struct {
+	shipmentRepo    repo.ShipmentRepo
+	orderRepo       repo.OrderRepo
+	productRepo     repo.ProductRepo
+	carriers        *logistics.Registry
+	autoConfirmDays int
+}
+
+func NewShipmentService(shipmentRepo repo.ShipmentRepo, orderRepo repo.OrderRepo, productRepo repo.ProductRepo, carriers *logistics.Registry, autoConfirmDays int) *ShipmentServiceImpl {
+	if autoConfirmDays <= 0 {
+		autoConfirmDays = 7
+	}
+	return &ShipmentServiceImpl{
+		shipmentRepo:    shipmentRepo,
+		orderRepo:       orderRepo,
+		productRepo:     productRepo,
+		carriers:        carriers,
+		autoConfirmDays: autoConfirmDays,
+	}
+}
+
+func (s *ShipmentServiceImpl) Ship(ctx context.Context, actor domain.Actor, orderID int64, carrier, trackingNo string, itemIDs []int64) (int64, error) {
+	if _, err := s.carriers.Get(carrier); err != nil {
+		return 0, err
+	}
+
+	order, orderItem, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return 0, err
+	}
+	if order.OrderStatus != _const.OrderStatusPendingShipment && order.OrderStatus != _const.OrderStatusShipped {
+		return 0, errors.New("订单当前状态不允许发货")
+	}
+
+	merchantID, err := s.productRepo.GetMerchantID(ctx, orderItem.ProductID)
+	if err != nil {
+		return 0, err
+	}
+	if !actor.OwnsMerchant(merchantID) {
+		return 0, domain.ErrForbidden
+	}
+
+	// 未指定订单项时发出订单内全部商品
+	if len(itemIDs) == 0 {
+		itemIDs = []int64{orderItem.ItemID}
+	}
+	shipped, err := s.shipmentRepo.GetShippedItemIDs(ctx, orderID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range itemIDs {
+		if id != orderItem.ItemID {
+			return 0, fmt.Errorf("订单项 %d 不属于订单 %d", id, orderID)
+		}
+		if domain.Int64List(shipped).Contains(id) {
+			return 0, fmt.Errorf("订单项 %d 已发货", id)
+		}
+	}
+
+	shipment, err := domain.NewShipment(orderID, merchantID, carrier, trackingNo, itemIDs, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	id, err := s.shipmentRepo.Create(ctx, shipment)
+	if err != nil {
+		applog.AppLogger.Errorf("创建发货单失败: %v", err)
+		return 0, fmt.Errorf("创建发货单失败: %w", err)
+	}
+
+	if order.OrderStatus != _const.OrderStatusShipped {
+		order.OrderStatus = _const.OrderStatusShipped
+		if err = s.orderRepo.UpdateStatus(ctx, order); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+func (s *ShipmentServiceImpl) Timeline(ctx context.Context, orderID int64, actor domain.Actor) ([]*domain.ShipmentTimeline, error) {
+	order, orderItem, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.OwnsUser(order.UserID) {
+		merchantID, err := s.productRepo.GetMerchantID(ctx, orderItem.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if !actor.OwnsMerchant(merchantID) {
+			return nil, domain.ErrForbidden
+		}
+	}
+
+	shipments, err := s.shipmentRepo.GetByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	timelines := make([]*domain.ShipmentTimeline, 0, len(shipments))
+	for _, shipment := range shipments {
+		events, err := s.shipmentRepo.GetEvents(ctx, shipment.ID)
+		if err != nil {
+			return nil, err
+		}
+		timelines = append(timelines, &domain.ShipmentTimeline{Shipment: shipment, Events: events})
+	}
+	return timelines, nil
+}
+
+func (s *ShipmentServiceImpl) SyncEvents(ctx context.Context) error {
+	shipments, err := s.shipmentRepo.ListActive(ctx, shipmentSyncBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, shipment := range shipments {
+		if err := s.syncShipment(ctx, shipment); err != nil {
+			// 单个包裹失败不影响其他包裹的同步
+			applog.AppLogger.Warnf("同步物流轨迹失败 (shipment: %d): %v", shipment.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *ShipmentServiceImpl) syncShipment(ctx context.Context, shipment *domain.Shipment) error {
+	carrier, err := s.carriers.Get(shipment.Carrier)
+	if err != nil {
+		return err
+	}
+	events, err := carrier.Track(ctx, shipment.TrackingNo)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	if err = s.shipmentRepo.AddEvents(ctx, shipment.ID, events); err != nil {
+		return err
+	}
+
+	stored, err := s.shipmentRepo.GetEvents(ctx, shipment.ID)
+	if err != nil {
+		return err
+	}
+	if shipment.Apply(stored) {
+		return s.shipmentRepo.UpdateStatus(ctx, shipment)
+	}
+	return nil
+}
+
+func (s *ShipmentServiceImpl) AutoConfirm(ctx context.Context) (int, error) {
+	before := time.Now().AddDate(0, 0, -s.autoConfirmDays).Unix()
+	ids, err := s.shipmentRepo.ListConfirmableOrders(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	confirmed := 0
+	for _, id := range ids {
+		// 查询后订单可能已被确认或售后, 只确认仍为已发货的订单
+		err := s.orderRepo.TransitionStatus(ctx, id, _const.OrderStatusShipped, _const.OrderStatusCompleted)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			applog.AppLogger.Warnf("自动确认收货失败 (order: %d): %v", id, err)
+			continue
+		}
+		confirmed++
+	}
+	return confirmed, nil
+}
+
+func (s *ShipmentServiceImpl) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SyncEvents(ctx); err != nil {
+				applog.AppLogger.Errorf("同步物流轨迹失败: %v", err)
+			}
+			if n, err := s.AutoConfirm(ctx); err != nil {
+				applog.AppLogger.Errorf("自动确认收货失败: %v", err)
+			} else if n > 0 {
+				applog.AppLogger.Infof("自动确认收货 %d 个订单", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/pkg/sms"
+	"github.com/star-find-cloud/star-mall/repo"
+	"github.com/star-find-cloud/star-mall/utils"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSmsCodeTTL         = 5 * time.Minute
+	defaultSmsResendInterval  = time.Minute
+	defaultSmsMaxAttempts     = 5
+	defaultSmsPhoneDailyLimit = 10
+	defaultSmsIPDailyLimit    = 30
+)
+
+type SmsService interface {
+	// SendCode 向手机号发送登录验证码, 同一手机号有发送间隔, 手机号和 IP 有每日限额
+	SendCode(ctx context.Context, phone, ip string) error
+
+	// VerifyCode 校验验证码, 通过后验证码失效; 输错次数过多时验证码作废
+	VerifyCode(ctx context.Context, phone, code string) error
+}
+
+type SmsServiceImpl struct {
+	repo     repo.SmsRepo
+	otpRepo  repo.OTPRepo
+	provider sms.Provider
+	conf     conf.SMSConf
+}
+
+func NewSmsService(repo repo.SmsRepo, otpRepo repo.OTPRepo, provider sms.Provider, c conf.SMSConf) *SmsServiceImpl {
+	if c.CodeTTL <= 0 {
+		c.CodeTTL = defaultSmsCodeTTL
+	}
+	if c.ResendInterval <= 0 {
+		c.ResendInterval = defaultSmsResendInterval
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultSmsMaxAttempts
+	}
+	if c.PhoneDailyLimit <= 0 {
+		c.PhoneDailyLimit = defaultSmsPhoneDailyLimit
+	}
+	if c.IPDailyLimit <= 0 {
+		c.IPDailyLimit = defaultSmsIPDailyLimit
+	}
+	return &SmsServiceImpl{
+		repo:     repo,
+		otpRepo:  otpRepo,
+		provider: provider,
+		conf:     c,
+	}
+}
+
+func (s *SmsServiceImpl) SendCode(ctx context.Context, phone, ip string) error {
+	if !utils.VerifyPhone(phone) {
+		return errors.New("invalid phone number")
+	}
+	if err := s.otpRepo.Cooldown(ctx, domain.OTPPurposeSmsLogin, phone, s.conf.ResendInterval); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	day, _ := strconv.Atoi(now.Format("20060102"))
+	record := &domain.UserSms{
+		IP:      ip,
+		Phone:   phone,
+		AddDay:  day,
+		AddTime: now.Unix(),
+	}
+	record.Sign = record.ComputeSign(s.conf.Secret)
+	if err := s.repo.RecordSend(ctx, record, s.conf.PhoneDailyLimit, s.conf.IPDailyLimit); err != nil {
+		if !errors.Is(err, domain.ErrSmsPhoneQuota) && !errors.Is(err, domain.ErrSmsIPQuota) {
+			s.refund(ctx, phone, nil)
+		}
+		return err
+	}
+
+	code, err := generateSmsCode()
+	if err != nil {
+		s.refund(ctx, phone, record)
+		return err
+	}
+	if err = s.otpRepo.Save(ctx, domain.OTPPurposeSmsLogin, phone, s.hashCode(phone, code), s.conf.CodeTTL); err != nil {
+		s.refund(ctx, phone, record)
+		return err
+	}
+	if err = s.provider.SendCode(ctx, phone, code); err != nil {
+		log.AppLogger.Errorf("send sms to %s failed: %v", phone, err)
+		s.refund(ctx, phone, record)
+		return errors.New("failed to send sms")
+	}
+	return nil
+}
+
+// refund 短信没有发出时清除发送间隔并退回已记录的额度, 用户可以立即重试. 退回失败只记录日志
+func (s *SmsServiceImpl) refund(ctx context.Context, phone string, record *domain.UserSms) {
+	if err := s.otpRepo.ResetCooldown(ctx, domain.OTPPurposeSmsLogin, phone); err != nil {
+		log.AppLogger.Errorf("reset sms cooldown for %s failed: %v", phone, err)
+	}
+	if record == nil {
+		return
+	}
+	if err := s.repo.RevertSend(ctx, record); err != nil {
+		log.AppLogger.Errorf("revert sms record for %s failed: %v", phone, err)
+	}
+}
+
+func (s *SmsServiceImpl) VerifyCode(ctx context.Context, phone, code string) error {
+	if phone == "" || code == "" {
+		return domain.ErrOTPInvalid
+	}
+	return s.otpRepo.Verify(ctx, domain.OTPPurposeSmsLogin, phone, s.hashCode(phone, code), s.conf.MaxAttempts)
+}
+
+// hashCode Redis 中只保存验证码的 HMAC 摘要
+func (s *SmsServiceImpl) hashCode(phone, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.conf.Secret))
+	mac.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSmsCode 生成 6 位数字验证码
+func generateSmsCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", errors.New("failed to generate code")
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSmsRepo 在内存中按手机号和 IP 计数
+type fakeSmsRepo struct {
+	phones map[string]int
+	ips    map[string]int
+}
+
+func (r *fakeSmsRepo) RecordSend(ctx context.Context, record *domain.UserSms, phoneLimit, ipLimit int) error {
+	if r.phones[record.Phone] >= phoneLimit {
+		return domain.ErrSmsPhoneQuota
+	}
+	if r.ips[record.IP] >= ipLimit {
+		return domain.ErrSmsIPQuota
+	}
+	r.phones[record.Phone]++
+	r.ips[record.IP]++
+	return nil
+}
+
+func (r *fakeSmsRepo) RevertSend(ctx context.Context, record *domain.UserSms) error {
+	r.phones[record.Phone]--
+	r.ips[record.IP]--
+	return nil
+}
+
+// fakeSmsProvider 记录每个手机号最后收到的验证码, failing 为 true 时发送失败
+type fakeSmsProvider struct {
+	codes   map[string]string
+	failing bool
+}
+
+func (p *fakeSmsProvider) SendCode(ctx context.Context, phone, code string) error {
+	if p.failing {
+		return errors.New("provider unavailable")
+	}
+	p.codes[phone] = code
+	return nil
+}
+
+func newTestSmsService(t *testing.T, c conf.SMSConf) (*SmsServiceImpl, *fakeSmsProvider, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	provider := &fakeSmsProvider{codes: make(map[string]string)}
+	smsRepo := &fakeSmsRepo{phones: make(map[string]int), ips: make(map[string]int)}
+	otpRepo := repo.NewOTPRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	return NewSmsService(smsRepo, otpRepo, provider, c), provider, mr
+}
+
+func TestSmsService_SendAndVerify(t *testing.T) {
+	s, provider, mr := newTestSmsService(t, conf.SMSConf{Secret: "secret", MaxAttempts: 3})
+	ctx := context.Background()
+	const phone = "13800138000"
+
+	if err := s.SendCode(ctx, "12345", "10.0.0.1"); err == nil {
+		t.Error("invalid phone accepted")
+	}
+	if err := s.SendCode(ctx, phone, "10.0.0.1"); err != nil {
+		t.Fatalf("SendCode: %v", err)
+	}
+	code := provider.codes[phone]
+	if len(code) != 6 {
+		t.Fatalf("code = %q, want 6 digits", code)
+	}
+	for _, key := range mr.Keys() {
+		if v := mr.HGet(key, "hash"); strings.Contains(v, code) {
+			t.Errorf("code stored in plain text under %s", key)
+		}
+	}
+	if err := s.SendCode(ctx, phone, "10.0.0.1"); !errors.Is(err, domain.ErrOTPTooFrequent) {
+		t.Errorf("resend: err = %v, want ErrOTPTooFrequent", err)
+	}
+
+	if err := s.VerifyCode(ctx, phone, "xxxxxx"); !errors.Is(err, domain.ErrOTPInvalid) {
+		t.Errorf("wrong code: err = %v, want ErrOTPInvalid", err)
+	}
+	if err := s.VerifyCode(ctx, phone, code); err != nil {
+		t.Fatalf("VerifyCode: %v", err)
+	}
+	if err := s.VerifyCode(ctx, phone, code); !errors.Is(err, domain.ErrOTPExpired) {
+		t.Errorf("reuse code: err = %v, want ErrOTPExpired", err)
+	}
+
+	// 输错次数达到上限后, 正确的验证码也不能再使用
+	mr.FastForward(time.Minute)
+	if err := s.SendCode(ctx, phone, "10.0.0.1"); err != nil {
+		t.Fatalf("SendCode: %v", err)
+	}
+	code = provider.codes[phone]
+	_ = s.VerifyCode(ctx, phone, "000000x")
+	_ = s.VerifyCode(ctx, phone, "000000y")
+	if err := s.VerifyCode(ctx, phone, "000000z"); !errors.Is(err, domain.ErrOTPAttemptsExceeded) {
+		t.Errorf("third wrong code: err = %v, want ErrOTPAttemptsExceeded", err)
+	}
+	if err := s.VerifyCode(ctx, phone, code); !errors.Is(err, domain.ErrOTPExpired) {
+		t.Errorf("code after lockout: err = %v, want ErrOTPExpired", err)
+	}
+}
+
+func TestSmsService_DailyQuota(t *testing.T) {
+	s, _, mr := newTestSmsService(t, conf.SMSConf{Secret: "secret", PhoneDailyLimit: 2, IPDailyLimit: 3})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.SendCode(ctx, "13800138000", "10.0.0.1"); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		mr.FastForward(time.Minute)
+	}
+	if err := s.SendCode(ctx, "13800138000", "10.0.0.2"); !errors.Is(err, domain.ErrSmsPhoneQuota) {
+		t.Errorf("phone quota: err = %v, want ErrSmsPhoneQuota", err)
+	}
+
+	if err := s.SendCode(ctx, "13800138001", "10.0.0.1"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := s.SendCode(ctx, "13800138002", "10.0.0.1"); !errors.Is(err, domain.ErrSmsIPQuota) {
+		t.Errorf("ip quota: err = %v, want ErrSmsIPQuota", err)
+	}
+}
+
+func TestSmsService_RefundOnSendFailure(t *testing.T) {
+	s, provider, _ := newTestSmsService(t, conf.SMSConf{Secret: "secret", PhoneDailyLimit: 1})
+	ctx := context.Background()
+	const phone = "13800138000"
+
+	// 发送失败不占用发送间隔和每日额度, 可以立即重试
+	provider.failing = true
+	if err := s.SendCode(ctx, phone, "10.0.0.1"); err == nil {
+		t.Fatal("SendCode with failing provider succeeded")
+	}
+	provider.failing = false
+	if err := s.SendCode(ctx, phone, "10.0.0.1"); err != nil {
+		t.Errorf("retry after failure: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/internal/search"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/repo"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SuggestService 搜索联想、热门搜索和最近搜索
+type SuggestService interface {
+	// Suggest 返回输入前缀的联想词, 来自商品标题、品牌和分类名称
+	Suggest(ctx context.Context, prefix string, limit int) ([]domain.Suggestion, error)
+
+	// Record 记录一次搜索及结果数, 无结果的搜索词单独统计供运营查看
+	Record(ctx context.Context, userID int64, query string, hits int64)
+
+	// Hot 返回最近一周的热门搜索词
+	Hot(ctx context.Context, limit int) ([]domain.SearchQueryStat, error)
+
+	// ZeroResults 返回最近 days 天的无结果搜索词
+	ZeroResults(ctx context.Context, days, limit int) ([]domain.SearchQueryStat, error)
+
+	// Recent 返回用户最近的搜索词
+	Recent(ctx context.Context, userID int64) ([]string, error)
+
+	// DeleteRecent 删除用户的一条最近搜索, query 为空时清空
+	DeleteRecent(ctx context.Context, userID int64, query string) error
+
+	// RebuildSuggestions 从数据库重建联想词库, 返回词数
+	RebuildSuggestions(ctx context.Context) (int, error)
+
+	// Run 定期重建联想词库, 直到 ctx 取消
+	Run(ctx context.Context)
+}
+
+const (
+	defaultSuggestLimit   = 10
+	maxSuggestLimit       = 20
+	defaultHotSearchLimit = 10
+	hotSearchDays         = 7
+	maxZeroResultDays     = 30
+	recentSearchLimit     = 20
+	maxSearchQueryLen     = 50
+	suggestRebuildPeriod  = 10 * time.Minute
+)
+
+type SuggestServiceImpl struct {
+	productRepo repo.ProductRepo
+	logRepo     repo.SearchLogRepo
+	suggester   *search.Suggester
+	now         func() time.Time
+}
+
+func NewSuggestService(productRepo repo.ProductRepo, logRepo repo.SearchLogRepo) *SuggestServiceImpl {
+	return &SuggestServiceImpl{
+		productRepo: productRepo,
+		logRepo:     logRepo,
+		suggester:   search.NewSuggester(),
+		now:         time.Now,
+	}
+}
+
+// clampLimit 未指定时使用默认值, 超过上限时取上限
+func clampLimit(limit, def, max int) int {
+	if limit <= 0 {
+		return def
+	}
+	return min(limit, max)
+}
+
+// normalizeQuery 合并连续空白, 英文转小写, 过长时截断
+func normalizeQuery(query string) string {
+	query = strings.ToLower(strings.Join(strings.Fields(query), " "))
+	if utf8.RuneCountInString(query) > maxSearchQueryLen {
+		query = string([]rune(query)[:maxSearchQueryLen])
+	}
+	return query
+}
+
+func (s *SuggestServiceImpl) Suggest(ctx context.Context, prefix string, limit int) ([]domain.Suggestion, error) {
+	return s.suggester.Suggest(prefix, clampLimit(limit, defaultSuggestLimit, maxSuggestLimit)), nil
+}
+
+func (s *SuggestServiceImpl) Record(ctx context.Context, userID int64, query string, hits int64) {
+	query = normalizeQuery(query)
+	if query == "" {
+		return
+	}
+	if hits == 0 {
+		log.AppLogger.Infof("搜索无结果 (user: %d): %q", userID, query)
+	}
+	if err := s.logRepo.Record(ctx, userID, query, hits, s.now(), recentSearchLimit); err != nil {
+		log.AppLogger.Warnf("记录搜索词失败: %v", err)
+	}
+}
+
+func (s *SuggestServiceImpl) Hot(ctx context.Context, limit int) ([]domain.SearchQueryStat, error) {
+	return s.logRepo.Hot(ctx, s.now(), hotSearchDays, clampLimit(limit, defaultHotSearchLimit, maxSuggestLimit))
+}
+
+func (s *SuggestServiceImpl) ZeroResults(ctx context.Context, days, limit int) ([]domain.SearchQueryStat, error) {
+	return s.logRepo.ZeroResults(ctx, s.now(), clampLimit(days, hotSearchDays, maxZeroResultDays), clampLimit(limit, defaultSearchPageSize, maxSearchPageSize))
+}
+
+func (s *SuggestServiceImpl) Recent(ctx context.Context, userID int64) ([]string, error) {
+	return s.logRepo.Recent(ctx, userID, recentSearchLimit)
+}
+
+func (s *SuggestServiceImpl) DeleteRecent(ctx context.Context, userID int64, query string) error {
+	if query = normalizeQuery(query); query == "" {
+		return s.logRepo.ClearRecent(ctx, userID)
+	}
+	return s.logRepo.DeleteRecent(ctx, userID, query)
+}
+
+// RebuildSuggestions 商品标题按销量加权, 品牌和分类按在售商品数加权
+func (s *SuggestServiceImpl) RebuildSuggestions(ctx context.Context) (int, error) {
+	var terms []search.SuggestTerm
+	brands := make(map[string]int64)
+	cateCounts := make(map[int64]int64)
+	var afterID int64
+	for {
+		products, err := s.productRepo.ListForIndex(ctx, afterID, search.ReindexBatchSize)
+		if err != nil {
+			return 0, err
+		}
+		if len(products) == 0 {
+			break
+		}
+		for _, p := range products {
+			terms = append(terms, search.SuggestTerm{Text: p.Title, Kind: domain.SuggestTitle, Weight: p.PurchaseCount})
+			brands[p.Brand]++
+			cateCounts[p.CateID]++
+		}
+		afterID = products[len(products)-1].ID
+	}
+	for brand, n := range brands {
+		terms = append(terms, search.SuggestTerm{Text: brand, Kind: domain.SuggestBrand, Weight: n})
+	}
+
+	cates, err := s.productRepo.ListCates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range cates {
+		terms = append(terms, search.SuggestTerm{Text: c.Title, Kind: domain.SuggestCategory, Weight: cateCounts[int64(c.ID)]})
+	}
+	return s.suggester.Build(terms), nil
+}
+
+func (s *SuggestServiceImpl) Run(ctx context.Context) {
+	rebuild := func() {
+		if n, err := s.RebuildSuggestions(ctx); err != nil {
+			log.AppLogger.Errorf("重建搜索联想词库失败: %v", err)
+		} else {
+			log.AppLogger.Debugf("搜索联想词库已重建, 共 %d 个词", n)
+		}
+	}
+	rebuild()
+
+	ticker := time.NewTicker(suggestRebuildPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rebuild()
+		}
+	}
+}
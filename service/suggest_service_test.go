@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestSuggestService(t *testing.T) *SuggestServiceImpl {
+	mr := miniredis.RunT(t)
+	catalog := &fakeCatalogRepo{products: []*domain.Product{
+		{ID: 1, Title: "蓝牙耳机", Brand: "星辰", CateID: 11, PurchaseCount: 30},
+		{ID: 2, Title: "蓝牙音箱", Brand: "星辰", CateID: 12, PurchaseCount: 90},
+	}}
+	s := NewSuggestService(catalog, repo.NewSearchLogRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()})))
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestSuggestService_Suggest(t *testing.T) {
+	s := newTestSuggestService(t)
+	ctx := context.Background()
+	if n, err := s.RebuildSuggestions(ctx); err != nil || n != 5 {
+		t.Fatalf("RebuildSuggestions = %d, %v, want 5 terms", n, err)
+	}
+
+	got, _ := s.Suggest(ctx, "ly", 0)
+	want := []domain.Suggestion{{Text: "蓝牙音箱", Kind: domain.SuggestTitle}, {Text: "蓝牙耳机", Kind: domain.SuggestTitle}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Suggest(ly) = %v, want %v", got, want)
+	}
+	got, _ = s.Suggest(ctx, "yinx", 0)
+	if !slices.Contains(got, domain.Suggestion{Text: "音箱", Kind: domain.SuggestCategory}) {
+		t.Errorf("Suggest(yinx) = %v, want category 音箱", got)
+	}
+}
+
+func TestSuggestService_History(t *testing.T) {
+	s := newTestSuggestService(t)
+	ctx := context.Background()
+
+	s.Record(ctx, 7, "  蓝牙   耳机 ", 3)
+	s.now = func() time.Time { return time.Date(2025, 6, 10, 12, 1, 0, 0, time.Local) }
+	s.Record(ctx, 7, "iPhone", 5)
+	s.Record(ctx, 8, "iphone", 5)
+	s.Record(ctx, 8, "不存在的商品", 0)
+	// 前一天的搜索也计入热门
+	s.now = func() time.Time { return time.Date(2025, 6, 9, 12, 0, 0, 0, time.Local) }
+	s.Record(ctx, 0, "蓝牙 耳机", 1)
+	s.Record(ctx, 0, "蓝牙 耳机", 1)
+	s.now = func() time.Time { return time.Date(2025, 6, 10, 13, 0, 0, 0, time.Local) }
+
+	hot, err := s.Hot(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHot := []domain.SearchQueryStat{{Query: "蓝牙 耳机", Count: 3}, {Query: "iphone", Count: 2}}
+	if !slices.Equal(hot, wantHot) {
+		t.Errorf("Hot = %v, want %v", hot, wantHot)
+	}
+	zero, _ := s.ZeroResults(ctx, 1, 0)
+	if !slices.Equal(zero, []domain.SearchQueryStat{{Query: "不存在的商品", Count: 1}}) {
+		t.Errorf("ZeroResults = %v", zero)
+	}
+
+	recent, _ := s.Recent(ctx, 7)
+	if !slices.Equal(recent, []string{"iphone", "蓝牙 耳机"}) {
+		t.Errorf("Recent = %v", recent)
+	}
+	if err = s.DeleteRecent(ctx, 7, "IPhone"); err != nil {
+		t.Fatal(err)
+	}
+	if recent, _ = s.Recent(ctx, 7); !slices.Equal(recent, []string{"蓝牙 耳机"}) {
+		t.Errorf("Recent after delete = %v", recent)
+	}
+	if err = s.DeleteRecent(ctx, 7, ""); err != nil {
+		t.Fatal(err)
+	}
+	if recent, _ = s.Recent(ctx, 7); len(recent) != 0 {
+		t.Errorf("Recent after clear = %v", recent)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/jwt"
+	"github.com/star-find-cloud/star-mall/repo"
+	"slices"
+	"strings"
+)
+
+type TokenService interface {
+	// Issue 为登录成功的身份创建会话, 返回访问 token 和刷新 token
+	Issue(ctx context.Context, userID int64, userName string, role int64) (*domain.TokenPair, error)
+
+	// Refresh 使用刷新 token 换取新的 token, 旧的刷新 token 随即失效.
+	// 已被使用过的刷新 token 再次出现时视为泄露, 整个会话被注销. 会话角色不在 roles 中时拒绝刷新
+	Refresh(ctx context.Context, refreshToken string, roles ...int64) (*domain.TokenPair, error)
+
+	// Revoke 注销访问 token 及其所属会话
+	Revoke(ctx context.Context, claims *jwt.CustomClaims) error
+
+	// RevokeAll 注销用户的全部会话, 用于修改密码、封禁等场景
+	RevokeAll(ctx context.Context, role, userID int64) error
+
+	// CheckToken 检查访问 token 是否已注销, 已注销返回 domain.ErrTokenRevoked
+	CheckToken(ctx context.Context, claims *jwt.CustomClaims) error
+}
+
+type TokenServiceImpl struct {
+	repo repo.TokenRepo
+}
+
+func NewTokenService(repo repo.TokenRepo) *TokenServiceImpl {
+	return &TokenServiceImpl{repo: repo}
+}
+
+func (s *TokenServiceImpl) Issue(ctx context.Context, userID int64, userName string, role int64) (*domain.TokenPair, error) {
+	session := &domain.TokenSession{
+		ID:       uuid.NewString(),
+		UserID:   userID,
+		UserName: userName,
+		Role:     role,
+	}
+	refreshToken, refreshHash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.repo.CreateSession(ctx, session, refreshHash, jwt.RefreshTokenExpireDuration); err != nil {
+		return nil, err
+	}
+	return newTokenPair(session, refreshToken)
+}
+
+func (s *TokenServiceImpl) Refresh(ctx context.Context, refreshToken string, roles ...int64) (*domain.TokenPair, error) {
+	sessionID, _, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" {
+		return nil, domain.ErrRefreshTokenInvalid
+	}
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(roles, session.Role) {
+		return nil, domain.ErrRefreshTokenInvalid
+	}
+
+	newToken, newHash, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.repo.RotateRefresh(ctx, session, hashRefreshToken(refreshToken), newHash, jwt.RefreshTokenExpireDuration); err != nil {
+		return nil, err
+	}
+	return newTokenPair(session, newToken)
+}
+
+func (s *TokenServiceImpl) Revoke(ctx context.Context, claims *jwt.CustomClaims) error {
+	if err := s.repo.Deny(ctx, claims.ID, claims.TTL()); err != nil {
+		return err
+	}
+	if claims.SessionID == "" {
+		return nil
+	}
+	return s.repo.DeleteSession(ctx, &domain.TokenSession{
+		ID:     claims.SessionID,
+		UserID: claims.UserID,
+		Role:   claims.Roles,
+	})
+}
+
+func (s *TokenServiceImpl) RevokeAll(ctx context.Context, role, userID int64) error {
+	return s.repo.DeleteUserSessions(ctx, role, userID)
+}
+
+func (s *TokenServiceImpl) CheckToken(ctx context.Context, claims *jwt.CustomClaims) error {
+	// 访问 token 都属于登录会话, 没有会话的 token 无法随修改密码、注销账号一起吊销, 直接拒绝
+	if claims.Purpose == "" && claims.SessionID == "" {
+		return domain.ErrTokenRevoked
+	}
+	revoked, err := s.repo.IsRevoked(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return domain.ErrTokenRevoked
+	}
+	return nil
+}
+
+func newTokenPair(session *domain.TokenSession, refreshToken string) (*domain.TokenPair, error) {
+	accessToken, err := jwt.GenerateSessionToken(session.UserID, session.UserName, session.Role, session.ID)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(jwt.TokenExpireDuration.Seconds()),
+	}, nil
+}
+
+// newRefreshToken 生成 "会话ID.随机串" 格式的刷新 token, Redis 中只保存其摘要
+func newRefreshToken(sessionID string) (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", errors.New("failed to generate refresh token")
+	}
+	token := sessionID + "." + base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
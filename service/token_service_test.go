@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/jwt"
+	"github.com/star-find-cloud/star-mall/repo"
+	"testing"
+)
+
+func newTestTokenService(t *testing.T) *TokenServiceImpl {
+	keys, err := jwt.NewKeySet(conf.JWTConf{}, "test-secret")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	jwt.SetKeySet(keys)
+
+	mr := miniredis.RunT(t)
+	return NewTokenService(repo.NewTokenRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()})))
+}
+
+func mustParse(t *testing.T, token string) *jwt.CustomClaims {
+	t.Helper()
+	claims, err := jwt.ParseToken(token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	return claims
+}
+
+func TestTokenService_RefreshRotation(t *testing.T) {
+	s := newTestTokenService(t)
+	ctx := context.Background()
+
+	first, err := s.Issue(ctx, 1, "alice", _const.UserRole)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims := mustParse(t, first.AccessToken)
+	if claims.SessionID == "" || claims.ID == "" {
+		t.Fatalf("access token missing sid or jti: %+v", claims)
+	}
+	if _, err = s.Refresh(ctx, first.RefreshToken, _const.AdminRole); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Fatalf("refresh with other role: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	second, err := s.Refresh(ctx, first.RefreshToken, _const.UserRole)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	if sid := mustParse(t, second.AccessToken).SessionID; sid != claims.SessionID {
+		t.Errorf("rotated access token sid = %s, want %s", sid, claims.SessionID)
+	}
+
+	// 重放已轮换的刷新 token, 整个会话被注销
+	if _, err = s.Refresh(ctx, first.RefreshToken, _const.UserRole); !errors.Is(err, domain.ErrRefreshTokenReused) {
+		t.Fatalf("reuse: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err = s.Refresh(ctx, second.RefreshToken, _const.UserRole); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Errorf("refresh after reuse: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if err = s.CheckToken(ctx, mustParse(t, second.AccessToken)); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("access token after reuse: err = %v, want ErrTokenRevoked", err)
+	}
+
+	// 伪造的刷新 token 不影响会话
+	third, _ := s.Issue(ctx, 1, "alice", _const.UserRole)
+	forged := mustParse(t, third.AccessToken).SessionID + ".forged"
+	if _, err = s.Refresh(ctx, forged, _const.UserRole); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Errorf("forged: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if _, err = s.Refresh(ctx, third.RefreshToken, _const.UserRole); err != nil {
+		t.Errorf("refresh after forged attempt: %v", err)
+	}
+}
+
+func TestTokenService_Revoke(t *testing.T) {
+	s := newTestTokenService(t)
+	ctx := context.Background()
+
+	pair, _ := s.Issue(ctx, 1, "alice", _const.UserRole)
+	other, _ := s.Issue(ctx, 1, "alice", _const.UserRole)
+	claims := mustParse(t, pair.AccessToken)
+	if err := s.CheckToken(ctx, claims); err != nil {
+		t.Fatalf("CheckToken before logout: %v", err)
+	}
+
+	if err := s.Revoke(ctx, claims); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := s.CheckToken(ctx, claims); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("CheckToken after logout: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := s.Refresh(ctx, pair.RefreshToken, _const.UserRole); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Errorf("refresh after logout: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if err := s.CheckToken(ctx, mustParse(t, other.AccessToken)); err != nil {
+		t.Errorf("other session revoked by logout: %v", err)
+	}
+
+	// 两步验证中间凭证没有会话, 只能通过 jti 黑名单注销
+	mfa, _ := jwt.GenerateMFAToken(2, "merchant", _const.MerchantRole)
+	mfaClaims := mustParse(t, mfa)
+	if err := s.CheckToken(ctx, mfaClaims); err != nil {
+		t.Errorf("mfa token: %v", err)
+	}
+	_ = s.Revoke(ctx, mfaClaims)
+	if err := s.CheckToken(ctx, mfaClaims); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("mfa token after revoke: err = %v, want ErrTokenRevoked", err)
+	}
+	// 没有会话的访问 token 无法吊销, 直接拒绝
+	if err := s.CheckToken(ctx, &jwt.CustomClaims{UserID: 2, Roles: _const.MerchantRole}); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("sessionless token: err = %v, want ErrTokenRevoked", err)
+	}
+
+	// 修改密码后全部会话失效, 其他用户不受影响
+	bob, _ := s.Issue(ctx, 3, "bob", _const.UserRole)
+	if err := s.RevokeAll(ctx, _const.UserRole, 1); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	if err := s.CheckToken(ctx, mustParse(t, other.AccessToken)); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("CheckToken after RevokeAll: err = %v, want ErrTokenRevoked", err)
+	}
+	if err := s.CheckToken(ctx, mustParse(t, bob.AccessToken)); err != nil {
+		t.Errorf("other user revoked: %v", err)
+	}
+}
+
+func TestTokenService_MerchantSession(t *testing.T) {
+	s := newTestTokenService(t)
+	ctx := context.Background()
+
+	// 商家会话可以通过用户接口刷新, 不能通过管理员接口刷新
+	pair, _ := s.Issue(ctx, 2, "shop", _const.MerchantRole)
+	if _, err := s.Refresh(ctx, pair.RefreshToken, _const.AdminRole); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Fatalf("refresh merchant as admin: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	refreshed, err := s.Refresh(ctx, pair.RefreshToken, _const.UserRole, _const.MerchantRole)
+	if err != nil {
+		t.Fatalf("refresh merchant: %v", err)
+	}
+
+	// 按商家角色吊销全部会话
+	if err = s.RevokeAll(ctx, _const.MerchantRole, 2); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	if err = s.CheckToken(ctx, mustParse(t, refreshed.AccessToken)); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("merchant token after RevokeAll: err = %v, want ErrTokenRevoked", err)
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/pkg/totp"
+	"github.com/star-find-cloud/star-mall/repo"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTOTPIssuer = "star-Mall"
+	// totpSkew 允许前后各一个时间步的时钟偏差
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+type TOTPService interface {
+	// Enroll 生成新的密钥并返回 otpauth URI, 激活前可重复调用, 以最后一次为准
+	Enroll(ctx context.Context, userID int64, account string) (*domain.TOTPEnrollment, error)
+
+	// Activate 校验首个验证码后启用两步验证, 返回只展示一次的恢复码
+	Activate(ctx context.Context, userID int64, code string) ([]string, error)
+
+	// Disable 使用验证码或恢复码关闭两步验证
+	Disable(ctx context.Context, userID int64, code string) error
+
+	// Enabled 用户是否已启用两步验证
+	Enabled(ctx context.Context, userID int64) (bool, error)
+
+	// Verify 校验验证码或恢复码, 每个验证码和恢复码只能使用一次.
+	// 失败次数按用户计入登录保护, 达到阈值后等待或锁定, 防止持有访问 token 时暴力尝试验证码
+	Verify(ctx context.Context, userID int64, code string) error
+
+	// Require 已启用两步验证的用户执行敏感操作时必须提供新的验证码, 未启用时直接通过
+	Require(ctx context.Context, userID int64, code string) error
+}
+
+type TOTPServiceImpl struct {
+	repo   repo.TOTPRepo
+	guard  LoginGuardService
+	issuer string
+	aead   cipher.AEAD
+}
+
+// NewTOTPService guard 为 nil 时不限制验证失败次数
+func NewTOTPService(repo repo.TOTPRepo, guard LoginGuardService, c conf.SecurityConf) *TOTPServiceImpl {
+	if c.TOTPIssuer == "" {
+		c.TOTPIssuer = defaultTOTPIssuer
+	}
+	if c.TOTPKey == "" {
+		log.AppLogger.Warnln("security.totp_key is empty, totp secrets are encrypted with an empty key")
+	}
+	key := sha256.Sum256([]byte(c.TOTPKey))
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+	return &TOTPServiceImpl{repo: repo, guard: guard, issuer: c.TOTPIssuer, aead: aead}
+}
+
+func (s *TOTPServiceImpl) Enroll(ctx context.Context, userID int64, account string) (*domain.TOTPEnrollment, error) {
+	current, err := s.repo.Get(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if current != nil && current.Enabled {
+		return nil, domain.ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.repo.SavePending(ctx, userID, sealed); err != nil {
+		return nil, err
+	}
+	return &domain.TOTPEnrollment{Secret: secret, URI: totp.URI(s.issuer, account, secret)}, nil
+}
+
+func (s *TOTPServiceImpl) Activate(ctx context.Context, userID int64, code string) ([]string, error) {
+	current, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrTOTPNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current.Enabled {
+		return nil, domain.ErrTOTPAlreadyEnabled
+	}
+
+	step, err := s.validate(current, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err = s.repo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	log.SecurityLogger.Infof("totp enabled, user id: %d", userID)
+	return codes, nil
+}
+
+func (s *TOTPServiceImpl) Disable(ctx context.Context, userID int64, code string) error {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, userID); err != nil {
+		return err
+	}
+	log.SecurityLogger.Infof("totp disabled, user id: %d", userID)
+	return nil
+}
+
+func (s *TOTPServiceImpl) Enabled(ctx context.Context, userID int64) (bool, error) {
+	current, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return current.Enabled, nil
+}
+
+func (s *TOTPServiceImpl) Verify(ctx context.Context, userID int64, code string) error {
+	if s.guard == nil {
+		return s.verify(ctx, userID, code)
+	}
+	account := guardTOTP(userID)
+	if err := s.guard.Check(ctx, account, ""); err != nil {
+		return err
+	}
+	err := s.verify(ctx, userID, code)
+	if errors.Is(err, domain.ErrTOTPInvalid) {
+		if blocked := s.guard.Fail(ctx, account, ""); blocked != nil {
+			return blocked
+		}
+		return err
+	}
+	if err == nil {
+		s.guard.Succeed(ctx, account)
+	}
+	return err
+}
+
+func (s *TOTPServiceImpl) verify(ctx context.Context, userID int64, code string) error {
+	current, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !current.Enabled) {
+		return domain.ErrTOTPNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, err := s.validate(current, code)
+		if err != nil {
+			return err
+		}
+		// 同一时间步的验证码只能使用一次
+		ok, err := s.repo.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.SecurityLogger.Warnf("totp code replayed, user id: %d", userID)
+			return domain.ErrTOTPInvalid
+		}
+		return nil
+	}
+
+	ok, err := s.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrTOTPInvalid
+	}
+	log.SecurityLogger.Infof("totp recovery code used, user id: %d", userID)
+	return nil
+}
+
+func (s *TOTPServiceImpl) Require(ctx context.Context, userID int64, code string) error {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil || !enabled {
+		return err
+	}
+	if code == "" {
+		return domain.ErrTOTPRequired
+	}
+	return s.Verify(ctx, userID, code)
+}
+
+func (s *TOTPServiceImpl) validate(current *domain.UserTOTP, code string) (int64, error) {
+	secret, err := s.open(current.Secret)
+	if err != nil {
+		log.AppLogger.Errorf("decrypt totp secret failed, user id: %d, err: %v", current.UserID, err)
+		return 0, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return 0, domain.ErrTOTPInvalid
+	}
+	return step, nil
+}
+
+// seal 使用 AES-GCM 加密密钥, 结果为 base64(nonce + 密文)
+func (s *TOTPServiceImpl) seal(secret string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (s *TOTPServiceImpl) open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", errors.New("invalid totp secret")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+	return string(plain), nil
+}
+
+// newRecoveryCode 生成形如 abcd-efgh 的恢复码
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// hashRecoveryCode 忽略大小写和分隔符后计算摘要
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTOTPRepo 在内存中保存 TOTP 配置和恢复码
+type fakeTOTPRepo struct {
+	totps     map[int64]*domain.UserTOTP
+	recovery  map[string]bool
+	lastSaved string
+}
+
+func (r *fakeTOTPRepo) Get(ctx context.Context, userID int64) (*domain.UserTOTP, error) {
+	if t, ok := r.totps[userID]; ok {
+		copied := *t
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeTOTPRepo) SavePending(ctx context.Context, userID int64, secret string) error {
+	if t, ok := r.totps[userID]; ok && t.Enabled {
+		return nil
+	}
+	r.lastSaved = secret
+	r.totps[userID] = &domain.UserTOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *fakeTOTPRepo) Enable(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	t := r.totps[userID]
+	t.Enabled, t.LastStep = true, step
+	r.recovery = make(map[string]bool)
+	for _, hash := range recoveryHashes {
+		r.recovery[hash] = false
+	}
+	return nil
+}
+
+func (r *fakeTOTPRepo) UseStep(ctx context.Context, userID, step int64) (bool, error) {
+	t := r.totps[userID]
+	if step <= t.LastStep {
+		return false, nil
+	}
+	t.LastStep = step
+	return true, nil
+}
+
+func (r *fakeTOTPRepo) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	used, ok := r.recovery[codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.recovery[codeHash] = true
+	return true, nil
+}
+
+func (r *fakeTOTPRepo) Delete(ctx context.Context, userID int64) error {
+	delete(r.totps, userID)
+	r.recovery = nil
+	return nil
+}
+
+func TestTOTPService_Lifecycle(t *testing.T) {
+	totpRepo := &fakeTOTPRepo{totps: make(map[int64]*domain.UserTOTP)}
+	s := NewTOTPService(totpRepo, nil, conf.SecurityConf{TOTPIssuer: "star", TOTPKey: "key"})
+	ctx := context.Background()
+	const userID = 1000001
+
+	if err := s.Require(ctx, userID, ""); err != nil {
+		t.Fatalf("Require before enrol err = %v", err)
+	}
+
+	enrollment, err := s.Enroll(ctx, userID, "alice")
+	if err != nil {
+		t.Fatalf("Enroll err = %v", err)
+	}
+	// 数据库中只保存加密后的密钥
+	if totpRepo.lastSaved == enrollment.Secret {
+		t.Error("secret stored in plain text")
+	}
+
+	if _, err = s.Activate(ctx, userID, "abcdef"); !errors.Is(err, domain.ErrTOTPInvalid) {
+		t.Fatalf("Activate(wrong) err = %v", err)
+	}
+	now := totp.Step(time.Now())
+	prev, _ := totp.Code(enrollment.Secret, now-1)
+	codes, err := s.Activate(ctx, userID, prev)
+	if err != nil {
+		t.Fatalf("Activate err = %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("recovery codes = %d, want %d", len(codes), recoveryCodeCount)
+	}
+	if _, err = s.Enroll(ctx, userID, "alice"); !errors.Is(err, domain.ErrTOTPAlreadyEnabled) {
+		t.Errorf("Enroll after activate err = %v, want %v", err, domain.ErrTOTPAlreadyEnabled)
+	}
+
+	if err = s.Require(ctx, userID, ""); !errors.Is(err, domain.ErrTOTPRequired) {
+		t.Errorf("Require without code err = %v, want %v", err, domain.ErrTOTPRequired)
+	}
+	// 激活使用的时间步不能再次使用
+	if err = s.Verify(ctx, userID, prev); !errors.Is(err, domain.ErrTOTPInvalid) {
+		t.Errorf("Verify(replayed) err = %v, want %v", err, domain.ErrTOTPInvalid)
+	}
+	current, _ := totp.Code(enrollment.Secret, now)
+	if err = s.Require(ctx, userID, current); err != nil {
+		t.Errorf("Require(current) err = %v", err)
+	}
+	if err = s.Verify(ctx, userID, current); !errors.Is(err, domain.ErrTOTPInvalid) {
+		t.Errorf("Verify(reused) err = %v, want %v", err, domain.ErrTOTPInvalid)
+	}
+
+	// 恢复码忽略大小写和分隔符, 只能使用一次
+	if err = s.Verify(ctx, userID, " "+strings.ToUpper(codes[0])+" "); err != nil {
+		t.Errorf("Verify(recovery) err = %v", err)
+	}
+	if err = s.Verify(ctx, userID, codes[0]); !errors.Is(err, domain.ErrTOTPInvalid) {
+		t.Errorf("Verify(used recovery) err = %v, want %v", err, domain.ErrTOTPInvalid)
+	}
+
+	if err = s.Disable(ctx, userID, codes[1]); err != nil {
+		t.Fatalf("Disable err = %v", err)
+	}
+	if enabled, _ := s.Enabled(ctx, userID); enabled {
+		t.Error("totp still enabled after disable")
+	}
+}
+
+func TestTOTPService_AttemptLimit(t *testing.T) {
+	guard, _ := newTestLoginGuard(t, conf.SecurityConf{DelayAfter: 10, AccountMaxFailures: 3})
+	s := NewTOTPService(&fakeTOTPRepo{totps: make(map[int64]*domain.UserTOTP)}, guard, conf.SecurityConf{TOTPKey: "key"})
+	ctx := context.Background()
+	const userID = 1000002
+
+	enrollment, _ := s.Enroll(ctx, userID, "alice")
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	codes, err := s.Activate(ctx, userID, code)
+	if err != nil {
+		t.Fatalf("Activate err = %v", err)
+	}
+
+	// 持有访问 token 也不能无限尝试关闭两步验证
+	for i := 0; i < 2; i++ {
+		if err = s.Disable(ctx, userID, "wrong-code"); !errors.Is(err, domain.ErrTOTPInvalid) {
+			t.Fatalf("Disable(wrong) #%d err = %v, want %v", i+1, err, domain.ErrTOTPInvalid)
+		}
+	}
+	if err = s.Disable(ctx, userID, "wrong-code"); !errors.Is(err, domain.ErrLoginLocked) {
+		t.Fatalf("Disable(wrong) #3 err = %v, want %v", err, domain.ErrLoginLocked)
+	}
+	if err = s.Require(ctx, userID, codes[0]); !errors.Is(err, domain.ErrLoginLocked) {
+		t.Errorf("Require while locked err = %v, want %v", err, domain.ErrLoginLocked)
+	}
+
+	// 解除锁定后恢复
+	if err = guard.Unlock(ctx, domain.GuardKindAccount, guardTOTP(userID)); err != nil {
+		t.Fatalf("Unlock err = %v", err)
+	}
+	if err = s.Disable(ctx, userID, codes[0]); err != nil {
+		t.Errorf("Disable after unlock err = %v", err)
+	}
+}
@@ -2,14 +2,21 @@ package service
 
 import (
 	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
 	"github.com/star-find-cloud/star-mall/domain"
 	"github.com/star-find-cloud/star-mall/pkg/jwt"
 	log "github.com/star-find-cloud/star-mall/pkg/logger"
 	"github.com/star-find-cloud/star-mall/repo"
 	"github.com/star-find-cloud/star-mall/utils"
 	"golang.org/x/net/context"
+	"strconv"
+	"strings"
 )
 
+// defaultEmailCodeMaxAttempts 邮箱验证码默认允许输错的次数
+const defaultEmailCodeMaxAttempts = 5
+
 type UserService interface {
 	// GetByID 根据id获取用户元数据
 	GetByID(ctx context.Context, id int64) (*domain.User, error)
@@ -17,47 +24,72 @@ type UserService interface {
 	// Create 创建用户
 	Create(ctx context.Context, user *domain.User) (int64, error)
 
-	// LoginByID 根据id和密码登录
-	LoginByID(ctx context.Context, id int64, password string) (string, int64, error)
+	// LoginByID 根据id和密码登录, 账号和 IP 连续失败过多时会被限制
+	LoginByID(ctx context.Context, id int64, password, ip string) (*domain.TokenPair, int64, error)
+
+	// LoginByEmail 根据邮箱和密码登录, 账号和 IP 连续失败过多时会被限制
+	LoginByEmail(ctx context.Context, email, password, ip string) (*domain.TokenPair, int64, error)
+
+	// Register 注册用户, 商家账号审核通过前不签发 token
+	Register(ctx context.Context, user *domain.User) (*domain.TokenPair, int64, error)
+
+	// LoginWithTOTP 两步验证第二步, 使用密码登录返回的 MFAToken 和验证码(或恢复码)换取正式 token
+	LoginWithTOTP(ctx context.Context, mfaToken, code, ip string) (*domain.TokenPair, *domain.User, error)
+
+	// LoginByIdentity 第三方账号验证通过后登录, 同样检查封禁状态, 开启两步验证时只返回 MFAToken
+	LoginByIdentity(ctx context.Context, userID int64) (*domain.TokenPair, *domain.User, error)
 
-	// LoginByEmail 根据邮箱和密码登录
-	LoginByEmail(ctx context.Context, email, password string) (string, int64, error)
+	// LoginByPhone 使用手机号和短信验证码登录
+	LoginByPhone(ctx context.Context, phone, code string) (*domain.TokenPair, *domain.User, error)
 
-	// Register 注册用户
-	Register(ctx context.Context, user *domain.User) (string, int64, error)
+	// RegisterByPhone 使用手机号和短信验证码注册, 密码可以为空, 之后只能通过验证码登录
+	RegisterByPhone(ctx context.Context, user *domain.User, code string) (*domain.TokenPair, int64, error)
+
+	// Refresh 使用刷新 token 换取新的 token
+	Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error)
+
+	// Logout 退出登录, 注销当前 token 所属的会话
+	Logout(ctx context.Context, claims *jwt.CustomClaims) error
 
 	// Update 修改用户信息
 	Update(ctx context.Context, name, phone, email string, id int64, sex int) error
 
-	// UpdatePassword 修改密码
-	UpdatePassword(ctx context.Context, id int64, newPassword, oldPassword string) error
+	// UpdatePassword 修改密码, 修改后用户的全部会话失效
+	UpdatePassword(ctx context.Context, id int64, newPassword, oldPassword, totpCode string) error
 
 	// UpdateImage 修改用户头像
 	UpdateImage(ctx context.Context, userID int64, image *domain.Image) error
 
 	// UpdateEmail 修改邮箱
-	UpdateEmail(ctx context.Context, email string, verificationCode string, userID int64) error
-
-	// Delete 删除用户
-	Delete(ctx context.Context, id int64) error
+	UpdateEmail(ctx context.Context, email string, verificationCode string, userID int64, totpCode string) error
 
 	// CheckEmailVerificationCode 检查邮箱验证码
 	CheckEmailVerificationCode(ctx context.Context, email string, verificationCode string) (bool, error)
 
-	// ForgetPassword 忘记密码
-	ForgetPassword(ctx context.Context, email string, verificationCode string, newPassword string) error
+	// ForgetPassword 忘记密码, 重置后用户的全部会话失效
+	ForgetPassword(ctx context.Context, email string, verificationCode string, newPassword, totpCode string) error
 }
 
 type UserServiceImpl struct {
 	repo      repo.UserRepo
 	imageRepo repo.ImageRepo
+	tokens    TokenService
+	sms       SmsService
+	guard     LoginGuardService
+	totp      TOTPService
+	merchants MerchantService
 }
 
-func NewUserService(repo repo.UserRepo, imageRepo repo.ImageRepo) *UserServiceImpl {
+func NewUserService(repo repo.UserRepo, imageRepo repo.ImageRepo, tokens TokenService, sms SmsService, guard LoginGuardService, totp TOTPService, merchants MerchantService) *UserServiceImpl {
 	return &UserServiceImpl{
 		repo: repo,
 		//ossClient: oosClient,
 		imageRepo: imageRepo,
+		tokens:    tokens,
+		sms:       sms,
+		guard:     guard,
+		totp:      totp,
+		merchants: merchants,
 	}
 }
 
@@ -80,78 +112,276 @@ func (s *UserServiceImpl) GetUserByEmail(ctx context.Context, email string) (*do
 	return s.repo.GetByEmail(ctx, email)
 }
 
-func (s *UserServiceImpl) LoginByID(ctx context.Context, id int64, password string) (string, int64, error) {
+func (s *UserServiceImpl) LoginByID(ctx context.Context, id int64, password, ip string) (*domain.TokenPair, int64, error) {
 	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return "", 0, errors.New("user not found")
+		return nil, 0, s.loginFailed(ctx, guardAccount(id), ip, errors.New("user not found"))
 	}
+	return s.loginWithPassword(ctx, user, password, ip)
+}
 
-	userPassword, err := s.repo.GetPasswordByID(ctx, id)
+func (s *UserServiceImpl) LoginByEmail(ctx context.Context, email, password, ip string) (*domain.TokenPair, int64, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		// 不存在的邮箱同样计数, 避免被用来无限制地探测
+		return nil, 0, s.loginFailed(ctx, guardEmail(email), ip, errors.New("user not found"))
+	}
+	return s.loginWithPassword(ctx, user, password, ip)
+}
+
+// loginWithPassword 校验密码并签发令牌. 失败次数按用户 ID 统计, 使用 ID 和邮箱登录共享同一计数
+func (s *UserServiceImpl) loginWithPassword(ctx context.Context, user *domain.User, password, ip string) (*domain.TokenPair, int64, error) {
+	account := guardAccount(user.ID)
+	if err := s.guard.Check(ctx, account, ip); err != nil {
+		return nil, 0, err
+	}
+
+	userPassword, err := s.repo.GetPasswordByID(ctx, user.ID)
 	err = utils.CheckPasswordHash(password, userPassword)
 	if err != nil {
-		return "", 0, errors.New("invalid password")
+		return nil, 0, s.loginFailed(ctx, account, ip, errors.New("invalid password"))
+	}
+	if err = s.checkBanned(ctx, user.ID); err != nil {
+		return nil, 0, err
 	}
 
-	token, err := jwt.GenerateToken(user.ID, user.Name, user.RoleID)
+	token, err := s.issueLogin(ctx, user)
 	if err != nil {
-		return "", 0, errors.New("failed to generate token")
+		return nil, 0, err
+	}
+	// 需要两步验证时, 失败次数在验证码通过后才清除, 避免用正确的密码反复重置计数来猜验证码
+	if !token.MFARequired() {
+		s.guard.Succeed(ctx, account)
 	}
 	return token, user.RoleID, nil
 }
 
-func (s *UserServiceImpl) LoginByEmail(ctx context.Context, email, password string) (string, int64, error) {
-	user, err := s.repo.GetByEmail(ctx, email)
+// issueLogin 已启用两步验证的用户只签发两步验证凭证, 否则直接签发会话 token
+func (s *UserServiceImpl) issueLogin(ctx context.Context, user *domain.User) (*domain.TokenPair, error) {
+	if err := s.checkMerchant(ctx, user); err != nil {
+		return nil, err
+	}
+	enabled, err := s.totp.Enabled(ctx, user.ID)
 	if err != nil {
-		return "", 0, errors.New("user not found")
+		return nil, err
+	}
+	if !enabled {
+		return s.tokens.Issue(ctx, user.ID, user.Name, user.RoleID)
 	}
 
-	userPassword, err := s.repo.GetPasswordByID(ctx, user.ID)
-	err = utils.CheckPasswordHash(password, userPassword)
+	mfaToken, err := jwt.GenerateMFAToken(user.ID, user.Name, user.RoleID)
 	if err != nil {
-		return "", 0, errors.New("invalid password")
+		return nil, errors.New("failed to generate token")
 	}
+	return &domain.TokenPair{MFAToken: mfaToken, ExpiresIn: int64(jwt.MFATokenExpireDuration.Seconds())}, nil
+}
 
-	token, err := jwt.GenerateToken(user.ID, user.Name, user.RoleID)
+func (s *UserServiceImpl) LoginByIdentity(ctx context.Context, userID int64) (*domain.TokenPair, *domain.User, error) {
+	user, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
-		return "", 0, errors.New("failed to generate token")
+		return nil, nil, errors.New("user not found")
 	}
-	return token, user.RoleID, nil
+	if err = s.checkBanned(ctx, user.ID); err != nil {
+		return nil, nil, err
+	}
+	token, err := s.issueLogin(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, user, nil
+}
+
+func (s *UserServiceImpl) LoginWithTOTP(ctx context.Context, mfaToken, code, ip string) (*domain.TokenPair, *domain.User, error) {
+	claims, err := jwt.ParseToken(mfaToken)
+	if err != nil || claims.Purpose != jwt.PurposeMFA {
+		return nil, nil, domain.ErrMFATokenInvalid
+	}
+	if err = s.tokens.CheckToken(ctx, claims); err != nil {
+		if errors.Is(err, domain.ErrTokenRevoked) {
+			return nil, nil, domain.ErrMFATokenInvalid
+		}
+		return nil, nil, err
+	}
+
+	account := guardAccount(claims.UserID)
+	if err = s.guard.Check(ctx, account, ip); err != nil {
+		return nil, nil, err
+	}
+	if err = s.totp.Verify(ctx, claims.UserID, code); err != nil {
+		if errors.Is(err, domain.ErrTOTPInvalid) {
+			return nil, nil, s.loginFailed(ctx, account, ip, err)
+		}
+		return nil, nil, err
+	}
+	// 两步验证凭证只能使用一次
+	if err = s.tokens.Revoke(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+	s.guard.Succeed(ctx, account)
+
+	user, err := s.repo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+	if err = s.checkBanned(ctx, user.ID); err != nil {
+		return nil, nil, err
+	}
+	if err = s.checkMerchant(ctx, user); err != nil {
+		return nil, nil, err
+	}
+	token, err := s.tokens.Issue(ctx, user.ID, user.Name, user.RoleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, user, nil
+}
+
+// loginFailed 记录失败; 触发等待或锁定时返回对应错误, 否则返回原错误
+func (s *UserServiceImpl) loginFailed(ctx context.Context, account, ip string, err error) error {
+	if blocked := s.guard.Fail(ctx, account, ip); blocked != nil {
+		return blocked
+	}
+	return err
+}
+
+// checkMerchant 商家账号在商家审核通过后才能登录
+func (s *UserServiceImpl) checkMerchant(ctx context.Context, user *domain.User) error {
+	if user.RoleID != _const.MerchantRole {
+		return nil
+	}
+	return s.merchants.CheckApproved(ctx, user.ID)
+}
+
+func guardAccount(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// guardTOTP 两步验证码的失败次数单独计数, 登录以外的敏感操作同样受限
+func guardTOTP(userID int64) string {
+	return "totp:" + strconv.FormatInt(userID, 10)
+}
+
+// guardEmail 邮箱不存在时按邮箱记录登录失败
+func guardEmail(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// checkBanned 被管理员封禁的用户不能登录
+func (s *UserServiceImpl) checkBanned(ctx context.Context, id int64) error {
+	status, err := s.repo.GetStatusByID(ctx, id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if status == _const.AccountStatusBanned {
+		return domain.ErrAccountBanned
+	}
+	// 已注销的账号只保留匿名化后的记录, 不能再登录
+	if status == _const.StatusDeleted {
+		return errors.New("user not found")
+	}
+	return nil
 }
 
 // Register 注册用户函数 返回 token和用户id
-func (s *UserServiceImpl) Register(ctx context.Context, user *domain.User) (string, int64, error) {
+func (s *UserServiceImpl) Register(ctx context.Context, user *domain.User) (*domain.TokenPair, int64, error) {
 	// 验证用户邮箱是否合法
 	if !utils.VerifyEmail(user.Email) {
-		return "", 0, errors.New("email is not valid")
+		return nil, 0, errors.New("email is not valid")
 	}
 
 	// 检查用户邮箱是否存在
 	existingUser, _ := s.repo.GetByEmail(ctx, user.Email)
 	if existingUser != nil {
-		return "", 0, errors.New("email already exists")
+		return nil, 0, errors.New("email already exists")
 	}
 
 	// 将密码哈希加密
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
-		return "", 0, errors.New("failed to hash password")
+		return nil, 0, errors.New("failed to hash password")
 	}
 
 	user.Password = hashedPassword
 
 	id, err := s.Create(ctx, user)
 	if err != nil {
-		return "", 0, errors.New("failed to create user")
+		return nil, 0, errors.New("failed to create user")
+	}
+	// 商家账号待审核, 审核通过后再登录
+	if user.RoleID == _const.MerchantRole {
+		return nil, id, nil
+	}
+
+	token, err := s.tokens.Issue(ctx, id, user.Name, user.RoleID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return token, id, nil
+}
+
+func (s *UserServiceImpl) LoginByPhone(ctx context.Context, phone, code string) (*domain.TokenPair, *domain.User, error) {
+	if err := s.sms.VerifyCode(ctx, phone, code); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.repo.GetByPhone(ctx, phone)
+	if err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+	if err = s.checkBanned(ctx, user.ID); err != nil {
+		return nil, nil, err
+	}
+
+	token, err := s.issueLogin(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, user, nil
+}
+
+func (s *UserServiceImpl) RegisterByPhone(ctx context.Context, user *domain.User, code string) (*domain.TokenPair, int64, error) {
+	if !utils.VerifyPhone(user.Phone) {
+		return nil, 0, errors.New("phone is not valid")
+	}
+	// 检查手机号是否已注册
+	existingUser, _ := s.repo.GetByPhone(ctx, user.Phone)
+	if existingUser != nil {
+		return nil, 0, errors.New("phone already exists")
+	}
+	if err := s.sms.VerifyCode(ctx, user.Phone, code); err != nil {
+		return nil, 0, err
 	}
 
-	token, err := jwt.GenerateToken(user.ID, user.Name, user.RoleID)
+	if user.Password != "" {
+		hashedPassword, err := utils.HashPassword(user.Password)
+		if err != nil {
+			return nil, 0, errors.New("failed to hash password")
+		}
+		user.Password = hashedPassword
+	}
+
+	id, err := s.Create(ctx, user)
 	if err != nil {
-		return "", 0, errors.New("failed to generate token")
+		return nil, 0, errors.New("failed to create user")
 	}
 
+	token, err := s.tokens.Issue(ctx, id, user.Name, user.RoleID)
+	if err != nil {
+		return nil, 0, err
+	}
 	return token, id, nil
 }
 
+// Refresh 商家账号也保存在用户表中, 通过用户接口登录和刷新
+func (s *UserServiceImpl) Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
+	return s.tokens.Refresh(ctx, refreshToken, _const.UserRole, _const.MerchantRole)
+}
+
+func (s *UserServiceImpl) Logout(ctx context.Context, claims *jwt.CustomClaims) error {
+	return s.tokens.Revoke(ctx, claims)
+}
+
 func (s *UserServiceImpl) Update(ctx context.Context, name, phone, email string, id int64, sex int) error {
 	if id == 0 {
 		return errors.New("invalid user")
@@ -174,10 +404,13 @@ func (s *UserServiceImpl) Update(ctx context.Context, name, phone, email string,
 	return nil
 }
 
-func (s *UserServiceImpl) UpdatePassword(ctx context.Context, id int64, newPassword, oldPassword string) error {
+func (s *UserServiceImpl) UpdatePassword(ctx context.Context, id int64, newPassword, oldPassword, totpCode string) error {
 	if id == 0 {
 		return errors.New("invalid user")
 	}
+	if err := s.totp.Require(ctx, id, totpCode); err != nil {
+		return err
+	}
 
 	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
@@ -196,6 +429,15 @@ func (s *UserServiceImpl) UpdatePassword(ctx context.Context, id int64, newPassw
 	if err = s.repo.UpdatePasswd(ctx, user); err != nil {
 		return errors.New("failed to update user")
 	}
+	return s.revokeSessions(ctx, user)
+}
+
+// revokeSessions 密码变更后注销用户的全部会话, 已签发的 token 需要重新登录获取. 会话按账号角色(用户或商家)保存
+func (s *UserServiceImpl) revokeSessions(ctx context.Context, user *domain.User) error {
+	if err := s.tokens.RevokeAll(ctx, user.RoleID, user.ID); err != nil {
+		log.AppLogger.Errorf("failed to revoke sessions of user %d: %v", user.ID, err)
+		return errors.New("password updated but failed to revoke sessions")
+	}
 	return nil
 }
 
@@ -222,58 +464,54 @@ func (s *UserServiceImpl) UpdateImage(ctx context.Context, userID int64, image *
 	return nil
 }
 
-func (s *UserServiceImpl) Delete(ctx context.Context, id int64) error {
-	if id == 0 {
-		return errors.New("invalid user")
-	}
-
-	err := s.repo.Delete(ctx, id)
-	if err != nil {
-		log.AppLogger.Errorf("failed to delete user: %v", err)
-		return errors.New("failed to delete user")
-	}
-	return nil
-}
-
 // CheckEmailVerificationCode 验证邮箱验证码
 func (s *UserServiceImpl) CheckEmailVerificationCode(ctx context.Context, email string, verificationCode string) (bool, error) {
 	if email == "" || verificationCode == "" {
 		return false, errors.New("invalid email or verification code")
 	}
-	return s.repo.CheckEmailVerificationCode(ctx, email, verificationCode)
+	maxAttempts := conf.GetConfig().Security.CodeMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultEmailCodeMaxAttempts
+	}
+	return s.repo.CheckEmailVerificationCode(ctx, email, verificationCode, maxAttempts)
 }
 
 // ForgetPassword 忘记密码修改密码函数
-func (s *UserServiceImpl) ForgetPassword(ctx context.Context, email string, verificationCode string, newPassword string) error {
+func (s *UserServiceImpl) ForgetPassword(ctx context.Context, email string, verificationCode string, newPassword, totpCode string) error {
 	if email == "" || verificationCode == "" || newPassword == "" {
 		return errors.New("invalid email or verification code or new password")
 	}
 
-	isInvalid, err := s.repo.CheckEmailVerificationCode(ctx, email, verificationCode)
-	if err != nil {
-		return errors.New("failed to verify email verification code")
-	}
-	if isInvalid == false {
-		return errors.New("invalid email verification code")
+	if _, err := s.CheckEmailVerificationCode(ctx, email, verificationCode); err != nil {
+		return err
 	}
 
 	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	// 邮箱被盗时仍需两步验证码才能重置密码
+	if err = s.totp.Require(ctx, user.ID, totpCode); err != nil {
+		return err
+	}
 	user.Password = newPassword
 
-	return s.repo.UpdatePasswd(ctx, user)
+	if err = s.repo.UpdatePasswd(ctx, user); err != nil {
+		return err
+	}
+	return s.revokeSessions(ctx, user)
 }
 
-func (s *UserServiceImpl) UpdateEmail(ctx context.Context, email string, verificationCode string, userID int64) error {
+func (s *UserServiceImpl) UpdateEmail(ctx context.Context, email string, verificationCode string, userID int64, totpCode string) error {
 	if email == "" || verificationCode == "" || userID == 0 {
 		return errors.New("invalid email or verification code or user id")
 	}
-
-	isInvalid, err := s.repo.CheckEmailVerificationCode(ctx, email, verificationCode)
-	if err != nil {
-		return errors.New("failed to verify email verification code")
+	if err := s.totp.Require(ctx, userID, totpCode); err != nil {
+		return err
 	}
-	if isInvalid == false {
-		return errors.New("invalid email verification code")
+
+	if _, err := s.CheckEmailVerificationCode(ctx, email, verificationCode); err != nil {
+		return err
 	}
 
 	return s.repo.UpdateEmail(ctx, email, userID)
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/repo"
+	"testing"
+)
+
+// fakeUserRepo 只实现修改密码用到的方法
+type fakeUserRepo struct {
+	repo.UserRepo
+	users map[int64]*domain.User
+}
+
+func (r *fakeUserRepo) GetByID(ctx context.Context, id int64) (*domain.User, error) {
+	if u, ok := r.users[id]; ok {
+		copied := *u
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeUserRepo) UpdatePasswd(ctx context.Context, user *domain.User) error {
+	r.users[user.ID].Password = user.Password
+	return nil
+}
+
+func newTestUserService(t *testing.T, users ...*domain.User) (*UserServiceImpl, *TokenServiceImpl) {
+	userRepo := &fakeUserRepo{users: make(map[int64]*domain.User)}
+	for _, u := range users {
+		userRepo.users[u.ID] = u
+	}
+	tokens := newTestTokenService(t)
+	totpService := NewTOTPService(&fakeTOTPRepo{totps: make(map[int64]*domain.UserTOTP)}, nil, conf.SecurityConf{TOTPKey: "key"})
+	return NewUserService(userRepo, nil, tokens, nil, nil, totpService, nil), tokens
+}
+
+func TestUserService_MerchantSession(t *testing.T) {
+	s, tokens := newTestUserService(t, &domain.User{ID: 2, Name: "shop", Password: "old", RoleID: _const.MerchantRole})
+	ctx := context.Background()
+
+	pair, _ := tokens.Issue(ctx, 2, "shop", _const.MerchantRole)
+	refreshed, err := s.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh merchant: %v", err)
+	}
+
+	// 修改密码后商家的全部会话失效
+	if err = s.UpdatePassword(ctx, 2, "new", "old", ""); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	if err = tokens.CheckToken(ctx, mustParse(t, refreshed.AccessToken)); !errors.Is(err, domain.ErrTokenRevoked) {
+		t.Errorf("merchant token after password change: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err = s.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Errorf("refresh after password change: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	log "github.com/star-find-cloud/star-mall/pkg/logger"
+	"github.com/star-find-cloud/star-mall/pkg/payment"
+	"github.com/star-find-cloud/star-mall/repo"
+	"time"
+)
+
+const (
+	defaultVipExpireInterval = 24 * time.Hour
+	defaultVipEarnWindow     = 365 * 24 * time.Hour
+	// vipExpireBatchSize 每轮最多处理的到期会员数
+	vipExpireBatchSize = 200
+)
+
+type MembershipService interface {
+	// Plans 获取在售的会员套餐
+	Plans(ctx context.Context) ([]*domain.VipPlan, error)
+
+	// Get 获取用户会员, 不是会员时返回 domain.ErrMembershipNotFound
+	Get(ctx context.Context, userID int64) (*domain.Membership, error)
+
+	// ActiveTier 获取用户当前生效的会员等级, 不是会员或已过期时返回 nil
+	ActiveTier(ctx context.Context, userID int64) (*domain.VipTier, error)
+
+	// Purchase 购买会员套餐, autoRenew 为 true 时同时签订代扣协议, 到期前自动续费
+	Purchase(ctx context.Context, userID, planID int64, autoRenew bool) (*domain.Membership, error)
+
+	// Earn 消费金额达到套餐要求后免费开通
+	Earn(ctx context.Context, userID, planID int64) (*domain.Membership, error)
+
+	// CancelAutoRenew 关闭自动续费, 会员在本期结束后过期
+	CancelAutoRenew(ctx context.Context, userID int64) error
+
+	// ExpireLapsed 为即将到期且开启自动续费的会员续费, 过期其余到期的会员
+	ExpireLapsed(ctx context.Context) (renewed int, expired int, err error)
+
+	// Run 定期执行 ExpireLapsed, 直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+type MembershipServiceImpl struct {
+	repo       repo.VipRepo
+	payment    payment.Provider
+	interval   time.Duration
+	earnWindow time.Duration
+}
+
+func NewMembershipService(repo repo.VipRepo, provider payment.Provider, c conf.VipConf) *MembershipServiceImpl {
+	if c.ExpireInterval <= 0 {
+		c.ExpireInterval = defaultVipExpireInterval
+	}
+	if c.EarnWindow <= 0 {
+		c.EarnWindow = defaultVipEarnWindow
+	}
+	return &MembershipServiceImpl{
+		repo:       repo,
+		payment:    provider,
+		interval:   c.ExpireInterval,
+		earnWindow: c.EarnWindow,
+	}
+}
+
+func (s *MembershipServiceImpl) Plans(ctx context.Context) ([]*domain.VipPlan, error) {
+	return s.repo.ListPlans(ctx)
+}
+
+func (s *MembershipServiceImpl) Get(ctx context.Context, userID int64) (*domain.Membership, error) {
+	return s.repo.GetMembership(ctx, userID)
+}
+
+func (s *MembershipServiceImpl) ActiveTier(ctx context.Context, userID int64) (*domain.VipTier, error) {
+	if userID == 0 {
+		return nil, nil
+	}
+	membership, err := s.repo.GetMembership(ctx, userID)
+	if errors.Is(err, domain.ErrMembershipNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !membership.Active(time.Now().Unix()) {
+		return nil, nil
+	}
+	return membership.Tier, nil
+}
+
+// current 获取用户现有的会员, 不是会员时返回 nil
+func (s *MembershipServiceImpl) current(ctx context.Context, userID int64) (*domain.Membership, error) {
+	membership, err := s.repo.GetMembership(ctx, userID)
+	if errors.Is(err, domain.ErrMembershipNotFound) {
+		return nil, nil
+	}
+	return membership, err
+}
+
+func (s *MembershipServiceImpl) Purchase(ctx context.Context, userID, planID int64, autoRenew bool) (*domain.Membership, error) {
+	if userID == 0 {
+		return nil, errors.New("userID is empty")
+	}
+	plan, err := s.repo.GetPlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Price <= 0 {
+		return nil, domain.ErrVipPlanNotPurchasable
+	}
+	current, err := s.current(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	// 先计算开通结果, 避免降级等无效开通产生扣款
+	if _, err = domain.NextMembership(current, plan, userID, now); err != nil {
+		return nil, err
+	}
+
+	// 商户订单号由下单时的会员状态决定: 并发或重试的相同购买使用同一订单号, 由支付服务商去重扣款, 只开通一次
+	outTradeNo := fmt.Sprintf("vip%d-%d-%d", userID, plan.ID, membershipVersion(current))
+	result, err := s.payment.Charge(ctx, payment.ChargeRequest{
+		OutTradeNo: outTradeNo,
+		UserID:     userID,
+		Amount:     plan.Price,
+		Subject:    plan.Name,
+		Recurring:  autoRenew,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := &domain.VipOrder{
+		UserID:     userID,
+		PlanID:     plan.ID,
+		Kind:       _const.VipOrderPurchase,
+		Amount:     plan.Price,
+		OutTradeNo: outTradeNo,
+		TradeNo:    result.TradeNo,
+		CreatedAt:  now,
+	}
+	next, err := s.activate(ctx, plan, order, func(next *domain.Membership) {
+		if autoRenew {
+			next.AutoRenew, next.AgreementNo = true, result.Agreement
+		}
+	})
+	if err != nil {
+		// 已扣款但开通失败, 需要按交易号人工处理
+		log.AppLogger.Errorf("会员已扣款但开通失败 (user: %d, out trade no: %s, trade no: %s): %v", userID, outTradeNo, result.TradeNo, err)
+		return nil, err
+	}
+	return next, nil
+}
+
+// membershipVersion 会员每次开通或过期后到期时间都会变化, 用于区分不同状态下的购买
+func membershipVersion(m *domain.Membership) int64 {
+	if m == nil {
+		return 0
+	}
+	return m.ExpiresAt
+}
+
+// activate 在锁定的会员记录上重新计算开通结果并保存, adjust 用于修改自动续费等开通选项.
+// 订单号已开通过时(重复提交)不再开通, 返回当前的会员
+func (s *MembershipServiceImpl) activate(ctx context.Context, plan *domain.VipPlan, order *domain.VipOrder, adjust func(next *domain.Membership)) (*domain.Membership, error) {
+	next, err := s.repo.Activate(ctx, order, func(current *domain.Membership) (*domain.Membership, error) {
+		next, err := domain.NextMembership(current, plan, order.UserID, order.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		adjust(next)
+		return next, nil
+	})
+	if errors.Is(err, domain.ErrVipOrderExists) {
+		return s.repo.GetMembership(ctx, order.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	next.Tier = plan.Tier
+	return next, nil
+}
+
+func (s *MembershipServiceImpl) Earn(ctx context.Context, userID, planID int64) (*domain.Membership, error) {
+	if userID == 0 {
+		return nil, errors.New("userID is empty")
+	}
+	plan, err := s.repo.GetPlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+	if plan.EarnThreshold <= 0 {
+		return nil, domain.ErrVipPlanNotPurchasable
+	}
+	current, err := s.current(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	// 同一笔消费只能换取一次, 当前仍是该套餐时不能重复获得
+	if current.Active(now) && current.PlanID == plan.ID {
+		return nil, domain.ErrVipNotEligible
+	}
+
+	// 只统计上次达标获得之后的消费, 已换取过会员的消费不能在过期后或换一个套餐再次使用
+	lastEarn, err := s.repo.LastEarnAt(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	since := now - int64(s.earnWindow/time.Second)
+	if lastEarn > 0 {
+		since = max(since, lastEarn+1)
+	}
+	spend, err := s.repo.SumSpend(ctx, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	if spend < plan.EarnThreshold {
+		return nil, domain.ErrVipNotEligible
+	}
+
+	if _, err = domain.NextMembership(current, plan, userID, now); err != nil {
+		return nil, err
+	}
+	order := &domain.VipOrder{
+		UserID: userID,
+		PlanID: plan.ID,
+		Kind:   _const.VipOrderEarn,
+		// 同一段消费并发换取时使用相同的订单号, 只能开通一次
+		OutTradeNo: fmt.Sprintf("vipe%d-%d", userID, lastEarn),
+		CreatedAt:  now,
+	}
+	// 消费达标获得的会员不自动续费
+	return s.activate(ctx, plan, order, func(next *domain.Membership) {
+		next.AutoRenew, next.AgreementNo = false, ""
+	})
+}
+
+func (s *MembershipServiceImpl) CancelAutoRenew(ctx context.Context, userID int64) error {
+	ok, err := s.repo.CancelAutoRenew(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrMembershipNotFound
+	}
+	return nil
+}
+
+func (s *MembershipServiceImpl) ExpireLapsed(ctx context.Context) (int, int, error) {
+	now := time.Now().Unix()
+	// 自动续费的会员提前一个执行周期续费, 避免在两次执行之间过期
+	due, err := s.repo.ListDue(ctx, now+int64(s.interval/time.Second), vipExpireBatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var renewed, expired int
+	for _, m := range due {
+		if m.AutoRenew && m.AgreementNo != "" {
+			if err = s.renew(ctx, m, now); err == nil {
+				renewed++
+				continue
+			}
+			log.AppLogger.Warnf("会员自动续费失败 (user: %d): %v", m.UserID, err)
+		}
+		// 续费失败时保留到本期结束, 下次执行时重试
+		if m.ExpiresAt > now {
+			continue
+		}
+
+		ok, err := s.repo.Expire(ctx, m.UserID, m.ExpiresAt)
+		if err != nil {
+			log.AppLogger.Errorf("会员过期失败 (user: %d): %v", m.UserID, err)
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return renewed, expired, nil
+}
+
+// renew 使用代扣协议按原套餐续费
+func (s *MembershipServiceImpl) renew(ctx context.Context, m *domain.Membership, now int64) error {
+	plan, err := s.repo.GetPlan(ctx, m.PlanID)
+	if err != nil {
+		return err
+	}
+	if plan.Price <= 0 {
+		return domain.ErrVipPlanNotPurchasable
+	}
+	if _, err = domain.NextMembership(m, plan, m.UserID, now); err != nil {
+		return err
+	}
+
+	// 同一期续费使用相同的商户订单号, 重复执行时由支付服务商去重
+	outTradeNo := fmt.Sprintf("vipr%d-%d", m.UserID, m.ExpiresAt)
+	result, err := s.payment.Charge(ctx, payment.ChargeRequest{
+		OutTradeNo: outTradeNo,
+		UserID:     m.UserID,
+		Amount:     plan.Price,
+		Subject:    plan.Name,
+		Agreement:  m.AgreementNo,
+	})
+	if err != nil {
+		return err
+	}
+	order := &domain.VipOrder{
+		UserID:     m.UserID,
+		PlanID:     plan.ID,
+		Kind:       _const.VipOrderRenew,
+		Amount:     plan.Price,
+		OutTradeNo: outTradeNo,
+		TradeNo:    result.TradeNo,
+		CreatedAt:  now,
+	}
+	_, err = s.activate(ctx, plan, order, func(next *domain.Membership) {
+		next.AutoRenew, next.AgreementNo = true, m.AgreementNo
+	})
+	if err != nil {
+		log.AppLogger.Errorf("会员已续费扣款但保存失败 (user: %d, out trade no: %s, trade no: %s): %v", m.UserID, outTradeNo, result.TradeNo, err)
+		return err
+	}
+	return nil
+}
+
+func (s *MembershipServiceImpl) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, expired, err := s.ExpireLapsed(ctx)
+			if err != nil {
+				log.AppLogger.Errorf("处理到期会员失败: %v", err)
+			} else if renewed > 0 || expired > 0 {
+				log.AppLogger.Infof("会员自动续费 %d 个, 过期 %d 个", renewed, expired)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/star-find-cloud/star-mall/conf"
+	_const "github.com/star-find-cloud/star-mall/const"
+	"github.com/star-find-cloud/star-mall/domain"
+	"github.com/star-find-cloud/star-mall/pkg/payment"
+	"testing"
+	"time"
+)
+
+// fakeVipRepo 在内存中保存会员和开通记录
+type fakeVipRepo struct {
+	plans       map[int64]*domain.VipPlan
+	memberships map[int64]*domain.Membership
+	orders      []*domain.VipOrder
+	spend       int64
+	// spendAt 消费的下单时间
+	spendAt int64
+}
+
+func (r *fakeVipRepo) ListPlans(ctx context.Context) ([]*domain.VipPlan, error) {
+	var plans []*domain.VipPlan
+	for _, p := range r.plans {
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+func (r *fakeVipRepo) GetPlan(ctx context.Context, id int64) (*domain.VipPlan, error) {
+	if p, ok := r.plans[id]; ok {
+		return p, nil
+	}
+	return nil, domain.ErrVipPlanNotFound
+}
+
+func (r *fakeVipRepo) GetMembership(ctx context.Context, userID int64) (*domain.Membership, error) {
+	m, ok := r.memberships[userID]
+	if !ok {
+		return nil, domain.ErrMembershipNotFound
+	}
+	copied := *m
+	for _, p := range r.plans {
+		if p.TierLevel == m.TierLevel {
+			copied.Tier = p.Tier
+		}
+	}
+	return &copied, nil
+}
+
+func (r *fakeVipRepo) Activate(ctx context.Context, order *domain.VipOrder, next func(current *domain.Membership) (*domain.Membership, error)) (*domain.Membership, error) {
+	for _, o := range r.orders {
+		if o.OutTradeNo == order.OutTradeNo {
+			return nil, domain.ErrVipOrderExists
+		}
+	}
+	var current *domain.Membership
+	if m, ok := r.memberships[order.UserID]; ok {
+		copied := *m
+		current = &copied
+	}
+	m, err := next(current)
+	if err != nil {
+		return nil, err
+	}
+	copied := *m
+	r.memberships[m.UserID] = &copied
+	r.orders = append(r.orders, order)
+	return m, nil
+}
+
+func (r *fakeVipRepo) CancelAutoRenew(ctx context.Context, userID int64) (bool, error) {
+	m, ok := r.memberships[userID]
+	if !ok || !m.AutoRenew {
+		return false, nil
+	}
+	m.AutoRenew, m.AgreementNo = false, ""
+	return true, nil
+}
+
+func (r *fakeVipRepo) ListDue(ctx context.Context, before int64, limit int) ([]*domain.Membership, error) {
+	var due []*domain.Membership
+	for _, m := range r.memberships {
+		if m.Status == _const.MembershipStatusActive && m.ExpiresAt <= before {
+			copied := *m
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeVipRepo) Expire(ctx context.Context, userID, expiresAt int64) (bool, error) {
+	m, ok := r.memberships[userID]
+	if !ok || m.Status != _const.MembershipStatusActive || m.ExpiresAt != expiresAt {
+		return false, nil
+	}
+	m.Status, m.AutoRenew = _const.MembershipStatusExpired, false
+	return true, nil
+}
+
+func (r *fakeVipRepo) SumSpend(ctx context.Context, userID, since int64) (int64, error) {
+	if r.spendAt < since {
+		return 0, nil
+	}
+	return r.spend, nil
+}
+
+func (r *fakeVipRepo) LastEarnAt(ctx context.Context, userID int64) (int64, error) {
+	var at int64
+	for _, o := range r.orders {
+		if o.UserID == userID && o.Kind == _const.VipOrderEarn {
+			at = max(at, o.CreatedAt)
+		}
+	}
+	return at, nil
+}
+
+// fakePayment 记录扣款请求, declined 中的用户扣款失败
+type fakePayment struct {
+	charges  []payment.ChargeRequest
+	declined map[int64]bool
+}
+
+func (p *fakePayment) Charge(ctx context.Context, req payment.ChargeRequest) (*payment.ChargeResult, error) {
+	if p.declined[req.UserID] {
+		return nil, fmt.Errorf("insufficient balance: %w", payment.ErrPaymentFailed)
+	}
+	p.charges = append(p.charges, req)
+	result := &payment.ChargeResult{TradeNo: "t-" + req.OutTradeNo, Agreement: req.Agreement}
+	if req.Recurring {
+		result.Agreement = fmt.Sprintf("agreement-%d", req.UserID)
+	}
+	return result, nil
+}
+
+func newTestMembershipService() (*MembershipServiceImpl, *fakeVipRepo, *fakePayment) {
+	silver := &domain.VipTier{Level: 1, DiscountPercent: 95, FreeShippingThreshold: 9900}
+	gold := &domain.VipTier{Level: 2, DiscountPercent: 90}
+	vipRepo := &fakeVipRepo{
+		plans: map[int64]*domain.VipPlan{
+			1: {ID: 1, TierLevel: 1, DurationDays: 30, Price: 1500, Tier: silver},
+			2: {ID: 2, TierLevel: 2, DurationDays: 365, EarnThreshold: 500000, Tier: gold},
+		},
+		memberships: make(map[int64]*domain.Membership),
+	}
+	pay := &fakePayment{declined: make(map[int64]bool)}
+	return NewMembershipService(vipRepo, pay, conf.VipConf{ExpireInterval: time.Hour}), vipRepo, pay
+}
+
+func TestMembershipService_PurchaseAndEarn(t *testing.T) {
+	s, vipRepo, pay := newTestMembershipService()
+	ctx := context.Background()
+
+	if _, err := s.Purchase(ctx, 7, 2, false); !errors.Is(err, domain.ErrVipPlanNotPurchasable) {
+		t.Errorf("Purchase(earn-only plan) err = %v, want %v", err, domain.ErrVipPlanNotPurchasable)
+	}
+	m, err := s.Purchase(ctx, 7, 1, true)
+	if err != nil {
+		t.Fatalf("Purchase err = %v", err)
+	}
+	if !m.AutoRenew || m.AgreementNo == "" || len(pay.charges) != 1 || pay.charges[0].Amount != 1500 {
+		t.Errorf("membership = %+v, charges = %+v", m, pay.charges)
+	}
+	// 基于相同会员状态重复提交的购买使用同一订单号, 只开通一期
+	order := &domain.VipOrder{UserID: 7, PlanID: 1, OutTradeNo: pay.charges[0].OutTradeNo, CreatedAt: time.Now().Unix()}
+	again, err := s.activate(ctx, vipRepo.plans[1], order, func(*domain.Membership) {})
+	if err != nil || again.ExpiresAt != m.ExpiresAt || len(vipRepo.orders) != 1 {
+		t.Errorf("duplicate activation = %+v, %v, orders = %d", again, err, len(vipRepo.orders))
+	}
+	tier, err := s.ActiveTier(ctx, 7)
+	if err != nil || tier == nil || tier.Level != 1 {
+		t.Errorf("ActiveTier = %+v, %v, want level 1", tier, err)
+	}
+	if tier, _ = s.ActiveTier(ctx, 8); tier != nil {
+		t.Errorf("ActiveTier(non-member) = %+v, want nil", tier)
+	}
+
+	vipRepo.spend, vipRepo.spendAt = 499999, time.Now().Unix()-60
+	if _, err = s.Earn(ctx, 7, 2); !errors.Is(err, domain.ErrVipNotEligible) {
+		t.Errorf("Earn(below threshold) err = %v, want %v", err, domain.ErrVipNotEligible)
+	}
+	vipRepo.spend = 500000
+	if m, err = s.Earn(ctx, 7, 2); err != nil {
+		t.Fatalf("Earn err = %v", err)
+	}
+	if m.TierLevel != 2 || m.AutoRenew {
+		t.Errorf("earned membership = %+v, want level 2 without auto renew", m)
+	}
+	if _, err = s.Earn(ctx, 7, 2); !errors.Is(err, domain.ErrVipNotEligible) {
+		t.Errorf("Earn(again) err = %v, want %v", err, domain.ErrVipNotEligible)
+	}
+	if _, err = s.Purchase(ctx, 7, 1, false); !errors.Is(err, domain.ErrVipDowngrade) {
+		t.Errorf("Purchase(lower tier) err = %v, want %v", err, domain.ErrVipDowngrade)
+	}
+	if len(pay.charges) != 1 {
+		t.Errorf("rejected purchases charged: %+v", pay.charges)
+	}
+}
+
+func TestMembershipService_ExpireLapsed(t *testing.T) {
+	s, vipRepo, pay := newTestMembershipService()
+	ctx := context.Background()
+	now := time.Now().Unix()
+	active := func(userID, expiresAt int64, agreement string) {
+		vipRepo.memberships[userID] = &domain.Membership{
+			UserID: userID, PlanID: 1, TierLevel: 1, Status: _const.MembershipStatusActive,
+			ExpiresAt: expiresAt, AutoRenew: agreement != "", AgreementNo: agreement,
+		}
+	}
+	active(1, now+60, "a1")    // 即将到期, 自动续费
+	active(2, now-60, "")      // 已到期, 未开启自动续费
+	active(3, now+60, "")      // 即将到期, 未开启自动续费, 保留到本期结束
+	active(4, now-60, "a4")    // 已到期, 扣款失败
+	active(5, now+60, "a5")    // 即将到期, 扣款失败, 下次重试
+	active(6, now+86400, "a6") // 未到期
+	pay.declined[4], pay.declined[5] = true, true
+
+	renewed, expired, err := s.ExpireLapsed(ctx)
+	if err != nil {
+		t.Fatalf("ExpireLapsed err = %v", err)
+	}
+	if renewed != 1 || expired != 2 {
+		t.Errorf("renewed, expired = %d, %d, want 1, 2", renewed, expired)
+	}
+	if m := vipRepo.memberships[1]; m.ExpiresAt != now+60+30*86400 || !m.AutoRenew || m.AgreementNo != "a1" {
+		t.Errorf("renewed membership = %+v", m)
+	}
+	if len(pay.charges) != 1 || pay.charges[0].Agreement != "a1" {
+		t.Errorf("charges = %+v, want one charge with agreement a1", pay.charges)
+	}
+	for userID, want := range map[int64]int{2: _const.MembershipStatusExpired, 3: _const.MembershipStatusActive,
+		4: _const.MembershipStatusExpired, 5: _const.MembershipStatusActive, 6: _const.MembershipStatusActive} {
+		if got := vipRepo.memberships[userID].Status; got != want {
+			t.Errorf("user %d status = %d, want %d", userID, got, want)
+		}
+	}
+}
+
+func TestMembershipService_EarnOnce(t *testing.T) {
+	s, vipRepo, _ := newTestMembershipService()
+	ctx := context.Background()
+	vipRepo.plans[3] = &domain.VipPlan{ID: 3, TierLevel: 2, DurationDays: 30, EarnThreshold: 500000, Tier: vipRepo.plans[2].Tier}
+	vipRepo.spend, vipRepo.spendAt = 500000, time.Now().Unix()-60
+
+	m, err := s.Earn(ctx, 7, 2)
+	if err != nil {
+		t.Fatalf("Earn err = %v", err)
+	}
+	// 同等级的其他套餐不能用同一段消费叠加
+	if _, err = s.Earn(ctx, 7, 3); !errors.Is(err, domain.ErrVipNotEligible) {
+		t.Errorf("Earn(other plan) err = %v, want %v", err, domain.ErrVipNotEligible)
+	}
+
+	// 获得的会员过期后, 同一段消费不能再次换取
+	vipRepo.memberships[7].ExpiresAt = m.ExpiresAt - 400*24*3600
+	vipRepo.memberships[7].Status = _const.MembershipStatusExpired
+	if _, err = s.Earn(ctx, 7, 2); !errors.Is(err, domain.ErrVipNotEligible) {
+		t.Errorf("Earn(after expiry) err = %v, want %v", err, domain.ErrVipNotEligible)
+	}
+
+	// 之后的新消费可以再次达标
+	vipRepo.spendAt = vipRepo.orders[len(vipRepo.orders)-1].CreatedAt + 1
+	if _, err = s.Earn(ctx, 7, 2); err != nil {
+		t.Errorf("Earn(new spend) err = %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+use shop;
+
+drop table if exists admin;
+CREATE TABLE `admin`
+(
+    `id`        BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '管理员ID',
+    `user_name` VARCHAR(64)  NOT NULL COMMENT '登录名',
+    `password`  VARCHAR(255) NOT NULL COMMENT '密码哈希',
+    `phone_num` VARCHAR(20)  NOT NULL DEFAULT '' COMMENT '手机号',
+    `email`     VARCHAR(100) NOT NULL DEFAULT '' COMMENT '邮箱',
+    `status`    TINYINT      NOT NULL DEFAULT 1 COMMENT '状态 (1-启用, 0-停用)',
+    `role_id`   BIGINT       NOT NULL DEFAULT 0 COMMENT '额外角色ID',
+    `add_time`  BIGINT       NOT NULL COMMENT '创建时间戳',
+    `is_super`  TINYINT      NOT NULL DEFAULT 0 COMMENT '是否超级管理员 (1-是, 0-否)',
+    UNIQUE KEY `uk_user_name` (`user_name`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='管理员表';
+
+drop table if exists admin_audit_log;
+CREATE TABLE `admin_audit_log`
+(
+    `id`         BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '日志ID',
+    `admin_id`   BIGINT       NOT NULL COMMENT '管理员ID',
+    `admin_name` VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '管理员登录名',
+    `action`     VARCHAR(300) NOT NULL COMMENT '操作, HTTP 方法 + 路由模板',
+    `path`       VARCHAR(255) NOT NULL COMMENT '请求路径',
+    `params`     TEXT COMMENT '请求参数, 敏感字段已脱敏',
+    `status`     INT          NOT NULL DEFAULT 0 COMMENT '响应状态码',
+    `ip`         VARCHAR(45)  NOT NULL DEFAULT '' COMMENT '操作IP',
+    `created_at` BIGINT       NOT NULL COMMENT '操作时间戳',
+    INDEX `idx_admin_created` (`admin_id`, `created_at`),
+    INDEX `idx_created_at` (`created_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='管理员操作审计日志';
+
+-- 后台管理接口权限, 需在 rbac.sql 之后执行
+insert into sys_auth (id, module_name, action_name, type, method, url, create_time)
+values (10, '用户管理', '搜索用户', 3, 'GET', '/api/v1/admin/user/search', unix_timestamp()),
+       (11, '用户管理', '封禁用户', 3, 'PATCH', '/api/v1/admin/user/ban/:id', unix_timestamp()),
+       (12, '用户管理', '解封用户', 3, 'PATCH', '/api/v1/admin/user/unban/:id', unix_timestamp()),
+       (13, '商家管理', '商家列表', 3, 'GET', '/api/v1/admin/merchant/list', unix_timestamp()),
+       (14, '商家管理', '审核通过', 3, 'PATCH', '/api/v1/admin/merchant/approve/:id', unix_timestamp()),
+       (15, '商家管理', '审核驳回', 3, 'PATCH', '/api/v1/admin/merchant/reject/:id', unix_timestamp()),
+       (16, '商品管理', '商品列表', 3, 'GET', '/api/v1/admin/product/list', unix_timestamp()),
+       (17, '商品管理', '下架商品', 3, 'PATCH', '/api/v1/admin/product/takedown/:id', unix_timestamp()),
+       (18, '商品管理', '恢复上架', 3, 'PATCH', '/api/v1/admin/product/restore/:id', unix_timestamp()),
+       (19, '订单管理', '订单列表', 3, 'GET', '/api/v1/admin/order/list', unix_timestamp()),
+       (20, '订单管理', '订单详情', 3, 'GET', '/api/v1/admin/order/get/:id', unix_timestamp()),
+       (21, '营销管理', '创建平台券', 3, 'PUT', '/api/v1/admin/coupon/create', unix_timestamp()),
+       (22, '首页', '数据概览', 3, 'GET', '/api/v1/admin/dashboard', unix_timestamp()),
+       (23, '系统管理', '审计日志', 3, 'GET', '/api/v1/admin/audit/list', unix_timestamp());
+
+insert into sys_role_permission (role_id, permission_id, created_at)
+select 3, id, unix_timestamp()
+from sys_auth
+where id between 10 and 23;
+
+-- 登录锁定管理
+insert into sys_auth (id, module_name, action_name, type, method, url, create_time)
+values (24, '系统管理', '登录锁定列表', 3, 'GET', '/api/v1/admin/security/locks', unix_timestamp()),
+       (25, '系统管理', '解除登录锁定', 3, 'DELETE', '/api/v1/admin/security/lock', unix_timestamp());
+
+insert into sys_role_permission (role_id, permission_id, created_at)
+select 3, id, unix_timestamp()
+from sys_auth
+where id between 24 and 25;
+
+-- 搜索运营
+insert into sys_auth (id, module_name, action_name, type, method, url, create_time)
+values (26, '商品管理', '无结果搜索词', 3, 'GET', '/api/v1/admin/search/zeroResults', unix_timestamp());
+
+insert into sys_role_permission (role_id, permission_id, created_at)
+values (3, 26, unix_timestamp());
+
+-- 管理员账号管理
+insert into sys_auth (id, module_name, action_name, type, method, url, create_time)
+values (27, '系统管理', '停用管理员', 3, 'PATCH', '/api/v1/admin/admin/disable/:id', unix_timestamp()),
+       (28, '系统管理', '启用管理员', 3, 'PATCH', '/api/v1/admin/admin/enable/:id', unix_timestamp());
+
+insert into sys_role_permission (role_id, permission_id, created_at)
+select 3, id, unix_timestamp()
+from sys_auth
+where id between 27 and 28;
@@ -0,0 +1,45 @@
+use shop;
+
+drop table if exists coupon;
+CREATE TABLE `coupon`
+(
+    `id`             BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '优惠券ID',
+    `name`           VARCHAR(128) NOT NULL COMMENT '优惠券名称',
+    `issuer_type`    INT          NOT NULL COMMENT '发放方 (100-平台, 101-商家)',
+    `merchant_id`    BIGINT       NOT NULL DEFAULT 0 COMMENT '商家券所属商家ID',
+    `type`           INT          NOT NULL COMMENT '类型 (90-立减, 91-折扣, 92-满减, 93-免运费)',
+    `amount`         BIGINT       NOT NULL DEFAULT 0 COMMENT '减免金额（单位：分）',
+    `threshold`      BIGINT       NOT NULL DEFAULT 0 COMMENT '使用门槛（单位：分）',
+    `percent`        INT          NOT NULL DEFAULT 0 COMMENT '折扣百分比',
+    `max_discount`   BIGINT       NOT NULL DEFAULT 0 COMMENT '折扣最高减免（单位：分）',
+    `scope_type`     INT          NOT NULL COMMENT '适用范围 (110-全场, 111-商品, 112-分类, 113-商家)',
+    `scope_ids`      JSON COMMENT '适用范围ID数组',
+    `start_at`       BIGINT       NOT NULL COMMENT '生效时间戳',
+    `end_at`         BIGINT       NOT NULL COMMENT '失效时间戳',
+    `total_limit`    BIGINT       NOT NULL DEFAULT 0 COMMENT '发放总量, 0 不限',
+    `issued_count`   BIGINT       NOT NULL DEFAULT 0 COMMENT '已发放数量',
+    `per_user_limit` BIGINT       NOT NULL DEFAULT 0 COMMENT '每人限领, 0 不限',
+    `vip_level`      BIGINT       NOT NULL DEFAULT 0 COMMENT '领取所需的会员等级, 0 不限',
+    `status`         INT          NOT NULL DEFAULT 60 COMMENT '状态 (60-正常, 61-删除)',
+    `created_at`     BIGINT       NOT NULL COMMENT '创建时间戳',
+    `updated_at`     BIGINT       NOT NULL DEFAULT 0 COMMENT '更新时间戳',
+    INDEX `idx_merchant` (`merchant_id`),
+    INDEX `idx_valid` (`status`, `start_at`, `end_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='优惠券模板表';
+
+drop table if exists user_coupon;
+CREATE TABLE `user_coupon`
+(
+    `id`         BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '用户优惠券ID',
+    `coupon_id`  BIGINT NOT NULL COMMENT '优惠券模板ID',
+    `user_id`    BIGINT NOT NULL COMMENT '用户ID',
+    `status`     INT    NOT NULL DEFAULT 120 COMMENT '状态 (120-未使用, 121-已使用, 122-已过期)',
+    `order_id`   BIGINT NOT NULL DEFAULT 0 COMMENT '使用的订单ID',
+    `claimed_at` BIGINT NOT NULL COMMENT '领取时间戳',
+    `used_at`    BIGINT NOT NULL DEFAULT 0 COMMENT '使用时间戳',
+    INDEX `idx_user_status` (`user_id`, `status`),
+    INDEX `idx_coupon_user` (`coupon_id`, `user_id`),
+    INDEX `idx_order_id` (`order_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='用户优惠券表';
@@ -8,10 +8,43 @@ CREATE TABLE if not exists `images`
     `ownerID`      bigint       COMMENT '拥有者ID',
     `path`         VARCHAR(255) NOT NULL COMMENT '存储路径',
     `sha256hash`   varchar(255) comment '哈希值',
-    `isCompressed` TINYINT(1)   DEFAULT 0 COMMENT '是否压缩 (0-否, 1-是)',
+    `isCompressed` TINYINT(1)   DEFAULT 0 COMMENT '是否已生成各尺寸版本 (0-否, 1-是)',
     `content_type` int          NOT NULL COMMENT '文件类型',
-    `create_at`    timestamp  default current_timestamp comment '创建时间',
+    `create_at`    bigint       NOT NULL DEFAULT 0 COMMENT '创建时间戳',
     `status`       int          DEFAULT 60 comment '状态 (60-正常,61-删除)',
     INDEX idx_owner (imageID, ownerType, ownerID)
 ) ENGINE = InnoDB
   DEFAULT CHARSET = utf8mb4;
+
+-- 图片处理生成的各尺寸版本, 同一尺寸可以有 JPEG/PNG 和 WebP 两种格式
+drop table if exists image_variants;
+CREATE TABLE if not exists `image_variants`
+(
+    `id`           bigint       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    `imageID`      bigint       NOT NULL COMMENT '原图ID',
+    `size`         varchar(32)  NOT NULL COMMENT '尺寸名',
+    `content_type` int          NOT NULL COMMENT '文件类型',
+    `path`         VARCHAR(255) NOT NULL COMMENT '存储路径',
+    `sha256hash`   varchar(64)  NOT NULL DEFAULT '' COMMENT '哈希值',
+    `width`        int          NOT NULL COMMENT '宽度',
+    `height`       int          NOT NULL COMMENT '高度',
+    `bytes`        bigint       NOT NULL COMMENT '文件大小',
+    `create_at`    bigint       NOT NULL DEFAULT 0 COMMENT '创建时间戳',
+    UNIQUE KEY uk_image_size (imageID, size, content_type)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
+
+-- 按 SHA-256 去重的图片内容, images.path 指向内容的 path, 引用数降为 0 后超过安全延迟由回收任务删除
+drop table if exists image_blobs;
+CREATE TABLE if not exists `image_blobs`
+(
+    `sha256hash`   char(64)     NOT NULL PRIMARY KEY COMMENT '内容的 SHA-256',
+    `path`         VARCHAR(255) NOT NULL COMMENT '存储路径',
+    `content_type` int          NOT NULL COMMENT '文件类型',
+    `size`         bigint       NOT NULL COMMENT '文件大小',
+    `ref_count`    int          NOT NULL DEFAULT 0 COMMENT '引用该内容的未删除图片数',
+    `create_at`    bigint       NOT NULL DEFAULT 0 COMMENT '创建时间戳',
+    `released_at`  bigint       NOT NULL DEFAULT 0 COMMENT '引用数降为 0 的时间戳',
+    INDEX idx_released (ref_count, released_at)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4;
@@ -37,7 +37,7 @@ CREATE TABLE IF NOT EXISTS `merchant`
     `create_at`        bigint(20)   NOT NULL COMMENT '创建时间',
     `update_at`        bigint(20)   COMMENT '更新时间',
     `delete_at`        bigint(20)            DEFAULT NULL COMMENT '删除时间',
-    `status`           int(11)      NOT NULL DEFAULT '0' COMMENT '商家状态：0-待审核，1-正常，2-禁用',
+    `status`           int(11)      NOT NULL DEFAULT '140' COMMENT '商家状态：140-待审核，141-审核通过，142-审核驳回，61-已删除',
     PRIMARY KEY (`id`),
     KEY `idx_status` (`status`),
     KEY `idx_score` (`score`),
@@ -7,6 +7,8 @@ CREATE TABLE `orders` (
                           `order_status` VARCHAR(50) NOT NULL COMMENT '订单状态',
                           `total_price` BIGINT NOT NULL DEFAULT 0 COMMENT '总价（单位：分）',
                           `pay_price` BIGINT NOT NULL DEFAULT 0 COMMENT '实际支付价格（单位：分）',
+                          `shipping_fee` BIGINT NOT NULL DEFAULT 0 COMMENT '运费（单位：分）',
+                          `discount_price` BIGINT NOT NULL DEFAULT 0 COMMENT '优惠金额（单位：分）',
                           `created_at` BIGINT NOT NULL COMMENT '创建时间戳',
                           `updated_at` BIGINT NOT NULL COMMENT '更新时间戳',
                           `payment_id` BIGINT NOT NULL COMMENT '支付方式ID',
@@ -28,4 +30,15 @@ CREATE TABLE `order_items` (
                                `subtotal` BIGINT NOT NULL DEFAULT 0 COMMENT '小计金额（单位：分）',
                                INDEX `idx_order_id` (`order_id`),
                                INDEX `idx_product_id` (`product_id`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单商品明细表';
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单商品明细表';
+
+drop table if exists order_discounts;
+CREATE TABLE `order_discounts` (
+                                   `id` BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '优惠明细ID',
+                                   `order_id` BIGINT NOT NULL COMMENT '关联订单ID',
+                                   `user_coupon_id` BIGINT NOT NULL COMMENT '使用的用户优惠券ID',
+                                   `coupon_id` BIGINT NOT NULL COMMENT '优惠券模板ID',
+                                   `coupon_type` INT NOT NULL COMMENT '优惠券类型',
+                                   `amount` BIGINT NOT NULL DEFAULT 0 COMMENT '优惠金额（单位：分）',
+                                   INDEX `idx_order_id` (`order_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='订单优惠明细表';
@@ -0,0 +1,18 @@
+use shop;
+
+drop table if exists outbox_event;
+CREATE TABLE `outbox_event`
+(
+    `id`              BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '事件ID',
+    `aggregate`       VARCHAR(32)  NOT NULL COMMENT '聚合类型, 如 product',
+    `aggregate_id`    BIGINT       NOT NULL COMMENT '聚合ID, 如商品ID',
+    `event_type`      VARCHAR(64)  NOT NULL COMMENT '事件类型, 如 product.changed',
+    `status`          INT          NOT NULL DEFAULT 190 COMMENT '状态 (190-待处理, 191-死信)',
+    `attempts`        INT          NOT NULL DEFAULT 0 COMMENT '已尝试次数',
+    `next_attempt_at` BIGINT       NOT NULL COMMENT '下次可处理的时间戳, 处理中的事件会被推迟作为租约',
+    `last_error`      VARCHAR(512) NOT NULL DEFAULT '' COMMENT '最近一次失败原因',
+    `created_at`      BIGINT       NOT NULL COMMENT '创建时间戳',
+    `updated_at`      BIGINT       NOT NULL COMMENT '更新时间戳',
+    INDEX `idx_claim` (`aggregate`, `status`, `next_attempt_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='事务发件箱, 与业务数据在同一事务中写入, 由后台任务投递, 处理成功后删除';
@@ -37,6 +37,8 @@ CREATE TABLE IF NOT EXISTS product
     product_type_id INT COMMENT '商品类型ID',
     sort            INT        DEFAULT 0 COMMENT '排序权重',
     status          INT COMMENT '商品状态',
+    rating          DECIMAL(3, 2) DEFAULT 0 COMMENT '评分, 由评价汇总',
+    rating_count    INT        DEFAULT 0 COMMENT '评价数',
 
     -- 基础索引
     INDEX idx_shop (merchant_id) COMMENT '商家ID索引',
@@ -51,6 +53,7 @@ CREATE TABLE IF NOT EXISTS product
     INDEX idx_sort (sort) COMMENT '排序权重索引',
     INDEX idx_purchase (purchase_count) COMMENT '购买量索引',
     INDEX idx_click (click_count) COMMENT '点击量索引',
+    INDEX idx_rating (rating) COMMENT '评分索引',
 
     -- 文本搜索索引
     INDEX idx_title (title(32)) COMMENT '商品标题前缀索引，用于标题搜索',
@@ -84,3 +87,23 @@ FROM product
 WHERE is_deleted = 0
   AND status = 1
 ORDER BY popularity_score DESC;
+
+-- 商品分类, pid 为 0 表示顶级分类
+DROP TABLE IF EXISTS product_cate;
+CREATE TABLE IF NOT EXISTS product_cate
+(
+    id          INT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+    title       VARCHAR(100) NOT NULL COMMENT '分类名称',
+    cate_img    VARCHAR(255) COMMENT '分类图片',
+    link        VARCHAR(255) COMMENT '跳转链接',
+    template    VARCHAR(100) COMMENT '模板',
+    pid         INT          NOT NULL DEFAULT 0 COMMENT '父级分类ID',
+    sub_title   VARCHAR(255) COMMENT '子标题',
+    keywords    VARCHAR(255) COMMENT '关键词',
+    description VARCHAR(500) COMMENT '描述',
+    sort        INT          DEFAULT 0 COMMENT '排序',
+    status      TINYINT      DEFAULT 1 COMMENT '状态',
+    add_time    BIGINT COMMENT '创建时间戳',
+
+    INDEX idx_pid (pid) COMMENT '父级分类索引，用于查询子分类'
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 COMMENT ='商品分类表';
@@ -0,0 +1,86 @@
+use shop;
+
+drop table if exists sys_role;
+CREATE TABLE `sys_role`
+(
+    `id`          BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '角色ID',
+    `name`        VARCHAR(64)  NOT NULL COMMENT '角色名称',
+    `code`        VARCHAR(64)  NOT NULL COMMENT '角色编码',
+    `description` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '角色描述',
+    `status`      TINYINT      NOT NULL DEFAULT 1 COMMENT '状态 (1-启用, 0-禁用)',
+    `is_system`   TINYINT(1)   NOT NULL DEFAULT 0 COMMENT '是否系统内置角色, 内置角色不可删除',
+    `sort`        INT          NOT NULL DEFAULT 0 COMMENT '排序',
+    `created_at`  BIGINT       NOT NULL COMMENT '创建时间戳',
+    `updated_at`  BIGINT       NOT NULL DEFAULT 0 COMMENT '更新时间戳',
+    `created_by`  BIGINT       NOT NULL DEFAULT 0 COMMENT '创建人ID',
+    `updated_by`  BIGINT       NOT NULL DEFAULT 0 COMMENT '更新人ID',
+    UNIQUE KEY `uk_code` (`code`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='角色表';
+
+drop table if exists sys_auth;
+CREATE TABLE `sys_auth`
+(
+    `id`          BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '权限ID',
+    `module_name` VARCHAR(64)  NOT NULL COMMENT '模块名称',
+    `action_name` VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '操作名称',
+    `type`        TINYINT      NOT NULL DEFAULT 3 COMMENT '类型 (1-模块, 2-菜单, 3-操作)',
+    `method`      VARCHAR(10)  NOT NULL DEFAULT '' COMMENT 'HTTP 方法',
+    `url`         VARCHAR(255) NOT NULL DEFAULT '' COMMENT '路由模板',
+    `module_id`   BIGINT       NOT NULL DEFAULT 0 COMMENT '所属模块ID',
+    `sort`        INT          NOT NULL DEFAULT 0 COMMENT '排序',
+    `description` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '描述',
+    `status`      TINYINT      NOT NULL DEFAULT 1 COMMENT '状态 (1-启用, 0-禁用)',
+    `create_time` BIGINT       NOT NULL COMMENT '创建时间戳',
+    `update_time` BIGINT       NOT NULL DEFAULT 0 COMMENT '更新时间戳',
+    `update_user` VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '更新人',
+    INDEX `idx_route` (`method`, `url`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='权限表';
+
+drop table if exists sys_role_permission;
+CREATE TABLE `sys_role_permission`
+(
+    `id`            BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+    `role_id`       BIGINT NOT NULL COMMENT '角色ID',
+    `permission_id` BIGINT NOT NULL COMMENT '权限ID',
+    `created_at`    BIGINT NOT NULL COMMENT '创建时间戳',
+    `created_by`    BIGINT NOT NULL DEFAULT 0 COMMENT '创建人ID',
+    UNIQUE KEY `uk_role_permission` (`role_id`, `permission_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='角色权限关联表';
+
+drop table if exists sys_user_role;
+CREATE TABLE `sys_user_role`
+(
+    `id`         BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+    `user_type`  BIGINT NOT NULL COMMENT '身份类型 (40001-用户, 40002-商家, 40003-管理员)',
+    `user_id`    BIGINT NOT NULL COMMENT '用户ID',
+    `role_id`    BIGINT NOT NULL COMMENT '角色ID',
+    `created_at` BIGINT NOT NULL COMMENT '创建时间戳',
+    `created_by` BIGINT NOT NULL DEFAULT 0 COMMENT '创建人ID',
+    UNIQUE KEY `uk_user_role` (`user_type`, `user_id`, `role_id`),
+    INDEX `idx_role_id` (`role_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='用户角色关联表';
+
+-- 系统内置角色, 每种身份默认拥有对应编码的角色
+insert into sys_role (id, name, code, description, is_system, created_at)
+values (1, '普通用户', 'user', '所有用户默认拥有', 1, unix_timestamp()),
+       (2, '商家', 'merchant', '所有商家默认拥有', 1, unix_timestamp()),
+       (3, '管理员', 'admin', '所有管理员默认拥有', 1, unix_timestamp());
+
+insert into sys_auth (id, module_name, action_name, type, method, url, create_time)
+values (1, '角色管理', '角色列表', 3, 'GET', '/api/v1/admin/role/list', unix_timestamp()),
+       (2, '角色管理', '创建角色', 3, 'PUT', '/api/v1/admin/role/create', unix_timestamp()),
+       (3, '角色管理', '更新角色', 3, 'PATCH', '/api/v1/admin/role/update', unix_timestamp()),
+       (4, '角色管理', '删除角色', 3, 'DELETE', '/api/v1/admin/role/delete/:id', unix_timestamp()),
+       (5, '角色管理', '角色权限', 3, 'GET', '/api/v1/admin/role/permissions/:id', unix_timestamp()),
+       (6, '角色管理', '设置角色权限', 3, 'PUT', '/api/v1/admin/role/permissions/:id', unix_timestamp()),
+       (7, '角色管理', '分配角色', 3, 'PUT', '/api/v1/admin/role/assign', unix_timestamp()),
+       (8, '角色管理', '撤销角色', 3, 'POST', '/api/v1/admin/role/revoke', unix_timestamp()),
+       (9, '角色管理', '权限列表', 3, 'GET', '/api/v1/admin/permission/list', unix_timestamp());
+
+insert into sys_role_permission (role_id, permission_id, created_at)
+select 3, id, unix_timestamp()
+from sys_auth;
@@ -0,0 +1,45 @@
+use shop;
+
+drop table if exists shipments;
+CREATE TABLE `shipments`
+(
+    `id`           BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '发货单ID',
+    `order_id`     BIGINT      NOT NULL COMMENT '关联订单ID',
+    `merchant_id`  BIGINT      NOT NULL COMMENT '发货商家ID',
+    `carrier`      VARCHAR(32) NOT NULL COMMENT '承运商编码',
+    `tracking_no`  VARCHAR(64) NOT NULL COMMENT '运单号',
+    `status`       INT         NOT NULL DEFAULT 130 COMMENT '物流状态 (130-已发货, 131-运输中, 132-已签收, 133-异常)',
+    `shipped_at`   BIGINT      NOT NULL COMMENT '发货时间戳',
+    `delivered_at` BIGINT      NOT NULL DEFAULT 0 COMMENT '签收时间戳',
+    `created_at`   BIGINT      NOT NULL COMMENT '创建时间戳',
+    `updated_at`   BIGINT      NOT NULL DEFAULT 0 COMMENT '更新时间戳',
+    UNIQUE KEY `uk_carrier_tracking` (`carrier`, `tracking_no`),
+    INDEX `idx_order_id` (`order_id`),
+    INDEX `idx_status` (`status`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='发货单表';
+
+drop table if exists shipment_items;
+CREATE TABLE `shipment_items`
+(
+    `shipment_id`   BIGINT NOT NULL COMMENT '发货单ID',
+    `order_item_id` BIGINT NOT NULL COMMENT '订单项ID',
+    PRIMARY KEY (`shipment_id`, `order_item_id`),
+    INDEX `idx_order_item` (`order_item_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='发货单订单项表';
+
+drop table if exists shipment_events;
+CREATE TABLE `shipment_events`
+(
+    `id`          BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '轨迹ID',
+    `shipment_id` BIGINT       NOT NULL COMMENT '发货单ID',
+    `status`      INT          NOT NULL COMMENT '物流状态',
+    `location`    VARCHAR(128) NOT NULL DEFAULT '' COMMENT '所在地',
+    `description` VARCHAR(512) NOT NULL DEFAULT '' COMMENT '轨迹描述',
+    `event_time`  BIGINT       NOT NULL COMMENT '轨迹发生时间戳',
+    `created_at`  BIGINT       NOT NULL COMMENT '入库时间戳',
+    UNIQUE KEY `uk_shipment_event` (`shipment_id`, `event_time`, `status`),
+    INDEX `idx_shipment_time` (`shipment_id`, `event_time`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='物流轨迹表';
@@ -22,3 +22,104 @@ CREATE TABLE IF NOT EXISTS `user`
 ) ENGINE = InnoDB
   AUTO_INCREMENT = 1000001
   DEFAULT CHARSET = utf8mb4 COMMENT = '用户表';
+
+drop table if exists user_sms;
+CREATE TABLE IF NOT EXISTS `user_sms`
+(
+    `id`         BIGINT       NOT NULL AUTO_INCREMENT COMMENT '记录ID',
+    `ip`         VARCHAR(45)  NOT NULL DEFAULT '' COMMENT '请求IP',
+    `phone`      VARCHAR(20)  NOT NULL DEFAULT '' COMMENT '手机号',
+    `send_count` INT          NOT NULL DEFAULT 0 COMMENT '当天发送次数',
+    `add_day`    INT          NOT NULL COMMENT '发送日期, 如 20250101',
+    `add_time`   BIGINT       NOT NULL COMMENT '最近一次发送时间',
+    `sign`       VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '最近一次发送记录的签名',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_phone_ip_day` (`phone`, `ip`, `add_day`),
+    KEY `idx_ip_day` (`ip`, `add_day`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '短信验证码发送记录';
+
+drop table if exists user_totp;
+CREATE TABLE IF NOT EXISTS `user_totp`
+(
+    `user_id`    BIGINT       NOT NULL COMMENT '用户ID',
+    `secret`     VARCHAR(128) NOT NULL COMMENT '加密后的 TOTP 密钥',
+    `enabled`    TINYINT(1)   NOT NULL DEFAULT 0 COMMENT '是否已激活 (0: 待验证, 1: 已启用)',
+    `last_step`  BIGINT       NOT NULL DEFAULT 0 COMMENT '最近一次使用的时间步, 防止验证码重放',
+    `created_at` BIGINT       NOT NULL COMMENT '创建时间',
+    `updated_at` BIGINT       NOT NULL COMMENT '更新时间',
+    PRIMARY KEY (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '用户两步验证';
+
+drop table if exists user_totp_recovery;
+CREATE TABLE IF NOT EXISTS `user_totp_recovery`
+(
+    `id`         BIGINT      NOT NULL AUTO_INCREMENT COMMENT '记录ID',
+    `user_id`    BIGINT      NOT NULL COMMENT '用户ID',
+    `code_hash`  VARCHAR(64) NOT NULL COMMENT '恢复码摘要',
+    `used_at`    BIGINT      NOT NULL DEFAULT 0 COMMENT '使用时间, 0 表示未使用',
+    `created_at` BIGINT      NOT NULL COMMENT '创建时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_user_code` (`user_id`, `code_hash`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '两步验证恢复码';
+
+drop table if exists user_identities;
+CREATE TABLE IF NOT EXISTS `user_identities`
+(
+    `id`         BIGINT       NOT NULL AUTO_INCREMENT COMMENT '记录ID',
+    `user_id`    BIGINT       NOT NULL COMMENT '用户ID',
+    `provider`   VARCHAR(32)  NOT NULL COMMENT '第三方登录提供方, 与配置中的 name 一致',
+    `subject`    VARCHAR(255) NOT NULL COMMENT '提供方内的账号唯一标识',
+    `email`      VARCHAR(100) NOT NULL DEFAULT '' COMMENT '提供方返回的邮箱',
+    `name`       VARCHAR(255) NOT NULL DEFAULT '' COMMENT '提供方返回的昵称',
+    `created_at` BIGINT       NOT NULL COMMENT '绑定时间',
+    `updated_at` BIGINT       NOT NULL COMMENT '最近一次登录时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_provider_subject` (`provider`, `subject`),
+    UNIQUE KEY `uk_user_provider` (`user_id`, `provider`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '用户第三方账号绑定';
+
+drop table if exists user_address;
+CREATE TABLE IF NOT EXISTS `user_address`
+(
+    `id`              BIGINT       NOT NULL AUTO_INCREMENT COMMENT '地址ID, 订单的 shipping_id 引用该字段',
+    `uid`             BIGINT       NOT NULL COMMENT '用户ID',
+    `phone`           VARCHAR(20)  NOT NULL DEFAULT '' COMMENT '收货人手机号',
+    `name`            VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '收货人姓名',
+    `address`         VARCHAR(512) NOT NULL DEFAULT '' COMMENT '详细地址',
+    `default_address` TINYINT(1)   NOT NULL DEFAULT 0 COMMENT '是否默认地址',
+    `add_time`        BIGINT       NOT NULL DEFAULT 0 COMMENT '添加时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_uid` (`uid`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '用户收货地址';
+
+drop table if exists product_collect;
+CREATE TABLE IF NOT EXISTS `product_collect`
+(
+    `id`          BIGINT NOT NULL AUTO_INCREMENT COMMENT '收藏ID',
+    `user_id`     BIGINT NOT NULL COMMENT '用户ID',
+    `product_id`  BIGINT NOT NULL COMMENT '商品ID',
+    `add_time`    BIGINT NOT NULL DEFAULT 0 COMMENT '收藏时间',
+    `delete_time` BIGINT NOT NULL DEFAULT 0 COMMENT '取消收藏时间, 0 表示未取消',
+    PRIMARY KEY (`id`),
+    KEY `idx_user_id` (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '商品收藏';
+
+drop table if exists user_deletion_requests;
+CREATE TABLE IF NOT EXISTS `user_deletion_requests`
+(
+    `user_id`      BIGINT NOT NULL COMMENT '用户ID',
+    `status`       INT    NOT NULL COMMENT '状态 (160-冷静期, 161-已撤销, 162-已注销)',
+    `requested_at` BIGINT NOT NULL COMMENT '申请时间',
+    `erase_at`     BIGINT NOT NULL COMMENT '计划注销时间, 冷静期结束时间',
+    `cancelled_at` BIGINT NOT NULL DEFAULT 0 COMMENT '撤销时间',
+    `erased_at`    BIGINT NOT NULL DEFAULT 0 COMMENT '完成注销时间',
+    PRIMARY KEY (`user_id`),
+    KEY `idx_status_erase_at` (`status`, `erase_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT = '账号注销申请';
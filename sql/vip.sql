@@ -0,0 +1,70 @@
+use shop;
+
+drop table if exists vip_tier;
+CREATE TABLE `vip_tier`
+(
+    `level`                   BIGINT      NOT NULL COMMENT '会员等级, 数字越大等级越高',
+    `name`                    VARCHAR(64) NOT NULL COMMENT '等级名称',
+    `discount_percent`        BIGINT      NOT NULL DEFAULT 100 COMMENT '会员价折扣百分比, 如 95 表示按原价的 95% 计价',
+    `free_shipping_threshold` BIGINT      NOT NULL DEFAULT -1 COMMENT '包邮门槛（单位：分）, 0 表示全部包邮, -1 表示不包邮',
+    PRIMARY KEY (`level`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='会员等级及权益表';
+
+drop table if exists vip_plan;
+CREATE TABLE `vip_plan`
+(
+    `id`             BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '套餐ID',
+    `tier_level`     BIGINT      NOT NULL COMMENT '开通的会员等级',
+    `name`           VARCHAR(64) NOT NULL COMMENT '套餐名称',
+    `duration_days`  INT         NOT NULL COMMENT '有效天数',
+    `price`          BIGINT      NOT NULL DEFAULT 0 COMMENT '价格（单位：分）, 0 表示不能购买',
+    `earn_threshold` BIGINT      NOT NULL DEFAULT 0 COMMENT '消费满该金额可免费获得（单位：分）, 0 表示不能通过消费获得',
+    `status`         INT         NOT NULL DEFAULT 60 COMMENT '状态 (60-正常, 61-下架)',
+    `created_at`     BIGINT      NOT NULL COMMENT '创建时间戳',
+    INDEX `idx_status` (`status`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='会员套餐表';
+
+drop table if exists user_membership;
+CREATE TABLE `user_membership`
+(
+    `user_id`      BIGINT       NOT NULL COMMENT '用户ID',
+    `plan_id`      BIGINT       NOT NULL COMMENT '最近一次开通的套餐ID, 自动续费使用该套餐',
+    `tier_level`   BIGINT       NOT NULL COMMENT '会员等级',
+    `status`       INT          NOT NULL COMMENT '状态 (170-生效中, 171-已过期)',
+    `started_at`   BIGINT       NOT NULL COMMENT '本期开始时间戳',
+    `expires_at`   BIGINT       NOT NULL COMMENT '到期时间戳',
+    `auto_renew`   TINYINT(1)   NOT NULL DEFAULT 0 COMMENT '是否自动续费',
+    `agreement_no` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '支付代扣协议号',
+    `updated_at`   BIGINT       NOT NULL COMMENT '更新时间戳',
+    PRIMARY KEY (`user_id`),
+    INDEX `idx_status_expires` (`status`, `expires_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='用户会员表';
+
+drop table if exists vip_order;
+CREATE TABLE `vip_order`
+(
+    `id`           BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '会员订单ID',
+    `user_id`      BIGINT      NOT NULL COMMENT '用户ID',
+    `plan_id`      BIGINT      NOT NULL COMMENT '套餐ID',
+    `kind`         INT         NOT NULL COMMENT '类型 (180-购买, 181-自动续费, 182-消费达标获得)',
+    `amount`       BIGINT      NOT NULL DEFAULT 0 COMMENT '实付金额（单位：分）',
+    `out_trade_no` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '商户订单号',
+    `trade_no`     VARCHAR(64) NOT NULL DEFAULT '' COMMENT '支付服务商交易号',
+    `created_at`   BIGINT      NOT NULL COMMENT '创建时间戳',
+    UNIQUE KEY `uk_out_trade_no` (`out_trade_no`),
+    INDEX `idx_user_id` (`user_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='会员订单表';
+
+INSERT INTO `vip_tier` (`level`, `name`, `discount_percent`, `free_shipping_threshold`)
+VALUES (1, '星享会员', 95, 9900),
+       (2, '星耀会员', 90, 0);
+
+INSERT INTO `vip_plan` (`tier_level`, `name`, `duration_days`, `price`, `earn_threshold`, `status`, `created_at`)
+VALUES (1, '星享会员月卡', 30, 1500, 0, 60, UNIX_TIMESTAMP()),
+       (1, '星享会员年卡', 365, 14800, 0, 60, UNIX_TIMESTAMP()),
+       (2, '星耀会员年卡', 365, 29800, 0, 60, UNIX_TIMESTAMP()),
+       (2, '星耀会员(消费达标)', 365, 0, 500000, 60, UNIX_TIMESTAMP());
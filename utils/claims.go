@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/star-find-cloud/star-mall/domain"
+	appjwt "github.com/star-find-cloud/star-mall/pkg/jwt"
+	"net/http"
+)
+
+// ErrInvalidClaims 上下文中没有有效的 JWT claims
+var ErrInvalidClaims = errors.New("invalid token claims")
+
+// GetClaims 从 gin 上下文中获取 middleware.JwtAuth 解析出的 claims
+func GetClaims(c *gin.Context) (*appjwt.CustomClaims, error) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil, ErrInvalidClaims
+	}
+	customClaims, ok := claims.(*appjwt.CustomClaims)
+	if !ok || customClaims == nil {
+		return nil, ErrInvalidClaims
+	}
+	return customClaims, nil
+}
+
+// MustClaims 获取 claims, 失败时直接返回 401; ok 为 false 时调用方应立即返回.
+// roles 不为空时, 只允许其中的角色访问, 管理员始终放行
+func MustClaims(c *gin.Context, roles ...int64) (*appjwt.CustomClaims, bool) {
+	customClaims, err := GetClaims(c)
+	if err != nil {
+		RespondError(c, http.StatusUnauthorized, "invalid token claims", err)
+		return nil, false
+	}
+	if len(roles) == 0 || customClaims.Actor().IsAdmin() {
+		return customClaims, true
+	}
+	for _, role := range roles {
+		if customClaims.Roles == role {
+			return customClaims, true
+		}
+	}
+	RespondError(c, http.StatusForbidden, "permission denied", domain.ErrForbidden)
+	return nil, false
+}
+
+// ErrorStatus 根据 service 返回的错误选择响应状态码, 越权访问返回 403, 刷新 token 无效返回 401, 发送过于频繁返回 429, 重复开启或重复绑定返回 409, 记录不存在返回 404, 其余返回 fallback
+func ErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, domain.ErrForbidden), errors.Is(err, domain.ErrSystemRole), errors.Is(err, domain.ErrAccountBanned), errors.Is(err, domain.ErrMerchantNotApproved),
+		errors.Is(err, domain.ErrTOTPRequired), errors.Is(err, domain.ErrVipNotEligible), errors.Is(err, domain.ErrCouponVipOnly):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrRefreshTokenInvalid), errors.Is(err, domain.ErrRefreshTokenReused), errors.Is(err, domain.ErrMFATokenInvalid),
+		errors.Is(err, domain.ErrOAuthStateInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, domain.ErrOTPInvalid), errors.Is(err, domain.ErrOTPExpired), errors.Is(err, domain.ErrOTPAttemptsExceeded),
+		errors.Is(err, domain.ErrTOTPInvalid), errors.Is(err, domain.ErrTOTPNotEnrolled), errors.Is(err, domain.ErrVipPlanNotPurchasable),
+		errors.Is(err, domain.ErrUnsupportedSort), errors.Is(err, domain.ErrImageTypeUnsupported), errors.Is(err, domain.ErrImageHashMismatch),
+		errors.Is(err, domain.ErrImageSizeUnknown), errors.Is(err, domain.ErrCouponUnavailable):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrPaymentFailed):
+		return http.StatusPaymentRequired
+	case errors.Is(err, domain.ErrOTPTooFrequent), errors.Is(err, domain.ErrSmsPhoneQuota), errors.Is(err, domain.ErrSmsIPQuota),
+		errors.Is(err, domain.ErrLoginLocked), errors.Is(err, domain.ErrLoginThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, domain.ErrTOTPAlreadyEnabled), errors.Is(err, domain.ErrIdentityLinked), errors.Is(err, domain.ErrProviderAlreadyBound),
+		errors.Is(err, domain.ErrIdentityEmailTaken), errors.Is(err, domain.ErrDeletionPending), errors.Is(err, domain.ErrVipDowngrade),
+		errors.Is(err, domain.ErrCouponSoldOut), errors.Is(err, domain.ErrCouponClaimLimit), errors.Is(err, domain.ErrOrderNotCancelable):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrRoleNotFound), errors.Is(err, domain.ErrLockNotFound), errors.Is(err, domain.ErrIdentityNotFound),
+		errors.Is(err, domain.ErrDeletionNotFound), errors.Is(err, domain.ErrUnknownOAuthProvider), errors.Is(err, domain.ErrVipPlanNotFound),
+		errors.Is(err, domain.ErrMembershipNotFound), errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	}
+	return fallback
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"strings"
+)
+
+// trustedProxies 信任的反向代理, 启动时通过 SetTrustedProxies 设置
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies 设置信任的反向代理, 支持单个 IP 和 CIDR. 为空时不信任任何代理, 只使用直连地址
+func SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// ClientIP 返回用于限流和登录保护的客户端 IP. gin 的 ClientIP 直接信任 X-Forwarded-For, 客户端可以伪造.
+// 这里只有直连地址是信任的代理时才读取 X-Forwarded-For, 从右向左跳过信任的代理, 取第一个不可信的地址
+func ClientIP(c *gin.Context) string {
+	remote := strings.TrimSpace(c.Request.RemoteAddr)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	hops := strings.Split(c.GetHeader("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		remote = hop
+	}
+	return remote
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
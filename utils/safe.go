@@ -29,3 +29,9 @@ func Bcrypt(str string) (string, error) {
 
 	return string(hash), err
 }
+
+// VerifyPhone 验证中国大陆手机号
+func VerifyPhone(phone string) bool {
+	reg := regexp.MustCompile(`^1[3-9]\d{9}$`)
+	return reg.MatchString(phone)
+}